@@ -66,6 +66,14 @@ func (cmd *applyCommand) Run(args []string) error {
 		run = cmd.applyUser
 	case "dep-autoassigner":
 		run = cmd.applyDEPAutoAssigner
+	case "dep-assignments":
+		run = cmd.applyDEPAssignments
+	case "groups":
+		run = cmd.applyGroup
+	case "devices":
+		run = cmd.applyDevices
+	case "device-attributes":
+		run = cmd.applyDeviceAttribute
 	default:
 		cmd.Usage()
 		os.Exit(1)
@@ -85,6 +93,10 @@ Valid resource types:
   * dep-tokens
   * dep-profiles
   * dep-autoassigner
+  * dep-assignments
+  * groups
+  * devices
+  * device-attributes
   * app
   * block
 
@@ -92,11 +104,30 @@ Examples:
   # Apply a Blueprint.
   mdmctl apply blueprints -f /path/to/blueprint.json
 
+  # Show what an edited Blueprint would remove from devices, without applying it.
+  mdmctl apply blueprints -f /path/to/blueprint.json -dry-run
+
+  # Apply a Blueprint to devices in its scope now, or to every enrolled device in its scope without -udid.
+  mdmctl apply blueprints -name "Staff Laptops" -udid UDID1,UDID2
+
   # Apply a DEP Profile.
   mdmctl apply dep-profiles -f /path/to/dep-profile.json
 
+  # Assign the latest version of a DEP Profile in the library to devices.
+  mdmctl apply dep-assignments -name "Staff Laptops" -serials C02ABCDEF,C02GHIJKL
+
+  # Apply a dynamic group of the enrolled devices running a release before 14.
+  mdmctl apply groups -name "Needs Update" -filter='os_version<14 and enrolled'
+
+  # Define a custom device attribute, and set it and a tag on devices.
+  mdmctl apply device-attributes -name department -type string
+  mdmctl apply devices -serials C02ABCDEF,C02GHIJKL -attr department=Sales -tags loaner
+
+  # Set custom attributes and tags from a CSV file.
+  mdmctl apply devices -f /path/to/devices.csv
+
 `
-	fmt.Println(applyUsage)
+	fmt.Print(applyUsage)
 	return nil
 }
 
@@ -105,6 +136,9 @@ func (cmd *applyCommand) applyBlueprint(args []string) error {
 	var (
 		flBlueprintPath = flagset.String("f", "", "filename of blueprint JSON to apply")
 		flTemplate      = flagset.Bool("template", false, "print a new blueprint template")
+		flName          = flagset.String("name", "", "name of a blueprint to apply to devices now")
+		flUDIDs         = flagset.String("udid", "", "comma separated UDIDs to apply the -name blueprint to. defaults to every enrolled device in its scope")
+		flDryRun        = flagset.Bool("dry-run", false, "show the profiles and applications which the -f blueprint would remove from devices, without applying it")
 	)
 	flagset.Usage = usageFor(flagset, "mdmctl apply blueprints [flags]")
 	if err := flagset.Parse(args); err != nil {
@@ -129,9 +163,25 @@ func (cmd *applyCommand) applyBlueprint(args []string) error {
 		return nil
 	}
 
+	if *flName != "" {
+		var udids []string
+		if *flUDIDs != "" {
+			udids = strings.Split(*flUDIDs, ",")
+		}
+		applied, err := cmd.blueprintsvc.ApplyToDevices(context.Background(), *flName, udids)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("applied blueprint %s to %d devices\n", *flName, len(applied))
+		for _, udid := range applied {
+			fmt.Println(udid)
+		}
+		return nil
+	}
+
 	if *flBlueprintPath == "" {
 		flagset.Usage()
-		return errors.New("bad input: must provide -f or -template flag")
+		return errors.New("bad input: must provide -f, -name or -template flag")
 	}
 
 	if *flBlueprintPath != "" {
@@ -151,6 +201,14 @@ func (cmd *applyCommand) applyBlueprint(args []string) error {
 		}
 
 		ctx := context.Background()
+		if *flDryRun {
+			removals, err := cmd.blueprintsvc.PreviewRemovals(ctx, blueprint.PreviewRemovalsOption{Blueprint: &blpt})
+			if err != nil {
+				return err
+			}
+			printRemovals(removals)
+			return nil
+		}
 		err = cmd.blueprintsvc.ApplyBlueprint(ctx, &blpt)
 		if err != nil {
 			return err
@@ -169,6 +227,7 @@ func (cmd *applyCommand) applyDEPTokens(args []string) error {
 			"import",
 			filepath.Join(defaultmdmctlFilesPath, "DEPOAuthToken.json"),
 			"Filename of p7m encrypted token file (downloaded from DEP portal)")
+		flName = flagset.String("name", "", "name of the DEP token, required to add more than one token. renewed tokens keep their name")
 	)
 
 	flagset.Usage = usageFor(flagset, "mdmctl apply dep-tokens [flags]")
@@ -187,7 +246,7 @@ func (cmd *applyCommand) applyDEPTokens(args []string) error {
 		return err
 	}
 	ctx := context.Background()
-	err = cmd.configsvc.ApplyDEPToken(ctx, p7mBytes)
+	err = cmd.configsvc.ApplyDEPToken(ctx, p7mBytes, *flName)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+)
+
+func (cmd *applyCommand) applyDEPAssignments(args []string) error {
+	flagset := flag.NewFlagSet("dep-assignments", flag.ExitOnError)
+	var (
+		flSerials = flagset.String("serials", "", "comma separated list of device serials")
+		flUUID    = flagset.String("uuid", "", "UUID of the DEP profile to assign")
+		flName    = flagset.String("name", "", "name of a profile in the DEP profile library. the latest version is assigned")
+		flToken   = flagset.String("token", "", "name of the DEP token, as set by apply dep-tokens -name")
+	)
+	flagset.Usage = usageFor(flagset, "mdmctl apply dep-assignments [flags]")
+	if err := flagset.Parse(args); err != nil {
+		return err
+	}
+	if *flSerials == "" {
+		flagset.Usage()
+		return errors.New("bad input: must provide a comma separated list of DEP serials")
+	}
+	if (*flUUID == "") == (*flName == "") {
+		flagset.Usage()
+		return errors.New("bad input: must provide one of -uuid or -name")
+	}
+
+	ctx := context.Background()
+	profileUUID := *flUUID
+	if *flName != "" {
+		versions, err := cmd.depsvc.ListProfiles(ctx, *flToken, *flName)
+		if err != nil {
+			return err
+		}
+		if len(versions) == 0 {
+			return errors.Errorf("no DEP profile named %s in the library", *flName)
+		}
+		profileUUID = versions[len(versions)-1].ProfileUUID
+	}
+
+	resp, err := cmd.depsvc.AssignProfile(ctx, *flToken, profileUUID, strings.Split(*flSerials, ","))
+	if err != nil {
+		return errors.Wrap(err, "assign dep profile")
+	}
+	fmt.Printf("Assigned DEP Profile with UUID %s\n", profileUUID)
+	printDEPDeviceStatuses(resp.Devices)
+	return nil
+}
+
+// printDEPDeviceStatuses prints the status the DEP API returned for each serial.
+func printDEPDeviceStatuses(devices map[string]string) {
+	serials := make([]string, 0, len(devices))
+	for serial := range devices {
+		serials = append(serials, serial)
+	}
+	sort.Strings(serials)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "SerialNumber\tStatus\n")
+	for _, serial := range serials {
+		fmt.Fprintf(w, "%s\t%s\n", serial, devices[serial])
+	}
+	w.Flush()
+}
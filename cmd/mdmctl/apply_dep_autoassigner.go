@@ -12,8 +12,14 @@ import (
 func (cmd *applyCommand) applyDEPAutoAssigner(args []string) error {
 	flagset := flag.NewFlagSet("dep-autoassigner", flag.ExitOnError)
 	var (
-		flFilter      = flagset.String("filter", "*", "filter string (only '*' supported right now)")
+		flFilter = flagset.String("filter", "*",
+			"'*' for every device, or conditions separated by ';' such as 'model=MacBook Air;serial^=C02'.\n"+
+				"attributes: serial, model, os, device_family, color, description, order_number, device_assigned_by,\n"+
+				"attr.<name> for a custom device attribute and tag for any device tag.\n"+
+				"operators: '=' equals, '^=' starts with, '~=' matches a regular expression")
 		flProfileUUID = flagset.String("uuid", "", "DEP profile UUID to set")
+		flToken       = flagset.String("token", "", "name of the DEP token, as set by apply dep-tokens -name")
+		flPriority    = flagset.Int("priority", 0, "auto-assigners with a higher priority are matched first")
 	)
 	flagset.Usage = usageFor(flagset, "mdmctl apply dep-autoassigner [flags]")
 	if err := flagset.Parse(args); err != nil {
@@ -24,7 +30,12 @@ func (cmd *applyCommand) applyDEPAutoAssigner(args []string) error {
 		return errors.New("bad input: must provide both -filter and -uuid")
 	}
 
-	assigner := sync.AutoAssigner{*flFilter, *flProfileUUID}
+	assigner := sync.AutoAssigner{
+		Filter:      *flFilter,
+		ProfileUUID: *flProfileUUID,
+		TokenName:   *flToken,
+		Priority:    *flPriority,
+	}
 
 	err := cmd.depsyncsvc.ApplyAutoAssigner(context.TODO(), &assigner)
 	if err != nil {
@@ -32,6 +43,6 @@ func (cmd *applyCommand) applyDEPAutoAssigner(args []string) error {
 	}
 
 	fmt.Printf("saved auto-assign filter '%s' to DEP profile UUID '%s'\n", assigner.Filter, assigner.ProfileUUID)
-	fmt.Println("newly added DEP devices will be auto-assigned to the above profile UUID")
+	fmt.Println("newly added DEP devices matching the filter will be auto-assigned to the above profile UUID")
 	return nil
 }
@@ -42,6 +42,7 @@ func (cmd *applyCommand) applyDEPProfile(args []string) error {
 		flAnchorFile  = flagset.String("anchor", "", "filename of PEM cert(s) to add to anchor certs in template")
 		flUseServer   = flagset.Bool("use-server-cert", false, "use the server cert(s) to add to anchor certs in template")
 		flFilter      = flagset.String("filter", "", "set the auto-assign filter to for the defined profile")
+		flToken       = flagset.String("token", "", "name of the DEP token, as set by apply dep-tokens -name")
 	)
 	flagset.Usage = usageFor(flagset, "mdmctl apply dep-profiles [flags]")
 	if err := flagset.Parse(args); err != nil {
@@ -91,7 +92,7 @@ func (cmd *applyCommand) applyDEPProfile(args []string) error {
 		return errors.Wrap(err, "decode DEP Profile JSON")
 	}
 
-	resp, err := cmd.depsvc.DefineProfile(context.TODO(), &profile)
+	resp, err := cmd.depsvc.DefineProfile(context.TODO(), *flToken, &profile)
 	if err != nil {
 		return errors.Wrap(err, "define dep profile")
 	}
@@ -101,7 +102,7 @@ func (cmd *applyCommand) applyDEPProfile(args []string) error {
 	fmt.Printf("Defined DEP Profile with UUID %s\n", resp.ProfileUUID)
 
 	if *flFilter != "" {
-		assigner := sync.AutoAssigner{*flFilter, resp.ProfileUUID}
+		assigner := sync.AutoAssigner{Filter: *flFilter, ProfileUUID: resp.ProfileUUID, TokenName: *flToken}
 		err := cmd.depsyncsvc.ApplyAutoAssigner(context.TODO(), &assigner)
 		if err != nil {
 			return errors.Wrap(err, "set auto-assigner")
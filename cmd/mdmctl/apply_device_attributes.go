@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/device"
+)
+
+func (cmd *applyCommand) applyDeviceAttribute(args []string) error {
+	flagset := flag.NewFlagSet("device-attributes", flag.ExitOnError)
+	var (
+		flName        = flagset.String("name", "", "name of the attribute, used in filters as attr.<name>")
+		flType        = flagset.String("type", "string", "type of the attribute values: string, number, bool or date")
+		flDescription = flagset.String("description", "", "description of the attribute")
+	)
+	flagset.Usage = usageFor(flagset, "mdmctl apply device-attributes [flags]")
+	if err := flagset.Parse(args); err != nil {
+		return err
+	}
+	if *flName == "" {
+		flagset.Usage()
+		return errors.New("bad input: must provide -name")
+	}
+
+	a := device.Attribute{
+		Name:        *flName,
+		Type:        device.AttributeType(*flType),
+		Description: *flDescription,
+	}
+	ctx := context.Background()
+	if err := cmd.devicesvc.ApplyAttribute(ctx, &a); err != nil {
+		return err
+	}
+	fmt.Printf("applied device attribute %s\n", a.Name)
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/device"
+)
+
+// attributeFlags collects repeated -attr name=value flags.
+type attributeFlags map[string]string
+
+func (f attributeFlags) String() string { return "" }
+
+func (f attributeFlags) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i < 1 {
+		return errors.Errorf("invalid attribute %q, want name=value", s)
+	}
+	f[strings.TrimSpace(s[:i])] = s[i+1:]
+	return nil
+}
+
+func (cmd *applyCommand) applyDevices(args []string) error {
+	flagset := flag.NewFlagSet("devices", flag.ExitOnError)
+	var (
+		flPath        = flagset.String("f", "", "filename of a CSV with a serial_number or udid column, a tags column and a column per attribute")
+		flSerials     = flagset.String("serials", "", "comma separated serials of the devices to update")
+		flUDIDs       = flagset.String("udids", "", "comma separated UDIDs of the devices to update")
+		flTags        = flagset.String("tags", "", "comma separated tags to add")
+		flRemoveTags  = flagset.String("remove-tags", "", "comma separated tags to remove")
+		flReplaceTags = flagset.Bool("replace-tags", false, "replace the tags of the devices with -tags")
+		flAttributes  = make(attributeFlags)
+	)
+	flagset.Var(flAttributes, "attr", "set a custom attribute as name=value, an empty value removes it. May be repeated")
+	flagset.Usage = usageFor(flagset, "mdmctl apply devices [flags]")
+	if err := flagset.Parse(args); err != nil {
+		return err
+	}
+
+	var updates []device.DeviceUpdate
+	if *flPath != "" {
+		f, err := os.Open(*flPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		updates, err = device.ParseDeviceUpdatesCSV(f)
+		if err != nil {
+			return errors.Wrapf(err, "read %s", *flPath)
+		}
+	} else {
+		update := device.DeviceUpdate{
+			Attributes:  flAttributes,
+			Tags:        splitList(*flTags),
+			ReplaceTags: *flReplaceTags,
+			RemoveTags:  splitList(*flRemoveTags),
+		}
+		for _, serial := range splitList(*flSerials) {
+			u := update
+			u.SerialNumber = serial
+			updates = append(updates, u)
+		}
+		for _, udid := range splitList(*flUDIDs) {
+			u := update
+			u.UDID = udid
+			updates = append(updates, u)
+		}
+	}
+	if len(updates) == 0 {
+		flagset.Usage()
+		return errors.New("bad input: must provide -f, -serials or -udids")
+	}
+
+	ctx := context.Background()
+	if err := cmd.devicesvc.UpdateDevices(ctx, updates); err != nil {
+		return err
+	}
+	fmt.Printf("updated %d device(s)\n", len(updates))
+	return nil
+}
+
+// splitList splits a comma separated list, and returns nil for an empty one.
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
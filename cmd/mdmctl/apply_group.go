@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/group"
+)
+
+func (cmd *applyCommand) applyGroup(args []string) error {
+	flagset := flag.NewFlagSet("groups", flag.ExitOnError)
+	var (
+		flPath        = flagset.String("f", "", "filename of group JSON to apply")
+		flName        = flagset.String("name", "", "name of the group")
+		flDescription = flagset.String("description", "", "description of the group")
+		flUDIDs       = flagset.String("udids", "", "comma separated UDIDs of the devices in a static group")
+		flSerials     = flagset.String("serials", "", "comma separated serials of the devices in a static group")
+		flFilter      = flagset.String("filter", "", "filter expression of a dynamic group, for example 'os_version<14 and enrolled'")
+		flSearch      = flagset.String("search", "", "only devices whose name or asset tag contains this text are in the dynamic group")
+	)
+	flagset.Usage = usageFor(flagset, "mdmctl apply groups [flags]")
+	if err := flagset.Parse(args); err != nil {
+		return err
+	}
+
+	var g group.Group
+	if *flPath != "" {
+		data, err := readBytesFromPath(*flPath)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &g); err != nil {
+			return errors.Wrapf(err, "decode group %s", *flPath)
+		}
+	} else {
+		g = group.Group{
+			Name:        *flName,
+			Description: *flDescription,
+			Filter:      *flFilter,
+			Query:       *flSearch,
+		}
+		if *flUDIDs != "" {
+			g.UDIDs = strings.Split(*flUDIDs, ",")
+		}
+		if *flSerials != "" {
+			g.Serials = strings.Split(*flSerials, ",")
+		}
+	}
+	if g.Name == "" {
+		flagset.Usage()
+		return errors.New("bad input: must provide -f or -name")
+	}
+
+	ctx := context.Background()
+	if err := cmd.groupsvc.ApplyGroup(ctx, &g); err != nil {
+		return err
+	}
+	fmt.Printf("applied group %s\n", g.Name)
+	return nil
+}
@@ -80,7 +80,7 @@ mdmctl config print
 mdmctl config set -h
 mdmctl config switch -h
 `
-	fmt.Println(help)
+	fmt.Print(help)
 	return nil
 }
 
@@ -118,7 +118,7 @@ func migrateServerConfig(configName string) error {
 	}
 	err = switchServerConfig(configName)
 	if err != nil {
-		fmt.Errorf("Failed to set %s as active config", configName)
+		return errors.Wrapf(err, "failed to set %s as active config", configName)
 	}
 	fmt.Println("Successfully migrated old config.")
 	return nil
@@ -17,6 +17,7 @@ import (
 
 	"github.com/vishnuvaradaraj/micromdm/pkg/crypto"
 	"github.com/vishnuvaradaraj/micromdm/platform/blueprint"
+	"github.com/vishnuvaradaraj/micromdm/platform/config"
 	"github.com/vishnuvaradaraj/micromdm/platform/device"
 	"github.com/vishnuvaradaraj/micromdm/platform/profile"
 )
@@ -66,6 +67,8 @@ func (cmd *getCommand) Run(args []string) error {
 		run = cmd.getDepTokens
 	case "blueprints":
 		run = cmd.getBlueprints
+	case "blueprint-compliance":
+		run = cmd.getBlueprintCompliance
 	case "profiles":
 		run = cmd.getProfiles
 	case "users":
@@ -74,6 +77,14 @@ func (cmd *getCommand) Run(args []string) error {
 		run = cmd.getApps
 	case "dep-autoassigners":
 		run = cmd.getDEPAutoAssigners
+	case "groups":
+		run = cmd.getGroups
+	case "device-attributes":
+		run = cmd.getDeviceAttributes
+	case "device-history":
+		run = cmd.getDeviceHistory
+	case "stale-actions":
+		run = cmd.getStaleActions
 	default:
 		cmd.Usage()
 		os.Exit(1)
@@ -90,11 +101,16 @@ Valid resource types:
 
   * devices
   * blueprints
+  * blueprint-compliance
   * dep-tokens
   * dep-devices
   * dep-account
   * dep-profiles
   * dep-autoassigners
+  * groups
+  * device-attributes
+  * device-history
+  * stale-actions
   * users
   * profiles
   * apps
@@ -103,17 +119,35 @@ Examples:
   # Get a list of devices
   mdmctl get devices
 
-  # Get a device by serial (TODO implement filtering)
-  mdmctl get devices -serial=C02ABCDEF
+  # Get devices by serial
+  mdmctl get devices -serials=C02ABCDEF,C02GHIJKL
+
+  # Get enrolled devices running a release before 14, most recently seen first
+  mdmctl get devices -filter='os_version<14 and enrolled' -sort=-last_seen
+
+  # Get the devices in a group
+  mdmctl get devices -group="Needs Update"
+
+  # Get the devices of the Sales department tagged as loaners
+  mdmctl get devices -filter='attr.department=Sales and tag=loaner'
+
+  # Get the enrollments and OS updates of a device in the last week
+  mdmctl get device-history -udid=UDID -type=enrolled,re_enrolled,os_updated -since=168h
+
+  # Get the blueprint profiles and applications which failed or went missing on a device
+  mdmctl get blueprint-compliance -udid=UDID
+
+  # Get the actions the stale device policy took on a device, and why
+  mdmctl get stale-actions -serial=C02ABCDEF
 `
-	fmt.Println(getUsage)
+	fmt.Print(getUsage)
 	return nil
 }
 
 type devicesTableOutput struct{ w *tabwriter.Writer }
 
 func (out *devicesTableOutput) BasicHeader() {
-	fmt.Fprintf(out.w, "UDID\tSerialNumber\tEnrollmentStatus\tLastSeen\n")
+	fmt.Fprintf(out.w, "UDID\tSerialNumber\tModel\tOSVersion\tEnrollmentStatus\tLastSeen\tTags\n")
 }
 
 func (out *devicesTableOutput) BasicFooter() {
@@ -124,6 +158,11 @@ func (cmd *getCommand) getDevices(args []string) error {
 	flagset := flag.NewFlagSet("devices", flag.ExitOnError)
 	var (
 		flFilterSerials = flagset.String("serials", "", "comma seperated list of serials to search")
+		flFilter        = flagset.String("filter", "", "filter expression, for example 'os_version<14 and enrolled'")
+		flSearch        = flagset.String("search", "", "only list devices whose name or asset tag contains this text")
+		flSort          = flagset.String("sort", "", "field to sort by, prefixed with - for descending order")
+		flLimit         = flagset.Int("limit", 0, "maximum number of devices to list, 0 to list every device")
+		flGroup         = flagset.String("group", "", "only list the devices in this group")
 	)
 	flagset.Usage = usageFor(flagset, "mdmctl get devices [flags]")
 	if err := flagset.Parse(args); err != nil {
@@ -142,14 +181,41 @@ func (cmd *getCommand) getDevices(args []string) error {
 		flFilterSerialsSlice = strings.Split(*flFilterSerials, ",")
 	}
 
-	devices, err := cmd.devicesvc.ListDevices(ctx, device.ListDevicesOption{FilterSerial: flFilterSerialsSlice})
-	if err != nil {
-		return err
+	opt := device.ListDevicesOption{
+		FilterSerial: flFilterSerialsSlice,
+		Filter:       *flFilter,
+		Query:        *flSearch,
+		Sort:         *flSort,
+		Fields:       []string{"model", "os_version", "enrolled", "last_seen", "tags"},
 	}
-	for _, d := range devices {
-		fmt.Fprintf(out.w, "%s\t%s\t%v\t%s\n", d.UDID, d.SerialNumber, d.EnrollmentStatus, d.LastSeen)
+	// list the devices a page at a time, so that large fleets don't need a
+	// single huge response.
+	const perPage = 500
+	listed := 0
+	for {
+		opt.PerPage = perPage
+		if *flLimit > 0 && *flLimit-listed < perPage {
+			opt.PerPage = *flLimit - listed
+		}
+		var page *device.DevicePage
+		var err error
+		if *flGroup != "" {
+			page, err = cmd.groupsvc.ListGroupDevices(ctx, *flGroup, opt)
+		} else {
+			page, err = cmd.devicesvc.ListDevices(ctx, opt)
+		}
+		if err != nil {
+			return err
+		}
+		for _, d := range page.Devices {
+			fmt.Fprintf(out.w, "%s\t%s\t%s\t%s\t%v\t%s\t%s\n", d.UDID, d.SerialNumber, d.Model, d.OSVersion, d.EnrollmentStatus, d.LastSeen, strings.Join(d.Tags, ","))
+		}
+		listed += len(page.Devices)
+		if page.NextCursor == "" || (*flLimit > 0 && listed >= *flLimit) {
+			return nil
+		}
+		opt.Cursor = page.NextCursor
 	}
-	return nil
 }
 
 const defaultmdmctlFilesPath = "mdm-files"
@@ -167,6 +233,7 @@ func (cmd *getCommand) getDepTokens(args []string) error {
 			"export-token",
 			filepath.Join(defaultmdmctlFilesPath, "DEPOAuthToken.json"),
 			"Filename to save decrypted oauth token (JSON)")
+		flToken = flagset.String("token", "", "name of the DEP token to export, if there is more than one")
 	)
 	flagset.Usage = usageFor(flagset, "mdmctl get dep-tokens [flags]")
 	if err := flagset.Parse(args); err != nil {
@@ -174,7 +241,7 @@ func (cmd *getCommand) getDepTokens(args []string) error {
 	}
 
 	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
-	fmt.Fprintf(w, "ConsumerKey\tAccessTokenExpiry\n")
+	fmt.Fprintf(w, "Name\tConsumerKey\tAccessTokenExpiry\n")
 	ctx := context.Background()
 	tokens, certBytes, err := cmd.configsvc.GetDEPTokens(ctx)
 	if err != nil {
@@ -187,7 +254,7 @@ func (cmd *getCommand) getDepTokens(args []string) error {
 		} else {
 			ckTrimmed = t.ConsumerKey
 		}
-		fmt.Fprintf(w, "%s\t%s\n", ckTrimmed, t.AccessTokenExpiry.String())
+		fmt.Fprintf(w, "%s\t%s\t%s\n", t.InstanceName(), ckTrimmed, t.AccessTokenExpiry.String())
 	}
 	w.Flush()
 
@@ -210,6 +277,22 @@ func (cmd *getCommand) getDepTokens(args []string) error {
 
 	if *flTokenPath != "" && len(tokens) > 0 {
 		t := tokens[0]
+		if *flToken != "" || len(tokens) > 1 {
+			name := *flToken
+			if name == "" {
+				name = config.DefaultDEPTokenName
+			}
+			found := false
+			for _, tok := range tokens {
+				if tok.InstanceName() == name {
+					t, found = tok, true
+					break
+				}
+			}
+			if !found {
+				return errors.Errorf("no DEP token named %s to export, use -token to choose one", name)
+			}
+		}
 
 		if err := os.MkdirAll(filepath.Dir(*flTokenPath), 0755); err != nil {
 			return errors.Wrapf(err, "create directory %s", filepath.Dir(*flTokenPath))
@@ -226,10 +309,7 @@ func (cmd *getCommand) getDepTokens(args []string) error {
 			return err
 		}
 
-		fmt.Printf("\nWrote DEP token JSON to: %s\n", *flTokenPath)
-		if len(tokens) > 1 {
-			fmt.Println("WARNING: more than one DEP token returned; only saved first")
-		}
+		fmt.Printf("\nWrote DEP token %s JSON to: %s\n", t.InstanceName(), *flTokenPath)
 	}
 
 	return nil
@@ -254,7 +334,7 @@ func (cmd *getCommand) getBlueprints(args []string) error {
 
 	if *flBlueprintName == "" || len(blueprints) < 1 {
 		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
-		fmt.Fprintf(w, "Name\tUUID\tManifests\tProfiles\tApply At\n")
+		fmt.Fprintf(w, "Name\tUUID\tManifests\tProfiles\tApply At\tPriority\n")
 		for _, bp := range blueprints {
 			var applyAtStr string
 			if len(bp.ApplyAt) > 0 {
@@ -264,12 +344,13 @@ func (cmd *getCommand) getBlueprints(args []string) error {
 			}
 			fmt.Fprintf(
 				w,
-				"%s\t%s\t%d\t%d\t%s\n",
+				"%s\t%s\t%d\t%d\t%s\t%d\n",
 				bp.Name,
 				bp.UUID,
 				len(bp.ApplicationURLs),
 				len(bp.ProfileIdentifiers),
 				applyAtStr,
+				bp.Priority,
 			)
 		}
 		w.Flush()
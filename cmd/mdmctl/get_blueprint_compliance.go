@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/blueprint"
+)
+
+func (cmd *getCommand) getBlueprintCompliance(args []string) error {
+	flagset := flag.NewFlagSet("blueprint-compliance", flag.ExitOnError)
+	var (
+		flUDID = flagset.String("udid", "", "show the profiles, applications and accounts of each blueprint on the device with this UDID")
+		flName = flagset.String("name", "", "show the status of each device the blueprint with this name was applied to")
+	)
+	flagset.Usage = usageFor(flagset, "mdmctl get blueprint-compliance [flags]")
+	if err := flagset.Parse(args); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	report, err := cmd.blueprintsvc.GetCompliance(ctx, blueprint.GetComplianceOption{UDID: *flUDID, Name: *flName})
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	switch {
+	case *flUDID != "":
+		fmt.Fprintf(w, "Blueprint\tType\tIdentifier\tStatus\tUpdated\tError\n")
+		for _, s := range report.Devices {
+			for _, item := range s.Items {
+				identifier := item.Identifier
+				if item.BundleIdentifier != "" {
+					identifier = item.BundleIdentifier
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", s.BlueprintName, item.Type, identifier,
+					item.Status, formatTime(item.UpdatedAt), item.Error)
+			}
+		}
+	case *flName != "":
+		fmt.Fprintf(w, "UDID\tStatus\tItems\tApplied\tChecked\n")
+		for _, s := range report.Devices {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", s.UDID, s.Status, len(s.Items),
+				formatTime(s.AppliedAt), formatTime(s.CheckedAt))
+		}
+	default:
+		fmt.Fprintf(w, "Blueprint\tCompliant\tPending\tNonCompliant\n")
+		for _, c := range report.Blueprints {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", c.BlueprintName, c.Compliant, c.Pending, c.NonCompliant)
+		}
+	}
+	w.Flush()
+	return nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format(time.RFC3339)
+}
@@ -20,6 +20,7 @@ func (out *depaccountTableOutput) BasicFooter() {
 
 func (cmd *getCommand) getDEPAccount(args []string) error {
 	flagset := flag.NewFlagSet("dep-account", flag.ExitOnError)
+	flToken := flagset.String("token", "", "name of the DEP token, as set by apply dep-tokens -name")
 	flagset.Usage = usageFor(flagset, "mdmctl get dep-account [flags]")
 	if err := flagset.Parse(args); err != nil {
 		return err
@@ -29,7 +30,7 @@ func (cmd *getCommand) getDEPAccount(args []string) error {
 	out.BasicHeader()
 	defer out.BasicFooter()
 	ctx := context.Background()
-	resp, err := cmd.depsvc.GetAccountInfo(ctx)
+	resp, err := cmd.depsvc.GetAccountInfo(ctx, *flToken)
 	if err != nil {
 		return err
 	}
@@ -5,25 +5,50 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 	"text/tabwriter"
 )
 
 func (cmd *getCommand) getDEPAutoAssigners(args []string) error {
 	flagset := flag.NewFlagSet("dep-autoassigner", flag.ExitOnError)
+	var (
+		flToken  = flagset.String("token", "", "name of the DEP token, as set by apply dep-tokens -name")
+		flDryRun = flagset.String("dry-run", "", "comma separated serials to show the profile they would be auto-assigned, without assigning it")
+	)
 	flagset.Usage = usageFor(flagset, "mdmctl get dep-autoassigner [flags]")
 	if err := flagset.Parse(args); err != nil {
 		return err
 	}
 
-	assigners, err := cmd.depsyncsvc.GetAutoAssigners(context.TODO())
+	if *flDryRun != "" {
+		return cmd.dryRunDEPAutoAssigners(*flToken, strings.Split(*flDryRun, ","))
+	}
+
+	assigners, err := cmd.depsyncsvc.GetAutoAssigners(context.TODO(), *flToken)
 	if err != nil {
 		return err
 	}
 
 	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
-	fmt.Fprintf(w, "Filter\tDEP Profile UUID\n")
+	fmt.Fprintf(w, "Token\tPriority\tFilter\tDEP Profile UUID\n")
 	for _, a := range assigners {
-		fmt.Fprintf(w, "%s\t%s\n", a.Filter, a.ProfileUUID)
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", a.TokenName, a.Priority, a.Filter, a.ProfileUUID)
+	}
+	w.Flush()
+
+	return nil
+}
+
+func (cmd *getCommand) dryRunDEPAutoAssigners(tokenName string, serials []string) error {
+	assignments, err := cmd.depsyncsvc.DryRunAutoAssigners(context.TODO(), tokenName, serials)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Serial\tStatus\tFilter\tDEP Profile UUID\n")
+	for _, a := range assignments {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", a.SerialNumber, a.Status, a.Filter, a.ProfileUUID)
 	}
 	w.Flush()
 
@@ -23,6 +23,7 @@ func (out *depDevicesTableOutput) BasicFooter() {
 func (cmd *getCommand) getDEPDevices(args []string) error {
 	flagset := flag.NewFlagSet("dep-devices", flag.ExitOnError)
 	flSerials := flagset.String("serials", "", "comma separated list of device serials")
+	flToken := flagset.String("token", "", "name of the DEP token, as set by apply dep-tokens -name")
 	flagset.Usage = usageFor(flagset, "mdmctl get dep-devices [flags]")
 	if err := flagset.Parse(args); err != nil {
 		return err
@@ -37,7 +38,7 @@ func (cmd *getCommand) getDEPDevices(args []string) error {
 	defer out.BasicFooter()
 	ctx := context.Background()
 	serials := strings.Split(*flSerials, ",")
-	resp, err := cmd.depsvc.GetDeviceDetails(ctx, serials)
+	resp, err := cmd.depsvc.GetDeviceDetails(ctx, *flToken, serials)
 	if err != nil {
 		return err
 	}
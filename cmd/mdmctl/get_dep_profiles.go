@@ -8,6 +8,11 @@ import (
 	"os"
 	"strings"
 	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/dep"
 )
 
 type depProfilesTableOutput struct{ w *tabwriter.Writer }
@@ -20,17 +25,24 @@ func (out *depProfilesTableOutput) BasicFooter() {
 	out.w.Flush()
 }
 
-const noUUIDText = `The DEP API does not support listing profiles. 
-A UUID flag must be specified. To get currently assigned profile UUIDs run
-	mdmctl get dep-devices -serials=serial1,serial2,serial3
-The output of the dep-devices response will contain the profile UUIDs.
-`
+type depProfileLibraryTableOutput struct{ w *tabwriter.Writer }
+
+func (out *depProfileLibraryTableOutput) BasicHeader() {
+	fmt.Fprintf(out.w, "Name\tVersion\tProfileUUID\tCreated\n")
+}
+
+func (out *depProfileLibraryTableOutput) BasicFooter() {
+	out.w.Flush()
+}
 
 func (cmd *getCommand) getDEPProfiles(args []string) error {
 	flagset := flag.NewFlagSet("dep-profiles", flag.ExitOnError)
 	var (
-		flProfilePath = flagset.String("f", "", "filename of DEP profile to apply")
-		flUUID        = flagset.String("uuid", "", "DEP Profile UUID(required)")
+		flProfilePath = flagset.String("f", "", "filename to write the DEP profile JSON to")
+		flUUID        = flagset.String("uuid", "", "DEP Profile UUID, to get the profile from the DEP API")
+		flName        = flagset.String("name", "", "name of a profile in the DEP profile library, to list its versions")
+		flVersion     = flagset.Int("version", 0, "version of the -name profile to write with -f. defaults to the latest")
+		flToken       = flagset.String("token", "", "name of the DEP token, as set by apply dep-tokens -name")
 	)
 	flagset.Usage = usageFor(flagset, "mdmctl get dep-profiles [flags]")
 	if err := flagset.Parse(args); err != nil {
@@ -38,38 +50,81 @@ func (cmd *getCommand) getDEPProfiles(args []string) error {
 	}
 
 	if *flUUID == "" {
-		fmt.Println(noUUIDText)
-		flagset.Usage()
-		os.Exit(1)
+		return cmd.getDEPProfileLibrary(*flToken, *flName, *flVersion, *flProfilePath)
 	}
 
 	ctx := context.Background()
-	resp, err := cmd.depsvc.FetchProfile(ctx, *flUUID)
+	resp, err := cmd.depsvc.FetchProfile(ctx, *flToken, *flUUID)
+	if err != nil {
+		return err
+	}
+	return writeDEPProfile(resp, *flProfilePath, *flUUID)
+}
+
+// getDEPProfileLibrary lists the profile library, or the versions of the
+// profile called name. With a path, the profile of a version is written to it.
+func (cmd *getCommand) getDEPProfileLibrary(tokenName, name string, version int, path string) error {
+	if path != "" && name == "" {
+		return errors.New("bad input: must provide -name or -uuid with -f")
+	}
+	profiles, err := cmd.depsvc.ListProfiles(context.Background(), tokenName, name)
 	if err != nil {
 		return err
 	}
+	if name != "" && len(profiles) == 0 {
+		return errors.Errorf("no DEP profile named %s in the library", name)
+	}
+
+	if path != "" {
+		selected := profiles[len(profiles)-1]
+		if version != 0 {
+			var found bool
+			for _, p := range profiles {
+				if p.Version == version {
+					selected, found = p, true
+				}
+			}
+			if !found {
+				return errors.Errorf("no version %d of DEP profile %s", version, name)
+			}
+		}
+		return writeDEPProfile(selected.Profile, path, fmt.Sprintf("%s version %d", name, selected.Version))
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	out := &depProfileLibraryTableOutput{w}
+	out.BasicHeader()
+	defer out.BasicFooter()
+	for _, p := range profiles {
+		fmt.Fprintf(out.w, "%s\t%d\t%s\t%s\n", p.Name, p.Version, p.ProfileUUID, p.CreatedAt.Format(time.RFC3339))
+	}
+	return nil
+}
 
-	if *flProfilePath == "" {
+// writeDEPProfile prints a summary of a DEP profile, or writes it as JSON to
+// path. A path of "-" is stdout.
+func writeDEPProfile(p *dep.Profile, path, desc string) error {
+	if path == "" {
 		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
 		out := &depProfilesTableOutput{w}
 		out.BasicHeader()
 		defer out.BasicFooter()
 
 		fmt.Fprintf(out.w, "%s\t%v\t%v\t%v\t%s\n",
-			resp.ProfileName,
-			resp.IsMandatory,
-			resp.IsMDMRemovable,
-			resp.AwaitDeviceConfigured,
-			strings.Join(resp.SkipSetupItems, ","),
+			p.ProfileName,
+			p.IsMandatory,
+			p.IsMDMRemovable,
+			p.AwaitDeviceConfigured,
+			strings.Join(p.SkipSetupItems, ","),
 		)
 	} else {
 		var output *os.File
 		{
-			if *flProfilePath == "-" {
+			if path == "-" {
 				output = os.Stdout
 			} else {
 				var err error
-				output, err = os.Create(*flProfilePath)
+				output, err = os.Create(path)
 				if err != nil {
 					return err
 				}
@@ -82,13 +137,12 @@ func (cmd *getCommand) getDEPProfiles(args []string) error {
 		// omitted in the marshalled JSON
 		enc := json.NewEncoder(output)
 		enc.SetIndent("", "  ")
-		err = enc.Encode(resp)
-		if err != nil {
+		if err := enc.Encode(p); err != nil {
 			return err
 		}
 
-		if *flProfilePath != "-" {
-			fmt.Printf("wrote DEP profile %s to: %s\n", *flUUID, *flProfilePath)
+		if path != "-" {
+			fmt.Printf("wrote DEP profile %s to: %s\n", desc, path)
 		}
 	}
 
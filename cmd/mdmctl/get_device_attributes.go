@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+func (cmd *getCommand) getDeviceAttributes(args []string) error {
+	flagset := flag.NewFlagSet("device-attributes", flag.ExitOnError)
+	flagset.Usage = usageFor(flagset, "mdmctl get device-attributes [flags]")
+	if err := flagset.Parse(args); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	attributes, err := cmd.devicesvc.GetAttributes(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Name\tType\tDescription\n")
+	for _, a := range attributes {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", a.Name, a.Type, a.Description)
+	}
+	w.Flush()
+	return nil
+}
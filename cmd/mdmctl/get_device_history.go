@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/device"
+)
+
+func (cmd *getCommand) getDeviceHistory(args []string) error {
+	flagset := flag.NewFlagSet("device-history", flag.ExitOnError)
+	var (
+		flUDID  = flagset.String("udid", "", "UDID of the device")
+		flTypes = flagset.String("type", "", "comma separated event types, such as enrolled,os_updated")
+		flSince = flagset.String("since", "", "only show events since an RFC 3339 time or a duration ago, such as 24h")
+		flLimit = flagset.Int("limit", 0, "only show this many of the most recent events")
+	)
+	flagset.Usage = usageFor(flagset, "mdmctl get device-history [flags]")
+	if err := flagset.Parse(args); err != nil {
+		return err
+	}
+	if *flUDID == "" {
+		flagset.Usage()
+		return errors.New("bad input: device UDID must be provided")
+	}
+
+	opt := device.HistoryOption{Limit: *flLimit}
+	for _, typ := range splitList(*flTypes) {
+		opt.Types = append(opt.Types, device.HistoryEventType(typ))
+	}
+	if *flSince != "" {
+		since, err := parseSince(*flSince)
+		if err != nil {
+			return err
+		}
+		opt.Since = since
+	}
+
+	ctx := context.Background()
+	events, err := cmd.devicesvc.DeviceHistory(ctx, *flUDID, opt)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Time\tType\tDetails\n")
+	for _, ev := range events {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", ev.Time.Local().Format(time.RFC3339), ev.Type, formatDetails(ev.Details))
+	}
+	w.Flush()
+	return nil
+}
+
+// parseSince parses a time or a duration before now.
+func parseSince(s string) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, errors.Errorf("bad input: since must be an RFC 3339 time or a duration, got %q", s)
+	}
+	return t, nil
+}
+
+// formatDetails formats the details of an event as key=value pairs sorted by
+// key.
+func formatDetails(details map[string]string) string {
+	keys := make([]string, 0, len(details))
+	for k := range details {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + details[k]
+	}
+	return strings.Join(pairs, " ")
+}
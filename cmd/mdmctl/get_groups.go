@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/group"
+)
+
+func (cmd *getCommand) getGroups(args []string) error {
+	flagset := flag.NewFlagSet("groups", flag.ExitOnError)
+	var (
+		flName     = flagset.String("name", "", "name of a group, to write its JSON")
+		flJSONName = flagset.String("f", "-", "filename of JSON to save to")
+	)
+	flagset.Usage = usageFor(flagset, "mdmctl get groups [flags]")
+	if err := flagset.Parse(args); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	groups, err := cmd.groupsvc.GetGroups(ctx, group.GetGroupsOption{FilterName: *flName})
+	if err != nil {
+		return err
+	}
+
+	if *flName == "" || len(groups) < 1 {
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "Name\tType\tDefinition\tDescription\n")
+		for _, g := range groups {
+			kind, definition := "static", fmt.Sprintf("%d udids, %d serials", len(g.UDIDs), len(g.Serials))
+			if g.Dynamic() {
+				var terms []string
+				if g.Filter != "" {
+					terms = append(terms, g.Filter)
+				}
+				if g.Query != "" {
+					terms = append(terms, fmt.Sprintf("search %q", g.Query))
+				}
+				kind, definition = "dynamic", strings.Join(terms, ", ")
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", g.Name, kind, definition, g.Description)
+		}
+		w.Flush()
+		return nil
+	}
+
+	output := os.Stdout
+	if *flJSONName != "-" {
+		output, err = os.Create(*flJSONName)
+		if err != nil {
+			return err
+		}
+		defer output.Close()
+	}
+	enc := json.NewEncoder(output)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(groups[0]); err != nil {
+		return err
+	}
+	if *flJSONName != "-" {
+		fmt.Printf("wrote group %s to: %s\n", *flName, *flJSONName)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/stale"
+)
+
+func (cmd *getCommand) getStaleActions(args []string) error {
+	flagset := flag.NewFlagSet("stale-actions", flag.ExitOnError)
+	var (
+		flUDID   = flagset.String("udid", "", "only show the actions on the device with this UDID")
+		flSerial = flagset.String("serial", "", "only show the actions on the device with this serial number")
+	)
+	flagset.Usage = usageFor(flagset, "mdmctl get stale-actions [flags]")
+	if err := flagset.Parse(args); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	actions, err := cmd.stalesvc.ListActions(ctx, stale.ListActionsOption{UDID: *flUDID, SerialNumber: *flSerial})
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Time\tAction\tUDID\tSerialNumber\tReason\n")
+	for _, a := range actions {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", a.Time.Local().Format(time.RFC3339), a.Type, a.UDID, a.SerialNumber, a.Reason)
+	}
+	w.Flush()
+	return nil
+}
@@ -61,7 +61,7 @@ Commands:
     push
     upload
 `
-	fmt.Println(usageText)
+	fmt.Print(usageText)
 	return nil
 
 }
@@ -206,6 +206,7 @@ func (cmd *mdmcertCommand) runUpload(args []string) error {
 		flKeyPass  = flagset.String("password", "", "Password to encrypt/read the RSA key.")
 		flKeyPath  = flagset.String("private-key", filepath.Join(mdmcertdir, pushCertificatePrivateKeyFilename), "Path to the push certificate private key.")
 		flCertPath = flagset.String("cert", "", "Path to the MDM Push Certificate.")
+		flForce    = flagset.Bool("force", false, "Replace the current push certificate even if the topic is different. Enrolled devices must re-enroll.")
 	)
 	if err := flagset.Parse(args); err != nil {
 		return err
@@ -216,10 +217,20 @@ func (cmd *mdmcertCommand) runUpload(args []string) error {
 		return errors.Wrap(err, "load push certificate")
 	}
 
-	if err := cmd.configsvc.SavePushCertificate(context.Background(), cert, key); err != nil {
+	ctx := context.Background()
+	if err := cmd.configsvc.SavePushCertificate(ctx, cert, key, *flForce); err != nil {
 		return errors.Wrap(err, "upload push certificate and key to server")
 	}
 
+	_, info, err := cmd.configsvc.GetPushCertificate(ctx)
+	if err != nil {
+		return errors.Wrap(err, "get uploaded push certificate")
+	}
+	if info != nil {
+		fmt.Printf("uploaded push certificate for topic %s, expires %s (%d days)\n",
+			info.Topic, info.NotAfter.Format("2006-01-02"), info.DaysRemaining)
+	}
+
 	return nil
 }
 
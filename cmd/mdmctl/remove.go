@@ -50,6 +50,16 @@ func (cmd *removeCommand) Run(args []string) error {
 		run = cmd.removeBlock
 	case "dep-autoassigner":
 		run = cmd.removeDEPAutoAssigner
+	case "dep-profiles":
+		run = cmd.removeDEPProfiles
+	case "dep-assignments":
+		run = cmd.removeDEPAssignments
+	case "dep-devices":
+		run = cmd.removeDEPDevices
+	case "groups":
+		run = cmd.removeGroups
+	case "device-attributes":
+		run = cmd.removeDeviceAttributes
 	default:
 		cmd.Usage()
 		os.Exit(1)
@@ -69,8 +79,13 @@ Valid resource types:
   * profiles
   * block
   * dep-autoassigner
+  * dep-profiles
+  * dep-assignments
+  * dep-devices
+  * groups
+  * device-attributes
 `
 
-	fmt.Println(getUsage)
+	fmt.Print(getUsage)
 	return nil
 }
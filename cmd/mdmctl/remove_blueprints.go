@@ -4,13 +4,18 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"os"
 	"strings"
+	"text/tabwriter"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/blueprint"
 )
 
 func (cmd *removeCommand) removeBlueprints(args []string) error {
 	flagset := flag.NewFlagSet("remove-blueprints", flag.ExitOnError)
 	var (
 		flBlueprintName = flagset.String("name", "", "name of blueprint, optionally comma separated")
+		flDryRun        = flagset.Bool("dry-run", false, "show the profiles and applications which would be removed from devices, without removing anything")
 	)
 	flagset.Usage = usageFor(flagset, "mdmctl remove blueprints [flags]")
 	if err := flagset.Parse(args); err != nil {
@@ -18,7 +23,16 @@ func (cmd *removeCommand) removeBlueprints(args []string) error {
 	}
 
 	ctx := context.Background()
-	err := cmd.blueprintsvc.RemoveBlueprints(ctx, strings.Split(*flBlueprintName, ","))
+	names := strings.Split(*flBlueprintName, ",")
+	if *flDryRun {
+		removals, err := cmd.blueprintsvc.PreviewRemovals(ctx, blueprint.PreviewRemovalsOption{Names: names})
+		if err != nil {
+			return err
+		}
+		printRemovals(removals)
+		return nil
+	}
+	err := cmd.blueprintsvc.RemoveBlueprints(ctx, names)
 	if err != nil {
 		return err
 	}
@@ -27,3 +41,14 @@ func (cmd *removeCommand) removeBlueprints(args []string) error {
 
 	return nil
 }
+
+// printRemovals prints the profiles and applications which un-applying
+// blueprints removes from devices.
+func printRemovals(removals []blueprint.Removal) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "UDID\tBlueprint\tType\tIdentifier\tReason\n")
+	for _, r := range removals {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.UDID, r.BlueprintName, r.Type, r.Identifier, r.Reason)
+	}
+	w.Flush()
+}
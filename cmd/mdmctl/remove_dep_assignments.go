@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+func (cmd *removeCommand) removeDEPAssignments(args []string) error {
+	flagset := flag.NewFlagSet("dep-assignments", flag.ExitOnError)
+	var (
+		flSerials = flagset.String("serials", "", "comma separated list of device serials")
+		flToken   = flagset.String("token", "", "name of the DEP token, as set by apply dep-tokens -name")
+	)
+	flagset.Usage = usageFor(flagset, "mdmctl remove dep-assignments [flags]")
+	if err := flagset.Parse(args); err != nil {
+		return err
+	}
+	if *flSerials == "" {
+		flagset.Usage()
+		return errors.New("bad input: must provide a comma separated list of DEP serials")
+	}
+
+	devices, err := cmd.depsvc.RemoveProfile(context.TODO(), *flToken, strings.Split(*flSerials, ","))
+	if err != nil {
+		return errors.Wrap(err, "remove dep profile")
+	}
+	printDEPDeviceStatuses(devices)
+	return nil
+}
@@ -11,7 +11,8 @@ import (
 func (cmd *removeCommand) removeDEPAutoAssigner(args []string) error {
 	flagset := flag.NewFlagSet("dep-autoassigner", flag.ExitOnError)
 	var (
-		flFilter = flagset.String("filter", "*", "filter string (only '*' supported right now)")
+		flFilter = flagset.String("filter", "*", "filter of the auto-assigner, as shown by get dep-autoassigners")
+		flToken  = flagset.String("token", "", "name of the DEP token, as set by apply dep-tokens -name")
 	)
 	flagset.Usage = usageFor(flagset, "mdmctl remove dep-autoassigner [flags]")
 	if err := flagset.Parse(args); err != nil {
@@ -22,7 +23,7 @@ func (cmd *removeCommand) removeDEPAutoAssigner(args []string) error {
 		return errors.New("bad input: must provide -filter")
 	}
 
-	err := cmd.depsyncsvc.RemoveAutoAssigner(context.TODO(), *flFilter)
+	err := cmd.depsyncsvc.RemoveAutoAssigner(context.TODO(), *flToken, *flFilter)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+func (cmd *removeCommand) removeDEPDevices(args []string) error {
+	flagset := flag.NewFlagSet("dep-devices", flag.ExitOnError)
+	var (
+		flSerials = flagset.String("serials", "", "comma separated list of device serials")
+		flDisown  = flagset.Bool("disown", false, "confirm the devices are disowned. disowned devices can not be added back to the DEP account")
+		flToken   = flagset.String("token", "", "name of the DEP token, as set by apply dep-tokens -name")
+	)
+	flagset.Usage = usageFor(flagset, "mdmctl remove dep-devices [flags]")
+	if err := flagset.Parse(args); err != nil {
+		return err
+	}
+	if *flSerials == "" {
+		flagset.Usage()
+		return errors.New("bad input: must provide a comma separated list of DEP serials")
+	}
+	if !*flDisown {
+		flagset.Usage()
+		return errors.New("bad input: disowning devices is permanent, confirm with -disown")
+	}
+
+	devices, err := cmd.depsvc.DisownDevices(context.TODO(), *flToken, strings.Split(*flSerials, ","))
+	if err != nil {
+		return errors.Wrap(err, "disown dep devices")
+	}
+	printDEPDeviceStatuses(devices)
+	return nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+func (cmd *removeCommand) removeDEPProfiles(args []string) error {
+	flagset := flag.NewFlagSet("dep-profiles", flag.ExitOnError)
+	var (
+		flName  = flagset.String("name", "", "name of the profile to delete from the DEP profile library")
+		flToken = flagset.String("token", "", "name of the DEP token, as set by apply dep-tokens -name")
+	)
+	flagset.Usage = usageFor(flagset, "mdmctl remove dep-profiles [flags]")
+	if err := flagset.Parse(args); err != nil {
+		return err
+	}
+	if *flName == "" {
+		flagset.Usage()
+		return errors.New("bad input: must provide -name")
+	}
+
+	if err := cmd.depsvc.DeleteProfile(context.TODO(), *flToken, *flName); err != nil {
+		return err
+	}
+	fmt.Printf("removed every version of DEP profile %s from the library\n", *flName)
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+func (cmd *removeCommand) removeDeviceAttributes(args []string) error {
+	flagset := flag.NewFlagSet("device-attributes", flag.ExitOnError)
+	var (
+		flName = flagset.String("name", "", "name of device attribute, optionally comma separated")
+	)
+	flagset.Usage = usageFor(flagset, "mdmctl remove device-attributes [flags]")
+	if err := flagset.Parse(args); err != nil {
+		return err
+	}
+	if *flName == "" {
+		flagset.Usage()
+		return errors.New("bad input: must provide -name")
+	}
+
+	ctx := context.Background()
+	if err := cmd.devicesvc.RemoveAttributes(ctx, strings.Split(*flName, ",")); err != nil {
+		return err
+	}
+
+	fmt.Printf("removed device attribute(s) and their values: %s\n", *flName)
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+func (cmd *removeCommand) removeGroups(args []string) error {
+	flagset := flag.NewFlagSet("groups", flag.ExitOnError)
+	var (
+		flName = flagset.String("name", "", "name of group, optionally comma separated")
+	)
+	flagset.Usage = usageFor(flagset, "mdmctl remove groups [flags]")
+	if err := flagset.Parse(args); err != nil {
+		return err
+	}
+	if *flName == "" {
+		flagset.Usage()
+		return errors.New("bad input: must provide -name")
+	}
+
+	ctx := context.Background()
+	if err := cmd.groupsvc.RemoveGroups(ctx, strings.Split(*flName, ",")); err != nil {
+		return err
+	}
+
+	fmt.Printf("removed group(s): %s\n", *flName)
+	return nil
+}
@@ -10,8 +10,10 @@ import (
 	"github.com/vishnuvaradaraj/micromdm/platform/dep"
 	"github.com/vishnuvaradaraj/micromdm/platform/dep/sync"
 	"github.com/vishnuvaradaraj/micromdm/platform/device"
+	"github.com/vishnuvaradaraj/micromdm/platform/group"
 	"github.com/vishnuvaradaraj/micromdm/platform/profile"
 	"github.com/vishnuvaradaraj/micromdm/platform/remove"
+	"github.com/vishnuvaradaraj/micromdm/platform/stale"
 	"github.com/vishnuvaradaraj/micromdm/platform/user"
 )
 
@@ -25,6 +27,8 @@ type remoteServices struct {
 	appsvc       appstore.Service
 	depsvc       dep.Service
 	depsyncsvc   sync.Service
+	groupsvc     group.Service
+	stalesvc     stale.Service
 }
 
 func setupClient(logger log.Logger) (*remoteServices, error) {
@@ -96,6 +100,20 @@ func setupClient(logger log.Logger) (*remoteServices, error) {
 		return nil, err
 	}
 
+	groupsvc, err := group.NewHTTPClient(
+		cfg.ServerURL, cfg.APIToken, logger,
+		httptransport.SetClient(skipVerifyHTTPClient(cfg.SkipVerify)))
+	if err != nil {
+		return nil, err
+	}
+
+	stalesvc, err := stale.NewHTTPClient(
+		cfg.ServerURL, cfg.APIToken, logger,
+		httptransport.SetClient(skipVerifyHTTPClient(cfg.SkipVerify)))
+	if err != nil {
+		return nil, err
+	}
+
 	return &remoteServices{
 		profilesvc:   profilesvc,
 		blueprintsvc: blueprintsvc,
@@ -106,5 +124,7 @@ func setupClient(logger log.Logger) (*remoteServices, error) {
 		appsvc:       appsvc,
 		depsvc:       depsvc,
 		depsyncsvc:   depsyncsvc,
+		groupsvc:     groupsvc,
+		stalesvc:     stalesvc,
 	}, nil
 }
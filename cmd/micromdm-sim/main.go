@@ -0,0 +1,276 @@
+// Command micromdm-sim enrolls simulated devices with a MicroMDM server and
+// answers the commands queued for them, for end-to-end and load tests.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/micromdm/go4/version"
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/mdm/devicesim"
+)
+
+func init() {
+	rand.Seed(time.Now().UnixNano())
+}
+
+func main() {
+	if len(os.Args) > 1 && strings.TrimLeft(os.Args[1], "-") == "version" {
+		version.Print()
+		return
+	}
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	flagset := flag.NewFlagSet("micromdm-sim", flag.ExitOnError)
+	var (
+		flServerURL       = flagset.String("server-url", "", "public URL of the micromdm server")
+		flDevices         = flagset.Int("devices", 1, "number of devices to simulate")
+		flSerialPrefix    = flagset.String("serial-prefix", "SIM", "prefix of the serial numbers of the devices")
+		flConcurrency     = flagset.Int("concurrency", 20, "maximum number of devices enrolling or connecting at the same time")
+		flConnectInterval = flagset.Duration("connect-interval", time.Minute, "how often each device connects to answer queued commands, 0 to connect once")
+		flDuration        = flagset.Duration("duration", 0, "how long to run, 0 to run until interrupted")
+		flScript          = flagset.String("script", "", "path to a JSON file with the reply to each command request type")
+		flKeyBits         = flagset.Int("key-bits", 0, "RSA key size of the device identities, 0 to use the size of the enrollment profile")
+		flCheckOut        = flagset.Bool("checkout", false, "check out every device before exiting")
+		flInsecure        = flagset.Bool("insecure", false, "skip verification of the server TLS certificate")
+	)
+	flagset.Usage = usageFor(flagset, "micromdm-sim -server-url=https://mdm.example.com [flags]")
+	if err := flagset.Parse(args); err != nil {
+		return err
+	}
+	if *flServerURL == "" {
+		return errors.New("must supply -server-url")
+	}
+	if *flDevices < 1 || *flConcurrency < 1 {
+		return errors.New("-devices and -concurrency must be at least 1")
+	}
+
+	responder := devicesim.DefaultResponder
+	if *flScript != "" {
+		data, err := ioutil.ReadFile(*flScript)
+		if err != nil {
+			return errors.Wrap(err, "read script")
+		}
+		var script devicesim.Script
+		if err := json.Unmarshal(data, &script); err != nil {
+			return errors.Wrapf(err, "decode script %s", *flScript)
+		}
+		responder = script
+	}
+
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			MaxIdleConnsPerHost: *flConcurrency,
+			TLSClientConfig:     &tls.Config{InsecureSkipVerify: *flInsecure},
+		},
+	}
+
+	logger := log.NewLogfmtLogger(os.Stderr)
+	logger = log.With(logger, "ts", log.DefaultTimestampUTC)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if *flDuration > 0 {
+		ctx, cancel = context.WithTimeout(ctx, *flDuration)
+		defer cancel()
+	}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	go func() {
+		<-sig
+		cancel()
+	}()
+
+	sim := &simulator{
+		serverURL:       *flServerURL,
+		connectInterval: *flConnectInterval,
+		sem:             make(chan struct{}, *flConcurrency),
+		logger:          logger,
+	}
+	for i := 0; i < *flDevices; i++ {
+		serial := fmt.Sprintf("%s%07d", *flSerialPrefix, i+1)
+		sim.devices = append(sim.devices, devicesim.New(serial,
+			devicesim.WithHTTPClient(client),
+			devicesim.WithResponder(responder),
+			devicesim.WithKeyBits(*flKeyBits),
+		))
+	}
+
+	sim.run(ctx)
+	if *flCheckOut {
+		sim.checkOut()
+	}
+	sim.report("finished")
+	return nil
+}
+
+type simulator struct {
+	serverURL       string
+	connectInterval time.Duration
+	devices         []*devicesim.Device
+	// sem limits the devices which send requests at the same time.
+	sem    chan struct{}
+	logger log.Logger
+
+	started       time.Time
+	enrolled      int64
+	enrollErrors  int64
+	connects      int64
+	connectErrors int64
+	commands      int64
+}
+
+// run enrolls every device, then connects each device every connect
+// interval until ctx is done.
+func (s *simulator) run(ctx context.Context) {
+	s.started = time.Now()
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(10 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.report("progress")
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for _, d := range s.devices {
+		wg.Add(1)
+		go func(d *devicesim.Device) {
+			defer wg.Done()
+			s.runDevice(ctx, d)
+		}(d)
+	}
+	wg.Wait()
+	close(done)
+}
+
+func (s *simulator) runDevice(ctx context.Context, d *devicesim.Device) {
+	if !s.acquire(ctx) {
+		return
+	}
+	err := d.Enroll(ctx, s.serverURL)
+	<-s.sem
+	if err != nil {
+		atomic.AddInt64(&s.enrollErrors, 1)
+		s.logger.Log("msg", "enroll device", "serial", d.SerialNumber, "err", err)
+		return
+	}
+	atomic.AddInt64(&s.enrolled, 1)
+
+	// spread the connections of the devices over the interval.
+	wait := time.Duration(0)
+	if s.connectInterval > 0 {
+		wait = time.Duration(rand.Int63n(int64(s.connectInterval)))
+	}
+	for {
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return
+		}
+		if !s.acquire(ctx) {
+			return
+		}
+		n, err := d.Connect(ctx)
+		<-s.sem
+		atomic.AddInt64(&s.connects, 1)
+		atomic.AddInt64(&s.commands, int64(n))
+		if err != nil && ctx.Err() == nil {
+			atomic.AddInt64(&s.connectErrors, 1)
+			s.logger.Log("msg", "connect device", "serial", d.SerialNumber, "err", err)
+		}
+		if s.connectInterval == 0 {
+			return
+		}
+		wait = s.connectInterval
+	}
+}
+
+func (s *simulator) acquire(ctx context.Context) bool {
+	select {
+	case s.sem <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// checkOut checks out the enrolled devices, like removing their enrollment
+// profiles.
+func (s *simulator) checkOut() {
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for _, d := range s.devices {
+		if !d.Enrolled() {
+			continue
+		}
+		wg.Add(1)
+		s.sem <- struct{}{}
+		go func(d *devicesim.Device) {
+			defer func() { <-s.sem; wg.Done() }()
+			if err := d.CheckOut(ctx); err != nil {
+				s.logger.Log("msg", "check out device", "serial", d.SerialNumber, "err", err)
+			}
+		}(d)
+	}
+	wg.Wait()
+}
+
+func (s *simulator) report(msg string) {
+	elapsed := time.Since(s.started)
+	enrolled := atomic.LoadInt64(&s.enrolled)
+	s.logger.Log(
+		"msg", msg,
+		"elapsed", elapsed.Round(time.Millisecond),
+		"enrolled", enrolled,
+		"enroll_errors", atomic.LoadInt64(&s.enrollErrors),
+		"enroll_rate", fmt.Sprintf("%.1f/s", float64(enrolled)/elapsed.Seconds()),
+		"connects", atomic.LoadInt64(&s.connects),
+		"connect_errors", atomic.LoadInt64(&s.connectErrors),
+		"commands", atomic.LoadInt64(&s.commands),
+	)
+}
+
+func usageFor(fs *flag.FlagSet, short string) func() {
+	return func() {
+		fmt.Fprintf(os.Stderr, "USAGE\n")
+		fmt.Fprintf(os.Stderr, "  %s\n", short)
+		fmt.Fprintf(os.Stderr, "\n")
+		fmt.Fprintf(os.Stderr, "FLAGS\n")
+		w := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
+		fs.VisitAll(func(f *flag.Flag) {
+			fmt.Fprintf(w, "\t-%s %s\t%s\n", f.Name, f.DefValue, f.Usage)
+		})
+		w.Flush()
+		fmt.Fprintf(os.Stderr, "\n")
+	}
+}
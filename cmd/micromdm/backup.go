@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/go-kit/kit/log"
+	"github.com/micromdm/go4/env"
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/backup"
+)
+
+func backupCmd(args []string) error {
+	flagset := flag.NewFlagSet("backup", flag.ExitOnError)
+	var (
+		flServerURL = flagset.String("server-url", "", "url of the running micromdm server")
+		flAPIToken  = flagset.String("api-token", env.String("MICROMDM_API_KEY", ""), "API token of the server")
+		flOutput    = flagset.String("o", "micromdm.db.backup", "path to write the backup to")
+	)
+	flagset.Usage = usageFor(flagset, "micromdm backup -server-url=https://mdm.example.com [flags]")
+	if err := flagset.Parse(args); err != nil {
+		return err
+	}
+	if *flServerURL == "" {
+		return errors.New("must supply -server-url")
+	}
+
+	svc, err := backup.NewHTTPClient(*flServerURL, *flAPIToken, log.NewNopLogger())
+	if err != nil {
+		return err
+	}
+	body, err := svc.Backup(context.Background())
+	if err != nil {
+		return errors.Wrap(err, "request backup")
+	}
+	defer body.Close()
+
+	if err := writeFile(*flOutput, body); err != nil {
+		return err
+	}
+	if err := checkBolt(*flOutput); err != nil {
+		return errors.Wrap(err, "verify backup")
+	}
+	fmt.Printf("wrote backup to %s\n", *flOutput)
+	return nil
+}
+
+func restore(args []string) error {
+	flagset := flag.NewFlagSet("restore", flag.ExitOnError)
+	var (
+		flConfigPath = flagset.String("config-path", "/var/db/micromdm", "path to configuration directory")
+		flBackup     = flagset.String("backup", "", "path to the backup file")
+	)
+	flagset.Usage = usageFor(flagset, "micromdm restore -backup=micromdm.db.backup [flags]")
+	if err := flagset.Parse(args); err != nil {
+		return err
+	}
+	if *flBackup == "" {
+		return errors.New("must supply -backup")
+	}
+	if err := checkBolt(*flBackup); err != nil {
+		return errors.Wrapf(err, "verify backup %s", *flBackup)
+	}
+
+	dbPath := filepath.Join(*flConfigPath, "micromdm.db")
+	if _, err := os.Stat(dbPath); err == nil {
+		// the server holds a lock on the database while it is running.
+		db, err := bolt.Open(dbPath, 0644, &bolt.Options{Timeout: time.Second})
+		if err != nil {
+			return errors.Wrapf(err, "open %s, stop the server before restoring", dbPath)
+		}
+		db.Close()
+
+		old := dbPath + "." + time.Now().UTC().Format("20060102T150405") + ".old"
+		if err := os.Rename(dbPath, old); err != nil {
+			return errors.Wrap(err, "move current database")
+		}
+		fmt.Printf("moved current database to %s\n", old)
+	}
+
+	f, err := os.Open(*flBackup)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := writeFile(dbPath, f); err != nil {
+		return err
+	}
+	fmt.Printf("restored %s to %s\n", *flBackup, dbPath)
+	return nil
+}
+
+// writeFile writes r to a temporary file which is renamed to path once
+// complete, so a failed copy never leaves a truncated database behind.
+func writeFile(path string, r io.Reader) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp-")
+	if err != nil {
+		return errors.Wrap(err, "create temporary file")
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return errors.Wrapf(err, "write %s", path)
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrapf(err, "write %s", path)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return errors.Wrapf(os.Rename(tmp.Name(), path), "write %s", path)
+}
+
+// checkBolt opens a BoltDB file and checks its consistency.
+func checkBolt(path string) error {
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: time.Second, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.View(func(tx *bolt.Tx) error {
+		var first error
+		for err := range tx.Check() {
+			if first == nil {
+				first = err
+			}
+		}
+		return first
+	})
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/backup"
+	"github.com/vishnuvaradaraj/micromdm/platform/pubsub/inmem"
+	"github.com/vishnuvaradaraj/micromdm/platform/storage"
+)
+
+func export(args []string) error {
+	flagset := flag.NewFlagSet("export", flag.ExitOnError)
+	var (
+		flConfigPath = flagset.String("config-path", "/var/db/micromdm", "path to configuration directory")
+		flDB         = flagset.String("db", "", "path to a BoltDB database or backup. overrides -config-path")
+		flOutput     = flagset.String("o", "-", "path to write the JSON export to. - writes to stdout")
+	)
+	flagset.Usage = usageFor(flagset, "micromdm export [flags]")
+	if err := flagset.Parse(args); err != nil {
+		return err
+	}
+
+	dbPath := *flDB
+	if dbPath == "" {
+		dbPath = filepath.Join(*flConfigPath, "micromdm.db")
+	}
+	db, err := bolt.Open(dbPath, 0644, &bolt.Options{Timeout: time.Second, ReadOnly: true})
+	if err != nil {
+		return errors.Wrapf(err, "open %s, export a backup if the server is running", dbPath)
+	}
+	defer db.Close()
+
+	exp, err := backup.ExportBolt(db)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *flOutput != "-" {
+		f, err := os.Create(*flOutput)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return errors.Wrap(enc.Encode(exp), "write export")
+}
+
+func importCmd(args []string) error {
+	flagset := flag.NewFlagSet("import", flag.ExitOnError)
+	var (
+		flStorage = flagset.String("storage", "", "storage URL to import into. bolt://, firestore://, postgres://, mysql:// or sqlite://")
+		flInput   = flagset.String("i", "", "path to a JSON export")
+	)
+	flagset.Usage = usageFor(flagset, "micromdm import -storage=URL -i=export.json")
+	if err := flagset.Parse(args); err != nil {
+		return err
+	}
+	if *flStorage == "" || *flInput == "" {
+		return errors.New("must supply -storage and -i")
+	}
+
+	f, err := os.Open(*flInput)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var exp backup.Export
+	if err := json.NewDecoder(f).Decode(&exp); err != nil {
+		return errors.Wrapf(err, "decode %s", *flInput)
+	}
+	if exp.Version != backup.ExportVersion {
+		return errors.Errorf("unsupported export version %d", exp.Version)
+	}
+
+	stores, err := storage.Open(context.Background(), *flStorage, inmem.NewPubSub())
+	if err != nil {
+		return err
+	}
+	defer stores.Close()
+	if err := exp.Import(stores); err != nil {
+		return err
+	}
+	fmt.Printf("imported %d devices, %d profiles, %d blueprints and %d users into %s\n",
+		len(exp.Devices), len(exp.Profiles), len(exp.Blueprints), len(exp.Users), stores.Backend)
+	return nil
+}
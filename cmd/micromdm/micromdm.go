@@ -29,6 +29,16 @@ func main() {
 		return
 	case "serve":
 		run = serve
+	case "backup":
+		run = backupCmd
+	case "restore":
+		run = restore
+	case "export":
+		run = export
+	case "import":
+		run = importCmd
+	case "migrate":
+		run = migrateCmd
 	default:
 		usage()
 		os.Exit(1)
@@ -45,6 +55,11 @@ func usage() error {
 
 Available Commands:
 	serve
+	backup
+	restore
+	export
+	import
+	migrate
 	version
 
 Use micromdm <command> -h for additional usage of each command.
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/pubsub/inmem"
+	"github.com/vishnuvaradaraj/micromdm/platform/storage"
+	"github.com/vishnuvaradaraj/micromdm/platform/storage/migrate"
+)
+
+func migrateCmd(args []string) error {
+	flagset := flag.NewFlagSet("migrate", flag.ExitOnError)
+	var (
+		flFrom   = flagset.String("from", "bolt:///var/db/micromdm", "bolt:// URL of the config directory or database to copy from")
+		flTo     = flagset.String("to", "", "storage URL to copy to. firestore://, postgres://, mysql:// or sqlite://")
+		flReport = flagset.String("report", "micromdm-migrate-report.json", "path to write the JSON report to")
+	)
+	flagset.Usage = usageFor(flagset, "micromdm migrate -from=bolt:///var/db/micromdm -to=URL [flags]")
+	if err := flagset.Parse(args); err != nil {
+		return err
+	}
+	if *flTo == "" {
+		return errors.New("must supply -to")
+	}
+
+	path, err := storage.BoltPath(*flFrom)
+	if err != nil {
+		return errors.Wrap(err, "only bolt storage can be migrated from")
+	}
+	src, err := bolt.Open(path, 0644, &bolt.Options{Timeout: time.Second, ReadOnly: true})
+	if err != nil {
+		return errors.Wrapf(err, "open %s, stop the server or migrate from a backup", path)
+	}
+	defer src.Close()
+
+	dst, err := storage.Open(context.Background(), *flTo, inmem.NewPubSub())
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	report, err := migrate.FromBolt(src, dst)
+	if err != nil {
+		return err
+	}
+	if err := report.Print(os.Stdout); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(*flReport, data, 0644); err != nil {
+		return errors.Wrap(err, "write report")
+	}
+	fmt.Printf("wrote report to %s\n", *flReport)
+
+	if !report.OK() {
+		return errors.New("record counts do not match, re-run the migration, or migrate to an empty destination if it has extra records")
+	}
+	return nil
+}
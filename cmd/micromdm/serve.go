@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"flag"
 	"fmt"
 	"io"
@@ -20,8 +21,8 @@ import (
 	"github.com/micromdm/go4/env"
 	"github.com/micromdm/go4/httputil"
 	"github.com/micromdm/go4/version"
-	scep "github.com/vishnuvaradaraj/scep/server"
 	"github.com/pkg/errors"
+	scep "github.com/vishnuvaradaraj/scep/server"
 	"golang.org/x/crypto/acme/autocert"
 
 	"github.com/vishnuvaradaraj/micromdm/mdm"
@@ -30,18 +31,22 @@ import (
 	"github.com/vishnuvaradaraj/micromdm/platform/apns"
 	"github.com/vishnuvaradaraj/micromdm/platform/appstore"
 	appsbuiltin "github.com/vishnuvaradaraj/micromdm/platform/appstore/builtin"
+	"github.com/vishnuvaradaraj/micromdm/platform/backup"
 	"github.com/vishnuvaradaraj/micromdm/platform/blueprint"
-	blueprintbuiltin "github.com/vishnuvaradaraj/micromdm/platform/blueprint/builtin"
+	bpbuiltin "github.com/vishnuvaradaraj/micromdm/platform/blueprint/builtin"
 	"github.com/vishnuvaradaraj/micromdm/platform/command"
 	"github.com/vishnuvaradaraj/micromdm/platform/config"
 	depapi "github.com/vishnuvaradaraj/micromdm/platform/dep"
 	"github.com/vishnuvaradaraj/micromdm/platform/dep/sync"
 	"github.com/vishnuvaradaraj/micromdm/platform/device"
-	devicebuiltin "github.com/vishnuvaradaraj/micromdm/platform/device/builtin"
+	"github.com/vishnuvaradaraj/micromdm/platform/group"
+	"github.com/vishnuvaradaraj/micromdm/platform/nudge"
 	"github.com/vishnuvaradaraj/micromdm/platform/profile"
+	"github.com/vishnuvaradaraj/micromdm/platform/queue"
 	block "github.com/vishnuvaradaraj/micromdm/platform/remove"
+	"github.com/vishnuvaradaraj/micromdm/platform/stale"
+	"github.com/vishnuvaradaraj/micromdm/platform/storage"
 	"github.com/vishnuvaradaraj/micromdm/platform/user"
-	userbuiltin "github.com/vishnuvaradaraj/micromdm/platform/user/builtin"
 	"github.com/vishnuvaradaraj/micromdm/server"
 )
 
@@ -73,16 +78,37 @@ func serve(args []string) error {
 		flAPNSCertPath      = flagset.String("apns-cert", "", "path to APNS certificate")
 		flAPNSKeyPass       = flagset.String("apns-password", env.String("MICROMDM_APNS_KEY_PASSWORD", ""), "password for your p12 APNS cert file (if using)")
 		flAPNSKeyPath       = flagset.String("apns-key", "", "path to key file if using .pem push cert")
+		flAPNSSandbox       = flagset.Bool("apns-sandbox", false, "send push notifications to the APNs sandbox environment")
+		flAPNSTokenKey      = flagset.String("apns-token-key", "", "path to a .p8 APNs authentication key, to use token based authentication instead of the push certificate")
+		flAPNSTokenKeyID    = flagset.String("apns-token-key-id", "", "key ID of the -apns-token-key")
+		flAPNSTokenTeamID   = flagset.String("apns-token-team-id", "", "team ID of the -apns-token-key")
+		flAPNSPushWorkers   = flagset.Int("apns-push-workers", apns.DefaultPushWorkers, "number of concurrent pushes for queued commands")
+		flAPNSPushRate      = flagset.Int("apns-push-rate", apns.DefaultPushRate, "maximum pushes per second for queued commands. 0 is unlimited")
+		flNudgeInterval     = flagset.Duration("nudge-interval", nudge.DefaultInterval, "push again to devices with pending commands which have been idle this long. 0 disables")
+		flNudgeMaxInterval  = flagset.Duration("nudge-max-interval", nudge.DefaultMaxInterval, "maximum wait between pushes to an idle device, the wait doubles from -nudge-interval")
+		flNudgeMaxAge       = flagset.Duration("nudge-max-age", nudge.DefaultMaxAge, "stop pushing to devices which have been idle this long")
+		flStaleDays         = flagset.Int("stale-days", 0, "mark devices which have not checked in for this many days as stale. 0 disables")
+		flStaleAction       = flagset.String("stale-action", string(stale.NoRemediation), "action on enrolled devices when they are marked stale. one of none, wipe or block")
+		flStalePurgeDays    = flagset.Int("stale-purge-days", 0, "remove the records of devices which have not checked in for this many days. 0 never removes them")
+		flStaleAllowWipe    = flagset.Bool("stale-allow-wipe", false, "allow -stale-action wipe to erase stale devices which do not answer a probe")
+		flBlueprintReapply  = flagset.Duration("blueprint-reapply-interval", bpbuiltin.DefaultReapplyInterval, "apply blueprints with ApplyAt Periodic again this often. 0 disables")
+		flBlueprintCheck    = flagset.Duration("blueprint-check-interval", bpbuiltin.DefaultCheckInterval, "check that the profiles and applications of blueprints are still installed this often, and queue the missing ones again. 0 disables")
+		flBlueprintRequeues = flagset.Int("blueprint-max-requeues", bpbuiltin.DefaultMaxRequeues, "queue a failed or missing profile or application of a blueprint again this many times before it is marked as permanently failed. 0 is unlimited")
+		flSetupTimeout      = flagset.Duration("await-configuration-timeout", bpbuiltin.DefaultSetupStepTimeout, "how long each blueprint may take to install on a device which awaits configuration")
+		flSetupFailure      = flagset.String("await-configuration-failure", string(bpbuiltin.ReleaseOnFailure), "when a blueprint fails on a device which awaits configuration, release it from Setup Assistant or hold it there. one of release or hold")
+		flDEPReconcile      = flagset.Duration("dep-reconcile-interval", depapi.DefaultReconcileInterval, "assign the intended DEP profile again to devices whose profile status drifted, this often. 0 disables")
 		flTLS               = flagset.Bool("tls", true, "use https")
 		flTLSCert           = flagset.String("tls-cert", "", "path to TLS certificate")
 		flTLSKey            = flagset.String("tls-key", "", "path to TLS private key")
 		flHTTPAddr          = flagset.String("http-addr", ":https", "http(s) listen address of mdm server. defaults to :8080 if tls is false")
 		flHTTPDebug         = flagset.Bool("http-debug", false, "enable debug for http(dumps full request)")
 		flRepoPath          = flagset.String("filerepo", "", "path to http file repo")
-		flDepSim            = flagset.String("depsim", "", "use depsim URL")
+		flDepSim            = flagset.String("depsim", "", "use depsim URL, or builtin for the in-process DEP simulator")
 		flExamples          = flagset.Bool("examples", false, "prints some example usage")
 		flCommandWebhookURL = flagset.String("command-webhook-url", "", "URL to send command responses.")
+		flCommandWebhookFmt = flagset.String("command-webhook-format", "raw", "format of events sent to -command-webhook-url. one of raw or enriched")
 		flHomePage          = flagset.Bool("homepage", true, "hosts a simple built-in webpage at the / address")
+		flStorage           = flagset.String("storage", env.String("MICROMDM_STORAGE", "bolt"), "storage backend. bolt, firestore://project-id, postgres://, mysql:// or sqlite:// URL")
 	)
 	flagset.Usage = usageFor(flagset, "micromdm serve [flags]")
 	if err := flagset.Parse(args); err != nil {
@@ -103,6 +129,30 @@ func serve(args []string) error {
 	if !*flTLS && (*flTLSCert != "" || *flTLSKey != "") {
 		return errors.New("cannot set -tls=false and supply -tls-cert or -tls-key")
 	}
+	if *flNudgeInterval > 0 && *flNudgeMaxInterval < *flNudgeInterval {
+		return errors.New("-nudge-max-interval must be at least -nudge-interval")
+	}
+	stalePolicy := stale.Policy{
+		StaleAfter:  time.Duration(*flStaleDays) * 24 * time.Hour,
+		Remediation: stale.Remediation(*flStaleAction),
+		PurgeAfter:  time.Duration(*flStalePurgeDays) * 24 * time.Hour,
+		AllowWipe:   *flStaleAllowWipe,
+	}
+	if *flStaleDays > 0 {
+		if err := stalePolicy.Verify(); err != nil {
+			return errors.Wrap(err, "stale device policy")
+		}
+	}
+	setupFailure, err := bpbuiltin.ParseSetupFailure(*flSetupFailure)
+	if err != nil {
+		return errors.Wrap(err, "-await-configuration-failure")
+	}
+	if *flSetupTimeout <= 0 {
+		return errors.New("-await-configuration-timeout must be positive")
+	}
+	if *flAPNSPushWorkers < 1 {
+		return errors.New("-apns-push-workers must be at least 1")
+	}
 	if *flAPNSCertPath != "" || *flAPNSKeyPass != "" || *flAPNSKeyPath != "" {
 		stdlog.Println("-apns-cert, -apns-password, and -apns-key switches are deprecated. please transition to `mdmctl mdmcert upload` instead")
 	}
@@ -116,14 +166,25 @@ func serve(args []string) error {
 		return errors.Wrapf(err, "creating config directory %s", *flConfigPath)
 	}
 	sm := &server.Server{
-		ConfigPath:          *flConfigPath,
-		ServerPublicURL:     strings.TrimRight(*flServerURL, "/"),
-		APNSCertificatePath: *flAPNSCertPath,
-		APNSPrivateKeyPass:  *flAPNSKeyPass,
-		APNSPrivateKeyPath:  *flAPNSKeyPath,
-		Depsim:              *flDepSim,
-		TLSCertPath:         *flTLSCert,
-		CommandWebhookURL:   *flCommandWebhookURL,
+		ConfigPath:           *flConfigPath,
+		ServerPublicURL:      strings.TrimRight(*flServerURL, "/"),
+		APNSCertificatePath:  *flAPNSCertPath,
+		APNSPrivateKeyPass:   *flAPNSKeyPass,
+		APNSPrivateKeyPath:   *flAPNSKeyPath,
+		APNSSandbox:          *flAPNSSandbox,
+		APNSTokenKeyPath:     *flAPNSTokenKey,
+		APNSTokenKeyID:       *flAPNSTokenKeyID,
+		APNSTokenTeamID:      *flAPNSTokenTeamID,
+		APNSPushWorkers:      *flAPNSPushWorkers,
+		APNSPushRate:         *flAPNSPushRate,
+		NudgeInterval:        *flNudgeInterval,
+		NudgeMaxInterval:     *flNudgeMaxInterval,
+		NudgeMaxAge:          *flNudgeMaxAge,
+		Depsim:               *flDepSim,
+		TLSCertPath:          *flTLSCert,
+		CommandWebhookURL:    *flCommandWebhookURL,
+		CommandWebhookFormat: *flCommandWebhookFmt,
+		Storage:              *flStorage,
 
 		WebhooksHTTPClient: &http.Client{Timeout: time.Second * 30},
 
@@ -134,7 +195,10 @@ func serve(args []string) error {
 		SCEPChallenge: "micromdm",
 	}
 
-	if err := sm.Setup(logger); err != nil {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := sm.Setup(ctx, logger); err != nil {
 		stdlog.Fatal(err)
 	}
 	syncer, err := sm.CreateDEPSyncer(logger)
@@ -151,34 +215,64 @@ func serve(args []string) error {
 		removeService = block.LoggingMiddleware(logger)(svc)
 	}
 
-	devDB, err := devicebuiltin.NewDB(sm.DB)
-	if err != nil {
-		stdlog.Fatal(err)
-	}
-
-	devWorker := device.NewWorker(devDB, sm.PubClient, logger)
+	userDB := sm.Stores.User
+
+	devDB := sm.DeviceDB
+	devWorker := device.NewWorker(devDB, sm.PubClient, logger,
+		device.WithEnrollmentReset(
+			func(udid string, authenticated time.Time) error {
+				return queue.ArchiveDeviceCommand(sm.Stores.Queue, udid, authenticated)
+			},
+			func(udid string, authenticated time.Time) error {
+				return user.DeleteDeviceUsersBefore(userDB, udid, authenticated)
+			},
+			func(udid string, _ time.Time) error { return sm.Stores.Blueprint.DeleteDeviceStates(udid) },
+		),
+	)
 	go devWorker.Run(context.Background())
 
-	userDB, err := userbuiltin.NewDB(sm.DB)
-	if err != nil {
-		stdlog.Fatal(err)
-	}
 	userWorker := user.NewWorker(userDB, sm.PubClient, logger)
 	go userWorker.Run(context.Background())
 
-	bpDB, err := blueprintbuiltin.NewDB(sm.DB, sm.ProfileDB, userDB)
-	if err != nil {
-		stdlog.Fatal(err)
+	groupsvc := group.New(sm.Stores.Group, devDB, sm.CommandService, sm.PubClient)
+	groupWorker := group.NewWorker(groupsvc, sm.PubClient, log.With(logger, "component", "groups"))
+	go groupWorker.Run(context.Background())
+
+	if *flStaleDays > 0 {
+		enforcer := stale.NewEnforcer(stalePolicy, sm.Stores.Stale, devDB, sm.CommandService,
+			removeService, device.New(devDB, sm.PubClient), sm.PubClient,
+			log.With(logger, "component", "stale"),
+			stale.WithCommandCanceler(func(udid, commandUUID string) (bool, error) {
+				return queue.CancelCommand(sm.Stores.Queue, udid, commandUUID)
+			}),
+			stale.WithLeader(sm.Leader.Held),
+		)
+		go enforcer.Run(ctx)
 	}
 
-	if err := bpDB.StartListener(sm.PubClient, sm.CommandService); err != nil {
-		stdlog.Fatal(err)
-	}
+	bpDB := sm.Stores.Blueprint
+	bpApplier := bpbuiltin.NewApplier(bpDB, devDB, sm.CommandService, groupsvc, sm.PubClient,
+		log.With(logger, "component", "blueprints"),
+		bpbuiltin.WithReapplyInterval(*flBlueprintReapply),
+		bpbuiltin.WithSetupStepTimeout(*flSetupTimeout),
+		bpbuiltin.WithSetupFailure(setupFailure),
+		bpbuiltin.WithReapplyLeader(sm.Leader.Held),
+	)
+	go bpApplier.Run(context.Background())
+	bpTracker := bpbuiltin.NewTracker(bpDB, sm.CommandService, sm.PubClient,
+		log.With(logger, "component", "blueprints"),
+		bpbuiltin.WithCheckInterval(*flBlueprintCheck),
+		bpbuiltin.WithMaxRequeues(*flBlueprintRequeues),
+		bpbuiltin.WithCheckLeader(sm.Leader.Held),
+	)
+	go bpTracker.Run(context.Background())
 
-	ctx := context.Background()
 	httpLogger := log.With(logger, "transport", "http")
 
-	dc := sm.DEPClient
+	depClients := make(map[string]depapi.DEPClient, len(sm.DEPClients))
+	for name, client := range sm.DEPClients {
+		depClients[name] = client
+	}
 	appDB := &appsbuiltin.Repo{Path: *flRepoPath}
 
 	scepEndpoints := scep.MakeServerEndpoints(sm.SCEPService)
@@ -216,7 +310,7 @@ func serve(args []string) error {
 		apnsEndpoints := apns.MakeServerEndpoints(sm.APNSPushService, basicAuthEndpointMiddleware)
 		apns.RegisterHTTPHandlers(r, apnsEndpoints, options...)
 
-		devicesvc := device.New(devDB)
+		devicesvc := device.New(devDB, sm.PubClient)
 		deviceEndpoints := device.MakeServerEndpoints(devicesvc, basicAuthEndpointMiddleware)
 		device.RegisterHTTPHandlers(r, deviceEndpoints, options...)
 
@@ -224,10 +318,16 @@ func serve(args []string) error {
 		profileEndpoints := profile.MakeServerEndpoints(profilesvc, basicAuthEndpointMiddleware)
 		profile.RegisterHTTPHandlers(r, profileEndpoints, options...)
 
-		blueprintsvc := blueprint.New(bpDB)
+		blueprintsvc := blueprint.New(bpDB, blueprint.WithApplier(bpApplier), blueprint.WithUnapplier(bpApplier))
 		blueprintEndpoints := blueprint.MakeServerEndpoints(blueprintsvc, basicAuthEndpointMiddleware)
 		blueprint.RegisterHTTPHandlers(r, blueprintEndpoints, options...)
 
+		groupEndpoints := group.MakeServerEndpoints(groupsvc, basicAuthEndpointMiddleware)
+		group.RegisterHTTPHandlers(r, groupEndpoints, options...)
+
+		staleEndpoints := stale.MakeServerEndpoints(stale.New(sm.Stores.Stale), basicAuthEndpointMiddleware)
+		stale.RegisterHTTPHandlers(r, staleEndpoints, options...)
+
 		blockEndpoints := block.MakeServerEndpoints(removeService, basicAuthEndpointMiddleware)
 		block.RegisterHTTPHandlers(r, blockEndpoints, options...)
 
@@ -242,12 +342,32 @@ func serve(args []string) error {
 		commandEndpoints := command.MakeServerEndpoints(sm.CommandService, basicAuthEndpointMiddleware)
 		command.RegisterHTTPHandlers(r, commandEndpoints, options...)
 
-		depsvc := depapi.New(dc, sm.PubClient)
+		depsvc := depapi.New(depClients, sm.Stores.DEPProfile, sm.PubClient)
+		if err := depsvc.Run(); err != nil {
+			stdlog.Fatal(err)
+		}
+		if *flDEPReconcile > 0 {
+			reconciler := depapi.NewReconciler(depsvc, sm.Stores.DEPProfile, devDB, sm.PubClient,
+				log.With(logger, "component", "dep_reconcile"),
+				depapi.WithReconcileInterval(*flDEPReconcile),
+				depapi.WithReconcileLeader(sm.Leader.Held),
+			)
+			go reconciler.Run(context.Background())
+		}
 		depEndpoints := depapi.MakeServerEndpoints(depsvc, basicAuthEndpointMiddleware)
 		depapi.RegisterHTTPHandlers(r, depEndpoints, options...)
 
-		depsyncEndpoints := sync.MakeServerEndpoints(sync.NewService(syncer, sm.SyncDB), basicAuthEndpointMiddleware)
+		depsyncEndpoints := sync.MakeServerEndpoints(sync.NewService(syncer, sm.SyncDB, devicesvc), basicAuthEndpointMiddleware)
 		sync.RegisterHTTPHandlers(r, depsyncEndpoints, options...)
+
+		// push dispatcher metrics, and anything else published with expvar.
+		r.Handle("/debug/vars", httputil2.BasicAuth("micromdm", *flAPIKey, "micromdm", expvar.Handler())).Methods("GET")
+
+		// online backups are only available for the BoltDB backend.
+		if sm.Stores.Backend == storage.Bolt {
+			backupEndpoints := backup.MakeServerEndpoints(backup.New(sm.DB), basicAuthEndpointMiddleware)
+			backup.RegisterHTTPHandlers(r, backupEndpoints, options...)
+		}
 	} else {
 		mainLogger.Log("msg", "no api key specified")
 	}
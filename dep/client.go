@@ -3,11 +3,11 @@ package dep
 import (
 	"bytes"
 	"encoding/json"
-	"io/ioutil"
 	"net/http"
 	"net/url"
 	"path"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/garyburd/go-oauth/oauth"
@@ -46,6 +46,8 @@ type Client struct {
 	consumerSecret   string //given by apple
 	accessToken      string //given by apple
 	accessSecret     string //given by apple
+
+	mtx              sync.Mutex
 	authSessionToken string //requested from DEP using above credentials
 	sessionExpires   time.Time
 
@@ -79,19 +81,41 @@ func NewClient(p OAuthParameters, opts ...Option) *Client {
 	return &client
 }
 
-func (c *Client) session() error {
+// session returns the auth session token, and requests a new one if there is
+// none or it expired.
+func (c *Client) session() (string, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
 	if c.authSessionToken == "" {
 		if err := c.newSession(); err != nil {
-			return errors.Wrap(err, "creating new auth session for dep")
+			return "", errors.Wrap(err, "creating new auth session for dep")
 		}
 	}
 
 	if time.Now().After(c.sessionExpires) {
 		if err := c.newSession(); err != nil {
-			return errors.Wrap(err, "refreshing expired dep session")
+			return "", errors.Wrap(err, "refreshing expired dep session")
 		}
 	}
-	return nil
+	return c.authSessionToken, nil
+}
+
+// expireSession forces a new session for the next request.
+func (c *Client) expireSession() {
+	c.mtx.Lock()
+	c.authSessionToken = ""
+	c.mtx.Unlock()
+}
+
+// updateSession stores a session token returned with a response. The DEP API
+// may replace the token while the session is in use.
+func (c *Client) updateSession(token string) {
+	if token == "" {
+		return
+	}
+	c.mtx.Lock()
+	c.authSessionToken = token
+	c.mtx.Unlock()
 }
 
 func (c *Client) newSession() error {
@@ -150,9 +174,9 @@ func (c *Client) newSession() error {
 	}
 	defer resp.Body.Close()
 
-	// check resp statuscode
+	// check resp statuscode. the OAuth tokens are refused once they expire.
 	if resp.StatusCode != http.StatusOK {
-		return errors.Errorf("establishing DEP session: %v", resp.Status)
+		return errors.Wrap(newError(resp), "establishing DEP session")
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&authSessionToken); err != nil {
@@ -192,23 +216,47 @@ func (c *Client) newRequest(method, urlStr string, body interface{}) (*http.Requ
 	return req, nil
 }
 
+// do performs the request with the auth session token. If the session is no
+// longer valid, a new session is requested and the request is sent again.
+// Failed DEP API responses are returned as *Error.
 func (c *Client) do(req *http.Request, into interface{}) error {
-	if err := c.session(); err != nil {
+	token, err := c.session()
+	if err != nil {
 		return errors.Wrapf(err, "get session for request to %s", c.baseURL.String())
 	}
-	req.Header.Add("X-ADM-Auth-Session", c.authSessionToken)
+	err = c.doSession(req, token, into)
+	if !IsCode(err, CodeUnauthorized) {
+		return err
+	}
+
+	c.expireSession()
+	token, err = c.session()
+	if err != nil {
+		return errors.Wrapf(err, "renew session for request to %s", c.baseURL.String())
+	}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return errors.Wrap(err, "reset dep request body for retry")
+		}
+		req.Body = body
+	}
+	return c.doSession(req, token, into)
+}
+
+func (c *Client) doSession(req *http.Request, token string, into interface{}) error {
+	req.Header.Set("X-ADM-Auth-Session", token)
 
 	resp, err := c.client.Do(req)
 	if err != nil {
 		return errors.Wrap(err, "perform dep request")
 	}
 	defer resp.Body.Close()
+	c.updateSession(resp.Header.Get("X-ADM-Auth-Session"))
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := ioutil.ReadAll(resp.Body)
-		return errors.Errorf("unexpected dep response. status=%d DEP API Error: %s", resp.StatusCode, string(body))
+		return newError(resp)
 	}
 	err = json.NewDecoder(resp.Body).Decode(into)
 	return errors.Wrap(err, "decode DEP response body")
-
 }
@@ -0,0 +1,121 @@
+package dep
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// testServer is a DEP API which hands out numbered session tokens, and serves
+// every other path with handler.
+func testServer(t *testing.T, handler http.HandlerFunc) (*Client, *int) {
+	sessions := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/session", func(w http.ResponseWriter, r *http.Request) {
+		sessions++
+		w.Write([]byte(`{"auth_session_token": "session-` + strconv.Itoa(sessions) + `"}`))
+	})
+	mux.HandleFunc("/", handler)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	u, _ := url.Parse(srv.URL)
+	return NewClient(OAuthParameters{ConsumerKey: "CK_test"}, WithServerURL(u)), &sessions
+}
+
+func TestClientRenewsSession(t *testing.T) {
+	requests := 0
+	client, sessions := testServer(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		// the first session expires after one request.
+		if r.Header.Get("X-ADM-Auth-Session") == "session-1" && requests > 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte("UNAUTHORIZED"))
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		if len(body) == 0 {
+			t.Error("have empty request body")
+		}
+		data, _ := ioutil.ReadFile("testdata/empty_sync_response.json")
+		w.Write(data)
+	})
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.SyncDevices("cursor"); err != nil {
+			t.Fatalf("sync %d: %s", i, err)
+		}
+	}
+	if have, want := *sessions, 2; have != want {
+		t.Errorf("have %d sessions, want %d", have, want)
+	}
+	if have, want := requests, 3; have != want {
+		t.Errorf("have %d requests, want %d", have, want)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		body       string
+		retryAfter string
+		want       Error
+	}{
+		{"bare code", 400, "EXHAUSTED_CURSOR", "",
+			Error{StatusCode: 400, Code: CodeExhaustedCursor}},
+		{"code with description", 400, "INVALID_CURSOR: cursor is not valid\n", "",
+			Error{StatusCode: 400, Code: CodeInvalidCursor, Message: "cursor is not valid"}},
+		{"json", 403, `{"code": "T_C_NOT_SIGNED", "message": "accept the terms"}`, "",
+			Error{StatusCode: 403, Code: CodeTermsNotSigned, Message: "accept the terms"}},
+		{"unavailable", 503, "", "120",
+			Error{StatusCode: 503, RetryAfter: 2 * time.Minute}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _ := testServer(t, func(w http.ResponseWriter, r *http.Request) {
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			})
+			_, err := client.FetchDevices()
+			if !IsCode(err, tt.want.Code) {
+				t.Fatalf("have error %v, want code %q", err, tt.want.Code)
+			}
+			have := errors.Cause(err).(*Error)
+			if *have != tt.want {
+				t.Errorf("have %#v, want %#v", *have, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeviceStatusResponses(t *testing.T) {
+	var paths []string
+	client, _ := testServer(t, func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		w.Write([]byte(`{"devices": {"C02-1": "SUCCESS", "C02-2": "NOT_ACCESSIBLE"}}`))
+	})
+
+	for _, fn := range []func(...string) (map[string]string, error){client.RemoveProfile, client.DisownDevices} {
+		devices, err := fn("C02-1", "C02-2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have, want := devices["C02-2"], "NOT_ACCESSIBLE"; have != want {
+			t.Errorf("have status %q, want %q", have, want)
+		}
+	}
+	if have, want := strings.Join(paths, ", "), "DELETE /profile/devices, POST /devices/disown"; have != want {
+		t.Errorf("have requests %s, want %s", have, want)
+	}
+}
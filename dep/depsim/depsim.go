@@ -0,0 +1,528 @@
+// Package depsim is an in-memory simulator of the DEP API, for tests and local
+// development without an Apple Business Manager account.
+//
+// A Server is an http.Handler, so tests can serve it with httptest:
+//
+//	sim := depsim.New()
+//	sim.AddDevices(depsim.SampleDevices(3)...)
+//	srv := httptest.NewServer(sim)
+//	u, _ := url.Parse(srv.URL)
+//	client := dep.NewClient(depsim.Credentials, dep.WithServerURL(u))
+//
+// The simulator implements sessions, the account, fetching and syncing devices
+// with cursors, device details, defining, fetching, assigning and removing
+// profiles, and disowning devices. Errors are returned with the codes of the
+// DEP API, and can be injected with FailNext.
+package depsim
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/dep"
+)
+
+// Credentials are the OAuth tokens the simulator accepts. They are also
+// accepted by the standalone depsim server.
+var Credentials = dep.OAuthParameters{
+	ConsumerKey:    "CK_48dd68d198350f51258e885ce9a5c37ab7f98543c4a697323d75682a6c10a32501cb247e3db08105db868f73f2c972bdb6ae77112aea803b9219eb52689d42e6",
+	ConsumerSecret: "CS_34c7b2b531a600d99a0e4edcf4a78ded79b86ef318118c2f5bcfee1b011108c32d5302df801adbe29d446eb78f02b13144e323eb9aad51c79f01e50cb45c3a68",
+	AccessToken:    "AT_927696831c59ba510cfe4ec1a69e5267c19881257d4bca2906a99d0785b785a6f6fdeb09774954fdd5e2d0ad952e3af52c6d8d2f21c924ba0caf4a031c158b89",
+	AccessSecret:   "AS_c31afd7a09691d83548489336e8ff1cb11b82b6bca13f793344496a556b1f4972eaff4dde6deb5ac9cf076fdfa97ec97699c34d515947b9cf9ed31c99dded6ba",
+}
+
+// CursorLifetime is how long a cursor can be used, like the DEP API.
+const CursorLifetime = 7 * 24 * time.Hour
+
+// Codes returned by the simulator in addition to the ones defined by the dep
+// package.
+const (
+	CodeMalformedRequest   dep.Code = "MALFORMED_REQUEST_BODY"
+	CodeProfileNotFound    dep.Code = "PROFILE_NOT_FOUND"
+	CodeConfigNameRequired dep.Code = "CONFIG_NAME_REQUIRED"
+	CodeConfigURLRequired  dep.Code = "CONFIG_URL_REQUIRED"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+)
+
+// Server simulates the DEP API of a single DEP token.
+type Server struct {
+	mtx sync.Mutex
+
+	account  dep.Account
+	devices  map[string]dep.Device
+	profiles map[string]dep.Profile
+	// events are the changes to devices, returned by sync.
+	events   []dep.Device
+	sessions map[string]bool
+	faults   map[string][]dep.Error
+	// cursors issued before cursorsValidAfter are expired.
+	cursorsValidAfter time.Time
+
+	now func() time.Time
+}
+
+// New creates a simulator without devices or profiles.
+func New() *Server {
+	return &Server{
+		account: dep.Account{
+			ServerName: "depsim",
+			ServerUUID: "DEPSIM-SERVER-UUID",
+			AdminID:    "admin@example.com",
+			OrgName:    "DEP Simulator",
+			OrgEmail:   "admin@example.com",
+			OrgID:      "DEPSIM-ORG",
+			OrgType:    "edu",
+			OrgVersion: "v2",
+		},
+		devices:  make(map[string]dep.Device),
+		profiles: make(map[string]dep.Profile),
+		sessions: make(map[string]bool),
+		faults:   make(map[string][]dep.Error),
+		now:      time.Now,
+	}
+}
+
+// Listen serves the simulator on addr in the background, and returns its URL.
+func (s *Server) Listen(addr string) (*url.URL, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "listen for DEP simulator")
+	}
+	go http.Serve(ln, s)
+	return &url.URL{Scheme: "http", Host: ln.Addr().String()}, nil
+}
+
+// SampleDevices returns n devices with serials DEPSIM0000001 and up.
+func SampleDevices(n int) []dep.Device {
+	models := []struct{ model, description, os, family, color string }{
+		{"MacBook Pro", "MBP 13.3 SPACE GRAY/2.0GHZ/8GB/256GB", "OSX", "Mac", "SPACE GRAY"},
+		{"iPad Air", "IPAD AIR WI-FI 64GB SILVER", "iOS", "iPad", "SILVER"},
+		{"iPhone XS", "IPHONE XS 64GB GOLD", "iOS", "iPhone", "GOLD"},
+	}
+	devices := make([]dep.Device, n)
+	for i := range devices {
+		m := models[i%len(models)]
+		devices[i] = dep.Device{
+			SerialNumber:     fmt.Sprintf("DEPSIM%07d", i+1),
+			Model:            m.model,
+			Description:      m.description,
+			OS:               m.os,
+			DeviceFamily:     m.family,
+			Color:            m.color,
+			OrderNumber:      "DEPSIM-ORDER",
+			DeviceAssignedBy: "admin@example.com",
+		}
+	}
+	return devices
+}
+
+// AddDevices adds devices to the DEP token, as if they were assigned to it in
+// Apple Business Manager.
+func (s *Server) AddDevices(devices ...dep.Device) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	now := s.now().UTC()
+	for _, d := range devices {
+		if d.ProfileStatus == "" {
+			d.ProfileStatus = dep.ProfileStatusEmpty
+		}
+		if d.DeviceAssignedDate.IsZero() {
+			d.DeviceAssignedDate = now
+		}
+		d.OpType, d.OpDate, d.ResponseStatus = "", time.Time{}, ""
+		s.devices[d.SerialNumber] = d
+		s.appendEvent(d, "added")
+	}
+}
+
+// Device returns a device of the DEP token.
+func (s *Server) Device(serial string) (dep.Device, bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	d, ok := s.devices[serial]
+	return d, ok
+}
+
+// ExpireSessions invalidates every auth session token, so clients have to
+// request a new session.
+func (s *Server) ExpireSessions() {
+	s.mtx.Lock()
+	s.sessions = make(map[string]bool)
+	s.mtx.Unlock()
+}
+
+// ExpireCursors expires every cursor issued so far.
+func (s *Server) ExpireCursors() {
+	s.mtx.Lock()
+	s.cursorsValidAfter = s.now()
+	s.mtx.Unlock()
+}
+
+// FailNext makes the next request to path fail with e. The path is relative
+// to the server, like "devices/sync" or "session".
+func (s *Server) FailNext(path string, e dep.Error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	path = strings.Trim(path, "/")
+	s.faults[path] = append(s.faults[path], e)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	path := strings.Trim(r.URL.Path, "/")
+	if faults := s.faults[path]; len(faults) > 0 {
+		s.faults[path] = faults[1:]
+		writeError(w, faults[0])
+		return
+	}
+
+	route := r.Method + " " + path
+	if route == "GET session" {
+		s.newSession(w, r)
+		return
+	}
+	handlers := map[string]func(http.ResponseWriter, *http.Request){
+		"GET account":            s.getAccount,
+		"POST server/devices":    s.fetchDevices,
+		"POST devices/sync":      s.syncDevices,
+		"POST devices":           s.deviceDetails,
+		"POST devices/disown":    s.disownDevices,
+		"POST profile":           s.defineProfile,
+		"GET profile":            s.fetchProfile,
+		"PUT profile/devices":    s.assignProfile,
+		"DELETE profile/devices": s.removeProfile,
+	}
+	handler, ok := handlers[route]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	token := r.Header.Get("X-ADM-Auth-Session")
+	if !s.sessions[token] {
+		writeError(w, dep.Error{StatusCode: http.StatusUnauthorized, Code: dep.CodeUnauthorized})
+		return
+	}
+	w.Header().Set("X-ADM-Auth-Session", token)
+	handler(w, r)
+}
+
+func (s *Server) newSession(w http.ResponseWriter, r *http.Request) {
+	if !strings.Contains(r.Header.Get("Authorization"), `oauth_consumer_key="`+Credentials.ConsumerKey+`"`) {
+		writeError(w, dep.Error{StatusCode: http.StatusForbidden, Code: dep.CodeForbidden})
+		return
+	}
+	token := "depsim-" + randomHex(16)
+	s.sessions[token] = true
+	writeJSON(w, map[string]string{"auth_session_token": token})
+}
+
+func (s *Server) getAccount(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.account)
+}
+
+// cursor is the position of a client in the device list while fetching, and
+// in the events while syncing. A fetch starts syncing from the events which
+// existed when it started.
+type cursor struct {
+	fetched  int
+	event    int
+	issuedAt time.Time
+}
+
+func (c cursor) String() string {
+	v := fmt.Sprintf("%d:%d:%d", c.fetched, c.event, c.issuedAt.UnixNano())
+	return base64.RawURLEncoding.EncodeToString([]byte(v))
+}
+
+func (s *Server) parseCursor(value string) (cursor, *dep.Error) {
+	invalid := &dep.Error{StatusCode: http.StatusBadRequest, Code: dep.CodeInvalidCursor}
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return cursor{}, invalid
+	}
+	parts := strings.Split(string(data), ":")
+	if len(parts) != 3 {
+		return cursor{}, invalid
+	}
+	var n [3]int64
+	for i, p := range parts {
+		if n[i], err = strconv.ParseInt(p, 10, 64); err != nil || n[i] < 0 {
+			return cursor{}, invalid
+		}
+	}
+	c := cursor{fetched: int(n[0]), event: int(n[1]), issuedAt: time.Unix(0, n[2])}
+	if c.event > len(s.events) {
+		return cursor{}, invalid
+	}
+	if c.issuedAt.Before(s.cursorsValidAfter) || s.now().Sub(c.issuedAt) > CursorLifetime {
+		return cursor{}, &dep.Error{StatusCode: http.StatusBadRequest, Code: dep.CodeExpiredCursor}
+	}
+	return c, nil
+}
+
+type deviceRequest struct {
+	Cursor string `json:"cursor"`
+	Limit  int    `json:"limit"`
+}
+
+func (req deviceRequest) limit() int {
+	if req.Limit <= 0 {
+		return defaultLimit
+	}
+	if req.Limit > maxLimit {
+		return maxLimit
+	}
+	return req.Limit
+}
+
+func (s *Server) fetchDevices(w http.ResponseWriter, r *http.Request) {
+	var req deviceRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	c := cursor{event: len(s.events)}
+	if req.Cursor != "" {
+		var e *dep.Error
+		if c, e = s.parseCursor(req.Cursor); e != nil {
+			writeError(w, *e)
+			return
+		}
+	}
+
+	serials := make([]string, 0, len(s.devices))
+	for serial := range s.devices {
+		serials = append(serials, serial)
+	}
+	sort.Strings(serials)
+	if req.Cursor != "" && c.fetched >= len(serials) {
+		writeError(w, dep.Error{StatusCode: http.StatusBadRequest, Code: dep.CodeExhaustedCursor})
+		return
+	}
+
+	end := c.fetched + req.limit()
+	if end > len(serials) {
+		end = len(serials)
+	}
+	devices := make([]dep.Device, 0, end-c.fetched)
+	for _, serial := range serials[c.fetched:end] {
+		devices = append(devices, s.devices[serial])
+	}
+	s.writeDevices(w, devices, cursor{fetched: end, event: c.event}, end < len(serials))
+}
+
+func (s *Server) syncDevices(w http.ResponseWriter, r *http.Request) {
+	var req deviceRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	if req.Cursor == "" {
+		writeError(w, dep.Error{StatusCode: http.StatusBadRequest, Code: dep.CodeCursorRequired})
+		return
+	}
+	c, e := s.parseCursor(req.Cursor)
+	if e != nil {
+		writeError(w, *e)
+		return
+	}
+	end := c.event + req.limit()
+	if end > len(s.events) {
+		end = len(s.events)
+	}
+	devices := append([]dep.Device{}, s.events[c.event:end]...)
+	s.writeDevices(w, devices, cursor{fetched: c.fetched, event: end}, end < len(s.events))
+}
+
+func (s *Server) writeDevices(w http.ResponseWriter, devices []dep.Device, c cursor, more bool) {
+	now := s.now().UTC()
+	c.issuedAt = now
+	writeJSON(w, dep.DeviceResponse{
+		Devices:      devices,
+		Cursor:       c.String(),
+		FetchedUntil: now,
+		MoreToFollow: more,
+	})
+}
+
+type serialsRequest struct {
+	ProfileUUID string   `json:"profile_uuid,omitempty"`
+	Devices     []string `json:"devices"`
+}
+
+func (s *Server) deviceDetails(w http.ResponseWriter, r *http.Request) {
+	var req serialsRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	resp := dep.DeviceDetailsResponse{Devices: make(map[string]dep.Device)}
+	for _, serial := range req.Devices {
+		d, ok := s.devices[serial]
+		if !ok {
+			resp.Devices[serial] = dep.Device{ResponseStatus: "NOT_ACCESSIBLE"}
+			continue
+		}
+		d.ResponseStatus = "SUCCESS"
+		resp.Devices[serial] = d
+	}
+	writeJSON(w, resp)
+}
+
+func (s *Server) disownDevices(w http.ResponseWriter, r *http.Request) {
+	var req serialsRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	statuses := s.updateDevices(req.Devices, func(d *dep.Device) string {
+		delete(s.devices, d.SerialNumber)
+		return "deleted"
+	})
+	writeJSON(w, map[string]map[string]string{"devices": statuses})
+}
+
+func (s *Server) defineProfile(w http.ResponseWriter, r *http.Request) {
+	var p dep.Profile
+	if !decodeRequest(w, r, &p) {
+		return
+	}
+	if p.ProfileName == "" {
+		writeError(w, dep.Error{StatusCode: http.StatusBadRequest, Code: CodeConfigNameRequired})
+		return
+	}
+	if p.URL == "" {
+		writeError(w, dep.Error{StatusCode: http.StatusBadRequest, Code: CodeConfigURLRequired})
+		return
+	}
+	p.ProfileUUID = strings.ToUpper(randomHex(16))
+	serials := p.Devices
+	p.Devices = nil
+	s.profiles[p.ProfileUUID] = p
+
+	writeJSON(w, dep.ProfileResponse{
+		ProfileUUID: p.ProfileUUID,
+		Devices:     s.assign(p.ProfileUUID, serials),
+	})
+}
+
+func (s *Server) fetchProfile(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.profiles[r.URL.Query().Get("profile_uuid")]
+	if !ok {
+		writeError(w, dep.Error{StatusCode: http.StatusBadRequest, Code: CodeProfileNotFound})
+		return
+	}
+	writeJSON(w, p)
+}
+
+func (s *Server) assignProfile(w http.ResponseWriter, r *http.Request) {
+	var req serialsRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	if _, ok := s.profiles[req.ProfileUUID]; !ok {
+		writeError(w, dep.Error{StatusCode: http.StatusBadRequest, Code: CodeProfileNotFound})
+		return
+	}
+	writeJSON(w, dep.ProfileResponse{
+		ProfileUUID: req.ProfileUUID,
+		Devices:     s.assign(req.ProfileUUID, req.Devices),
+	})
+}
+
+func (s *Server) removeProfile(w http.ResponseWriter, r *http.Request) {
+	var req serialsRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	statuses := s.updateDevices(req.Devices, func(d *dep.Device) string {
+		d.ProfileUUID = ""
+		d.ProfileStatus = dep.ProfileStatusRemoved
+		return "modified"
+	})
+	writeJSON(w, map[string]map[string]string{"devices": statuses})
+}
+
+func (s *Server) assign(profileUUID string, serials []string) map[string]string {
+	now := s.now().UTC()
+	return s.updateDevices(serials, func(d *dep.Device) string {
+		d.ProfileUUID = profileUUID
+		d.ProfileStatus = dep.ProfileStatusAssigned
+		d.ProfileAssignTime = now
+		return "modified"
+	})
+}
+
+// updateDevices calls fn for every device in serials, and records the change
+// as an event with the op type returned by fn. It returns the status of each
+// serial for the response.
+func (s *Server) updateDevices(serials []string, fn func(*dep.Device) string) map[string]string {
+	statuses := make(map[string]string, len(serials))
+	for _, serial := range serials {
+		d, ok := s.devices[serial]
+		if !ok {
+			statuses[serial] = "NOT_ACCESSIBLE"
+			continue
+		}
+		op := fn(&d)
+		if _, ok := s.devices[serial]; ok {
+			s.devices[serial] = d
+		}
+		s.appendEvent(d, op)
+		statuses[serial] = "SUCCESS"
+	}
+	return statuses
+}
+
+func (s *Server) appendEvent(d dep.Device, op string) {
+	d.OpType, d.OpDate = op, s.now().UTC()
+	s.events = append(s.events, d)
+}
+
+func decodeRequest(w http.ResponseWriter, r *http.Request, into interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(into); err != nil {
+		writeError(w, dep.Error{StatusCode: http.StatusBadRequest, Code: CodeMalformedRequest, Message: err.Error()})
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json;charset=UTF8")
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError responds like the DEP API, with the code and an optional
+// description in the body.
+func writeError(w http.ResponseWriter, e dep.Error) {
+	if e.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(e.RetryAfter/time.Second)))
+	}
+	body := string(e.Code)
+	if e.Message != "" {
+		body += ": " + e.Message
+	}
+	w.WriteHeader(e.StatusCode)
+	w.Write([]byte(body))
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,168 @@
+package depsim
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/dep"
+)
+
+func newTestServer(t *testing.T, sim *Server) *url.URL {
+	srv := httptest.NewServer(sim)
+	t.Cleanup(srv.Close)
+	u, _ := url.Parse(srv.URL)
+	return u
+}
+
+func newTestClient(t *testing.T, sim *Server) *dep.Client {
+	return dep.NewClient(Credentials, dep.WithServerURL(newTestServer(t, sim)))
+}
+
+func TestFetchAndSync(t *testing.T) {
+	sim := New()
+	sim.AddDevices(SampleDevices(5)...)
+	client := newTestClient(t, sim)
+
+	var (
+		fetched []dep.Device
+		cursor  string
+	)
+	for {
+		resp, err := client.FetchDevices(dep.Limit(2), dep.Cursor(cursor))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fetched = append(fetched, resp.Devices...)
+		cursor = resp.Cursor
+		if !resp.MoreToFollow {
+			break
+		}
+	}
+	if have, want := len(fetched), 5; have != want {
+		t.Fatalf("fetched %d devices, want %d", have, want)
+	}
+	if have, want := fetched[0].ProfileStatus, dep.ProfileStatusEmpty; have != want {
+		t.Errorf("have profile status %q, want %q", have, want)
+	}
+	if _, err := client.FetchDevices(dep.Cursor(cursor)); !dep.IsCode(err, dep.CodeExhaustedCursor) {
+		t.Errorf("fetch with exhausted cursor: have %v, want %s", err, dep.CodeExhaustedCursor)
+	}
+
+	// devices added after the fetch are returned by sync.
+	sim.AddDevices(dep.Device{SerialNumber: "NEW1"})
+	resp, err := client.SyncDevices(cursor, dep.Cursor(cursor))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Devices) != 1 || resp.Devices[0].SerialNumber != "NEW1" || resp.Devices[0].OpType != "added" {
+		t.Fatalf("have sync devices %+v, want NEW1 added", resp.Devices)
+	}
+	resp, err = client.SyncDevices(resp.Cursor, dep.Cursor(resp.Cursor))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have := len(resp.Devices); have != 0 {
+		t.Errorf("have %d devices on second sync, want none", have)
+	}
+
+	sim.ExpireCursors()
+	if _, err := client.SyncDevices(resp.Cursor, dep.Cursor(resp.Cursor)); !dep.IsCode(err, dep.CodeExpiredCursor) {
+		t.Errorf("sync with expired cursor: have %v, want %s", err, dep.CodeExpiredCursor)
+	}
+	if _, err := client.SyncDevices("bogus", dep.Cursor("bogus")); !dep.IsCode(err, dep.CodeInvalidCursor) {
+		t.Errorf("sync with invalid cursor: have %v, want %s", err, dep.CodeInvalidCursor)
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	sim := New()
+	sim.AddDevices(SampleDevices(3)...)
+	client := newTestClient(t, sim)
+
+	if _, err := client.DefineProfile(&dep.Profile{ProfileName: "no url"}); !dep.IsCode(err, CodeConfigURLRequired) {
+		t.Errorf("define profile without URL: have %v, want %s", err, CodeConfigURLRequired)
+	}
+	resp, err := client.DefineProfile(&dep.Profile{
+		ProfileName: "school",
+		URL:         "https://mdm.example.com/mdm/enroll",
+		Devices:     []string{"DEPSIM0000001"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := resp.Devices["DEPSIM0000001"], "SUCCESS"; have != want {
+		t.Errorf("define profile: have status %q, want %q", have, want)
+	}
+	profile, err := client.FetchProfile(resp.ProfileUUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := profile.ProfileName, "school"; have != want {
+		t.Errorf("have profile name %q, want %q", have, want)
+	}
+
+	assigned, err := client.AssignProfile(resp.ProfileUUID, "DEPSIM0000002", "UNKNOWN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := assigned.Devices["UNKNOWN"], "NOT_ACCESSIBLE"; have != want {
+		t.Errorf("assign unknown device: have status %q, want %q", have, want)
+	}
+	details, err := client.DeviceDetails("DEPSIM0000002")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := details.Devices["DEPSIM0000002"]
+	if d.ProfileUUID != resp.ProfileUUID || d.ProfileStatus != dep.ProfileStatusAssigned {
+		t.Errorf("have profile %q with status %q, want %q assigned", d.ProfileUUID, d.ProfileStatus, resp.ProfileUUID)
+	}
+
+	if _, err := client.RemoveProfile("DEPSIM0000002"); err != nil {
+		t.Fatal(err)
+	}
+	if d, _ := sim.Device("DEPSIM0000002"); d.ProfileStatus != dep.ProfileStatusRemoved {
+		t.Errorf("have profile status %q after remove, want %q", d.ProfileStatus, dep.ProfileStatusRemoved)
+	}
+
+	if _, err := client.DisownDevices("DEPSIM0000003"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := sim.Device("DEPSIM0000003"); ok {
+		t.Error("have disowned device, want it removed")
+	}
+}
+
+func TestSessionsAndFaults(t *testing.T) {
+	sim := New()
+	u := newTestServer(t, sim)
+	client := dep.NewClient(Credentials, dep.WithServerURL(u))
+
+	if _, err := client.Account(); err != nil {
+		t.Fatal(err)
+	}
+	// the client renews the session when it expires.
+	sim.ExpireSessions()
+	account, err := client.Account()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := account.ServerName, "depsim"; have != want {
+		t.Errorf("have server name %q, want %q", have, want)
+	}
+
+	sim.FailNext("account", dep.Error{StatusCode: http.StatusServiceUnavailable, RetryAfter: time.Minute})
+	_, err = client.Account()
+	if e, ok := errors.Cause(err).(*dep.Error); !ok || !e.Temporary() || e.RetryAfter != time.Minute {
+		t.Errorf("have error %v, want temporary error with retry after a minute", err)
+	}
+
+	forbidden := dep.NewClient(dep.OAuthParameters{ConsumerKey: "CK_wrong"}, dep.WithServerURL(u))
+	if _, err := forbidden.Account(); !dep.IsCode(err, dep.CodeForbidden) {
+		t.Errorf("have error %v with unknown consumer key, want %s", err, dep.CodeForbidden)
+	}
+}
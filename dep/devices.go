@@ -10,6 +10,15 @@ const (
 	fetchDevicesPath  = "server/devices"
 	syncDevicesPath   = "devices/sync"
 	deviceDetailsPath = "devices"
+	disownDevicesPath = "devices/disown"
+)
+
+// Profile statuses of a Device.
+const (
+	ProfileStatusEmpty    = "empty"
+	ProfileStatusAssigned = "assigned"
+	ProfileStatusPushed   = "pushed"
+	ProfileStatusRemoved  = "removed"
 )
 
 type Device struct {
@@ -26,6 +35,8 @@ type Device struct {
 	DeviceAssignedBy   string    `json:"device_assigned_by,omitempty"`
 	OS                 string    `json:"os,omitempty"`
 	DeviceFamily       string    `json:"device_family,omitempty"`
+	// OrderNumber is not included in every response.
+	OrderNumber string `json:"order_number,omitempty"`
 	// sync fields
 	OpType string    `json:"op_type,omitempty"`
 	OpDate time.Time `json:"op_date,omitempty"`
@@ -119,3 +130,23 @@ func (c *Client) DeviceDetails(serials ...string) (*DeviceDetailsResponse, error
 	err = c.do(req, &response)
 	return &response, errors.Wrap(err, "get device details")
 }
+
+// DisownDevices permanently removes devices from the DEP account. The response
+// maps each serial to SUCCESS, NOT_ACCESSIBLE or FAILED.
+func (c *Client) DisownDevices(serials ...string) (map[string]string, error) {
+	request := struct {
+		Devices []string `json:"devices"`
+	}{
+		Devices: serials,
+	}
+
+	var response struct {
+		Devices map[string]string `json:"devices"`
+	}
+	req, err := c.newRequest("POST", disownDevicesPath, request)
+	if err != nil {
+		return nil, errors.Wrap(err, "create disown devices request")
+	}
+	err = c.do(req, &response)
+	return response.Devices, errors.Wrap(err, "disown devices")
+}
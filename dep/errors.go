@@ -0,0 +1,101 @@
+package dep
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Code is the error code in the body of a failed DEP API response.
+type Code string
+
+// Codes which are handled by the client or the DEP sync. See the DEP API
+// documentation for the full list.
+const (
+	// CodeUnauthorized is returned when the auth session token expired. The
+	// client requests a new session and retries.
+	CodeUnauthorized Code = "UNAUTHORIZED"
+	// CodeForbidden is returned when the OAuth tokens are no longer accepted,
+	// for example after they expired or were revoked.
+	CodeForbidden Code = "FORBIDDEN"
+	// CodeTermsNotSigned is returned until new terms and conditions are
+	// accepted in Apple Business Manager.
+	CodeTermsNotSigned  Code = "T_C_NOT_SIGNED"
+	CodeExhaustedCursor Code = "EXHAUSTED_CURSOR"
+	CodeExpiredCursor   Code = "EXPIRED_CURSOR"
+	CodeInvalidCursor   Code = "INVALID_CURSOR"
+	CodeCursorRequired  Code = "CURSOR_REQUIRED"
+)
+
+// Error is a failed DEP API response.
+type Error struct {
+	StatusCode int
+	Code       Code
+	// Message is the description which follows the code, if any.
+	Message string
+	// RetryAfter is how long to wait before retrying, when the server asks
+	// for a wait with the Retry-After header.
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	code := string(e.Code)
+	if code == "" {
+		code = http.StatusText(e.StatusCode)
+	}
+	msg := "dep: " + code + " (status " + strconv.Itoa(e.StatusCode) + ")"
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// Temporary reports whether the request may succeed if it is retried later.
+func (e *Error) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// IsCode reports whether err is a DEP API error with the code c.
+func IsCode(err error, c Code) bool {
+	e, ok := errors.Cause(err).(*Error)
+	return ok && e.Code == c
+}
+
+var codeRegexp = regexp.MustCompile(`^[A-Z][A-Z_]*$`)
+
+// newError creates an Error from a response which is not 200 OK. Most
+// endpoints respond with the bare code, some with a JSON object.
+func newError(resp *http.Response) *Error {
+	body, _ := ioutil.ReadAll(resp.Body)
+	e := &Error{StatusCode: resp.StatusCode}
+	var obj struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &obj); err == nil && obj.Code != "" {
+		e.Code, e.Message = Code(obj.Code), obj.Message
+	} else {
+		text := strings.TrimSpace(string(body))
+		// codes like "INVALID_CURSOR" are sometimes followed by a description,
+		// and errors of the session endpoint are OAuth problem descriptions.
+		code, msg := text, ""
+		if i := strings.IndexAny(text, " \n:"); i > 0 {
+			code, msg = text[:i], strings.TrimSpace(strings.TrimLeft(text[i:], ":"))
+		}
+		if codeRegexp.MatchString(code) {
+			e.Code, e.Message = Code(code), msg
+		} else {
+			e.Message = text
+		}
+	}
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		e.RetryAfter = time.Duration(secs) * time.Second
+	}
+	return e
+}
@@ -77,16 +77,20 @@ func (c *Client) FetchProfile(uuid string) (*Profile, error) {
 	return &response, errors.Wrap(err, "fetch profile")
 }
 
+// RemoveProfile unassigns the profile of devices. The response maps each
+// serial to SUCCESS, NOT_ACCESSIBLE or FAILED.
 func (c *Client) RemoveProfile(serials ...string) (map[string]string, error) {
-	var response map[string]string
+	var response struct {
+		Devices map[string]string `json:"devices"`
+	}
 	var request = struct {
 		Devices []string `json:"devices"`
 	}{Devices: serials}
 
 	req, err := c.newRequest("DELETE", assignProfilePath, &request)
 	if err != nil {
-		return nil, errors.Wrap(err, "create fetch profile request")
+		return nil, errors.Wrap(err, "create remove profile request")
 	}
 	err = c.do(req, &response)
-	return response, errors.Wrap(err, "remove profile")
+	return response.Devices, errors.Wrap(err, "remove profile")
 }
@@ -3,13 +3,15 @@ module github.com/vishnuvaradaraj/micromdm
 require (
 	cloud.google.com/go v0.27.0
 	contrib.go.opencensus.io/exporter/stackdriver v0.6.0 // indirect
+	filippo.io/edwards25519 v1.2.0 // indirect
 	firebase.google.com/go v3.4.0+incompatible
-	github.com/RobotsAndPencils/buford v0.12.0
+	github.com/VividCortex/gohistogram v1.0.0 // indirect
 	github.com/boltdb/bolt v1.3.1
 	github.com/fullsailor/pkcs7 v0.0.0-20180824154052-36585635cb64
 	github.com/garyburd/go-oauth v0.0.0-20180319155456-bca2e7f09a17
 	github.com/go-kit/kit v0.7.0
 	github.com/go-logfmt/logfmt v0.3.0 // indirect
+	github.com/go-sql-driver/mysql v1.10.1
 	github.com/go-stack/stack v1.7.0 // indirect
 	github.com/gogo/protobuf v1.0.0
 	github.com/golang/protobuf v1.2.0
@@ -20,6 +22,8 @@ require (
 	github.com/groob/plist v0.0.0-20180203051248-dd56909aee38
 	github.com/kr/logfmt v0.0.0-20140226030751-b84e30acd515 // indirect
 	github.com/kr/pretty v0.1.0 // indirect
+	github.com/lib/pq v1.12.3
+	github.com/mattn/go-sqlite3 v1.14.52
 	github.com/micromdm/go4 v0.0.0-20171021081444-deded5397014
 	github.com/micromdm/scep v1.0.0
 	github.com/pkg/errors v0.8.0
@@ -0,0 +1,313 @@
+// Package devicesim simulates Apple devices which enroll with MicroMDM, for
+// end-to-end and load tests without real hardware.
+//
+// A simulated device fetches the enrollment profile, requests its identity
+// certificate with SCEP, signs every MDM request with the Mdm-Signature
+// header, sends the Authenticate, TokenUpdate and CheckOut check-in messages
+// and answers queued commands with the replies of its Responder.
+package devicesim
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/fullsailor/pkcs7"
+	"github.com/groob/plist"
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+// Device is a simulated device. The exported fields are reported to the
+// server, and can be changed before the device enrolls.
+type Device struct {
+	UDID         string
+	SerialNumber string
+	DeviceName   string
+	Model        string
+	ModelName    string
+	ProductName  string
+	OSVersion    string
+	BuildVersion string
+
+	client    *http.Client
+	responder Responder
+	keyBits   int
+
+	mtx        sync.Mutex
+	key        *rsa.PrivateKey
+	cert       *x509.Certificate
+	checkInURL string
+	serverURL  string
+	topic      string
+	token      []byte
+	pushMagic  string
+	enrolled   bool
+}
+
+// Option configures a Device.
+type Option func(*Device)
+
+// WithHTTPClient sets the HTTP client of the device. Load tests should share
+// one client between devices, so that connections are reused.
+func WithHTTPClient(client *http.Client) Option {
+	return func(d *Device) {
+		d.client = client
+	}
+}
+
+// WithResponder sets how the device answers commands. The default is
+// DefaultResponder.
+func WithResponder(r Responder) Option {
+	return func(d *Device) {
+		d.responder = r
+	}
+}
+
+// WithKeyBits overrides the RSA key size requested by the enrollment profile.
+// Smaller keys make enrolling thousands of devices faster.
+func WithKeyBits(bits int) Option {
+	return func(d *Device) {
+		d.keyBits = bits
+	}
+}
+
+// New creates a Mac with the serial number serial and a random UDID.
+func New(serial string, opts ...Option) *Device {
+	d := &Device{
+		UDID:         strings.ToUpper(uuid.NewV4().String()),
+		SerialNumber: serial,
+		DeviceName:   "Simulated Mac " + serial,
+		Model:        "MacBookPro15,1",
+		ModelName:    "MacBook Pro",
+		ProductName:  "MacBookPro15,1",
+		OSVersion:    "10.14.1",
+		BuildVersion: "18B75",
+		client:       http.DefaultClient,
+		responder:    DefaultResponder,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// Enrolled reports whether the device has sent a TokenUpdate, and has not
+// checked out since.
+func (d *Device) Enrolled() bool {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	return d.enrolled
+}
+
+// Certificate returns the identity certificate of the device, or nil before
+// it enrolled.
+func (d *Device) Certificate() *x509.Certificate {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	return d.cert
+}
+
+type checkinMessage struct {
+	MessageType  string
+	Topic        string
+	UDID         string
+	OSVersion    string `plist:",omitempty"`
+	BuildVersion string `plist:",omitempty"`
+	ProductName  string `plist:",omitempty"`
+	SerialNumber string `plist:",omitempty"`
+	DeviceName   string `plist:",omitempty"`
+	Model        string `plist:",omitempty"`
+	ModelName    string `plist:",omitempty"`
+	Token        []byte `plist:",omitempty"`
+	PushMagic    string `plist:",omitempty"`
+	UnlockToken  []byte `plist:",omitempty"`
+}
+
+// Authenticate sends the Authenticate check-in message.
+func (d *Device) Authenticate(ctx context.Context) error {
+	msg := d.checkinMessage("Authenticate")
+	msg.OSVersion = d.OSVersion
+	msg.BuildVersion = d.BuildVersion
+	msg.ProductName = d.ProductName
+	msg.SerialNumber = d.SerialNumber
+	msg.DeviceName = d.DeviceName
+	msg.Model = d.Model
+	msg.ModelName = d.ModelName
+	return d.checkin(ctx, msg)
+}
+
+// TokenUpdate sends the TokenUpdate check-in message with a random push
+// token. The token is kept for later TokenUpdate messages.
+func (d *Device) TokenUpdate(ctx context.Context) error {
+	d.mtx.Lock()
+	if d.token == nil {
+		d.token = make([]byte, 32)
+		rand.Read(d.token)
+		d.pushMagic = strings.ToUpper(uuid.NewV4().String())
+	}
+	token, pushMagic := d.token, d.pushMagic
+	d.mtx.Unlock()
+
+	msg := d.checkinMessage("TokenUpdate")
+	msg.Token = token
+	msg.PushMagic = pushMagic
+	msg.UnlockToken = []byte("simulated unlock token")
+	if err := d.checkin(ctx, msg); err != nil {
+		return err
+	}
+	d.mtx.Lock()
+	d.enrolled = true
+	d.mtx.Unlock()
+	return nil
+}
+
+// CheckOut sends the CheckOut check-in message, like a device whose
+// enrollment profile is removed.
+func (d *Device) CheckOut(ctx context.Context) error {
+	if err := d.checkin(ctx, d.checkinMessage("CheckOut")); err != nil {
+		return err
+	}
+	d.mtx.Lock()
+	d.enrolled = false
+	d.mtx.Unlock()
+	return nil
+}
+
+func (d *Device) checkinMessage(messageType string) checkinMessage {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	return checkinMessage{MessageType: messageType, Topic: d.topic, UDID: d.UDID}
+}
+
+func (d *Device) checkin(ctx context.Context, msg checkinMessage) error {
+	d.mtx.Lock()
+	url := d.checkInURL
+	d.mtx.Unlock()
+	if url == "" {
+		return errors.New("device is not enrolled")
+	}
+	body, err := plist.Marshal(msg)
+	if err != nil {
+		return errors.Wrapf(err, "marshal %s message", msg.MessageType)
+	}
+	_, err = d.put(ctx, url, body)
+	return errors.Wrap(err, msg.MessageType)
+}
+
+// Connect connects to the server like a device which received a push
+// notification. It reports that it is idle, and answers every command the
+// server sends until the queue is empty. It returns the number of commands
+// answered.
+func (d *Device) Connect(ctx context.Context) (int, error) {
+	d.mtx.Lock()
+	url := d.serverURL
+	d.mtx.Unlock()
+	if url == "" {
+		return 0, errors.New("device is not enrolled")
+	}
+
+	var (
+		answered int
+		seen     = make(map[string]bool)
+		reply    = Reply{Status: "Idle"}
+		cmd      Command
+	)
+	for {
+		body, err := d.marshalReply(cmd, reply)
+		if err != nil {
+			return answered, err
+		}
+		resp, err := d.put(ctx, url, body)
+		if err != nil {
+			return answered, errors.Wrap(err, "connect")
+		}
+		if len(resp) == 0 {
+			return answered, nil
+		}
+		cmd, err = parseCommand(resp)
+		if err != nil {
+			return answered, err
+		}
+		// the server sends the same command again if it did not record the
+		// reply, stop instead of looping.
+		if seen[cmd.CommandUUID] {
+			return answered, nil
+		}
+		seen[cmd.CommandUUID] = true
+		reply = d.responder.Respond(d, cmd)
+		answered++
+	}
+}
+
+func (d *Device) marshalReply(cmd Command, reply Reply) ([]byte, error) {
+	resp := make(map[string]interface{}, len(reply.Fields)+3)
+	for k, v := range reply.Fields {
+		resp[k] = v
+	}
+	resp["UDID"] = d.UDID
+	resp["Status"] = reply.Status
+	if cmd.CommandUUID != "" {
+		resp["CommandUUID"] = cmd.CommandUUID
+	}
+	body, err := plist.Marshal(resp)
+	return body, errors.Wrapf(err, "marshal reply to %s", cmd.RequestType)
+}
+
+// put sends a signed MDM request and returns the response body.
+func (d *Device) put(ctx context.Context, url string, body []byte) ([]byte, error) {
+	sig, err := d.sign(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPut, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-apple-aspen-mdm")
+	req.Header.Set("Mdm-Signature", sig)
+	return d.do(req)
+}
+
+// sign returns the Mdm-Signature header of body, a detached CMS signature
+// with the identity certificate.
+func (d *Device) sign(body []byte) (string, error) {
+	d.mtx.Lock()
+	key, cert := d.key, d.cert
+	d.mtx.Unlock()
+	if cert == nil {
+		return "", errors.New("device has no identity certificate")
+	}
+	sd, err := pkcs7.NewSignedData(body)
+	if err != nil {
+		return "", errors.Wrap(err, "create signed data")
+	}
+	if err := sd.AddSigner(cert, key, pkcs7.SignerInfoConfig{}); err != nil {
+		return "", errors.Wrap(err, "add signer")
+	}
+	sd.Detach()
+	sig, err := sd.Finish()
+	if err != nil {
+		return "", errors.Wrap(err, "sign request")
+	}
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
+
+// StatusError is returned when the server does not respond with 200 OK. The
+// server responds with 401 Unauthorized to devices it does not accept, and to
+// devices which were removed.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return "server responded with " + strconv.Itoa(e.StatusCode) + " " + http.StatusText(e.StatusCode)
+}
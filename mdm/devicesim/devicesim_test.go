@@ -0,0 +1,234 @@
+package devicesim
+
+import (
+	"context"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/go-kit/kit/log"
+	"github.com/gorilla/mux"
+	"github.com/groob/plist"
+	boltdepot "github.com/vishnuvaradaraj/scep/depot/bolt"
+	scepserver "github.com/vishnuvaradaraj/scep/server"
+
+	"github.com/vishnuvaradaraj/micromdm/mdm"
+	"github.com/vishnuvaradaraj/micromdm/mdm/enroll"
+	"github.com/vishnuvaradaraj/micromdm/platform/profile"
+	"github.com/vishnuvaradaraj/micromdm/platform/pubsub/inmem"
+)
+
+const testTopic = "com.apple.mgmt.External.test"
+
+type staticTopic string
+
+func (t staticTopic) PushTopic() (string, error) { return string(t), nil }
+
+// noProfiles makes the enrollment service generate the enrollment profile.
+type noProfiles struct{ profile.Store }
+
+type notFound struct{}
+
+func (notFound) Error() string  { return "not found" }
+func (notFound) NotFound() bool { return true }
+
+func (noProfiles) ProfileById(string) (*profile.Profile, error) { return nil, notFound{} }
+
+// fakeMDM accepts requests signed with a certificate of the SCEP CA, records
+// them, and sends the queued commands.
+type fakeMDM struct {
+	ca *x509.Certificate
+
+	mtx      sync.Mutex
+	checkins []mdm.CheckinEvent
+	acks     []mdm.AcknowledgeEvent
+	queue    [][]byte
+}
+
+func (s *fakeMDM) verify(ctx context.Context) error {
+	cert, err := mdm.DeviceCertificateFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	return cert.CheckSignatureFrom(s.ca)
+}
+
+func (s *fakeMDM) Checkin(ctx context.Context, event mdm.CheckinEvent) error {
+	if err := s.verify(ctx); err != nil {
+		return err
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.checkins = append(s.checkins, event)
+	return nil
+}
+
+func (s *fakeMDM) Acknowledge(ctx context.Context, event mdm.AcknowledgeEvent) ([]byte, error) {
+	if err := s.verify(ctx); err != nil {
+		return nil, err
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.acks = append(s.acks, event)
+	if len(s.queue) == 0 {
+		return nil, nil
+	}
+	next := s.queue[0]
+	s.queue = s.queue[1:]
+	return next, nil
+}
+
+// newTestServer serves the enrollment profile, SCEP and the MDM endpoints.
+// The enrollment profile has the SCEP challenge challenge, the SCEP server
+// only accepts "secret".
+func newTestServer(t *testing.T, challenge string) (*httptest.Server, *fakeMDM) {
+	f, err := ioutil.TempFile("", "bolt-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	t.Cleanup(func() { os.Remove(f.Name()) })
+	db, err := bolt.Open(f.Name(), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	depot, err := boltdepot.NewBoltDepot(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := depot.CreateOrLoadKey(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := depot.CreateOrLoadCA(key, 5, "MicroMDM", "US")
+	if err != nil {
+		t.Fatal(err)
+	}
+	scepService, err := scepserver.NewService(depot, scepserver.ChallengePassword("secret"), scepserver.ClientValidity(365))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := mux.NewRouter()
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+
+	enrollService, err := enroll.NewService(staticTopic(testTopic), inmem.NewPubSub(), srv.URL+"/scep", challenge, srv.URL, "", "", noProfiles{}, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	enrollHandlers := enroll.MakeHTTPHandlers(context.Background(), enroll.MakeServerEndpoints(enrollService, depot))
+	r.Handle("/mdm/enroll", enrollHandlers.EnrollHandler)
+	r.Handle("/scep", scepserver.MakeHTTPHandler(scepserver.MakeServerEndpoints(scepService), scepService, log.NewNopLogger()))
+
+	svc := &fakeMDM{ca: ca}
+	mdm.RegisterHTTPHandlers(r, mdm.MakeServerEndpoints(svc), log.NewNopLogger())
+	return srv, svc
+}
+
+func commandPayload(t *testing.T, uuid, requestType string) []byte {
+	payload, err := plist.Marshal(map[string]interface{}{
+		"CommandUUID": uuid,
+		"Command":     map[string]interface{}{"RequestType": requestType},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return payload
+}
+
+func TestEnrollAndAnswerCommands(t *testing.T) {
+	srv, svc := newTestServer(t, "secret")
+	ctx := context.Background()
+	d := New("SIM0001", WithKeyBits(1024), WithResponder(Script{
+		"DeviceLock": {Status: "Error"},
+	}))
+
+	if err := d.Enroll(ctx, srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	if !d.Enrolled() {
+		t.Error("have device not enrolled after Enroll")
+	}
+	if have, want := d.Certificate().Subject.CommonName, "MicroMDM Identity (Simulated Mac SIM0001)"; have != want {
+		t.Errorf("have certificate CN %q, want %q", have, want)
+	}
+
+	svc.mtx.Lock()
+	if have, want := len(svc.checkins), 2; have != want {
+		t.Fatalf("have %d check-ins, want %d", have, want)
+	}
+	auth, update := svc.checkins[0].Command, svc.checkins[1].Command
+	if auth.MessageType != "Authenticate" || auth.SerialNumber != "SIM0001" || auth.UDID != d.UDID {
+		t.Errorf("have Authenticate %+v", auth)
+	}
+	if update.MessageType != "TokenUpdate" || update.Topic != testTopic || len(update.Token) == 0 {
+		t.Errorf("have TokenUpdate %+v", update)
+	}
+	svc.queue = [][]byte{
+		commandPayload(t, "cmd-1", "DeviceInformation"),
+		commandPayload(t, "cmd-2", "DeviceLock"),
+	}
+	svc.mtx.Unlock()
+
+	answered, err := d.Connect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := answered, 2; have != want {
+		t.Errorf("answered %d commands, want %d", have, want)
+	}
+
+	svc.mtx.Lock()
+	var statuses []string
+	for _, ack := range svc.acks {
+		statuses = append(statuses, ack.Response.Status+" "+ack.Response.CommandUUID)
+	}
+	if have, want := len(statuses), 3; have != want {
+		t.Fatalf("have %d acknowledgements, want %d", have, want)
+	}
+	for i, want := range []string{"Idle ", "Acknowledged cmd-1", "Error cmd-2"} {
+		if statuses[i] != want {
+			t.Errorf("acknowledgement %d: have %q, want %q", i, statuses[i], want)
+		}
+	}
+	var info struct {
+		QueryResponses struct{ SerialNumber string }
+	}
+	if err := plist.Unmarshal(svc.acks[1].Raw, &info); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := info.QueryResponses.SerialNumber, "SIM0001"; have != want {
+		t.Errorf("have DeviceInformation serial %q, want %q", have, want)
+	}
+	svc.mtx.Unlock()
+
+	if err := d.CheckOut(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if d.Enrolled() {
+		t.Error("have device enrolled after CheckOut")
+	}
+}
+
+func TestEnrollWrongChallenge(t *testing.T) {
+	srv, svc := newTestServer(t, "wrong")
+	d := New("SIM0002", WithKeyBits(1024))
+	if err := d.Enroll(context.Background(), srv.URL); err == nil {
+		t.Fatal("have no error enrolling with the wrong SCEP challenge")
+	}
+	if _, err := d.Connect(context.Background()); err == nil {
+		t.Error("have no error connecting without enrolling")
+	}
+	svc.mtx.Lock()
+	defer svc.mtx.Unlock()
+	if have := len(svc.checkins); have != 0 {
+		t.Errorf("have %d check-ins, want none", have)
+	}
+}
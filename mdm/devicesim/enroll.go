@@ -0,0 +1,339 @@
+package devicesim
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/fullsailor/pkcs7"
+	"github.com/groob/plist"
+	"github.com/pkg/errors"
+	"github.com/vishnuvaradaraj/scep/crypto/x509util"
+	"github.com/vishnuvaradaraj/scep/scep"
+)
+
+// Enroll enrolls the device with the MicroMDM server at serverURL, like a
+// user who installs the profile from /mdm/enroll. The device requests its
+// identity certificate from the SCEP server of the profile, and sends the
+// Authenticate and TokenUpdate check-in messages.
+func (d *Device) Enroll(ctx context.Context, serverURL string) error {
+	profile, err := d.fetchEnrollmentProfile(ctx, strings.TrimRight(serverURL, "/")+"/mdm/enroll")
+	if err != nil {
+		return err
+	}
+	var (
+		mdm  *profilePayload
+		scep *scepPayload
+	)
+	for i, p := range profile.PayloadContent {
+		switch p.PayloadType {
+		case "com.apple.mdm":
+			mdm = &profile.PayloadContent[i]
+		case "com.apple.security.scep":
+			scep = p.SCEP
+		}
+	}
+	if mdm == nil {
+		return errors.New("enrollment profile has no MDM payload")
+	}
+	if scep == nil {
+		return errors.New("enrollment profile has no SCEP payload")
+	}
+
+	key, cert, err := d.requestCertificate(ctx, scep)
+	if err != nil {
+		return errors.Wrap(err, "request identity certificate")
+	}
+	d.mtx.Lock()
+	d.key, d.cert = key, cert
+	d.serverURL = mdm.ServerURL
+	d.checkInURL = mdm.CheckInURL
+	if d.checkInURL == "" {
+		// without a check-in URL, devices check in with the server URL.
+		d.checkInURL = mdm.ServerURL
+	}
+	d.topic = mdm.Topic
+	d.mtx.Unlock()
+
+	if err := d.Authenticate(ctx); err != nil {
+		return err
+	}
+	return d.TokenUpdate(ctx)
+}
+
+type enrollmentProfile struct {
+	PayloadContent []profilePayload
+}
+
+// profilePayload is a payload of the enrollment profile. The MDM settings
+// are top level keys, the SCEP settings are in the PayloadContent.
+type profilePayload struct {
+	PayloadType string
+	ServerURL   string
+	CheckInURL  string
+	Topic       string
+	SCEP        *scepPayload
+}
+
+type scepPayload struct {
+	URL       string
+	Challenge string
+	Subject   [][][]string
+	Keysize   int
+}
+
+func (p *profilePayload) UnmarshalPlist(f func(interface{}) error) error {
+	var payload struct {
+		PayloadType string
+		ServerURL   string
+		CheckInURL  string
+		Topic       string
+	}
+	if err := f(&payload); err != nil {
+		return err
+	}
+	p.PayloadType = payload.PayloadType
+	p.ServerURL = payload.ServerURL
+	p.CheckInURL = payload.CheckInURL
+	p.Topic = payload.Topic
+	if p.PayloadType == "com.apple.security.scep" {
+		var scep struct {
+			PayloadContent scepPayload
+		}
+		if err := f(&scep); err != nil {
+			return err
+		}
+		p.SCEP = &scep.PayloadContent
+	}
+	return nil
+}
+
+func (d *Device) fetchEnrollmentProfile(ctx context.Context, url string) (*enrollmentProfile, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	body, err := d.do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrap(err, "fetch enrollment profile")
+	}
+	// the profile is signed if it was uploaded with mdmctl apply profiles.
+	if trimmed := bytes.TrimSpace(body); !bytes.HasPrefix(trimmed, []byte("<")) && !bytes.HasPrefix(trimmed, []byte("bplist")) {
+		p7, err := pkcs7.Parse(body)
+		if err != nil {
+			return nil, errors.Wrap(err, "parse signed enrollment profile")
+		}
+		body = p7.Content
+	}
+	var profile enrollmentProfile
+	err = plist.Unmarshal(body, &profile)
+	return &profile, errors.Wrap(err, "unmarshal enrollment profile")
+}
+
+// requestCertificate creates a key and requests a certificate for it from the
+// SCEP server, like the SCEP payload of a profile.
+func (d *Device) requestCertificate(ctx context.Context, p *scepPayload) (*rsa.PrivateKey, *x509.Certificate, error) {
+	bits := p.Keysize
+	if d.keyBits > 0 {
+		bits = d.keyBits
+	}
+	if bits == 0 {
+		bits = 2048
+	}
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "generate key")
+	}
+
+	caps, err := d.scepRequest(ctx, p.URL, "GetCACaps", nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	supports := func(capability string) bool {
+		for _, c := range strings.Fields(string(caps)) {
+			if c == capability {
+				return true
+			}
+		}
+		return false
+	}
+	sigAlgo := x509.SHA1WithRSA
+	if supports("SHA-256") || supports("SCEPStandard") {
+		sigAlgo = x509.SHA256WithRSA
+	}
+	var encryptionAlgo int
+	if supports("AES") || supports("SCEPStandard") {
+		encryptionAlgo = pkcs7.EncryptionAlgorithmAES128GCM
+	}
+
+	caData, err := d.scepRequest(ctx, p.URL, "GetCACert", nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	recipients, err := x509.ParseCertificates(caData)
+	if err != nil {
+		// a CA with an RA certificate responds with a degenerate PKCS#7.
+		if recipients, err = scep.CACerts(caData); err != nil {
+			return nil, nil, errors.Wrap(err, "parse CA certificates")
+		}
+	}
+
+	csrDER, err := x509util.CreateCertificateRequest(rand.Reader, &x509util.CertificateRequest{
+		CertificateRequest: x509.CertificateRequest{
+			Subject:            d.subject(p.Subject),
+			SignatureAlgorithm: sigAlgo,
+		},
+		ChallengePassword: p.Challenge,
+	}, key)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "create CSR")
+	}
+	csr, err := x509.ParseCertificateRequest(csrDER)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "parse CSR")
+	}
+	signer, err := selfSign(key, csr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	msg, err := scep.NewCSRRequest(csr, &scep.PKIMessage{
+		MessageType:             scep.PKCSReq,
+		Recipients:              recipients,
+		SignerKey:               key,
+		SignerCert:              signer,
+		SCEPEncryptionAlgorithm: encryptionAlgo,
+	})
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "create SCEP request")
+	}
+	respData, err := d.scepRequest(ctx, p.URL, "PKIOperation", msg.Raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := scep.ParsePKIMessage(respData)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "parse SCEP response")
+	}
+	switch resp.PKIStatus {
+	case scep.FAILURE:
+		return nil, nil, errors.Errorf("SCEP request failed: %s", resp.FailInfo)
+	case scep.PENDING:
+		return nil, nil, errors.New("SCEP request is pending, manual approval is not supported")
+	}
+	if err := resp.DecryptPKIEnvelope(signer, key); err != nil {
+		return nil, nil, errors.Wrap(err, "decrypt SCEP response")
+	}
+	return key, resp.CertRepMessage.Certificate, nil
+}
+
+// subject returns the subject of the CSR, with the variables of the profile
+// replaced by the attributes of the device.
+func (d *Device) subject(s [][][]string) pkix.Name {
+	r := strings.NewReplacer(
+		"%ComputerName%", d.DeviceName,
+		"%SerialNumber%", d.SerialNumber,
+		"%HardwareUUID%", d.UDID,
+	)
+	var name pkix.Name
+	for _, rdn := range s {
+		for _, attr := range rdn {
+			if len(attr) != 2 {
+				continue
+			}
+			value := r.Replace(attr[1])
+			switch attr[0] {
+			case "CN":
+				name.CommonName = value
+			case "O":
+				name.Organization = append(name.Organization, value)
+			case "OU":
+				name.OrganizationalUnit = append(name.OrganizationalUnit, value)
+			case "C":
+				name.Country = append(name.Country, value)
+			case "L":
+				name.Locality = append(name.Locality, value)
+			case "ST":
+				name.Province = append(name.Province, value)
+			}
+		}
+	}
+	return name
+}
+
+// selfSign creates the certificate which signs the SCEP request, before the
+// device has a certificate from the CA.
+func selfSign(key *rsa.PrivateKey, csr *x509.CertificateRequest) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, errors.Wrap(err, "generate serial number")
+	}
+	tmpl := x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   "SCEP SIGNER",
+			Organization: csr.Subject.Organization,
+		},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, errors.Wrap(err, "create SCEP signer certificate")
+	}
+	return x509.ParseCertificate(der)
+}
+
+// scepRequest sends a SCEP operation. PKIOperation messages are posted, the
+// other operations don't have a message.
+func (d *Device) scepRequest(ctx context.Context, scepURL, operation string, msg []byte) ([]byte, error) {
+	u, err := url.Parse(scepURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse SCEP URL")
+	}
+	q := u.Query()
+	q.Set("operation", operation)
+	u.RawQuery = q.Encode()
+
+	method, body := http.MethodGet, io.Reader(nil)
+	if msg != nil {
+		method, body = http.MethodPost, bytes.NewReader(msg)
+	}
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if msg != nil {
+		req.Header.Set("Content-Type", "application/x-pki-message")
+	}
+	data, err := d.do(req.WithContext(ctx))
+	return data, errors.Wrapf(err, "SCEP %s", operation)
+}
+
+func (d *Device) do(req *http.Request) ([]byte, error) {
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "read response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{StatusCode: resp.StatusCode}
+	}
+	return body, nil
+}
@@ -0,0 +1,96 @@
+package devicesim
+
+import (
+	"github.com/groob/plist"
+	"github.com/pkg/errors"
+)
+
+// Command is a command sent to a device.
+type Command struct {
+	CommandUUID string
+	RequestType string
+	// Payload is the command plist as sent by the server.
+	Payload []byte
+}
+
+func parseCommand(payload []byte) (Command, error) {
+	var p struct {
+		CommandUUID string
+		Command     struct {
+			RequestType string
+		}
+	}
+	if err := plist.Unmarshal(payload, &p); err != nil {
+		return Command{}, errors.Wrap(err, "unmarshal command")
+	}
+	return Command{
+		CommandUUID: p.CommandUUID,
+		RequestType: p.Command.RequestType,
+		Payload:     payload,
+	}, nil
+}
+
+// Reply is the answer of a device to a command.
+type Reply struct {
+	// Status is Acknowledged, Error or NotNow.
+	Status string `json:"status"`
+	// Fields are added to the response, for example the QueryResponses of
+	// a DeviceInformation command.
+	Fields map[string]interface{} `json:"fields,omitempty"`
+}
+
+// Responder answers the commands sent to a device.
+type Responder interface {
+	Respond(d *Device, cmd Command) Reply
+}
+
+// ResponderFunc is an adapter to use a function as a Responder.
+type ResponderFunc func(d *Device, cmd Command) Reply
+
+// Respond calls f(d, cmd).
+func (f ResponderFunc) Respond(d *Device, cmd Command) Reply {
+	return f(d, cmd)
+}
+
+// DefaultResponder acknowledges every command. It answers DeviceInformation
+// with the attributes of the device, and the list commands with empty lists.
+var DefaultResponder Responder = ResponderFunc(defaultReply)
+
+func defaultReply(d *Device, cmd Command) Reply {
+	ack := Reply{Status: "Acknowledged"}
+	switch cmd.RequestType {
+	case "DeviceInformation":
+		ack.Fields = map[string]interface{}{
+			"QueryResponses": map[string]interface{}{
+				"UDID":         d.UDID,
+				"SerialNumber": d.SerialNumber,
+				"DeviceName":   d.DeviceName,
+				"Model":        d.Model,
+				"ModelName":    d.ModelName,
+				"ProductName":  d.ProductName,
+				"OSVersion":    d.OSVersion,
+				"BuildVersion": d.BuildVersion,
+			},
+		}
+	case "InstalledApplicationList":
+		ack.Fields = map[string]interface{}{"InstalledApplicationList": []interface{}{}}
+	case "ProfileList":
+		ack.Fields = map[string]interface{}{"ProfileList": []interface{}{}}
+	case "CertificateList":
+		ack.Fields = map[string]interface{}{"CertificateList": []interface{}{}}
+	}
+	return ack
+}
+
+// Script answers commands with a scripted reply for each request type, and
+// with DefaultResponder for other request types. Scripts can be read from
+// JSON, for example {"DeviceLock": {"status": "Error"}}.
+type Script map[string]Reply
+
+// Respond returns the scripted reply to cmd.
+func (s Script) Respond(d *Device, cmd Command) Reply {
+	if r, ok := s[cmd.RequestType]; ok {
+		return r
+	}
+	return DefaultResponder.Respond(d, cmd)
+}
@@ -7,7 +7,7 @@ import (
 
 	"github.com/fullsailor/pkcs7"
 	"github.com/go-kit/kit/endpoint"
-	boltdepot "github.com/vishnuvaradaraj/scep/depot/bolt"
+	"github.com/vishnuvaradaraj/scep/depot"
 
 	"github.com/vishnuvaradaraj/micromdm/pkg/crypto"
 	"github.com/vishnuvaradaraj/micromdm/platform/profile"
@@ -59,7 +59,7 @@ type mdmOTAPhase2Phase3Request struct {
 	p7                   *pkcs7.PKCS7
 }
 
-func MakeServerEndpoints(s Service, scepDepot *boltdepot.Depot) Endpoints {
+func MakeServerEndpoints(s Service, scepDepot depot.Depot) Endpoints {
 	return Endpoints{
 		GetEnrollEndpoint:       MakeGetEnrollEndpoint(s),
 		OTAEnrollEndpoint:       MakeOTAEnrollEndpoint(s),
@@ -90,7 +90,7 @@ func MakeOTAEnrollEndpoint(s Service) endpoint.Endpoint {
 	}
 }
 
-func MakeOTAPhase2Phase3Endpoint(s Service, scepDepot *boltdepot.Depot) endpoint.Endpoint {
+func MakeOTAPhase2Phase3Endpoint(s Service, scepDepot depot.Depot) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		req := request.(mdmOTAPhase2Phase3Request)
 
@@ -4,10 +4,11 @@ import (
 	"bytes"
 	"crypto/x509"
 	"io/ioutil"
-	"log"
 	"strings"
 	"sync"
 
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
 	"github.com/groob/plist"
 	"github.com/pkg/errors"
 	"golang.org/x/net/context"
@@ -29,7 +30,7 @@ type Service interface {
 	OTAPhase3(ctx context.Context) (profile.Mobileconfig, error)
 }
 
-func NewService(topic TopicProvider, sub pubsub.Subscriber, scepURL, scepChallenge, url, tlsCertPath, scepSubject string, profileDB profile.Store) (Service, error) {
+func NewService(topic TopicProvider, sub pubsub.Subscriber, scepURL, scepChallenge, url, tlsCertPath, scepSubject string, profileDB profile.Store, logger log.Logger) (Service, error) {
 	var tlsCert []byte
 	var err error
 
@@ -68,6 +69,7 @@ func NewService(topic TopicProvider, sub pubsub.Subscriber, scepURL, scepChallen
 		ProfileDB:     profileDB,
 		Topic:         pushTopic,
 		topicProvier:  topic,
+		logger:        logger,
 	}
 
 	if err := updateTopic(svc, sub); err != nil {
@@ -83,23 +85,21 @@ func updateTopic(svc *service, sub pubsub.Subscriber) error {
 		return errors.Wrap(err, "update enrollment service")
 	}
 	go func() {
-		for {
-			select {
-			case <-configEvents:
-				topic, err := svc.topicProvier.PushTopic()
-				if err != nil {
-					log.Printf("enroll: get push topic %s\n", topic)
-				}
-				svc.mu.Lock()
-				svc.Topic = topic
-				svc.mu.Unlock()
-
-				// terminate the loop here because the topic should never change
-				goto exit
+		// follow every config update, a push certificate with a different
+		// topic may be uploaded with force.
+		for range configEvents {
+			topic, err := svc.topicProvier.PushTopic()
+			if err != nil {
+				level.Info(svc.logger).Log("msg", "get push topic", "err", err)
+				continue
+			}
+			svc.mu.Lock()
+			if svc.Topic != "" && svc.Topic != topic {
+				level.Info(svc.logger).Log("msg", "push topic changed", "from", svc.Topic, "to", topic)
 			}
+			svc.Topic = topic
+			svc.mu.Unlock()
 		}
-	exit:
-		return
 	}()
 	return nil
 }
@@ -113,6 +113,7 @@ type service struct {
 	ProfileDB     profile.Store
 
 	topicProvier TopicProvider
+	logger       log.Logger
 
 	mu    sync.RWMutex
 	Topic string // APNS Topic for MDM notifications
@@ -102,6 +102,43 @@ func TestUnmarshalCommandPayload(t *testing.T) {
 	}
 }
 
+func TestUnmarshalCommandPreviousJSONKeys(t *testing.T) {
+	tests := []struct {
+		data string
+		want Command
+	}{
+		{
+			`{"request_type": "InviteToProgram", "ProgramID": "program-1"}`,
+			Command{RequestType: "InviteToProgram", InviteToProgram: &InviteToProgram{ProgramID: "program-1"}},
+		},
+		{
+			`{"request_type": "InviteToProgram", "program_id": "program-2"}`,
+			Command{RequestType: "InviteToProgram", InviteToProgram: &InviteToProgram{ProgramID: "program-2"}},
+		},
+		{
+			`{"request_type": "ActiveNSExtensions", "FilterExtensionPoints": ["com.apple.share-services"]}`,
+			Command{RequestType: "ActiveNSExtensions", ActiveNSExtensions: &ActiveNSExtensions{
+				FilterExtensionPoints: []string{"com.apple.share-services"},
+			}},
+		},
+		{
+			`{"request_type": "ActiveNSExtensions", "filter_extensions_points": ["com.apple.ui-services"]}`,
+			Command{RequestType: "ActiveNSExtensions", ActiveNSExtensions: &ActiveNSExtensions{
+				FilterExtensionPoints: []string{"com.apple.ui-services"},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		var have Command
+		if err := json.Unmarshal([]byte(tt.data), &have); err != nil {
+			t.Fatalf("unmarshal %s: %s", tt.data, err)
+		}
+		if !reflect.DeepEqual(have, tt.want) {
+			t.Errorf("%s: have %+v, want %+v", tt.data, have, tt.want)
+		}
+	}
+}
+
 func mustLoadFile(t *testing.T, filename string) []byte {
 	t.Helper()
 	data, err := ioutil.ReadFile(filepath.Join("testdata", filename))
@@ -298,3 +298,37 @@ func (c *Command) UnmarshalJSON(data []byte) error {
 		return fmt.Errorf("mdm: unknown RequestType: %s", c.RequestType)
 	}
 }
+
+// UnmarshalJSON accepts the ProgramID key which the command was decoded from
+// before it had a JSON tag, as well as program_id.
+func (c *InviteToProgram) UnmarshalJSON(data []byte) error {
+	type inviteToProgram InviteToProgram
+	var payload = struct {
+		*inviteToProgram
+		ProgramID string `json:"ProgramID"`
+	}{inviteToProgram: (*inviteToProgram)(c)}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return err
+	}
+	if c.ProgramID == "" {
+		c.ProgramID = payload.ProgramID
+	}
+	return nil
+}
+
+// UnmarshalJSON accepts the FilterExtensionPoints key which the command was
+// decoded from before it had a JSON tag, as well as filter_extensions_points.
+func (c *ActiveNSExtensions) UnmarshalJSON(data []byte) error {
+	type activeNSExtensions ActiveNSExtensions
+	var payload = struct {
+		*activeNSExtensions
+		FilterExtensionPoints []string `json:"FilterExtensionPoints"`
+	}{activeNSExtensions: (*activeNSExtensions)(c)}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return err
+	}
+	if c.FilterExtensionPoints == nil {
+		c.FilterExtensionPoints = payload.FilterExtensionPoints
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package httputil
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -102,6 +103,22 @@ func EncodeRequestWithToken(token string, next httptransport.EncodeRequestFunc)
 	}
 }
 
+// BasicAuth protects a plain http.Handler with the same credentials the API
+// endpoints use.
+func BasicAuth(user, password, realm string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, ok := r.BasicAuth()
+		if !ok ||
+			subtle.ConstantTimeCompare([]byte(u), []byte(user)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(p), []byte(password)) != 1 {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", realm))
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func CopyURL(base *url.URL, path string) *url.URL {
 	next := *base
 	next.Path = path
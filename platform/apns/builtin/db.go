@@ -1,55 +1,124 @@
 package builtin
 
 import (
-	"fmt"
 	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	"cloud.google.com/go/firestore"
 	"github.com/boltdb/bolt"
 	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
-	"cloud.google.com/go/firestore"
 	"github.com/vishnuvaradaraj/micromdm/platform/apns"
 	"github.com/vishnuvaradaraj/micromdm/platform/pubsub"
 )
 
-const PushBucket = "mdm.PushInfo"
+const (
+	PushBucket    = "mdm.PushInfo"
+	PushLogBucket = "mdm.PushLog"
+)
 
+// FireDB stores PushInfo in Google Cloud Firestore, keyed by UDID.
 type FireDB struct {
 	*firestore.Client
 }
 
+type pushInfoDoc struct {
+	Data []byte `firestore:"data"`
+}
+
 func NewFireDB(db *firestore.Client) (*FireDB, error) {
 	datastore := &FireDB{Client: db}
 	return datastore, nil
 }
 
 func (db *FireDB) PushInfo(udid string) (*apns.PushInfo, error) {
-	var info apns.PushInfo
-
-	ctx := context.Background()
-
-	doc, err := db.Collection(PushBucket).Doc(udid).Get(ctx)
-	if err != nil {
-		return nil, &notFound{"Pushinfo","Not found"}
+	snap, err := db.Collection(PushBucket).Doc(udid).Get(context.Background())
+	if status.Code(err) == codes.NotFound {
+		return nil, &notFound{"PushInfo", fmt.Sprintf("udid %s", udid)}
 	}
-
-	err = doc.DataTo(&info)
 	if err != nil {
+		return nil, errors.Wrap(err, "get PushInfo from firestore")
+	}
+	var doc pushInfoDoc
+	if err := snap.DataTo(&doc); err != nil {
+		return nil, errors.Wrap(err, "decode PushInfo document")
+	}
+	var info apns.PushInfo
+	if err := apns.UnmarshalPushInfo(doc.Data, &info); err != nil {
 		return nil, err
 	}
 	return &info, nil
 }
 
 func (db *FireDB) Save(info *apns.PushInfo) error {
+	pushproto, err := apns.MarshalPushInfo(info)
+	if err != nil {
+		return errors.Wrap(err, "marshalling PushInfo")
+	}
+	doc := pushInfoDoc{Data: pushproto}
+	_, err = db.Collection(PushBucket).Doc(info.UDID).Set(context.Background(), doc)
+	return errors.Wrap(err, "put PushInfo to firestore")
+}
+
+type pushLogDoc struct {
+	CreatedAt int64  `firestore:"created_at"`
+	Data      []byte `firestore:"data"`
+}
 
+func (db *FireDB) DeletePushInfo(udid string) error {
+	_, err := db.Collection(PushBucket).Doc(udid).Delete(context.Background())
+	return errors.Wrap(err, "delete PushInfo from firestore")
+}
+
+func (db *FireDB) SavePushLog(entry *apns.PushLogEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return errors.Wrap(err, "marshal push log entry")
+	}
 	ctx := context.Background()
+	entries := db.Collection(PushLogBucket).Doc(entry.UDID).Collection("entries")
+	doc := pushLogDoc{CreatedAt: entry.CreatedAt.UnixNano(), Data: data}
+	if _, _, err := entries.Add(ctx, doc); err != nil {
+		return errors.Wrap(err, "add push log entry to firestore")
+	}
 
-	_, err := db.Collection(PushBucket).Doc(info.UDID).Set(ctx, info)
+	old, err := entries.OrderBy("created_at", firestore.Desc).Offset(apns.PushLogSize).Documents(ctx).GetAll()
 	if err != nil {
-		return err
+		return errors.Wrap(err, "get old push log entries from firestore")
+	}
+	for _, snap := range old {
+		if _, err := snap.Ref.Delete(ctx); err != nil {
+			return errors.Wrap(err, "delete old push log entry from firestore")
+		}
 	}
 	return nil
 }
 
+func (db *FireDB) PushLog(udid string) ([]apns.PushLogEntry, error) {
+	docs, err := db.Collection(PushLogBucket).Doc(udid).Collection("entries").
+		OrderBy("created_at", firestore.Desc).Documents(context.Background()).GetAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "get push log from firestore")
+	}
+	entries := []apns.PushLogEntry{}
+	for _, snap := range docs {
+		var doc pushLogDoc
+		if err := snap.DataTo(&doc); err != nil {
+			return nil, errors.Wrap(err, "decode push log document")
+		}
+		var entry apns.PushLogEntry
+		if err := json.Unmarshal(doc.Data, &entry); err != nil {
+			return nil, errors.Wrap(err, "unmarshal push log entry")
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
 ////////////////////////////////////////////////////////////
 
 type DB struct {
@@ -58,11 +127,15 @@ type DB struct {
 
 func NewDB(db *bolt.DB, sub pubsub.Subscriber) (*DB, error) {
 	err := db.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists([]byte(PushBucket))
-		return err
+		for _, name := range []string{PushBucket, PushLogBucket} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return errors.Wrapf(err, "creating %s bucket", name)
+			}
+		}
+		return nil
 	})
 	if err != nil {
-		return nil, errors.Wrapf(err, "creating %s bucket", PushBucket)
+		return nil, err
 	}
 	datastore := &DB{
 		DB: db,
@@ -79,6 +152,10 @@ func (e *notFound) Error() string {
 	return fmt.Sprintf("not found: %s %s", e.ResourceType, e.Message)
 }
 
+func (e *notFound) NotFound() bool {
+	return true
+}
+
 func (db *DB) PushInfo(udid string) (*apns.PushInfo, error) {
 	var info apns.PushInfo
 	err := db.View(func(tx *bolt.Tx) error {
@@ -114,3 +191,70 @@ func (db *DB) Save(info *apns.PushInfo) error {
 	}
 	return tx.Commit()
 }
+
+func (db *DB) DeletePushInfo(udid string) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket([]byte(PushBucket)).Delete([]byte(udid))
+		return errors.Wrap(err, "delete PushInfo from boltdb")
+	})
+}
+
+// SavePushLog stores the entry in a bucket per UDID, keyed by the big endian
+// creation time so the keys sort by age.
+func (db *DB) SavePushLog(entry *apns.PushLogEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return errors.Wrap(err, "marshal push log entry")
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		bkt, err := tx.Bucket([]byte(PushLogBucket)).CreateBucketIfNotExists([]byte(entry.UDID))
+		if err != nil {
+			return errors.Wrap(err, "create push log bucket")
+		}
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, uint64(entry.CreatedAt.UnixNano()))
+		for bkt.Get(key) != nil {
+			// entries created within the same nanosecond.
+			binary.BigEndian.PutUint64(key, binary.BigEndian.Uint64(key)+1)
+		}
+		if err := bkt.Put(key, data); err != nil {
+			return errors.Wrap(err, "put push log entry to boltdb")
+		}
+
+		// walk back from the newest entry to find those beyond the limit.
+		var old [][]byte
+		c := bkt.Cursor()
+		n := 0
+		for k, _ := c.Last(); k != nil; k, _ = c.Prev() {
+			if n++; n > apns.PushLogSize {
+				old = append(old, append([]byte(nil), k...))
+			}
+		}
+		for _, k := range old {
+			if err := bkt.Delete(k); err != nil {
+				return errors.Wrap(err, "delete old push log entry")
+			}
+		}
+		return nil
+	})
+}
+
+func (db *DB) PushLog(udid string) ([]apns.PushLogEntry, error) {
+	entries := []apns.PushLogEntry{}
+	err := db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(PushLogBucket)).Bucket([]byte(udid))
+		if bkt == nil {
+			return nil
+		}
+		c := bkt.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var entry apns.PushLogEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return errors.Wrap(err, "unmarshal push log entry")
+			}
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	return entries, err
+}
@@ -0,0 +1,99 @@
+package builtin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/apns"
+	"github.com/vishnuvaradaraj/micromdm/platform/storage/sqldb"
+)
+
+// SQLDB stores PushInfo in a SQL database, keyed by UDID.
+type SQLDB struct {
+	*sqldb.DB
+}
+
+func NewSQLDB(db *sqldb.DB) (*SQLDB, error) {
+	datastore := &SQLDB{DB: db}
+	return datastore, nil
+}
+
+func (db *SQLDB) PushInfo(udid string) (*apns.PushInfo, error) {
+	var data []byte
+	err := db.QueryRow(`SELECT data FROM push_info WHERE udid = ?`, udid).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, &notFound{"PushInfo", fmt.Sprintf("udid %s", udid)}
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "get PushInfo from sql")
+	}
+	var info apns.PushInfo
+	if err := apns.UnmarshalPushInfo(data, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func (db *SQLDB) Save(info *apns.PushInfo) error {
+	pushproto, err := apns.MarshalPushInfo(info)
+	if err != nil {
+		return errors.Wrap(err, "marshalling PushInfo")
+	}
+	_, err = db.Exec(db.Upsert("push_info", "udid", "udid", "data"), info.UDID, pushproto)
+	return errors.Wrap(err, "put PushInfo to sql")
+}
+
+func (db *SQLDB) DeletePushInfo(udid string) error {
+	_, err := db.Exec(`DELETE FROM push_info WHERE udid = ?`, udid)
+	return errors.Wrap(err, "delete PushInfo from sql")
+}
+
+func (db *SQLDB) SavePushLog(entry *apns.PushLogEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return errors.Wrap(err, "marshal push log entry")
+	}
+	_, err = db.Exec(`INSERT INTO push_log (id, udid, created_at, data) VALUES (?, ?, ?, ?)`,
+		uuid.NewV4().String(), entry.UDID, entry.CreatedAt.UnixNano(), data)
+	if err != nil {
+		return errors.Wrap(err, "put push log entry to sql")
+	}
+
+	// find the creation time of the oldest entry to keep, and delete any older.
+	var cutoff int64
+	err = db.QueryRow(`SELECT created_at FROM push_log WHERE udid = ? ORDER BY created_at DESC LIMIT 1 OFFSET ?`,
+		entry.UDID, apns.PushLogSize-1).Scan(&cutoff)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "get push log cutoff from sql")
+	}
+	_, err = db.Exec(`DELETE FROM push_log WHERE udid = ? AND created_at < ?`, entry.UDID, cutoff)
+	return errors.Wrap(err, "delete old push log entries from sql")
+}
+
+func (db *SQLDB) PushLog(udid string) ([]apns.PushLogEntry, error) {
+	rows, err := db.Query(`SELECT data FROM push_log WHERE udid = ? ORDER BY created_at DESC`, udid)
+	if err != nil {
+		return nil, errors.Wrap(err, "get push log from sql")
+	}
+	defer rows.Close()
+	entries := []apns.PushLogEntry{}
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, errors.Wrap(err, "scan push log entry")
+		}
+		var entry apns.PushLogEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return nil, errors.Wrap(err, "unmarshal push log entry")
+		}
+		entries = append(entries, entry)
+	}
+	return entries, errors.Wrap(rows.Err(), "list push log from sql")
+}
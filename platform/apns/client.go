@@ -0,0 +1,199 @@
+package apns
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/http2"
+)
+
+// APNs provider API hosts.
+const (
+	Production = "https://api.push.apple.com"
+	Sandbox    = "https://api.sandbox.push.apple.com"
+)
+
+// Notification is a push notification for a single device token.
+type Notification struct {
+	// ID is the apns-id of the notification. APNs assigns one if empty.
+	ID          string
+	DeviceToken string
+	// Topic is required with token based authentication.
+	Topic   string
+	Payload []byte
+}
+
+// Client sends notifications to the APNs provider API over HTTP/2.
+type Client struct {
+	// Host is Production or Sandbox.
+	Host       string
+	HTTPClient *http.Client
+
+	// Token is used to authenticate if set, otherwise the TLS client
+	// certificate of HTTPClient is.
+	Token *Token
+}
+
+// NewClient creates a Client which authenticates with a push certificate.
+func NewClient(cert tls.Certificate, host string) (*Client, error) {
+	client, err := newClient(&cert)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{Host: host, HTTPClient: client}, nil
+}
+
+// NewTokenClient creates a Client which authenticates with a provider token.
+func NewTokenClient(token *Token, host string) (*Client, error) {
+	client, err := newClient(nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{Host: host, HTTPClient: client, Token: token}, nil
+}
+
+func newClient(cert *tls.Certificate) (*http.Client, error) {
+	config := &tls.Config{}
+	if cert != nil {
+		config.Certificates = []tls.Certificate{*cert}
+	}
+	transport := &http.Transport{
+		TLSClientConfig: config,
+		IdleConnTimeout: 90 * time.Second,
+	}
+
+	if err := http2.ConfigureTransport(transport); err != nil {
+		return nil, err
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   20 * time.Second,
+	}, nil
+}
+
+// Push sends a notification and returns its apns-id. Errors returned by APNs
+// are of type *Error.
+func (c *Client) Push(ctx context.Context, n Notification) (string, error) {
+	id, err := c.push(ctx, n)
+	if IsReason(err, ReasonExpiredProviderToken) && c.Token != nil {
+		// the token is refreshed before it expires, but APNs may disagree.
+		c.Token.Expire()
+		id, err = c.push(ctx, n)
+	}
+	return id, err
+}
+
+func (c *Client) push(ctx context.Context, n Notification) (string, error) {
+	req, err := http.NewRequest("POST", c.Host+"/3/device/"+n.DeviceToken, bytes.NewReader(n.Payload))
+	if err != nil {
+		return "", errors.Wrap(err, "create push request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	if n.ID != "" {
+		req.Header.Set("apns-id", n.ID)
+	}
+	if n.Topic != "" {
+		req.Header.Set("apns-topic", n.Topic)
+	}
+	if c.Token != nil {
+		bearer, err := c.Token.Bearer()
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("authorization", "bearer "+bearer)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		if isTLSAlert(err) {
+			return "", errors.Wrap(err, "push error: possibly expired or invalid APNs certificate")
+		}
+		return "", errors.Wrap(err, "send push request")
+	}
+	defer resp.Body.Close()
+
+	id := resp.Header.Get("apns-id")
+	if resp.StatusCode == http.StatusOK {
+		return id, nil
+	}
+
+	var body struct {
+		Reason    Reason `json:"reason"`
+		Timestamp int64  `json:"timestamp"`
+	}
+	// the body is empty for some errors, the status is enough in that case.
+	_ = json.NewDecoder(resp.Body).Decode(&body)
+	apnsErr := &Error{Status: resp.StatusCode, Reason: body.Reason, ID: id}
+	if body.Timestamp != 0 {
+		apnsErr.Timestamp = time.Unix(0, body.Timestamp*int64(time.Millisecond))
+	}
+	return id, apnsErr
+}
+
+// isTLSAlert reports whether the APNs server rejected the TLS handshake, which
+// is how an expired or revoked push certificate shows up.
+func isTLSAlert(err error) bool {
+	for err != nil {
+		if opErr, ok := err.(*net.OpError); ok && opErr.Op == "remote error" {
+			return true
+		}
+		u, ok := err.(interface{ Unwrap() error })
+		if !ok {
+			return false
+		}
+		err = u.Unwrap()
+	}
+	return false
+}
+
+// Reason is the reason APNs gives for rejecting a notification.
+type Reason string
+
+// Reasons which are handled by the push service. See the APNs provider API
+// documentation for the full list.
+const (
+	ReasonBadDeviceToken         Reason = "BadDeviceToken"
+	ReasonDeviceTokenNotForTopic Reason = "DeviceTokenNotForTopic"
+	ReasonUnregistered           Reason = "Unregistered"
+	ReasonBadCertificate         Reason = "BadCertificate"
+	ReasonBadTopic               Reason = "BadTopic"
+	ReasonExpiredProviderToken   Reason = "ExpiredProviderToken"
+	ReasonInvalidProviderToken   Reason = "InvalidProviderToken"
+	ReasonTooManyRequests        Reason = "TooManyRequests"
+	ReasonInternalServerError    Reason = "InternalServerError"
+	ReasonServiceUnavailable     Reason = "ServiceUnavailable"
+)
+
+// Error is a notification rejected by APNs.
+type Error struct {
+	Status int
+	Reason Reason
+	// ID is the apns-id of the notification.
+	ID string
+	// Timestamp is the last time APNs confirmed the token was no longer
+	// valid. It is only set for ReasonUnregistered.
+	Timestamp time.Time
+}
+
+func (e *Error) Error() string {
+	reason := string(e.Reason)
+	if reason == "" {
+		reason = http.StatusText(e.Status)
+	}
+	return "apns: " + reason + " (status " + strconv.Itoa(e.Status) + ")"
+}
+
+// IsReason reports whether err is an APNs error with the reason r.
+func IsReason(err error, r Reason) bool {
+	e, ok := errors.Cause(err).(*Error)
+	return ok && e.Reason == r
+}
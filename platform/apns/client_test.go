@@ -0,0 +1,211 @@
+package apns
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/pubsub/inmem"
+)
+
+const deviceToken = "c2732227a1d8021cfaf781d71fb2f908c61f5861079a00954a5453f1d0281433"
+
+// newFakeAPNs starts an HTTP/2 server which handles pushes like APNs, and a
+// client for it.
+func newFakeAPNs(t *testing.T, handler http.HandlerFunc) *Client {
+	server := httptest.NewUnstartedServer(handler)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return &Client{Host: server.URL, HTTPClient: server.Client()}
+}
+
+func reject(w http.ResponseWriter, status int, reason Reason, timestamp int64) {
+	w.Header().Set("apns-id", "rejected-id")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"reason": reason, "timestamp": timestamp})
+}
+
+func TestClientPush(t *testing.T) {
+	client := newFakeAPNs(t, func(w http.ResponseWriter, r *http.Request) {
+		if have, want := r.ProtoMajor, 2; have != want {
+			t.Errorf("have HTTP/%d, want HTTP/%d", have, want)
+		}
+		if have, want := r.URL.Path, "/3/device/"+deviceToken; have != want {
+			t.Errorf("have path %s, want %s", have, want)
+		}
+		if have, want := r.Header.Get("apns-topic"), "com.example.mdm"; have != want {
+			t.Errorf("have topic %s, want %s", have, want)
+		}
+		w.Header().Set("apns-id", r.Header.Get("apns-id"))
+	})
+
+	id, err := client.Push(context.Background(), Notification{
+		ID:          "push-id",
+		DeviceToken: deviceToken,
+		Topic:       "com.example.mdm",
+		Payload:     []byte(`{"mdm":"magic"}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := id, "push-id"; have != want {
+		t.Errorf("have apns-id %s, want %s", have, want)
+	}
+}
+
+func TestClientPushError(t *testing.T) {
+	tests := []struct {
+		status int
+		reason Reason
+	}{
+		{http.StatusBadRequest, ReasonBadDeviceToken},
+		{http.StatusGone, ReasonUnregistered},
+		{http.StatusForbidden, ReasonExpiredProviderToken},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.reason), func(t *testing.T) {
+			client := newFakeAPNs(t, func(w http.ResponseWriter, r *http.Request) {
+				reject(w, tt.status, tt.reason, 1500000000000)
+			})
+			_, err := client.Push(context.Background(), Notification{DeviceToken: deviceToken})
+			if !IsReason(err, tt.reason) {
+				t.Fatalf("have error %v, want reason %s", err, tt.reason)
+			}
+			apnsErr := err.(*Error)
+			if have, want := apnsErr.Status, tt.status; have != want {
+				t.Errorf("have status %d, want %d", have, want)
+			}
+			if have, want := apnsErr.Timestamp, time.Unix(1500000000, 0); !have.Equal(want) {
+				t.Errorf("have timestamp %s, want %s", have, want)
+			}
+		})
+	}
+}
+
+func TestClientPushExpiredToken(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mu      sync.Mutex
+		bearers []string
+	)
+	client := newFakeAPNs(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		bearers = append(bearers, r.Header.Get("authorization"))
+		if len(bearers) == 1 {
+			reject(w, http.StatusForbidden, ReasonExpiredProviderToken, 0)
+		}
+	})
+	client.Token = &Token{KeyID: "KEYID", TeamID: "TEAMID", Key: key}
+
+	if _, err := client.Push(context.Background(), Notification{DeviceToken: deviceToken}); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(bearers), 2; have != want {
+		t.Fatalf("have %d requests, want %d", have, want)
+	}
+	if !strings.HasPrefix(bearers[0], "bearer ") {
+		t.Errorf("have authorization %q, want a bearer token", bearers[0])
+	}
+	if bearers[0] == bearers[1] {
+		t.Error("have the same token after ExpiredProviderToken, want a new one")
+	}
+}
+
+type memStore struct {
+	mu    sync.Mutex
+	infos map[string]PushInfo
+	log   []PushLogEntry
+}
+
+func (s *memStore) PushInfo(udid string) (*PushInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info := s.infos[udid]
+	return &info, nil
+}
+
+func (s *memStore) Save(info *PushInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.infos[info.UDID] = *info
+	return nil
+}
+
+func (s *memStore) SavePushLog(entry *PushLogEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.log = append([]PushLogEntry{*entry}, s.log...)
+	return nil
+}
+
+func (s *memStore) PushLog(udid string) ([]PushLogEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.log, nil
+}
+
+func TestPushUnregistered(t *testing.T) {
+	client := newFakeAPNs(t, func(w http.ResponseWriter, r *http.Request) {
+		reject(w, http.StatusGone, ReasonUnregistered, 1500000000000)
+	})
+	store := &memStore{infos: map[string]PushInfo{
+		"udid-1": {UDID: "udid-1", Token: deviceToken, PushMagic: "magic", MDMTopic: "com.example.mdm"},
+	}}
+	ps := inmem.NewPubSub()
+	events, err := ps.Subscribe(context.Background(), "test", UnregisteredTopic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc, err := New(context.Background(), store, nil, ps, WithClient(client))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := svc.Push(context.Background(), "udid-1"); !IsReason(err, ReasonUnregistered) {
+		t.Fatalf("have error %v, want reason %s", err, ReasonUnregistered)
+	}
+	if !store.infos["udid-1"].Unreachable {
+		t.Error("have reachable PushInfo, want unreachable")
+	}
+	select {
+	case ev := <-events:
+		if have, want := string(ev.Message), "udid-1"; have != want {
+			t.Errorf("have unregistered udid %s, want %s", have, want)
+		}
+	case <-time.After(time.Second):
+		t.Error("no event published to UnregisteredTopic")
+	}
+
+	entries, err := svc.PushHistory(context.Background(), "udid-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(entries), 1; have != want {
+		t.Fatalf("have %d push log entries, want %d", have, want)
+	}
+	if have, want := entries[0].Reason, ReasonUnregistered; have != want {
+		t.Errorf("have push log reason %s, want %s", have, want)
+	}
+	if have, want := entries[0].Status, http.StatusGone; have != want {
+		t.Errorf("have push log status %d, want %d", have, want)
+	}
+
+	// the token is not pushed to again until the device sends a TokenUpdate.
+	if _, err := svc.Push(context.Background(), "udid-1"); err == nil {
+		t.Error("have push to unreachable token succeed, want error")
+	}
+}
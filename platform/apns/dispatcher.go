@@ -0,0 +1,247 @@
+package apns
+
+import (
+	"container/heap"
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+	"github.com/pkg/errors"
+)
+
+// Defaults for the push dispatcher.
+const (
+	DefaultPushWindow  = time.Second
+	DefaultPushWorkers = 16
+	DefaultPushRate    = 500
+	// DefaultPushQueueSize is how many pushes may wait to be sent.
+	DefaultPushQueueSize = 100000
+
+	pushRetries = 3
+	pushBackoff = 2 * time.Second
+)
+
+// Metrics are recorded by the push dispatcher.
+type Metrics struct {
+	// Latency is the duration of each APNs request, in seconds.
+	Latency metrics.Histogram
+
+	Succeeded metrics.Counter
+	Failed    metrics.Counter
+	// Retried counts pushes which failed with a transient error and were
+	// queued again.
+	Retried metrics.Counter
+	// Coalesced counts pushes which were not sent because a push to the same
+	// UDID was already waiting.
+	Coalesced metrics.Counter
+	// Dropped counts pushes which were not sent because the queue was full.
+	Dropped metrics.Counter
+}
+
+func discardMetrics() Metrics {
+	return Metrics{
+		Latency:   discard.NewHistogram(),
+		Succeeded: discard.NewCounter(),
+		Failed:    discard.NewCounter(),
+		Retried:   discard.NewCounter(),
+		Coalesced: discard.NewCounter(),
+		Dropped:   discard.NewCounter(),
+	}
+}
+
+type pushJob struct {
+	udid    string
+	attempt int
+	due     time.Time
+}
+
+// pushQueue orders the waiting pushes by when they are due.
+type pushQueue []*pushJob
+
+func (q pushQueue) Len() int            { return len(q) }
+func (q pushQueue) Less(i, j int) bool  { return q[i].due.Before(q[j].due) }
+func (q pushQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *pushQueue) Push(x interface{}) { *q = append(*q, x.(*pushJob)) }
+func (q *pushQueue) Pop() interface{} {
+	old := *q
+	job := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return job
+}
+
+// dispatcher sends the pushes for queued commands. A push to a UDID is held
+// for a short window, so that commands queued together wake the device once,
+// and is then sent by a bounded pool of workers at a limited rate. Pushes
+// which fail with a transient error are retried with backoff. At most size
+// pushes wait at a time, one per UDID. Pushes beyond that are dropped, and the
+// nudger wakes those devices later if they still have commands.
+type dispatcher struct {
+	push    func(ctx context.Context, udid string) (string, error)
+	window  time.Duration
+	workers int
+	rate    int
+	size    int
+	backoff time.Duration
+	metrics Metrics
+	logger  log.Logger
+
+	// wake interrupts the wait for the next due push when one is added.
+	wake chan struct{}
+
+	mu      sync.Mutex
+	pending map[string]*pushJob
+	queue   pushQueue
+}
+
+func newDispatcher(push func(context.Context, string) (string, error), window time.Duration, workers, rate int, m Metrics, logger log.Logger) *dispatcher {
+	return &dispatcher{
+		push:    push,
+		window:  window,
+		workers: workers,
+		rate:    rate,
+		size:    DefaultPushQueueSize,
+		backoff: pushBackoff,
+		metrics: m,
+		logger:  logger,
+		wake:    make(chan struct{}, 1),
+		pending: make(map[string]*pushJob),
+	}
+}
+
+// Enqueue schedules a push to the UDID, unless one is already waiting.
+func (d *dispatcher) Enqueue(udid string) {
+	d.schedule(pushJob{udid: udid, due: time.Now().Add(d.window)})
+}
+
+// schedule adds the job to the queue, unless a push to the same UDID is
+// already waiting or the queue is full.
+func (d *dispatcher) schedule(job pushJob) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.pending[job.udid]; ok {
+		d.metrics.Coalesced.Add(1)
+		return
+	}
+	if len(d.pending) >= d.size {
+		d.metrics.Dropped.Add(1)
+		return
+	}
+	d.pending[job.udid] = &job
+	heap.Push(&d.queue, &job)
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next removes and returns the first push which is due, or else how long to
+// wait for one.
+func (d *dispatcher) next(now time.Time) (pushJob, time.Duration, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.queue) == 0 {
+		return pushJob{}, time.Hour, false
+	}
+	if wait := d.queue[0].due.Sub(now); wait > 0 {
+		return pushJob{}, wait, false
+	}
+	job := heap.Pop(&d.queue).(*pushJob)
+	delete(d.pending, job.udid)
+	return *job, 0, true
+}
+
+// Run starts the workers and hands them the pushes as they are due, until
+// ctx is done.
+func (d *dispatcher) Run(ctx context.Context) {
+	// pushes are not rate limited if rate is zero.
+	var limit <-chan time.Time
+	if d.rate > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(d.rate))
+		defer ticker.Stop()
+		limit = ticker.C
+	}
+
+	jobs := make(chan pushJob)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for i := 0; i < d.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-jobs:
+					if limit != nil {
+						select {
+						case <-ctx.Done():
+							return
+						case <-limit:
+						}
+					}
+					d.send(ctx, job)
+				}
+			}
+		}()
+	}
+
+	for {
+		job, wait, ok := d.next(time.Now())
+		if ok {
+			select {
+			case <-ctx.Done():
+				return
+			case jobs <- job:
+			}
+			continue
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-d.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+func (d *dispatcher) send(ctx context.Context, job pushJob) {
+	begin := time.Now()
+	_, err := d.push(ctx, job.udid)
+	d.metrics.Latency.Observe(time.Since(begin).Seconds())
+	if err == nil {
+		d.metrics.Succeeded.Add(1)
+		return
+	}
+
+	if isTransient(err) && job.attempt < pushRetries && ctx.Err() == nil {
+		d.metrics.Retried.Add(1)
+		job.attempt++
+		job.due = time.Now().Add(d.backoff << uint(job.attempt-1))
+		d.schedule(job)
+		return
+	}
+	d.metrics.Failed.Add(1)
+	level.Info(d.logger).Log("msg", "push", "udid", job.udid, "err", err)
+}
+
+// isTransient reports whether a push may succeed if it is sent again.
+func isTransient(err error) bool {
+	switch e := errors.Cause(err).(type) {
+	case *Error:
+		return e.Status == http.StatusTooManyRequests || e.Status >= http.StatusInternalServerError
+	case net.Error:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,220 @@
+package apns
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics/generic"
+)
+
+type fakePusher struct {
+	mu       sync.Mutex
+	calls    map[string]int
+	inflight int
+	max      int
+	fail     func(udid string, call int) error
+	done     chan string
+}
+
+func (p *fakePusher) Push(ctx context.Context, udid string) (string, error) {
+	p.mu.Lock()
+	p.calls[udid]++
+	call := p.calls[udid]
+	p.inflight++
+	if p.inflight > p.max {
+		p.max = p.inflight
+	}
+	p.mu.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	p.mu.Lock()
+	p.inflight--
+	p.mu.Unlock()
+
+	var err error
+	if p.fail != nil {
+		err = p.fail(udid, call)
+	}
+	p.done <- udid
+	return "id", err
+}
+
+func testMetrics() Metrics {
+	return Metrics{
+		Latency:   generic.NewHistogram("latency", 10),
+		Succeeded: generic.NewCounter("succeeded"),
+		Failed:    generic.NewCounter("failed"),
+		Retried:   generic.NewCounter("retried"),
+		Coalesced: generic.NewCounter("coalesced"),
+		Dropped:   generic.NewCounter("dropped"),
+	}
+}
+
+func waitPushes(t *testing.T, done chan string, n int) {
+	for i := 0; i < n; i++ {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("have %d pushes, want %d", i, n)
+		}
+	}
+}
+
+func TestDispatcherCoalesce(t *testing.T) {
+	p := &fakePusher{calls: make(map[string]int), done: make(chan string, 100)}
+	m := testMetrics()
+	d := newDispatcher(p.Push, 50*time.Millisecond, 4, 0, m, log.NewNopLogger())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Run(ctx)
+
+	for i := 0; i < 20; i++ {
+		d.Enqueue("udid-1")
+	}
+	d.Enqueue("udid-2")
+	waitPushes(t, p.done, 2)
+
+	if have, want := p.calls["udid-1"], 1; have != want {
+		t.Errorf("have %d pushes to udid-1, want %d", have, want)
+	}
+	if have, want := m.Coalesced.(*generic.Counter).Value(), 19.0; have != want {
+		t.Errorf("have %v coalesced, want %v", have, want)
+	}
+
+	// a push after the window is sent again.
+	d.Enqueue("udid-1")
+	waitPushes(t, p.done, 1)
+	if have, want := p.calls["udid-1"], 2; have != want {
+		t.Errorf("have %d pushes to udid-1, want %d", have, want)
+	}
+}
+
+func TestDispatcherWorkers(t *testing.T) {
+	p := &fakePusher{calls: make(map[string]int), done: make(chan string, 100)}
+	d := newDispatcher(p.Push, time.Millisecond, 3, 0, testMetrics(), log.NewNopLogger())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Run(ctx)
+
+	for i := 0; i < 30; i++ {
+		d.Enqueue(fmt.Sprintf("udid-%d", i))
+	}
+	waitPushes(t, p.done, 30)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.max > 3 {
+		t.Errorf("have %d concurrent pushes, want at most 3", p.max)
+	}
+}
+
+func TestDispatcherRetry(t *testing.T) {
+	p := &fakePusher{
+		calls: make(map[string]int),
+		done:  make(chan string, 100),
+		fail: func(udid string, call int) error {
+			if udid == "udid-gone" {
+				return &Error{Status: http.StatusGone, Reason: ReasonUnregistered}
+			}
+			if call == 1 {
+				return &Error{Status: http.StatusServiceUnavailable, Reason: ReasonServiceUnavailable}
+			}
+			return nil
+		},
+	}
+	m := testMetrics()
+	d := newDispatcher(p.Push, time.Millisecond, 2, 0, m, log.NewNopLogger())
+	d.backoff = time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Run(ctx)
+
+	d.Enqueue("udid-1")
+	d.Enqueue("udid-gone")
+	waitPushes(t, p.done, 3)
+	time.Sleep(20 * time.Millisecond)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if have, want := p.calls["udid-1"], 2; have != want {
+		t.Errorf("have %d pushes to udid-1, want %d", have, want)
+	}
+	if have, want := p.calls["udid-gone"], 1; have != want {
+		t.Errorf("have %d pushes to udid-gone, want %d", have, want)
+	}
+	for _, tt := range []struct {
+		name string
+		have float64
+		want float64
+	}{
+		{"retried", m.Retried.(*generic.Counter).Value(), 1},
+		{"succeeded", m.Succeeded.(*generic.Counter).Value(), 1},
+		{"failed", m.Failed.(*generic.Counter).Value(), 1},
+	} {
+		if tt.have != tt.want {
+			t.Errorf("have %v %s, want %v", tt.have, tt.name, tt.want)
+		}
+	}
+}
+
+func TestDispatcherDrop(t *testing.T) {
+	p := &fakePusher{calls: make(map[string]int), done: make(chan string, 100)}
+	m := testMetrics()
+	d := newDispatcher(p.Push, time.Hour, 1, 0, m, log.NewNopLogger())
+	d.size = 2
+
+	for i := 0; i < 5; i++ {
+		d.Enqueue(fmt.Sprintf("udid-%d", i))
+	}
+	d.Enqueue("udid-0")
+
+	if have, want := len(d.queue), 2; have != want {
+		t.Errorf("have %d queued pushes, want %d", have, want)
+	}
+	if have, want := m.Dropped.(*generic.Counter).Value(), 3.0; have != want {
+		t.Errorf("have %v dropped, want %v", have, want)
+	}
+	if have, want := m.Coalesced.(*generic.Counter).Value(), 1.0; have != want {
+		t.Errorf("have %v coalesced, want %v", have, want)
+	}
+}
+
+func TestDispatcherNoRetryAfterShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &fakePusher{
+		calls: make(map[string]int),
+		done:  make(chan string, 100),
+		fail: func(udid string, call int) error {
+			cancel()
+			return &Error{Status: http.StatusServiceUnavailable, Reason: ReasonServiceUnavailable}
+		},
+	}
+	m := testMetrics()
+	d := newDispatcher(p.Push, time.Millisecond, 1, 0, m, log.NewNopLogger())
+	d.backoff = time.Millisecond
+	stopped := make(chan struct{})
+	go func() {
+		d.Run(ctx)
+		close(stopped)
+	}()
+
+	d.Enqueue("udid-1")
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("dispatcher did not stop")
+	}
+
+	if have, want := m.Retried.(*generic.Counter).Value(), 0.0; have != want {
+		t.Errorf("have %v retried, want %v", have, want)
+	}
+	if have, want := len(d.queue), 0; have != want {
+		t.Errorf("have %d queued pushes, want %d", have, want)
+	}
+}
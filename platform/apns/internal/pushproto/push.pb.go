@@ -29,10 +29,11 @@ var _ = math.Inf
 const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
 
 type PushInfo struct {
-	Udid      string `protobuf:"bytes,1,opt,name=udid" json:"udid,omitempty"`
-	Token     string `protobuf:"bytes,2,opt,name=token" json:"token,omitempty"`
-	PushMagic string `protobuf:"bytes,3,opt,name=push_magic,json=pushMagic" json:"push_magic,omitempty"`
-	MdmTopic  string `protobuf:"bytes,4,opt,name=mdm_topic,json=mdmTopic" json:"mdm_topic,omitempty"`
+	Udid        string `protobuf:"bytes,1,opt,name=udid" json:"udid,omitempty"`
+	Token       string `protobuf:"bytes,2,opt,name=token" json:"token,omitempty"`
+	PushMagic   string `protobuf:"bytes,3,opt,name=push_magic,json=pushMagic" json:"push_magic,omitempty"`
+	MdmTopic    string `protobuf:"bytes,4,opt,name=mdm_topic,json=mdmTopic" json:"mdm_topic,omitempty"`
+	Unreachable bool   `protobuf:"varint,5,opt,name=unreachable" json:"unreachable,omitempty"`
 }
 
 func (m *PushInfo) Reset()                    { *m = PushInfo{} }
@@ -68,6 +69,13 @@ func (m *PushInfo) GetMdmTopic() string {
 	return ""
 }
 
+func (m *PushInfo) GetUnreachable() bool {
+	if m != nil {
+		return m.Unreachable
+	}
+	return false
+}
+
 func init() {
 	proto.RegisterType((*PushInfo)(nil), "pushproto.PushInfo")
 }
@@ -75,14 +83,15 @@ func init() {
 func init() { proto.RegisterFile("push.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 133 bytes of a gzipped FileDescriptorProto
+	// 155 bytes of a gzipped FileDescriptorProto
 	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xe2, 0xe2, 0x2a, 0x28, 0x2d, 0xce,
-	0xd0, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0xe2, 0x04, 0xb1, 0xc1, 0x4c, 0xa5, 0x02, 0x2e, 0x8e,
-	0x80, 0xd2, 0xe2, 0x0c, 0xcf, 0xbc, 0xb4, 0x7c, 0x21, 0x21, 0x2e, 0x96, 0xd2, 0x94, 0xcc, 0x14,
-	0x09, 0x46, 0x05, 0x46, 0x0d, 0xce, 0x20, 0x30, 0x5b, 0x48, 0x84, 0x8b, 0xb5, 0x24, 0x3f, 0x3b,
-	0x35, 0x4f, 0x82, 0x09, 0x2c, 0x08, 0xe1, 0x08, 0xc9, 0x42, 0x8c, 0x8b, 0xcf, 0x4d, 0x4c, 0xcf,
-	0x4c, 0x96, 0x60, 0x06, 0x4b, 0x81, 0x0d, 0xf5, 0x05, 0x09, 0x08, 0x49, 0x73, 0x71, 0xe6, 0xa6,
-	0xe4, 0xc6, 0x97, 0xe4, 0x17, 0x64, 0x26, 0x4b, 0xb0, 0x80, 0x65, 0x39, 0x72, 0x53, 0x72, 0x43,
-	0x40, 0xfc, 0x24, 0x36, 0xb0, 0xc5, 0xc6, 0x80, 0x00, 0x00, 0x00, 0xff, 0xff, 0x1e, 0xd3, 0xd3,
-	0x24, 0x91, 0x00, 0x00, 0x00,
+	0xd0, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0xe2, 0x04, 0xb1, 0xc1, 0x4c, 0xa5, 0x49, 0x8c, 0x5c,
+	0x1c, 0x01, 0xa5, 0xc5, 0x19, 0x9e, 0x79, 0x69, 0xf9, 0x42, 0x42, 0x5c, 0x2c, 0xa5, 0x29, 0x99,
+	0x29, 0x12, 0x8c, 0x0a, 0x8c, 0x1a, 0x9c, 0x41, 0x60, 0xb6, 0x90, 0x08, 0x17, 0x6b, 0x49, 0x7e,
+	0x76, 0x6a, 0x9e, 0x04, 0x13, 0x58, 0x10, 0xc2, 0x11, 0x92, 0x85, 0x98, 0x17, 0x9f, 0x9b, 0x98,
+	0x9e, 0x99, 0x2c, 0xc1, 0x0c, 0x96, 0x02, 0x9b, 0xea, 0x0b, 0x12, 0x10, 0x92, 0xe6, 0xe2, 0xcc,
+	0x4d, 0xc9, 0x8d, 0x2f, 0xc9, 0x2f, 0xc8, 0x4c, 0x96, 0x60, 0x01, 0xcb, 0x72, 0xe4, 0xa6, 0xe4,
+	0x86, 0x80, 0xf8, 0x42, 0x0a, 0x5c, 0xdc, 0xa5, 0x79, 0x45, 0xa9, 0x89, 0xc9, 0x19, 0x89, 0x49,
+	0x39, 0xa9, 0x12, 0xac, 0x0a, 0x8c, 0x1a, 0x1c, 0x41, 0xc8, 0x42, 0x49, 0x6c, 0x60, 0xb7, 0x19,
+	0x03, 0x06, 0x00, 0x1c, 0xa8, 0x62, 0xfa, 0xb4, 0x00, 0x00, 0x00,
 }
@@ -2,16 +2,16 @@ package apns
 
 import (
 	"context"
+	"encoding/hex"
 	"encoding/json"
 	"net/http"
-	"strings"
 	"time"
 
-	"github.com/RobotsAndPencils/buford/payload"
-	"github.com/RobotsAndPencils/buford/push"
 	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log/level"
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
 
 	"github.com/vishnuvaradaraj/micromdm/pkg/httputil"
 )
@@ -21,23 +21,62 @@ func (svc *PushService) Push(ctx context.Context, deviceUDID string) (string, er
 	if err != nil {
 		return "", errors.Wrap(err, "retrieving PushInfo by UDID")
 	}
-
-	p := payload.MDM{Token: info.PushMagic}
-	valid := push.IsDeviceTokenValid(info.Token)
-	if !valid {
+	if info.Unreachable {
+		return "", errors.Errorf("push token for udid %s is unregistered, waiting for a new TokenUpdate", deviceUDID)
+	}
+	if !isDeviceTokenValid(info.Token) {
 		return "", errors.New("invalid push token")
 	}
-	jsonPayload, err := json.Marshal(p)
+
+	jsonPayload, err := json.Marshal(map[string]string{"mdm": info.PushMagic})
 	if err != nil {
 		return "", errors.Wrap(err, "marshalling push notification payload")
 	}
-	result, err := svc.pushsvc.Push(info.Token, nil, jsonPayload)
-	if err != nil && strings.HasSuffix(err.Error(), "remote error: tls: internal error") {
-		// TODO: yuck, error substring searching. see:
-		// https://github.com/vishnuvaradaraj/micromdm/issues/150
-		return result, errors.Wrap(err, "push error: possibly expired or invalid APNs certificate")
+
+	svc.mu.RLock()
+	client := svc.client
+	svc.mu.RUnlock()
+	if client == nil {
+		return "", errors.New("push service is not configured, upload a push certificate")
+	}
+
+	id, err := client.Push(ctx, Notification{
+		ID:          uuid.NewV4().String(),
+		DeviceToken: info.Token,
+		Topic:       info.MDMTopic,
+		Payload:     jsonPayload,
+	})
+	if logErr := svc.store.SavePushLog(newPushLogEntry(deviceUDID, id, err)); logErr != nil {
+		level.Info(svc.logger).Log("msg", "save push log", "udid", deviceUDID, "err", logErr)
+	}
+	if IsReason(err, ReasonUnregistered) {
+		if markErr := svc.markUnreachable(ctx, info); markErr != nil {
+			level.Info(svc.logger).Log("msg", "mark push token unreachable", "udid", deviceUDID, "err", markErr)
+		}
+	}
+	return id, err
+}
+
+// markUnreachable stops pushes to a token APNs reports as Unregistered, until
+// the device checks in with a new one.
+func (svc *PushService) markUnreachable(ctx context.Context, info *PushInfo) error {
+	info.Unreachable = true
+	if err := svc.store.Save(info); err != nil {
+		return err
+	}
+	if svc.pub == nil {
+		return nil
+	}
+	return svc.pub.Publish(ctx, UnregisteredTopic, []byte(info.UDID))
+}
+
+// isDeviceTokenValid reports whether token is a hex encoded APNs device token.
+func isDeviceTokenValid(token string) bool {
+	if len(token) < 64 || len(token) > 200 {
+		return false
 	}
-	return result, err
+	_, err := hex.DecodeString(token)
+	return err == nil
 }
 
 type pushRequest struct {
@@ -12,14 +12,19 @@ type PushInfo struct {
 	PushMagic string
 	Token     string
 	MDMTopic  string
+
+	// Unreachable is set when APNs reports the token as Unregistered. It is
+	// cleared by the next TokenUpdate.
+	Unreachable bool
 }
 
 func MarshalPushInfo(p *PushInfo) ([]byte, error) {
 	protopush := pushproto.PushInfo{
-		Udid:      p.UDID,
-		PushMagic: p.PushMagic,
-		Token:     p.Token,
-		MdmTopic:  p.MDMTopic,
+		Udid:        p.UDID,
+		PushMagic:   p.PushMagic,
+		Token:       p.Token,
+		MdmTopic:    p.MDMTopic,
+		Unreachable: p.Unreachable,
 	}
 	return proto.Marshal(&protopush)
 }
@@ -33,5 +38,6 @@ func UnmarshalPushInfo(data []byte, p *PushInfo) error {
 	p.Token = pb.GetToken()
 	p.PushMagic = pb.GetPushMagic()
 	p.MDMTopic = pb.GetMdmTopic()
+	p.Unreachable = pb.GetUnreachable()
 	return nil
 }
@@ -0,0 +1,99 @@
+package apns
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+// PushLogSize is the number of push log entries kept for each UDID.
+const PushLogSize = 100
+
+// PushLogEntry records the outcome of a push notification.
+type PushLogEntry struct {
+	UDID      string    `json:"udid"`
+	ID        string    `json:"apns_id"`
+	Status    int       `json:"status"`
+	Reason    Reason    `json:"reason,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PushLogStore persists the push log of each UDID.
+type PushLogStore interface {
+	// SavePushLog adds an entry, dropping the oldest entries of the UDID
+	// beyond PushLogSize.
+	SavePushLog(entry *PushLogEntry) error
+	// PushLog returns the entries of a UDID, newest first.
+	PushLog(udid string) ([]PushLogEntry, error)
+}
+
+func newPushLogEntry(udid, id string, err error) *PushLogEntry {
+	entry := &PushLogEntry{
+		UDID:      udid,
+		ID:        id,
+		Status:    http.StatusOK,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err == nil {
+		return entry
+	}
+	if apnsErr, ok := errors.Cause(err).(*Error); ok {
+		entry.Status = apnsErr.Status
+		entry.Reason = apnsErr.Reason
+	} else {
+		entry.Status = 0
+	}
+	entry.Error = err.Error()
+	return entry
+}
+
+func (svc *PushService) PushHistory(ctx context.Context, udid string) ([]PushLogEntry, error) {
+	entries, err := svc.store.PushLog(udid)
+	return entries, errors.Wrapf(err, "get push log for udid %s", udid)
+}
+
+type pushHistoryRequest struct {
+	UDID string
+}
+
+type pushHistoryResponse struct {
+	Entries []PushLogEntry `json:"push_log"`
+	Err     error          `json:"err,omitempty"`
+}
+
+func (r pushHistoryResponse) Failed() error { return r.Err }
+
+func decodePushHistoryRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	udid, ok := mux.Vars(r)["udid"]
+	if !ok {
+		return nil, errors.New("apns: bad route")
+	}
+	return pushHistoryRequest{UDID: udid}, nil
+}
+
+func MakePushHistoryEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(pushHistoryRequest)
+		entries, err := svc.PushHistory(ctx, req.UDID)
+		return pushHistoryResponse{Entries: entries, Err: err}, nil
+	}
+}
+
+func (mw loggingMiddleware) PushHistory(ctx context.Context, udid string) (entries []PushLogEntry, err error) {
+	defer func(begin time.Time) {
+		_ = mw.logger.Log(
+			"method", "PushHistory",
+			"udid", udid,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+
+	entries, err = mw.next.PushHistory(ctx, udid)
+	return
+}
@@ -9,18 +9,21 @@ import (
 )
 
 type Endpoints struct {
-	PushEndpoint endpoint.Endpoint
+	PushEndpoint        endpoint.Endpoint
+	PushHistoryEndpoint endpoint.Endpoint
 }
 
 func MakeServerEndpoints(s Service, outer endpoint.Middleware, others ...endpoint.Middleware) Endpoints {
 	return Endpoints{
-		PushEndpoint: endpoint.Chain(outer, others...)(MakePushEndpoint(s)),
+		PushEndpoint:        endpoint.Chain(outer, others...)(MakePushEndpoint(s)),
+		PushHistoryEndpoint: endpoint.Chain(outer, others...)(MakePushHistoryEndpoint(s)),
 	}
 }
 
 func RegisterHTTPHandlers(r *mux.Router, e Endpoints, options ...httptransport.ServerOption) {
 	// GET    /push/:udid		create an APNS Push notification for a managed device or user(deprecated)
 	// POST   /v1/push/:udid	create an APNS Push notification for a managed device or user
+	// GET    /v1/push/:udid	get the push log of a managed device or user
 
 	r.Methods("GET").Path("/push/{udid}").Handler(httptransport.NewServer(
 		e.PushEndpoint,
@@ -35,4 +38,11 @@ func RegisterHTTPHandlers(r *mux.Router, e Endpoints, options ...httptransport.S
 		httputil.EncodeJSONResponse,
 		options...,
 	))
+
+	r.Methods("GET").Path("/v1/push/{udid}").Handler(httptransport.NewServer(
+		e.PushHistoryEndpoint,
+		decodePushHistoryRequest,
+		httputil.EncodeJSONResponse,
+		options...,
+	))
 }
@@ -3,36 +3,50 @@ package apns
 import (
 	"context"
 	"crypto/tls"
-	"fmt"
-	"log"
-	"net/http"
 	"sync"
 	"time"
 
-	"github.com/RobotsAndPencils/buford/push"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
 	"github.com/pkg/errors"
-	"golang.org/x/net/http2"
 
 	"github.com/vishnuvaradaraj/micromdm/platform/config"
 	"github.com/vishnuvaradaraj/micromdm/platform/pubsub"
 	"github.com/vishnuvaradaraj/micromdm/platform/queue"
 )
 
+// UnregisteredTopic is published with the UDID as the message when APNs
+// reports a push token as Unregistered.
+const UnregisteredTopic = "mdm.PushUnregistered"
+
 type Service interface {
 	Push(ctx context.Context, udid string) (string, error)
+	PushHistory(ctx context.Context, udid string) ([]PushLogEntry, error)
 }
 
 type Store interface {
 	PushInfo(udid string) (*PushInfo, error)
+	Save(*PushInfo) error
+	PushLogStore
 }
 
 type PushService struct {
 	store    Store
 	start    chan struct{}
 	provider PushCertificateProvider
-
-	mu      sync.RWMutex
-	pushsvc *push.Service
+	pub      pubsub.Publisher
+	host     string
+	token    *Token
+	logger   log.Logger
+
+	pushWindow  time.Duration
+	pushWorkers int
+	pushRate    int
+	metrics     Metrics
+	dispatch    *dispatcher
+
+	mu     sync.RWMutex
+	client *Client
 }
 
 type PushCertificateProvider interface {
@@ -41,58 +55,127 @@ type PushCertificateProvider interface {
 
 type Option func(*PushService)
 
-func WithPushService(svc *push.Service) Option {
+// WithDispatch configures how pushes for queued commands are sent. Pushes to
+// the same UDID within window are coalesced, and at most workers pushes are in
+// flight, at no more than rate per second. A rate of zero is unlimited.
+func WithDispatch(window time.Duration, workers, rate int) Option {
+	return func(p *PushService) {
+		p.pushWindow = window
+		p.pushWorkers = workers
+		p.pushRate = rate
+	}
+}
+
+// WithMetrics records push latency and outcomes.
+func WithMetrics(m Metrics) Option {
 	return func(p *PushService) {
-		p.pushsvc = svc
+		p.metrics = m
 	}
 }
 
-func New(db Store, provider PushCertificateProvider, sub pubsub.Subscriber, opts ...Option) (*PushService, error) {
+// WithClient sets the APNs client, instead of creating one once the push
+// certificate is available.
+func WithClient(client *Client) Option {
+	return func(p *PushService) {
+		p.client = client
+	}
+}
+
+// WithLogger logs push errors which are not returned to the caller.
+func WithLogger(logger log.Logger) Option {
+	return func(p *PushService) {
+		p.logger = logger
+	}
+}
+
+// WithHost sets the APNs host, Production or Sandbox. The default is
+// Production.
+func WithHost(host string) Option {
+	return func(p *PushService) {
+		p.host = host
+	}
+}
+
+// WithToken authenticates to APNs with a provider token instead of the push
+// certificate.
+func WithToken(token *Token) Option {
+	return func(p *PushService) {
+		p.token = token
+	}
+}
+
+// New creates the push service. Pushes for queued commands are sent until ctx
+// is done.
+func New(ctx context.Context, db Store, provider PushCertificateProvider, ps pubsub.PublishSubscriber, opts ...Option) (*PushService, error) {
 	pushSvc := PushService{
 		store:    db,
 		provider: provider,
+		pub:      ps,
+		host:     Production,
 		start:    make(chan struct{}),
+		logger:   log.NewNopLogger(),
+
+		pushWindow:  DefaultPushWindow,
+		pushWorkers: DefaultPushWorkers,
+		pushRate:    DefaultPushRate,
+		metrics:     discardMetrics(),
 	}
 	for _, opt := range opts {
 		opt(&pushSvc)
 	}
-	// if there is no push service, the push certificate hasn't been provided.
-	// start a goroutine that delays the run of this service.
-	if err := updateClient(&pushSvc, sub); err != nil {
+
+	if pushSvc.token != nil {
+		if pushSvc.client == nil {
+			client, err := NewTokenClient(pushSvc.token, pushSvc.host)
+			if err != nil {
+				return nil, errors.Wrap(err, "create push token client")
+			}
+			pushSvc.client = client
+		}
+	} else if err := updateClient(ctx, &pushSvc, ps); err != nil {
+		// if there is no push client, the push certificate hasn't been provided.
+		// start a goroutine that delays the run of this service.
 		return nil, errors.Wrap(err, "wait for push service config")
 	}
 
-	if err := pushSvc.startQueuedSubscriber(sub); err != nil {
+	pushSvc.dispatch = newDispatcher(pushSvc.Push, pushSvc.pushWindow, pushSvc.pushWorkers, pushSvc.pushRate, pushSvc.metrics, pushSvc.logger)
+	if err := pushSvc.startQueuedSubscriber(ctx, ps); err != nil {
 		return &pushSvc, err
 	}
 	return &pushSvc, nil
 }
 
-func (svc *PushService) startQueuedSubscriber(sub pubsub.Subscriber) error {
-	commandQueuedEvents, err := sub.Subscribe(context.TODO(), "push-info", queue.CommandQueuedTopic)
+func (svc *PushService) startQueuedSubscriber(ctx context.Context, sub pubsub.Subscriber) error {
+	commandQueuedEvents, err := sub.Subscribe(ctx, "push-info", queue.CommandQueuedTopic)
 	if err != nil {
 		return errors.Wrapf(err,
 			"subscribing push to %s topic", queue.CommandQueuedTopic)
 	}
+	svc.mu.RLock()
+	ready := svc.client != nil
+	svc.mu.RUnlock()
 	go func() {
-		if svc.pushsvc == nil {
-			log.Println("push: waiting for push certificate before enabling APNS service provider")
-			<-svc.start
-			log.Println("push: service started")
+		if !ready {
+			level.Info(svc.logger).Log("msg", "waiting for push certificate before enabling APNS service provider")
+			select {
+			case <-ctx.Done():
+				return
+			case <-svc.start:
+			}
+			level.Info(svc.logger).Log("msg", "push service started")
 		}
+		go svc.dispatch.Run(ctx)
 		for {
 			select {
+			case <-ctx.Done():
+				return
 			case event := <-commandQueuedEvents:
 				cq, err := queue.UnmarshalQueuedCommand(event.Message)
 				if err != nil {
-					fmt.Println(err)
-					continue
-				}
-				_, err = svc.Push(context.TODO(), cq.DeviceUDID)
-				if err != nil {
-					fmt.Println(err)
+					level.Info(svc.logger).Log("msg", "unmarshal queued command", "err", err)
 					continue
 				}
+				svc.QueuePush(cq.DeviceUDID)
 			}
 		}
 	}()
@@ -100,22 +183,30 @@ func (svc *PushService) startQueuedSubscriber(sub pubsub.Subscriber) error {
 	return nil
 }
 
-func updateClient(svc *PushService, sub pubsub.Subscriber) error {
-	configEvents, err := sub.Subscribe(context.TODO(), "push-server-configs", config.ConfigTopic)
+// QueuePush schedules a push to the UDID through the dispatcher, which
+// coalesces, rate limits and retries it. Errors are logged.
+func (svc *PushService) QueuePush(udid string) {
+	svc.dispatch.Enqueue(udid)
+}
+
+func updateClient(ctx context.Context, svc *PushService, sub pubsub.Subscriber) error {
+	configEvents, err := sub.Subscribe(ctx, "push-server-configs", config.ConfigTopic)
 	if err != nil {
 		return errors.Wrap(err, "update push service client")
 	}
 	go func() {
 		for {
 			select {
+			case <-ctx.Done():
+				return
 			case <-configEvents:
-				pushsvc, err := NewPushService(svc.provider)
+				client, err := NewCertificateClient(svc.provider, svc.host)
 				if err != nil {
-					log.Printf("push: could not get push certificate %s\n", err)
+					level.Info(svc.logger).Log("msg", "get push certificate", "err", err)
 					continue
 				}
 				svc.mu.Lock()
-				svc.pushsvc = pushsvc
+				svc.client = client
 				svc.mu.Unlock()
 				go func() { svc.start <- struct{}{} }() // unblock queue
 			}
@@ -124,37 +215,17 @@ func updateClient(svc *PushService, sub pubsub.Subscriber) error {
 	return nil
 }
 
-func newClient(cert tls.Certificate) (*http.Client, error) {
-	config := &tls.Config{
-		Certificates: []tls.Certificate{cert},
-	}
-	config.BuildNameToCertificate()
-	transport := &http.Transport{
-		TLSClientConfig: config,
-		IdleConnTimeout: 90 * time.Second,
-	}
-
-	if err := http2.ConfigureTransport(transport); err != nil {
-		return nil, err
-	}
-
-	return &http.Client{
-		Transport: transport,
-		Timeout:   20 * time.Second,
-	}, nil
-}
-
-func NewPushService(provider PushCertificateProvider) (*push.Service, error) {
+// NewCertificateClient creates an APNs client with the push certificate of
+// the provider.
+func NewCertificateClient(provider PushCertificateProvider, host string) (*Client, error) {
 	cert, err := provider.PushCertificate()
 	if err != nil {
 		return nil, errors.Wrap(err, "get push certificate from store")
 	}
 
-	client, err := newClient(*cert)
+	client, err := NewClient(*cert, host)
 	if err != nil {
 		return nil, errors.Wrap(err, "create push service client")
 	}
-
-	svc := push.NewService(client, push.Production)
-	return svc, nil
+	return client, nil
 }
@@ -0,0 +1,101 @@
+package apns
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// tokenLifetime is how long a provider token is reused. APNs rejects tokens
+// older than an hour and throttles tokens refreshed more than every 20 minutes.
+const tokenLifetime = 50 * time.Minute
+
+// Token is an APNs provider token, signed with the .p8 authentication key of
+// a developer account.
+type Token struct {
+	KeyID  string
+	TeamID string
+	Key    *ecdsa.PrivateKey
+
+	mu       sync.Mutex
+	bearer   string
+	issuedAt time.Time
+}
+
+// ParseTokenKey parses a PEM encoded .p8 APNs authentication key.
+func ParseTokenKey(p8 []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(p8)
+	if block == nil {
+		return nil, errors.New("decode APNs authentication key PEM")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse APNs authentication key")
+	}
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("APNs authentication key is not an ECDSA key")
+	}
+	return ecKey, nil
+}
+
+// Bearer returns the signed JWT to send in the authorization header.
+func (t *Token) Bearer() (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.bearer != "" && time.Since(t.issuedAt) < tokenLifetime {
+		return t.bearer, nil
+	}
+	now := time.Now()
+	bearer, err := t.sign(now)
+	if err != nil {
+		return "", err
+	}
+	t.bearer, t.issuedAt = bearer, now
+	return bearer, nil
+}
+
+// Expire discards the current JWT, so the next call to Bearer signs a new one.
+func (t *Token) Expire() {
+	t.mu.Lock()
+	t.bearer = ""
+	t.mu.Unlock()
+}
+
+func (t *Token) sign(now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "ES256", "kid": t.KeyID})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{"iss": t.TeamID, "iat": now.Unix()})
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+
+	hash := sha256.Sum256([]byte(unsigned))
+	r, s, err := ecdsa.Sign(rand.Reader, t.Key, hash[:])
+	if err != nil {
+		return "", errors.Wrap(err, "sign APNs provider token")
+	}
+	// ES256 signatures are r and s as 32 byte big endian integers.
+	sig := make([]byte, 64)
+	fillBytes(r, sig[:32])
+	fillBytes(s, sig[32:])
+	return unsigned + "." + enc.EncodeToString(sig), nil
+}
+
+func fillBytes(n *big.Int, buf []byte) {
+	b := n.Bytes()
+	copy(buf[len(buf)-len(b):], b)
+}
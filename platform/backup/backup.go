@@ -0,0 +1,60 @@
+package backup
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/pkg/httputil"
+)
+
+type backupResponse struct {
+	Body io.ReadCloser
+	Err  error `json:"err,omitempty"`
+}
+
+func (r backupResponse) Failed() error { return r.Err }
+
+func decodeBackupRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	return nil, nil
+}
+
+// encodeBackupResponse streams the snapshot instead of encoding JSON.
+func encodeBackupResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	resp := response.(backupResponse)
+	if resp.Err != nil {
+		httputil.ErrorEncoder(ctx, resp.Err, w)
+		return nil
+	}
+	defer resp.Body.Close()
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="micromdm.db"`)
+	_, err := io.Copy(w, resp.Body)
+	return errors.Wrap(err, "write backup")
+}
+
+func decodeBackupResponse(_ context.Context, r *http.Response) (interface{}, error) {
+	if r.StatusCode != http.StatusOK {
+		defer r.Body.Close()
+		return nil, httputil.JSONErrorDecoder(r)
+	}
+	return backupResponse{Body: r.Body}, nil
+}
+
+func MakeBackupEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		body, err := svc.Backup(ctx)
+		return backupResponse{Body: body, Err: err}, nil
+	}
+}
+
+func (e Endpoints) Backup(ctx context.Context) (io.ReadCloser, error) {
+	response, err := e.BackupEndpoint(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return response.(backupResponse).Body, response.(backupResponse).Err
+}
@@ -0,0 +1,292 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/blueprint"
+	depapi "github.com/vishnuvaradaraj/micromdm/platform/dep"
+	"github.com/vishnuvaradaraj/micromdm/platform/dep/sync"
+	"github.com/vishnuvaradaraj/micromdm/platform/device"
+	"github.com/vishnuvaradaraj/micromdm/platform/group"
+	"github.com/vishnuvaradaraj/micromdm/platform/profile"
+	"github.com/vishnuvaradaraj/micromdm/platform/pubsub/inmem"
+	"github.com/vishnuvaradaraj/micromdm/platform/queue"
+	"github.com/vishnuvaradaraj/micromdm/platform/storage"
+	"github.com/vishnuvaradaraj/micromdm/platform/user"
+)
+
+const mobileconfig = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>PayloadIdentifier</key>
+	<string>com.example.profile</string>
+</dict>
+</plist>`
+
+func TestBackup(t *testing.T) {
+	db, stores := setupBolt(t)
+	defer db.Close()
+	defer os.Remove(db.Path())
+	seed(t, stores)
+
+	svc := New(db)
+	r, err := svc.Backup(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	f, err := ioutil.TempFile("", "bolt-backup-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := io.Copy(f, r); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	snapshot, err := bolt.Open(f.Name(), 0644, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snapshot.Close()
+	exp, err := ExportBolt(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(exp.Devices), 1; have != want {
+		t.Errorf("have %d devices, want %d", have, want)
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	db, stores := setupBolt(t)
+	defer db.Close()
+	defer os.Remove(db.Path())
+	seed(t, stores)
+
+	exp, err := ExportBolt(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the import reads the JSON, not the in-memory export.
+	data, err := json.Marshal(exp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var imp Export
+	if err := json.Unmarshal(data, &imp); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := ioutil.TempFile("", "sqlite-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	dst, err := storage.Open(context.Background(), "sqlite://"+f.Name(), inmem.NewPubSub())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+
+	// importing twice must not fail or duplicate records.
+	for i := 0; i < 2; i++ {
+		if err := imp.Import(dst); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("devices", func(t *testing.T) {
+		dev, err := dst.Device.DeviceByUDID("UDID-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have, want := dev.SerialNumber, "SERIAL-1"; have != want {
+			t.Errorf("have %s, want %s", have, want)
+		}
+		hash, err := dst.Device.GetUDIDCertHash([]byte("UDID-1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have, want := hash, []byte("hash"); !bytes.Equal(have, want) {
+			t.Errorf("have %s, want %s", have, want)
+		}
+	})
+
+	t.Run("blueprints", func(t *testing.T) {
+		bps, err := dst.Blueprint.List()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have, want := len(bps), 1; have != want {
+			t.Fatalf("have %d blueprints, want %d", have, want)
+		}
+		if have, want := bps[0].ProfileIdentifiers[0], "com.example.profile"; have != want {
+			t.Errorf("have %s, want %s", have, want)
+		}
+	})
+
+	t.Run("queue", func(t *testing.T) {
+		cmd, err := dst.Queue.DeviceCommand("UDID-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have, want := len(cmd.Commands), 1; have != want {
+			t.Fatalf("have %d commands, want %d", have, want)
+		}
+		if have, want := cmd.Commands[0].UUID, "cmd-1"; have != want {
+			t.Errorf("have %s, want %s", have, want)
+		}
+	})
+
+	t.Run("dep", func(t *testing.T) {
+		for _, tt := range []struct{ tokenName, cursor, profile string }{
+			{"", "cursor-1", "profile-1"},
+			{"school", "cursor-2", "profile-2"},
+		} {
+			cursor, err := dst.DEPSync.LoadCursor(tt.tokenName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have, want := cursor.Value, tt.cursor; have != want {
+				t.Errorf("have %s, want %s", have, want)
+			}
+			aa, err := dst.DEPSync.LoadAutoAssigners(tt.tokenName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have, want := len(aa), 1; have != want {
+				t.Fatalf("have %d auto-assigners, want %d", have, want)
+			}
+			if have, want := aa[0].ProfileUUID, tt.profile; have != want {
+				t.Errorf("have auto-assigner profile %s, want %s", have, want)
+			}
+		}
+
+		versions, err := dst.DEPProfile.ProfileVersions("default", "Staff")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have, want := len(versions), 2; have != want {
+			t.Fatalf("have %d dep profile versions, want %d", have, want)
+		}
+		assignments, err := dst.DEPProfile.Assignments()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have, want := len(assignments), 1; have != want {
+			t.Errorf("have %d dep profile assignments, want %d", have, want)
+		}
+	})
+
+	t.Run("groups", func(t *testing.T) {
+		g, err := dst.Group.GroupByName("Staff")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(g.Serials) != 1 || g.Serials[0] != "SERIAL-1" {
+			t.Errorf("have group serials %v", g.Serials)
+		}
+		m, err := dst.Group.Member("Staff", "device-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have, want := m.UDID, "UDID-1"; have != want {
+			t.Errorf("have member UDID %s, want %s", have, want)
+		}
+	})
+}
+
+func setupBolt(t *testing.T) (*bolt.DB, *storage.Stores) {
+	f, err := ioutil.TempFile("", "bolt-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	db, err := bolt.Open(f.Name(), 0777, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores, err := storage.NewBolt(db, inmem.NewPubSub())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, stores
+}
+
+func seed(t *testing.T, stores *storage.Stores) {
+	if err := stores.Device.Save(&device.Device{UUID: "uuid-1", UDID: "UDID-1", SerialNumber: "SERIAL-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := stores.Device.SaveUDIDCertHash([]byte("UDID-1"), []byte("hash")); err != nil {
+		t.Fatal(err)
+	}
+	if err := stores.Profile.Save(&profile.Profile{Identifier: "com.example.profile", Mobileconfig: []byte(mobileconfig)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := stores.User.Save(&user.User{UUID: "user-1", UDID: "UDID-1", UserID: "user-id-1"}); err != nil {
+		t.Fatal(err)
+	}
+	bp := &blueprint.Blueprint{
+		UUID:               "bp-1",
+		Name:               "default",
+		ProfileIdentifiers: []string{"com.example.profile"},
+		UserUUID:           []string{"user-1"},
+	}
+	if err := stores.Blueprint.Save(bp); err != nil {
+		t.Fatal(err)
+	}
+	cmd := &queue.DeviceCommand{
+		DeviceUDID: "UDID-1",
+		Commands:   []queue.Command{{UUID: "cmd-1", Payload: []byte("payload")}},
+	}
+	if err := stores.Queue.Save(cmd); err != nil {
+		t.Fatal(err)
+	}
+	if err := stores.Config.AddToken("CK_backup", []byte(`{"consumer_key":"CK_backup"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := stores.DEPSync.SaveCursor("", sync.Cursor{Value: "cursor-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := stores.DEPSync.SaveAutoAssigner(&sync.AutoAssigner{Filter: "*", ProfileUUID: "profile-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := stores.DEPSync.SaveCursor("school", sync.Cursor{Value: "cursor-2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := stores.DEPSync.SaveAutoAssigner(&sync.AutoAssigner{Filter: "*", ProfileUUID: "profile-2", TokenName: "school"}); err != nil {
+		t.Fatal(err)
+	}
+	for v := 1; v <= 2; v++ {
+		pv := &depapi.ProfileVersion{TokenName: "default", Name: "Staff", Version: v, ProfileUUID: "profile-" + strconv.Itoa(v)}
+		if err := stores.DEPProfile.SaveProfileVersion(pv); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := stores.DEPProfile.SaveAssignment(&depapi.Assignment{SerialNumber: "SERIAL-1", TokenName: "default", ProfileUUID: "profile-2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := stores.Group.Save(&group.Group{Name: "Staff", Serials: []string{"SERIAL-1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := stores.Group.SaveMember("Staff", &group.Member{UUID: "device-1", UDID: "UDID-1", SerialNumber: "SERIAL-1"}); err != nil {
+		t.Fatal(err)
+	}
+}
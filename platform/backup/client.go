@@ -0,0 +1,35 @@
+package backup
+
+import (
+	"net/url"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	httptransport "github.com/go-kit/kit/transport/http"
+
+	"github.com/vishnuvaradaraj/micromdm/pkg/httputil"
+)
+
+func NewHTTPClient(instance, token string, logger log.Logger, opts ...httptransport.ClientOption) (Service, error) {
+	u, err := url.Parse(instance)
+	if err != nil {
+		return nil, err
+	}
+
+	var backupEndpoint endpoint.Endpoint
+	{
+		// the body is handed to the caller instead of being closed.
+		opts = append(opts, httptransport.BufferedStream(true))
+		backupEndpoint = httptransport.NewClient(
+			"GET",
+			httputil.CopyURL(u, "/v1/backup"),
+			httputil.EncodeRequestWithToken(token, httptransport.EncodeJSONRequest),
+			decodeBackupResponse,
+			opts...,
+		).Endpoint()
+	}
+
+	return Endpoints{
+		BackupEndpoint: backupEndpoint,
+	}, nil
+}
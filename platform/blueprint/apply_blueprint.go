@@ -5,11 +5,45 @@ import (
 	"net/http"
 
 	"github.com/go-kit/kit/endpoint"
+	"github.com/pkg/errors"
+
 	"github.com/vishnuvaradaraj/micromdm/pkg/httputil"
 )
 
+// ApplyBlueprint creates or replaces a blueprint. The profiles and
+// applications which a replaced blueprint no longer installs, and everything
+// it installed on devices which left its scope, are removed from them. A
+// blueprint can not be replaced by one with another UUID, as its state on
+// devices is kept by UUID.
 func (svc *BlueprintService) ApplyBlueprint(ctx context.Context, bp *Blueprint) error {
-	return svc.store.Save(bp)
+	prev, err := svc.previous(bp)
+	if err != nil {
+		return err
+	}
+	if err := svc.store.Save(bp); err != nil {
+		return err
+	}
+	if prev == nil || svc.unapplier == nil {
+		return nil
+	}
+	_, err = svc.unapplier.Unapply(ctx, prev, bp, false)
+	return errors.Wrapf(err, "un-apply blueprint %s", bp.Name)
+}
+
+// previous returns the saved version of a blueprint, or nil if there is none.
+// It fails if the saved version has another UUID.
+func (svc *BlueprintService) previous(bp *Blueprint) (*Blueprint, error) {
+	prev, err := svc.store.BlueprintByName(bp.Name)
+	if IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "get blueprint %s", bp.Name)
+	}
+	if prev.UUID != bp.UUID {
+		return nil, errors.Errorf("blueprint %s exists with UUID %s, its UUID can not be changed to %s", bp.Name, prev.UUID, bp.UUID)
+	}
+	return prev, nil
 }
 
 type applyBlueprintRequest struct {
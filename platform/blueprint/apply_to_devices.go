@@ -0,0 +1,66 @@
+package blueprint
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/pkg/httputil"
+)
+
+// ApplyToDevices applies the blueprint with a name to devices now, whatever
+// its ApplyAt, and returns the UDIDs it was applied to.
+func (svc *BlueprintService) ApplyToDevices(ctx context.Context, name string, udids []string) ([]string, error) {
+	if svc.applier == nil {
+		return nil, errors.New("blueprint: applying blueprints on demand is not enabled")
+	}
+	bp, err := svc.store.BlueprintByName(name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get blueprint %s", name)
+	}
+	return svc.applier.ApplyToDevices(ctx, bp, udids)
+}
+
+type applyToDevicesRequest struct {
+	Name  string   `json:"name"`
+	UDIDs []string `json:"udids,omitempty"`
+}
+
+type applyToDevicesResponse struct {
+	UDIDs []string `json:"udids"`
+	Err   error    `json:"err,omitempty"`
+}
+
+func (r applyToDevicesResponse) Failed() error { return r.Err }
+
+func decodeApplyToDevicesRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	var req applyToDevicesRequest
+	err := httputil.DecodeJSONRequest(r, &req)
+	return req, err
+}
+
+func decodeApplyToDevicesResponse(_ context.Context, r *http.Response) (interface{}, error) {
+	var resp applyToDevicesResponse
+	err := httputil.DecodeJSONResponse(r, &resp)
+	return resp, err
+}
+
+func MakeApplyToDevicesEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(applyToDevicesRequest)
+		udids, err := svc.ApplyToDevices(ctx, req.Name, req.UDIDs)
+		return applyToDevicesResponse{UDIDs: udids, Err: err}, nil
+	}
+}
+
+func (e Endpoints) ApplyToDevices(ctx context.Context, name string, udids []string) ([]string, error) {
+	request := applyToDevicesRequest{Name: name, UDIDs: udids}
+	resp, err := e.ApplyToDevicesEndpoint(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	response := resp.(applyToDevicesResponse)
+	return response.UDIDs, response.Err
+}
@@ -1,7 +1,12 @@
 package blueprint
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
 
 	"github.com/gogo/protobuf/proto"
 	"github.com/vishnuvaradaraj/micromdm/platform/blueprint/internal/blueprintproto"
@@ -10,12 +15,24 @@ import (
 // ApplyAt is a case-insensitive string that specifies at which point the
 // system should apply a Blueprint to devices. For example if a Blueprint has
 // an ApplyAt of "Enroll" then that profile will be applied immediately after
-// a device's enrollment in the MDM system. Currently "Enroll" is the only
-// supported value but more are planned.
+// a device's enrollment in the MDM system. Any Blueprint can also be applied
+// on demand through the API, whatever its ApplyAt.
 const (
+	// ApplyAtEnroll applies the blueprint each time a device enrolls,
+	// including when it re-enrolls.
 	ApplyAtEnroll string = "Enroll"
+	// ApplyAtReEnroll applies the blueprint only when a device re-enrolls.
+	ApplyAtReEnroll string = "ReEnroll"
+	// ApplyAtGroupJoin applies the blueprint when an enrolled device joins
+	// one of the groups of the blueprint.
+	ApplyAtGroupJoin string = "GroupJoin"
+	// ApplyAtPeriodic applies the blueprint again to the enrolled devices in
+	// its scope at the reapply interval of the server.
+	ApplyAtPeriodic string = "Periodic"
 )
 
+var applyAtTriggers = []string{ApplyAtEnroll, ApplyAtReEnroll, ApplyAtGroupJoin, ApplyAtPeriodic}
+
 type Blueprint struct {
 	UUID                                string   `json:"uuid"`
 	Name                                string   `json:"name"`
@@ -25,15 +42,153 @@ type Blueprint struct {
 	SkipPrimarySetupAccountCreation     bool     `json:"skip_primary_setup_account_creation"`
 	SetPrimarySetupAccountAsRegularUser bool     `json:"set_primary_setup_account_as_regular_user"`
 	ApplyAt                             []string `json:"apply_at"`
+	// Groups limits the blueprint to devices in one of the groups. A
+	// blueprint without groups applies to every device.
+	Groups []string `json:"groups,omitempty"`
+	// DEPProfileUUIDs limits the blueprint to devices assigned one of the
+	// DEP profiles.
+	DEPProfileUUIDs []string `json:"dep_profile_uuids,omitempty"`
+	// Models and SerialNumbers limit the blueprint to devices which match
+	// one of the patterns, such as "MacBook*" or "C02*". Patterns use the
+	// syntax of path.Match and ignore case. Models match the model, model
+	// name or product name of a device.
+	Models        []string `json:"models,omitempty"`
+	SerialNumbers []string `json:"serial_numbers,omitempty"`
+	// OSVersions limits the blueprint to devices running an OS version which
+	// matches one of the patterns, such as "14.*".
+	OSVersions []string `json:"os_versions,omitempty"`
+	// Priority orders the blueprints which are applied to a device at the
+	// same time. Blueprints with a lower priority are applied first, and
+	// blueprints with the same priority in name order.
+	Priority int `json:"priority,omitempty"`
+	// SetupOptional lets a device which awaits configuration finish Setup
+	// Assistant when the blueprint fails to install. Otherwise the failure
+	// policy of the server decides.
+	SetupOptional bool `json:"setup_optional,omitempty"`
 }
 
 func (bp *Blueprint) Verify() error {
 	if bp.Name == "" || bp.UUID == "" {
 		return errors.New("Blueprint must have Name and UUID")
 	}
+	for _, applyAt := range bp.ApplyAt {
+		if !knownTrigger(applyAt) {
+			return fmt.Errorf("unknown ApplyAt %q, want one of %s", applyAt, strings.Join(applyAtTriggers, ", "))
+		}
+	}
+	if bp.AppliesAt(ApplyAtGroupJoin) && len(bp.Groups) == 0 {
+		return fmt.Errorf("Blueprint with ApplyAt %s must have groups", ApplyAtGroupJoin)
+	}
+	var patterns []string
+	patterns = append(patterns, bp.Models...)
+	patterns = append(patterns, bp.SerialNumbers...)
+	patterns = append(patterns, bp.OSVersions...)
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q", pattern)
+		}
+	}
 	return nil
 }
 
+func knownTrigger(applyAt string) bool {
+	for _, trigger := range applyAtTriggers {
+		if strings.EqualFold(applyAt, trigger) {
+			return true
+		}
+	}
+	return false
+}
+
+// AppliesAt reports whether the blueprint has the trigger in its ApplyAt.
+func (bp *Blueprint) AppliesAt(trigger string) bool {
+	for _, applyAt := range bp.ApplyAt {
+		if strings.EqualFold(applyAt, trigger) {
+			return true
+		}
+	}
+	return false
+}
+
+// Target is a device which a blueprint may be applied to.
+type Target struct {
+	UDID           string
+	SerialNumber   string
+	Model          string
+	ModelName      string
+	ProductName    string
+	DEPProfileUUID string
+	OSVersion      string
+}
+
+// InScope reports whether the blueprint applies to the device, which must
+// match each of the groups, DEP profiles, models, serial numbers and OS
+// versions of the blueprint that are set.
+func (bp *Blueprint) InScope(ctx context.Context, groups Groups, t Target) (bool, error) {
+	if len(bp.DEPProfileUUIDs) > 0 && !containsFold(bp.DEPProfileUUIDs, t.DEPProfileUUID) {
+		return false, nil
+	}
+	if len(bp.Models) > 0 && !matchAny(bp.Models, t.Model, t.ModelName, t.ProductName) {
+		return false, nil
+	}
+	if len(bp.SerialNumbers) > 0 && !matchAny(bp.SerialNumbers, t.SerialNumber) {
+		return false, nil
+	}
+	if len(bp.OSVersions) > 0 && !matchAny(bp.OSVersions, t.OSVersion) {
+		return false, nil
+	}
+	if len(bp.Groups) == 0 {
+		return true, nil
+	}
+	if groups == nil {
+		return false, nil
+	}
+	for _, name := range bp.Groups {
+		member, err := groups.IsMember(ctx, name, t.UDID)
+		if err != nil {
+			return false, err
+		}
+		if member {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if s != "" && strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAny reports whether one of the values matches one of the patterns.
+func matchAny(patterns []string, values ...string) bool {
+	for _, pattern := range patterns {
+		for _, v := range values {
+			if v == "" {
+				continue
+			}
+			if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(v)); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Sort orders blueprints by priority, then by name.
+func Sort(bps []*Blueprint) {
+	sort.SliceStable(bps, func(i, j int) bool {
+		if bps[i].Priority != bps[j].Priority {
+			return bps[i].Priority < bps[j].Priority
+		}
+		return bps[i].Name < bps[j].Name
+	})
+}
+
 func MarshalBlueprint(bp *Blueprint) ([]byte, error) {
 	protobp := blueprintproto.Blueprint{
 		Uuid:                                bp.UUID,
@@ -43,7 +198,14 @@ func MarshalBlueprint(bp *Blueprint) ([]byte, error) {
 		UserUuid:                            bp.UserUUID,
 		SkipPrimarySetupAccountCreation:     bp.SkipPrimarySetupAccountCreation,
 		SetPrimarySetupAccountAsRegularUser: bp.SetPrimarySetupAccountAsRegularUser,
-		ApplyAt: bp.ApplyAt,
+		ApplyAt:                             bp.ApplyAt,
+		Groups:                              bp.Groups,
+		DepProfileUuids:                     bp.DEPProfileUUIDs,
+		Models:                              bp.Models,
+		SerialNumbers:                       bp.SerialNumbers,
+		Priority:                            int64(bp.Priority),
+		OsVersions:                          bp.OSVersions,
+		SetupOptional:                       bp.SetupOptional,
 	}
 	return proto.Marshal(&protobp)
 }
@@ -61,5 +223,12 @@ func UnmarshalBlueprint(data []byte, bp *Blueprint) error {
 	bp.UserUUID = pb.GetUserUuid()
 	bp.SkipPrimarySetupAccountCreation = pb.GetSkipPrimarySetupAccountCreation()
 	bp.SetPrimarySetupAccountAsRegularUser = pb.GetSetPrimarySetupAccountAsRegularUser()
+	bp.Groups = pb.GetGroups()
+	bp.DEPProfileUUIDs = pb.GetDepProfileUuids()
+	bp.Models = pb.GetModels()
+	bp.SerialNumbers = pb.GetSerialNumbers()
+	bp.Priority = int(pb.GetPriority())
+	bp.OSVersions = pb.GetOsVersions()
+	bp.SetupOptional = pb.GetSetupOptional()
 	return nil
 }
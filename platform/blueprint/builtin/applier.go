@@ -0,0 +1,292 @@
+package builtin
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/blueprint"
+	"github.com/vishnuvaradaraj/micromdm/platform/command"
+	"github.com/vishnuvaradaraj/micromdm/platform/device"
+	"github.com/vishnuvaradaraj/micromdm/platform/pubsub"
+)
+
+// DefaultReapplyInterval is how often blueprints with ApplyAt Periodic are
+// applied again.
+const DefaultReapplyInterval = 24 * time.Hour
+
+// onDemand is the trigger recorded when a blueprint is applied through the
+// API.
+const onDemand = "OnDemand"
+
+// ApplyStore looks up blueprints, queues their commands and keeps their state
+// on devices.
+type ApplyStore interface {
+	BlueprintByName(name string) (*blueprint.Blueprint, error)
+	BlueprintsByApplyAt(name string) ([]*blueprint.Blueprint, error)
+	ApplyToDevice(ctx context.Context, svc command.Service, bp *blueprint.Blueprint, udid string) error
+	blueprint.ComplianceStore
+}
+
+// DeviceStore looks up the devices which blueprints are applied to.
+type DeviceStore interface {
+	DeviceByUDID(udid string) (*device.Device, error)
+	List(opt device.ListDevicesOption) ([]device.Device, error)
+}
+
+// Applier applies blueprints to the devices in their scope, in priority
+// order. It applies them when devices enroll, re-enroll or join groups,
+// periodically, and on demand. What blueprints installed is removed from
+// devices which leave their scope. Devices which await configuration are set up
+// one blueprint at a time before they are sent DeviceConfigured.
+type Applier struct {
+	db          ApplyStore
+	devices     DeviceStore
+	cmdSvc      command.Service
+	groups      blueprint.Groups
+	ps          pubsub.PublishSubscriber
+	logger      log.Logger
+	interval    time.Duration
+	stepTimeout time.Duration
+	onFailure   SetupFailure
+	leader      func() bool
+
+	// lastReapply is the time of the previous periodic pass.
+	lastReapply time.Time
+	// setups are the devices awaiting configuration, by UDID.
+	setups map[string]*setup
+}
+
+type ApplierOption func(*Applier)
+
+// WithReapplyInterval sets how often blueprints with ApplyAt Periodic are
+// applied again. Zero disables periodic application.
+func WithReapplyInterval(interval time.Duration) ApplierOption {
+	return func(a *Applier) {
+		a.interval = interval
+	}
+}
+
+// WithSetupStepTimeout sets how long each blueprint of the setup of a device
+// which awaits configuration may take to install.
+func WithSetupStepTimeout(timeout time.Duration) ApplierOption {
+	return func(a *Applier) {
+		a.stepTimeout = timeout
+	}
+}
+
+// WithSetupFailure sets what happens to a device which awaits configuration
+// when a blueprint of its setup fails or times out.
+func WithSetupFailure(f SetupFailure) ApplierOption {
+	return func(a *Applier) {
+		a.onFailure = f
+	}
+}
+
+// WithReapplyLeader only applies blueprints periodically while held returns
+// true, so that a single server reapplies the blueprints of the devices shared
+// by several servers. Blueprints are applied at enrollment by every server.
+func WithReapplyLeader(held func() bool) ApplierOption {
+	return func(a *Applier) {
+		a.leader = held
+	}
+}
+
+func NewApplier(
+	db ApplyStore,
+	devices DeviceStore,
+	cmdSvc command.Service,
+	groups blueprint.Groups,
+	ps pubsub.PublishSubscriber,
+	logger log.Logger,
+	opts ...ApplierOption,
+) *Applier {
+	a := &Applier{
+		db:          db,
+		devices:     devices,
+		cmdSvc:      cmdSvc,
+		groups:      groups,
+		ps:          ps,
+		logger:      logger,
+		interval:    DefaultReapplyInterval,
+		stepTimeout: DefaultSetupStepTimeout,
+		onFailure:   ReleaseOnFailure,
+		setups:      make(map[string]*setup),
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// target returns the device with a UDID as a blueprint target. A device which
+// is not in the inventory only has its UDID.
+func (a *Applier) target(udid string) (blueprint.Target, error) {
+	dev, err := a.devices.DeviceByUDID(udid)
+	if isNotFound(err) {
+		return blueprint.Target{UDID: udid}, nil
+	}
+	if err != nil {
+		return blueprint.Target{}, errors.Wrapf(err, "retrieve device with udid %s", udid)
+	}
+	return targetOf(dev), nil
+}
+
+func targetOf(dev *device.Device) blueprint.Target {
+	return blueprint.Target{
+		UDID:           dev.UDID,
+		SerialNumber:   dev.SerialNumber,
+		Model:          dev.Model,
+		ModelName:      dev.ModelName,
+		ProductName:    dev.ProductName,
+		DEPProfileUUID: dev.DEPProfileUUID,
+		OSVersion:      dev.OSVersion,
+	}
+}
+
+// blueprintsAt returns the blueprints with any of the triggers, without
+// duplicates, in priority order.
+func (a *Applier) blueprintsAt(triggers ...string) ([]*blueprint.Blueprint, error) {
+	seen := make(map[string]bool)
+	var bps []*blueprint.Blueprint
+	for _, trigger := range triggers {
+		found, err := a.db.BlueprintsByApplyAt(trigger)
+		if err != nil {
+			return nil, errors.Wrapf(err, "get blueprints applied at %s", trigger)
+		}
+		for _, bp := range found {
+			if !seen[bp.UUID] {
+				seen[bp.UUID] = true
+				bps = append(bps, bp)
+			}
+		}
+	}
+	blueprint.Sort(bps)
+	return bps, nil
+}
+
+// apply applies the blueprints which have the target in their scope, in
+// order, and returns the number applied. A blueprint which fails to apply
+// does not stop the others.
+func (a *Applier) apply(ctx context.Context, bps []*blueprint.Blueprint, t blueprint.Target, trigger string) (int, error) {
+	var applied int
+	var firstErr error
+	for _, bp := range bps {
+		inScope, err := bp.InScope(ctx, a.groups, t)
+		if err != nil {
+			return applied, errors.Wrapf(err, "check scope of blueprint %s", bp.Name)
+		}
+		if !inScope {
+			continue
+		}
+		level.Debug(a.logger).Log("msg", "applying blueprint", "blueprint", bp.Name, "udid", t.UDID, "trigger", trigger)
+		if err := a.db.ApplyToDevice(ctx, a.cmdSvc, bp, t.UDID); err != nil {
+			if firstErr == nil {
+				firstErr = errors.Wrapf(err, "apply blueprint %s to %s", bp.Name, t.UDID)
+			}
+			continue
+		}
+		applied++
+		if err := publishApplied(ctx, a.ps, bp, t.UDID, trigger); err != nil {
+			level.Info(a.logger).Log("msg", "record applied blueprint", "err", err)
+		}
+	}
+	return applied, firstErr
+}
+
+// enrolledDevices returns the enrolled devices in the inventory.
+func (a *Applier) enrolledDevices() ([]device.Device, error) {
+	devices, err := a.devices.List(device.ListDevicesOption{})
+	if err != nil {
+		return nil, errors.Wrap(err, "list devices")
+	}
+	enrolled := devices[:0]
+	for _, dev := range devices {
+		if dev.Enrolled && dev.UDID != "" {
+			enrolled = append(enrolled, dev)
+		}
+	}
+	return enrolled, nil
+}
+
+// ApplyToDevices applies the blueprint to the devices with the UDIDs which
+// are in its scope, or to every enrolled device in its scope if there are no
+// UDIDs, and returns the UDIDs it was applied to.
+func (a *Applier) ApplyToDevices(ctx context.Context, bp *blueprint.Blueprint, udids []string) ([]string, error) {
+	var targets []blueprint.Target
+	if len(udids) == 0 {
+		devices, err := a.enrolledDevices()
+		if err != nil {
+			return nil, err
+		}
+		for i := range devices {
+			targets = append(targets, targetOf(&devices[i]))
+		}
+	}
+	for _, udid := range udids {
+		t, err := a.target(udid)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, t)
+	}
+
+	applied := []string{}
+	for _, t := range targets {
+		n, err := a.apply(ctx, []*blueprint.Blueprint{bp}, t, onDemand)
+		if err != nil {
+			return applied, err
+		}
+		if n > 0 {
+			applied = append(applied, t.UDID)
+		}
+	}
+	return applied, nil
+}
+
+// Reapply applies the blueprints with ApplyAt Periodic to the enrolled
+// devices in their scope. Devices which have not checked in since the
+// previous pass are skipped, so that commands do not pile up for devices which
+// are offline. What blueprints installed on devices which left their scope is
+// removed first.
+func (a *Applier) Reapply(ctx context.Context, now time.Time) error {
+	since := a.lastReapply
+	a.lastReapply = now
+	if err := a.unapplyAllOutOfScope(ctx); err != nil {
+		return err
+	}
+	bps, err := a.blueprintsAt(blueprint.ApplyAtPeriodic)
+	if err != nil || len(bps) == 0 {
+		return err
+	}
+	devices, err := a.enrolledDevices()
+	if err != nil {
+		return err
+	}
+	for i := range devices {
+		if !since.IsZero() && devices[i].LastSeen.Before(since) {
+			continue
+		}
+		if _, err := a.apply(ctx, bps, targetOf(&devices[i]), blueprint.ApplyAtPeriodic); err != nil {
+			level.Info(a.logger).Log("msg", "reapply blueprints", "udid", devices[i].UDID, "err", err)
+		}
+	}
+	return nil
+}
+
+// publishApplied adds the blueprint to the history of the device.
+func publishApplied(ctx context.Context, pub pubsub.Publisher, bp *blueprint.Blueprint, udid, trigger string) error {
+	msg, err := device.MarshalHistoryEvent(device.NewHistoryEvent(device.BlueprintApplied, udid, map[string]string{
+		"blueprint":      bp.Name,
+		"blueprint_uuid": bp.UUID,
+		"trigger":        trigger,
+	}))
+	if err != nil {
+		return errors.Wrap(err, "marshal blueprint history event")
+	}
+	err = pub.Publish(ctx, device.HistoryTopic, msg)
+	return errors.Wrapf(err, "publish blueprint %s applied to %s", bp.Name, udid)
+}
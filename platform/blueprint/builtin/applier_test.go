@@ -0,0 +1,210 @@
+package builtin
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	mdmsvc "github.com/vishnuvaradaraj/micromdm/mdm"
+	"github.com/vishnuvaradaraj/micromdm/mdm/mdm"
+	"github.com/vishnuvaradaraj/micromdm/platform/blueprint"
+	"github.com/vishnuvaradaraj/micromdm/platform/device"
+	"github.com/vishnuvaradaraj/micromdm/platform/group"
+	"github.com/vishnuvaradaraj/micromdm/platform/pubsub/inmem"
+)
+
+type fakeDevices map[string]*device.Device
+
+func (f fakeDevices) DeviceByUDID(udid string) (*device.Device, error) {
+	dev, ok := f[udid]
+	if !ok {
+		return nil, &notFound{"Device", udid}
+	}
+	return dev, nil
+}
+
+func (f fakeDevices) List(opt device.ListDevicesOption) ([]device.Device, error) {
+	var devices []device.Device
+	for _, dev := range f {
+		devices = append(devices, *dev)
+	}
+	return devices, nil
+}
+
+type fakeGroups map[string][]string
+
+func (f fakeGroups) IsMember(ctx context.Context, group, udid string) (bool, error) {
+	for _, member := range f[group] {
+		if member == udid {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// recordCommands records the blueprints whose application manifests were
+// queued, by device, and the other request types.
+type recordCommands struct {
+	applied map[string][]string
+	other   []string
+	queued  []*mdm.CommandRequest
+}
+
+func (c *recordCommands) NewCommand(ctx context.Context, req *mdm.CommandRequest) (*mdm.CommandPayload, error) {
+	c.queued = append(c.queued, req)
+	payload := &mdm.CommandPayload{CommandUUID: fmt.Sprintf("command-%d", len(c.queued))}
+	if req.InstallApplication == nil {
+		c.other = append(c.other, req.RequestType)
+		return payload, nil
+	}
+	name := strings.TrimSuffix(strings.TrimPrefix(*req.InstallApplication.ManifestURL, "https://example.com/"), ".plist")
+	c.applied[req.UDID] = append(c.applied[req.UDID], name)
+	return payload, nil
+}
+
+func (c *recordCommands) take(udid string) []string {
+	applied := c.applied[udid]
+	delete(c.applied, udid)
+	return applied
+}
+
+func setupApplier(t *testing.T, bps ...*blueprint.Blueprint) (*Applier, *recordCommands, fakeDevices) {
+	t.Helper()
+	db := setupDB(t)
+	for _, bp := range bps {
+		bp.UUID = bp.Name + "-uuid"
+		bp.ApplicationURLs = []string{fmt.Sprintf("https://example.com/%s.plist", bp.Name)}
+		if err := db.Save(bp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	devices := fakeDevices{
+		"UDID-MAC":  {UDID: "UDID-MAC", SerialNumber: "C02MAC", Model: "MacBookPro15,1", DEPProfileUUID: "staff", Enrolled: true},
+		"UDID-IPAD": {UDID: "UDID-IPAD", SerialNumber: "DMPIPAD", ProductName: "iPad8,1", Enrolled: true},
+	}
+	groups := fakeGroups{"Sales": {"UDID-IPAD"}}
+	cmds := &recordCommands{applied: make(map[string][]string)}
+	a := NewApplier(db, devices, cmds, groups, inmem.NewPubSub(), log.NewNopLogger())
+	return a, cmds, devices
+}
+
+func checkinMessage(t *testing.T, udid string, awaitingConfiguration bool) []byte {
+	t.Helper()
+	ev := mdmsvc.CheckinEvent{Command: mdmsvc.CheckinCommand{MessageType: "TokenUpdate", UDID: udid}}
+	ev.Command.AwaitingConfiguration = awaitingConfiguration
+	msg, err := mdmsvc.MarshalCheckinEvent(&ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestApplierEnroll(t *testing.T) {
+	a, cmds, _ := setupApplier(t,
+		&blueprint.Blueprint{Name: "base", ApplyAt: []string{"enroll"}, Priority: -1},
+		&blueprint.Blueprint{Name: "macs", ApplyAt: []string{blueprint.ApplyAtEnroll}, Models: []string{"macbook*"}},
+		&blueprint.Blueprint{Name: "dep-staff", ApplyAt: []string{blueprint.ApplyAtEnroll}, DEPProfileUUIDs: []string{"staff"}},
+		&blueprint.Blueprint{Name: "c02", ApplyAt: []string{blueprint.ApplyAtEnroll}, SerialNumbers: []string{"C02*"}, Priority: 5},
+		&blueprint.Blueprint{Name: "sales", ApplyAt: []string{blueprint.ApplyAtEnroll}, Groups: []string{"Sales"}},
+		&blueprint.Blueprint{Name: "again", ApplyAt: []string{blueprint.ApplyAtReEnroll}},
+	)
+	ctx := context.Background()
+
+	if err := a.applyAtEnroll(ctx, checkinMessage(t, "UDID-MAC", false), blueprint.ApplyAtEnroll); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := cmds.take("UDID-MAC"), []string{"base", "dep-staff", "macs", "c02"}; !reflect.DeepEqual(have, want) {
+		t.Errorf("have blueprints %v applied at enrollment, want %v", have, want)
+	}
+	if len(cmds.other) != 0 {
+		t.Errorf("have other commands %v, want none", cmds.other)
+	}
+
+	if err := a.applyAtEnroll(ctx, checkinMessage(t, "UDID-IPAD", false), blueprint.ApplyAtEnroll, blueprint.ApplyAtReEnroll); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := cmds.take("UDID-IPAD"), []string{"base", "again", "sales"}; !reflect.DeepEqual(have, want) {
+		t.Errorf("have blueprints %v applied at re-enrollment, want %v", have, want)
+	}
+}
+
+func TestApplierGroupJoin(t *testing.T) {
+	a, cmds, devices := setupApplier(t,
+		&blueprint.Blueprint{Name: "sales", ApplyAt: []string{blueprint.ApplyAtGroupJoin}, Groups: []string{"Sales"}},
+		&blueprint.Blueprint{Name: "support", ApplyAt: []string{blueprint.ApplyAtGroupJoin}, Groups: []string{"Support"}},
+	)
+	devices["UDID-NEW"] = &device.Device{UDID: "UDID-NEW"}
+	ctx := context.Background()
+
+	msg, err := group.MarshalEvent(&group.Event{
+		Group: "Sales",
+		Added: []group.Member{{UDID: "UDID-IPAD"}, {UDID: "UDID-NEW"}, {SerialNumber: "DEP-ONLY"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.groupChanged(ctx, msg); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := cmds.take("UDID-IPAD"), []string{"sales"}; !reflect.DeepEqual(have, want) {
+		t.Errorf("have blueprints %v applied at group join, want %v", have, want)
+	}
+	if have := cmds.take("UDID-NEW"); len(have) != 0 {
+		t.Errorf("have blueprints %v applied to a device which is not enrolled", have)
+	}
+}
+
+func TestApplierReapplyAndOnDemand(t *testing.T) {
+	a, cmds, devices := setupApplier(t,
+		&blueprint.Blueprint{Name: "periodic", ApplyAt: []string{blueprint.ApplyAtPeriodic}},
+		&blueprint.Blueprint{Name: "ipads", Models: []string{"iPad*"}},
+	)
+	ctx := context.Background()
+	now := time.Now()
+	devices["UDID-MAC"].LastSeen = now.Add(-time.Hour)
+	devices["UDID-IPAD"].LastSeen = now.Add(time.Hour)
+
+	if err := a.Reapply(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+	for _, udid := range []string{"UDID-MAC", "UDID-IPAD"} {
+		if have, want := cmds.take(udid), []string{"periodic"}; !reflect.DeepEqual(have, want) {
+			t.Errorf("have blueprints %v reapplied to %s, want %v", have, want, udid)
+		}
+	}
+	// only devices which checked in since the previous pass.
+	if err := a.Reapply(ctx, now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if have := cmds.take("UDID-MAC"); len(have) != 0 {
+		t.Errorf("have blueprints %v reapplied to a device which did not check in", have)
+	}
+	if have, want := cmds.take("UDID-IPAD"), []string{"periodic"}; !reflect.DeepEqual(have, want) {
+		t.Errorf("have blueprints %v reapplied, want %v", have, want)
+	}
+
+	bp, err := a.db.(*DB).BlueprintByName("ipads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := blueprint.New(a.db.(*DB), blueprint.WithApplier(a))
+	applied, err := svc.ApplyToDevices(ctx, bp.Name, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := applied, []string{"UDID-IPAD"}; !reflect.DeepEqual(have, want) {
+		t.Errorf("have blueprint applied on demand to %v, want %v", have, want)
+	}
+	applied, err = svc.ApplyToDevices(ctx, bp.Name, []string{"UDID-MAC"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 0 {
+		t.Errorf("have blueprint applied on demand to %v, want none out of scope", applied)
+	}
+}
@@ -1,15 +1,14 @@
 package builtin
 
 import (
+	"context"
 	"fmt"
-	"google.golang.org/api/iterator"
 	"strings"
-	"context"
 
+	"cloud.google.com/go/firestore"
 	"github.com/boltdb/bolt"
 	"github.com/pkg/errors"
-
-	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
 
 	"github.com/vishnuvaradaraj/micromdm/platform/blueprint"
 	"github.com/vishnuvaradaraj/micromdm/platform/profile"
@@ -21,51 +20,54 @@ const (
 	blueprintIndexBucket = "mdm.BlueprintIdx"
 )
 
+// FireDB stores blueprints in Google Cloud Firestore, keyed by UUID.
+// The name is stored next to the record so it can be queried.
 type FireDB struct {
 	*firestore.Client
 	profDB profile.Store
 	userDB user.Store
 }
 
+type blueprintDoc struct {
+	Name string `firestore:"name"`
+	Data []byte `firestore:"data"`
+}
+
 func NewFireDB(
 	db *firestore.Client,
 	profileDB profile.Store,
-	userDB user.Store,) (*FireDB, error) {
-
+	userDB user.Store,
+) (*FireDB, error) {
 	datastore := &FireDB{
 		Client: db,
 		profDB: profileDB,
-		userDB: userDB,}
+		userDB: userDB,
+	}
 	return datastore, nil
 }
 
 func (db *FireDB) List() ([]blueprint.Blueprint, error) {
-	// TODO add filter/limit with ForEach
 	var blueprints []blueprint.Blueprint
-
-	ctx := context.Background()
-
-	iter := db.Collection(BlueprintBucket).Documents(ctx)
+	iter := db.Collection(BlueprintBucket).Documents(context.Background())
+	defer iter.Stop()
 	for {
-		doc, err := iter.Next()
+		snap, err := iter.Next()
 		if err == iterator.Done {
 			break
 		}
+		if err != nil {
+			return nil, errors.Wrap(err, "list blueprints from firestore")
+		}
+		bp, err := blueprintFromSnapshot(snap)
 		if err != nil {
 			return nil, err
 		}
-
-		var bp blueprint.Blueprint
-		doc.DataTo(&bp)
-
-		blueprints = append(blueprints, bp)
+		blueprints = append(blueprints, *bp)
 	}
-
 	return blueprints, nil
 }
 
 func (db *FireDB) Save(bp *blueprint.Blueprint) error {
-
 	err := bp.Verify()
 	if err != nil {
 		return err
@@ -86,93 +88,76 @@ func (db *FireDB) Save(bp *blueprint.Blueprint) error {
 			return errors.Wrap(err, "fetching profile")
 		}
 	}
-
-	ctx := context.Background()
-
-	_, err = db.Collection(BlueprintBucket).Doc(bp.UUID).Set(ctx, bp)
+	bpproto, err := blueprint.MarshalBlueprint(bp)
 	if err != nil {
-		return err
+		return errors.Wrap(err, "marshalling blueprint")
 	}
-
-	return nil
+	doc := blueprintDoc{Name: bp.Name, Data: bpproto}
+	_, err = db.Collection(BlueprintBucket).Doc(bp.UUID).Set(context.Background(), doc)
+	return errors.Wrap(err, "put blueprint to firestore")
 }
 
 func (db *FireDB) BlueprintByName(name string) (*blueprint.Blueprint, error) {
-	var bp blueprint.Blueprint
-
-	ctx := context.Background()
-
-	q := db.Collection(BlueprintBucket).Where("Name", "==", name).Limit(1)
-	query := q.Documents(ctx)
-	docs, err := query.GetAll()
+	snap, err := db.snapshotByName(name)
 	if err != nil {
 		return nil, err
 	}
+	return blueprintFromSnapshot(snap)
+}
 
-	if (len(docs)>0) {
-
-		var bp blueprint.Blueprint
-
-		doc := docs[0]
-		doc.DataTo(&bp)
-
-	} else {
-		return nil, &notFound{"Blueprint","Not found"}
+func (db *FireDB) snapshotByName(name string) (*firestore.DocumentSnapshot, error) {
+	q := db.Collection(BlueprintBucket).Where("name", "==", name).Limit(1)
+	docs, err := q.Documents(context.Background()).GetAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "query blueprint by name")
 	}
-
-	return &bp, nil
+	if len(docs) == 0 {
+		return nil, &notFound{"Blueprint", fmt.Sprintf("name %s", name)}
+	}
+	return docs[0], nil
 }
 
 func (db *FireDB) BlueprintsByApplyAt(name string) ([]*blueprint.Blueprint, error) {
-
-	var blueprints []*blueprint.Blueprint
-
-	ctx := context.Background()
-
-	iter := db.Collection(BlueprintBucket).Documents(ctx)
-	for {
-		doc, err := iter.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			return nil, err
-		}
-
-		var bp blueprint.Blueprint
-		doc.DataTo(&bp)
-
-		for _, n := range bp.ApplyAt {
-			if strings.ToLower(n) == strings.ToLower(name) {
-				blueprints = append(blueprints, &bp)
-				break
-			}
-		}
+	all, err := db.List()
+	if err != nil {
+		return nil, err
 	}
-
-	return blueprints, nil
+	return filterApplyAt(all, name), nil
 }
 
 func (db *FireDB) Delete(name string) error {
-
-	ctx := context.Background()
-
-	q := db.Collection(BlueprintBucket).Where("Name", "==", name).Limit(1)
-	query := q.Documents(ctx)
-	docs, err := query.GetAll()
+	snap, err := db.snapshotByName(name)
 	if err != nil {
 		return err
 	}
+	_, err = snap.Ref.Delete(context.Background())
+	return err
+}
 
-	if (len(docs)>0) {
-
-		doc := docs[0]
-		doc.Ref.Delete(ctx)
+func blueprintFromSnapshot(snap *firestore.DocumentSnapshot) (*blueprint.Blueprint, error) {
+	var doc blueprintDoc
+	if err := snap.DataTo(&doc); err != nil {
+		return nil, errors.Wrap(err, "decode blueprint document")
+	}
+	var bp blueprint.Blueprint
+	if err := blueprint.UnmarshalBlueprint(doc.Data, &bp); err != nil {
+		return nil, err
+	}
+	return &bp, nil
+}
 
-	} else {
-		return &notFound{"Blueprint","Not found"}
+// filterApplyAt returns the blueprints which are applied at the named event.
+func filterApplyAt(all []blueprint.Blueprint, name string) []*blueprint.Blueprint {
+	var bps []*blueprint.Blueprint
+	for i := range all {
+		for _, n := range all[i].ApplyAt {
+			if strings.ToLower(n) == strings.ToLower(name) {
+				bps = append(bps, &all[i])
+				break
+			}
+		}
 	}
-	return err
+	return bps
 }
 
 //////////////////////////////////////////////////////////////////
@@ -193,6 +178,10 @@ func NewDB(
 		if err != nil {
 			return err
 		}
+		_, err = tx.CreateBucketIfNotExists([]byte(DeviceStateBucket))
+		if err != nil {
+			return err
+		}
 		_, err = tx.CreateBucketIfNotExists([]byte(BlueprintBucket))
 		return err
 	})
@@ -284,7 +273,7 @@ func (db *DB) BlueprintByName(name string) (*blueprint.Blueprint, error) {
 			return &notFound{"Blueprint", fmt.Sprintf("name %s", name)}
 		}
 		v := b.Get(idx)
-		if idx == nil {
+		if v == nil {
 			return &notFound{"Blueprint", fmt.Sprintf("uuid %s", string(idx))}
 		}
 		return blueprint.UnmarshalBlueprint(v, &bp)
@@ -353,9 +342,13 @@ func (e *notFound) Error() string {
 	return fmt.Sprintf("not found: %s %s", e.ResourceType, e.Message)
 }
 
+func (e *notFound) NotFound() bool {
+	return true
+}
+
+// isNotFound reports whether err is a not found error of this or another
+// store, such as the device store.
 func isNotFound(err error) bool {
-	if _, ok := err.(*notFound); ok {
-		return true
-	}
-	return false
+	e, ok := errors.Cause(err).(interface{ NotFound() bool })
+	return ok && e.NotFound()
 }
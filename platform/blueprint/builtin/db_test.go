@@ -1,14 +1,10 @@
 package builtin
 
 import (
-	"firebase.google.com/go"
-	"google.golang.org/api/option"
 	"io/ioutil"
 	"os"
 	"testing"
 
-	"context"
-
 	"github.com/boltdb/bolt"
 	"github.com/vishnuvaradaraj/micromdm/platform/blueprint"
 	profile "github.com/vishnuvaradaraj/micromdm/platform/profile/builtin"
@@ -16,7 +12,7 @@ import (
 )
 
 func TestSave(t *testing.T) {
-	db := setupFireDB(t)
+	db := setupDB(t)
 	bp := &blueprint.Blueprint{}
 	bp.ApplyAt = []string{"Enroll"}
 
@@ -54,7 +50,6 @@ func TestSave(t *testing.T) {
 		t.Fatalf("saving blueprint2 in datastore: %s", err)
 	}
 
-	/*
 	byName, err := db.BlueprintByName("blueprint")
 	if err != nil {
 		t.Fatalf("getting blueprint by Name: %s", err)
@@ -62,7 +57,6 @@ func TestSave(t *testing.T) {
 	if byName == nil || byName.UUID != "a-b-c-d" {
 		t.Fatalf("have %s, want %s", byName.UUID, "a-b-c-d")
 	}
-	*/
 	byApplyAt, err := db.BlueprintsByApplyAt("Enroll")
 	if err != nil {
 		t.Fatalf("getting blueprint by ApplyAt: %s", err)
@@ -70,6 +64,17 @@ func TestSave(t *testing.T) {
 	if len(byApplyAt) != 2 {
 		t.Fatalf("multiple blueprints not saved correctly")
 	}
+
+	invalid := []*blueprint.Blueprint{
+		{UUID: "i-1", Name: "invalid-1", ApplyAt: []string{"Tuesday"}},
+		{UUID: "i-2", Name: "invalid-2", ApplyAt: []string{blueprint.ApplyAtGroupJoin}},
+		{UUID: "i-3", Name: "invalid-3", SerialNumbers: []string{"C02["}},
+	}
+	for _, bp := range invalid {
+		if err := db.Save(bp); err == nil {
+			t.Errorf("expected saving blueprint %+v to fail", bp)
+		}
+	}
 }
 
 func TestList(t *testing.T) {
@@ -144,34 +149,3 @@ func setupDB(t *testing.T) *DB {
 	}
 	return blueprintDB
 }
-
-func setupFireDB(t *testing.T) *FireDB {
-
-	ctx := context.Background()
-
-	// Use a service account
-	sa := option.WithCredentialsFile("/Users/vishnuv/go/src/github.com/vishnuvaradaraj/micromdm/tools/certs/family-protection-dd191-firebase-adminsdk-x7xrc-435ea7bf3a.json")
-	app, err := firebase.NewApp(ctx, nil, sa)
-	if err != nil {
-		t.Fatalf("couldn't open firebase, err %s\n", err)
-	}
-
-	fireDB, err := app.Firestore(ctx)
-	if err != nil {
-		t.Fatalf("couldn't init firebase, err %s\n", err)
-	}
-
-	profileDB, err := profile.NewFireDB(fireDB)
-	if err != nil {
-		t.Fatalf("couldn't create profile DB, err %s\n", err)
-	}
-	userDB, err := user.NewFireDB(fireDB)
-	if err != nil {
-		t.Fatalf("couldn't create user DB, err %s\n", err)
-	}
-	blueprintDB, err := NewFireDB(fireDB, profileDB, userDB)
-	if err != nil {
-		t.Fatalf("couldn't create blueprint DB, err %s\n", err)
-	}
-	return blueprintDB
-}
@@ -3,7 +3,9 @@ package builtin
 import (
 	"context"
 	"fmt"
+	"time"
 
+	"github.com/go-kit/kit/log/level"
 	"github.com/pkg/errors"
 
 	mdmsvc "github.com/vishnuvaradaraj/micromdm/mdm"
@@ -11,32 +13,89 @@ import (
 	"github.com/vishnuvaradaraj/micromdm/platform/blueprint"
 	"github.com/vishnuvaradaraj/micromdm/platform/command"
 	"github.com/vishnuvaradaraj/micromdm/platform/device"
+	"github.com/vishnuvaradaraj/micromdm/platform/group"
 	"github.com/vishnuvaradaraj/micromdm/platform/profile"
-	"github.com/vishnuvaradaraj/micromdm/platform/pubsub"
+	"github.com/vishnuvaradaraj/micromdm/platform/user"
 )
 
+// ApplyToDevice queues the commands of a blueprint for a device, and saves
+// the state of the blueprint on the device.
 func (db *DB) ApplyToDevice(ctx context.Context, svc command.Service, bp *blueprint.Blueprint, udid string) error {
-	var requests []*mdm.CommandRequest
+	return applyToDevice(ctx, svc, db, db.profDB, db.userDB, bp, udid)
+}
+
+// ApplyToDevice queues the commands of a blueprint for a device, and saves
+// the state of the blueprint on the device.
+func (db *FireDB) ApplyToDevice(ctx context.Context, svc command.Service, bp *blueprint.Blueprint, udid string) error {
+	return applyToDevice(ctx, svc, db, db.profDB, db.userDB, bp, udid)
+}
+
+// ApplyToDevice queues the commands of a blueprint for a device, and saves
+// the state of the blueprint on the device.
+func (db *SQLDB) ApplyToDevice(ctx context.Context, svc command.Service, bp *blueprint.Blueprint, udid string) error {
+	return applyToDevice(ctx, svc, db, db.profDB, db.userDB, bp, udid)
+}
+
+// RequeueMissing queues the commands of the missing items of a device state
+// again, and saves the state.
+func (db *DB) RequeueMissing(ctx context.Context, svc command.Service, s *blueprint.DeviceState) error {
+	return requeueMissing(ctx, svc, db, db.profDB, db.userDB, s)
+}
+
+// RequeueMissing queues the commands of the missing items of a device state
+// again, and saves the state.
+func (db *FireDB) RequeueMissing(ctx context.Context, svc command.Service, s *blueprint.DeviceState) error {
+	return requeueMissing(ctx, svc, db, db.profDB, db.userDB, s)
+}
+
+// RequeueMissing queues the commands of the missing items of a device state
+// again, and saves the state.
+func (db *SQLDB) RequeueMissing(ctx context.Context, svc command.Service, s *blueprint.DeviceState) error {
+	return requeueMissing(ctx, svc, db, db.profDB, db.userDB, s)
+}
+
+// stateStore is implemented by each blueprint store.
+type stateStore interface {
+	BlueprintByName(name string) (*blueprint.Blueprint, error)
+	SaveDeviceState(*blueprint.DeviceState) error
+}
+
+// itemCommand is the command which installs an item of a blueprint.
+type itemCommand struct {
+	item    blueprint.Item
+	request *mdm.CommandRequest
+}
+
+func itemCommands(
+	profDB profile.Store,
+	userDB user.Store,
+	bp *blueprint.Blueprint,
+	udid string,
+) []itemCommand {
+	var commands []itemCommand
 	for _, uuid := range bp.UserUUID {
 		fmt.Println("Adding user to admin account")
-		u, err := db.userDB.User(uuid)
+		u, err := userDB.User(uuid)
 		if err != nil {
 			fmt.Printf("User UUID %s in Blueprint %s not added \n", bp.UserUUID, bp.Name)
 			continue
 		}
-		requests = append(requests, &mdm.CommandRequest{
-			UDID: udid,
-			Command: &mdm.Command{
-				RequestType: "AccountConfiguration",
-				AccountConfiguration: &mdm.AccountConfiguration{
-					SkipPrimarySetupAccountCreation:     bp.SkipPrimarySetupAccountCreation,
-					SetPrimarySetupAccountAsRegularUser: bp.SetPrimarySetupAccountAsRegularUser,
-					AutoSetupAdminAccounts: []mdm.AdminAccount{
-						mdm.AdminAccount{
-							ShortName:    u.UserShortname,
-							FullName:     u.UserLongname,
-							PasswordHash: u.PasswordHash,
-							Hidden:       u.Hidden,
+		commands = append(commands, itemCommand{
+			item: blueprint.Item{Type: blueprint.ItemAccount, Identifier: uuid},
+			request: &mdm.CommandRequest{
+				UDID: udid,
+				Command: &mdm.Command{
+					RequestType: "AccountConfiguration",
+					AccountConfiguration: &mdm.AccountConfiguration{
+						SkipPrimarySetupAccountCreation:     bp.SkipPrimarySetupAccountCreation,
+						SetPrimarySetupAccountAsRegularUser: bp.SetPrimarySetupAccountAsRegularUser,
+						AutoSetupAdminAccounts: []mdm.AdminAccount{
+							mdm.AdminAccount{
+								ShortName:    u.UserShortname,
+								FullName:     u.UserLongname,
+								PasswordHash: u.PasswordHash,
+								Hidden:       u.Hidden,
+							},
 						},
 					},
 				},
@@ -45,20 +104,24 @@ func (db *DB) ApplyToDevice(ctx context.Context, svc command.Service, bp *bluepr
 	}
 
 	for _, appURL := range bp.ApplicationURLs {
-		requests = append(requests, &mdm.CommandRequest{
-			UDID: udid,
-			Command: &mdm.Command{
-				RequestType: "InstallApplication",
-				InstallApplication: &mdm.InstallApplication{
-					ManifestURL:     &appURL,
-					ManagementFlags: intPtr(1),
+		appURL := appURL
+		commands = append(commands, itemCommand{
+			item: blueprint.Item{Type: blueprint.ItemApplication, Identifier: appURL},
+			request: &mdm.CommandRequest{
+				UDID: udid,
+				Command: &mdm.Command{
+					RequestType: "InstallApplication",
+					InstallApplication: &mdm.InstallApplication{
+						ManifestURL:     &appURL,
+						ManagementFlags: intPtr(1),
+					},
 				},
 			},
 		})
 	}
 
 	for _, p := range bp.ProfileIdentifiers {
-		foundProfile, err := db.profDB.ProfileById(p)
+		foundProfile, err := profDB.ProfileById(p)
 		if err != nil {
 			if profile.IsNotFound(err) {
 				fmt.Printf("Profile ID %s in Blueprint %s does not exist\n", p, bp.Name)
@@ -68,84 +131,259 @@ func (db *DB) ApplyToDevice(ctx context.Context, svc command.Service, bp *bluepr
 			continue
 		}
 
-		requests = append(requests, &mdm.CommandRequest{
-			UDID: udid,
-			Command: &mdm.Command{
-				RequestType: "InstallProfile",
-				InstallProfile: &mdm.InstallProfile{
-					Payload: foundProfile.Mobileconfig,
+		commands = append(commands, itemCommand{
+			item: blueprint.Item{Type: blueprint.ItemProfile, Identifier: p},
+			request: &mdm.CommandRequest{
+				UDID: udid,
+				Command: &mdm.Command{
+					RequestType: "InstallProfile",
+					InstallProfile: &mdm.InstallProfile{
+						Payload: foundProfile.Mobileconfig,
+					},
 				},
 			},
 		})
 	}
+	return commands
+}
 
-	for _, r := range requests {
-		_, err := svc.NewCommand(ctx, r)
+func applyToDevice(
+	ctx context.Context,
+	svc command.Service,
+	db stateStore,
+	profDB profile.Store,
+	userDB user.Store,
+	bp *blueprint.Blueprint,
+	udid string,
+) error {
+	unlock := lockStates(udid)
+	defer unlock()
+	state := &blueprint.DeviceState{
+		UDID:          udid,
+		BlueprintUUID: bp.UUID,
+		BlueprintName: bp.Name,
+		AppliedAt:     time.Now().UTC(),
+	}
+	ctx = command.NewContext(ctx, command.Correlation{BlueprintID: bp.UUID})
+	var queueErr error
+	for _, c := range itemCommands(profDB, userDB, bp, udid) {
+		payload, err := svc.NewCommand(ctx, c.request)
 		if err != nil {
-			return errors.Wrap(err, "create new command from blueprint")
+			queueErr = errors.Wrap(err, "create new command from blueprint")
+			break
 		}
+		c.item.CommandUUID = payload.CommandUUID
+		c.item.Status = blueprint.ItemQueued
+		c.item.UpdatedAt = state.AppliedAt
+		state.Items = append(state.Items, c.item)
 	}
-	return nil
+	// the commands which were queued are tracked even if the others failed.
+	if err := db.SaveDeviceState(state); err != nil && queueErr == nil {
+		queueErr = errors.Wrap(err, "save blueprint device state")
+	}
+	return queueErr
 }
 
-func (db *DB) StartListener(sub pubsub.Subscriber, cmdSvc command.Service) error {
-	tokenUpdateEvents, err := sub.Subscribe(context.TODO(), "applyAtEnroll", device.DeviceEnrolledTopic)
+// requeueMissing queues the commands of the missing items again. Accounts are
+// never queued again, as they can only be created in the Setup Assistant. The
+// caller holds the lock of the device states.
+func requeueMissing(
+	ctx context.Context,
+	svc command.Service,
+	db stateStore,
+	profDB profile.Store,
+	userDB user.Store,
+	state *blueprint.DeviceState,
+) error {
+	bp, err := db.BlueprintByName(state.BlueprintName)
 	if err != nil {
-		return errors.Wrapf(err,
-			"subscribing devices to %s topic", device.DeviceEnrolledTopic)
-	}
-
-	go func() {
-		for {
-			select {
-			case event := <-tokenUpdateEvents:
-				var ev mdmsvc.CheckinEvent
-				if err := mdmsvc.UnmarshalCheckinEvent(event.Message, &ev); err != nil {
-					fmt.Println(err)
-					continue
-				}
-				if ev.Command.UserID != "" {
-					// skip UserID token updates
-					continue
-				}
-				bps, err := db.BlueprintsByApplyAt(blueprint.ApplyAtEnroll)
-				if err != nil {
-					fmt.Println(err)
-					continue
-				}
-				ctx := context.Background()
-				for _, bp := range bps {
-					fmt.Printf("applying blueprint %s to %s\n", bp.Name, ev.Command.UDID)
-					err := db.ApplyToDevice(ctx, cmdSvc, bp, ev.Command.UDID)
-					if err != nil {
-						fmt.Println(err)
-					}
-				}
-
-				if ev.Command.AwaitingConfiguration {
-					_, err := cmdSvc.NewCommand(ctx, &mdm.CommandRequest{
-						Command: &mdm.Command{RequestType: "DeviceConfigured"},
-						UDID:    ev.Command.UDID,
-					})
-					if err != nil {
-						fmt.Println(errors.Wrapf(err, "sending DeviceConfigured"))
-					}
-				}
-
-				// TODO: See notes from here:
-				// https://github.com/jessepeterson/micromdm/blob/8b068ac98d06954bb3e08b1557c193007932552b/blueprint/listener.go#L73-L103
-				// Also see discussion here for general direction:
-				// https://github.com/vishnuvaradaraj/micromdm/pull/149
-				// Finally see discussion here for high-level goals:
-				// https://github.com/vishnuvaradaraj/micromdm/issues/110
+		return errors.Wrapf(err, "get blueprint %s", state.BlueprintName)
+	}
+	commands := itemCommands(profDB, userDB, bp, state.UDID)
+	ctx = command.NewContext(ctx, command.Correlation{BlueprintID: bp.UUID})
+	now := time.Now().UTC()
+	var queueErr error
+	for i := range state.Items {
+		item := &state.Items[i]
+		if item.Status != blueprint.ItemMissing || item.Type == blueprint.ItemAccount {
+			continue
+		}
+		for _, c := range commands {
+			if c.item.Type != item.Type || c.item.Identifier != item.Identifier {
+				continue
 			}
-
+			payload, err := svc.NewCommand(ctx, c.request)
+			if err != nil {
+				queueErr = errors.Wrapf(err, "queue %s %s again", item.Type, item.Identifier)
+				break
+			}
+			item.CommandUUID = payload.CommandUUID
+			item.Status = blueprint.ItemQueued
+			item.Error = ""
+			item.UpdatedAt = now
+			item.Requeued++
+			break
 		}
-	}()
-
-	return nil
+		if queueErr != nil {
+			break
+		}
+	}
+	if err := db.SaveDeviceState(state); err != nil && queueErr == nil {
+		queueErr = errors.Wrap(err, "save blueprint device state")
+	}
+	return queueErr
 }
 
 func intPtr(i int) *int {
 	return &i
 }
+
+// Run applies blueprints to devices as they enroll, re-enroll and join groups,
+// and periodically, until ctx is done. It un-applies them from devices which
+// leave their groups. Blueprints limited to groups only apply
+// to their members. Devices which await configuration are set up step by step
+// as they acknowledge the commands of each blueprint.
+func (a *Applier) Run(ctx context.Context) error {
+	const subscription = "applyAtEnroll"
+	enrollEvents, err := a.ps.Subscribe(ctx, subscription, device.DeviceEnrolledTopic)
+	if err != nil {
+		return errors.Wrapf(err, "subscribing %s to %s", subscription, device.DeviceEnrolledTopic)
+	}
+	reEnrollEvents, err := a.ps.Subscribe(ctx, subscription, device.DeviceReEnrolledTopic)
+	if err != nil {
+		return errors.Wrapf(err, "subscribing %s to %s", subscription, device.DeviceReEnrolledTopic)
+	}
+	groupEvents, err := a.ps.Subscribe(ctx, subscription, group.MembershipChangedTopic)
+	if err != nil {
+		return errors.Wrapf(err, "subscribing %s to %s", subscription, group.MembershipChangedTopic)
+	}
+	ackEvents, err := a.ps.Subscribe(ctx, subscription, mdmsvc.ConnectTopic)
+	if err != nil {
+		return errors.Wrapf(err, "subscribing %s to %s", subscription, mdmsvc.ConnectTopic)
+	}
+	if err := a.resumeSetups(ctx, time.Now()); err != nil {
+		level.Info(a.logger).Log("msg", "resume setups", "err", err)
+	}
+	setupTicker := time.NewTicker(setupTick)
+	defer setupTicker.Stop()
+
+	// receiving from the nil channel blocks forever when periodic
+	// application is disabled.
+	var reapply <-chan time.Time
+	if a.interval > 0 {
+		ticker := time.NewTicker(a.interval)
+		defer ticker.Stop()
+		reapply = ticker.C
+	}
+
+	for {
+		var err error
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ev := <-enrollEvents:
+			err = a.applyAtEnroll(ctx, ev.Message, blueprint.ApplyAtEnroll)
+		case ev := <-reEnrollEvents:
+			// a re-enrolled device starts with an empty command queue, so
+			// the blueprints applied at every enrollment are applied again.
+			err = a.applyAtEnroll(ctx, ev.Message, blueprint.ApplyAtEnroll, blueprint.ApplyAtReEnroll)
+		case ev := <-groupEvents:
+			err = a.groupChanged(ctx, ev.Message)
+		case ev := <-ackEvents:
+			err = a.setupAcknowledged(ctx, ev.Message, time.Now())
+		case now := <-setupTicker.C:
+			a.expireSetups(ctx, now)
+		case now := <-reapply:
+			if a.leader != nil && !a.leader() {
+				// a server which takes over only reapplies to the
+				// devices seen since.
+				a.lastReapply = now
+				continue
+			}
+			err = a.Reapply(ctx, now)
+		}
+		if err != nil {
+			level.Info(a.logger).Log("msg", "apply blueprints", "err", err)
+		}
+	}
+}
+
+func (a *Applier) applyAtEnroll(ctx context.Context, message []byte, triggers ...string) error {
+	var ev mdmsvc.CheckinEvent
+	if err := mdmsvc.UnmarshalCheckinEvent(message, &ev); err != nil {
+		return errors.Wrap(err, "unmarshal checkin event")
+	}
+	if ev.Command.UserID != "" {
+		// skip UserID token updates
+		return nil
+	}
+	bps, err := a.blueprintsAt(triggers...)
+	if err != nil {
+		return err
+	}
+	t, err := a.target(ev.Command.UDID)
+	if err != nil {
+		return err
+	}
+	// the last trigger is the most specific.
+	trigger := triggers[len(triggers)-1]
+	if ev.Command.AwaitingConfiguration {
+		return a.startSetup(ctx, bps, t, trigger, time.Now())
+	}
+	_, err = a.apply(ctx, bps, t, trigger)
+	return err
+}
+
+// groupChanged applies blueprints to the devices which joined a group, and
+// un-applies them from the devices which left it.
+func (a *Applier) groupChanged(ctx context.Context, message []byte) error {
+	var ev group.Event
+	if err := group.UnmarshalEvent(message, &ev); err != nil {
+		return errors.Wrap(err, "unmarshal group membership event")
+	}
+	if err := a.applyAtGroupJoin(ctx, &ev); err != nil {
+		return err
+	}
+	return a.unapplyAtGroupLeave(ctx, &ev)
+}
+
+// applyAtGroupJoin applies the blueprints with ApplyAt GroupJoin for the group
+// to the enrolled devices which joined it.
+func (a *Applier) applyAtGroupJoin(ctx context.Context, ev *group.Event) error {
+	if len(ev.Added) == 0 {
+		return nil
+	}
+	all, err := a.blueprintsAt(blueprint.ApplyAtGroupJoin)
+	if err != nil {
+		return err
+	}
+	var bps []*blueprint.Blueprint
+	for _, bp := range all {
+		for _, name := range bp.Groups {
+			if name == ev.Group {
+				bps = append(bps, bp)
+				break
+			}
+		}
+	}
+	if len(bps) == 0 {
+		return nil
+	}
+	for _, m := range ev.Added {
+		if m.UDID == "" {
+			// DEP devices join groups before they enroll.
+			continue
+		}
+		dev, err := a.devices.DeviceByUDID(m.UDID)
+		if err != nil {
+			return errors.Wrapf(err, "retrieve device with udid %s", m.UDID)
+		}
+		if !dev.Enrolled {
+			continue
+		}
+		if _, err := a.apply(ctx, bps, targetOf(dev), blueprint.ApplyAtGroupJoin); err != nil {
+			return err
+		}
+	}
+	return nil
+}
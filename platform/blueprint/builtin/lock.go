@@ -0,0 +1,40 @@
+package builtin
+
+import "sync"
+
+// stateLocks serializes the changes of the blueprint states of each device by
+// the tracker, the applier and the blueprint service, which read the states of
+// a device, change some of their items and save them whole. Without it, one
+// would save a copy read before the other saved and undo its changes.
+var stateLocks = struct {
+	sync.Mutex
+	m map[string]*stateLock
+}{m: make(map[string]*stateLock)}
+
+type stateLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lockStates locks the blueprint states of the device with a UDID and returns
+// the function which unlocks them.
+func lockStates(udid string) func() {
+	stateLocks.Lock()
+	l, ok := stateLocks.m[udid]
+	if !ok {
+		l = new(stateLock)
+		stateLocks.m[udid] = l
+	}
+	l.refs++
+	stateLocks.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		stateLocks.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(stateLocks.m, udid)
+		}
+		stateLocks.Unlock()
+	}
+}
@@ -0,0 +1,318 @@
+package builtin
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+
+	mdmsvc "github.com/vishnuvaradaraj/micromdm/mdm"
+	"github.com/vishnuvaradaraj/micromdm/mdm/mdm"
+	"github.com/vishnuvaradaraj/micromdm/platform/blueprint"
+	"github.com/vishnuvaradaraj/micromdm/platform/device"
+	"github.com/vishnuvaradaraj/micromdm/platform/pubsub"
+)
+
+// DefaultSetupStepTimeout is how long each blueprint of the setup of a device
+// which awaits configuration may take to install.
+const DefaultSetupStepTimeout = 10 * time.Minute
+
+// setupTick is how often setups are checked for steps which timed out.
+const setupTick = 30 * time.Second
+
+// SetupFailure is what happens to a device which awaits configuration when a
+// blueprint of its setup which is not optional fails or times out.
+type SetupFailure string
+
+const (
+	// ReleaseOnFailure sends DeviceConfigured anyway, so that the device
+	// finishes Setup Assistant without the rest of its blueprints.
+	ReleaseOnFailure SetupFailure = "release"
+	// HoldOnFailure keeps the device in Setup Assistant until it is sent a
+	// DeviceConfigured command through the commands API.
+	HoldOnFailure SetupFailure = "hold"
+)
+
+// ParseSetupFailure returns the SetupFailure for a string.
+func ParseSetupFailure(s string) (SetupFailure, error) {
+	switch f := SetupFailure(s); f {
+	case ReleaseOnFailure, HoldOnFailure:
+		return f, nil
+	default:
+		return "", errors.Errorf("unknown setup failure policy %q, must be release or hold", s)
+	}
+}
+
+// setup is the progress of a device which awaits configuration through its
+// steps, the blueprints in its scope in priority order. Each step is installed
+// once every command of the step before it was acknowledged. Setups are only
+// read and changed by Run, which rebuilds them from the devices which await
+// configuration when it starts.
+type setup struct {
+	target  blueprint.Target
+	trigger string
+	steps   []*blueprint.Blueprint
+	step    int
+	// pending are the commands of the current step which were not
+	// acknowledged yet, and deadline is when the step times out.
+	pending  map[string]bool
+	deadline time.Time
+	// failed are the names of the steps which failed.
+	failed []string
+}
+
+// startSetup starts the setup of a device which awaits configuration,
+// replacing the setup of a previous enrollment.
+func (a *Applier) startSetup(ctx context.Context, bps []*blueprint.Blueprint, t blueprint.Target, trigger string, now time.Time) error {
+	s, err := a.newSetup(ctx, bps, t, trigger)
+	if err != nil {
+		return err
+	}
+	a.setups[t.UDID] = s
+	return a.runSetup(ctx, s, now)
+}
+
+// newSetup returns a setup with the blueprints which have the target in their
+// scope as its steps.
+func (a *Applier) newSetup(ctx context.Context, bps []*blueprint.Blueprint, t blueprint.Target, trigger string) (*setup, error) {
+	s := &setup{target: t, trigger: trigger}
+	for _, bp := range bps {
+		inScope, err := bp.InScope(ctx, a.groups, t)
+		if err != nil {
+			return nil, errors.Wrapf(err, "check scope of blueprint %s", bp.Name)
+		}
+		if inScope {
+			s.steps = append(s.steps, bp)
+		}
+	}
+	return s, nil
+}
+
+// resumeSetups rebuilds the setups of the enrolled devices which still await
+// configuration, which are lost when the server restarts, and queues the
+// current step of each again.
+func (a *Applier) resumeSetups(ctx context.Context, now time.Time) error {
+	devices, err := a.enrolledDevices()
+	if err != nil {
+		return err
+	}
+	for i := range devices {
+		dev := &devices[i]
+		if !dev.AwaitingConfiguration {
+			continue
+		}
+		if _, ok := a.setups[dev.UDID]; ok {
+			continue
+		}
+		if err := a.resumeSetup(ctx, targetOf(dev), now); err != nil {
+			level.Info(a.logger).Log("msg", "resume setup", "udid", dev.UDID, "err", err)
+		}
+	}
+	return nil
+}
+
+// resumeSetup rebuilds the setup of a device from the states of the
+// blueprints applied to it since it enrolled. The current step is the first
+// one whose commands were not all acknowledged, and is applied again. The
+// setup is of a re-enrollment if a blueprint applied only at re-enrollment
+// was applied.
+func (a *Applier) resumeSetup(ctx context.Context, t blueprint.Target, now time.Time) error {
+	states, err := a.db.DeviceStates(t.UDID)
+	if err != nil {
+		return errors.Wrapf(err, "get blueprint states of %s", t.UDID)
+	}
+	bps, err := a.blueprintsAt(blueprint.ApplyAtEnroll, blueprint.ApplyAtReEnroll)
+	if err != nil {
+		return err
+	}
+	applied := make(map[string]*blueprint.DeviceState)
+	for i := range states {
+		applied[states[i].BlueprintUUID] = &states[i]
+	}
+	trigger := blueprint.ApplyAtEnroll
+	for _, bp := range bps {
+		if applied[bp.UUID] != nil && !bp.AppliesAt(blueprint.ApplyAtEnroll) {
+			trigger = blueprint.ApplyAtReEnroll
+		}
+	}
+	if trigger == blueprint.ApplyAtEnroll {
+		if bps, err = a.blueprintsAt(blueprint.ApplyAtEnroll); err != nil {
+			return err
+		}
+	}
+
+	s, err := a.newSetup(ctx, bps, t, trigger)
+	if err != nil {
+		return err
+	}
+	for ; s.step < len(s.steps); s.step++ {
+		if !installed(applied[s.steps[s.step].UUID]) {
+			break
+		}
+	}
+	level.Info(a.logger).Log("msg", "resume setup", "udid", t.UDID, "step", s.step+1, "steps", len(s.steps))
+	a.setups[t.UDID] = s
+	return a.runSetup(ctx, s, now)
+}
+
+// installed reports whether every command of a blueprint state was
+// acknowledged.
+func installed(state *blueprint.DeviceState) bool {
+	if state == nil {
+		return false
+	}
+	for _, item := range state.Items {
+		if item.Status != blueprint.ItemAcknowledged && item.Status != blueprint.ItemInstalled {
+			return false
+		}
+	}
+	return true
+}
+
+// runSetup installs the current step of the setup, skipping steps without
+// commands, and sends DeviceConfigured after the last one.
+func (a *Applier) runSetup(ctx context.Context, s *setup, now time.Time) error {
+	for ; s.step < len(s.steps); s.step++ {
+		pending, err := a.applyStep(ctx, s)
+		if err != nil {
+			return a.setupStepFailed(ctx, s, now, err.Error())
+		}
+		if len(pending) > 0 {
+			s.pending = pending
+			s.deadline = now.Add(a.stepTimeout)
+			return nil
+		}
+	}
+	return a.finishSetup(ctx, s)
+}
+
+// applyStep applies the blueprint of the current step and returns its
+// commands.
+func (a *Applier) applyStep(ctx context.Context, s *setup) (map[string]bool, error) {
+	bp, udid := s.steps[s.step], s.target.UDID
+	level.Debug(a.logger).Log("msg", "applying setup step", "blueprint", bp.Name, "udid", udid, "step", s.step+1)
+	if err := a.db.ApplyToDevice(ctx, a.cmdSvc, bp, udid); err != nil {
+		return nil, errors.Wrapf(err, "apply blueprint %s", bp.Name)
+	}
+	if err := publishApplied(ctx, a.ps, bp, udid, s.trigger); err != nil {
+		level.Info(a.logger).Log("msg", "record applied blueprint", "err", err)
+	}
+	states, err := a.db.DeviceStates(udid)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get state of blueprint %s", bp.Name)
+	}
+	pending := make(map[string]bool)
+	for _, state := range states {
+		if state.BlueprintUUID != bp.UUID {
+			continue
+		}
+		for _, item := range state.Items {
+			pending[item.CommandUUID] = true
+		}
+	}
+	return pending, nil
+}
+
+// setupAcknowledged moves the setup of a device to the next step once every
+// command of the current step was acknowledged.
+func (a *Applier) setupAcknowledged(ctx context.Context, message []byte, now time.Time) error {
+	var ev mdmsvc.AcknowledgeEvent
+	if err := mdmsvc.UnmarshalAcknowledgeEvent(message, &ev); err != nil {
+		return errors.Wrap(err, "unmarshal acknowledge event")
+	}
+	s, ok := a.setups[ev.Response.UDID]
+	if !ok || ev.Response.UserID != nil || !s.pending[ev.Response.CommandUUID] {
+		return nil
+	}
+	switch ev.Response.Status {
+	case "Acknowledged":
+		delete(s.pending, ev.Response.CommandUUID)
+		if len(s.pending) > 0 {
+			return nil
+		}
+		s.step++
+		return a.runSetup(ctx, s, now)
+	case "NotNow":
+		// the device sends the command again, unless the step times out.
+		return nil
+	default:
+		reason := fmt.Sprintf("command %s answered with %s", ev.Response.CommandUUID, ev.Response.Status)
+		return a.setupStepFailed(ctx, s, now, reason)
+	}
+}
+
+// expireSetups fails the steps which timed out.
+func (a *Applier) expireSetups(ctx context.Context, now time.Time) {
+	for udid, s := range a.setups {
+		if now.Before(s.deadline) {
+			continue
+		}
+		if err := a.setupStepFailed(ctx, s, now, "timed out"); err != nil {
+			level.Info(a.logger).Log("msg", "expire setup step", "udid", udid, "err", err)
+		}
+	}
+}
+
+// setupStepFailed moves on to the next step if the current one is optional,
+// or else releases or holds the device according to the failure policy.
+func (a *Applier) setupStepFailed(ctx context.Context, s *setup, now time.Time, reason string) error {
+	bp, udid := s.steps[s.step], s.target.UDID
+	s.failed = append(s.failed, bp.Name)
+	level.Info(a.logger).Log("msg", "setup step failed", "blueprint", bp.Name, "udid", udid, "reason", reason)
+	action := string(a.onFailure)
+	if bp.SetupOptional {
+		action = "continue"
+	}
+	if err := publishSetup(ctx, a.ps, device.SetupFailed, udid, map[string]string{
+		"blueprint": bp.Name,
+		"reason":    reason,
+		"action":    action,
+	}); err != nil {
+		level.Info(a.logger).Log("msg", "record setup failure", "err", err)
+	}
+	if bp.SetupOptional {
+		s.step++
+		return a.runSetup(ctx, s, now)
+	}
+	if a.onFailure == HoldOnFailure {
+		delete(a.setups, udid)
+		return nil
+	}
+	return a.finishSetup(ctx, s)
+}
+
+// finishSetup sends DeviceConfigured, which lets the device leave Setup
+// Assistant.
+func (a *Applier) finishSetup(ctx context.Context, s *setup) error {
+	udid := s.target.UDID
+	delete(a.setups, udid)
+	_, err := a.cmdSvc.NewCommand(ctx, &mdm.CommandRequest{
+		Command: &mdm.Command{RequestType: "DeviceConfigured"},
+		UDID:    udid,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "sending DeviceConfigured")
+	}
+	details := map[string]string{"steps": strconv.Itoa(len(s.steps))}
+	if len(s.failed) > 0 {
+		details["failed"] = strings.Join(s.failed, ",")
+	}
+	if err := publishSetup(ctx, a.ps, device.SetupCompleted, udid, details); err != nil {
+		level.Info(a.logger).Log("msg", "record setup", "err", err)
+	}
+	return nil
+}
+
+// publishSetup adds the progress of a setup to the history of the device.
+func publishSetup(ctx context.Context, pub pubsub.Publisher, typ device.HistoryEventType, udid string, details map[string]string) error {
+	msg, err := device.MarshalHistoryEvent(device.NewHistoryEvent(typ, udid, details))
+	if err != nil {
+		return errors.Wrap(err, "marshal setup history event")
+	}
+	err = pub.Publish(ctx, device.HistoryTopic, msg)
+	return errors.Wrapf(err, "publish %s of %s", typ, udid)
+}
@@ -0,0 +1,137 @@
+package builtin
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/blueprint"
+	"github.com/vishnuvaradaraj/micromdm/platform/pubsub/inmem"
+)
+
+func TestApplierSetup(t *testing.T) {
+	a, cmds, devices := setupApplier(t,
+		&blueprint.Blueprint{Name: "base", ApplyAt: []string{blueprint.ApplyAtEnroll}, Priority: -1},
+		&blueprint.Blueprint{Name: "sonoma", ApplyAt: []string{blueprint.ApplyAtEnroll}, OSVersions: []string{"14.*"}},
+		&blueprint.Blueprint{Name: "ventura", ApplyAt: []string{blueprint.ApplyAtEnroll}, OSVersions: []string{"13.*"}},
+		&blueprint.Blueprint{Name: "extras", ApplyAt: []string{blueprint.ApplyAtEnroll}, SetupOptional: true, Priority: 5},
+	)
+	devices["UDID-MAC"].OSVersion = "14.2"
+	ctx := context.Background()
+	now := time.Now()
+
+	ack := func(commandUUID, status string) {
+		t.Helper()
+		msg := ackMessage(t, "UDID-MAC", commandUUID, status, map[string]interface{}{})
+		if err := a.setupAcknowledged(ctx, msg, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect := func(applied, other []string) {
+		t.Helper()
+		if have := cmds.take("UDID-MAC"); !reflect.DeepEqual(have, applied) {
+			t.Errorf("have blueprints %v applied, want %v", have, applied)
+		}
+		if have := cmds.other; !reflect.DeepEqual(have, other) {
+			t.Errorf("have other commands %v, want %v", have, other)
+		}
+		cmds.other = nil
+	}
+
+	// each step is applied once the previous one was acknowledged, and the
+	// optional step may fail.
+	if err := a.applyAtEnroll(ctx, checkinMessage(t, "UDID-MAC", true), blueprint.ApplyAtEnroll); err != nil {
+		t.Fatal(err)
+	}
+	expect([]string{"base"}, nil)
+	ack("command-1", "NotNow")
+	expect(nil, nil)
+	ack("command-1", "Acknowledged")
+	expect([]string{"sonoma"}, nil)
+	ack("command-2", "Acknowledged")
+	expect([]string{"extras"}, nil)
+	ack("command-3", "Error")
+	expect(nil, []string{"DeviceConfigured"})
+	if len(a.setups) != 0 {
+		t.Errorf("have %d setups after DeviceConfigured, want none", len(a.setups))
+	}
+
+	// a step which times out holds the device in Setup Assistant.
+	a.onFailure = HoldOnFailure
+	if err := a.applyAtEnroll(ctx, checkinMessage(t, "UDID-MAC", true), blueprint.ApplyAtEnroll); err != nil {
+		t.Fatal(err)
+	}
+	expect([]string{"base"}, nil)
+	a.expireSetups(ctx, now.Add(time.Minute))
+	expect(nil, nil)
+	a.expireSetups(ctx, now.Add(DefaultSetupStepTimeout+time.Minute))
+	expect(nil, nil)
+	if len(a.setups) != 0 {
+		t.Errorf("have %d setups after the step timed out, want none", len(a.setups))
+	}
+
+	// or releases it.
+	a.onFailure = ReleaseOnFailure
+	if err := a.applyAtEnroll(ctx, checkinMessage(t, "UDID-MAC", true), blueprint.ApplyAtEnroll); err != nil {
+		t.Fatal(err)
+	}
+	expect([]string{"base"}, nil)
+	a.expireSetups(ctx, now.Add(DefaultSetupStepTimeout+time.Minute))
+	expect(nil, []string{"DeviceConfigured"})
+}
+
+func TestApplierResumeSetup(t *testing.T) {
+	a, cmds, devices := setupApplier(t,
+		&blueprint.Blueprint{Name: "base", ApplyAt: []string{blueprint.ApplyAtEnroll}, Priority: -1},
+		&blueprint.Blueprint{Name: "sonoma", ApplyAt: []string{blueprint.ApplyAtEnroll}},
+		&blueprint.Blueprint{Name: "extras", ApplyAt: []string{blueprint.ApplyAtEnroll}, Priority: 5},
+	)
+	tracker := NewTracker(a.db.(TrackStore), cmds, inmem.NewPubSub(), log.NewNopLogger())
+	ctx := context.Background()
+	now := time.Now()
+
+	// the tracker records the acknowledged commands in the blueprint states.
+	ack := func(commandUUID string) {
+		t.Helper()
+		msg := ackMessage(t, "UDID-MAC", commandUUID, "Acknowledged", map[string]interface{}{})
+		if err := tracker.acknowledged(ctx, msg); err != nil {
+			t.Fatal(err)
+		}
+		if err := a.setupAcknowledged(ctx, msg, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := a.applyAtEnroll(ctx, checkinMessage(t, "UDID-MAC", true), blueprint.ApplyAtEnroll); err != nil {
+		t.Fatal(err)
+	}
+	ack("command-1")
+	if have, want := cmds.take("UDID-MAC"), []string{"base", "sonoma"}; !reflect.DeepEqual(have, want) {
+		t.Fatalf("have blueprints %v applied, want %v", have, want)
+	}
+
+	// the server restarts during the second step, which is applied again.
+	a.setups = make(map[string]*setup)
+	devices["UDID-MAC"].AwaitingConfiguration = true
+	if err := a.resumeSetups(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := cmds.take("UDID-MAC"), []string{"sonoma"}; !reflect.DeepEqual(have, want) {
+		t.Errorf("have blueprints %v applied on resume, want %v", have, want)
+	}
+	if _, ok := a.setups["UDID-IPAD"]; ok {
+		t.Error("have a setup for a device which does not await configuration")
+	}
+
+	ack("command-3")
+	ack("command-4")
+	if have, want := cmds.take("UDID-MAC"), []string{"extras"}; !reflect.DeepEqual(have, want) {
+		t.Errorf("have blueprints %v applied, want %v", have, want)
+	}
+	if have, want := cmds.other, []string{"DeviceConfigured"}; !reflect.DeepEqual(have, want) {
+		t.Errorf("have other commands %v, want %v", have, want)
+	}
+}
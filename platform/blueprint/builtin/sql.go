@@ -0,0 +1,118 @@
+package builtin
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/blueprint"
+	"github.com/vishnuvaradaraj/micromdm/platform/profile"
+	"github.com/vishnuvaradaraj/micromdm/platform/storage/sqldb"
+	"github.com/vishnuvaradaraj/micromdm/platform/user"
+)
+
+// SQLDB stores blueprints in a SQL database, keyed by UUID.
+type SQLDB struct {
+	*sqldb.DB
+	profDB profile.Store
+	userDB user.Store
+}
+
+func NewSQLDB(
+	db *sqldb.DB,
+	profileDB profile.Store,
+	userDB user.Store,
+) (*SQLDB, error) {
+	datastore := &SQLDB{
+		DB:     db,
+		profDB: profileDB,
+		userDB: userDB,
+	}
+	return datastore, nil
+}
+
+func (db *SQLDB) List() ([]blueprint.Blueprint, error) {
+	rows, err := db.Query(`SELECT data FROM blueprints ORDER BY uuid`)
+	if err != nil {
+		return nil, errors.Wrap(err, "list blueprints from sql")
+	}
+	defer rows.Close()
+	var blueprints []blueprint.Blueprint
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, errors.Wrap(err, "scan blueprint row")
+		}
+		var bp blueprint.Blueprint
+		if err := blueprint.UnmarshalBlueprint(data, &bp); err != nil {
+			return nil, err
+		}
+		blueprints = append(blueprints, bp)
+	}
+	return blueprints, errors.Wrap(rows.Err(), "list blueprints from sql")
+}
+
+func (db *SQLDB) Save(bp *blueprint.Blueprint) error {
+	err := bp.Verify()
+	if err != nil {
+		return err
+	}
+	check_bp, err := db.BlueprintByName(bp.Name)
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+	if err == nil && bp.UUID != check_bp.UUID {
+		return fmt.Errorf("Blueprint not saved: same name %s exists", bp.Name)
+	}
+	// verify that each Profile ID represents a profile we know about
+	for _, p := range bp.ProfileIdentifiers {
+		if _, err := db.profDB.ProfileById(p); err != nil {
+			if profile.IsNotFound(err) {
+				return fmt.Errorf("Profile ID %s in Blueprint %s does not exist", p, bp.Name)
+			}
+			return errors.Wrap(err, "fetching profile")
+		}
+	}
+	bpproto, err := blueprint.MarshalBlueprint(bp)
+	if err != nil {
+		return errors.Wrap(err, "marshalling blueprint")
+	}
+	_, err = db.Exec(db.Upsert("blueprints", "uuid", "uuid", "name", "data"), bp.UUID, bp.Name, bpproto)
+	return errors.Wrap(err, "put blueprint to sql")
+}
+
+func (db *SQLDB) BlueprintByName(name string) (*blueprint.Blueprint, error) {
+	var data []byte
+	err := db.QueryRow(`SELECT data FROM blueprints WHERE name = ?`, name).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, &notFound{"Blueprint", fmt.Sprintf("name %s", name)}
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "get blueprint by name from sql")
+	}
+	var bp blueprint.Blueprint
+	if err := blueprint.UnmarshalBlueprint(data, &bp); err != nil {
+		return nil, err
+	}
+	return &bp, nil
+}
+
+func (db *SQLDB) BlueprintsByApplyAt(name string) ([]*blueprint.Blueprint, error) {
+	all, err := db.List()
+	if err != nil {
+		return nil, err
+	}
+	return filterApplyAt(all, name), nil
+}
+
+func (db *SQLDB) Delete(name string) error {
+	res, err := db.Exec(`DELETE FROM blueprints WHERE name = ?`, name)
+	if err != nil {
+		return errors.Wrap(err, "delete blueprint from sql")
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return &notFound{"Blueprint", fmt.Sprintf("name %s", name)}
+	}
+	return nil
+}
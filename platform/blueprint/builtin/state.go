@@ -0,0 +1,202 @@
+package builtin
+
+import (
+	"context"
+
+	"cloud.google.com/go/firestore"
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/blueprint"
+)
+
+// DeviceStateBucket holds the state of blueprints on devices, in a bucket per
+// UDID keyed by blueprint UUID.
+const DeviceStateBucket = "mdm.BlueprintDeviceStates"
+
+// stateID is the key of a state in the Firestore and SQL stores.
+func stateID(s *blueprint.DeviceState) string {
+	return s.UDID + ":" + s.BlueprintUUID
+}
+
+type stateDoc struct {
+	UDID string `firestore:"udid"`
+	Data []byte `firestore:"data"`
+}
+
+func (db *FireDB) SaveDeviceState(s *blueprint.DeviceState) error {
+	data, err := blueprint.MarshalDeviceState(s)
+	if err != nil {
+		return errors.Wrap(err, "marshal blueprint device state")
+	}
+	doc := stateDoc{UDID: s.UDID, Data: data}
+	_, err = db.Collection(DeviceStateBucket).Doc(stateID(s)).Set(context.Background(), doc)
+	return errors.Wrap(err, "put blueprint device state to firestore")
+}
+
+func (db *FireDB) DeviceStates(udid string) ([]blueprint.DeviceState, error) {
+	return db.statesByQuery(db.Collection(DeviceStateBucket).Where("udid", "==", udid))
+}
+
+func (db *FireDB) ListDeviceStates() ([]blueprint.DeviceState, error) {
+	return db.statesByQuery(db.Collection(DeviceStateBucket).Query)
+}
+
+func (db *FireDB) statesByQuery(q firestore.Query) ([]blueprint.DeviceState, error) {
+	docs, err := q.Documents(context.Background()).GetAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "get blueprint device states from firestore")
+	}
+	states := []blueprint.DeviceState{}
+	for _, snap := range docs {
+		var doc stateDoc
+		if err := snap.DataTo(&doc); err != nil {
+			return nil, errors.Wrap(err, "decode blueprint device state document")
+		}
+		var s blueprint.DeviceState
+		if err := blueprint.UnmarshalDeviceState(doc.Data, &s); err != nil {
+			return nil, errors.Wrap(err, "unmarshal blueprint device state")
+		}
+		states = append(states, s)
+	}
+	return states, nil
+}
+
+func (db *FireDB) DeleteDeviceStates(udid string) error {
+	ctx := context.Background()
+	docs, err := db.Collection(DeviceStateBucket).Where("udid", "==", udid).Documents(ctx).GetAll()
+	if err != nil {
+		return errors.Wrap(err, "get blueprint device states from firestore")
+	}
+	for _, snap := range docs {
+		if _, err := snap.Ref.Delete(ctx); err != nil {
+			return errors.Wrapf(err, "delete blueprint device state of %s", udid)
+		}
+	}
+	return nil
+}
+
+func (db *FireDB) DeleteDeviceState(udid, blueprintUUID string) error {
+	id := stateID(&blueprint.DeviceState{UDID: udid, BlueprintUUID: blueprintUUID})
+	_, err := db.Collection(DeviceStateBucket).Doc(id).Delete(context.Background())
+	return errors.Wrapf(err, "delete blueprint %s state of %s", blueprintUUID, udid)
+}
+
+func (db *DB) SaveDeviceState(s *blueprint.DeviceState) error {
+	data, err := blueprint.MarshalDeviceState(s)
+	if err != nil {
+		return errors.Wrap(err, "marshal blueprint device state")
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		bkt, err := tx.Bucket([]byte(DeviceStateBucket)).CreateBucketIfNotExists([]byte(s.UDID))
+		if err != nil {
+			return errors.Wrap(err, "create blueprint device state bucket")
+		}
+		return errors.Wrap(bkt.Put([]byte(s.BlueprintUUID), data), "put blueprint device state to boltdb")
+	})
+}
+
+func (db *DB) DeviceStates(udid string) ([]blueprint.DeviceState, error) {
+	states := []blueprint.DeviceState{}
+	err := db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(DeviceStateBucket)).Bucket([]byte(udid))
+		if bkt == nil {
+			return nil
+		}
+		return bkt.ForEach(func(k, v []byte) error {
+			var s blueprint.DeviceState
+			if err := blueprint.UnmarshalDeviceState(v, &s); err != nil {
+				return errors.Wrap(err, "unmarshal blueprint device state")
+			}
+			states = append(states, s)
+			return nil
+		})
+	})
+	return states, err
+}
+
+func (db *DB) ListDeviceStates() ([]blueprint.DeviceState, error) {
+	states := []blueprint.DeviceState{}
+	err := db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(DeviceStateBucket)).ForEach(func(udid, _ []byte) error {
+			return tx.Bucket([]byte(DeviceStateBucket)).Bucket(udid).ForEach(func(k, v []byte) error {
+				var s blueprint.DeviceState
+				if err := blueprint.UnmarshalDeviceState(v, &s); err != nil {
+					return errors.Wrap(err, "unmarshal blueprint device state")
+				}
+				states = append(states, s)
+				return nil
+			})
+		})
+	})
+	return states, err
+}
+
+func (db *DB) DeleteDeviceStates(udid string) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket([]byte(DeviceStateBucket)).DeleteBucket([]byte(udid))
+		if err == bolt.ErrBucketNotFound {
+			return nil
+		}
+		return errors.Wrapf(err, "delete blueprint device states of %s", udid)
+	})
+}
+
+func (db *DB) DeleteDeviceState(udid, blueprintUUID string) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(DeviceStateBucket)).Bucket([]byte(udid))
+		if bkt == nil {
+			return nil
+		}
+		return errors.Wrapf(bkt.Delete([]byte(blueprintUUID)), "delete blueprint %s state of %s", blueprintUUID, udid)
+	})
+}
+
+func (db *SQLDB) SaveDeviceState(s *blueprint.DeviceState) error {
+	data, err := blueprint.MarshalDeviceState(s)
+	if err != nil {
+		return errors.Wrap(err, "marshal blueprint device state")
+	}
+	_, err = db.Exec(db.Upsert("blueprint_device_states", "id", "id", "udid", "blueprint_uuid", "data"),
+		stateID(s), s.UDID, s.BlueprintUUID, data)
+	return errors.Wrap(err, "put blueprint device state to sql")
+}
+
+func (db *SQLDB) DeviceStates(udid string) ([]blueprint.DeviceState, error) {
+	return db.statesByQuery(`SELECT data FROM blueprint_device_states WHERE udid = ? ORDER BY id`, udid)
+}
+
+func (db *SQLDB) ListDeviceStates() ([]blueprint.DeviceState, error) {
+	return db.statesByQuery(`SELECT data FROM blueprint_device_states ORDER BY id`)
+}
+
+func (db *SQLDB) statesByQuery(query string, args ...interface{}) ([]blueprint.DeviceState, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "get blueprint device states from sql")
+	}
+	defer rows.Close()
+	states := []blueprint.DeviceState{}
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, errors.Wrap(err, "scan blueprint device state")
+		}
+		var s blueprint.DeviceState
+		if err := blueprint.UnmarshalDeviceState(data, &s); err != nil {
+			return nil, errors.Wrap(err, "unmarshal blueprint device state")
+		}
+		states = append(states, s)
+	}
+	return states, errors.Wrap(rows.Err(), "list blueprint device states from sql")
+}
+
+func (db *SQLDB) DeleteDeviceStates(udid string) error {
+	_, err := db.Exec(`DELETE FROM blueprint_device_states WHERE udid = ?`, udid)
+	return errors.Wrapf(err, "delete blueprint device states of %s", udid)
+}
+
+func (db *SQLDB) DeleteDeviceState(udid, blueprintUUID string) error {
+	_, err := db.Exec(`DELETE FROM blueprint_device_states WHERE udid = ? AND blueprint_uuid = ?`, udid, blueprintUUID)
+	return errors.Wrapf(err, "delete blueprint %s state of %s", blueprintUUID, udid)
+}
@@ -0,0 +1,410 @@
+package builtin
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/groob/plist"
+	"github.com/pkg/errors"
+
+	mdmsvc "github.com/vishnuvaradaraj/micromdm/mdm"
+	"github.com/vishnuvaradaraj/micromdm/mdm/mdm"
+	"github.com/vishnuvaradaraj/micromdm/platform/blueprint"
+	"github.com/vishnuvaradaraj/micromdm/platform/command"
+	"github.com/vishnuvaradaraj/micromdm/platform/pubsub"
+)
+
+// DefaultCheckInterval is how often the installed profiles and applications
+// of devices are compared with their blueprints.
+const DefaultCheckInterval = 24 * time.Hour
+
+// DefaultMaxRequeues is how often a profile or application is queued again
+// before it is marked as permanently failed.
+const DefaultMaxRequeues = 5
+
+// checkExpiry is how long a check which was not answered, for example by a
+// device which re-enrolled, holds back the next one.
+const checkExpiry = 7 * 24 * time.Hour
+
+// TrackStore keeps the state of blueprints on devices and queues the missing
+// items again.
+type TrackStore interface {
+	blueprint.ComplianceStore
+	RequeueMissing(ctx context.Context, svc command.Service, s *blueprint.DeviceState) error
+}
+
+// Tracker records the outcome of the commands of blueprints, and checks that
+// what they installed is still on the devices. Profiles and applications
+// which failed or went missing are queued again, up to a limit.
+type Tracker struct {
+	db          TrackStore
+	cmdSvc      command.Service
+	sub         pubsub.Subscriber
+	logger      log.Logger
+	interval    time.Duration
+	maxRequeues int
+	leader      func() bool
+
+	// requested is when a check was last queued for each device which has
+	// not answered it.
+	requested map[string]time.Time
+}
+
+type TrackerOption func(*Tracker)
+
+// WithMaxRequeues sets how often an item is queued again before it is marked
+// as permanently failed. Zero queues items again without a limit.
+func WithMaxRequeues(n int) TrackerOption {
+	return func(t *Tracker) {
+		t.maxRequeues = n
+	}
+}
+
+// WithCheckInterval sets how often devices are checked. Zero disables the
+// checks, but the outcome of commands is still recorded.
+func WithCheckInterval(interval time.Duration) TrackerOption {
+	return func(t *Tracker) {
+		t.interval = interval
+	}
+}
+
+// WithCheckLeader only checks the devices while held returns true, so that a
+// single server checks the devices shared by several servers. The outcome of
+// commands is recorded by every server.
+func WithCheckLeader(held func() bool) TrackerOption {
+	return func(t *Tracker) {
+		t.leader = held
+	}
+}
+
+func NewTracker(db TrackStore, cmdSvc command.Service, sub pubsub.Subscriber, logger log.Logger, opts ...TrackerOption) *Tracker {
+	t := &Tracker{
+		db:          db,
+		cmdSvc:      cmdSvc,
+		sub:         sub,
+		logger:      logger,
+		interval:    DefaultCheckInterval,
+		maxRequeues: DefaultMaxRequeues,
+		requested:   make(map[string]time.Time),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// Run records command responses and checks devices until ctx is done.
+func (t *Tracker) Run(ctx context.Context) error {
+	const subscription = "blueprintCompliance"
+	ackEvents, err := t.sub.Subscribe(ctx, subscription, mdmsvc.ConnectTopic)
+	if err != nil {
+		return errors.Wrapf(err, "subscribing %s to %s", subscription, mdmsvc.ConnectTopic)
+	}
+
+	// receiving from the nil channel blocks forever when checks are
+	// disabled.
+	var check <-chan time.Time
+	if t.interval > 0 {
+		ticker := time.NewTicker(t.interval)
+		defer ticker.Stop()
+		check = ticker.C
+	}
+
+	for {
+		var err error
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ev := <-ackEvents:
+			err = t.acknowledged(ctx, ev.Message)
+		case now := <-check:
+			if t.leader != nil && !t.leader() {
+				continue
+			}
+			err = t.Check(ctx, now)
+		}
+		if err != nil {
+			level.Info(t.logger).Log("msg", "track blueprint compliance", "err", err)
+		}
+	}
+}
+
+// ackResponse are the fields of command responses which are tracked.
+type ackResponse struct {
+	// Identifier is the bundle identifier of an InstallApplication response.
+	Identifier string
+	ErrorChain []mdmsvc.ErrorChainItem
+
+	ProfileList            *[]installedProfile
+	ManagedApplicationList *map[string]managedApplication
+}
+
+type installedProfile struct {
+	PayloadIdentifier string
+}
+
+type managedApplication struct {
+	Status string
+}
+
+// acknowledged records the outcome of a blueprint command, or compares the
+// response to a ProfileList or ManagedApplicationList command with the
+// blueprints of the device.
+func (t *Tracker) acknowledged(ctx context.Context, message []byte) error {
+	var ev mdmsvc.AcknowledgeEvent
+	if err := mdmsvc.UnmarshalAcknowledgeEvent(message, &ev); err != nil {
+		return errors.Wrap(err, "unmarshal acknowledge event")
+	}
+	if ev.Response.Status == "Idle" || ev.Response.UserID != nil {
+		return nil
+	}
+	var resp ackResponse
+	if err := plist.Unmarshal(ev.Raw, &resp); err != nil {
+		return errors.Wrap(err, "decode command response")
+	}
+	udid := ev.Response.UDID
+	unlock := lockStates(udid)
+	defer unlock()
+	states, err := t.db.DeviceStates(udid)
+	if err != nil {
+		return errors.Wrapf(err, "get blueprint states of %s", udid)
+	}
+
+	if resp.ProfileList != nil || resp.ManagedApplicationList != nil {
+		delete(t.requested, udid)
+		return t.compare(ctx, states, &resp, ev.Time)
+	}
+
+	for i := range states {
+		item := states[i].ItemByCommandUUID(ev.Response.CommandUUID)
+		if item == nil {
+			continue
+		}
+		switch ev.Response.Status {
+		case "Acknowledged":
+			item.Status = blueprint.ItemAcknowledged
+			item.Error = ""
+			if item.Type == blueprint.ItemApplication && resp.Identifier != "" {
+				item.BundleIdentifier = resp.Identifier
+			}
+		case "NotNow":
+			item.Status = blueprint.ItemNotNow
+		default:
+			item.Status = blueprint.ItemFailed
+			item.Error = errorDescription(ev.Response.Status, resp.ErrorChain)
+		}
+		item.UpdatedAt = ev.Time
+		return t.db.SaveDeviceState(&states[i])
+	}
+	return nil
+}
+
+func errorDescription(status string, chain []mdmsvc.ErrorChainItem) string {
+	for _, e := range chain {
+		if e.USEnglishDescription != "" {
+			return e.USEnglishDescription
+		}
+		if e.LocalizedDescription != "" {
+			return e.LocalizedDescription
+		}
+	}
+	return status
+}
+
+// inProgress are the statuses of managed applications which are still being
+// installed or updated.
+var inProgress = map[string]bool{
+	"Prompting":               true,
+	"PromptingForLogin":       true,
+	"ValidatingPurchase":      true,
+	"Installing":              true,
+	"Redeeming":               true,
+	"PromptingForUpdate":      true,
+	"PromptingForUpdateLogin": true,
+	"ValidatingUpdate":        true,
+	"Updating":                true,
+}
+
+// compare marks the profiles or applications which were installed as missing
+// if they are not in the list response, and queues them again. Items which
+// are still waiting for the device are left alone.
+func (t *Tracker) compare(ctx context.Context, states []blueprint.DeviceState, resp *ackResponse, now time.Time) error {
+	var profiles map[string]bool
+	if resp.ProfileList != nil {
+		profiles = make(map[string]bool)
+		for _, p := range *resp.ProfileList {
+			profiles[p.PayloadIdentifier] = true
+		}
+	}
+	for i := range states {
+		state := &states[i]
+		var missing bool
+		for j := range state.Items {
+			item := &state.Items[j]
+			if item.Status != blueprint.ItemAcknowledged && item.Status != blueprint.ItemInstalled {
+				continue
+			}
+			var installed bool
+			switch {
+			case item.Type == blueprint.ItemProfile && resp.ProfileList != nil:
+				installed = profiles[item.Identifier]
+			case item.Type == blueprint.ItemApplication && resp.ManagedApplicationList != nil && item.BundleIdentifier != "":
+				app, ok := (*resp.ManagedApplicationList)[item.BundleIdentifier]
+				if ok && inProgress[app.Status] {
+					continue
+				}
+				installed = ok && (app.Status == "Managed" || app.Status == "UpdateAvailable")
+			default:
+				continue
+			}
+			status := blueprint.ItemInstalled
+			if !installed {
+				status = t.retryStatus(state, item)
+				missing = missing || status == blueprint.ItemMissing
+			}
+			if item.Status != status {
+				item.Status = status
+				item.UpdatedAt = now
+			}
+		}
+		state.CheckedAt = now
+		var err error
+		if missing {
+			level.Info(t.logger).Log("msg", "blueprint drift", "blueprint", state.BlueprintName, "udid", state.UDID)
+			err = t.db.RequeueMissing(ctx, t.cmdSvc, state)
+		} else {
+			err = t.db.SaveDeviceState(state)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "remediate blueprint %s on %s", state.BlueprintName, state.UDID)
+		}
+	}
+	return nil
+}
+
+// retryStatus returns ItemMissing for an item which failed or went missing and
+// is queued again, or ItemFailedPermanently once it was queued again as often
+// as allowed.
+func (t *Tracker) retryStatus(state *blueprint.DeviceState, item *blueprint.Item) blueprint.ItemStatus {
+	if t.maxRequeues == 0 || item.Requeued < t.maxRequeues {
+		return blueprint.ItemMissing
+	}
+	level.Info(t.logger).Log(
+		"msg", "blueprint item failed permanently",
+		"blueprint", state.BlueprintName,
+		"udid", state.UDID,
+		"type", item.Type,
+		"identifier", item.Identifier,
+		"requeued", item.Requeued,
+	)
+	return blueprint.ItemFailedPermanently
+}
+
+// Check queues the failed items of every device again, and queues a
+// ProfileList and a ManagedApplicationList command for each device to find
+// the items which went missing. A device is not checked again while it has
+// not answered the previous check.
+func (t *Tracker) Check(ctx context.Context, now time.Time) error {
+	states, err := t.db.ListDeviceStates()
+	if err != nil {
+		return errors.Wrap(err, "list blueprint device states")
+	}
+	checks := make(map[string]*deviceCheck)
+	var udids []string
+	for _, state := range states {
+		if _, ok := checks[state.UDID]; ok {
+			continue
+		}
+		c, err := t.retryFailed(ctx, state.UDID, now)
+		if err != nil {
+			level.Info(t.logger).Log("msg", "check blueprint device states", "udid", state.UDID, "err", err)
+			c = &deviceCheck{}
+		}
+		checks[state.UDID] = c
+		udids = append(udids, state.UDID)
+	}
+
+	for _, udid := range udids {
+		if requested, ok := t.requested[udid]; ok && now.Sub(requested) < checkExpiry {
+			continue
+		}
+		c := checks[udid]
+		var requests []*mdm.CommandRequest
+		if c.profiles {
+			requests = append(requests, &mdm.CommandRequest{
+				UDID:    udid,
+				Command: &mdm.Command{RequestType: "ProfileList"},
+			})
+		}
+		if len(c.bundleIDs) > 0 {
+			requests = append(requests, &mdm.CommandRequest{
+				UDID: udid,
+				Command: &mdm.Command{
+					RequestType:            "ManagedApplicationList",
+					ManagedApplicationList: &mdm.ManagedApplicationList{Identifiers: c.bundleIDs},
+				},
+			})
+		}
+		for _, r := range requests {
+			if _, err := t.cmdSvc.NewCommand(ctx, r); err != nil {
+				return errors.Wrapf(err, "queue %s for %s", r.RequestType, udid)
+			}
+			t.requested[udid] = now
+		}
+	}
+	return nil
+}
+
+// deviceCheck is what a check asks a device for.
+type deviceCheck struct {
+	profiles  bool
+	bundleIDs []string
+}
+
+// retryFailed queues the failed items of a device again, and returns what to
+// ask the device for. The states are read again once they are locked, as they
+// may have changed since they were listed.
+func (t *Tracker) retryFailed(ctx context.Context, udid string, now time.Time) (*deviceCheck, error) {
+	unlock := lockStates(udid)
+	defer unlock()
+	states, err := t.db.DeviceStates(udid)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get blueprint states of %s", udid)
+	}
+	c := &deviceCheck{}
+	for i := range states {
+		state := &states[i]
+		var failed, exhausted bool
+		for j := range state.Items {
+			item := &state.Items[j]
+			if item.Type == blueprint.ItemAccount {
+				continue
+			}
+			if item.Status == blueprint.ItemFailed {
+				item.Status = t.retryStatus(state, item)
+				item.UpdatedAt = now
+				failed = failed || item.Status == blueprint.ItemMissing
+				exhausted = exhausted || item.Status == blueprint.ItemFailedPermanently
+			}
+			if item.Type == blueprint.ItemProfile {
+				c.profiles = true
+			}
+			if item.BundleIdentifier != "" {
+				c.bundleIDs = append(c.bundleIDs, item.BundleIdentifier)
+			}
+		}
+		switch {
+		case failed:
+			if err := t.db.RequeueMissing(ctx, t.cmdSvc, state); err != nil {
+				level.Info(t.logger).Log("msg", "queue failed blueprint items again", "udid", state.UDID, "err", err)
+			}
+		case exhausted:
+			if err := t.db.SaveDeviceState(state); err != nil {
+				level.Info(t.logger).Log("msg", "save blueprint device state", "udid", state.UDID, "err", err)
+			}
+		}
+	}
+	return c, nil
+}
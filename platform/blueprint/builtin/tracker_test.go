@@ -0,0 +1,289 @@
+package builtin
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/groob/plist"
+
+	mdmsvc "github.com/vishnuvaradaraj/micromdm/mdm"
+	"github.com/vishnuvaradaraj/micromdm/platform/blueprint"
+	"github.com/vishnuvaradaraj/micromdm/platform/profile"
+	"github.com/vishnuvaradaraj/micromdm/platform/pubsub/inmem"
+)
+
+const wifiProfile = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>PayloadIdentifier</key>
+	<string>com.example.wifi</string>
+	<key>PayloadType</key>
+	<string>Configuration</string>
+</dict>
+</plist>`
+
+func ackMessage(t *testing.T, udid, commandUUID, status string, fields map[string]interface{}) []byte {
+	t.Helper()
+	raw, err := plist.Marshal(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := mdmsvc.MarshalAcknowledgeEvent(&mdmsvc.AcknowledgeEvent{
+		Time:     time.Now().UTC(),
+		Response: mdmsvc.Response{UDID: udid, Status: status, CommandUUID: commandUUID},
+		Raw:      raw,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestTrackerDrift(t *testing.T) {
+	db := setupDB(t)
+	if err := db.profDB.Save(&profile.Profile{Identifier: "com.example.wifi", Mobileconfig: []byte(wifiProfile)}); err != nil {
+		t.Fatal(err)
+	}
+	bp := &blueprint.Blueprint{
+		UUID:               "bp-uuid",
+		Name:               "staff",
+		ApplicationURLs:    []string{"https://example.com/app.plist"},
+		ProfileIdentifiers: []string{"com.example.wifi"},
+	}
+	if err := db.Save(bp); err != nil {
+		t.Fatal(err)
+	}
+	cmds := &recordCommands{applied: make(map[string][]string)}
+	tracker := NewTracker(db, cmds, inmem.NewPubSub(), log.NewNopLogger())
+	svc := blueprint.New(db)
+	ctx := context.Background()
+
+	if err := db.ApplyToDevice(ctx, cmds, bp, "UDID-1"); err != nil {
+		t.Fatal(err)
+	}
+	// itemStatus returns the status of each item of the blueprint on the
+	// device, by type.
+	itemStatus := func() (map[blueprint.ItemType]blueprint.Item, blueprint.Compliance) {
+		t.Helper()
+		report, err := svc.GetCompliance(ctx, blueprint.GetComplianceOption{UDID: "UDID-1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Devices) != 1 {
+			t.Fatalf("have %d device states, want 1", len(report.Devices))
+		}
+		items := make(map[blueprint.ItemType]blueprint.Item)
+		for _, item := range report.Devices[0].Items {
+			items[item.Type] = item
+		}
+		return items, report.Devices[0].Status
+	}
+	items, status := itemStatus()
+	if status != blueprint.Pending || items[blueprint.ItemApplication].CommandUUID != "command-1" ||
+		items[blueprint.ItemProfile].CommandUUID != "command-2" {
+		t.Fatalf("have %s with items %+v after apply, want pending", status, items)
+	}
+
+	acks := [][]byte{
+		ackMessage(t, "UDID-1", "command-1", "Acknowledged", map[string]interface{}{"Identifier": "com.example.app"}),
+		ackMessage(t, "UDID-1", "command-2", "Error", map[string]interface{}{
+			"ErrorChain": []interface{}{map[string]interface{}{"USEnglishDescription": "The profile is invalid."}},
+		}),
+	}
+	for _, msg := range acks {
+		if err := tracker.acknowledged(ctx, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	items, status = itemStatus()
+	if app := items[blueprint.ItemApplication]; app.Status != blueprint.ItemAcknowledged || app.BundleIdentifier != "com.example.app" {
+		t.Errorf("have application %+v, want acknowledged com.example.app", app)
+	}
+	if p := items[blueprint.ItemProfile]; p.Status != blueprint.ItemFailed || p.Error != "The profile is invalid." {
+		t.Errorf("have profile %+v, want failed", p)
+	}
+	if status != blueprint.NonCompliant {
+		t.Errorf("have %s, want %s", status, blueprint.NonCompliant)
+	}
+
+	// the failed profile is queued again and the device is checked.
+	now := time.Now()
+	if err := tracker.Check(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, r := range cmds.queued[2:] {
+		types = append(types, r.RequestType)
+	}
+	if have, want := types, []string{"InstallProfile", "ProfileList", "ManagedApplicationList"}; !reflect.DeepEqual(have, want) {
+		t.Fatalf("have commands %v queued by the check, want %v", have, want)
+	}
+	items, _ = itemStatus()
+	if p := items[blueprint.ItemProfile]; p.Status != blueprint.ItemQueued || p.Requeued != 1 || p.CommandUUID != "command-3" {
+		t.Errorf("have profile %+v, want queued again", p)
+	}
+	// the device has not answered the check.
+	if err := tracker.Check(ctx, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(cmds.queued), 5; have != want {
+		t.Errorf("have %d commands, want %d", have, want)
+	}
+
+	acks = [][]byte{
+		ackMessage(t, "UDID-1", "command-3", "Acknowledged", map[string]interface{}{}),
+		ackMessage(t, "UDID-1", "command-5", "Acknowledged", map[string]interface{}{
+			"ManagedApplicationList": map[string]interface{}{
+				"com.example.app": map[string]interface{}{"Status": "Managed"},
+			},
+		}),
+	}
+	for _, msg := range acks {
+		if err := tracker.acknowledged(ctx, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	items, status = itemStatus()
+	if items[blueprint.ItemApplication].Status != blueprint.ItemInstalled || status != blueprint.Compliant {
+		t.Errorf("have %s with items %+v, want compliant", status, items)
+	}
+
+	// the profile was removed from the device.
+	msg := ackMessage(t, "UDID-1", "command-4", "Acknowledged", map[string]interface{}{"ProfileList": []interface{}{}})
+	if err := tracker.acknowledged(ctx, msg); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := cmds.queued[len(cmds.queued)-1].RequestType, "InstallProfile"; have != want {
+		t.Errorf("have %s queued for the missing profile, want %s", have, want)
+	}
+	items, status = itemStatus()
+	if p := items[blueprint.ItemProfile]; p.Status != blueprint.ItemQueued || p.Requeued != 2 {
+		t.Errorf("have profile %+v, want queued again", p)
+	}
+	if items[blueprint.ItemApplication].Status != blueprint.ItemInstalled || status != blueprint.Pending {
+		t.Errorf("have %s with items %+v, want pending", status, items)
+	}
+
+	report, err := svc.GetCompliance(ctx, blueprint.GetComplianceOption{Name: bp.Name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []blueprint.BlueprintCompliance{{BlueprintName: bp.Name, Pending: 1}}
+	if have := report.Blueprints; len(have) != 1 || have[0] != want[0] {
+		t.Errorf("have blueprint compliance %+v, want %+v", have, want)
+	}
+}
+
+func TestTrackerMaxRequeues(t *testing.T) {
+	db := setupDB(t)
+	if err := db.profDB.Save(&profile.Profile{Identifier: "com.example.wifi", Mobileconfig: []byte(wifiProfile)}); err != nil {
+		t.Fatal(err)
+	}
+	bp := &blueprint.Blueprint{UUID: "bp-uuid", Name: "staff", ProfileIdentifiers: []string{"com.example.wifi"}}
+	if err := db.Save(bp); err != nil {
+		t.Fatal(err)
+	}
+	cmds := &recordCommands{applied: make(map[string][]string)}
+	tracker := NewTracker(db, cmds, inmem.NewPubSub(), log.NewNopLogger(), WithMaxRequeues(1))
+	ctx := context.Background()
+	if err := db.ApplyToDevice(ctx, cmds, bp, "UDID-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	installs := func() int {
+		var n int
+		for _, r := range cmds.queued {
+			if r.RequestType == "InstallProfile" {
+				n++
+			}
+		}
+		return n
+	}
+	profileState := func() (blueprint.Item, blueprint.Compliance) {
+		t.Helper()
+		states, err := db.DeviceStates("UDID-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(states) != 1 || len(states[0].Items) != 1 {
+			t.Fatalf("have states %+v, want one profile", states)
+		}
+		return states[0].Items[0], states[0].Compliance()
+	}
+
+	// the profile fails, is queued again once and fails again.
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		item, _ := profileState()
+		if item.Status == blueprint.ItemQueued {
+			msg := ackMessage(t, "UDID-1", item.CommandUUID, "Error", map[string]interface{}{})
+			if err := tracker.acknowledged(ctx, msg); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := tracker.Check(ctx, now.Add(time.Duration(i)*checkExpiry)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	item, status := profileState()
+	if item.Status != blueprint.ItemFailedPermanently || item.Requeued != 1 {
+		t.Errorf("have profile %+v, want failed permanently after one requeue", item)
+	}
+	if status != blueprint.NonCompliant {
+		t.Errorf("have %s, want %s", status, blueprint.NonCompliant)
+	}
+	if have, want := installs(), 2; have != want {
+		t.Errorf("have %d InstallProfile commands, want %d", have, want)
+	}
+}
+
+func TestTrackerConcurrentAcknowledged(t *testing.T) {
+	db := setupDB(t)
+	bp := &blueprint.Blueprint{UUID: "bp-uuid", Name: "staff"}
+	for i := 0; i < 20; i++ {
+		bp.ApplicationURLs = append(bp.ApplicationURLs, fmt.Sprintf("https://example.com/app-%d.plist", i))
+	}
+	if err := db.Save(bp); err != nil {
+		t.Fatal(err)
+	}
+	cmds := &recordCommands{applied: make(map[string][]string)}
+	tracker := NewTracker(db, cmds, inmem.NewPubSub(), log.NewNopLogger())
+	ctx := context.Background()
+	if err := db.ApplyToDevice(ctx, cmds, bp, "UDID-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// each acknowledgement changes another item of the same state.
+	var wg sync.WaitGroup
+	for i := range cmds.queued {
+		msg := ackMessage(t, "UDID-1", fmt.Sprintf("command-%d", i+1), "Acknowledged", map[string]interface{}{})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := tracker.acknowledged(ctx, msg); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	states, err := db.DeviceStates("UDID-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 1 {
+		t.Fatalf("have %d states, want 1", len(states))
+	}
+	for _, item := range states[0].Items {
+		if item.Status != blueprint.ItemAcknowledged {
+			t.Errorf("have item %s %s, want acknowledged", item.Identifier, item.Status)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package builtin
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/mdm/mdm"
+	"github.com/vishnuvaradaraj/micromdm/platform/blueprint"
+	"github.com/vishnuvaradaraj/micromdm/platform/command"
+	"github.com/vishnuvaradaraj/micromdm/platform/device"
+	"github.com/vishnuvaradaraj/micromdm/platform/group"
+	"github.com/vishnuvaradaraj/micromdm/platform/pubsub"
+)
+
+// Unapply removes what the blueprint installed from the devices it was
+// applied to. With next, the edited blueprint, only the items it no longer has
+// are removed, or everything from the devices which are not in its scope.
+func (a *Applier) Unapply(ctx context.Context, bp, next *blueprint.Blueprint, dryRun bool) ([]blueprint.Removal, error) {
+	states, err := a.db.ListDeviceStates()
+	if err != nil {
+		return nil, errors.Wrap(err, "list blueprint device states")
+	}
+	removals := []blueprint.Removal{}
+	for i := range states {
+		state := &states[i]
+		if state.BlueprintUUID != bp.UUID {
+			continue
+		}
+		keep, reason := next, blueprint.ItemDropped
+		if next == nil {
+			reason = blueprint.BlueprintDeleted
+		} else {
+			inScope, err := a.inScope(ctx, next, state.UDID)
+			if err != nil {
+				return removals, err
+			}
+			if !inScope {
+				keep, reason = nil, blueprint.OutOfScope
+			}
+		}
+		r, err := a.unapplyState(ctx, state, keep, reason, dryRun)
+		if err != nil {
+			return removals, err
+		}
+		removals = append(removals, r...)
+	}
+	return removals, nil
+}
+
+// inScope reports whether a device is in the scope of a blueprint. Devices
+// which are not in the inventory are left alone.
+func (a *Applier) inScope(ctx context.Context, bp *blueprint.Blueprint, udid string) (bool, error) {
+	dev, err := a.devices.DeviceByUDID(udid)
+	if isNotFound(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, errors.Wrapf(err, "retrieve device with udid %s", udid)
+	}
+	return bp.InScope(ctx, a.groups, targetOf(dev))
+}
+
+// unapplyState removes the profiles and applications of a blueprint state
+// which keep, the blueprint as it is now, does not install. A nil keep removes
+// them all and deletes the state. Accounts cannot be removed, applications
+// whose bundle identifier is not known yet are left alone, and items which
+// another blueprint installed on the device stay. The state is read again once
+// the states of the device are locked, as the tracker may have changed it.
+func (a *Applier) unapplyState(ctx context.Context, state *blueprint.DeviceState, keep *blueprint.Blueprint, reason blueprint.RemovalReason, dryRun bool) ([]blueprint.Removal, error) {
+	unlock := lockStates(state.UDID)
+	defer unlock()
+	states, err := a.db.DeviceStates(state.UDID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get blueprint states of %s", state.UDID)
+	}
+	var current *blueprint.DeviceState
+	kept := make(map[string]bool)
+	for i, other := range states {
+		if other.BlueprintUUID == state.BlueprintUUID {
+			current = &states[i]
+			continue
+		}
+		for _, item := range other.Items {
+			kept[string(item.Type)+":"+item.Identifier] = true
+			if item.BundleIdentifier != "" {
+				kept[string(item.Type)+":"+item.BundleIdentifier] = true
+			}
+		}
+	}
+	if current == nil {
+		// the state was removed meanwhile.
+		return nil, nil
+	}
+	state = current
+
+	var removals []blueprint.Removal
+	var remaining []blueprint.Item
+	for _, item := range state.Items {
+		if keep != nil && installs(keep, item) {
+			remaining = append(remaining, item)
+			continue
+		}
+		identifier := item.Identifier
+		if item.Type == blueprint.ItemApplication {
+			identifier = item.BundleIdentifier
+		}
+		if item.Type == blueprint.ItemAccount || identifier == "" ||
+			item.Status == blueprint.ItemFailed || item.Status == blueprint.ItemFailedPermanently {
+			continue
+		}
+		if kept[string(item.Type)+":"+item.Identifier] || kept[string(item.Type)+":"+identifier] {
+			continue
+		}
+		removals = append(removals, blueprint.Removal{
+			UDID:          state.UDID,
+			BlueprintName: state.BlueprintName,
+			Type:          item.Type,
+			Identifier:    identifier,
+			Reason:        reason,
+		})
+	}
+	if dryRun {
+		return removals, nil
+	}
+
+	ctx = command.NewContext(ctx, command.Correlation{BlueprintID: state.BlueprintUUID})
+	for _, r := range removals {
+		if _, err := a.cmdSvc.NewCommand(ctx, removeCommand(r)); err != nil {
+			return nil, errors.Wrapf(err, "queue removal of %s %s", r.Type, r.Identifier)
+		}
+	}
+	switch {
+	case keep == nil:
+		err = a.db.DeleteDeviceState(state.UDID, state.BlueprintUUID)
+	case len(remaining) != len(state.Items):
+		state.Items = remaining
+		err = a.db.SaveDeviceState(state)
+	}
+	if err != nil {
+		return removals, errors.Wrapf(err, "update blueprint %s state of %s", state.BlueprintName, state.UDID)
+	}
+	if keep == nil || len(removals) > 0 {
+		if err := publishRemoved(ctx, a.ps, state, reason, len(removals)); err != nil {
+			level.Info(a.logger).Log("msg", "record removed blueprint", "err", err)
+		}
+	}
+	return removals, nil
+}
+
+// installs reports whether the blueprint has the item.
+func installs(bp *blueprint.Blueprint, item blueprint.Item) bool {
+	switch item.Type {
+	case blueprint.ItemProfile:
+		return contains(bp.ProfileIdentifiers, item.Identifier)
+	case blueprint.ItemApplication:
+		return contains(bp.ApplicationURLs, item.Identifier)
+	default:
+		return contains(bp.UserUUID, item.Identifier)
+	}
+}
+
+func removeCommand(r blueprint.Removal) *mdm.CommandRequest {
+	req := &mdm.CommandRequest{UDID: r.UDID, Command: &mdm.Command{}}
+	if r.Type == blueprint.ItemProfile {
+		req.RequestType = "RemoveProfile"
+		req.RemoveProfile = &mdm.RemoveProfile{Identifier: r.Identifier}
+	} else {
+		req.RequestType = "RemoveApplication"
+		req.RemoveApplication = &mdm.RemoveApplication{Identifier: r.Identifier}
+	}
+	return req
+}
+
+// unapplyAtGroupLeave removes what the blueprints limited to a group installed
+// from the devices which left it and are no longer in their scope.
+func (a *Applier) unapplyAtGroupLeave(ctx context.Context, ev *group.Event) error {
+	for _, m := range ev.Removed {
+		if m.UDID == "" {
+			continue
+		}
+		states, err := a.db.DeviceStates(m.UDID)
+		if err != nil {
+			return errors.Wrapf(err, "get blueprint states of %s", m.UDID)
+		}
+		for i := range states {
+			bp, err := a.db.BlueprintByName(states[i].BlueprintName)
+			if isNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return errors.Wrapf(err, "get blueprint %s", states[i].BlueprintName)
+			}
+			if !contains(bp.Groups, ev.Group) {
+				continue
+			}
+			if err := a.unapplyOutOfScope(ctx, bp, &states[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// unapplyOutOfScope removes what the blueprint installed from the device of
+// the state if it is no longer in its scope.
+func (a *Applier) unapplyOutOfScope(ctx context.Context, bp *blueprint.Blueprint, state *blueprint.DeviceState) error {
+	if bp.UUID != state.BlueprintUUID {
+		return nil
+	}
+	inScope, err := a.inScope(ctx, bp, state.UDID)
+	if err != nil || inScope {
+		return err
+	}
+	_, err = a.unapplyState(ctx, state, nil, blueprint.OutOfScope, false)
+	return err
+}
+
+// unapplyAllOutOfScope removes what blueprints installed from every device
+// which left their scope, for example by updating its OS.
+func (a *Applier) unapplyAllOutOfScope(ctx context.Context) error {
+	states, err := a.db.ListDeviceStates()
+	if err != nil {
+		return errors.Wrap(err, "list blueprint device states")
+	}
+	bps := make(map[string]*blueprint.Blueprint)
+	for i := range states {
+		name := states[i].BlueprintName
+		bp, ok := bps[name]
+		if !ok {
+			bp, err = a.db.BlueprintByName(name)
+			if err != nil && !isNotFound(err) {
+				return errors.Wrapf(err, "get blueprint %s", name)
+			}
+			bps[name] = bp
+		}
+		if bp == nil {
+			continue
+		}
+		if err := a.unapplyOutOfScope(ctx, bp, &states[i]); err != nil {
+			level.Info(a.logger).Log("msg", "un-apply blueprint", "blueprint", name, "udid", states[i].UDID, "err", err)
+		}
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// publishRemoved adds the removal of a blueprint's items to the history of the
+// device.
+func publishRemoved(ctx context.Context, pub pubsub.Publisher, state *blueprint.DeviceState, reason blueprint.RemovalReason, removed int) error {
+	msg, err := device.MarshalHistoryEvent(device.NewHistoryEvent(device.BlueprintRemoved, state.UDID, map[string]string{
+		"blueprint":      state.BlueprintName,
+		"blueprint_uuid": state.BlueprintUUID,
+		"reason":         string(reason),
+		"removed":        strconv.Itoa(removed),
+	}))
+	if err != nil {
+		return errors.Wrap(err, "marshal blueprint history event")
+	}
+	err = pub.Publish(ctx, device.HistoryTopic, msg)
+	return errors.Wrapf(err, "publish blueprint %s removed from %s", state.BlueprintName, state.UDID)
+}
@@ -0,0 +1,156 @@
+package builtin
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/blueprint"
+	"github.com/vishnuvaradaraj/micromdm/platform/group"
+	"github.com/vishnuvaradaraj/micromdm/platform/profile"
+)
+
+func TestApplierUnapply(t *testing.T) {
+	a, cmds, _ := setupApplier(t,
+		&blueprint.Blueprint{Name: "sales", Groups: []string{"Sales"}},
+		&blueprint.Blueprint{Name: "base"},
+	)
+	db := a.db.(*DB)
+	if err := db.profDB.Save(&profile.Profile{Identifier: "com.example.wifi", Mobileconfig: []byte(wifiProfile)}); err != nil {
+		t.Fatal(err)
+	}
+	svc := blueprint.New(db, blueprint.WithUnapplier(a))
+	ctx := context.Background()
+
+	// both blueprints install the profile on the device.
+	for _, name := range []string{"sales", "base"} {
+		bp, err := db.BlueprintByName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bp.ProfileIdentifiers = []string{"com.example.wifi"}
+		if err := svc.ApplyBlueprint(ctx, bp); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := a.ApplyToDevices(ctx, bp, []string{"UDID-IPAD"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	states, err := db.DeviceStates("UDID-IPAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range states {
+		if states[i].BlueprintName == "sales" {
+			states[i].Items[0].Status = blueprint.ItemAcknowledged
+			states[i].Items[0].BundleIdentifier = "com.example.sales"
+			if err := db.SaveDeviceState(&states[i]); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// removed returns the commands queued since the previous call.
+	queued := len(cmds.queued)
+	removed := func() []string {
+		var types []string
+		for _, r := range cmds.queued[queued:] {
+			types = append(types, r.RequestType)
+		}
+		queued = len(cmds.queued)
+		return types
+	}
+
+	// the profile stays for the other blueprint, and nothing is queued.
+	removals, err := svc.PreviewRemovals(ctx, blueprint.PreviewRemovalsOption{Names: []string{"sales"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []blueprint.Removal{{UDID: "UDID-IPAD", BlueprintName: "sales", Type: blueprint.ItemApplication,
+		Identifier: "com.example.sales", Reason: blueprint.BlueprintDeleted}}
+	if !reflect.DeepEqual(removals, want) {
+		t.Errorf("have removals %+v, want %+v", removals, want)
+	}
+	if have := removed(); len(have) != 0 {
+		t.Errorf("have commands %v queued by a dry run", have)
+	}
+
+	// the application is dropped from the blueprint.
+	sales, err := db.BlueprintByName("sales")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sales.ApplicationURLs = nil
+	if err := svc.ApplyBlueprint(ctx, sales); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := removed(), []string{"RemoveApplication"}; !reflect.DeepEqual(have, want) {
+		t.Errorf("have commands %v queued for the dropped item, want %v", have, want)
+	}
+	if have, want := cmds.queued[len(cmds.queued)-1].RemoveApplication.Identifier, "com.example.sales"; have != want {
+		t.Errorf("have application %s removed, want %s", have, want)
+	}
+
+	// the device leaves the group, and the state of the blueprint is removed.
+	a.groups = fakeGroups{}
+	msg, err := group.MarshalEvent(&group.Event{Group: "Sales", Removed: []group.Member{{UDID: "UDID-IPAD"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.groupChanged(ctx, msg); err != nil {
+		t.Fatal(err)
+	}
+	if have := removed(); len(have) != 0 {
+		t.Errorf("have commands %v queued for the profile of another blueprint", have)
+	}
+	states, err = db.DeviceStates("UDID-IPAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 1 || states[0].BlueprintName != "base" {
+		t.Fatalf("have device states %+v, want base", states)
+	}
+
+	// the application of base was never acknowledged, so only the profile
+	// is removed.
+	if err := svc.RemoveBlueprints(ctx, []string{"base"}); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := removed(), []string{"RemoveProfile"}; !reflect.DeepEqual(have, want) {
+		t.Errorf("have commands %v queued for the deleted blueprint, want %v", have, want)
+	}
+	if states, err = db.DeviceStates("UDID-IPAD"); err != nil || len(states) != 0 {
+		t.Errorf("have device states %+v, %v after delete, want none", states, err)
+	}
+}
+
+func TestApplyBlueprintUUIDChange(t *testing.T) {
+	a, _, _ := setupApplier(t, &blueprint.Blueprint{Name: "sales", Groups: []string{"Sales"}})
+	db := a.db.(*DB)
+	svc := blueprint.New(db, blueprint.WithUnapplier(a))
+	ctx := context.Background()
+	bp, err := db.BlueprintByName("sales")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.ApplyToDevices(ctx, bp, []string{"UDID-IPAD"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the states of the blueprint on devices would be orphaned.
+	edited := *bp
+	edited.UUID = "other-uuid"
+	edited.Groups = nil
+	if err := svc.ApplyBlueprint(ctx, &edited); err == nil {
+		t.Fatal("have the UUID of the blueprint changed, want an error")
+	}
+	if saved, err := db.BlueprintByName("sales"); err != nil || saved.UUID != bp.UUID || len(saved.Groups) != 1 {
+		t.Errorf("have blueprint %+v (err %v), want it unchanged", saved, err)
+	}
+	states, err := db.DeviceStates("UDID-IPAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 1 || states[0].BlueprintUUID != bp.UUID {
+		t.Errorf("have states %+v, want the state of %s kept", states, bp.UUID)
+	}
+}
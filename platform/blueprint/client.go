@@ -48,9 +48,45 @@ func NewHTTPClient(instance, token string, logger log.Logger, opts ...httptransp
 		).Endpoint()
 	}
 
+	var applyToDevicesEndpoint endpoint.Endpoint
+	{
+		applyToDevicesEndpoint = httptransport.NewClient(
+			"POST",
+			httputil.CopyURL(u, "/v1/blueprints/apply"),
+			httputil.EncodeRequestWithToken(token, httptransport.EncodeJSONRequest),
+			decodeApplyToDevicesResponse,
+			opts...,
+		).Endpoint()
+	}
+
+	var getComplianceEndpoint endpoint.Endpoint
+	{
+		getComplianceEndpoint = httptransport.NewClient(
+			"GET",
+			httputil.CopyURL(u, "/v1/blueprints/compliance"),
+			httputil.EncodeRequestWithToken(token, encodeGetComplianceRequest),
+			decodeGetComplianceResponse,
+			opts...,
+		).Endpoint()
+	}
+
+	var previewRemovalsEndpoint endpoint.Endpoint
+	{
+		previewRemovalsEndpoint = httptransport.NewClient(
+			"POST",
+			httputil.CopyURL(u, "/v1/blueprints/removals"),
+			httputil.EncodeRequestWithToken(token, httptransport.EncodeJSONRequest),
+			decodePreviewRemovalsResponse,
+			opts...,
+		).Endpoint()
+	}
+
 	return Endpoints{
 		ApplyBlueprintEndpoint:   applyBlueprintEndpoint,
 		GetBlueprintsEndpoint:    getBlueprintsEndpoint,
 		RemoveBlueprintsEndpoint: removeBlueprintsEndpoint,
+		ApplyToDevicesEndpoint:   applyToDevicesEndpoint,
+		GetComplianceEndpoint:    getComplianceEndpoint,
+		PreviewRemovalsEndpoint:  previewRemovalsEndpoint,
 	}, nil
 }
@@ -0,0 +1,156 @@
+package blueprint
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// ItemType is the kind of blueprint payload which an Item tracks.
+type ItemType string
+
+const (
+	ItemProfile     ItemType = "profile"
+	ItemApplication ItemType = "application"
+	ItemAccount     ItemType = "account"
+)
+
+// ItemStatus is the outcome of the command which installs an Item.
+type ItemStatus string
+
+const (
+	// ItemQueued and ItemNotNow are waiting for the device.
+	ItemQueued ItemStatus = "queued"
+	ItemNotNow ItemStatus = "not_now"
+	// ItemAcknowledged is installed according to the command response, and
+	// ItemInstalled according to the last ProfileList or
+	// ManagedApplicationList response of the device.
+	ItemAcknowledged ItemStatus = "acknowledged"
+	ItemInstalled    ItemStatus = "installed"
+	// ItemFailed was answered with an error, and ItemMissing was installed
+	// but is no longer on the device. Both are queued again by the next
+	// compliance check.
+	ItemFailed  ItemStatus = "failed"
+	ItemMissing ItemStatus = "missing"
+	// ItemFailedPermanently failed or went missing again after it was queued
+	// again as often as allowed, and is not queued again until the blueprint
+	// is applied again.
+	ItemFailedPermanently ItemStatus = "failed_permanently"
+)
+
+// Item is a profile, application or account of a blueprint, and the command
+// which installs it on a device.
+type Item struct {
+	Type ItemType `json:"type"`
+	// Identifier is the PayloadIdentifier of a profile, the manifest URL of
+	// an application or the UUID of an account user.
+	Identifier string `json:"identifier"`
+	// BundleIdentifier is the bundle identifier of an application, known
+	// once the device acknowledged its installation.
+	BundleIdentifier string     `json:"bundle_identifier,omitempty"`
+	CommandUUID      string     `json:"command_uuid"`
+	Status           ItemStatus `json:"status"`
+	// Error describes the error the device answered the command with.
+	Error     string    `json:"error,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Requeued counts how often the command was queued again to remediate
+	// drift.
+	Requeued int `json:"requeued,omitempty"`
+}
+
+// Compliance summarizes the status of the items of a DeviceState.
+type Compliance string
+
+const (
+	// Compliant devices have every item of the blueprint installed.
+	Compliant Compliance = "compliant"
+	// Pending devices have not answered the command for an item yet.
+	Pending Compliance = "pending"
+	// NonCompliant devices have an item which failed or went missing.
+	NonCompliant Compliance = "non_compliant"
+)
+
+// DeviceState is the state of a blueprint on a device. It tracks the command
+// of each item from when the blueprint was last applied.
+type DeviceState struct {
+	UDID          string    `json:"udid"`
+	BlueprintUUID string    `json:"blueprint_uuid"`
+	BlueprintName string    `json:"blueprint_name"`
+	AppliedAt     time.Time `json:"applied_at"`
+	// CheckedAt is when the installed profiles or applications of the device
+	// were last compared with the items.
+	CheckedAt time.Time `json:"checked_at,omitempty"`
+	Items     []Item    `json:"items"`
+	// Status is filled in by the service from the items.
+	Status Compliance `json:"status,omitempty"`
+}
+
+// Compliance returns the status of the items. An account can only be
+// verified by the response to its command.
+func (s *DeviceState) Compliance() Compliance {
+	status := Compliant
+	for _, item := range s.Items {
+		switch item.Status {
+		case ItemFailed, ItemMissing, ItemFailedPermanently:
+			return NonCompliant
+		case ItemQueued, ItemNotNow:
+			status = Pending
+		}
+	}
+	return status
+}
+
+// ItemByCommandUUID returns the item which the command installs, or nil.
+func (s *DeviceState) ItemByCommandUUID(uuid string) *Item {
+	for i := range s.Items {
+		if s.Items[i].CommandUUID == uuid {
+			return &s.Items[i]
+		}
+	}
+	return nil
+}
+
+func MarshalDeviceState(s *DeviceState) ([]byte, error) {
+	return json.Marshal(s)
+}
+
+func UnmarshalDeviceState(data []byte, s *DeviceState) error {
+	return json.Unmarshal(data, s)
+}
+
+// BlueprintCompliance counts the devices of a blueprint by status.
+type BlueprintCompliance struct {
+	BlueprintName string `json:"blueprint_name"`
+	Compliant     int    `json:"compliant"`
+	Pending       int    `json:"pending"`
+	NonCompliant  int    `json:"non_compliant"`
+}
+
+// Summarize counts the states by blueprint, ordered by name.
+func Summarize(states []DeviceState) []BlueprintCompliance {
+	byName := make(map[string]*BlueprintCompliance)
+	var names []string
+	for i := range states {
+		name := states[i].BlueprintName
+		c, ok := byName[name]
+		if !ok {
+			c = &BlueprintCompliance{BlueprintName: name}
+			byName[name] = c
+			names = append(names, name)
+		}
+		switch states[i].Compliance() {
+		case Compliant:
+			c.Compliant++
+		case Pending:
+			c.Pending++
+		case NonCompliant:
+			c.NonCompliant++
+		}
+	}
+	sort.Strings(names)
+	summary := []BlueprintCompliance{}
+	for _, name := range names {
+		summary = append(summary, *byName[name])
+	}
+	return summary
+}
@@ -0,0 +1,105 @@
+package blueprint
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+
+	"github.com/vishnuvaradaraj/micromdm/pkg/httputil"
+)
+
+type GetComplianceOption struct {
+	UDID string `json:"udid,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+// ComplianceReport is the state of blueprints on devices, and the number of
+// devices of each blueprint by status.
+type ComplianceReport struct {
+	Devices    []DeviceState         `json:"devices"`
+	Blueprints []BlueprintCompliance `json:"blueprints"`
+}
+
+func (svc *BlueprintService) GetCompliance(ctx context.Context, opt GetComplianceOption) (*ComplianceReport, error) {
+	var states []DeviceState
+	var err error
+	if opt.UDID != "" {
+		states, err = svc.store.DeviceStates(opt.UDID)
+	} else {
+		states, err = svc.store.ListDeviceStates()
+	}
+	if err != nil {
+		return nil, err
+	}
+	filtered := []DeviceState{}
+	for _, s := range states {
+		if opt.Name != "" && s.BlueprintName != opt.Name {
+			continue
+		}
+		s.Status = s.Compliance()
+		filtered = append(filtered, s)
+	}
+	return &ComplianceReport{
+		Devices:    filtered,
+		Blueprints: Summarize(filtered),
+	}, nil
+}
+
+type getComplianceRequest struct {
+	Opts GetComplianceOption
+}
+
+type getComplianceResponse struct {
+	*ComplianceReport
+	Err error `json:"err,omitempty"`
+}
+
+func (r getComplianceResponse) Failed() error { return r.Err }
+
+// decodeGetComplianceRequest decodes the options from the udid and name query
+// parameters.
+func decodeGetComplianceRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	q := r.URL.Query()
+	opts := GetComplianceOption{
+		UDID: q.Get("udid"),
+		Name: q.Get("name"),
+	}
+	return getComplianceRequest{Opts: opts}, nil
+}
+
+func encodeGetComplianceRequest(_ context.Context, r *http.Request, request interface{}) error {
+	req := request.(getComplianceRequest)
+	q := r.URL.Query()
+	if req.Opts.UDID != "" {
+		q.Set("udid", req.Opts.UDID)
+	}
+	if req.Opts.Name != "" {
+		q.Set("name", req.Opts.Name)
+	}
+	r.URL.RawQuery = q.Encode()
+	return nil
+}
+
+func decodeGetComplianceResponse(_ context.Context, r *http.Response) (interface{}, error) {
+	var resp getComplianceResponse
+	err := httputil.DecodeJSONResponse(r, &resp)
+	return resp, err
+}
+
+func MakeGetComplianceEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getComplianceRequest)
+		report, err := svc.GetCompliance(ctx, req.Opts)
+		return getComplianceResponse{ComplianceReport: report, Err: err}, nil
+	}
+}
+
+func (e Endpoints) GetCompliance(ctx context.Context, opt GetComplianceOption) (*ComplianceReport, error) {
+	response, err := e.GetComplianceEndpoint(ctx, getComplianceRequest{Opts: opt})
+	if err != nil {
+		return nil, err
+	}
+	resp := response.(getComplianceResponse)
+	return resp.ComplianceReport, resp.Err
+}
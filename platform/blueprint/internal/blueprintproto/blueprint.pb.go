@@ -36,6 +36,13 @@ type Blueprint struct {
 	UserUuid                            []string `protobuf:"bytes,7,rep,name=user_uuid,json=userUuid" json:"user_uuid,omitempty"`
 	SkipPrimarySetupAccountCreation     bool     `protobuf:"varint,8,opt,name=skip_primary_setup_account_creation,json=skipPrimarySetupAccountCreation" json:"skip_primary_setup_account_creation,omitempty"`
 	SetPrimarySetupAccountAsRegularUser bool     `protobuf:"varint,9,opt,name=set_primary_setup_account_as_regular_user,json=setPrimarySetupAccountAsRegularUser" json:"set_primary_setup_account_as_regular_user,omitempty"`
+	Groups                              []string `protobuf:"bytes,10,rep,name=groups" json:"groups,omitempty"`
+	DepProfileUuids                     []string `protobuf:"bytes,11,rep,name=dep_profile_uuids,json=depProfileUuids" json:"dep_profile_uuids,omitempty"`
+	Models                              []string `protobuf:"bytes,12,rep,name=models" json:"models,omitempty"`
+	SerialNumbers                       []string `protobuf:"bytes,13,rep,name=serial_numbers,json=serialNumbers" json:"serial_numbers,omitempty"`
+	Priority                            int64    `protobuf:"varint,14,opt,name=priority" json:"priority,omitempty"`
+	OsVersions                          []string `protobuf:"bytes,15,rep,name=os_versions,json=osVersions" json:"os_versions,omitempty"`
+	SetupOptional                       bool     `protobuf:"varint,16,opt,name=setup_optional,json=setupOptional" json:"setup_optional,omitempty"`
 }
 
 func (m *Blueprint) Reset()                    { *m = Blueprint{} }
@@ -99,6 +106,55 @@ func (m *Blueprint) GetSetPrimarySetupAccountAsRegularUser() bool {
 	return false
 }
 
+func (m *Blueprint) GetGroups() []string {
+	if m != nil {
+		return m.Groups
+	}
+	return nil
+}
+
+func (m *Blueprint) GetDepProfileUuids() []string {
+	if m != nil {
+		return m.DepProfileUuids
+	}
+	return nil
+}
+
+func (m *Blueprint) GetModels() []string {
+	if m != nil {
+		return m.Models
+	}
+	return nil
+}
+
+func (m *Blueprint) GetSerialNumbers() []string {
+	if m != nil {
+		return m.SerialNumbers
+	}
+	return nil
+}
+
+func (m *Blueprint) GetPriority() int64 {
+	if m != nil {
+		return m.Priority
+	}
+	return 0
+}
+
+func (m *Blueprint) GetOsVersions() []string {
+	if m != nil {
+		return m.OsVersions
+	}
+	return nil
+}
+
+func (m *Blueprint) GetSetupOptional() bool {
+	if m != nil {
+		return m.SetupOptional
+	}
+	return false
+}
+
 func init() {
 	proto.RegisterType((*Blueprint)(nil), "blueprintproto.Blueprint")
 }
@@ -106,23 +162,30 @@ func init() {
 func init() { proto.RegisterFile("blueprint.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 282 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x74, 0x90, 0xbd, 0x4e, 0x2b, 0x31,
-	0x10, 0x85, 0x95, 0xff, 0x5d, 0xdf, 0x1b, 0x40, 0xae, 0x8c, 0x28, 0x12, 0x91, 0x26, 0x34, 0x34,
-	0x3c, 0x41, 0xa0, 0x02, 0x51, 0xa0, 0x45, 0xa1, 0xb5, 0xbc, 0xbb, 0xb3, 0x91, 0x85, 0xd7, 0xb6,
-	0x66, 0xec, 0x22, 0xef, 0xcc, 0x43, 0x20, 0x7b, 0x13, 0x2a, 0xe8, 0x66, 0xbe, 0xf9, 0x74, 0x7c,
-	0x64, 0x76, 0x59, 0x9b, 0x08, 0x1e, 0xb5, 0x0d, 0xf7, 0x1e, 0x5d, 0x70, 0xfc, 0xe2, 0x07, 0xe4,
-	0xfd, 0xf6, 0x6b, 0xcc, 0xca, 0xc7, 0x33, 0xe2, 0x9c, 0x4d, 0x63, 0xd4, 0xad, 0x18, 0xad, 0x47,
-	0xdb, 0xb2, 0xca, 0x73, 0x62, 0x56, 0xf5, 0x20, 0xc6, 0x03, 0x4b, 0x33, 0xdf, 0xb0, 0x65, 0xaf,
-	0xac, 0xee, 0x80, 0x82, 0x8c, 0x68, 0x48, 0x4c, 0xd6, 0x93, 0x6d, 0x59, 0xfd, 0x3f, 0xc3, 0x3d,
-	0x1a, 0xe2, 0x2b, 0xf6, 0xcf, 0xa3, 0xeb, 0xb4, 0x01, 0xa9, 0x5b, 0x12, 0xb3, 0xac, 0xb0, 0x13,
-	0x7a, 0x6e, 0x89, 0x5f, 0xb3, 0x42, 0x79, 0x6f, 0x8e, 0x52, 0x05, 0x31, 0xcf, 0xd7, 0x45, 0xde,
-	0x77, 0x81, 0xdf, 0xb0, 0x32, 0x12, 0xa0, 0xcc, 0x6d, 0x16, 0xf9, 0x56, 0x24, 0xb0, 0x4f, 0x8d,
-	0x5e, 0xd9, 0x86, 0x3e, 0xb5, 0x97, 0x1e, 0x75, 0xaf, 0xf0, 0x28, 0x09, 0x42, 0xf4, 0x52, 0x35,
-	0x8d, 0x8b, 0x36, 0xc8, 0x06, 0x41, 0x05, 0xed, 0xac, 0x28, 0xd6, 0xa3, 0x6d, 0x51, 0xad, 0x92,
-	0xfa, 0x36, 0x98, 0xef, 0x49, 0xdc, 0x0d, 0xde, 0xd3, 0x49, 0xe3, 0x1f, 0xec, 0x8e, 0x20, 0xfc,
-	0x11, 0xa6, 0x48, 0x22, 0x1c, 0xa2, 0x51, 0x28, 0xd3, 0xf3, 0xa2, 0xcc, 0x99, 0x1b, 0x82, 0xf0,
-	0x4b, 0xe4, 0x8e, 0xaa, 0xc1, 0xdd, 0x13, 0xe0, 0xcb, 0xb4, 0x98, 0x5e, 0xcd, 0xaa, 0x65, 0xef,
-	0x6a, 0x6d, 0xa0, 0x71, 0xb6, 0xd3, 0x07, 0xaa, 0xe7, 0xf9, 0xd7, 0x1f, 0xbe, 0x03, 0x00, 0x00,
-	0xff, 0xff, 0x22, 0x48, 0x96, 0x88, 0x98, 0x01, 0x00, 0x00,
+	// 396 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x74, 0x92, 0xc1, 0x6e, 0x13, 0x31,
+	0x10, 0x86, 0x15, 0x92, 0xa6, 0xbb, 0x6e, 0x37, 0x29, 0x3e, 0x20, 0x03, 0x87, 0x46, 0x44, 0x48,
+	0x81, 0x03, 0x17, 0x9e, 0x20, 0x70, 0x02, 0x21, 0xa8, 0x16, 0xa5, 0x57, 0xcb, 0xbb, 0x3b, 0x89,
+	0x2c, 0xbc, 0xb6, 0x35, 0x63, 0x23, 0xe5, 0x39, 0x79, 0x21, 0x64, 0x7b, 0x9b, 0x13, 0xdc, 0xfc,
+	0x7f, 0xf3, 0xeb, 0xf7, 0xcc, 0xd8, 0x6c, 0xdd, 0x99, 0x08, 0x1e, 0xb5, 0x0d, 0x1f, 0x3c, 0xba,
+	0xe0, 0xf8, 0xea, 0x02, 0xb2, 0x7e, 0xf3, 0x67, 0xc1, 0xea, 0x4f, 0x4f, 0x88, 0x73, 0xb6, 0x88,
+	0x51, 0x0f, 0x62, 0xb6, 0x99, 0xed, 0xea, 0x36, 0x9f, 0x13, 0xb3, 0x6a, 0x04, 0xf1, 0xac, 0xb0,
+	0x74, 0xe6, 0x5b, 0xd6, 0x8c, 0xca, 0xea, 0x23, 0x50, 0x90, 0x11, 0x0d, 0x89, 0xf9, 0x66, 0xbe,
+	0xab, 0xdb, 0xdb, 0x27, 0x78, 0x40, 0x43, 0xfc, 0x9e, 0xdd, 0x78, 0x74, 0x47, 0x6d, 0x40, 0xea,
+	0x81, 0xc4, 0x55, 0xb6, 0xb0, 0x09, 0x7d, 0x19, 0x88, 0xbf, 0x64, 0x95, 0xf2, 0xde, 0x9c, 0xa5,
+	0x0a, 0x62, 0x99, 0xab, 0xd7, 0x59, 0xef, 0x03, 0x7f, 0xcd, 0xea, 0x48, 0x80, 0x32, 0x77, 0x73,
+	0x9d, 0x6b, 0x55, 0x02, 0x87, 0xd4, 0xd1, 0x37, 0xb6, 0xa5, 0x5f, 0xda, 0x4b, 0x8f, 0x7a, 0x54,
+	0x78, 0x96, 0x04, 0x21, 0x7a, 0xa9, 0xfa, 0xde, 0x45, 0x1b, 0x64, 0x8f, 0xa0, 0x82, 0x76, 0x56,
+	0x54, 0x9b, 0xd9, 0xae, 0x6a, 0xef, 0x93, 0xf5, 0xa1, 0x38, 0x7f, 0x26, 0xe3, 0xbe, 0xf8, 0x3e,
+	0x4f, 0x36, 0xfe, 0xc8, 0xde, 0x11, 0x84, 0xff, 0x84, 0x29, 0x92, 0x08, 0xa7, 0x68, 0x14, 0xca,
+	0x74, 0xbd, 0xa8, 0x73, 0xe6, 0x96, 0x20, 0xfc, 0x23, 0x72, 0x4f, 0x6d, 0xf1, 0x1e, 0x08, 0x90,
+	0xbf, 0x60, 0xcb, 0x13, 0xba, 0xe8, 0x49, 0xb0, 0xdc, 0xff, 0xa4, 0xf8, 0x7b, 0xf6, 0x7c, 0x00,
+	0x2f, 0xa7, 0x3d, 0xe4, 0x09, 0x49, 0xdc, 0x64, 0xcb, 0x7a, 0x00, 0xff, 0x50, 0x78, 0x1a, 0x94,
+	0x52, 0xc6, 0xe8, 0x06, 0x30, 0x24, 0x6e, 0x4b, 0x46, 0x51, 0xfc, 0x2d, 0x5b, 0x11, 0xa0, 0x56,
+	0x46, 0xda, 0x38, 0x76, 0x80, 0x24, 0x9a, 0x5c, 0x6f, 0x0a, 0xfd, 0x5e, 0x20, 0x7f, 0xc5, 0x2a,
+	0x8f, 0xda, 0xa1, 0x0e, 0x67, 0xb1, 0xda, 0xcc, 0x76, 0xf3, 0xf6, 0xa2, 0xd3, 0xeb, 0x38, 0x92,
+	0xbf, 0x01, 0x49, 0x3b, 0x4b, 0x62, 0x5d, 0x5e, 0xc7, 0xd1, 0xe3, 0x44, 0xca, 0x1d, 0x69, 0x17,
+	0xce, 0xa7, 0x3d, 0x29, 0x23, 0xee, 0xf2, 0xf0, 0x4d, 0xa6, 0x3f, 0x26, 0xf8, 0x75, 0x51, 0x2d,
+	0xee, 0xae, 0xda, 0x66, 0x74, 0x9d, 0x36, 0xd0, 0x3b, 0x7b, 0xd4, 0x27, 0xea, 0x96, 0xf9, 0x73,
+	0x7d, 0xfc, 0x3b, 0x00, 0x61, 0x46, 0xf4, 0xc5, 0x7f, 0x02, 0x00, 0x00,
 }
@@ -0,0 +1,115 @@
+package blueprint
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/pkg/httputil"
+)
+
+// RemovalReason is why a profile or application is removed from a device.
+type RemovalReason string
+
+const (
+	// BlueprintDeleted removes what a deleted blueprint installed.
+	BlueprintDeleted RemovalReason = "blueprint_deleted"
+	// ItemDropped removes the items an edited blueprint no longer has.
+	ItemDropped RemovalReason = "item_dropped"
+	// OutOfScope removes what a blueprint installed on a device which is no
+	// longer in its scope.
+	OutOfScope RemovalReason = "out_of_scope"
+)
+
+// Removal is a profile or application which un-applying a blueprint removes
+// from a device with a RemoveProfile or RemoveApplication command. The
+// Identifier of an application is its bundle identifier.
+type Removal struct {
+	UDID          string        `json:"udid"`
+	BlueprintName string        `json:"blueprint_name"`
+	Type          ItemType      `json:"type"`
+	Identifier    string        `json:"identifier"`
+	Reason        RemovalReason `json:"reason"`
+}
+
+// PreviewRemovalsOption is either the names of blueprints to remove, or an
+// edited blueprint to apply.
+type PreviewRemovalsOption struct {
+	Names     []string   `json:"names,omitempty"`
+	Blueprint *Blueprint `json:"blueprint,omitempty"`
+}
+
+// PreviewRemovals returns what removing or editing the blueprints would remove
+// from devices, without queueing any commands.
+func (svc *BlueprintService) PreviewRemovals(ctx context.Context, opt PreviewRemovalsOption) ([]Removal, error) {
+	if svc.unapplier == nil {
+		return nil, errors.New("blueprint: un-applying blueprints is not enabled")
+	}
+	removals := []Removal{}
+	for _, name := range opt.Names {
+		bp, err := svc.store.BlueprintByName(name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "get blueprint %s", name)
+		}
+		r, err := svc.unapplier.Unapply(ctx, bp, nil, true)
+		if err != nil {
+			return nil, err
+		}
+		removals = append(removals, r...)
+	}
+	if opt.Blueprint != nil {
+		prev, err := svc.previous(opt.Blueprint)
+		if err != nil || prev == nil {
+			return removals, err
+		}
+		r, err := svc.unapplier.Unapply(ctx, prev, opt.Blueprint, true)
+		if err != nil {
+			return nil, err
+		}
+		removals = append(removals, r...)
+	}
+	return removals, nil
+}
+
+type previewRemovalsRequest struct {
+	PreviewRemovalsOption
+}
+
+type previewRemovalsResponse struct {
+	Removals []Removal `json:"removals"`
+	Err      error     `json:"err,omitempty"`
+}
+
+func (r previewRemovalsResponse) Failed() error { return r.Err }
+
+func decodePreviewRemovalsRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	var req previewRemovalsRequest
+	err := httputil.DecodeJSONRequest(r, &req)
+	return req, err
+}
+
+func decodePreviewRemovalsResponse(_ context.Context, r *http.Response) (interface{}, error) {
+	var resp previewRemovalsResponse
+	err := httputil.DecodeJSONResponse(r, &resp)
+	return resp, err
+}
+
+func MakePreviewRemovalsEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(previewRemovalsRequest)
+		removals, err := svc.PreviewRemovals(ctx, req.PreviewRemovalsOption)
+		return previewRemovalsResponse{Removals: removals, Err: err}, nil
+	}
+}
+
+func (e Endpoints) PreviewRemovals(ctx context.Context, opt PreviewRemovalsOption) ([]Removal, error) {
+	request := previewRemovalsRequest{PreviewRemovalsOption: opt}
+	resp, err := e.PreviewRemovalsEndpoint(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	response := resp.(previewRemovalsResponse)
+	return response.Removals, response.Err
+}
@@ -5,11 +5,24 @@ import (
 	"net/http"
 
 	"github.com/go-kit/kit/endpoint"
+	"github.com/pkg/errors"
+
 	"github.com/vishnuvaradaraj/micromdm/pkg/httputil"
 )
 
+// RemoveBlueprints deletes blueprints, after removing what they installed from
+// devices.
 func (svc *BlueprintService) RemoveBlueprints(ctx context.Context, names []string) error {
 	for _, name := range names {
+		if svc.unapplier != nil {
+			bp, err := svc.store.BlueprintByName(name)
+			if err != nil {
+				return errors.Wrapf(err, "get blueprint %s", name)
+			}
+			if _, err := svc.unapplier.Unapply(ctx, bp, nil, false); err != nil {
+				return errors.Wrapf(err, "un-apply blueprint %s", name)
+			}
+		}
 		err := svc.store.Delete(name)
 		if err != nil {
 			return err
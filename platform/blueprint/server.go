@@ -11,6 +11,9 @@ type Endpoints struct {
 	ApplyBlueprintEndpoint   endpoint.Endpoint
 	GetBlueprintsEndpoint    endpoint.Endpoint
 	RemoveBlueprintsEndpoint endpoint.Endpoint
+	ApplyToDevicesEndpoint   endpoint.Endpoint
+	GetComplianceEndpoint    endpoint.Endpoint
+	PreviewRemovalsEndpoint  endpoint.Endpoint
 }
 
 func MakeServerEndpoints(s Service, outer endpoint.Middleware, others ...endpoint.Middleware) Endpoints {
@@ -18,6 +21,9 @@ func MakeServerEndpoints(s Service, outer endpoint.Middleware, others ...endpoin
 		GetBlueprintsEndpoint:    endpoint.Chain(outer, others...)(MakeGetBlueprintsEndpoint(s)),
 		ApplyBlueprintEndpoint:   endpoint.Chain(outer, others...)(MakeApplyBlueprintEndpoint(s)),
 		RemoveBlueprintsEndpoint: endpoint.Chain(outer, others...)(MakeRemoveBlueprintsEndpoint(s)),
+		ApplyToDevicesEndpoint:   endpoint.Chain(outer, others...)(MakeApplyToDevicesEndpoint(s)),
+		GetComplianceEndpoint:    endpoint.Chain(outer, others...)(MakeGetComplianceEndpoint(s)),
+		PreviewRemovalsEndpoint:  endpoint.Chain(outer, others...)(MakePreviewRemovalsEndpoint(s)),
 	}
 }
 
@@ -25,6 +31,9 @@ func RegisterHTTPHandlers(r *mux.Router, e Endpoints, options ...httptransport.S
 	// PUT     /v1/blueprints			create or replace a blueprint on the server
 	// GET     /v1/blueprints			get a list of blueprints managed by the server
 	// DELETE  /v1/blueprints			remove one or more blueprints from the server
+	// POST    /v1/blueprints/apply		apply a blueprint to devices now
+	// GET     /v1/blueprints/compliance	get the state of blueprints on devices
+	// POST    /v1/blueprints/removals	preview what removing or editing blueprints removes from devices
 
 	r.Methods("PUT").Path("/v1/blueprints").Handler(httptransport.NewServer(
 		e.ApplyBlueprintEndpoint,
@@ -46,4 +55,25 @@ func RegisterHTTPHandlers(r *mux.Router, e Endpoints, options ...httptransport.S
 		httputil.EncodeJSONResponse,
 		options...,
 	))
+
+	r.Methods("POST").Path("/v1/blueprints/apply").Handler(httptransport.NewServer(
+		e.ApplyToDevicesEndpoint,
+		decodeApplyToDevicesRequest,
+		httputil.EncodeJSONResponse,
+		options...,
+	))
+
+	r.Methods("GET").Path("/v1/blueprints/compliance").Handler(httptransport.NewServer(
+		e.GetComplianceEndpoint,
+		decodeGetComplianceRequest,
+		httputil.EncodeJSONResponse,
+		options...,
+	))
+
+	r.Methods("POST").Path("/v1/blueprints/removals").Handler(httptransport.NewServer(
+		e.PreviewRemovalsEndpoint,
+		decodePreviewRemovalsRequest,
+		httputil.EncodeJSONResponse,
+		options...,
+	))
 }
@@ -2,6 +2,8 @@ package blueprint
 
 import (
 	"context"
+
+	"github.com/pkg/errors"
 )
 
 type GetBlueprintsOption struct {
@@ -12,6 +14,9 @@ type Service interface {
 	ApplyBlueprint(ctx context.Context, bp *Blueprint) error
 	GetBlueprints(ctx context.Context, opt GetBlueprintsOption) ([]Blueprint, error)
 	RemoveBlueprints(ctx context.Context, names []string) error
+	ApplyToDevices(ctx context.Context, name string, udids []string) ([]string, error)
+	GetCompliance(ctx context.Context, opt GetComplianceOption) (*ComplianceReport, error)
+	PreviewRemovals(ctx context.Context, opt PreviewRemovalsOption) ([]Removal, error)
 }
 
 type Store interface {
@@ -19,12 +24,83 @@ type Store interface {
 	BlueprintByName(name string) (*Blueprint, error)
 	List() ([]Blueprint, error)
 	Delete(string) error
+	ComplianceStore
+}
+
+// ComplianceStore keeps the state of blueprints on devices, one per device and
+// blueprint.
+type ComplianceStore interface {
+	// SaveDeviceState creates or replaces the state of a blueprint on a
+	// device.
+	SaveDeviceState(*DeviceState) error
+	// DeviceStates returns the states of the blueprints applied to a device.
+	DeviceStates(udid string) ([]DeviceState, error)
+	// ListDeviceStates returns the states of every device.
+	ListDeviceStates() ([]DeviceState, error)
+	// DeleteDeviceStates removes the states of a device.
+	DeleteDeviceStates(udid string) error
+	// DeleteDeviceState removes the state of a blueprint on a device.
+	DeleteDeviceState(udid, blueprintUUID string) error
+}
+
+// Groups reports whether devices are in the groups which blueprints are
+// limited to.
+type Groups interface {
+	IsMember(ctx context.Context, group, udid string) (bool, error)
+}
+
+// Applier applies blueprints to the devices in their scope on demand.
+type Applier interface {
+	// ApplyToDevices applies the blueprint to the devices with the UDIDs
+	// which are in its scope, or to every enrolled device in its scope if
+	// there are no UDIDs, and returns the UDIDs it was applied to.
+	ApplyToDevices(ctx context.Context, bp *Blueprint, udids []string) ([]string, error)
+}
+
+// Unapplier removes the profiles and applications which blueprints installed
+// from devices.
+type Unapplier interface {
+	// Unapply removes what the blueprint installed from the devices it was
+	// applied to, which next, the edited blueprint, no longer installs or
+	// has in its scope. A nil next removes everything. With dryRun the
+	// removals are only returned.
+	Unapply(ctx context.Context, bp, next *Blueprint, dryRun bool) ([]Removal, error)
 }
 
 type BlueprintService struct {
-	store Store
+	store     Store
+	applier   Applier
+	unapplier Unapplier
+}
+
+type Option func(*BlueprintService)
+
+// WithApplier enables applying blueprints on demand.
+func WithApplier(applier Applier) Option {
+	return func(svc *BlueprintService) {
+		svc.applier = applier
+	}
+}
+
+// WithUnapplier removes what blueprints installed from devices when they are
+// removed or edited.
+func WithUnapplier(unapplier Unapplier) Option {
+	return func(svc *BlueprintService) {
+		svc.unapplier = unapplier
+	}
+}
+
+func New(store Store, opts ...Option) *BlueprintService {
+	svc := &BlueprintService{store: store}
+	for _, opt := range opts {
+		opt(svc)
+	}
+	return svc
 }
 
-func New(store Store) *BlueprintService {
-	return &BlueprintService{store: store}
+// IsNotFound reports whether err is caused by a blueprint which does not
+// exist.
+func IsNotFound(err error) bool {
+	e, ok := errors.Cause(err).(interface{ NotFound() bool })
+	return ok && e.NotFound()
 }
@@ -0,0 +1,53 @@
+package command
+
+import (
+	"encoding/json"
+
+	"golang.org/x/net/context"
+)
+
+// CorrelationTopic is a PubSub topic that correlation events are published to.
+// An event is only published for commands created with a Correlation in the context.
+const CorrelationTopic = "mdm.CommandCorrelation"
+
+// Correlation identifies the batch or blueprint which caused a command to be created.
+type Correlation struct {
+	BatchID     string `json:"batch_id,omitempty"`
+	BlueprintID string `json:"blueprint_id,omitempty"`
+}
+
+func (c Correlation) empty() bool {
+	return c.BatchID == "" && c.BlueprintID == ""
+}
+
+// CorrelationEvent associates a queued command with its Correlation.
+type CorrelationEvent struct {
+	CommandUUID string      `json:"command_uuid"`
+	DeviceUDID  string      `json:"udid"`
+	RequestType string      `json:"request_type"`
+	Correlation Correlation `json:"correlation"`
+}
+
+type correlationKey struct{}
+
+// NewContext returns a context which carries the Correlation. Commands created
+// with the returned context publish a CorrelationEvent.
+func NewContext(ctx context.Context, c Correlation) context.Context {
+	return context.WithValue(ctx, correlationKey{}, c)
+}
+
+// CorrelationFromContext returns the Correlation stored in the context, if any.
+func CorrelationFromContext(ctx context.Context) (Correlation, bool) {
+	c, ok := ctx.Value(correlationKey{}).(Correlation)
+	return c, ok && !c.empty()
+}
+
+// MarshalCorrelationEvent serializes a correlation event.
+func MarshalCorrelationEvent(e *CorrelationEvent) ([]byte, error) {
+	return json.Marshal(e)
+}
+
+// UnmarshalCorrelationEvent parses a serialized correlation event.
+func UnmarshalCorrelationEvent(data []byte, e *CorrelationEvent) error {
+	return json.Unmarshal(data, e)
+}
@@ -1,6 +1,7 @@
 package command
 
 import (
+	"encoding/json"
 	"net/http"
 
 	"github.com/go-kit/kit/endpoint"
@@ -32,11 +33,52 @@ func (svc *CommandService) NewCommand(ctx context.Context, request *mdm.CommandR
 	if err := svc.publisher.Publish(context.TODO(), CommandTopic, msg); err != nil {
 		return nil, errors.Wrapf(err, "publish mdm command on topic: %s", CommandTopic)
 	}
+	if c, ok := CorrelationFromContext(ctx); ok {
+		if err := svc.publishCorrelation(payload, request.UDID, c); err != nil {
+			return nil, err
+		}
+	}
 	return payload, nil
 }
 
+func (svc *CommandService) publishCorrelation(payload *mdm.CommandPayload, udid string, c Correlation) error {
+	msg, err := MarshalCorrelationEvent(&CorrelationEvent{
+		CommandUUID: payload.CommandUUID,
+		DeviceUDID:  udid,
+		RequestType: payload.Command.RequestType,
+		Correlation: c,
+	})
+	if err != nil {
+		return errors.Wrap(err, "marshalling command correlation event")
+	}
+	if err := svc.publisher.Publish(context.TODO(), CorrelationTopic, msg); err != nil {
+		return errors.Wrapf(err, "publish command correlation on topic: %s", CorrelationTopic)
+	}
+	return nil
+}
+
 type newCommandRequest struct {
 	mdm.CommandRequest
+
+	// BatchID is an optional caller supplied ID which is included in
+	// enriched webhook events for the command.
+	BatchID string `json:"batch_id,omitempty"`
+}
+
+// UnmarshalJSON decodes the optional batch_id alongside the embedded
+// CommandRequest, which has its own UnmarshalJSON method.
+func (r *newCommandRequest) UnmarshalJSON(data []byte) error {
+	if err := r.CommandRequest.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	var batch struct {
+		BatchID string `json:"batch_id"`
+	}
+	if err := json.Unmarshal(data, &batch); err != nil {
+		return err
+	}
+	r.BatchID = batch.BatchID
+	return nil
 }
 
 type newCommandResponse struct {
@@ -62,6 +104,9 @@ func MakeNewCommandEndpoint(svc Service) endpoint.Endpoint {
 		if req.UDID == "" || req.RequestType == "" {
 			return newCommandResponse{Err: errEmptyRequest}, nil
 		}
+		if req.BatchID != "" {
+			ctx = NewContext(ctx, Correlation{BatchID: req.BatchID})
+		}
 		payload, err := svc.NewCommand(ctx, &req.CommandRequest)
 		if err != nil {
 			return newCommandResponse{Err: err}, nil
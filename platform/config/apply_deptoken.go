@@ -16,7 +16,7 @@ import (
 	"github.com/vishnuvaradaraj/micromdm/pkg/httputil"
 )
 
-func (svc *ConfigService) ApplyDEPToken(ctx context.Context, P7MContent []byte) error {
+func (svc *ConfigService) ApplyDEPToken(ctx context.Context, P7MContent []byte, name string) error {
 	unwrapped, err := unwrapSMIME(P7MContent)
 	if err != nil {
 		return err
@@ -42,16 +42,29 @@ func (svc *ConfigService) ApplyDEPToken(ctx context.Context, P7MContent []byte)
 	if err != nil {
 		return err
 	}
+	tokens, err := svc.store.DEPTokens()
+	if err != nil {
+		return err
+	}
+	depToken.Name, err = depTokenName(tokens, depToken, name)
+	if err != nil {
+		return err
+	}
+	tokenJSON, err = json.Marshal(depToken)
+	if err != nil {
+		return err
+	}
 	err = svc.store.AddToken(depToken.ConsumerKey, tokenJSON)
 	if err != nil {
 		return err
 	}
-	fmt.Println("stored DEP token with ck", depToken.ConsumerKey)
+	fmt.Println("stored DEP token", depToken.Name, "with ck", depToken.ConsumerKey)
 	return nil
 }
 
 type applyDEPTokenRequest struct {
 	P7MContent []byte `json:"p7m_content"`
+	Name       string `json:"name,omitempty"`
 }
 
 type applyDEPTokenResponse struct {
@@ -75,15 +88,15 @@ func decodeApplyDEPTokensResponse(_ context.Context, r *http.Response) (interfac
 func MakeApplyDEPTokensEndpoint(svc Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		req := request.(applyDEPTokenRequest)
-		err = svc.ApplyDEPToken(ctx, req.P7MContent)
+		err = svc.ApplyDEPToken(ctx, req.P7MContent, req.Name)
 		return applyDEPTokenResponse{
 			Err: err,
 		}, nil
 	}
 }
 
-func (e Endpoints) ApplyDEPToken(ctx context.Context, P7MContent []byte) error {
-	req := applyDEPTokenRequest{P7MContent: P7MContent}
+func (e Endpoints) ApplyDEPToken(ctx context.Context, P7MContent []byte, name string) error {
+	req := applyDEPTokenRequest{P7MContent: P7MContent, Name: name}
 	resp, err := e.ApplyDEPTokensEndpoint(ctx, req)
 	if err != nil {
 		return err
@@ -6,10 +6,12 @@ import (
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
-	"github.com/boltdb/bolt"
-	"github.com/pkg/errors"
 
 	"cloud.google.com/go/firestore"
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/vishnuvaradaraj/micromdm/pkg/crypto"
 	"github.com/vishnuvaradaraj/micromdm/platform/config"
@@ -20,51 +22,56 @@ const (
 	ConfigBucket = "mdm.ServerConfig"
 )
 
+// FireDB stores server configuration in Google Cloud Firestore.
 type FireDB struct {
 	*firestore.Client
 	Publisher pubsub.Publisher
 }
 
+type configDoc struct {
+	Data []byte `firestore:"data"`
+}
+
 func NewFireDB(db *firestore.Client, pub pubsub.Publisher) (*FireDB, error) {
 	datastore := &FireDB{Client: db, Publisher: pub}
 	return datastore, nil
 }
 
 func (db *FireDB) SavePushCertificate(cert, key []byte) error {
-
-	ctx := context.Background()
-
-	rec  := &config.ServerConfig{
+	pb, err := config.MarshalServerConfig(&config.ServerConfig{
 		PushCertificate: cert,
 		PrivateKey:      key,
-	}
-
-	_, err := db.Collection(ConfigBucket).Doc("config").Set(ctx, rec)
+	})
 	if err != nil {
-		return err
+		return errors.Wrap(err, "save push cert in firestore")
+	}
+	doc := configDoc{Data: pb}
+	if _, err := db.Collection(ConfigBucket).Doc("config").Set(context.Background(), doc); err != nil {
+		return errors.Wrap(err, "save ServerConfig in firestore")
 	}
 
 	if err := db.Publisher.Publish(context.TODO(), config.ConfigTopic, []byte("updated")); err != nil {
 		return err
 	}
-	return err
+	return nil
 }
 
 func (db *FireDB) serverConfig() (*config.ServerConfig, error) {
-	var conf config.ServerConfig
-
-	ctx := context.Background()
-
-	doc, err := db.Collection(ConfigBucket).Doc("config").Get(ctx)
-	if err != nil {
-		return nil, &notFound{"Config","Not found"}
+	snap, err := db.Collection(ConfigBucket).Doc("config").Get(context.Background())
+	if status.Code(err) == codes.NotFound {
+		err = &notFound{"ServerConfig", "no config found in firestore"}
 	}
-
-	err = doc.DataTo(&conf)
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrap(err, "get server config from firestore")
+	}
+	var doc configDoc
+	if err := snap.DataTo(&doc); err != nil {
+		return nil, errors.Wrap(err, "decode server config document")
+	}
+	var conf config.ServerConfig
+	if err := config.UnmarshalServerConfig(doc.Data, &conf); err != nil {
+		return nil, errors.Wrap(err, "get server config from firestore")
 	}
-
 	return &conf, nil
 }
 
@@ -84,35 +91,7 @@ func (db *FireDB) PushCertificate() (*tls.Certificate, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "get server config for push cert")
 	}
-
-	// load private key
-	pkeyBlock, _ := pem.Decode(conf.PrivateKey)
-	if pkeyBlock == nil {
-		return nil, errors.New("decode private key for push cert")
-	}
-
-	priv, err := x509.ParsePKCS1PrivateKey(pkeyBlock.Bytes)
-	if err != nil {
-		return nil, errors.Wrap(err, "parse push certificate key from server config")
-	}
-
-	// load certificate
-	certBlock, _ := pem.Decode(conf.PushCertificate)
-	if certBlock == nil {
-		return nil, errors.New("decode push certificate PEM")
-	}
-
-	pushCert, err := x509.ParseCertificate(certBlock.Bytes)
-	if err != nil {
-		return nil, errors.Wrap(err, "parse push certificate from server config")
-	}
-
-	cert := tls.Certificate{
-		Certificate: [][]byte{pushCert.Raw},
-		PrivateKey:  priv,
-		Leaf:        pushCert,
-	}
-	return &cert, nil
+	return pushCertificate(conf)
 }
 
 func (db *FireDB) PushTopic() (string, error) {
@@ -124,7 +103,6 @@ func (db *FireDB) PushTopic() (string, error) {
 	return topic, errors.Wrap(err, "get topic from push certificate")
 }
 
-
 ///////////////////////////////////////////////////////////////////////
 
 // DB stores server configuration in BoltDB
@@ -201,7 +179,33 @@ func (db *DB) PushCertificate() (*tls.Certificate, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "get server config for push cert")
 	}
+	return pushCertificate(conf)
+}
+
+func (db *DB) PushTopic() (string, error) {
+	cert, err := db.PushCertificate()
+	if err != nil {
+		return "", errors.Wrap(err, "get push certificate for topic")
+	}
+	topic, err := crypto.TopicFromCert(cert.Leaf)
+	return topic, errors.Wrap(err, "get topic from push certificate")
+}
 
+type notFound struct {
+	ResourceType string
+	Message      string
+}
+
+func (e *notFound) Error() string {
+	return fmt.Sprintf("not found: %s %s", e.ResourceType, e.Message)
+}
+
+func (e *notFound) NotFound() bool {
+	return true
+}
+
+// pushCertificate parses the push certificate and key in the server config.
+func pushCertificate(conf *config.ServerConfig) (*tls.Certificate, error) {
 	// load private key
 	pkeyBlock, _ := pem.Decode(conf.PrivateKey)
 	if pkeyBlock == nil {
@@ -231,21 +235,3 @@ func (db *DB) PushCertificate() (*tls.Certificate, error) {
 	}
 	return &cert, nil
 }
-
-func (db *DB) PushTopic() (string, error) {
-	cert, err := db.PushCertificate()
-	if err != nil {
-		return "", errors.Wrap(err, "get push certificate for topic")
-	}
-	topic, err := crypto.TopicFromCert(cert.Leaf)
-	return topic, errors.Wrap(err, "get topic from push certificate")
-}
-
-type notFound struct {
-	ResourceType string
-	Message      string
-}
-
-func (e *notFound) Error() string {
-	return fmt.Sprintf("not found: %s %s", e.ResourceType, e.Message)
-}
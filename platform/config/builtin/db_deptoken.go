@@ -6,95 +6,84 @@ import (
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/json"
+	"strings"
+
 	"github.com/boltdb/bolt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
 	"github.com/vishnuvaradaraj/micromdm/pkg/crypto"
 	"github.com/vishnuvaradaraj/micromdm/platform/config"
 )
 
 const (
-	depTokenBucket = "mdm.DEPToken"
+	DEPTokenBucket = "mdm.DEPToken"
 )
 
+type depTokenDoc struct {
+	Data []byte `firestore:"data"`
+}
 
-func (db *FireDB) AddToken(consumerKey string, jsonData []byte) error {
-
-	ctx := context.Background()
-
-	var depToken config.DEPToken
-	err := json.Unmarshal(jsonData, &depToken)
-	if err != nil {
-		return  err
-	}
+type depKeypairDoc struct {
+	Key         []byte `firestore:"key"`
+	Certificate []byte `firestore:"certificate"`
+}
 
-	_, err = db.Collection(depTokenBucket).Doc(consumerKey).Set(ctx, depToken)
-	if err != nil {
+func (db *FireDB) AddToken(consumerKey string, json []byte) error {
+	doc := depTokenDoc{Data: json}
+	if _, err := db.Collection(DEPTokenBucket).Doc(consumerKey).Set(context.Background(), doc); err != nil {
 		return err
 	}
-
-	if err := db.Publisher.Publish(context.TODO(), config.DEPTokenTopic, jsonData); err != nil {
+	if err := db.Publisher.Publish(context.TODO(), config.DEPTokenTopic, json); err != nil {
 		return err
 	}
-
 	return nil
 }
 
 func (db *FireDB) DEPTokens() ([]config.DEPToken, error) {
 	var result []config.DEPToken
-
-	ctx := context.Background()
-
-	prefix := []byte("CK_")
-	suffix := []byte("CK`")
-
-	q := db.Collection(depTokenBucket).Where("ConsumerKey", ">=", prefix).Where("ConsumerKey", "<", suffix)
-	query := q.Documents(ctx)
-
-	docs, err := query.GetAll()
+	docs, err := db.Collection(DEPTokenBucket).Documents(context.Background()).GetAll()
 	if err != nil {
 		return nil, err
 	}
-
-	if (len(docs)>0) {
-
-		for i := 0; i < len(docs); i++ {
-			var depToken config.DEPToken
-
-			doc := docs[i]
-			doc.DataTo(&depToken)
-
-			result = append(result, depToken)
+	for _, snap := range docs {
+		if !strings.HasPrefix(snap.Ref.ID, "CK_") {
+			continue
+		}
+		var doc depTokenDoc
+		if err := snap.DataTo(&doc); err != nil {
+			continue
 		}
+		var depToken config.DEPToken
+		if err := json.Unmarshal(doc.Data, &depToken); err != nil {
+			// TODO: log problematic DEP token, or remove altogether?
+			continue
+		}
+		result = append(result, depToken)
 	}
-
-	return result, err
+	return result, nil
 }
 
 func (db *FireDB) DEPKeypair() (key *rsa.PrivateKey, cert *x509.Certificate, err error) {
-	var keyBytes, certBytes []byte
-
-	ctx := context.Background()
-
-	depKeyPair, err := db.Collection(depTokenBucket).Doc("key").Get(ctx)
+	snap, err := db.Collection(DEPTokenBucket).Doc("key").Get(context.Background())
+	if status.Code(err) == codes.NotFound {
+		// if there is no certificate or private key then generate
+		return generateAndStoreDEPKeypairFire(db)
+	}
 	if err != nil {
 		return nil, nil, err
 	}
-	depMap := depKeyPair.Data()
-
-	keyBytes = depMap["key"].([]byte)
-	certBytes = depMap["value"].([]byte)
-
-	if keyBytes == nil || certBytes == nil {
-		// if there is no certificate or private key then generate
-		key, cert, err = generateAndStoreDEPKeypairFire(db)
-	} else {
-		key, err = x509.ParsePKCS1PrivateKey(keyBytes)
-		if err != nil {
-			return
-		}
-		cert, err = x509.ParseCertificate(certBytes)
-		if err != nil {
-			return
-		}
+	var doc depKeypairDoc
+	if err = snap.DataTo(&doc); err != nil {
+		return
+	}
+	key, err = x509.ParsePKCS1PrivateKey(doc.Key)
+	if err != nil {
+		return
+	}
+	cert, err = x509.ParseCertificate(doc.Certificate)
+	if err != nil {
+		return
 	}
 	return
 }
@@ -104,24 +93,25 @@ func generateAndStoreDEPKeypairFire(db *FireDB) (key *rsa.PrivateKey, cert *x509
 	if err != nil {
 		return
 	}
-
-	pkBytes := x509.MarshalPKCS1PrivateKey(key)
-	certBytes := cert.Raw
-
-	ctx := context.Background()
-	_, err = db.Collection(depTokenBucket).Doc("key").Set(ctx, map[string]interface{}{
-		"key":    pkBytes,
-		"certificate":   certBytes,
-	})
-
+	err = db.SaveDEPKeypair(key, cert)
 	return
 }
 
+// SaveDEPKeypair replaces the keypair used to decrypt DEP tokens.
+func (db *FireDB) SaveDEPKeypair(key *rsa.PrivateKey, cert *x509.Certificate) error {
+	doc := depKeypairDoc{
+		Key:         x509.MarshalPKCS1PrivateKey(key),
+		Certificate: cert.Raw,
+	}
+	_, err := db.Collection(DEPTokenBucket).Doc("key").Set(context.Background(), doc)
+	return err
+}
+
 //////////////////////////////////////////////////////
 
 func (db *DB) AddToken(consumerKey string, json []byte) error {
 	err := db.Update(func(tx *bolt.Tx) error {
-		b, err := tx.CreateBucketIfNotExists([]byte(depTokenBucket))
+		b, err := tx.CreateBucketIfNotExists([]byte(DEPTokenBucket))
 		if err != nil {
 			return err
 		}
@@ -139,7 +129,7 @@ func (db *DB) AddToken(consumerKey string, json []byte) error {
 func (db *DB) DEPTokens() ([]config.DEPToken, error) {
 	var result []config.DEPToken
 	err := db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(depTokenBucket))
+		b := tx.Bucket([]byte(DEPTokenBucket))
 		if b == nil {
 			return nil
 		}
@@ -163,12 +153,17 @@ func (db *DB) DEPTokens() ([]config.DEPToken, error) {
 func (db *DB) DEPKeypair() (key *rsa.PrivateKey, cert *x509.Certificate, err error) {
 	var keyBytes, certBytes []byte
 	err = db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(depTokenBucket))
+		b := tx.Bucket([]byte(DEPTokenBucket))
 		if b == nil {
 			return nil
 		}
-		keyBytes = b.Get([]byte("key"))
-		certBytes = b.Get([]byte("certificate"))
+		// bolt values are only valid for the life of the transaction.
+		if v := b.Get([]byte("key")); v != nil {
+			keyBytes = append([]byte(nil), v...)
+		}
+		if v := b.Get([]byte("certificate")); v != nil {
+			certBytes = append([]byte(nil), v...)
+		}
 		return nil
 	})
 	if err != nil {
@@ -195,12 +190,17 @@ func generateAndStoreDEPKeypair(db *DB) (key *rsa.PrivateKey, cert *x509.Certifi
 	if err != nil {
 		return
 	}
+	err = db.SaveDEPKeypair(key, cert)
+	return
+}
 
+// SaveDEPKeypair replaces the keypair used to decrypt DEP tokens.
+func (db *DB) SaveDEPKeypair(key *rsa.PrivateKey, cert *x509.Certificate) error {
 	pkBytes := x509.MarshalPKCS1PrivateKey(key)
 	certBytes := cert.Raw
 
-	err = db.Update(func(tx *bolt.Tx) error {
-		b, err := tx.CreateBucketIfNotExists([]byte(depTokenBucket))
+	return db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(DEPTokenBucket))
 		if err != nil {
 			return err
 		}
@@ -214,6 +214,4 @@ func generateAndStoreDEPKeypair(db *DB) (key *rsa.PrivateKey, cert *x509.Certifi
 		}
 		return nil
 	})
-
-	return
 }
@@ -0,0 +1,163 @@
+package builtin
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/pkg/crypto"
+	"github.com/vishnuvaradaraj/micromdm/platform/config"
+	"github.com/vishnuvaradaraj/micromdm/platform/pubsub"
+	"github.com/vishnuvaradaraj/micromdm/platform/storage/sqldb"
+)
+
+// SQLDB stores server configuration and DEP tokens in a SQL database.
+type SQLDB struct {
+	*sqldb.DB
+	Publisher pubsub.Publisher
+}
+
+func NewSQLDB(db *sqldb.DB, pub pubsub.Publisher) (*SQLDB, error) {
+	datastore := &SQLDB{DB: db, Publisher: pub}
+	return datastore, nil
+}
+
+func (db *SQLDB) SavePushCertificate(cert, key []byte) error {
+	pb, err := config.MarshalServerConfig(&config.ServerConfig{
+		PushCertificate: cert,
+		PrivateKey:      key,
+	})
+	if err != nil {
+		return errors.Wrap(err, "save push cert in sql")
+	}
+	if _, err := db.Exec(db.Upsert("server_config", "id", "id", "data"), "config", pb); err != nil {
+		return errors.Wrap(err, "save ServerConfig in sql")
+	}
+
+	if err := db.Publisher.Publish(context.TODO(), config.ConfigTopic, []byte("updated")); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (db *SQLDB) serverConfig() (*config.ServerConfig, error) {
+	var data []byte
+	err := db.QueryRow(`SELECT data FROM server_config WHERE id = ?`, "config").Scan(&data)
+	if err == sql.ErrNoRows {
+		err = &notFound{"ServerConfig", "no config found in sql"}
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "get server config from sql")
+	}
+	var conf config.ServerConfig
+	if err := config.UnmarshalServerConfig(data, &conf); err != nil {
+		return nil, errors.Wrap(err, "get server config from sql")
+	}
+	return &conf, nil
+}
+
+func (db *SQLDB) GetPushCertificate() ([]byte, error) {
+	cert, err := db.PushCertificate()
+	if err != nil {
+		return nil, err
+	}
+	if len(cert.Certificate) > 0 {
+		return cert.Certificate[0], nil
+	}
+	return nil, nil
+}
+
+func (db *SQLDB) PushCertificate() (*tls.Certificate, error) {
+	conf, err := db.serverConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "get server config for push cert")
+	}
+	return pushCertificate(conf)
+}
+
+func (db *SQLDB) PushTopic() (string, error) {
+	cert, err := db.PushCertificate()
+	if err != nil {
+		return "", errors.Wrap(err, "get push certificate for topic")
+	}
+	topic, err := crypto.TopicFromCert(cert.Leaf)
+	return topic, errors.Wrap(err, "get topic from push certificate")
+}
+
+func (db *SQLDB) AddToken(consumerKey string, json []byte) error {
+	if _, err := db.Exec(db.Upsert("dep_tokens", "consumer_key", "consumer_key", "data"), consumerKey, json); err != nil {
+		return err
+	}
+	if err := db.Publisher.Publish(context.TODO(), config.DEPTokenTopic, json); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (db *SQLDB) DEPTokens() ([]config.DEPToken, error) {
+	rows, err := db.Query(`SELECT consumer_key, data FROM dep_tokens ORDER BY consumer_key`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var result []config.DEPToken
+	for rows.Next() {
+		var (
+			consumerKey string
+			data        []byte
+		)
+		if err := rows.Scan(&consumerKey, &data); err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(consumerKey, "CK_") {
+			continue
+		}
+		var depToken config.DEPToken
+		if err := json.Unmarshal(data, &depToken); err != nil {
+			// TODO: log problematic DEP token, or remove altogether?
+			continue
+		}
+		result = append(result, depToken)
+	}
+	return result, rows.Err()
+}
+
+func (db *SQLDB) DEPKeypair() (key *rsa.PrivateKey, cert *x509.Certificate, err error) {
+	var keyBytes, certBytes []byte
+	err = db.QueryRow(`SELECT private_key, certificate FROM dep_keypair WHERE id = ?`, "key").Scan(&keyBytes, &certBytes)
+	if err == sql.ErrNoRows {
+		// if there is no certificate or private key then generate
+		return generateAndStoreDEPKeypairSQL(db)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err = x509.ParsePKCS1PrivateKey(keyBytes)
+	if err != nil {
+		return
+	}
+	cert, err = x509.ParseCertificate(certBytes)
+	return
+}
+
+func generateAndStoreDEPKeypairSQL(db *SQLDB) (key *rsa.PrivateKey, cert *x509.Certificate, err error) {
+	key, cert, err = crypto.SimpleSelfSignedRSAKeypair("micromdm-dep-token", 365)
+	if err != nil {
+		return
+	}
+	err = db.SaveDEPKeypair(key, cert)
+	return
+}
+
+// SaveDEPKeypair replaces the keypair used to decrypt DEP tokens.
+func (db *SQLDB) SaveDEPKeypair(key *rsa.PrivateKey, cert *x509.Certificate) error {
+	_, err := db.Exec(db.Upsert("dep_keypair", "id", "id", "private_key", "certificate"),
+		"key", x509.MarshalPKCS1PrivateKey(key), cert.Raw)
+	return err
+}
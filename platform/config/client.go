@@ -26,6 +26,17 @@ func NewHTTPClient(instance, token string, logger log.Logger, opts ...httptransp
 		).Endpoint()
 	}
 
+	var getEndpoint endpoint.Endpoint
+	{
+		getEndpoint = httptransport.NewClient(
+			"GET",
+			httputil.CopyURL(u, "/v1/config/certificate"),
+			httputil.EncodeRequestWithToken(token, httptransport.EncodeJSONRequest),
+			decodeGetPushCertificateResponse,
+			opts...,
+		).Endpoint()
+	}
+
 	var applyDEPTokensEndpoint endpoint.Endpoint
 	{
 		applyDEPTokensEndpoint = httptransport.NewClient(
@@ -50,6 +61,7 @@ func NewHTTPClient(instance, token string, logger log.Logger, opts ...httptransp
 
 	return Endpoints{
 		SavePushCertificateEndpoint: saveEndpoint,
+		GetPushCertificateEndpoint:  getEndpoint,
 		ApplyDEPTokensEndpoint:      applyDEPTokensEndpoint,
 		GetDEPTokensEndpoint:        getDEPTokensEndpoint,
 	}, nil
@@ -1,19 +1,52 @@
 package config
 
 import (
+	"context"
+	"encoding/json"
+	"regexp"
 	"time"
 
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+
 	"github.com/vishnuvaradaraj/micromdm/dep"
 )
 
 const DEPTokenTopic = "mdm.TokenAdded"
 
+const (
+	// DEPTokenExpiringTopic is published with a JSON encoded DEPTokenInfo for
+	// each DEP token which is expiring or expired.
+	DEPTokenExpiringTopic = "mdm.DEPTokenExpiring"
+
+	// DEPTokenWarnPeriod is how long before expiry warnings start.
+	DEPTokenWarnPeriod = 30 * 24 * time.Hour
+)
+
+// DefaultDEPTokenName is the name of a DEP token applied without one, and of
+// tokens stored before tokens were named.
+const DefaultDEPTokenName = "default"
+
 type DEPToken struct {
 	ConsumerKey       string    `json:"consumer_key"`
 	ConsumerSecret    string    `json:"consumer_secret"`
 	AccessToken       string    `json:"access_token"`
 	AccessSecret      string    `json:"access_secret"`
 	AccessTokenExpiry time.Time `json:"access_token_expiry"`
+
+	// Name identifies the DEP server the token belongs to. Each token is
+	// synced separately, so one MicroMDM server can be the MDM server of
+	// several Apple Business Manager or Apple School Manager servers.
+	Name string `json:"name,omitempty"`
+}
+
+// InstanceName returns the name of the token, or DefaultDEPTokenName if it
+// has none.
+func (tok DEPToken) InstanceName() string {
+	if tok.Name == "" {
+		return DefaultDEPTokenName
+	}
+	return tok.Name
 }
 
 // create a DEP client from token.
@@ -27,3 +60,89 @@ func (tok DEPToken) Client() (*dep.Client, error) {
 	client := dep.NewClient(conf)
 	return client, nil
 }
+
+// DEP token names are used in storage keys and URLs.
+var depTokenNameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// depTokenName returns the name for a token which is being applied. Without a
+// name, a renewed token keeps the name it has, and a new token is the default.
+// A name which belongs to a different token is refused.
+func depTokenName(tokens []DEPToken, tok DEPToken, name string) (string, error) {
+	if name != "" && !depTokenNameRegexp.MatchString(name) {
+		return "", errors.Errorf("invalid DEP token name %q: use letters, digits, '.', '_' and '-'", name)
+	}
+	for _, existing := range tokens {
+		if existing.ConsumerKey == tok.ConsumerKey && name == "" {
+			return existing.InstanceName(), nil
+		}
+	}
+	if name == "" {
+		name = DefaultDEPTokenName
+	}
+	for _, existing := range tokens {
+		if existing.ConsumerKey != tok.ConsumerKey && existing.InstanceName() == name {
+			return "", errors.Errorf("DEP token name %s is used by another token, choose a different name", name)
+		}
+	}
+	return name, nil
+}
+
+// DEPTokenInfo describes the expiry of a DEP token.
+type DEPTokenInfo struct {
+	Name              string    `json:"name"`
+	ConsumerKey       string    `json:"consumer_key"`
+	AccessTokenExpiry time.Time `json:"access_token_expiry"`
+	DaysRemaining     int       `json:"days_remaining"`
+	// Expiring is set within DEPTokenWarnPeriod of AccessTokenExpiry.
+	Expiring bool `json:"expiring"`
+	Expired  bool `json:"expired"`
+}
+
+// NewDEPTokenInfo describes tok at the time now.
+func NewDEPTokenInfo(tok DEPToken, now time.Time) *DEPTokenInfo {
+	remaining := tok.AccessTokenExpiry.Sub(now)
+	return &DEPTokenInfo{
+		Name:              tok.InstanceName(),
+		ConsumerKey:       tok.ConsumerKey,
+		AccessTokenExpiry: tok.AccessTokenExpiry,
+		DaysRemaining:     int(remaining.Hours() / 24),
+		Expiring:          remaining < DEPTokenWarnPeriod,
+		Expired:           remaining <= 0,
+	}
+}
+
+func (w *ExpiryWorker) checkDEPTokens(ctx context.Context, now time.Time) error {
+	tokens, err := w.store.DEPTokens()
+	if err != nil {
+		return errors.Wrap(err, "load DEP tokens")
+	}
+	for _, tok := range tokens {
+		if tok.AccessTokenExpiry.IsZero() {
+			continue
+		}
+		info := NewDEPTokenInfo(tok, now)
+		if !info.Expiring {
+			continue
+		}
+
+		msg := "DEP token expires soon, download a new one from Apple Business Manager and apply it with mdmctl apply dep-tokens"
+		if info.Expired {
+			msg = "DEP token has expired, devices are not synced until a new one is applied with mdmctl apply dep-tokens"
+		}
+		level.Warn(w.logger).Log(
+			"msg", msg,
+			"dep_token", info.Name,
+			"access_token_expiry", info.AccessTokenExpiry,
+			"days_remaining", info.DaysRemaining,
+		)
+
+		data, err := json.Marshal(info)
+		if err != nil {
+			return errors.Wrap(err, "marshal DEP token info")
+		}
+		if err := w.pub.Publish(ctx, DEPTokenExpiringTopic, data); err != nil {
+			return errors.Wrapf(err, "publish to %s", DEPTokenExpiringTopic)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/pubsub/inmem"
+)
+
+func TestDEPTokenName(t *testing.T) {
+	tokens := []DEPToken{
+		{ConsumerKey: "CK_legacy"},
+		{ConsumerKey: "CK_school", Name: "school"},
+	}
+	tests := []struct {
+		name        string
+		consumerKey string
+		applyName   string
+		want        string
+		wantErr     bool
+	}{
+		{"renewed token keeps its name", "CK_school", "", "school", false},
+		{"unnamed token is the default", "CK_legacy", "", DefaultDEPTokenName, false},
+		{"renamed token", "CK_school", "campus", "campus", false},
+		{"new named token", "CK_office", "office", "office", false},
+		{"new token without a name", "CK_office", "", "", true},
+		{"name of another token", "CK_office", "school", "", true},
+		{"invalid name", "CK_office", "my:office", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			have, err := depTokenName(tokens, DEPToken{ConsumerKey: tt.consumerKey}, tt.applyName)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("have name %s, want error", have)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have != tt.want {
+				t.Errorf("have %s, want %s", have, tt.want)
+			}
+		})
+	}
+}
+
+// tokenStore keeps DEP tokens. Only DEPTokens is implemented.
+type tokenStore struct {
+	Store
+	tokens []DEPToken
+}
+
+func (s *tokenStore) DEPTokens() ([]DEPToken, error) { return s.tokens, nil }
+
+func TestDEPTokenExpiry(t *testing.T) {
+	now := time.Now()
+	store := &tokenStore{tokens: []DEPToken{
+		{ConsumerKey: "CK_valid", AccessTokenExpiry: now.AddDate(0, 6, 0)},
+		{ConsumerKey: "CK_expiring", Name: "school", AccessTokenExpiry: now.AddDate(0, 0, 10)},
+		{ConsumerKey: "CK_expired", Name: "office", AccessTokenExpiry: now.AddDate(0, 0, -1)},
+		{ConsumerKey: "CK_unknown", Name: "legacy"},
+	}}
+	ps := inmem.NewPubSub()
+	events, err := ps.Subscribe(context.Background(), "test", DEPTokenExpiringTopic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewExpiryWorker(store, ps, log.NewNopLogger())
+	if err := w.checkDEPTokens(context.Background(), now); err != nil {
+		t.Fatal(err)
+	}
+
+	expired := make(map[string]bool)
+	for len(expired) < 2 {
+		select {
+		case ev := <-events:
+			var info DEPTokenInfo
+			if err := json.Unmarshal(ev.Message, &info); err != nil {
+				t.Fatal(err)
+			}
+			expired[info.Name] = info.Expired
+		case <-time.After(100 * time.Millisecond):
+			t.Fatalf("have warnings for %v, want school and office", expired)
+		}
+	}
+	if expired["school"] || !expired["office"] {
+		t.Errorf("have expired %v, want school expiring and office expired", expired)
+	}
+	select {
+	case ev := <-events:
+		t.Errorf("have unexpected warning %s", ev.Message)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -2,24 +2,31 @@ package config
 
 import (
 	"context"
+	"crypto/x509"
 	"net/http"
+	"time"
 
 	"github.com/go-kit/kit/endpoint"
 	"github.com/vishnuvaradaraj/micromdm/pkg/httputil"
 	"github.com/pkg/errors"
 )
 
-func (svc *ConfigService) GetPushCertificate(ctx context.Context) ([]byte, error) {
+func (svc *ConfigService) GetPushCertificate(ctx context.Context) ([]byte, *PushCertificateInfo, error) {
 	cert, err := svc.store.GetPushCertificate()
 	if err != nil {
-		return cert, errors.Wrap(err, "get push certificate")
+		return cert, nil, errors.Wrap(err, "get push certificate")
 	}
-	return cert, nil
+	parsed, err := x509.ParseCertificate(cert)
+	if err != nil {
+		return cert, nil, errors.Wrap(err, "parse push certificate")
+	}
+	return cert, NewPushCertificateInfo(parsed, time.Now()), nil
 }
 
 type getResponse struct {
-	Cert []byte `json:"cert"`
-	Err  error  `json:"err,omitempty"`
+	Cert []byte               `json:"cert"`
+	Info *PushCertificateInfo `json:"info,omitempty"`
+	Err  error                `json:"err,omitempty"`
 }
 
 func (r getResponse) Failed() error { return r.Err }
@@ -36,16 +43,16 @@ func decodeGetPushCertificateResponse(_ context.Context, r *http.Response) (inte
 
 func MakeGetPushCertificateEndpoint(svc Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
-		cert, err := svc.GetPushCertificate(ctx)
-		return getResponse{Err: err, Cert: cert}, nil
+		cert, info, err := svc.GetPushCertificate(ctx)
+		return getResponse{Err: err, Cert: cert, Info: info}, nil
 	}
 }
 
-func (e Endpoints) GetPushCertificate(ctx context.Context) ([]byte, error) {
+func (e Endpoints) GetPushCertificate(ctx context.Context) ([]byte, *PushCertificateInfo, error) {
 	response, err := e.GetPushCertificateEndpoint(ctx, nil)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-
-	return response.(getResponse).Cert, response.(getResponse).Err
+	resp := response.(getResponse)
+	return resp.Cert, resp.Info, resp.Err
 }
@@ -0,0 +1,177 @@
+package config
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/pkg/crypto"
+	"github.com/vishnuvaradaraj/micromdm/platform/pubsub"
+)
+
+const (
+	// PushCertificateExpiringTopic is published with a JSON encoded
+	// PushCertificateInfo while the push certificate is expiring or expired.
+	PushCertificateExpiringTopic = "mdm.PushCertificateExpiring"
+
+	// PushCertificateWarnPeriod is how long before expiry warnings start.
+	PushCertificateWarnPeriod = 30 * 24 * time.Hour
+
+	expiryCheckInterval = 12 * time.Hour
+)
+
+// PushCertificateInfo describes the MDM push certificate.
+type PushCertificateInfo struct {
+	Topic         string    `json:"topic"`
+	CommonName    string    `json:"common_name"`
+	SerialNumber  string    `json:"serial_number"`
+	NotBefore     time.Time `json:"not_before"`
+	NotAfter      time.Time `json:"not_after"`
+	DaysRemaining int       `json:"days_remaining"`
+	// Expiring is set within PushCertificateWarnPeriod of NotAfter.
+	Expiring bool `json:"expiring"`
+	Expired  bool `json:"expired"`
+}
+
+// NewPushCertificateInfo describes cert at the time now.
+func NewPushCertificateInfo(cert *x509.Certificate, now time.Time) *PushCertificateInfo {
+	// the topic is empty if the certificate is not an MDM push certificate.
+	topic, _ := crypto.TopicFromCert(cert)
+	remaining := cert.NotAfter.Sub(now)
+	return &PushCertificateInfo{
+		Topic:         topic,
+		CommonName:    cert.Subject.CommonName,
+		SerialNumber:  cert.SerialNumber.String(),
+		NotBefore:     cert.NotBefore,
+		NotAfter:      cert.NotAfter,
+		DaysRemaining: int(remaining.Hours() / 24),
+		Expiring:      remaining < PushCertificateWarnPeriod,
+		Expired:       remaining <= 0,
+	}
+}
+
+// TopicMismatchError is returned when an uploaded push certificate has a
+// different topic than the current one. Devices enrolled with the current topic
+// can no longer be pushed to once it is replaced, and must re-enroll.
+type TopicMismatchError struct {
+	Current string
+	New     string
+}
+
+func (e *TopicMismatchError) Error() string {
+	return fmt.Sprintf("push certificate topic %s does not match the current topic %s. "+
+		"enrolled devices will stop responding unless they re-enroll; upload with force to replace it anyway", e.New, e.Current)
+}
+
+func (e *TopicMismatchError) StatusCode() int { return http.StatusConflict }
+
+// checkPushCertificate returns an error if the PEM encoded certificate can not
+// replace the current push certificate without breaking enrolled devices.
+func checkPushCertificate(store Store, certPEM []byte) error {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return errors.New("decode push certificate PEM")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return errors.Wrap(err, "parse push certificate")
+	}
+	topic, err := crypto.TopicFromCert(cert)
+	if err != nil {
+		return err
+	}
+	if time.Now().After(cert.NotAfter) {
+		return errors.Errorf("push certificate expired on %s", cert.NotAfter.Format("2006-01-02"))
+	}
+
+	// there is nothing to compare with if no certificate was uploaded before.
+	current, err := store.PushTopic()
+	if isNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "get current push topic")
+	}
+	if current != topic {
+		return &TopicMismatchError{Current: current, New: topic}
+	}
+	return nil
+}
+
+func isNotFound(err error) bool {
+	e, ok := errors.Cause(err).(interface{ NotFound() bool })
+	return ok && e.NotFound()
+}
+
+// ExpiryWorker warns while the push certificate or a DEP token is expiring or
+// expired, in the logs and by publishing to PushCertificateExpiringTopic and
+// DEPTokenExpiringTopic.
+type ExpiryWorker struct {
+	store  Store
+	pub    pubsub.Publisher
+	logger log.Logger
+}
+
+func NewExpiryWorker(store Store, pub pubsub.Publisher, logger log.Logger) *ExpiryWorker {
+	return &ExpiryWorker{store: store, pub: pub, logger: logger}
+}
+
+// Run checks the certificate and tokens a minute after it starts, giving the
+// webhook worker time to subscribe, and every 12 hours after that until ctx is
+// done.
+func (w *ExpiryWorker) Run(ctx context.Context) error {
+	wait := time.Minute
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		wait = expiryCheckInterval
+		now := time.Now()
+		if err := w.check(ctx, now); err != nil {
+			level.Info(w.logger).Log("msg", "check push certificate expiry", "err", err)
+		}
+		if err := w.checkDEPTokens(ctx, now); err != nil {
+			level.Info(w.logger).Log("msg", "check DEP token expiry", "err", err)
+		}
+	}
+}
+
+func (w *ExpiryWorker) check(ctx context.Context, now time.Time) error {
+	cert, err := w.store.PushCertificate()
+	if err != nil {
+		// no push certificate has been uploaded yet.
+		return nil
+	}
+	info := NewPushCertificateInfo(cert.Leaf, now)
+	if !info.Expiring {
+		return nil
+	}
+
+	msg := "push certificate expires soon, renew it with the same Apple ID to keep the topic"
+	if info.Expired {
+		msg = "push certificate has expired, devices can not be pushed to until it is renewed"
+	}
+	level.Warn(w.logger).Log(
+		"msg", msg,
+		"topic", info.Topic,
+		"not_after", info.NotAfter,
+		"days_remaining", info.DaysRemaining,
+	)
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		return errors.Wrap(err, "marshal push certificate info")
+	}
+	err = w.pub.Publish(ctx, PushCertificateExpiringTopic, data)
+	return errors.Wrapf(err, "publish to %s", PushCertificateExpiringTopic)
+}
@@ -0,0 +1,182 @@
+package config
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/vishnuvaradaraj/micromdm/pkg/crypto"
+	"github.com/vishnuvaradaraj/micromdm/platform/pubsub/inmem"
+)
+
+func pushCert(t *testing.T, topic string, notAfter time.Time) (*x509.Certificate, []byte) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oidUserID := asn1.ObjectIdentifier{0, 9, 2342, 19200300, 100, 1, 1}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			CommonName: "APSP:" + topic,
+			ExtraNames: []pkix.AttributeTypeAndValue{{Type: oidUserID, Value: topic}},
+		},
+		NotBefore: notAfter.AddDate(-1, 0, 0),
+		NotAfter:  notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+// certStore keeps the uploaded certificate. Only the push certificate methods
+// are implemented.
+type certStore struct {
+	Store
+	cert *x509.Certificate
+	err  error
+}
+
+type notFoundError struct{}
+
+func (notFoundError) Error() string  { return "not found" }
+func (notFoundError) NotFound() bool { return true }
+
+func (s *certStore) SavePushCertificate(cert, key []byte) error {
+	block, _ := pem.Decode(cert)
+	parsed, err := x509.ParseCertificate(block.Bytes)
+	s.cert = parsed
+	return err
+}
+
+func (s *certStore) PushCertificate() (*tls.Certificate, error) {
+	if s.cert == nil {
+		return nil, errors.New("not found")
+	}
+	return &tls.Certificate{Certificate: [][]byte{s.cert.Raw}, Leaf: s.cert}, nil
+}
+
+func (s *certStore) PushTopic() (string, error) {
+	if s.err != nil {
+		return "", s.err
+	}
+	if s.cert == nil {
+		return "", notFoundError{}
+	}
+	return crypto.TopicFromCert(s.cert)
+}
+
+func TestSavePushCertificateTopic(t *testing.T) {
+	store := &certStore{}
+	svc := New(store)
+	ctx := context.Background()
+	notAfter := time.Now().AddDate(1, 0, 0)
+
+	_, first := pushCert(t, "com.apple.mgmt.first", notAfter)
+	if err := svc.SavePushCertificate(ctx, first, nil, false); err != nil {
+		t.Fatalf("first upload: %s", err)
+	}
+
+	_, renewed := pushCert(t, "com.apple.mgmt.first", notAfter.AddDate(1, 0, 0))
+	if err := svc.SavePushCertificate(ctx, renewed, nil, false); err != nil {
+		t.Fatalf("renewal with the same topic: %s", err)
+	}
+
+	_, other := pushCert(t, "com.apple.mgmt.other", notAfter)
+	err := svc.SavePushCertificate(ctx, other, nil, false)
+	if _, ok := err.(*TopicMismatchError); !ok {
+		t.Fatalf("have error %v, want *TopicMismatchError", err)
+	}
+	if have, _ := store.PushTopic(); have != "com.apple.mgmt.first" {
+		t.Errorf("have topic %s after refused upload, want com.apple.mgmt.first", have)
+	}
+
+	if err := svc.SavePushCertificate(ctx, other, nil, true); err != nil {
+		t.Fatalf("forced upload: %s", err)
+	}
+	if have, _ := store.PushTopic(); have != "com.apple.mgmt.other" {
+		t.Errorf("have topic %s after forced upload, want com.apple.mgmt.other", have)
+	}
+
+	// force only replaces a certificate with a different topic.
+	_, expired := pushCert(t, "com.apple.mgmt.other", time.Now().AddDate(0, 0, -1))
+	if err := svc.SavePushCertificate(ctx, expired, nil, true); err == nil {
+		t.Error("forced upload of an expired certificate succeeded")
+	}
+	store.err = errors.New("store unavailable")
+	_, third := pushCert(t, "com.apple.mgmt.third", notAfter)
+	if err := svc.SavePushCertificate(ctx, third, nil, true); err == nil {
+		t.Error("forced upload succeeded without the current topic")
+	}
+	store.err = nil
+	if have, _ := store.PushTopic(); have != "com.apple.mgmt.other" {
+		t.Errorf("have topic %s after refused uploads, want com.apple.mgmt.other", have)
+	}
+}
+
+func TestExpiryWorker(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		notAfter time.Time
+		warn     bool
+		expired  bool
+	}{
+		{"valid", now.AddDate(0, 6, 0), false, false},
+		{"expiring", now.AddDate(0, 0, 10), true, false},
+		{"expired", now.AddDate(0, 0, -1), true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert, _ := pushCert(t, "com.apple.mgmt.test", tt.notAfter)
+			ps := inmem.NewPubSub()
+			events, err := ps.Subscribe(context.Background(), "test", PushCertificateExpiringTopic)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := NewExpiryWorker(&certStore{cert: cert}, ps, log.NewNopLogger())
+			if err := w.check(context.Background(), now); err != nil {
+				t.Fatal(err)
+			}
+
+			select {
+			case ev := <-events:
+				if !tt.warn {
+					t.Fatal("have warning for a valid certificate")
+				}
+				var info PushCertificateInfo
+				if err := json.Unmarshal(ev.Message, &info); err != nil {
+					t.Fatal(err)
+				}
+				if have, want := info.Expired, tt.expired; have != want {
+					t.Errorf("have expired %v, want %v", have, want)
+				}
+				if have, want := info.Topic, "com.apple.mgmt.test"; have != want {
+					t.Errorf("have topic %s, want %s", have, want)
+				}
+			case <-time.After(100 * time.Millisecond):
+				if tt.warn {
+					t.Fatal("no warning published")
+				}
+			}
+		})
+	}
+}
@@ -9,14 +9,25 @@ import (
 	"github.com/pkg/errors"
 )
 
-func (svc *ConfigService) SavePushCertificate(ctx context.Context, cert, key []byte) error {
-	err := svc.store.SavePushCertificate(cert, key)
+// SavePushCertificate replaces the push certificate. Unless force is set, a
+// certificate with a different topic than the current one is refused with a
+// *TopicMismatchError. Force does not override any other error.
+func (svc *ConfigService) SavePushCertificate(ctx context.Context, cert, key []byte, force bool) error {
+	err := checkPushCertificate(svc.store, cert)
+	if _, mismatch := err.(*TopicMismatchError); mismatch && force {
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
+	err = svc.store.SavePushCertificate(cert, key)
 	return errors.Wrap(err, "save push certificate")
 }
 
 type saveRequest struct {
-	Cert []byte `json:"cert"`
-	Key  []byte `json:"key"`
+	Cert  []byte `json:"cert"`
+	Key   []byte `json:"key"`
+	Force bool   `json:"force,omitempty"`
 }
 
 type saveResponse struct {
@@ -40,15 +51,16 @@ func decodeSavePushCertificateResponse(_ context.Context, r *http.Response) (int
 func MakeSavePushCertificateEndpoint(svc Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		req := request.(saveRequest)
-		err = svc.SavePushCertificate(ctx, req.Cert, req.Key)
+		err = svc.SavePushCertificate(ctx, req.Cert, req.Key, req.Force)
 		return saveResponse{Err: err}, nil
 	}
 }
 
-func (e Endpoints) SavePushCertificate(ctx context.Context, cert, key []byte) error {
+func (e Endpoints) SavePushCertificate(ctx context.Context, cert, key []byte, force bool) error {
 	request := saveRequest{
-		Cert: cert,
-		Key:  key,
+		Cert:  cert,
+		Key:   key,
+		Force: force,
 	}
 
 	response, err := e.SavePushCertificateEndpoint(ctx, request)
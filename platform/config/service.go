@@ -8,9 +8,9 @@ import (
 )
 
 type Service interface {
-	SavePushCertificate(ctx context.Context, cert, key []byte) error
-	GetPushCertificate(ctx context.Context) ([]byte, error)
-	ApplyDEPToken(ctx context.Context, P7MContent []byte) error
+	SavePushCertificate(ctx context.Context, cert, key []byte, force bool) error
+	GetPushCertificate(ctx context.Context) ([]byte, *PushCertificateInfo, error)
+	ApplyDEPToken(ctx context.Context, P7MContent []byte, name string) error
 	GetDEPTokens(ctx context.Context) ([]DEPToken, []byte, error)
 }
 
@@ -0,0 +1,67 @@
+package dep
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+
+	"github.com/vishnuvaradaraj/micromdm/dep"
+	"github.com/vishnuvaradaraj/micromdm/pkg/httputil"
+)
+
+// AssignProfile assigns a profile to devices, and records it as their intended
+// profile.
+func (svc *DEPService) AssignProfile(ctx context.Context, tokenName, uuid string, serials []string) (*dep.ProfileResponse, error) {
+	client, err := svc.client(tokenName)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.AssignProfile(uuid, serials...)
+	if err != nil {
+		return nil, err
+	}
+	return resp, svc.saveAssignments(instanceName(tokenName), uuid, resp.Devices)
+}
+
+type assignProfileRequest struct {
+	TokenName   string   `json:"token_name,omitempty"`
+	ProfileUUID string   `json:"profile_uuid"`
+	Serials     []string `json:"serials"`
+}
+
+type assignProfileResponse struct {
+	*dep.ProfileResponse
+	Err error `json:"err,omitempty"`
+}
+
+func (r assignProfileResponse) Failed() error { return r.Err }
+
+func decodeAssignProfileRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	var req assignProfileRequest
+	err := httputil.DecodeJSONRequest(r, &req)
+	return req, err
+}
+
+func decodeAssignProfileResponse(_ context.Context, r *http.Response) (interface{}, error) {
+	var resp assignProfileResponse
+	err := httputil.DecodeJSONResponse(r, &resp)
+	return resp, err
+}
+
+func MakeAssignProfileEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(assignProfileRequest)
+		resp, err := svc.AssignProfile(ctx, req.TokenName, req.ProfileUUID, req.Serials)
+		return assignProfileResponse{ProfileResponse: resp, Err: err}, nil
+	}
+}
+
+func (e Endpoints) AssignProfile(ctx context.Context, tokenName, uuid string, serials []string) (*dep.ProfileResponse, error) {
+	request := assignProfileRequest{TokenName: tokenName, ProfileUUID: uuid, Serials: serials}
+	response, err := e.AssignProfileEndpoint(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	return response.(assignProfileResponse).ProfileResponse, response.(assignProfileResponse).Err
+}
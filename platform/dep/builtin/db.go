@@ -0,0 +1,325 @@
+package builtin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/firestore"
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/dep"
+)
+
+const (
+	ProfileBucket    = "mdm.DEPProfiles"
+	AssignmentBucket = "mdm.DEPProfileAssignments"
+)
+
+// Profile versions are keyed by token name, profile name and version, which
+// are escaped as Firestore document IDs can not contain "/". Versions are zero
+// padded so they sort in order.
+var keyEscaper = strings.NewReplacer("%", "%25", "/", "%2F", ":", "%3A")
+
+const keySep = ":"
+
+func profilePrefix(tokenName, name string) string {
+	prefix := keyEscaper.Replace(tokenName) + keySep
+	if name != "" {
+		prefix += keyEscaper.Replace(name) + keySep
+	}
+	return prefix
+}
+
+func profileKey(v *dep.ProfileVersion) string {
+	return profilePrefix(v.TokenName, v.Name) + fmt.Sprintf("%08d", v.Version)
+}
+
+// latestVersions returns the latest version of each profile, by name.
+func latestVersions(versions []dep.ProfileVersion) []dep.ProfileVersion {
+	latest := make(map[string]dep.ProfileVersion)
+	for _, v := range versions {
+		if l, ok := latest[v.Name]; !ok || v.Version > l.Version {
+			latest[v.Name] = v
+		}
+	}
+	profiles := make([]dep.ProfileVersion, 0, len(latest))
+	for _, v := range latest {
+		profiles = append(profiles, v)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	return profiles
+}
+
+// FireDB stores the DEP profile library in Google Cloud Firestore.
+type FireDB struct {
+	*firestore.Client
+}
+
+type profileDoc struct {
+	TokenName string `firestore:"token_name"`
+	Name      string `firestore:"name"`
+	Version   int    `firestore:"version"`
+	Data      []byte `firestore:"data"`
+}
+
+type assignmentDoc struct {
+	Data []byte `firestore:"data"`
+}
+
+func NewFireDB(db *firestore.Client) (*FireDB, error) {
+	datastore := &FireDB{Client: db}
+	return datastore, nil
+}
+
+func (db *FireDB) SaveProfileVersion(v *dep.ProfileVersion) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "marshal dep profile")
+	}
+	doc := profileDoc{TokenName: v.TokenName, Name: v.Name, Version: v.Version, Data: data}
+	_, err = db.Collection(ProfileBucket).Doc(profileKey(v)).Set(context.Background(), doc)
+	return errors.Wrap(err, "put dep profile to firestore")
+}
+
+func (db *FireDB) ProfileVersions(tokenName, name string) ([]dep.ProfileVersion, error) {
+	q := db.Collection(ProfileBucket).Where("token_name", "==", tokenName).Where("name", "==", name)
+	versions, err := db.profilesByQuery(q)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get versions of dep profile %s", name)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+	return versions, nil
+}
+
+func (db *FireDB) ListProfiles(tokenName string) ([]dep.ProfileVersion, error) {
+	versions, err := db.profilesByQuery(db.Collection(ProfileBucket).Where("token_name", "==", tokenName))
+	if err != nil {
+		return nil, errors.Wrap(err, "list dep profiles")
+	}
+	return latestVersions(versions), nil
+}
+
+func (db *FireDB) DeleteProfile(tokenName, name string) error {
+	ctx := context.Background()
+	q := db.Collection(ProfileBucket).Where("token_name", "==", tokenName).Where("name", "==", name)
+	docs, err := q.Documents(ctx).GetAll()
+	if err == nil && len(docs) == 0 {
+		err = &notFound{"DEP Profile", fmt.Sprintf("name %s", name)}
+	}
+	if err != nil {
+		return errors.Wrapf(err, "delete dep profile %s", name)
+	}
+	for _, snap := range docs {
+		if _, err := snap.Ref.Delete(ctx); err != nil {
+			return errors.Wrapf(err, "delete dep profile %s", name)
+		}
+	}
+	return nil
+}
+
+func (db *FireDB) profilesByQuery(q firestore.Query) ([]dep.ProfileVersion, error) {
+	docs, err := q.Documents(context.Background()).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	var versions []dep.ProfileVersion
+	for _, snap := range docs {
+		var doc profileDoc
+		if err := snap.DataTo(&doc); err != nil {
+			return nil, errors.Wrap(err, "decode dep profile document")
+		}
+		var v dep.ProfileVersion
+		if err := json.Unmarshal(doc.Data, &v); err != nil {
+			return nil, errors.Wrap(err, "unmarshal dep profile")
+		}
+		versions = append(versions, v)
+	}
+	return versions, nil
+}
+
+func (db *FireDB) SaveAssignment(a *dep.Assignment) error {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return errors.Wrap(err, "marshal dep profile assignment")
+	}
+	_, err = db.Collection(AssignmentBucket).Doc(a.SerialNumber).Set(context.Background(), assignmentDoc{Data: data})
+	return errors.Wrap(err, "put dep profile assignment to firestore")
+}
+
+func (db *FireDB) Assignments() ([]dep.Assignment, error) {
+	docs, err := db.Collection(AssignmentBucket).Documents(context.Background()).GetAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "list dep profile assignments")
+	}
+	var assignments []dep.Assignment
+	for _, snap := range docs {
+		var doc assignmentDoc
+		if err := snap.DataTo(&doc); err != nil {
+			return nil, errors.Wrap(err, "decode dep profile assignment document")
+		}
+		var a dep.Assignment
+		if err := json.Unmarshal(doc.Data, &a); err != nil {
+			return nil, errors.Wrap(err, "unmarshal dep profile assignment")
+		}
+		assignments = append(assignments, a)
+	}
+	return assignments, nil
+}
+
+func (db *FireDB) DeleteAssignment(serial string) error {
+	_, err := db.Collection(AssignmentBucket).Doc(serial).Delete(context.Background())
+	if status.Code(err) == codes.NotFound {
+		return nil
+	}
+	return errors.Wrapf(err, "delete dep profile assignment of %s", serial)
+}
+
+//////////////////////////////////////////////////////
+
+// DB stores the DEP profile library in BoltDB.
+type DB struct {
+	*bolt.DB
+}
+
+func NewDB(db *bolt.DB) (*DB, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists([]byte(ProfileBucket)); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists([]byte(AssignmentBucket))
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "creating dep profile buckets")
+	}
+	datastore := &DB{
+		DB: db,
+	}
+	return datastore, nil
+}
+
+func (db *DB) SaveProfileVersion(v *dep.ProfileVersion) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "marshal dep profile")
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(ProfileBucket)).Put([]byte(profileKey(v)), data)
+	})
+	return errors.Wrap(err, "put dep profile to boltdb")
+}
+
+// forEachProfile calls fn for every profile version with a key prefix, in key
+// order.
+func (db *DB) forEachProfile(prefix string, fn func(k []byte, v dep.ProfileVersion) error) error {
+	return db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(ProfileBucket)).Cursor()
+		p := []byte(prefix)
+		for k, data := c.Seek(p); k != nil && strings.HasPrefix(string(k), prefix); k, data = c.Next() {
+			var v dep.ProfileVersion
+			if err := json.Unmarshal(data, &v); err != nil {
+				return errors.Wrapf(err, "unmarshal dep profile %s", k)
+			}
+			if err := fn(k, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (db *DB) ProfileVersions(tokenName, name string) ([]dep.ProfileVersion, error) {
+	var versions []dep.ProfileVersion
+	err := db.forEachProfile(profilePrefix(tokenName, name), func(_ []byte, v dep.ProfileVersion) error {
+		versions = append(versions, v)
+		return nil
+	})
+	return versions, errors.Wrapf(err, "get versions of dep profile %s", name)
+}
+
+func (db *DB) ListProfiles(tokenName string) ([]dep.ProfileVersion, error) {
+	var versions []dep.ProfileVersion
+	err := db.forEachProfile(profilePrefix(tokenName, ""), func(_ []byte, v dep.ProfileVersion) error {
+		versions = append(versions, v)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "list dep profiles")
+	}
+	return latestVersions(versions), nil
+}
+
+func (db *DB) DeleteProfile(tokenName, name string) error {
+	var keys [][]byte
+	err := db.forEachProfile(profilePrefix(tokenName, name), func(k []byte, _ dep.ProfileVersion) error {
+		keys = append(keys, append([]byte(nil), k...))
+		return nil
+	})
+	if err == nil && len(keys) == 0 {
+		err = &notFound{"DEP Profile", fmt.Sprintf("name %s", name)}
+	}
+	if err == nil {
+		err = db.Update(func(tx *bolt.Tx) error {
+			b := tx.Bucket([]byte(ProfileBucket))
+			for _, k := range keys {
+				if err := b.Delete(k); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	return errors.Wrapf(err, "delete dep profile %s", name)
+}
+
+func (db *DB) SaveAssignment(a *dep.Assignment) error {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return errors.Wrap(err, "marshal dep profile assignment")
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(AssignmentBucket)).Put([]byte(a.SerialNumber), data)
+	})
+	return errors.Wrap(err, "put dep profile assignment to boltdb")
+}
+
+func (db *DB) Assignments() ([]dep.Assignment, error) {
+	var assignments []dep.Assignment
+	err := db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(AssignmentBucket)).ForEach(func(k, v []byte) error {
+			var a dep.Assignment
+			if err := json.Unmarshal(v, &a); err != nil {
+				return errors.Wrapf(err, "unmarshal dep profile assignment of %s", k)
+			}
+			assignments = append(assignments, a)
+			return nil
+		})
+	})
+	return assignments, errors.Wrap(err, "list dep profile assignments")
+}
+
+func (db *DB) DeleteAssignment(serial string) error {
+	err := db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(AssignmentBucket)).Delete([]byte(serial))
+	})
+	return errors.Wrapf(err, "delete dep profile assignment of %s", serial)
+}
+
+type notFound struct {
+	ResourceType string
+	Message      string
+}
+
+func (e *notFound) Error() string {
+	return fmt.Sprintf("not found: %s %s", e.ResourceType, e.Message)
+}
+
+func (e *notFound) NotFound() bool {
+	return true
+}
@@ -0,0 +1,112 @@
+package builtin
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/dep"
+	"github.com/vishnuvaradaraj/micromdm/platform/storage/sqldb"
+)
+
+// SQLDB stores the DEP profile library in a SQL database.
+type SQLDB struct {
+	*sqldb.DB
+}
+
+func NewSQLDB(db *sqldb.DB) (*SQLDB, error) {
+	datastore := &SQLDB{DB: db}
+	return datastore, nil
+}
+
+func (db *SQLDB) SaveProfileVersion(v *dep.ProfileVersion) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "marshal dep profile")
+	}
+	_, err = db.Exec(db.Upsert("dep_profiles", "id", "id", "token_name", "name", "version", "data"),
+		profileKey(v), v.TokenName, v.Name, v.Version, data)
+	return errors.Wrap(err, "put dep profile to sql")
+}
+
+func (db *SQLDB) ProfileVersions(tokenName, name string) ([]dep.ProfileVersion, error) {
+	versions, err := db.profilesByQuery(
+		`SELECT data FROM dep_profiles WHERE token_name = ? AND name = ? ORDER BY version`, tokenName, name)
+	return versions, errors.Wrapf(err, "get versions of dep profile %s", name)
+}
+
+func (db *SQLDB) ListProfiles(tokenName string) ([]dep.ProfileVersion, error) {
+	versions, err := db.profilesByQuery(`SELECT data FROM dep_profiles WHERE token_name = ?`, tokenName)
+	if err != nil {
+		return nil, errors.Wrap(err, "list dep profiles")
+	}
+	return latestVersions(versions), nil
+}
+
+func (db *SQLDB) profilesByQuery(query string, args ...interface{}) ([]dep.ProfileVersion, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var versions []dep.ProfileVersion
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var v dep.ProfileVersion
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, errors.Wrap(err, "unmarshal dep profile")
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+func (db *SQLDB) DeleteProfile(tokenName, name string) error {
+	res, err := db.Exec(`DELETE FROM dep_profiles WHERE token_name = ? AND name = ?`, tokenName, name)
+	if err != nil {
+		return errors.Wrapf(err, "delete dep profile %s", name)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return errors.Wrapf(&notFound{"DEP Profile", fmt.Sprintf("name %s", name)}, "delete dep profile %s", name)
+	}
+	return nil
+}
+
+func (db *SQLDB) SaveAssignment(a *dep.Assignment) error {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return errors.Wrap(err, "marshal dep profile assignment")
+	}
+	_, err = db.Exec(db.Upsert("dep_profile_assignments", "serial_number", "serial_number", "data"), a.SerialNumber, data)
+	return errors.Wrap(err, "put dep profile assignment to sql")
+}
+
+func (db *SQLDB) Assignments() ([]dep.Assignment, error) {
+	rows, err := db.Query(`SELECT data FROM dep_profile_assignments`)
+	if err != nil {
+		return nil, errors.Wrap(err, "list dep profile assignments")
+	}
+	defer rows.Close()
+	var assignments []dep.Assignment
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, errors.Wrap(err, "list dep profile assignments")
+		}
+		var a dep.Assignment
+		if err := json.Unmarshal(data, &a); err != nil {
+			return nil, errors.Wrap(err, "unmarshal dep profile assignment")
+		}
+		assignments = append(assignments, a)
+	}
+	return assignments, errors.Wrap(rows.Err(), "list dep profile assignments")
+}
+
+func (db *SQLDB) DeleteAssignment(serial string) error {
+	_, err := db.Exec(`DELETE FROM dep_profile_assignments WHERE serial_number = ?`, serial)
+	return errors.Wrapf(err, "delete dep profile assignment of %s", serial)
+}
@@ -60,10 +60,70 @@ func NewHTTPClient(instance, token string, logger log.Logger, opts ...httptransp
 		).Endpoint()
 	}
 
+	var listProfilesEndpoint endpoint.Endpoint
+	{
+		listProfilesEndpoint = httptransport.NewClient(
+			"GET",
+			httputil.CopyURL(u, "/v1/dep/profiles"),
+			httputil.EncodeRequestWithToken(token, httptransport.EncodeJSONRequest),
+			decodeListProfilesResponse,
+			opts...,
+		).Endpoint()
+	}
+
+	var deleteProfileEndpoint endpoint.Endpoint
+	{
+		deleteProfileEndpoint = httptransport.NewClient(
+			"DELETE",
+			httputil.CopyURL(u, "/v1/dep/profiles"),
+			httputil.EncodeRequestWithToken(token, httptransport.EncodeJSONRequest),
+			decodeDeleteProfileResponse,
+			opts...,
+		).Endpoint()
+	}
+
+	var assignProfileEndpoint endpoint.Endpoint
+	{
+		assignProfileEndpoint = httptransport.NewClient(
+			"PUT",
+			httputil.CopyURL(u, "/v1/dep/profiles/devices"),
+			httputil.EncodeRequestWithToken(token, httptransport.EncodeJSONRequest),
+			decodeAssignProfileResponse,
+			opts...,
+		).Endpoint()
+	}
+
+	var removeProfileEndpoint endpoint.Endpoint
+	{
+		removeProfileEndpoint = httptransport.NewClient(
+			"DELETE",
+			httputil.CopyURL(u, "/v1/dep/profiles/devices"),
+			httputil.EncodeRequestWithToken(token, httptransport.EncodeJSONRequest),
+			decodeDevicesResponse,
+			opts...,
+		).Endpoint()
+	}
+
+	var disownDevicesEndpoint endpoint.Endpoint
+	{
+		disownDevicesEndpoint = httptransport.NewClient(
+			"POST",
+			httputil.CopyURL(u, "/v1/dep/devices/disown"),
+			httputil.EncodeRequestWithToken(token, httptransport.EncodeJSONRequest),
+			decodeDevicesResponse,
+			opts...,
+		).Endpoint()
+	}
+
 	return Endpoints{
 		DefineProfileEndpoint:    defineProfileEndpoint,
 		FetchProfileEndpoint:     fetchProfileEndpoint,
 		GetAccountInfoEndpoint:   getAccountInfoEndpoint,
 		GetDeviceDetailsEndpoint: getDeviceDetailsEndpoint,
+		AssignProfileEndpoint:    assignProfileEndpoint,
+		RemoveProfileEndpoint:    removeProfileEndpoint,
+		DisownDevicesEndpoint:    disownDevicesEndpoint,
+		ListProfilesEndpoint:     listProfilesEndpoint,
+		DeleteProfileEndpoint:    deleteProfileEndpoint,
 	}, nil
 }
@@ -2,7 +2,6 @@ package dep
 
 import (
 	"context"
-	"errors"
 	"net/http"
 
 	"github.com/go-kit/kit/endpoint"
@@ -11,14 +10,29 @@ import (
 	"github.com/vishnuvaradaraj/micromdm/pkg/httputil"
 )
 
-func (svc *DEPService) DefineProfile(ctx context.Context, p *dep.Profile) (*dep.ProfileResponse, error) {
-	if svc.client == nil {
-		return nil, errors.New("DEP not configured yet. add a DEP token to enable DEP")
+// DefineProfile defines a profile with DEP and saves it to the profile library
+// as the next version of its profile name. Devices listed in the profile are
+// recorded as assigned to it.
+func (svc *DEPService) DefineProfile(ctx context.Context, tokenName string, p *dep.Profile) (*dep.ProfileResponse, error) {
+	client, err := svc.client(tokenName)
+	if err != nil {
+		return nil, err
 	}
-	return svc.client.DefineProfile(p)
+	resp, err := client.DefineProfile(p)
+	if err != nil {
+		return nil, err
+	}
+	tokenName = instanceName(tokenName)
+	if err := svc.saveProfileVersion(tokenName, resp.ProfileUUID, p); err != nil {
+		return resp, err
+	}
+	return resp, svc.saveAssignments(tokenName, resp.ProfileUUID, resp.Devices)
 }
 
-type defineProfileRequest struct{ *dep.Profile }
+type defineProfileRequest struct {
+	TokenName string `json:"token_name,omitempty"`
+	*dep.Profile
+}
 type defineProfileResponse struct {
 	*dep.ProfileResponse
 	Err error `json:"err,omitempty"`
@@ -41,7 +55,7 @@ func decodeDefineProfileResponse(_ context.Context, r *http.Response) (interface
 func MakeDefineProfileEndpoint(svc Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		req := request.(defineProfileRequest)
-		resp, err := svc.DefineProfile(ctx, req.Profile)
+		resp, err := svc.DefineProfile(ctx, req.TokenName, req.Profile)
 		return &defineProfileResponse{
 			ProfileResponse: resp,
 			Err:             err,
@@ -49,8 +63,8 @@ func MakeDefineProfileEndpoint(svc Service) endpoint.Endpoint {
 	}
 }
 
-func (e Endpoints) DefineProfile(ctx context.Context, p *dep.Profile) (*dep.ProfileResponse, error) {
-	request := defineProfileRequest{Profile: p}
+func (e Endpoints) DefineProfile(ctx context.Context, tokenName string, p *dep.Profile) (*dep.ProfileResponse, error) {
+	request := defineProfileRequest{TokenName: tokenName, Profile: p}
 	resp, err := e.DefineProfileEndpoint(ctx, request)
 	if err != nil {
 		return nil, err
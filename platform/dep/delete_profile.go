@@ -0,0 +1,60 @@
+package dep
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/pkg/httputil"
+)
+
+// DeleteProfile deletes every version of a profile from the library. The DEP
+// API cannot delete profiles, so devices keep a profile which is assigned.
+func (svc *DEPService) DeleteProfile(ctx context.Context, tokenName, name string) error {
+	if svc.store == nil {
+		return errors.New("DEP profile library not configured")
+	}
+	return svc.store.DeleteProfile(instanceName(tokenName), name)
+}
+
+type deleteProfileRequest struct {
+	TokenName string `json:"token_name,omitempty"`
+	Name      string `json:"name"`
+}
+
+type deleteProfileResponse struct {
+	Err error `json:"err,omitempty"`
+}
+
+func (r deleteProfileResponse) Failed() error { return r.Err }
+
+func decodeDeleteProfileRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	var req deleteProfileRequest
+	err := httputil.DecodeJSONRequest(r, &req)
+	return req, err
+}
+
+func decodeDeleteProfileResponse(_ context.Context, r *http.Response) (interface{}, error) {
+	var resp deleteProfileResponse
+	err := httputil.DecodeJSONResponse(r, &resp)
+	return resp, err
+}
+
+func MakeDeleteProfileEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(deleteProfileRequest)
+		err = svc.DeleteProfile(ctx, req.TokenName, req.Name)
+		return deleteProfileResponse{Err: err}, nil
+	}
+}
+
+func (e Endpoints) DeleteProfile(ctx context.Context, tokenName, name string) error {
+	request := deleteProfileRequest{TokenName: tokenName, Name: name}
+	response, err := e.DeleteProfileEndpoint(ctx, request)
+	if err != nil {
+		return err
+	}
+	return response.(deleteProfileResponse).Err
+}
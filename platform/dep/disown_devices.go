@@ -0,0 +1,52 @@
+package dep
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+
+	"github.com/vishnuvaradaraj/micromdm/pkg/httputil"
+)
+
+// DisownDevices permanently removes devices from the DEP account, and forgets
+// their intended profile. Disowned devices cannot be added back to the account.
+func (svc *DEPService) DisownDevices(ctx context.Context, tokenName string, serials []string) (map[string]string, error) {
+	client, err := svc.client(tokenName)
+	if err != nil {
+		return nil, err
+	}
+	devices, err := client.DisownDevices(serials...)
+	if err != nil {
+		return nil, err
+	}
+	return devices, svc.deleteAssignments(devices)
+}
+
+type disownDevicesRequest struct {
+	TokenName string   `json:"token_name,omitempty"`
+	Serials   []string `json:"serials"`
+}
+
+func decodeDisownDevicesRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	var req disownDevicesRequest
+	err := httputil.DecodeJSONRequest(r, &req)
+	return req, err
+}
+
+func MakeDisownDevicesEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(disownDevicesRequest)
+		devices, err := svc.DisownDevices(ctx, req.TokenName, req.Serials)
+		return devicesResponse{Devices: devices, Err: err}, nil
+	}
+}
+
+func (e Endpoints) DisownDevices(ctx context.Context, tokenName string, serials []string) (map[string]string, error) {
+	request := disownDevicesRequest{TokenName: tokenName, Serials: serials}
+	response, err := e.DisownDevicesEndpoint(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	return response.(devicesResponse).Devices, response.(devicesResponse).Err
+}
@@ -2,7 +2,7 @@ package dep
 
 import (
 	"context"
-	"errors"
+	"io"
 	"net/http"
 
 	"github.com/go-kit/kit/endpoint"
@@ -11,14 +11,17 @@ import (
 	"github.com/vishnuvaradaraj/micromdm/pkg/httputil"
 )
 
-func (svc *DEPService) GetAccountInfo(ctx context.Context) (*dep.Account, error) {
-	if svc.client == nil {
-		return nil, errors.New("DEP not configured yet. add a DEP token to enable DEP")
+func (svc *DEPService) GetAccountInfo(ctx context.Context, tokenName string) (*dep.Account, error) {
+	client, err := svc.client(tokenName)
+	if err != nil {
+		return nil, err
 	}
-	return svc.client.Account()
+	return client.Account()
 }
 
-type getAccountInfoRequest struct{}
+type getAccountInfoRequest struct {
+	TokenName string `json:"token_name,omitempty"`
+}
 type getAccountInfoResponse struct {
 	*dep.Account
 	Err error `json:"err,omitempty"`
@@ -26,8 +29,14 @@ type getAccountInfoResponse struct {
 
 func (r getAccountInfoResponse) Failed() error { return r.Err }
 
+// decodeGetAccountInfoRequest accepts an empty body for the default DEP token.
 func decodeGetAccountInfoRequest(ctx context.Context, r *http.Request) (interface{}, error) {
-	return nil, nil
+	var req getAccountInfoRequest
+	err := httputil.DecodeJSONRequest(r, &req)
+	if err == io.EOF {
+		err = nil
+	}
+	return req, err
 }
 
 func decodeGetAccountInfoResponse(_ context.Context, r *http.Response) (interface{}, error) {
@@ -38,13 +47,14 @@ func decodeGetAccountInfoResponse(_ context.Context, r *http.Response) (interfac
 
 func MakeGetAccountInfoEndpoint(svc Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
-		account, err := svc.GetAccountInfo(ctx)
+		req := request.(getAccountInfoRequest)
+		account, err := svc.GetAccountInfo(ctx, req.TokenName)
 		return getAccountInfoResponse{Account: account, Err: err}, nil
 	}
 }
 
-func (e Endpoints) GetAccountInfo(ctx context.Context) (*dep.Account, error) {
-	request := getAccountInfoRequest{}
+func (e Endpoints) GetAccountInfo(ctx context.Context, tokenName string) (*dep.Account, error) {
+	request := getAccountInfoRequest{TokenName: tokenName}
 	response, err := e.GetAccountInfoEndpoint(ctx, request)
 	if err != nil {
 		return nil, err
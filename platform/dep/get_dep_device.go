@@ -2,7 +2,6 @@ package dep
 
 import (
 	"context"
-	"errors"
 	"net/http"
 
 	"github.com/go-kit/kit/endpoint"
@@ -11,15 +10,17 @@ import (
 	"github.com/vishnuvaradaraj/micromdm/pkg/httputil"
 )
 
-func (svc *DEPService) GetDeviceDetails(ctx context.Context, serials []string) (*dep.DeviceDetailsResponse, error) {
-	if svc.client == nil {
-		return nil, errors.New("DEP not configured yet. add a DEP token to enable DEP")
+func (svc *DEPService) GetDeviceDetails(ctx context.Context, tokenName string, serials []string) (*dep.DeviceDetailsResponse, error) {
+	client, err := svc.client(tokenName)
+	if err != nil {
+		return nil, err
 	}
-	return svc.client.DeviceDetails(serials...)
+	return client.DeviceDetails(serials...)
 }
 
 type deviceDetailsRequest struct {
-	Serials []string `json:"serials"`
+	Serials   []string `json:"serials"`
+	TokenName string   `json:"token_name,omitempty"`
 }
 
 type deviceDetailsResponse struct {
@@ -44,13 +45,13 @@ func decodeDeviceDetailsResponse(_ context.Context, r *http.Response) (interface
 func MakeGetDeviceDetailsEndpoint(svc Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		req := request.(deviceDetailsRequest)
-		details, err := svc.GetDeviceDetails(ctx, req.Serials)
+		details, err := svc.GetDeviceDetails(ctx, req.TokenName, req.Serials)
 		return deviceDetailsResponse{DeviceDetailsResponse: details, Err: err}, nil
 	}
 }
 
-func (e Endpoints) GetDeviceDetails(ctx context.Context, serials []string) (*dep.DeviceDetailsResponse, error) {
-	request := deviceDetailsRequest{Serials: serials}
+func (e Endpoints) GetDeviceDetails(ctx context.Context, tokenName string, serials []string) (*dep.DeviceDetailsResponse, error) {
+	request := deviceDetailsRequest{Serials: serials, TokenName: tokenName}
 	response, err := e.GetDeviceDetailsEndpoint(ctx, request)
 	if err != nil {
 		return nil, err
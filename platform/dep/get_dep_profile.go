@@ -2,7 +2,6 @@ package dep
 
 import (
 	"context"
-	"errors"
 	"net/http"
 
 	"github.com/go-kit/kit/endpoint"
@@ -11,15 +10,17 @@ import (
 	"github.com/vishnuvaradaraj/micromdm/pkg/httputil"
 )
 
-func (svc *DEPService) FetchProfile(ctx context.Context, uuid string) (*dep.Profile, error) {
-	if svc.client == nil {
-		return nil, errors.New("DEP not configured yet. add a DEP token to enable DEP")
+func (svc *DEPService) FetchProfile(ctx context.Context, tokenName, uuid string) (*dep.Profile, error) {
+	client, err := svc.client(tokenName)
+	if err != nil {
+		return nil, err
 	}
-	return svc.client.FetchProfile(uuid)
+	return client.FetchProfile(uuid)
 }
 
 type fetchProfileRequest struct {
-	UUID string `json:"uuid"`
+	UUID      string `json:"uuid"`
+	TokenName string `json:"token_name,omitempty"`
 }
 
 type fetchProfileResponse struct {
@@ -44,13 +45,13 @@ func decodeFetchProfileResponse(_ context.Context, r *http.Response) (interface{
 func MakeFetchProfileEndpoint(svc Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		req := request.(fetchProfileRequest)
-		profile, err := svc.FetchProfile(ctx, req.UUID)
+		profile, err := svc.FetchProfile(ctx, req.TokenName, req.UUID)
 		return fetchProfileResponse{Profile: profile, Err: err}, nil
 	}
 }
 
-func (e Endpoints) FetchProfile(ctx context.Context, uuid string) (*dep.Profile, error) {
-	request := fetchProfileRequest{UUID: uuid}
+func (e Endpoints) FetchProfile(ctx context.Context, tokenName, uuid string) (*dep.Profile, error) {
+	request := fetchProfileRequest{UUID: uuid, TokenName: tokenName}
 	response, err := e.FetchProfileEndpoint(ctx, request)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,69 @@
+package dep
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/pkg/httputil"
+)
+
+// ListProfiles returns the latest version of each profile in the library, or
+// every version of the profile called name.
+func (svc *DEPService) ListProfiles(ctx context.Context, tokenName, name string) ([]ProfileVersion, error) {
+	if svc.store == nil {
+		return nil, errors.New("DEP profile library not configured")
+	}
+	if name != "" {
+		return svc.store.ProfileVersions(instanceName(tokenName), name)
+	}
+	return svc.store.ListProfiles(instanceName(tokenName))
+}
+
+type listProfilesRequest struct {
+	TokenName string `json:"token_name,omitempty"`
+	Name      string `json:"name,omitempty"`
+}
+
+type listProfilesResponse struct {
+	Profiles []ProfileVersion `json:"profiles"`
+	Err      error            `json:"err,omitempty"`
+}
+
+func (r listProfilesResponse) Failed() error { return r.Err }
+
+// decodeListProfilesRequest accepts an empty body for the default DEP token.
+func decodeListProfilesRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	var req listProfilesRequest
+	err := httputil.DecodeJSONRequest(r, &req)
+	if err == io.EOF {
+		err = nil
+	}
+	return req, err
+}
+
+func decodeListProfilesResponse(_ context.Context, r *http.Response) (interface{}, error) {
+	var resp listProfilesResponse
+	err := httputil.DecodeJSONResponse(r, &resp)
+	return resp, err
+}
+
+func MakeListProfilesEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(listProfilesRequest)
+		profiles, err := svc.ListProfiles(ctx, req.TokenName, req.Name)
+		return listProfilesResponse{Profiles: profiles, Err: err}, nil
+	}
+}
+
+func (e Endpoints) ListProfiles(ctx context.Context, tokenName, name string) ([]ProfileVersion, error) {
+	request := listProfilesRequest{TokenName: tokenName, Name: name}
+	response, err := e.ListProfilesEndpoint(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	return response.(listProfilesResponse).Profiles, response.(listProfilesResponse).Err
+}
@@ -0,0 +1,98 @@
+package dep
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/dep"
+)
+
+// ProfileVersion is a DEP profile in the profile library. Defining a profile
+// saves a new version under its profile name, with the UUID Apple assigned to
+// it. Earlier versions are kept, so a profile can be restored or compared.
+type ProfileVersion struct {
+	TokenName   string       `json:"token_name"`
+	Name        string       `json:"name"`
+	Version     int          `json:"version"`
+	ProfileUUID string       `json:"profile_uuid"`
+	Profile     *dep.Profile `json:"profile"`
+	CreatedAt   time.Time    `json:"created_at"`
+}
+
+// Assignment is the DEP profile a device is intended to have. The Reconciler
+// assigns the profile again if the profile status of the device drifts.
+type Assignment struct {
+	SerialNumber string    `json:"serial_number"`
+	TokenName    string    `json:"token_name"`
+	ProfileUUID  string    `json:"profile_uuid"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// saveProfileVersion saves p as the next version of its profile.
+func (svc *DEPService) saveProfileVersion(tokenName, uuid string, p *dep.Profile) error {
+	if svc.store == nil || p.ProfileName == "" {
+		return nil
+	}
+	svc.libraryMtx.Lock()
+	defer svc.libraryMtx.Unlock()
+
+	versions, err := svc.store.ProfileVersions(tokenName, p.ProfileName)
+	if err != nil {
+		return errors.Wrapf(err, "get versions of profile %s", p.ProfileName)
+	}
+	next := 1
+	if n := len(versions); n > 0 {
+		next = versions[n-1].Version + 1
+	}
+
+	// devices are assigned separately and the UUID changes with every version.
+	profile := *p
+	profile.Devices = nil
+	profile.ProfileUUID = ""
+	v := &ProfileVersion{
+		TokenName:   tokenName,
+		Name:        p.ProfileName,
+		Version:     next,
+		ProfileUUID: uuid,
+		Profile:     &profile,
+		CreatedAt:   time.Now().UTC(),
+	}
+	return errors.Wrapf(svc.store.SaveProfileVersion(v), "save version %d of profile %s", next, p.ProfileName)
+}
+
+// saveAssignments records uuid as the intended profile of the devices which
+// were assigned successfully.
+func (svc *DEPService) saveAssignments(tokenName, uuid string, devices map[string]string) error {
+	if svc.store == nil {
+		return nil
+	}
+	now := time.Now().UTC()
+	for serial, status := range devices {
+		if status != "SUCCESS" {
+			continue
+		}
+		a := &Assignment{SerialNumber: serial, TokenName: tokenName, ProfileUUID: uuid, CreatedAt: now}
+		if err := svc.store.SaveAssignment(a); err != nil {
+			return errors.Wrapf(err, "save profile assignment of %s", serial)
+		}
+	}
+	return nil
+}
+
+// deleteAssignments forgets the intended profile of the devices which were
+// unassigned or disowned successfully.
+func (svc *DEPService) deleteAssignments(devices map[string]string) error {
+	if svc.store == nil {
+		return nil
+	}
+	for serial, status := range devices {
+		if status != "SUCCESS" {
+			continue
+		}
+		if err := svc.store.DeleteAssignment(serial); err != nil {
+			return errors.Wrapf(err, "delete profile assignment of %s", serial)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+package dep
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+
+	depsync "github.com/vishnuvaradaraj/micromdm/platform/dep/sync"
+	"github.com/vishnuvaradaraj/micromdm/platform/device"
+	"github.com/vishnuvaradaraj/micromdm/platform/pubsub"
+)
+
+// DefaultReconcileInterval is how often the Reconciler compares devices with
+// their intended profile.
+const DefaultReconcileInterval = 30 * time.Minute
+
+type DeviceStore interface {
+	DeviceBySerial(serial string) (*device.Device, error)
+}
+
+// Reconciler assigns the intended profile again to devices whose DEP profile
+// status drifted from it, for example after the profile was removed in Apple
+// Business Manager or the device was assigned a different profile.
+//
+// The status of a device is updated by the DEP sync, so a device is assigned
+// at most once every two intervals to give the sync time to report the new
+// status. The assignments of devices which the DEP sync reports as deleted,
+// or which DEP reports as not accessible, are dropped.
+type Reconciler struct {
+	svc      Service
+	store    Store
+	devices  DeviceStore
+	sub      pubsub.Subscriber
+	logger   log.Logger
+	interval time.Duration
+	leader   func() bool
+	now      func() time.Time
+
+	mu         sync.Mutex
+	reassigned map[string]time.Time
+}
+
+type ReconcilerOption func(*Reconciler)
+
+// WithReconcileInterval sets how often devices are compared with their
+// intended profile.
+func WithReconcileInterval(interval time.Duration) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.interval = interval
+	}
+}
+
+// WithReconcileLeader only reconciles while held returns true, so that a
+// single server reassigns the profiles of devices shared by several servers.
+func WithReconcileLeader(held func() bool) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.leader = held
+	}
+}
+
+func NewReconciler(svc Service, store Store, devices DeviceStore, sub pubsub.Subscriber, logger log.Logger, opts ...ReconcilerOption) *Reconciler {
+	r := &Reconciler{
+		svc:        svc,
+		store:      store,
+		devices:    devices,
+		sub:        sub,
+		logger:     logger,
+		interval:   DefaultReconcileInterval,
+		now:        time.Now,
+		reassigned: make(map[string]time.Time),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Run reconciles every interval until ctx is done.
+func (r *Reconciler) Run(ctx context.Context) error {
+	const subscription = "dep_reconcile"
+	syncEvents, err := r.sub.Subscribe(ctx, subscription, depsync.SyncTopic)
+	if err != nil {
+		return errors.Wrapf(err, "subscribing %s to %s", subscription, depsync.SyncTopic)
+	}
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ev := <-syncEvents:
+			if err := r.synced(ev.Message); err != nil {
+				level.Info(r.logger).Log("msg", "drop profile assignments of deleted DEP devices", "err", err)
+			}
+		case <-ticker.C:
+			if r.leader != nil && !r.leader() {
+				continue
+			}
+			if err := r.reconcile(ctx); err != nil {
+				level.Info(r.logger).Log("msg", "reconcile DEP profile assignments", "err", err)
+			}
+		}
+	}
+}
+
+// synced drops the assignments of the devices which a DEP sync reports as
+// deleted from the DEP token they were assigned with.
+func (r *Reconciler) synced(message []byte) error {
+	var ev depsync.Event
+	if err := depsync.UnmarshalEvent(message, &ev); err != nil {
+		return errors.Wrap(err, "unmarshal depsync event")
+	}
+	deleted := make(map[string]bool)
+	for _, d := range ev.Devices {
+		if d.OpType == "deleted" {
+			deleted[d.SerialNumber] = true
+		}
+	}
+	if len(deleted) == 0 {
+		return nil
+	}
+	assignments, err := r.store.Assignments()
+	if err != nil {
+		return errors.Wrap(err, "list profile assignments")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, a := range assignments {
+		if !deleted[a.SerialNumber] || instanceName(a.TokenName) != instanceName(ev.TokenName) {
+			continue
+		}
+		if err := r.drop(a.SerialNumber, "deleted"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// drop deletes the assignment of a device which DEP no longer manages. It
+// must be called with mu held.
+func (r *Reconciler) drop(serial, reason string) error {
+	level.Info(r.logger).Log("msg", "dropping DEP profile assignment", "serial", serial, "reason", reason)
+	delete(r.reassigned, serial)
+	return errors.Wrapf(r.store.DeleteAssignment(serial), "delete profile assignment of %s", serial)
+}
+
+// drifted reports whether the DEP profile of a device differs from the
+// intended one.
+func drifted(dev *device.Device, a Assignment) bool {
+	switch dev.DEPProfileStatus {
+	case device.ASSIGNED, device.PUSHED:
+		return dev.DEPProfileUUID != a.ProfileUUID
+	default:
+		return true
+	}
+}
+
+func (r *Reconciler) reconcile(ctx context.Context) error {
+	assignments, err := r.store.Assignments()
+	if err != nil {
+		return errors.Wrap(err, "list profile assignments")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+
+	type target struct{ tokenName, profileUUID string }
+	var targets []target
+	serials := make(map[target][]string)
+	seen := make(map[string]bool, len(assignments))
+	for _, a := range assignments {
+		seen[a.SerialNumber] = true
+		dev, err := r.devices.DeviceBySerial(a.SerialNumber)
+		if isNotFound(err) {
+			// not reported by the DEP sync yet.
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "retrieve device with serial %s", a.SerialNumber)
+		}
+		if !drifted(dev, a) {
+			delete(r.reassigned, a.SerialNumber)
+			continue
+		}
+		if t, ok := r.reassigned[a.SerialNumber]; ok && now.Sub(t) < 2*r.interval {
+			continue
+		}
+		level.Info(r.logger).Log(
+			"msg", "DEP profile drifted",
+			"serial", a.SerialNumber,
+			"status", dev.DEPProfileStatus,
+			"profile_uuid", dev.DEPProfileUUID,
+			"want_profile_uuid", a.ProfileUUID,
+		)
+		t := target{tokenName: a.TokenName, profileUUID: a.ProfileUUID}
+		if _, ok := serials[t]; !ok {
+			targets = append(targets, t)
+		}
+		serials[t] = append(serials[t], a.SerialNumber)
+	}
+
+	// forget devices which no longer have an assignment.
+	for serial := range r.reassigned {
+		if !seen[serial] {
+			delete(r.reassigned, serial)
+		}
+	}
+
+	for _, t := range targets {
+		sort.Strings(serials[t])
+		for _, serial := range serials[t] {
+			r.reassigned[serial] = now
+		}
+		resp, err := r.svc.AssignProfile(ctx, t.tokenName, t.profileUUID, serials[t])
+		if err != nil {
+			level.Info(r.logger).Log(
+				"msg", "assign intended DEP profile",
+				"dep_token", t.tokenName,
+				"profile_uuid", t.profileUUID,
+				"err", err,
+			)
+			continue
+		}
+		for serial, status := range resp.Devices {
+			switch status {
+			case "SUCCESS":
+			case "NOT_ACCESSIBLE":
+				// the device was removed from the DEP token, assigning
+				// it again would fail forever.
+				if err := r.drop(serial, status); err != nil {
+					level.Info(r.logger).Log("msg", "drop DEP profile assignment", "serial", serial, "err", err)
+				}
+			default:
+				level.Info(r.logger).Log("msg", "assign intended DEP profile", "serial", serial, "status", status)
+			}
+		}
+	}
+	return nil
+}
+
+func isNotFound(err error) bool {
+	e, ok := errors.Cause(err).(interface{ NotFound() bool })
+	return ok && e.NotFound()
+}
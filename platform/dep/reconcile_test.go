@@ -0,0 +1,115 @@
+package dep
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/vishnuvaradaraj/micromdm/dep"
+	depsync "github.com/vishnuvaradaraj/micromdm/platform/dep/sync"
+	"github.com/vishnuvaradaraj/micromdm/platform/device"
+	"github.com/vishnuvaradaraj/micromdm/platform/pubsub/inmem"
+)
+
+func TestReconcile(t *testing.T) {
+	svc, client, store := newTestService()
+	ctx := context.Background()
+	if _, err := svc.AssignProfile(ctx, "", "uuid-1", []string{"C02-1", "C02-2", "C02-3"}); err != nil {
+		t.Fatal(err)
+	}
+	devices := fakeDevices{
+		"C02-1": {SerialNumber: "C02-1", DEPProfileStatus: device.REMOVED},
+		"C02-2": {SerialNumber: "C02-2", DEPProfileStatus: device.PUSHED, DEPProfileUUID: "uuid-1"},
+		// C02-3 has not been reported by the DEP sync yet.
+	}
+	client.assigned = make(map[string]string)
+
+	start := time.Date(2018, 9, 1, 12, 0, 0, 0, time.UTC)
+	r := NewReconciler(svc, store, devices, inmem.NewPubSub(), log.NewNopLogger(), WithReconcileInterval(10*time.Minute))
+	steps := []struct {
+		at       time.Duration
+		assigned []string
+	}{
+		{0, []string{"C02-1"}},
+		{10 * time.Minute, nil}, // waiting for the sync to report the new status
+		{20 * time.Minute, []string{"C02-1"}},
+	}
+	for _, step := range steps {
+		r.now = func() time.Time { return start.Add(step.at) }
+		if err := r.reconcile(ctx); err != nil {
+			t.Fatal(err)
+		}
+		var assigned []string
+		for serial, uuid := range client.assigned {
+			if uuid != "uuid-1" {
+				t.Errorf("at %s: have %s assigned %s, want uuid-1", step.at, serial, uuid)
+			}
+			assigned = append(assigned, serial)
+		}
+		sort.Strings(assigned)
+		if have, want := fmt.Sprint(assigned), fmt.Sprint(step.assigned); have != want {
+			t.Errorf("at %s: have assigned %s, want %s", step.at, have, want)
+		}
+		client.assigned = make(map[string]string)
+	}
+
+	// a different profile is drift too.
+	devices["C02-1"].DEPProfileStatus = device.ASSIGNED
+	devices["C02-1"].DEPProfileUUID = "uuid-other"
+	r.now = func() time.Time { return start.Add(time.Hour) }
+	if err := r.reconcile(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := client.assigned["C02-1"], "uuid-1"; have != want {
+		t.Errorf("have C02-1 assigned %q, want %q", have, want)
+	}
+}
+
+func TestReconcileDrop(t *testing.T) {
+	svc, client, store := newTestService()
+	ctx := context.Background()
+	serials := []string{"C02-GONE", "C02-DELETED", "C02-KEPT"}
+	if _, err := svc.AssignProfile(ctx, "", "uuid-1", serials); err != nil {
+		t.Fatal(err)
+	}
+	devices := make(fakeDevices)
+	for _, serial := range serials {
+		devices[serial] = &device.Device{SerialNumber: serial, DEPProfileStatus: device.REMOVED}
+	}
+	client.results = map[string]string{"C02-GONE": "NOT_ACCESSIBLE"}
+	r := NewReconciler(svc, store, devices, inmem.NewPubSub(), log.NewNopLogger())
+
+	// DEP reports the device as not accessible.
+	if err := r.reconcile(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// the devices are deleted from the default token, and from another.
+	for _, tokenName := range []string{"", "school"} {
+		serial := "C02-DELETED"
+		if tokenName != "" {
+			serial = "C02-KEPT"
+		}
+		msg, err := depsync.MarshalEvent(depsync.NewEvent(tokenName, []dep.Device{{SerialNumber: serial, OpType: "deleted"}}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := r.synced(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	assignments, err := store.Assignments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(assignments) != 1 || assignments[0].SerialNumber != "C02-KEPT" {
+		t.Errorf("have assignments %+v, want only C02-KEPT", assignments)
+	}
+	if _, ok := r.reassigned["C02-GONE"]; ok {
+		t.Error("have C02-GONE waiting to be reassigned, want it forgotten")
+	}
+}
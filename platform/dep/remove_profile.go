@@ -0,0 +1,65 @@
+package dep
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+
+	"github.com/vishnuvaradaraj/micromdm/pkg/httputil"
+)
+
+// RemoveProfile unassigns the profile of devices, and forgets their intended
+// profile.
+func (svc *DEPService) RemoveProfile(ctx context.Context, tokenName string, serials []string) (map[string]string, error) {
+	client, err := svc.client(tokenName)
+	if err != nil {
+		return nil, err
+	}
+	devices, err := client.RemoveProfile(serials...)
+	if err != nil {
+		return nil, err
+	}
+	return devices, svc.deleteAssignments(devices)
+}
+
+type removeProfileRequest struct {
+	TokenName string   `json:"token_name,omitempty"`
+	Serials   []string `json:"serials"`
+}
+
+type devicesResponse struct {
+	Devices map[string]string `json:"devices,omitempty"`
+	Err     error             `json:"err,omitempty"`
+}
+
+func (r devicesResponse) Failed() error { return r.Err }
+
+func decodeRemoveProfileRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	var req removeProfileRequest
+	err := httputil.DecodeJSONRequest(r, &req)
+	return req, err
+}
+
+func decodeDevicesResponse(_ context.Context, r *http.Response) (interface{}, error) {
+	var resp devicesResponse
+	err := httputil.DecodeJSONResponse(r, &resp)
+	return resp, err
+}
+
+func MakeRemoveProfileEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(removeProfileRequest)
+		devices, err := svc.RemoveProfile(ctx, req.TokenName, req.Serials)
+		return devicesResponse{Devices: devices, Err: err}, nil
+	}
+}
+
+func (e Endpoints) RemoveProfile(ctx context.Context, tokenName string, serials []string) (map[string]string, error) {
+	request := removeProfileRequest{TokenName: tokenName, Serials: serials}
+	response, err := e.RemoveProfileEndpoint(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	return response.(devicesResponse).Devices, response.(devicesResponse).Err
+}
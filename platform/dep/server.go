@@ -13,6 +13,11 @@ type Endpoints struct {
 	FetchProfileEndpoint     endpoint.Endpoint
 	GetAccountInfoEndpoint   endpoint.Endpoint
 	GetDeviceDetailsEndpoint endpoint.Endpoint
+	AssignProfileEndpoint    endpoint.Endpoint
+	RemoveProfileEndpoint    endpoint.Endpoint
+	DisownDevicesEndpoint    endpoint.Endpoint
+	ListProfilesEndpoint     endpoint.Endpoint
+	DeleteProfileEndpoint    endpoint.Endpoint
 }
 
 func MakeServerEndpoints(s Service, outer endpoint.Middleware, others ...endpoint.Middleware) Endpoints {
@@ -21,6 +26,11 @@ func MakeServerEndpoints(s Service, outer endpoint.Middleware, others ...endpoin
 		FetchProfileEndpoint:     endpoint.Chain(outer, others...)(MakeFetchProfileEndpoint(s)),
 		GetAccountInfoEndpoint:   endpoint.Chain(outer, others...)(MakeGetAccountInfoEndpoint(s)),
 		GetDeviceDetailsEndpoint: endpoint.Chain(outer, others...)(MakeGetDeviceDetailsEndpoint(s)),
+		AssignProfileEndpoint:    endpoint.Chain(outer, others...)(MakeAssignProfileEndpoint(s)),
+		RemoveProfileEndpoint:    endpoint.Chain(outer, others...)(MakeRemoveProfileEndpoint(s)),
+		DisownDevicesEndpoint:    endpoint.Chain(outer, others...)(MakeDisownDevicesEndpoint(s)),
+		ListProfilesEndpoint:     endpoint.Chain(outer, others...)(MakeListProfilesEndpoint(s)),
+		DeleteProfileEndpoint:    endpoint.Chain(outer, others...)(MakeDeleteProfileEndpoint(s)),
 	}
 }
 
@@ -29,6 +39,11 @@ func RegisterHTTPHandlers(r *mux.Router, e Endpoints, options ...httptransport.S
 	// POST		/v1/dep/profiles		get a DEP profile given a known profile UUID
 	// GET		/v1/dep/account			get information about the dep account
 	// POST		/v1/dep/devices			get device details given a list of serials
+	// GET		/v1/dep/profiles		list the DEP profile library
+	// DELETE	/v1/dep/profiles		delete a profile from the DEP profile library
+	// PUT		/v1/dep/profiles/devices	assign a DEP profile to devices
+	// DELETE	/v1/dep/profiles/devices	unassign the DEP profile of devices
+	// POST		/v1/dep/devices/disown		remove devices from the DEP account
 
 	r.Methods("PUT").Path("/v1/dep/profiles").Handler(httptransport.NewServer(
 		e.DefineProfileEndpoint,
@@ -57,4 +72,39 @@ func RegisterHTTPHandlers(r *mux.Router, e Endpoints, options ...httptransport.S
 		httputil.EncodeJSONResponse,
 		options...,
 	))
+
+	r.Methods("GET").Path("/v1/dep/profiles").Handler(httptransport.NewServer(
+		e.ListProfilesEndpoint,
+		decodeListProfilesRequest,
+		httputil.EncodeJSONResponse,
+		options...,
+	))
+
+	r.Methods("DELETE").Path("/v1/dep/profiles").Handler(httptransport.NewServer(
+		e.DeleteProfileEndpoint,
+		decodeDeleteProfileRequest,
+		httputil.EncodeJSONResponse,
+		options...,
+	))
+
+	r.Methods("PUT").Path("/v1/dep/profiles/devices").Handler(httptransport.NewServer(
+		e.AssignProfileEndpoint,
+		decodeAssignProfileRequest,
+		httputil.EncodeJSONResponse,
+		options...,
+	))
+
+	r.Methods("DELETE").Path("/v1/dep/profiles/devices").Handler(httptransport.NewServer(
+		e.RemoveProfileEndpoint,
+		decodeRemoveProfileRequest,
+		httputil.EncodeJSONResponse,
+		options...,
+	))
+
+	r.Methods("POST").Path("/v1/dep/devices/disown").Handler(httptransport.NewServer(
+		e.DisownDevicesEndpoint,
+		decodeDisownDevicesRequest,
+		httputil.EncodeJSONResponse,
+		options...,
+	))
 }
@@ -4,15 +4,25 @@ import (
 	"context"
 	"sync"
 
+	"github.com/pkg/errors"
+
 	"github.com/vishnuvaradaraj/micromdm/dep"
+	"github.com/vishnuvaradaraj/micromdm/platform/config"
 	"github.com/vishnuvaradaraj/micromdm/platform/pubsub"
 )
 
+// Service proxies requests to the DEP API. The token name selects the DEP
+// server, and an empty name is the default token.
 type Service interface {
-	DefineProfile(ctx context.Context, p *dep.Profile) (*dep.ProfileResponse, error)
-	GetAccountInfo(ctx context.Context) (*dep.Account, error)
-	GetDeviceDetails(ctx context.Context, serials []string) (*dep.DeviceDetailsResponse, error)
-	FetchProfile(ctx context.Context, uuid string) (*dep.Profile, error)
+	DefineProfile(ctx context.Context, tokenName string, p *dep.Profile) (*dep.ProfileResponse, error)
+	GetAccountInfo(ctx context.Context, tokenName string) (*dep.Account, error)
+	GetDeviceDetails(ctx context.Context, tokenName string, serials []string) (*dep.DeviceDetailsResponse, error)
+	FetchProfile(ctx context.Context, tokenName, uuid string) (*dep.Profile, error)
+	AssignProfile(ctx context.Context, tokenName, uuid string, serials []string) (*dep.ProfileResponse, error)
+	RemoveProfile(ctx context.Context, tokenName string, serials []string) (map[string]string, error)
+	DisownDevices(ctx context.Context, tokenName string, serials []string) (map[string]string, error)
+	ListProfiles(ctx context.Context, tokenName, name string) ([]ProfileVersion, error)
+	DeleteProfile(ctx context.Context, tokenName, name string) error
 }
 
 type DEPClient interface {
@@ -21,18 +31,72 @@ type DEPClient interface {
 	FetchProfile(string) (*dep.Profile, error)
 	Account() (*dep.Account, error)
 	DeviceDetails(...string) (*dep.DeviceDetailsResponse, error)
+	RemoveProfile(...string) (map[string]string, error)
+	DisownDevices(...string) (map[string]string, error)
+}
+
+// Store persists the DEP profile library and the profile each device is
+// intended to have.
+type Store interface {
+	// SaveProfileVersion saves a version of a profile. Versions are never
+	// overwritten by a later version.
+	SaveProfileVersion(v *ProfileVersion) error
+	// ProfileVersions returns every version of a profile, oldest first.
+	ProfileVersions(tokenName, name string) ([]ProfileVersion, error)
+	// ListProfiles returns the latest version of each profile of a token.
+	ListProfiles(tokenName string) ([]ProfileVersion, error)
+	// DeleteProfile deletes every version of a profile.
+	DeleteProfile(tokenName, name string) error
+
+	SaveAssignment(a *Assignment) error
+	Assignments() ([]Assignment, error)
+	// DeleteAssignment deletes the assignment of a device, if there is one.
+	DeleteAssignment(serial string) error
 }
 
 type DEPService struct {
 	mtx        sync.RWMutex
-	client     DEPClient
+	clients    map[string]DEPClient
+	store      Store
 	subscriber pubsub.Subscriber
+
+	// libraryMtx serializes the numbering of profile versions.
+	libraryMtx sync.Mutex
 }
 
 func (svc *DEPService) Run() error {
 	return svc.watchTokenUpdates(svc.subscriber)
 }
 
-func New(client DEPClient, subscriber pubsub.Subscriber) *DEPService {
-	return &DEPService{client: client, subscriber: subscriber}
+// New creates a DEPService with a client for each DEP token, keyed by name.
+// Defined profiles and assignments are saved to store.
+func New(clients map[string]DEPClient, store Store, subscriber pubsub.Subscriber) *DEPService {
+	if clients == nil {
+		clients = make(map[string]DEPClient)
+	}
+	return &DEPService{clients: clients, store: store, subscriber: subscriber}
+}
+
+// client returns the client of the DEP token named tokenName.
+func (svc *DEPService) client(tokenName string) (DEPClient, error) {
+	tokenName = instanceName(tokenName)
+	svc.mtx.RLock()
+	defer svc.mtx.RUnlock()
+	if len(svc.clients) == 0 {
+		return nil, errors.New("DEP not configured yet. add a DEP token to enable DEP")
+	}
+	client, ok := svc.clients[tokenName]
+	if !ok {
+		return nil, errors.Errorf("no DEP token named %s", tokenName)
+	}
+	return client, nil
+}
+
+// instanceName returns the name of a DEP token, where an empty name is the
+// default token.
+func instanceName(tokenName string) string {
+	if tokenName == "" {
+		return config.DefaultDEPTokenName
+	}
+	return tokenName
 }
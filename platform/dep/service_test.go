@@ -0,0 +1,192 @@
+package dep
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/vishnuvaradaraj/micromdm/dep"
+	"github.com/vishnuvaradaraj/micromdm/platform/device"
+)
+
+type notFound struct{}
+
+func (notFound) Error() string  { return "not found" }
+func (notFound) NotFound() bool { return true }
+
+// fakeClient defines profiles with numbered UUIDs and records assignments.
+type fakeClient struct {
+	defined  int
+	assigned map[string]string
+	// results are the statuses of the assignments which do not succeed, by
+	// serial number.
+	results map[string]string
+}
+
+func (c *fakeClient) DefineProfile(p *dep.Profile) (*dep.ProfileResponse, error) {
+	c.defined++
+	uuid := "uuid-" + strconv.Itoa(c.defined)
+	devices := make(map[string]string)
+	for _, serial := range p.Devices {
+		c.assigned[serial] = uuid
+		devices[serial] = "SUCCESS"
+	}
+	return &dep.ProfileResponse{ProfileUUID: uuid, Devices: devices}, nil
+}
+
+func (c *fakeClient) AssignProfile(uuid string, serials ...string) (*dep.ProfileResponse, error) {
+	devices := make(map[string]string)
+	for _, serial := range serials {
+		if status, ok := c.results[serial]; ok {
+			devices[serial] = status
+			continue
+		}
+		c.assigned[serial] = uuid
+		devices[serial] = "SUCCESS"
+	}
+	return &dep.ProfileResponse{ProfileUUID: uuid, Devices: devices}, nil
+}
+
+func (c *fakeClient) RemoveProfile(serials ...string) (map[string]string, error) {
+	devices := make(map[string]string)
+	for _, serial := range serials {
+		delete(c.assigned, serial)
+		devices[serial] = "SUCCESS"
+	}
+	return devices, nil
+}
+
+func (c *fakeClient) DisownDevices(serials ...string) (map[string]string, error) {
+	return c.RemoveProfile(serials...)
+}
+
+func (c *fakeClient) FetchProfile(string) (*dep.Profile, error)                   { return nil, nil }
+func (c *fakeClient) Account() (*dep.Account, error)                              { return nil, nil }
+func (c *fakeClient) DeviceDetails(...string) (*dep.DeviceDetailsResponse, error) { return nil, nil }
+
+type memStore struct {
+	mtx         sync.Mutex
+	versions    []ProfileVersion
+	assignments map[string]Assignment
+}
+
+func (s *memStore) SaveProfileVersion(v *ProfileVersion) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.versions = append(s.versions, *v)
+	return nil
+}
+
+func (s *memStore) ProfileVersions(tokenName, name string) ([]ProfileVersion, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	var versions []ProfileVersion
+	for _, v := range s.versions {
+		if v.TokenName == tokenName && v.Name == name {
+			versions = append(versions, v)
+		}
+	}
+	return versions, nil
+}
+
+func (s *memStore) ListProfiles(tokenName string) ([]ProfileVersion, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	latest := make(map[string]ProfileVersion)
+	for _, v := range s.versions {
+		if v.TokenName == tokenName {
+			latest[v.Name] = v
+		}
+	}
+	var profiles []ProfileVersion
+	for _, v := range latest {
+		profiles = append(profiles, v)
+	}
+	return profiles, nil
+}
+
+func (s *memStore) DeleteProfile(tokenName, name string) error { return nil }
+
+func (s *memStore) SaveAssignment(a *Assignment) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.assignments[a.SerialNumber] = *a
+	return nil
+}
+
+func (s *memStore) Assignments() ([]Assignment, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	var assignments []Assignment
+	for _, a := range s.assignments {
+		assignments = append(assignments, a)
+	}
+	sort.Slice(assignments, func(i, j int) bool { return assignments[i].SerialNumber < assignments[j].SerialNumber })
+	return assignments, nil
+}
+
+func (s *memStore) DeleteAssignment(serial string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	delete(s.assignments, serial)
+	return nil
+}
+
+type fakeDevices map[string]*device.Device
+
+func (d fakeDevices) DeviceBySerial(serial string) (*device.Device, error) {
+	dev, ok := d[serial]
+	if !ok {
+		return nil, notFound{}
+	}
+	return dev, nil
+}
+
+func newTestService() (*DEPService, *fakeClient, *memStore) {
+	client := &fakeClient{assigned: make(map[string]string)}
+	store := &memStore{assignments: make(map[string]Assignment)}
+	svc := New(map[string]DEPClient{"default": client}, store, nil)
+	return svc, client, store
+}
+
+func TestProfileLibrary(t *testing.T) {
+	svc, _, store := newTestService()
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		p := &dep.Profile{ProfileName: "Staff", Devices: []string{"C02-1"}, IsSupervised: i == 1}
+		if _, err := svc.DefineProfile(ctx, "", p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	profiles, err := svc.ListProfiles(ctx, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(profiles) != 1 || profiles[0].Version != 2 || profiles[0].ProfileUUID != "uuid-2" {
+		t.Fatalf("have library %+v, want version 2 of Staff", profiles)
+	}
+	if v := profiles[0]; v.TokenName != "default" || len(v.Profile.Devices) != 0 || !v.Profile.IsSupervised {
+		t.Errorf("have saved version %+v", v)
+	}
+	versions, err := svc.ListProfiles(ctx, "default", "Staff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(versions), 2; have != want {
+		t.Errorf("have %d versions, want %d", have, want)
+	}
+
+	if have, want := store.assignments["C02-1"].ProfileUUID, "uuid-2"; have != want {
+		t.Errorf("have assignment of %s, want %s", have, want)
+	}
+	if _, err := svc.RemoveProfile(ctx, "", []string{"C02-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if a, ok := store.assignments["C02-1"]; ok {
+		t.Errorf("have assignment %+v after removing the profile", a)
+	}
+}
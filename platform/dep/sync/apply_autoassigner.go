@@ -11,6 +11,9 @@ import (
 )
 
 func (s DEPSyncService) ApplyAutoAssigner(ctx context.Context, aa *AutoAssigner) error {
+	if _, err := parseFilter(aa.Filter); err != nil {
+		return err
+	}
 	err := s.db.SaveAutoAssigner(aa)
 	return errors.Wrap(err, "saving AutoAssigner")
 }
@@ -1,107 +1,241 @@
 package builtin
 
 import (
+	"context"
 	"encoding/json"
-	"google.golang.org/api/iterator"
+	"strings"
 
 	"cloud.google.com/go/firestore"
-	"context"
 	"github.com/boltdb/bolt"
 	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
+	"github.com/vishnuvaradaraj/micromdm/platform/config"
 	"github.com/vishnuvaradaraj/micromdm/platform/dep/sync"
 )
 
 const (
-	ConfigBucket     = "mdm.DEPConfig"
-	AutoAssignBucket = "mdm.DEPAutoAssign"
+	ConfigBucket          = "mdm.DEPConfig"
+	AutoAssignBucket      = "mdm.DEPAutoAssign"
+	AutoAssignRetryBucket = "mdm.DEPAutoAssignRetries"
 )
 
-type FireDB struct {
-	*firestore.Client
-}
+// The cursor and auto-assigners of the default DEP token keep the keys they had
+// before DEP tokens were named. Other tokens prefix the key with their name.
+const (
+	cursorKeyPrefix = "configuration"
+	tokenNameSep    = ":"
+)
 
-func NewFireDB(db *firestore.Client) (*FireDB, error) {
-	datastore := &FireDB{Client: db}
-	return datastore, nil
+func isDefaultToken(tokenName string) bool {
+	return tokenName == "" || tokenName == config.DefaultDEPTokenName
 }
 
-func (db *FireDB) LoadCursor() (*sync.Cursor, error) {
+func cursorKey(tokenName string) string {
+	if isDefaultToken(tokenName) {
+		return cursorKeyPrefix
+	}
+	return cursorKeyPrefix + tokenNameSep + tokenName
+}
 
-	var cur sync.Cursor
+// CursorTokenName returns the DEP token name of a stored cursor key.
+func CursorTokenName(key string) (string, bool) {
+	if key == cursorKeyPrefix {
+		return config.DefaultDEPTokenName, true
+	}
+	if !strings.HasPrefix(key, cursorKeyPrefix+tokenNameSep) {
+		return "", false
+	}
+	return strings.TrimPrefix(key, cursorKeyPrefix+tokenNameSep), true
+}
 
-	ctx := context.Background()
+// Filters are escaped in keys, as Firestore document IDs can not contain "/"
+// and ":" separates the token name.
+var (
+	filterKeyEscaper   = strings.NewReplacer("%", "%25", "/", "%2F", ":", "%3A")
+	filterKeyUnescaper = strings.NewReplacer("%2F", "/", "%3A", ":", "%25", "%")
+)
 
-	doc, err := db.Collection(ConfigBucket).Doc("configuration").Get(ctx)
-	if err != nil {
-		return nil, err
+func autoAssignerKey(tokenName, filter string) string {
+	filter = filterKeyEscaper.Replace(filter)
+	if isDefaultToken(tokenName) {
+		return filter
 	}
+	return tokenName + tokenNameSep + filter
+}
 
-	err = doc.DataTo(&cur)
-	if err != nil {
-		return nil, err
+func splitAutoAssignerKey(key string) (tokenName, filter string) {
+	tokenName = config.DefaultDEPTokenName
+	if i := strings.Index(key, tokenNameSep); i >= 0 {
+		tokenName, key = key[:i], key[i+1:]
 	}
+	return tokenName, filterKeyUnescaper.Replace(key)
+}
 
-	return &cur, nil
+// autoAssignerValue is the stored value of an auto-assigner. Auto-assigners
+// stored before they had a priority are stored as the bare profile UUID.
+type autoAssignerValue struct {
+	ProfileUUID string `json:"profile_uuid"`
+	Priority    int    `json:"priority,omitempty"`
 }
 
-func (db *FireDB) SaveCursor(c sync.Cursor) error {
+func marshalAutoAssigner(a *sync.AutoAssigner) ([]byte, error) {
+	return json.Marshal(autoAssignerValue{ProfileUUID: a.ProfileUUID, Priority: a.Priority})
+}
 
-	ctx := context.Background()
+// UnmarshalAutoAssigner returns the auto-assigner stored with key and value.
+func UnmarshalAutoAssigner(key string, value []byte) sync.AutoAssigner {
+	name, filter := splitAutoAssignerKey(key)
+	a := sync.AutoAssigner{Filter: filter, TokenName: name}
+	var v autoAssignerValue
+	if err := json.Unmarshal(value, &v); err == nil {
+		a.ProfileUUID, a.Priority = v.ProfileUUID, v.Priority
+	} else {
+		a.ProfileUUID = string(value)
+	}
+	return a
+}
 
-	_, err := db.Collection(ConfigBucket).Doc("configuration").Set(ctx, c)
-	if err != nil {
-		return err
+// retriesKey is the key of the auto-assign retries of a DEP token.
+func retriesKey(tokenName string) string {
+	if isDefaultToken(tokenName) {
+		return config.DefaultDEPTokenName
 	}
+	return tokenName
+}
 
-	return nil
+func marshalRetries(pending []sync.PendingAssignment) ([]byte, error) {
+	v, err := json.Marshal(pending)
+	return v, errors.Wrap(err, "marshal auto-assign retries")
 }
 
-func (db *FireDB) SaveAutoAssigner(a *sync.AutoAssigner) error {
-	if a.Filter != "*" {
-		return errors.New("only '*' filter auto-assigners supported")
+func unmarshalRetries(v []byte) ([]sync.PendingAssignment, error) {
+	var pending []sync.PendingAssignment
+	err := json.Unmarshal(v, &pending)
+	return pending, errors.Wrap(err, "unmarshal auto-assign retries")
+}
+
+// isTokenAssigner reports whether a belongs to the DEP token tokenName.
+func isTokenAssigner(a sync.AutoAssigner, tokenName string) bool {
+	if isDefaultToken(tokenName) {
+		tokenName = config.DefaultDEPTokenName
 	}
-	ctx := context.Background()
+	return a.TokenName == tokenName
+}
+
+// FireDB stores the DEP sync cursor and auto-assigners in Google Cloud Firestore.
+type FireDB struct {
+	*firestore.Client
+}
+
+type cursorDoc struct {
+	Data []byte `firestore:"data"`
+}
+
+type retriesDoc struct {
+	Data []byte `firestore:"data"`
+}
+
+type autoAssignerDoc struct {
+	ProfileUUID string `firestore:"profile_uuid"`
+	Priority    int    `firestore:"priority"`
+}
 
-	_, err := db.Collection(AutoAssignBucket).Doc(a.Filter).Set(ctx, a)
+func NewFireDB(db *firestore.Client) (*FireDB, error) {
+	datastore := &FireDB{Client: db}
+	return datastore, nil
+}
+
+func (db *FireDB) LoadCursor(tokenName string) (*sync.Cursor, error) {
+	var cursor = struct {
+		Cursor sync.Cursor `json:"cursor"`
+	}{}
+	snap, err := db.Collection(ConfigBucket).Doc(cursorKey(tokenName)).Get(context.Background())
+	if status.Code(err) == codes.NotFound {
+		return &cursor.Cursor, nil // TODO add notfound
+	}
 	if err != nil {
-		return err
+		return nil, errors.Wrap(err, "load cursor from firestore")
 	}
-
-	return nil
+	var doc cursorDoc
+	if err := snap.DataTo(&doc); err != nil {
+		return nil, errors.Wrap(err, "load cursor from firestore")
+	}
+	if err := json.Unmarshal(doc.Data, &cursor); err != nil {
+		return nil, errors.Wrap(err, "unmarshal dep cursor")
+	}
+	return &cursor.Cursor, nil
 }
 
-func (db *FireDB) DeleteAutoAssigner(filter string) error {
+func (db *FireDB) SaveCursor(tokenName string, c sync.Cursor) error {
+	// use the same structure as the bolt store.
+	var cursor = struct {
+		Cursor sync.Cursor `json:"cursor"`
+	}{Cursor: c}
+	v, err := json.Marshal(&cursor)
+	if err != nil {
+		return errors.Wrap(err, "saving dep sync cursor")
+	}
+	doc := cursorDoc{Data: v}
+	_, err = db.Collection(ConfigBucket).Doc(cursorKey(tokenName)).Set(context.Background(), doc)
+	return errors.Wrap(err, "saving dep sync cursor")
+}
 
-	ctx := context.Background()
+func (db *FireDB) SaveAutoAssigner(a *sync.AutoAssigner) error {
+	doc := autoAssignerDoc{ProfileUUID: a.ProfileUUID, Priority: a.Priority}
+	_, err := db.Collection(AutoAssignBucket).Doc(autoAssignerKey(a.TokenName, a.Filter)).Set(context.Background(), doc)
+	return errors.Wrap(err, "saving auto-assigner")
+}
 
-	_, err := db.Collection(AutoAssignBucket).Doc(filter).Delete(ctx)
+func (db *FireDB) DeleteAutoAssigner(tokenName, filter string) error {
+	_, err := db.Collection(AutoAssignBucket).Doc(autoAssignerKey(tokenName, filter)).Delete(context.Background())
 	return err
 }
 
-func (db *FireDB) LoadAutoAssigners() ([]sync.AutoAssigner, error) {
-	var aal []sync.AutoAssigner
-	ctx := context.Background()
-
-	iter := db.Collection(AutoAssignBucket).Documents(ctx)
-	for {
-		doc, err := iter.Next()
-		if err == iterator.Done {
-			break
+func (db *FireDB) LoadAutoAssigners(tokenName string) ([]sync.AutoAssigner, error) {
+	var aa []sync.AutoAssigner
+	docs, err := db.Collection(AutoAssignBucket).Documents(context.Background()).GetAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "loading auto-assigners")
+	}
+	for _, snap := range docs {
+		var doc autoAssignerDoc
+		if err := snap.DataTo(&doc); err != nil {
+			return nil, errors.Wrap(err, "loading auto-assigners")
 		}
-		if err != nil {
-			return nil, err
+		name, filter := splitAutoAssignerKey(snap.Ref.ID)
+		a := sync.AutoAssigner{Filter: filter, TokenName: name, ProfileUUID: doc.ProfileUUID, Priority: doc.Priority}
+		if isTokenAssigner(a, tokenName) {
+			aa = append(aa, a)
 		}
-
-		var aa sync.AutoAssigner
-		doc.DataTo(&aa)
-
-		aal = append(aal, aa)
 	}
+	return aa, nil
+}
 
-	return aal, nil
+func (db *FireDB) LoadAutoAssignRetries(tokenName string) ([]sync.PendingAssignment, error) {
+	snap, err := db.Collection(AutoAssignRetryBucket).Doc(retriesKey(tokenName)).Get(context.Background())
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "load auto-assign retries from firestore")
+	}
+	var doc retriesDoc
+	if err := snap.DataTo(&doc); err != nil {
+		return nil, errors.Wrap(err, "load auto-assign retries from firestore")
+	}
+	return unmarshalRetries(doc.Data)
 }
 
+func (db *FireDB) SaveAutoAssignRetries(tokenName string, pending []sync.PendingAssignment) error {
+	v, err := marshalRetries(pending)
+	if err != nil {
+		return err
+	}
+	_, err = db.Collection(AutoAssignRetryBucket).Doc(retriesKey(tokenName)).Set(context.Background(), retriesDoc{Data: v})
+	return errors.Wrap(err, "saving auto-assign retries")
+}
 
 //////////////////////////////////////////////////////
 
@@ -116,6 +250,10 @@ func NewDB(db *bolt.DB) (*DB, error) {
 			return err
 		}
 		_, err = tx.CreateBucketIfNotExists([]byte(AutoAssignBucket))
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists([]byte(AutoAssignRetryBucket))
 		return err
 	})
 	if err != nil {
@@ -125,13 +263,13 @@ func NewDB(db *bolt.DB) (*DB, error) {
 	return datastore, nil
 }
 
-func (db *DB) LoadCursor() (*sync.Cursor, error) {
+func (db *DB) LoadCursor(tokenName string) (*sync.Cursor, error) {
 	var cursor = struct {
 		Cursor sync.Cursor `json:"cursor"`
 	}{}
 	err := db.View(func(tx *bolt.Tx) error {
 		bkt := tx.Bucket([]byte(ConfigBucket))
-		v := bkt.Get([]byte("configuration"))
+		v := bkt.Get([]byte(cursorKey(tokenName)))
 		if v == nil {
 			return nil // TODO add notfound
 		}
@@ -144,7 +282,7 @@ func (db *DB) LoadCursor() (*sync.Cursor, error) {
 	return &cursor.Cursor, nil
 }
 
-func (db *DB) SaveCursor(c sync.Cursor) error {
+func (db *DB) SaveCursor(tokenName string, c sync.Cursor) error {
 	err := db.Update(func(tx *bolt.Tx) error {
 		bkt, err := tx.CreateBucketIfNotExists([]byte(ConfigBucket))
 		if err != nil {
@@ -158,36 +296,37 @@ func (db *DB) SaveCursor(c sync.Cursor) error {
 		if err != nil {
 			return err
 		}
-		return bkt.Put([]byte("configuration"), v)
+		return bkt.Put([]byte(cursorKey(tokenName)), v)
 	})
 	return errors.Wrap(err, "saving dep sync cursor")
 }
 
 func (db *DB) SaveAutoAssigner(a *sync.AutoAssigner) error {
-	if a.Filter != "*" {
-		return errors.New("only '*' filter auto-assigners supported")
+	v, err := marshalAutoAssigner(a)
+	if err != nil {
+		return errors.Wrap(err, "marshal auto-assigner")
 	}
-	err := db.Update(func(tx *bolt.Tx) error {
+	err = db.Update(func(tx *bolt.Tx) error {
 		b, err := tx.CreateBucketIfNotExists([]byte(AutoAssignBucket))
 		if err != nil {
 			return err
 		}
-		return b.Put([]byte(a.Filter), []byte(a.ProfileUUID))
+		return b.Put([]byte(autoAssignerKey(a.TokenName, a.Filter)), v)
 	})
 	return errors.Wrap(err, "saving auto-assigner")
 }
 
-func (db *DB) DeleteAutoAssigner(filter string) error {
+func (db *DB) DeleteAutoAssigner(tokenName, filter string) error {
 	return db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(AutoAssignBucket))
 		if b == nil { // bucket doesn't exist yet
 			return nil
 		}
-		return b.Delete([]byte(filter))
+		return b.Delete([]byte(autoAssignerKey(tokenName, filter)))
 	})
 }
 
-func (db *DB) LoadAutoAssigners() ([]sync.AutoAssigner, error) {
+func (db *DB) LoadAutoAssigners(tokenName string) ([]sync.AutoAssigner, error) {
 	var aa []sync.AutoAssigner
 	err := db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(AutoAssignBucket))
@@ -196,12 +335,44 @@ func (db *DB) LoadAutoAssigners() ([]sync.AutoAssigner, error) {
 		}
 
 		return b.ForEach(func(k, v []byte) error {
-			aa = append(aa, sync.AutoAssigner{
-				Filter:      string(k),
-				ProfileUUID: string(v),
-			})
+			if a := UnmarshalAutoAssigner(string(k), v); isTokenAssigner(a, tokenName) {
+				aa = append(aa, a)
+			}
 			return nil
 		})
 	})
 	return aa, errors.Wrap(err, "loading auto-assigners")
 }
+
+func (db *DB) LoadAutoAssignRetries(tokenName string) ([]sync.PendingAssignment, error) {
+	var pending []sync.PendingAssignment
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(AutoAssignRetryBucket))
+		if b == nil { // bucket doesn't exist yet
+			return nil
+		}
+		v := b.Get([]byte(retriesKey(tokenName)))
+		if v == nil {
+			return nil
+		}
+		var err error
+		pending, err = unmarshalRetries(v)
+		return err
+	})
+	return pending, errors.Wrap(err, "load auto-assign retries from bolt")
+}
+
+func (db *DB) SaveAutoAssignRetries(tokenName string, pending []sync.PendingAssignment) error {
+	v, err := marshalRetries(pending)
+	if err != nil {
+		return err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(AutoAssignRetryBucket))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(retriesKey(tokenName)), v)
+	})
+	return errors.Wrap(err, "saving auto-assign retries")
+}
@@ -0,0 +1,109 @@
+package builtin
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/dep/sync"
+	"github.com/vishnuvaradaraj/micromdm/platform/storage/sqldb"
+)
+
+// SQLDB stores the DEP sync cursor and auto-assigners in a SQL database.
+type SQLDB struct {
+	*sqldb.DB
+}
+
+func NewSQLDB(db *sqldb.DB) (*SQLDB, error) {
+	datastore := &SQLDB{DB: db}
+	return datastore, nil
+}
+
+func (db *SQLDB) LoadCursor(tokenName string) (*sync.Cursor, error) {
+	var cursor = struct {
+		Cursor sync.Cursor `json:"cursor"`
+	}{}
+	var data []byte
+	err := db.QueryRow(`SELECT data FROM dep_sync_cursor WHERE id = ?`, cursorKey(tokenName)).Scan(&data)
+	if err == sql.ErrNoRows {
+		return &cursor.Cursor, nil // TODO add notfound
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "load cursor from sql")
+	}
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, errors.Wrap(err, "unmarshal dep cursor")
+	}
+	return &cursor.Cursor, nil
+}
+
+func (db *SQLDB) SaveCursor(tokenName string, c sync.Cursor) error {
+	// use the same structure as the bolt store.
+	var cursor = struct {
+		Cursor sync.Cursor `json:"cursor"`
+	}{Cursor: c}
+	v, err := json.Marshal(&cursor)
+	if err != nil {
+		return errors.Wrap(err, "saving dep sync cursor")
+	}
+	_, err = db.Exec(db.Upsert("dep_sync_cursor", "id", "id", "data"), cursorKey(tokenName), v)
+	return errors.Wrap(err, "saving dep sync cursor")
+}
+
+func (db *SQLDB) SaveAutoAssigner(a *sync.AutoAssigner) error {
+	_, err := db.Exec(db.Upsert("dep_autoassigners", "filter_name", "filter_name", "profile_uuid", "priority"),
+		autoAssignerKey(a.TokenName, a.Filter), a.ProfileUUID, a.Priority)
+	return errors.Wrap(err, "saving auto-assigner")
+}
+
+func (db *SQLDB) DeleteAutoAssigner(tokenName, filter string) error {
+	_, err := db.Exec(`DELETE FROM dep_autoassigners WHERE filter_name = ?`, autoAssignerKey(tokenName, filter))
+	return err
+}
+
+func (db *SQLDB) LoadAutoAssigners(tokenName string) ([]sync.AutoAssigner, error) {
+	// the filter_name column holds the same keys as the bolt store.
+	rows, err := db.Query(`SELECT filter_name, profile_uuid, priority FROM dep_autoassigners ORDER BY filter_name`)
+	if err != nil {
+		return nil, errors.Wrap(err, "loading auto-assigners")
+	}
+	defer rows.Close()
+	var aa []sync.AutoAssigner
+	for rows.Next() {
+		var (
+			key, profileUUID string
+			priority         int
+		)
+		if err := rows.Scan(&key, &profileUUID, &priority); err != nil {
+			return nil, errors.Wrap(err, "loading auto-assigners")
+		}
+		name, filter := splitAutoAssignerKey(key)
+		a := sync.AutoAssigner{Filter: filter, TokenName: name, ProfileUUID: profileUUID, Priority: priority}
+		if isTokenAssigner(a, tokenName) {
+			aa = append(aa, a)
+		}
+	}
+	return aa, errors.Wrap(rows.Err(), "loading auto-assigners")
+}
+
+func (db *SQLDB) LoadAutoAssignRetries(tokenName string) ([]sync.PendingAssignment, error) {
+	var data []byte
+	err := db.QueryRow(`SELECT data FROM dep_autoassign_retries WHERE token_name = ?`, retriesKey(tokenName)).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "load auto-assign retries from sql")
+	}
+	return unmarshalRetries(data)
+}
+
+func (db *SQLDB) SaveAutoAssignRetries(tokenName string, pending []sync.PendingAssignment) error {
+	v, err := marshalRetries(pending)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(db.Upsert("dep_autoassign_retries", "token_name", "token_name", "data"), retriesKey(tokenName), v)
+	return errors.Wrap(err, "saving auto-assign retries")
+}
@@ -19,10 +19,10 @@ func NewHTTPClient(instance, token string, logger log.Logger, opts ...httptransp
 	var syncNowEndpoint endpoint.Endpoint
 	{
 		syncNowEndpoint = httptransport.NewClient(
-			"PUT",
-			httputil.CopyURL(u, "/v1/dep/autoassign"),
+			"POST",
+			httputil.CopyURL(u, "/v1/dep/syncnow"),
 			httputil.EncodeRequestWithToken(token, httptransport.EncodeJSONRequest),
-			decodeEmptyResponse,
+			decodeSyncNowResponse,
 			opts...,
 		).Endpoint()
 	}
@@ -60,10 +60,22 @@ func NewHTTPClient(instance, token string, logger log.Logger, opts ...httptransp
 		).Endpoint()
 	}
 
+	var dryRunAutoAssignersEndpoint endpoint.Endpoint
+	{
+		dryRunAutoAssignersEndpoint = httptransport.NewClient(
+			"POST",
+			httputil.CopyURL(u, "/v1/dep/autoassigners/dryrun"),
+			httputil.EncodeRequestWithToken(token, httptransport.EncodeJSONRequest),
+			decodeDryRunAutoAssignersResponse,
+			opts...,
+		).Endpoint()
+	}
+
 	return Endpoints{
-		SyncNowEndpoint:            syncNowEndpoint,
-		ApplyAutoAssignerEndpoint:  applyAutoAssignerEndpoint,
-		GetAutoAssignersEndpoint:   getAutoAssignersEndpoint,
-		RemoveAutoAssignerEndpoint: removeAutoAssignerEndpoint,
+		SyncNowEndpoint:             syncNowEndpoint,
+		ApplyAutoAssignerEndpoint:   applyAutoAssignerEndpoint,
+		GetAutoAssignersEndpoint:    getAutoAssignersEndpoint,
+		RemoveAutoAssignerEndpoint:  removeAutoAssignerEndpoint,
+		DryRunAutoAssignersEndpoint: dryRunAutoAssignersEndpoint,
 	}, nil
 }
@@ -2,8 +2,6 @@ package sync
 
 import (
 	"context"
-	"encoding/json"
-	"strings"
 	"sync"
 	"time"
 
@@ -21,18 +19,42 @@ const (
 
 	syncDuration        = 30 * time.Minute
 	cursorValidDuration = 7 * 24 * time.Hour
+
+	// the sync is restarted after an error, backing off from the minimum to
+	// the maximum wait while it keeps failing.
+	defaultMinBackoff = 30 * time.Second
+	defaultMaxBackoff = syncDuration
+
+	// failed auto-assignments are retried with each sync until they were
+	// attempted this many times.
+	autoAssignAttempts = 5
 )
 
-type Syncer interface{ SyncNow() }
+// Syncer syncs the devices of the DEP tokens.
+type Syncer interface {
+	// SyncNow syncs the DEP token named tokenName, or every token if
+	// tokenName is empty.
+	SyncNow(tokenName string) error
+
+	// DeviceDetails looks up devices with the DEP API, using the DEP token
+	// named tokenName or the default token if tokenName is empty.
+	DeviceDetails(tokenName string, serials ...string) (*dep.DeviceDetailsResponse, error)
+}
 
 type WatcherDB interface {
-	LoadCursor() (*Cursor, error)
-	SaveCursor(c Cursor) error
-	LoadAutoAssigners() ([]AutoAssigner, error)
+	LoadCursor(tokenName string) (*Cursor, error)
+	SaveCursor(tokenName string, c Cursor) error
+	LoadAutoAssigners(tokenName string) ([]AutoAssigner, error)
+	// LoadAutoAssignRetries and SaveAutoAssignRetries keep the devices
+	// whose auto-assignment failed, so that they are retried after a restart.
+	LoadAutoAssignRetries(tokenName string) ([]PendingAssignment, error)
+	SaveAutoAssignRetries(tokenName string, pending []PendingAssignment) error
 }
 
+// Watcher syncs the devices of a single DEP token.
 type Watcher struct {
 	mtx    sync.RWMutex
+	name   string
 	logger log.Logger
 	client Client
 
@@ -42,21 +64,42 @@ type Watcher struct {
 	syncNow   chan bool
 
 	cursor Cursor
+	// synced is set once Run has fetched or synced successfully.
+	synced bool
+
+	// retries are the devices whose auto-assignment failed, by serial number.
+	// They are saved with each change.
+	retryMtx sync.Mutex
+	retries  map[string]PendingAssignment
+
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	// attributes looks up the custom attributes and tags of devices for
+	// auto-assigner filters.
+	attributes DeviceAttributes
+
+	// leader reports whether this server may sync. Nil always syncs.
+	leader func() bool
 }
 
-func NewWatcher(db WatcherDB, pub pubsub.PublishSubscriber, opts ...Option) (*Watcher, error) {
+func NewWatcher(db WatcherDB, pub pubsub.Publisher, opts ...Option) (*Watcher, error) {
 	w := Watcher{
-		logger:    log.NewNopLogger(),
-		db:        db,
-		publisher: pub,
-		startSync: make(chan bool),
-		syncNow:   make(chan bool),
+		name:       conf.DefaultDEPTokenName,
+		logger:     log.NewNopLogger(),
+		db:         db,
+		publisher:  pub,
+		startSync:  make(chan bool),
+		syncNow:    make(chan bool, 1),
+		minBackoff: defaultMinBackoff,
+		maxBackoff: defaultMaxBackoff,
+		retries:    make(map[string]PendingAssignment),
 	}
 	for _, optFn := range opts {
 		optFn(&w)
 	}
 
-	cursor, err := w.db.LoadCursor()
+	cursor, err := w.db.LoadCursor(w.name)
 	if err != nil {
 		return nil, err
 	}
@@ -64,31 +107,21 @@ func NewWatcher(db WatcherDB, pub pubsub.PublishSubscriber, opts ...Option) (*Wa
 		level.Debug(w.logger).Log("msg", "loaded DEP config", "cursor", cursor.Value)
 		w.cursor = *cursor
 	}
-
-	if err := w.updateClient(pub); err != nil {
+	pending, err := w.db.LoadAutoAssignRetries(w.name)
+	if err != nil {
 		return nil, err
 	}
-
-	saveCursor := func() {
-		if err := db.SaveCursor(w.cursor); err != nil {
-			level.Info(w.logger).Log("err", err, "msg", "saving cursor")
-			return
-		}
-		level.Info(w.logger).Log("msg", "saved DEP config", "cursor", w.cursor.Value)
+	for _, p := range pending {
+		w.retries[p.SerialNumber] = p
 	}
 
 	go func() {
-		defer saveCursor()
-		if w.client == nil {
-			//panic("boom")
+		if w.currentClient() == nil {
 			// block until we have a DEP client to start sync process
 			level.Info(w.logger).Log("msg", "waiting for DEP token to be added before starting sync")
 			<-w.startSync
 		}
-		err := w.Run()
-		// the DEP sync should never end without an error, but log
-		// unconditionally anyway so we never silently stop watching
-		level.Info(w.logger).Log("err", err, "msg", "DEP watcher stopped")
+		w.supervise()
 	}()
 
 	return &w, nil
@@ -98,6 +131,7 @@ type Client interface {
 	FetchDevices(...dep.DeviceRequestOption) (*dep.DeviceResponse, error)
 	SyncDevices(string, ...dep.DeviceRequestOption) (*dep.DeviceResponse, error)
 	AssignProfile(string, ...string) (*dep.ProfileResponse, error)
+	DeviceDetails(...string) (*dep.DeviceDetailsResponse, error)
 }
 
 type Option func(*Watcher)
@@ -114,92 +148,182 @@ func WithLogger(logger log.Logger) Option {
 	}
 }
 
-func (w *Watcher) updateClient(pubsub pubsub.Subscriber) error {
-	tokenAdded, err := pubsub.Subscribe(context.TODO(), "token-events", conf.DEPTokenTopic)
-	if err != nil {
-		return err
+// WithName sets the name of the DEP token the watcher syncs. The cursor and
+// auto-assigners are loaded for that token, and published events carry it.
+func WithName(tokenName string) Option {
+	return func(w *Watcher) {
+		w.name = tokenName
 	}
+}
 
-	go func() {
-		for {
-			select {
-			case event := <-tokenAdded:
-				var token conf.DEPToken
-				if err := json.Unmarshal(event.Message, &token); err != nil {
-					level.Info(w.logger).Log("err", err, "msg", "unmarshalling tokenAdd to token")
-					continue
-				}
-
-				client, err := token.Client()
-				if err != nil {
-					level.Info(w.logger).Log("err", err, "msg", "creating new DEP client")
-					continue
-				}
-
-				w.mtx.Lock()
-				w.client = client
-				w.mtx.Unlock()
-				go func() { w.startSync <- true }() // unblock Run
-			}
-		}
-	}()
-	return nil
+// WithRetryBackoff sets the wait before the sync is restarted after its first
+// error, and the longest wait while it keeps failing.
+func WithRetryBackoff(min, max time.Duration) Option {
+	return func(w *Watcher) {
+		w.minBackoff = min
+		w.maxBackoff = max
+	}
+}
+
+// WithLeader only syncs while held returns true, so that a single server syncs
+// the DEP tokens shared by several servers.
+func WithLeader(held func() bool) Option {
+	return func(w *Watcher) {
+		w.leader = held
+	}
+}
+
+// WithDeviceAttributes looks up the custom attributes and tags of devices in
+// the device inventory, for auto-assigner filters which match them.
+func WithDeviceAttributes(attrs DeviceAttributes) Option {
+	return func(w *Watcher) {
+		w.attributes = attrs
+	}
+}
+
+// UpdateClient replaces the DEP client, for example after the token was
+// renewed, and starts the sync if the watcher was waiting for a client.
+func (w *Watcher) UpdateClient(client Client) {
+	w.mtx.Lock()
+	waiting := w.client == nil
+	w.client = client
+	w.mtx.Unlock()
+	if waiting {
+		go func() { w.startSync <- true }() // unblock Run
+	}
+}
+
+func (w *Watcher) currentClient() Client {
+	w.mtx.RLock()
+	defer w.mtx.RUnlock()
+	return w.client
 }
 
 func (w *Watcher) SyncNow() {
-	if w.client == nil {
+	if w.currentClient() == nil {
 		level.Info(w.logger).Log("msg", "waiting for DEP token to be added before starting sync")
 		return
 	}
-	w.syncNow <- true
+	select {
+	case w.syncNow <- true:
+	default: // a sync was already requested.
+	}
 }
 
-// TODO this needs to be a proper error in the micromdm/dep package.
-func isCursorExhausted(err error) bool {
-	return strings.Contains(err.Error(), "EXHAUSTED_CURSOR")
+// supervise runs the sync, and restarts it after an error so that an outage of
+// the DEP API does not stop the sync until MicroMDM is restarted. The wait
+// doubles while the sync keeps failing, and is cut short by SyncNow.
+func (w *Watcher) supervise() {
+	backoff := w.minBackoff
+	for {
+		w.awaitLeader()
+		w.synced = false
+		err := w.Run()
+		if err == errNotLeader {
+			continue
+		}
+		if w.synced {
+			backoff = w.minBackoff
+		}
+
+		wait := backoff
+		if e, ok := errors.Cause(err).(*dep.Error); ok && e.RetryAfter > wait {
+			wait = e.RetryAfter
+		}
+		if advice := syncErrorAdvice(err); advice != "" {
+			level.Warn(w.logger).Log("msg", "DEP sync stopped, restarting", "err", err, "retry_in", wait, "advice", advice)
+		} else {
+			level.Info(w.logger).Log("msg", "DEP sync stopped, restarting", "err", err, "retry_in", wait)
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-w.syncNow:
+			level.Info(w.logger).Log("msg", "explicit DEP sync requested")
+		}
+		if backoff *= 2; backoff > w.maxBackoff {
+			backoff = w.maxBackoff
+		}
+	}
 }
 
-func isCursorExpired(err error) bool {
-	return strings.Contains(err.Error(), "EXPIRED_CURSOR")
+// errNotLeader stops a sync when another server took over.
+var errNotLeader = errors.New("not the leader")
+
+// leaderPoll is how often a server which does not sync checks if it may.
+const leaderPoll = 10 * time.Second
+
+// awaitLeader blocks until this server may sync. A server which takes over
+// the sync loads the cursor and auto-assign retries saved by the previous one.
+func (w *Watcher) awaitLeader() {
+	if w.leader == nil || w.leader() {
+		return
+	}
+	level.Info(w.logger).Log("msg", "another server syncs DEP, waiting to take over")
+	for !w.leader() {
+		time.Sleep(leaderPoll)
+	}
+	level.Info(w.logger).Log("msg", "taking over DEP sync")
+	cursor, err := w.db.LoadCursor(w.name)
+	if err != nil {
+		level.Info(w.logger).Log("msg", "load DEP cursor", "err", err)
+	} else if cursor.Valid() {
+		w.cursor = *cursor
+	}
+	pending, err := w.db.LoadAutoAssignRetries(w.name)
+	if err != nil {
+		level.Info(w.logger).Log("msg", "load DEP auto-assign retries", "err", err)
+		return
+	}
+	w.retryMtx.Lock()
+	defer w.retryMtx.Unlock()
+	w.retries = make(map[string]PendingAssignment, len(pending))
+	for _, p := range pending {
+		w.retries[p.SerialNumber] = p
+	}
 }
 
-func isCursorInvalid(err error) bool {
-	return strings.Contains(err.Error(), "INVALID_CURSOR")
+// syncErrorAdvice describes how to fix errors which retrying does not.
+func syncErrorAdvice(err error) string {
+	switch {
+	case dep.IsCode(err, dep.CodeTermsNotSigned):
+		return "accept the new terms and conditions in Apple Business Manager"
+	case dep.IsCode(err, dep.CodeForbidden), dep.IsCode(err, dep.CodeUnauthorized):
+		return "the DEP token may have expired or been revoked, download a new one and apply it with mdmctl apply dep-tokens"
+	}
+	return ""
 }
 
-// Process DEP messages and pull out filter-matching serial numbers
-// associated to profile UUIDs for auto-assignment.
+// filteredAutoAssignments returns the serial numbers of added devices grouped
+// by the profile UUID they are auto-assigned.
 func (w *Watcher) filteredAutoAssignments(devices []dep.Device) (map[string][]string, error) {
 	// load auto-assigners every run to make sure we get the latest set of
-	// auto-assigner profile UUIDs/filters. Note this makes every *watcher
-	// (i.e. every DEP sync instance) share the current DB set of auto-
-	// assigners. perhaps to refactor to be more separated.
-	assigners, err := w.db.LoadAutoAssigners()
+	// auto-assigner profile UUIDs/filters for this watcher's DEP token.
+	aa, err := w.db.LoadAutoAssigners(w.name)
 	if err != nil {
 		return nil, err
 	}
 	assigned := make(map[string][]string)
 	// skip looping over serials if we have no autoassigners
-	if len(assigners) < 1 {
+	if len(aa) < 1 {
 		return assigned, nil
 	}
+	assigners, err := newAutoAssigners(aa)
+	if err != nil {
+		level.Info(w.logger).Log("err", err, "msg", "auto-assign")
+	}
 	for _, d := range devices {
 		// only process DEP "added" OpType messages
 		if d.OpType != "added" {
 			continue
 		}
-		// filter our devices by our assigner filters and get list of
-		// which devices are to be assigned to which profiles
-		for _, assigner := range assigners {
-			if assigner.Filter == "*" { // only supported filter type right now
-				if serials, ok := assigned[assigner.ProfileUUID]; ok {
-					assigned[assigner.ProfileUUID] = append(serials, d.SerialNumber)
-				} else {
-					assigned[assigner.ProfileUUID] = []string{d.SerialNumber}
-				}
-			}
+		fd, err := newFilterDevice(assigners, w.attributes, d)
+		if err != nil {
+			level.Info(w.logger).Log("err", err, "msg", "auto-assign")
+		}
+		if a, ok := assign(assigners, fd); ok {
+			assigned[a.ProfileUUID] = append(assigned[a.ProfileUUID], d.SerialNumber)
 		}
-
 	}
 	return assigned, nil
 }
@@ -211,43 +335,127 @@ func (w *Watcher) processAutoAssign(devices []dep.Device) error {
 	}
 
 	for profileUUID, serials := range assignments {
-		resp, err := w.client.AssignProfile(profileUUID, serials...)
-		if err != nil {
+		w.assignProfile(profileUUID, serials)
+	}
+	return nil
+}
+
+// assignProfile assigns the profile, and queues the devices which could not
+// be assigned to be retried with the next sync.
+func (w *Watcher) assignProfile(profileUUID string, serials []string) {
+	resp, err := w.currentClient().AssignProfile(profileUUID, serials...)
+	if err != nil {
+		level.Info(w.logger).Log(
+			"err", err,
+			"msg", "auto-assign error assigning serials to profile",
+			"profile", profileUUID,
+		)
+		w.queueAssignRetry(profileUUID, serials)
+		return
+	}
+	// count our results for logging
+	resultCounts := map[string]int{
+		"SUCCESS":        0,
+		"NOT_ACCESSIBLE": 0,
+		"FAILED":         0,
+	}
+	var failed []string
+	for serial, result := range resp.Devices {
+		if ct, ok := resultCounts[result]; ok {
+			// NOTE: we're logging _only_ the above pre-defined result types
+			resultCounts[result] = ct + 1
+		}
+		if result == "SUCCESS" {
+			w.clearAssignRetry(serial)
+		} else {
+			failed = append(failed, serial)
+		}
+	}
+	w.queueAssignRetry(profileUUID, failed)
+	level.Info(w.logger).Log(
+		"msg", "DEP auto-assigned",
+		"profile", profileUUID,
+		"success", resultCounts["SUCCESS"],
+		"not_accessible", resultCounts["NOT_ACCESSIBLE"],
+		"failed", resultCounts["FAILED"],
+	)
+}
+
+// PendingAssignment is a device whose auto-assignment failed, which is
+// assigned again with the next syncs.
+type PendingAssignment struct {
+	SerialNumber string `json:"serial_number"`
+	ProfileUUID  string `json:"profile_uuid"`
+	Attempts     int    `json:"attempts"`
+}
+
+func (w *Watcher) queueAssignRetry(profileUUID string, serials []string) {
+	if len(serials) == 0 {
+		return
+	}
+	w.retryMtx.Lock()
+	defer w.retryMtx.Unlock()
+	for _, serial := range serials {
+		p := w.retries[serial]
+		if p.ProfileUUID != profileUUID {
+			p = PendingAssignment{SerialNumber: serial, ProfileUUID: profileUUID}
+		}
+		p.Attempts++
+		if p.Attempts >= autoAssignAttempts {
 			level.Info(w.logger).Log(
-				"err", err,
-				"msg", "auto-assign error assigning serials to profile",
+				"msg", "giving up DEP auto-assign, assign the profile manually",
+				"serial", serial,
 				"profile", profileUUID,
+				"attempts", p.Attempts,
 			)
+			delete(w.retries, serial)
 			continue
 		}
-		// count our results for logging
-		resultCounts := map[string]int{
-			"SUCCESS":        0,
-			"NOT_ACCESSIBLE": 0,
-			"FAILED":         0,
-		}
-		for _, result := range resp.Devices {
-			if ct, ok := resultCounts[result]; ok {
-				// NOTE: we're logging _only_ the above pre-defined result types
-				resultCounts[result] = ct + 1
-			}
-		}
-		// TODO: alternate strategy is to log all failed devices
-		// TODO: handle/requeue failed devices?
-		level.Info(w.logger).Log(
-			"msg", "DEP auto-assigned",
-			"profile", profileUUID,
-			"success", resultCounts["SUCCESS"],
-			"not_accessible", resultCounts["NOT_ACCESSIBLE"],
-			"failed", resultCounts["FAILED"],
-		)
+		w.retries[serial] = p
 	}
+	w.saveAssignRetries()
+}
 
-	return nil
+func (w *Watcher) clearAssignRetry(serial string) {
+	w.retryMtx.Lock()
+	defer w.retryMtx.Unlock()
+	if _, ok := w.retries[serial]; !ok {
+		return
+	}
+	delete(w.retries, serial)
+	w.saveAssignRetries()
+}
+
+// saveAssignRetries saves the pending retries. It must be called with
+// retryMtx held. A retry which is not saved is only lost on a restart, so
+// the error is logged.
+func (w *Watcher) saveAssignRetries() {
+	pending := make([]PendingAssignment, 0, len(w.retries))
+	for _, p := range w.retries {
+		pending = append(pending, p)
+	}
+	if err := w.db.SaveAutoAssignRetries(w.name, pending); err != nil {
+		level.Info(w.logger).Log("msg", "save DEP auto-assign retries", "err", err)
+	}
+}
+
+// retryAutoAssign assigns the profiles of devices whose assignment failed.
+func (w *Watcher) retryAutoAssign() {
+	w.retryMtx.Lock()
+	pending := make(map[string][]string)
+	for serial, p := range w.retries {
+		pending[p.ProfileUUID] = append(pending[p.ProfileUUID], serial)
+	}
+	w.retryMtx.Unlock()
+
+	for profileUUID, serials := range pending {
+		level.Debug(w.logger).Log("msg", "retrying DEP auto-assign", "profile", profileUUID, "devices", len(serials))
+		w.assignProfile(profileUUID, serials)
+	}
 }
 
 func (w *Watcher) publishAndProcessDevices(devices []dep.Device) error {
-	e := NewEvent(devices)
+	e := NewEvent(w.name, devices)
 	data, err := MarshalEvent(e)
 	if err != nil {
 		return err
@@ -270,14 +478,17 @@ func (w *Watcher) publishAndProcessDevices(devices []dep.Device) error {
 	return nil
 }
 
+// Run fetches all devices and then syncs changes every 30 minutes, or when
+// SyncNow is called. It only returns with an error.
 func (w *Watcher) Run() error {
-	ticker := time.NewTicker(syncDuration).C
+	ticker := time.NewTicker(syncDuration)
+	defer ticker.Stop()
 FETCH:
 	for {
-		resp, err := w.client.FetchDevices(dep.Limit(100), dep.Cursor(w.cursor.Value))
-		if err != nil && isCursorExhausted(err) {
+		resp, err := w.currentClient().FetchDevices(dep.Limit(100), dep.Cursor(w.cursor.Value))
+		if dep.IsCode(err, dep.CodeExhaustedCursor) {
 			goto SYNC
-		} else if err != nil && isCursorInvalid(err) {
+		} else if dep.IsCode(err, dep.CodeInvalidCursor) {
 			level.Info(w.logger).Log(
 				"msg", "DEP fetch cursor response",
 				"cursor", w.cursor.Value,
@@ -296,8 +507,9 @@ FETCH:
 			"fetched", resp.FetchedUntil,
 			"devices", len(resp.Devices),
 		)
+		w.synced = true
 		w.cursor = Cursor{Value: resp.Cursor, CreatedAt: time.Now()}
-		if err := w.db.SaveCursor(w.cursor); err != nil {
+		if err := w.db.SaveCursor(w.name, w.cursor); err != nil {
 			return errors.Wrap(err, "saving cursor from fetch")
 		}
 		if err := w.publishAndProcessDevices(resp.Devices); err != nil {
@@ -310,8 +522,8 @@ FETCH:
 
 SYNC:
 	for {
-		resp, err := w.client.SyncDevices(w.cursor.Value, dep.Cursor(w.cursor.Value))
-		if err != nil && (isCursorExpired(err) || isCursorInvalid(err)) {
+		resp, err := w.currentClient().SyncDevices(w.cursor.Value, dep.Cursor(w.cursor.Value))
+		if dep.IsCode(err, dep.CodeExpiredCursor) || dep.IsCode(err, dep.CodeInvalidCursor) {
 			level.Info(w.logger).Log(
 				"msg", "DEP sync cursor response",
 				"cursor", w.cursor.Value,
@@ -330,19 +542,25 @@ SYNC:
 			"fetched", resp.FetchedUntil,
 			"devices", len(resp.Devices),
 		)
+		w.synced = true
 		w.cursor = Cursor{Value: resp.Cursor, CreatedAt: time.Now()}
-		if err := w.db.SaveCursor(w.cursor); err != nil {
+		if err := w.db.SaveCursor(w.name, w.cursor); err != nil {
 			return errors.Wrap(err, "saving cursor from sync")
 		}
 		if err := w.publishAndProcessDevices(resp.Devices); err != nil {
 			return err
 		}
 		if !resp.MoreToFollow {
+			go w.retryAutoAssign()
 			select {
-			case <-ticker:
+			case <-ticker.C:
 			case <-w.syncNow:
 				level.Info(w.logger).Log("msg", "explicit DEP sync requested")
 			}
+			if w.leader != nil && !w.leader() {
+				level.Info(w.logger).Log("msg", "another server took over DEP sync")
+				return errNotLeader
+			}
 		}
 	}
 }
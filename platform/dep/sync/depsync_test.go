@@ -0,0 +1,231 @@
+package sync
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/vishnuvaradaraj/micromdm/dep"
+	"github.com/vishnuvaradaraj/micromdm/dep/depsim"
+	"github.com/vishnuvaradaraj/micromdm/platform/pubsub/inmem"
+)
+
+// flakyClient fails to fetch until it has been called failures times.
+type flakyClient struct {
+	fakeClient
+	mtx      sync.Mutex
+	failures int
+	fetches  int
+}
+
+func (c *flakyClient) FetchDevices(opts ...dep.DeviceRequestOption) (*dep.DeviceResponse, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.fetches++
+	if c.fetches <= c.failures {
+		return nil, &dep.Error{StatusCode: http.StatusServiceUnavailable}
+	}
+	return c.fakeClient.FetchDevices(opts...)
+}
+
+func TestWatcherRestartsAfterError(t *testing.T) {
+	db := &fakeWatcherDB{cursors: make(map[string]Cursor)}
+	client := &flakyClient{fakeClient: fakeClient{serial: "SERIAL1"}, failures: 2}
+	_, err := NewWatcher(db, inmem.NewPubSub(),
+		WithClient(client),
+		WithRetryBackoff(time.Millisecond, 10*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		db.mtx.Lock()
+		cursor := db.cursors["default"].Value
+		db.mtx.Unlock()
+		if cursor == "SERIAL1-cursor" {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	client.mtx.Lock()
+	defer client.mtx.Unlock()
+	t.Fatalf("sync did not recover after %d fetches", client.fetches)
+}
+
+func TestSyncErrorAdvice(t *testing.T) {
+	tests := []struct {
+		err    error
+		advice bool
+	}{
+		{&dep.Error{StatusCode: http.StatusForbidden, Code: dep.CodeTermsNotSigned}, true},
+		{&dep.Error{StatusCode: http.StatusForbidden, Code: dep.CodeForbidden}, true},
+		{&dep.Error{StatusCode: http.StatusServiceUnavailable}, false},
+	}
+	for _, tt := range tests {
+		if have := syncErrorAdvice(tt.err) != ""; have != tt.advice {
+			t.Errorf("%v: have advice %v, want %v", tt.err, have, tt.advice)
+		}
+	}
+}
+
+// resultClient assigns profiles with the next of its results for each serial.
+type resultClient struct {
+	fakeClient
+	results map[string][]string
+}
+
+func (c *resultClient) AssignProfile(uuid string, serials ...string) (*dep.ProfileResponse, error) {
+	resp := &dep.ProfileResponse{ProfileUUID: uuid, Devices: make(map[string]string)}
+	for _, serial := range serials {
+		resp.Devices[serial] = c.results[serial][0]
+		c.results[serial] = c.results[serial][1:]
+	}
+	return resp, nil
+}
+
+func TestAutoAssignRetry(t *testing.T) {
+	client := &resultClient{results: map[string][]string{
+		"RETRIED": {"FAILED", "NOT_ACCESSIBLE", "SUCCESS"},
+		"FAILING": {"FAILED", "FAILED", "FAILED", "FAILED", "FAILED"},
+		"SUCCESS": {"SUCCESS"},
+	}}
+	w := &Watcher{
+		name:    "default",
+		logger:  log.NewNopLogger(),
+		client:  client,
+		retries: make(map[string]PendingAssignment),
+		db: &fakeWatcherDB{assigners: map[string][]AutoAssigner{
+			"default": {{Filter: "*", ProfileUUID: "profile"}},
+		}},
+	}
+	err := w.processAutoAssign([]dep.Device{
+		{SerialNumber: "RETRIED", OpType: "added"},
+		{SerialNumber: "FAILING", OpType: "added"},
+		{SerialNumber: "SUCCESS", OpType: "added"},
+		{SerialNumber: "MODIFIED", OpType: "modified"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pending := func() map[string]int {
+		w.retryMtx.Lock()
+		defer w.retryMtx.Unlock()
+		attempts := make(map[string]int)
+		for serial, p := range w.retries {
+			attempts[serial] = p.Attempts
+		}
+		return attempts
+	}
+	if have := pending(); len(have) != 2 || have["RETRIED"] != 1 || have["FAILING"] != 1 {
+		t.Fatalf("have pending %v after the first attempt, want RETRIED and FAILING", have)
+	}
+
+	// the retries are saved, and loaded by the watcher after a restart.
+	restarted, err := NewWatcher(w.db, nil, WithName("default"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have := restarted.retries; len(have) != 2 || have["RETRIED"].Attempts != 1 || have["FAILING"].ProfileUUID != "profile" {
+		t.Errorf("have retries %v after a restart, want RETRIED and FAILING", have)
+	}
+
+	w.retryAutoAssign()
+	w.retryAutoAssign()
+	if have := pending(); len(have) != 1 || have["FAILING"] != 3 {
+		t.Fatalf("have pending %v after two retries, want FAILING", have)
+	}
+	for i := 0; i < autoAssignAttempts; i++ {
+		w.retryAutoAssign()
+	}
+	if have := pending(); len(have) != 0 {
+		t.Errorf("have pending %v, want the retries to stop after %d attempts", have, autoAssignAttempts)
+	}
+	if saved, _ := w.db.LoadAutoAssignRetries("default"); len(saved) != 0 {
+		t.Errorf("have saved retries %v, want none", saved)
+	}
+}
+
+func TestWatcherWithSimulator(t *testing.T) {
+	sim := depsim.New()
+	sim.AddDevices(depsim.SampleDevices(3)...)
+	srv := httptest.NewServer(sim)
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	client := dep.NewClient(depsim.Credentials, dep.WithServerURL(u))
+
+	profile, err := client.DefineProfile(&dep.Profile{ProfileName: "school", URL: "https://mdm.example.com/mdm/enroll"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := &fakeWatcherDB{
+		cursors: make(map[string]Cursor),
+		assigners: map[string][]AutoAssigner{
+			"default": {{Filter: "serial^=NEW", ProfileUUID: profile.ProfileUUID}},
+		},
+	}
+	ps := inmem.NewPubSub()
+	events, err := ps.Subscribe(context.Background(), "test", SyncTopic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWatcher(db, ps, WithClient(client))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// waitFor waits for a sync event whose devices satisfy ok.
+	waitFor := func(what string, ok func([]dep.Device) bool) {
+		t.Helper()
+		timeout := time.After(2 * time.Second)
+		for {
+			select {
+			case ev := <-events:
+				var e Event
+				if err := UnmarshalEvent(ev.Message, &e); err != nil {
+					t.Fatal(err)
+				}
+				if ok(e.Devices) {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("timed out waiting for %s", what)
+			}
+		}
+	}
+
+	waitFor("fetched devices", func(devices []dep.Device) bool { return len(devices) == 3 })
+
+	sim.AddDevices(dep.Device{SerialNumber: "NEW1", Model: "iPad Air"})
+	w.SyncNow()
+	waitFor("added device", func(devices []dep.Device) bool {
+		return len(devices) == 1 && devices[0].SerialNumber == "NEW1" && devices[0].OpType == "added"
+	})
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		d, _ := sim.Device("NEW1")
+		if d.ProfileUUID == profile.ProfileUUID {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("NEW1 has profile %q, want auto-assigned %q", d.ProfileUUID, profile.ProfileUUID)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if d, _ := sim.Device("DEPSIM0000001"); d.ProfileUUID != "" {
+		t.Errorf("have profile %q for a device which does not match the filter", d.ProfileUUID)
+	}
+
+	// an expired cursor starts a new fetch of every device.
+	sim.ExpireCursors()
+	w.SyncNow()
+	waitFor("refetched devices", func(devices []dep.Device) bool { return len(devices) == 4 })
+}
@@ -0,0 +1,97 @@
+package sync
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/pkg/httputil"
+)
+
+// DryRunAutoAssigners looks up the devices with the DEP API and returns the
+// profile each one would be auto-assigned, without assigning it.
+func (s DEPSyncService) DryRunAutoAssigners(ctx context.Context, tokenName string, serials []string) ([]AutoAssignment, error) {
+	if len(serials) == 0 {
+		return nil, errors.New("no serial numbers to dry run")
+	}
+	aa, err := s.db.LoadAutoAssigners(tokenName)
+	if err != nil {
+		return nil, errors.Wrap(err, "get AutoAssigners")
+	}
+	assigners, err := newAutoAssigners(aa)
+	if err != nil {
+		return nil, err
+	}
+	details, err := s.syncer.DeviceDetails(tokenName, serials...)
+	if err != nil {
+		return nil, errors.Wrap(err, "get DEP device details")
+	}
+
+	assignments := make([]AutoAssignment, 0, len(serials))
+	for _, serial := range serials {
+		result := AutoAssignment{SerialNumber: serial, Status: "NOT_ACCESSIBLE"}
+		d, ok := details.Devices[serial]
+		if ok {
+			result.Status = d.ResponseStatus
+		}
+		if ok && (d.ResponseStatus == "" || d.ResponseStatus == "SUCCESS") {
+			d.SerialNumber = serial
+			fd, err := newFilterDevice(assigners, s.devices, d)
+			if err != nil {
+				return nil, err
+			}
+			if a, ok := assign(assigners, fd); ok {
+				result.ProfileUUID, result.Filter = a.ProfileUUID, a.Filter
+			}
+		}
+		assignments = append(assignments, result)
+	}
+	return assignments, nil
+}
+
+type dryRunAutoAssignersRequest struct {
+	TokenName string   `json:"token_name,omitempty"`
+	Serials   []string `json:"serials"`
+}
+
+type dryRunAutoAssignersResponse struct {
+	Assignments []AutoAssignment `json:"assignments,omitempty"`
+	Err         error            `json:"err,omitempty"`
+}
+
+func (r dryRunAutoAssignersResponse) Failed() error { return r.Err }
+
+func MakeDryRunAutoAssignersEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(dryRunAutoAssignersRequest)
+		assignments, err := s.DryRunAutoAssigners(ctx, req.TokenName, req.Serials)
+		return &dryRunAutoAssignersResponse{
+			Assignments: assignments,
+			Err:         err,
+		}, nil
+	}
+}
+
+func decodeDryRunAutoAssignersRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	var req dryRunAutoAssignersRequest
+	err := httputil.DecodeJSONRequest(r, &req)
+	return req, err
+}
+
+func decodeDryRunAutoAssignersResponse(ctx context.Context, r *http.Response) (interface{}, error) {
+	var resp dryRunAutoAssignersResponse
+	err := httputil.DecodeJSONResponse(r, &resp)
+	return resp, err
+}
+
+func (e Endpoints) DryRunAutoAssigners(ctx context.Context, tokenName string, serials []string) ([]AutoAssignment, error) {
+	request := dryRunAutoAssignersRequest{TokenName: tokenName, Serials: serials}
+	resp, err := e.DryRunAutoAssignersEndpoint(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	response := resp.(dryRunAutoAssignersResponse)
+	return response.Assignments, response.Err
+}
@@ -0,0 +1,70 @@
+package sync
+
+import (
+	"context"
+	"testing"
+
+	"github.com/vishnuvaradaraj/micromdm/dep"
+)
+
+type fakeSyncer map[string]dep.Device
+
+func (s fakeSyncer) SyncNow(string) error { return nil }
+
+func (s fakeSyncer) DeviceDetails(tokenName string, serials ...string) (*dep.DeviceDetailsResponse, error) {
+	resp := &dep.DeviceDetailsResponse{Devices: make(map[string]dep.Device)}
+	for _, serial := range serials {
+		d, ok := s[serial]
+		if !ok {
+			d = dep.Device{ResponseStatus: "NOT_ACCESSIBLE"}
+		}
+		resp.Devices[serial] = d
+	}
+	return resp, nil
+}
+
+// assignerDB implements DB for the auto-assigners of the default token.
+type assignerDB []AutoAssigner
+
+func (db *assignerDB) SaveAutoAssigner(a *AutoAssigner) error {
+	*db = append(*db, *a)
+	return nil
+}
+
+func (db *assignerDB) LoadAutoAssigners(string) ([]AutoAssigner, error) { return *db, nil }
+
+func (db *assignerDB) DeleteAutoAssigner(string, string) error { return nil }
+
+func TestDryRunAutoAssigners(t *testing.T) {
+	db := &assignerDB{}
+	svc := NewService(fakeSyncer{
+		"C02MAC":  {Model: "MacBook Pro", ResponseStatus: "SUCCESS"},
+		"DMPIPAD": {Model: "iPad", ResponseStatus: "SUCCESS"},
+	}, db, nil)
+	ctx := context.Background()
+
+	if err := svc.ApplyAutoAssigner(ctx, &AutoAssigner{Filter: "size=13", ProfileUUID: "p"}); err == nil {
+		t.Error("have no error applying an invalid filter")
+	}
+	if err := svc.ApplyAutoAssigner(ctx, &AutoAssigner{Filter: "model=MacBook Pro", ProfileUUID: "mac"}); err != nil {
+		t.Fatal(err)
+	}
+
+	assignments, err := svc.DryRunAutoAssigners(ctx, "", []string{"C02MAC", "DMPIPAD", "UNKNOWN"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []AutoAssignment{
+		{SerialNumber: "C02MAC", ProfileUUID: "mac", Filter: "model=MacBook Pro", Status: "SUCCESS"},
+		{SerialNumber: "DMPIPAD", Status: "SUCCESS"},
+		{SerialNumber: "UNKNOWN", Status: "NOT_ACCESSIBLE"},
+	}
+	if len(assignments) != len(want) {
+		t.Fatalf("have %+v, want %+v", assignments, want)
+	}
+	for i := range want {
+		if assignments[i] != want[i] {
+			t.Errorf("have %+v, want %+v", assignments[i], want[i])
+		}
+	}
+}
@@ -11,16 +11,19 @@ import (
 )
 
 type Event struct {
-	ID      string
-	Time    time.Time
-	Devices []dep.Device
+	ID        string
+	Time      time.Time
+	TokenName string
+	Devices   []dep.Device
 }
 
-func NewEvent(devices []dep.Device) *Event {
+// NewEvent returns an Event for devices synced with the DEP token named tokenName.
+func NewEvent(tokenName string, devices []dep.Device) *Event {
 	event := Event{
-		ID:      uuid.NewV4().String(),
-		Time:    time.Now().UTC(),
-		Devices: devices,
+		ID:        uuid.NewV4().String(),
+		Time:      time.Now().UTC(),
+		TokenName: tokenName,
+		Devices:   devices,
 	}
 	return &event
 }
@@ -45,9 +48,10 @@ func MarshalEvent(e *Event) ([]byte, error) {
 		})
 	}
 	return proto.Marshal(&depsyncproto.Event{
-		Id:      e.ID,
-		Time:    e.Time.UnixNano(),
-		Devices: devices,
+		Id:        e.ID,
+		Time:      e.Time.UnixNano(),
+		Devices:   devices,
+		TokenName: e.TokenName,
 	})
 }
 
@@ -60,6 +64,7 @@ func UnmarshalEvent(data []byte, e *Event) error {
 	}
 	e.ID = pb.GetId()
 	e.Time = time.Unix(0, pb.GetTime()).UTC()
+	e.TokenName = pb.GetTokenName()
 	protodev := pb.GetDevices()
 	var devices []dep.Device
 	for _, d := range protodev {
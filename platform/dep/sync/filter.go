@@ -0,0 +1,218 @@
+package sync
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/dep"
+)
+
+// MatchAll is the filter of an auto-assigner which assigns every device.
+const MatchAll = "*"
+
+// filterAttributes are the DEP device attributes a filter can match.
+var filterAttributes = map[string]func(filterDevice) string{
+	"serial":             func(d filterDevice) string { return d.SerialNumber },
+	"model":              func(d filterDevice) string { return d.Model },
+	"os":                 func(d filterDevice) string { return d.OS },
+	"device_family":      func(d filterDevice) string { return d.DeviceFamily },
+	"color":              func(d filterDevice) string { return d.Color },
+	"description":        func(d filterDevice) string { return d.Description },
+	"order_number":       func(d filterDevice) string { return d.OrderNumber },
+	"device_assigned_by": func(d filterDevice) string { return d.DeviceAssignedBy },
+}
+
+const (
+	// attributePrefix prefixes the custom device attributes in filters, as
+	// in attr.department=Sales.
+	attributePrefix = "attr."
+	// tagAttribute matches any of the tags of a device.
+	tagAttribute = "tag"
+)
+
+// DeviceAttributes looks up the custom attributes and tags of devices in the
+// device inventory, so that filters can match them.
+type DeviceAttributes interface {
+	DeviceAttributes(serial string) (map[string]string, []string, error)
+}
+
+// filterDevice is a DEP device with its custom attributes and tags.
+type filterDevice struct {
+	dep.Device
+	Attributes map[string]string
+	Tags       []string
+}
+
+// deviceFilter is a parsed AutoAssigner filter. A device matches if it
+// matches every condition.
+type deviceFilter []condition
+
+type condition struct {
+	attr  string
+	op    string
+	value string
+	re    *regexp.Regexp
+}
+
+// parseFilter parses a filter. The filter is either "*", or conditions
+// separated by ";" such as "model=MacBook Air;serial^=C02". A condition
+// compares a device attribute with "=" for equality, "^=" for a prefix or "~="
+// for a regular expression. Equality and prefixes ignore case. Custom
+// attributes are matched as attr.<name>, and tag matches any of the tags of
+// the device.
+func parseFilter(s string) (deviceFilter, error) {
+	if s == MatchAll {
+		return deviceFilter{}, nil
+	}
+	var f deviceFilter
+	for _, part := range strings.Split(s, ";") {
+		i := strings.Index(part, "=")
+		if i < 1 {
+			return nil, errors.Errorf("invalid filter condition %q, want attribute=value", part)
+		}
+		c := condition{op: "=", attr: part[:i], value: strings.TrimSpace(part[i+1:])}
+		if op := part[i-1]; op == '^' || op == '~' {
+			c.op = string(op) + "="
+			c.attr = part[:i-1]
+		}
+		c.attr = strings.ToLower(strings.TrimSpace(c.attr))
+		if _, ok := filterAttributes[c.attr]; !ok && !c.inventory() {
+			return nil, errors.Errorf("unknown filter attribute %q in %q", c.attr, part)
+		}
+		if c.op == "~=" {
+			re, err := regexp.Compile(c.value)
+			if err != nil {
+				return nil, errors.Wrapf(err, "filter condition %q", part)
+			}
+			c.re = re
+		}
+		f = append(f, c)
+	}
+	return f, nil
+}
+
+// inventory reports whether the condition matches a custom attribute or tag,
+// which are looked up in the device inventory.
+func (c condition) inventory() bool {
+	return c.attr == tagAttribute ||
+		(strings.HasPrefix(c.attr, attributePrefix) && len(c.attr) > len(attributePrefix))
+}
+
+func (c condition) matchValue(v string) bool {
+	switch c.op {
+	case "^=":
+		return strings.HasPrefix(strings.ToLower(v), strings.ToLower(c.value))
+	case "~=":
+		return c.re.MatchString(v)
+	default:
+		return strings.EqualFold(v, c.value)
+	}
+}
+
+func (c condition) match(d filterDevice) bool {
+	switch {
+	case c.attr == tagAttribute:
+		for _, tag := range d.Tags {
+			if c.matchValue(tag) {
+				return true
+			}
+		}
+		return false
+	case strings.HasPrefix(c.attr, attributePrefix):
+		return c.matchValue(d.Attributes[strings.TrimPrefix(c.attr, attributePrefix)])
+	default:
+		return c.matchValue(filterAttributes[c.attr](d))
+	}
+}
+
+func (f deviceFilter) match(d filterDevice) bool {
+	for _, c := range f {
+		if !c.match(d) {
+			return false
+		}
+	}
+	return true
+}
+
+// inventory reports whether the filter matches custom attributes or tags.
+func (f deviceFilter) inventory() bool {
+	for _, c := range f {
+		if c.inventory() {
+			return true
+		}
+	}
+	return false
+}
+
+// sortAutoAssigners sorts auto-assigners in the order they are evaluated: by
+// descending priority, with "*" after other filters of the same priority.
+func sortAutoAssigners(aa []AutoAssigner) {
+	sort.SliceStable(aa, func(i, j int) bool {
+		a, b := aa[i], aa[j]
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		if (a.Filter == MatchAll) != (b.Filter == MatchAll) {
+			return b.Filter == MatchAll
+		}
+		return a.Filter < b.Filter
+	})
+}
+
+// autoAssigner is an AutoAssigner with its filter parsed.
+type autoAssigner struct {
+	AutoAssigner
+	filter deviceFilter
+}
+
+// newAutoAssigners parses the filters of aa and sorts them. Invalid filters
+// are returned as an error, after the valid ones.
+func newAutoAssigners(aa []AutoAssigner) ([]autoAssigner, error) {
+	sortAutoAssigners(aa)
+	var (
+		assigners []autoAssigner
+		invalid   []string
+	)
+	for _, a := range aa {
+		f, err := parseFilter(a.Filter)
+		if err != nil {
+			invalid = append(invalid, err.Error())
+			continue
+		}
+		assigners = append(assigners, autoAssigner{AutoAssigner: a, filter: f})
+	}
+	if len(invalid) > 0 {
+		return assigners, errors.Errorf("skipping invalid auto-assigners: %s", strings.Join(invalid, "; "))
+	}
+	return assigners, nil
+}
+
+// assign returns the first auto-assigner which matches the device.
+func assign(assigners []autoAssigner, d filterDevice) (AutoAssigner, bool) {
+	for _, a := range assigners {
+		if a.filter.match(d) {
+			return a.AutoAssigner, true
+		}
+	}
+	return AutoAssigner{}, false
+}
+
+// newFilterDevice looks up the custom attributes and tags of a device if the
+// filter of any of the assigners matches them, and attrs is not nil.
+func newFilterDevice(assigners []autoAssigner, attrs DeviceAttributes, d dep.Device) (filterDevice, error) {
+	fd := filterDevice{Device: d}
+	if attrs == nil {
+		return fd, nil
+	}
+	for _, a := range assigners {
+		if a.filter.inventory() {
+			var err error
+			fd.Attributes, fd.Tags, err = attrs.DeviceAttributes(d.SerialNumber)
+			return fd, errors.Wrapf(err, "get attributes of device %s", d.SerialNumber)
+		}
+	}
+	return fd, nil
+}
@@ -0,0 +1,131 @@
+package sync
+
+import (
+	"testing"
+
+	"github.com/vishnuvaradaraj/micromdm/dep"
+)
+
+func TestParseFilter(t *testing.T) {
+	valid := []string{
+		"*",
+		"model=MacBook Pro",
+		"serial^=C02;os=OSX",
+		"serial~=^C02[A-Z]{2}",
+		"description^=MBP 13.3/2.0GHZ",
+		" Device_Assigned_By = it@example.com",
+		"attr.department=Sales;tag=loaner",
+		"tag~=^lab-",
+	}
+	for _, f := range valid {
+		if _, err := parseFilter(f); err != nil {
+			t.Errorf("%q: %s", f, err)
+		}
+	}
+	invalid := []string{
+		"",
+		"model",
+		"=MacBook Pro",
+		"size=13",
+		"serial~=[",
+		"model=MacBook Pro;",
+		"attr.=Sales",
+	}
+	for _, f := range invalid {
+		if _, err := parseFilter(f); err == nil {
+			t.Errorf("%q: have no error", f)
+		}
+	}
+}
+
+func TestAssign(t *testing.T) {
+	assigners, err := newAutoAssigners([]AutoAssigner{
+		{Filter: "*", ProfileUUID: "catch-all"},
+		{Filter: "os=iOS", ProfileUUID: "ios"},
+		{Filter: "os=iOS;color=space gray", ProfileUUID: "ios-gray", Priority: 10},
+		{Filter: "serial^=c02", ProfileUUID: "c02"},
+		{Filter: "serial~=^F[0-9]+$", ProfileUUID: "numeric-f"},
+		{Filter: "order_number=PO-1", ProfileUUID: "order", Priority: -1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		device dep.Device
+		want   string
+	}{
+		{dep.Device{SerialNumber: "X1", OS: "OSX"}, "catch-all"},
+		{dep.Device{SerialNumber: "X2", OS: "iOS", Color: "Silver"}, "ios"},
+		{dep.Device{SerialNumber: "X3", OS: "iOS", Color: "Space Gray"}, "ios-gray"},
+		{dep.Device{SerialNumber: "C02ABC", OS: "OSX"}, "c02"},
+		{dep.Device{SerialNumber: "F123"}, "numeric-f"},
+		{dep.Device{SerialNumber: "F12A"}, "catch-all"},
+		// the catch-all has a higher priority than the order number filter.
+		{dep.Device{SerialNumber: "X4", OrderNumber: "PO-1"}, "catch-all"},
+	}
+	for _, tt := range tests {
+		a, ok := assign(assigners, filterDevice{Device: tt.device})
+		if !ok {
+			t.Errorf("%s: no match, want %s", tt.device.SerialNumber, tt.want)
+			continue
+		}
+		if have := a.ProfileUUID; have != tt.want {
+			t.Errorf("%s: have %s, want %s", tt.device.SerialNumber, have, tt.want)
+		}
+	}
+}
+
+// deviceAttributes are the custom attributes and tags of devices, by serial
+// number.
+type deviceAttributes map[string]filterDevice
+
+func (da deviceAttributes) DeviceAttributes(serial string) (map[string]string, []string, error) {
+	d := da[serial]
+	return d.Attributes, d.Tags, nil
+}
+
+func TestAssignDeviceAttributes(t *testing.T) {
+	assigners, err := newAutoAssigners([]AutoAssigner{
+		{Filter: "*", ProfileUUID: "catch-all"},
+		{Filter: "attr.department=sales", ProfileUUID: "sales"},
+		{Filter: "tag=Loaner", ProfileUUID: "loaner", Priority: 10},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	attrs := deviceAttributes{
+		"S1": {Attributes: map[string]string{"department": "Sales"}},
+		"S2": {Attributes: map[string]string{"department": "Sales"}, Tags: []string{"kiosk", "loaner"}},
+	}
+	tests := []struct {
+		serial string
+		want   string
+	}{
+		{"S1", "sales"},
+		{"S2", "loaner"},
+		{"S3", "catch-all"},
+	}
+	for _, tt := range tests {
+		d, err := newFilterDevice(assigners, attrs, dep.Device{SerialNumber: tt.serial})
+		if err != nil {
+			t.Fatal(err)
+		}
+		a, _ := assign(assigners, d)
+		if have := a.ProfileUUID; have != tt.want {
+			t.Errorf("%s: have %s, want %s", tt.serial, have, tt.want)
+		}
+	}
+}
+
+func TestNewAutoAssignersSkipsInvalid(t *testing.T) {
+	assigners, err := newAutoAssigners([]AutoAssigner{
+		{Filter: "size=13", ProfileUUID: "invalid"},
+		{Filter: "model=iPad", ProfileUUID: "ipad"},
+	})
+	if err == nil {
+		t.Error("have no error for an invalid filter")
+	}
+	if len(assigners) != 1 || assigners[0].ProfileUUID != "ipad" {
+		t.Errorf("have %+v, want only the valid auto-assigner", assigners)
+	}
+}
@@ -2,6 +2,7 @@ package sync
 
 import (
 	"context"
+	"io"
 	"net/http"
 
 	"github.com/go-kit/kit/endpoint"
@@ -10,9 +11,17 @@ import (
 	"github.com/vishnuvaradaraj/micromdm/pkg/httputil"
 )
 
-func (s DEPSyncService) GetAutoAssigners(ctx context.Context) ([]AutoAssigner, error) {
-	aa, err := s.db.LoadAutoAssigners()
-	return aa, errors.Wrap(err, "get AutoAssigners")
+func (s DEPSyncService) GetAutoAssigners(ctx context.Context, tokenName string) ([]AutoAssigner, error) {
+	aa, err := s.db.LoadAutoAssigners(tokenName)
+	if err != nil {
+		return nil, errors.Wrap(err, "get AutoAssigners")
+	}
+	sortAutoAssigners(aa)
+	return aa, nil
+}
+
+type getAutoAssignersRequest struct {
+	TokenName string `json:"token_name,omitempty"`
 }
 
 type getAutoAssignersResponse struct {
@@ -24,7 +33,8 @@ func (r getAutoAssignersResponse) Failed() error { return r.Err }
 
 func MakeGetAutoAssignersEndpoint(s Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
-		assigners, err := s.GetAutoAssigners(ctx)
+		req := request.(getAutoAssignersRequest)
+		assigners, err := s.GetAutoAssigners(ctx, req.TokenName)
 		return &getAutoAssignersResponse{
 			AutoAssigners: assigners,
 			Err:           err,
@@ -32,14 +42,24 @@ func MakeGetAutoAssignersEndpoint(s Service) endpoint.Endpoint {
 	}
 }
 
+// decodeGetAutoAssignersRequest accepts an empty body for the default DEP token.
+func decodeGetAutoAssignersRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	var req getAutoAssignersRequest
+	err := httputil.DecodeJSONRequest(r, &req)
+	if err == io.EOF {
+		err = nil
+	}
+	return req, err
+}
+
 func decodeGetAutoAssignersResponse(ctx context.Context, r *http.Response) (interface{}, error) {
 	var req getAutoAssignersResponse
 	err := httputil.DecodeJSONResponse(r, &req)
 	return req, err
 }
 
-func (e Endpoints) GetAutoAssigners(ctx context.Context) ([]AutoAssigner, error) {
-	resp, err := e.GetAutoAssignersEndpoint(ctx, nil)
+func (e Endpoints) GetAutoAssigners(ctx context.Context, tokenName string) ([]AutoAssigner, error) {
+	resp, err := e.GetAutoAssignersEndpoint(ctx, getAutoAssignersRequest{TokenName: tokenName})
 	if err != nil {
 		return nil, err
 	}
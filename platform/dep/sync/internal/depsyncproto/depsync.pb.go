@@ -30,9 +30,10 @@ var _ = math.Inf
 const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
 
 type Event struct {
-	Id      string    `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
-	Time    int64     `protobuf:"varint,2,opt,name=time" json:"time,omitempty"`
-	Devices []*Device `protobuf:"bytes,3,rep,name=devices" json:"devices,omitempty"`
+	Id        string    `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Time      int64     `protobuf:"varint,2,opt,name=time" json:"time,omitempty"`
+	Devices   []*Device `protobuf:"bytes,3,rep,name=devices" json:"devices,omitempty"`
+	TokenName string    `protobuf:"bytes,4,opt,name=token_name,json=tokenName" json:"token_name,omitempty"`
 }
 
 func (m *Event) Reset()                    { *m = Event{} }
@@ -61,6 +62,13 @@ func (m *Event) GetDevices() []*Device {
 	return nil
 }
 
+func (m *Event) GetTokenName() string {
+	if m != nil {
+		return m.TokenName
+	}
+	return ""
+}
+
 type Device struct {
 	SerialNumber       string `protobuf:"bytes,1,opt,name=serial_number,json=serialNumber" json:"serial_number,omitempty"`
 	Model              string `protobuf:"bytes,2,opt,name=model" json:"model,omitempty"`
@@ -181,28 +189,29 @@ func init() {
 func init() { proto.RegisterFile("depsync.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 361 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x5c, 0x91, 0x51, 0x8b, 0xd3, 0x40,
-	0x10, 0xc7, 0x69, 0x73, 0x4d, 0x2f, 0xd3, 0xe4, 0xd4, 0xb1, 0xe0, 0x82, 0x2f, 0xf1, 0x44, 0x28,
-	0x22, 0x41, 0xf4, 0x13, 0x9c, 0x9c, 0xaf, 0x22, 0xb1, 0x3e, 0xf9, 0x10, 0xb6, 0xd9, 0xb1, 0xb7,
-	0x90, 0x66, 0x97, 0xec, 0xa6, 0x90, 0x6f, 0xe9, 0x47, 0x92, 0xce, 0x6e, 0xa0, 0xfa, 0x96, 0xf9,
-	0xff, 0x7e, 0x33, 0x13, 0x66, 0xa1, 0x50, 0x64, 0xdd, 0xd4, 0xb7, 0x95, 0x1d, 0x8c, 0x37, 0x98,
-	0xc7, 0x92, 0xab, 0xfb, 0x5f, 0xb0, 0xfa, 0x7a, 0xa6, 0xde, 0xe3, 0x1d, 0x2c, 0xb5, 0x12, 0x8b,
-	0x72, 0xb1, 0xcb, 0xea, 0xa5, 0x56, 0x88, 0x70, 0xe3, 0xf5, 0x89, 0xc4, 0xb2, 0x5c, 0xec, 0x92,
-	0x9a, 0xbf, 0xb1, 0x82, 0xb5, 0xa2, 0xb3, 0x6e, 0xc9, 0x89, 0xa4, 0x4c, 0x76, 0x9b, 0x4f, 0xdb,
-	0xea, 0x7a, 0x58, 0xf5, 0xc8, 0xb0, 0x9e, 0xa5, 0xfb, 0x3f, 0x09, 0xa4, 0x21, 0xc3, 0xb7, 0x50,
-	0x38, 0x1a, 0xb4, 0xec, 0x9a, 0x7e, 0x3c, 0x1d, 0x68, 0x88, 0x9b, 0xf2, 0x10, 0x7e, 0xe3, 0x0c,
-	0xb7, 0xb0, 0x3a, 0x19, 0x45, 0x1d, 0x2f, 0xcd, 0xea, 0x50, 0x60, 0x09, 0x1b, 0x45, 0xae, 0x1d,
-	0xb4, 0xf5, 0xda, 0xf4, 0x22, 0x61, 0x76, 0x1d, 0x5d, 0xfa, 0x5a, 0xd3, 0x99, 0x41, 0xdc, 0x84,
-	0x3e, 0x2e, 0xf0, 0x35, 0x64, 0xd2, 0x39, 0xf2, 0x8d, 0x97, 0x47, 0xb1, 0x62, 0x72, 0xcb, 0xc1,
-	0x5e, 0x1e, 0xf1, 0x1d, 0xdc, 0xd9, 0xc1, 0xfc, 0xd6, 0x1d, 0x35, 0xce, 0x4b, 0x3f, 0x3a, 0x91,
-	0xb2, 0x51, 0xc4, 0xf4, 0x07, 0x87, 0xf8, 0x06, 0xf2, 0x59, 0x1b, 0x47, 0xad, 0xc4, 0x3a, 0x2c,
-	0x8f, 0xd9, 0xcf, 0x51, 0x2b, 0xac, 0xe0, 0xe5, 0xac, 0x48, 0xe7, 0xf4, 0xb1, 0x6f, 0xf8, 0x6e,
-	0xb7, 0x7c, 0xb7, 0x17, 0x11, 0x3d, 0x30, 0xd9, 0x5f, 0x8e, 0xf8, 0x1e, 0xe6, 0xb0, 0xb1, 0xa3,
-	0x7b, 0x0a, 0x76, 0xc6, 0xf6, 0xb3, 0x08, 0xbe, 0x8f, 0xee, 0x89, 0xdd, 0x8f, 0xb0, 0x0d, 0xb7,
-	0x8c, 0xa3, 0x49, 0x35, 0x4a, 0x7a, 0x12, 0xc0, 0x3a, 0x06, 0xf6, 0x10, 0xd1, 0xa3, 0xf4, 0x84,
-	0x1f, 0x00, 0xff, 0xef, 0x38, 0x4c, 0x62, 0xc3, 0xbf, 0xfd, 0xfc, 0x5f, 0xff, 0xcb, 0x84, 0xaf,
-	0x60, 0x6d, 0x6c, 0xe3, 0x27, 0x4b, 0x22, 0x67, 0x25, 0x35, 0x76, 0x3f, 0x59, 0x8a, 0x80, 0x77,
-	0x15, 0xbc, 0x2b, 0x35, 0xf6, 0x32, 0xff, 0x90, 0xf2, 0x4b, 0x7f, 0xfe, 0x1b, 0x00, 0x00, 0xff,
-	0xff, 0x1d, 0x9a, 0x90, 0xb5, 0x55, 0x02, 0x00, 0x00,
+	// 376 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x5c, 0x92, 0xe1, 0x8a, 0xd3, 0x40,
+	0x10, 0xc7, 0x69, 0x73, 0x4d, 0x2f, 0xd3, 0xf6, 0xd4, 0xb1, 0xe0, 0x82, 0x08, 0xf5, 0x44, 0x28,
+	0x22, 0x41, 0xf4, 0x09, 0x4e, 0xce, 0xaf, 0x87, 0xc4, 0xfa, 0x79, 0xd9, 0x66, 0xc7, 0xde, 0x62,
+	0x92, 0x5d, 0xb2, 0x9b, 0x83, 0xf8, 0x94, 0x3e, 0x92, 0x74, 0x76, 0x03, 0xe7, 0x7d, 0xcb, 0xfc,
+	0x7f, 0xbf, 0x9d, 0x19, 0x86, 0xc0, 0x46, 0x93, 0xf3, 0x63, 0x57, 0x97, 0xae, 0xb7, 0xc1, 0xe2,
+	0x3a, 0x95, 0x5c, 0x5d, 0xff, 0x81, 0xc5, 0xb7, 0x07, 0xea, 0x02, 0x5e, 0xc1, 0xdc, 0x68, 0x31,
+	0xdb, 0xcd, 0xf6, 0x45, 0x35, 0x37, 0x1a, 0x11, 0x2e, 0x82, 0x69, 0x49, 0xcc, 0x77, 0xb3, 0x7d,
+	0x56, 0xf1, 0x37, 0x96, 0xb0, 0xd4, 0xf4, 0x60, 0x6a, 0xf2, 0x22, 0xdb, 0x65, 0xfb, 0xd5, 0xe7,
+	0x6d, 0xf9, 0xb8, 0x59, 0x79, 0xcb, 0xb0, 0x9a, 0x24, 0x7c, 0x03, 0x10, 0xec, 0x6f, 0xea, 0x64,
+	0xa7, 0x5a, 0x12, 0x17, 0xdc, 0xbb, 0xe0, 0xe4, 0x4e, 0xb5, 0x74, 0xfd, 0x37, 0x83, 0x3c, 0x3e,
+	0xc1, 0x77, 0xb0, 0xf1, 0xd4, 0x1b, 0xd5, 0xc8, 0x6e, 0x68, 0x8f, 0xd4, 0xa7, 0x45, 0xd6, 0x31,
+	0xbc, 0xe3, 0x0c, 0xb7, 0xb0, 0x68, 0xad, 0xa6, 0x86, 0x77, 0x2a, 0xaa, 0x58, 0xe0, 0x0e, 0x56,
+	0x9a, 0x7c, 0xdd, 0x1b, 0x17, 0x8c, 0xed, 0x44, 0xc6, 0xec, 0x71, 0x74, 0x7e, 0x57, 0xdb, 0xc6,
+	0xf6, 0x69, 0x83, 0x58, 0xe0, 0x6b, 0x28, 0x94, 0xf7, 0x14, 0x64, 0x50, 0x27, 0xb1, 0x60, 0x72,
+	0xc9, 0xc1, 0x41, 0x9d, 0xf0, 0x3d, 0x5c, 0xb9, 0xde, 0xfe, 0x32, 0x0d, 0x49, 0x1f, 0x54, 0x18,
+	0xbc, 0xc8, 0xd9, 0xd8, 0xa4, 0xf4, 0x07, 0x87, 0xf8, 0x16, 0xd6, 0x93, 0x36, 0x0c, 0x46, 0x8b,
+	0x65, 0x1c, 0x9e, 0xb2, 0x9f, 0x83, 0xd1, 0x58, 0xc2, 0xcb, 0x49, 0x51, 0xde, 0x9b, 0x53, 0x27,
+	0xf9, 0xac, 0x97, 0x7c, 0xd6, 0x17, 0x09, 0xdd, 0x30, 0x39, 0x9c, 0x6f, 0xfc, 0x01, 0xa6, 0x50,
+	0xba, 0xc1, 0xdf, 0x47, 0xbb, 0x60, 0xfb, 0x59, 0x02, 0xdf, 0x07, 0x7f, 0xcf, 0xee, 0x27, 0xd8,
+	0xc6, 0x53, 0xa7, 0xd6, 0xa4, 0xa5, 0x56, 0x81, 0x04, 0xb0, 0x8e, 0x91, 0xdd, 0x24, 0x74, 0xab,
+	0x02, 0xe1, 0x47, 0xc0, 0xa7, 0x2f, 0x8e, 0xa3, 0x58, 0xf1, 0xda, 0xcf, 0xff, 0xf7, 0xbf, 0x8e,
+	0xf8, 0x0a, 0x96, 0xd6, 0xc9, 0x30, 0x3a, 0x12, 0x6b, 0x56, 0x72, 0xeb, 0x0e, 0xa3, 0xa3, 0x04,
+	0x78, 0xd6, 0x86, 0x67, 0xe5, 0xd6, 0x9d, 0xfb, 0x1f, 0x73, 0xfe, 0x11, 0xbe, 0xfc, 0x1b, 0x00,
+	0xf9, 0xfc, 0x9c, 0x0b, 0x74, 0x02, 0x00, 0x00,
 }
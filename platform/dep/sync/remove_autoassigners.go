@@ -9,13 +9,14 @@ import (
 	"github.com/pkg/errors"
 )
 
-func (s DEPSyncService) RemoveAutoAssigner(ctx context.Context, filter string) error {
-	err := s.db.DeleteAutoAssigner(filter)
+func (s DEPSyncService) RemoveAutoAssigner(ctx context.Context, tokenName, filter string) error {
+	err := s.db.DeleteAutoAssigner(tokenName, filter)
 	return errors.Wrap(err, "remove AutoAssigner")
 }
 
 type removeAutoAssignerRequest struct {
-	Filter string `json:"filter"`
+	Filter    string `json:"filter"`
+	TokenName string `json:"token_name,omitempty"`
 }
 
 type removeAutoAssignerResponse struct {
@@ -27,7 +28,7 @@ func (r removeAutoAssignerResponse) Failed() error { return r.Err }
 func MakeRemoveAutoAssignerEndpoint(s Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		req := request.(removeAutoAssignerRequest)
-		err := s.RemoveAutoAssigner(ctx, req.Filter)
+		err := s.RemoveAutoAssigner(ctx, req.TokenName, req.Filter)
 		return &removeAutoAssignerResponse{
 			Err: err,
 		}, nil
@@ -46,8 +47,8 @@ func decodeRemoveAutoAssignerRequest(ctx context.Context, r *http.Request) (inte
 	return req, err
 }
 
-func (e Endpoints) RemoveAutoAssigner(ctx context.Context, filter string) error {
-	request := removeAutoAssignerRequest{Filter: filter}
+func (e Endpoints) RemoveAutoAssigner(ctx context.Context, tokenName, filter string) error {
+	request := removeAutoAssignerRequest{Filter: filter, TokenName: tokenName}
 	resp, err := e.RemoveAutoAssignerEndpoint(ctx, request)
 	if err != nil {
 		return err
@@ -8,36 +8,41 @@ import (
 	"github.com/vishnuvaradaraj/micromdm/pkg/httputil"
 )
 
-func NewService(syncer Syncer, db DB) *DEPSyncService {
-	return &DEPSyncService{syncer: syncer, db: db}
+// NewService creates the DEP sync service. devices looks up the custom
+// attributes and tags of devices for dry runs, and may be nil.
+func NewService(syncer Syncer, db DB, devices DeviceAttributes) *DEPSyncService {
+	return &DEPSyncService{syncer: syncer, db: db, devices: devices}
 }
 
 type Endpoints struct {
-	SyncNowEndpoint            endpoint.Endpoint
-	ApplyAutoAssignerEndpoint  endpoint.Endpoint
-	GetAutoAssignersEndpoint   endpoint.Endpoint
-	RemoveAutoAssignerEndpoint endpoint.Endpoint
+	SyncNowEndpoint             endpoint.Endpoint
+	ApplyAutoAssignerEndpoint   endpoint.Endpoint
+	GetAutoAssignersEndpoint    endpoint.Endpoint
+	RemoveAutoAssignerEndpoint  endpoint.Endpoint
+	DryRunAutoAssignersEndpoint endpoint.Endpoint
 }
 
 func MakeServerEndpoints(s Service, outer endpoint.Middleware, others ...endpoint.Middleware) Endpoints {
 	return Endpoints{
-		SyncNowEndpoint:            endpoint.Chain(outer, others...)(MakeSyncNowEndpoint(s)),
-		ApplyAutoAssignerEndpoint:  endpoint.Chain(outer, others...)(MakeApplyAutoAssignerEndpoint(s)),
-		GetAutoAssignersEndpoint:   endpoint.Chain(outer, others...)(MakeGetAutoAssignersEndpoint(s)),
-		RemoveAutoAssignerEndpoint: endpoint.Chain(outer, others...)(MakeRemoveAutoAssignerEndpoint(s)),
+		SyncNowEndpoint:             endpoint.Chain(outer, others...)(MakeSyncNowEndpoint(s)),
+		ApplyAutoAssignerEndpoint:   endpoint.Chain(outer, others...)(MakeApplyAutoAssignerEndpoint(s)),
+		GetAutoAssignersEndpoint:    endpoint.Chain(outer, others...)(MakeGetAutoAssignersEndpoint(s)),
+		RemoveAutoAssignerEndpoint:  endpoint.Chain(outer, others...)(MakeRemoveAutoAssignerEndpoint(s)),
+		DryRunAutoAssignersEndpoint: endpoint.Chain(outer, others...)(MakeDryRunAutoAssignersEndpoint(s)),
 	}
 }
 
 func RegisterHTTPHandlers(r *mux.Router, e Endpoints, options ...httptransport.ServerOption) {
-	// POST		/v1/dep/syncnow			request a DEP sync operation to happen now
+	// POST		/v1/dep/syncnow			request a DEP sync of one or all DEP tokens to happen now
 	// POST		/v1/dep/autoassigners	set a DEP auto-assigner
-	// GET		/v1/dep/autoassigners	get list of DEP auto-assigners
+	// GET		/v1/dep/autoassigners	get list of DEP auto-assigners of a DEP token
 	// DELETE	/v1/dep/autoassigners	remove a DEP auto-assigner
+	// POST		/v1/dep/autoassigners/dryrun	show the profiles devices would be auto-assigned
 
 	r.Methods("POST").Path("/v1/dep/syncnow").Handler(httptransport.NewServer(
 		e.SyncNowEndpoint,
-		decodeEmptyRequest,
-		encodeEmptyResponse,
+		decodeSyncNowRequest,
+		httputil.EncodeJSONResponse,
 		options...,
 	))
 
@@ -50,7 +55,7 @@ func RegisterHTTPHandlers(r *mux.Router, e Endpoints, options ...httptransport.S
 
 	r.Methods("GET").Path("/v1/dep/autoassigners").Handler(httptransport.NewServer(
 		e.GetAutoAssignersEndpoint,
-		decodeEmptyRequest,
+		decodeGetAutoAssignersRequest,
 		httputil.EncodeJSONResponse,
 		options...,
 	))
@@ -61,4 +66,11 @@ func RegisterHTTPHandlers(r *mux.Router, e Endpoints, options ...httptransport.S
 		httputil.EncodeJSONResponse,
 		options...,
 	))
+
+	r.Methods("POST").Path("/v1/dep/autoassigners/dryrun").Handler(httptransport.NewServer(
+		e.DryRunAutoAssignersEndpoint,
+		decodeDryRunAutoAssignersRequest,
+		httputil.EncodeJSONResponse,
+		options...,
+	))
 }
@@ -5,22 +5,26 @@ import (
 	"time"
 )
 
+// The DEP token name selects which DEP server an operation applies to. An
+// empty name is the default token, except for SyncNow, which syncs every token.
 type Service interface {
-	SyncNow(context.Context) error
+	SyncNow(ctx context.Context, tokenName string) error
 	ApplyAutoAssigner(context.Context, *AutoAssigner) error
-	GetAutoAssigners(context.Context) ([]AutoAssigner, error)
-	RemoveAutoAssigner(context.Context, string) error
+	GetAutoAssigners(ctx context.Context, tokenName string) ([]AutoAssigner, error)
+	RemoveAutoAssigner(ctx context.Context, tokenName, filter string) error
+	DryRunAutoAssigners(ctx context.Context, tokenName string, serials []string) ([]AutoAssignment, error)
 }
 
 type DB interface {
 	SaveAutoAssigner(a *AutoAssigner) error
-	LoadAutoAssigners() ([]AutoAssigner, error)
-	DeleteAutoAssigner(filter string) error
+	LoadAutoAssigners(tokenName string) ([]AutoAssigner, error)
+	DeleteAutoAssigner(tokenName, filter string) error
 }
 
 type DEPSyncService struct {
-	db     DB
-	syncer Syncer
+	db      DB
+	syncer  Syncer
+	devices DeviceAttributes
 }
 
 type Cursor struct {
@@ -34,7 +38,26 @@ func (c Cursor) Valid() bool {
 	return c.CreatedAt.Before(expiration)
 }
 
+// AutoAssigner assigns a DEP profile to devices which are added to a DEP token.
+// Auto-assigners are evaluated by descending priority, and a device is
+// assigned the profile of the first one whose filter matches. See parseFilter
+// for the filter syntax.
 type AutoAssigner struct {
 	Filter      string `json:"filter"`
 	ProfileUUID string `json:"profile_uuid"`
+	// TokenName is the DEP token whose devices are assigned.
+	TokenName string `json:"token_name,omitempty"`
+	Priority  int    `json:"priority,omitempty"`
+}
+
+// AutoAssignment is the profile the auto-assigners of a DEP token assign to a
+// device.
+type AutoAssignment struct {
+	SerialNumber string `json:"serial_number"`
+	// ProfileUUID and Filter are empty if no auto-assigner matches.
+	ProfileUUID string `json:"profile_uuid,omitempty"`
+	Filter      string `json:"filter,omitempty"`
+	// Status is the DEP API response status of the device, such as
+	// NOT_ACCESSIBLE if the device does not belong to the DEP token.
+	Status string `json:"status,omitempty"`
 }
@@ -2,39 +2,56 @@ package sync
 
 import (
 	"context"
+	"io"
 	"net/http"
 
 	"github.com/go-kit/kit/endpoint"
+
+	"github.com/vishnuvaradaraj/micromdm/pkg/httputil"
 )
 
-func (s *DEPSyncService) SyncNow(_ context.Context) error {
-	s.syncer.SyncNow()
-	return nil
+func (s *DEPSyncService) SyncNow(_ context.Context, tokenName string) error {
+	return s.syncer.SyncNow(tokenName)
 }
 
-type syncNowResponse struct{}
-type syncNowRequest struct{}
+type syncNowRequest struct {
+	TokenName string `json:"token_name,omitempty"`
+}
 
-func MakeSyncNowEndpoint(s Service) endpoint.Endpoint {
-	return func(ctx context.Context, _ interface{}) (interface{}, error) {
-		s.SyncNow(ctx)
-		return syncNowResponse{}, nil
-	}
+type syncNowResponse struct {
+	Err error `json:"err,omitempty"`
 }
 
-func decodeEmptyRequest(ctx context.Context, r *http.Request) (interface{}, error) {
-	return nil, nil
+func (r syncNowResponse) Failed() error { return r.Err }
+
+func MakeSyncNowEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(syncNowRequest)
+		err := s.SyncNow(ctx, req.TokenName)
+		return syncNowResponse{Err: err}, nil
+	}
 }
 
-func encodeEmptyResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
-	return nil
+// decodeSyncNowRequest accepts an empty body, which syncs every DEP token.
+func decodeSyncNowRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	var req syncNowRequest
+	err := httputil.DecodeJSONRequest(r, &req)
+	if err == io.EOF {
+		err = nil
+	}
+	return req, err
 }
 
-func decodeEmptyResponse(ctx context.Context, r *http.Response) (interface{}, error) {
-	return nil, nil
+func decodeSyncNowResponse(ctx context.Context, r *http.Response) (interface{}, error) {
+	var resp syncNowResponse
+	err := httputil.DecodeJSONResponse(r, &resp)
+	return resp, err
 }
 
-func (e Endpoints) SyncNow(ctx context.Context) error {
-	_, err := e.SyncNowEndpoint(ctx, nil)
-	return err
+func (e Endpoints) SyncNow(ctx context.Context, tokenName string) error {
+	resp, err := e.SyncNowEndpoint(ctx, syncNowRequest{TokenName: tokenName})
+	if err != nil {
+		return err
+	}
+	return resp.(syncNowResponse).Err
 }
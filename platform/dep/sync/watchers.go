@@ -0,0 +1,134 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/dep"
+	conf "github.com/vishnuvaradaraj/micromdm/platform/config"
+	"github.com/vishnuvaradaraj/micromdm/platform/pubsub"
+)
+
+// Watchers runs a Watcher for every DEP token. Each token has its own client,
+// cursor and auto-assigners. A watcher is started when a token with a new name
+// is added, and the client of a renewed token is replaced.
+type Watchers struct {
+	db     WatcherDB
+	pub    pubsub.Publisher
+	logger log.Logger
+	// opts are applied to every Watcher.
+	opts []Option
+
+	mtx      sync.Mutex
+	watchers map[string]*Watcher
+}
+
+// NewWatchers starts a Watcher for each client, keyed by DEP token name. The
+// options are applied to each Watcher.
+func NewWatchers(db WatcherDB, pub pubsub.PublishSubscriber, logger log.Logger, clients map[string]Client, opts ...Option) (*Watchers, error) {
+	ws := &Watchers{
+		db:       db,
+		pub:      pub,
+		logger:   logger,
+		opts:     opts,
+		watchers: make(map[string]*Watcher),
+	}
+	for name, client := range clients {
+		if err := ws.start(name, client); err != nil {
+			return nil, err
+		}
+	}
+	if len(clients) == 0 {
+		level.Info(logger).Log("msg", "waiting for DEP token to be added before starting sync")
+	}
+	if err := ws.watchTokenUpdates(pub); err != nil {
+		return nil, err
+	}
+	return ws, nil
+}
+
+func (ws *Watchers) start(name string, client Client) error {
+	opts := append([]Option{
+		WithName(name),
+		WithClient(client),
+		WithLogger(log.With(ws.logger, "dep_token", name)),
+	}, ws.opts...)
+	w, err := NewWatcher(ws.db, ws.pub, opts...)
+	if err != nil {
+		return errors.Wrapf(err, "start DEP watcher for token %s", name)
+	}
+	ws.watchers[name] = w
+	return nil
+}
+
+func (ws *Watchers) watchTokenUpdates(sub pubsub.Subscriber) error {
+	tokenAdded, err := sub.Subscribe(context.TODO(), "token-events", conf.DEPTokenTopic)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for event := range tokenAdded {
+			var token conf.DEPToken
+			if err := json.Unmarshal(event.Message, &token); err != nil {
+				level.Info(ws.logger).Log("err", err, "msg", "unmarshalling tokenAdd to token")
+				continue
+			}
+
+			client, err := token.Client()
+			if err != nil {
+				level.Info(ws.logger).Log("err", err, "msg", "creating new DEP client")
+				continue
+			}
+
+			name := token.InstanceName()
+			ws.mtx.Lock()
+			if w, ok := ws.watchers[name]; ok {
+				w.UpdateClient(client)
+			} else if err := ws.start(name, client); err != nil {
+				level.Info(ws.logger).Log("err", err, "msg", "starting DEP sync for new token")
+			}
+			ws.mtx.Unlock()
+		}
+	}()
+	return nil
+}
+
+func (ws *Watchers) SyncNow(tokenName string) error {
+	ws.mtx.Lock()
+	defer ws.mtx.Unlock()
+	if tokenName == "" {
+		for _, w := range ws.watchers {
+			w.SyncNow()
+		}
+		return nil
+	}
+	w, ok := ws.watchers[tokenName]
+	if !ok {
+		return errors.Errorf("no DEP token named %s", tokenName)
+	}
+	w.SyncNow()
+	return nil
+}
+
+func (ws *Watchers) DeviceDetails(tokenName string, serials ...string) (*dep.DeviceDetailsResponse, error) {
+	if tokenName == "" {
+		tokenName = conf.DefaultDEPTokenName
+	}
+	ws.mtx.Lock()
+	w, ok := ws.watchers[tokenName]
+	ws.mtx.Unlock()
+	if !ok {
+		return nil, errors.Errorf("no DEP token named %s", tokenName)
+	}
+	client := w.currentClient()
+	if client == nil {
+		return nil, errors.Errorf("DEP token %s has no client yet", tokenName)
+	}
+	return client.DeviceDetails(serials...)
+}
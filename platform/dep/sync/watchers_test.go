@@ -0,0 +1,165 @@
+package sync
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/vishnuvaradaraj/micromdm/dep"
+	"github.com/vishnuvaradaraj/micromdm/platform/pubsub/inmem"
+)
+
+// fakeClient returns a single added device on fetch, and reports the serials
+// assigned to each profile.
+type fakeClient struct {
+	serial   string
+	assigned chan []string
+}
+
+func (c *fakeClient) FetchDevices(...dep.DeviceRequestOption) (*dep.DeviceResponse, error) {
+	return &dep.DeviceResponse{
+		Cursor:  c.serial + "-cursor",
+		Devices: []dep.Device{{SerialNumber: c.serial, OpType: "added"}},
+	}, nil
+}
+
+func (c *fakeClient) SyncDevices(cursor string, _ ...dep.DeviceRequestOption) (*dep.DeviceResponse, error) {
+	return &dep.DeviceResponse{Cursor: cursor}, nil
+}
+
+func (c *fakeClient) AssignProfile(uuid string, serials ...string) (*dep.ProfileResponse, error) {
+	c.assigned <- append([]string{uuid}, serials...)
+	return &dep.ProfileResponse{ProfileUUID: uuid}, nil
+}
+
+func (c *fakeClient) DeviceDetails(serials ...string) (*dep.DeviceDetailsResponse, error) {
+	resp := &dep.DeviceDetailsResponse{Devices: make(map[string]dep.Device)}
+	for _, serial := range serials {
+		resp.Devices[serial] = dep.Device{SerialNumber: serial, Model: "MacBook Pro", ResponseStatus: "SUCCESS"}
+	}
+	return resp, nil
+}
+
+type fakeWatcherDB struct {
+	mtx       sync.Mutex
+	cursors   map[string]Cursor
+	assigners map[string][]AutoAssigner
+	retries   map[string][]PendingAssignment
+}
+
+func (db *fakeWatcherDB) LoadCursor(name string) (*Cursor, error) {
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	c := db.cursors[name]
+	return &c, nil
+}
+
+func (db *fakeWatcherDB) SaveCursor(name string, c Cursor) error {
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	db.cursors[name] = c
+	return nil
+}
+
+func (db *fakeWatcherDB) LoadAutoAssigners(name string) ([]AutoAssigner, error) {
+	return db.assigners[name], nil
+}
+
+func (db *fakeWatcherDB) LoadAutoAssignRetries(name string) ([]PendingAssignment, error) {
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	return db.retries[name], nil
+}
+
+func (db *fakeWatcherDB) SaveAutoAssignRetries(name string, pending []PendingAssignment) error {
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	if db.retries == nil {
+		db.retries = make(map[string][]PendingAssignment)
+	}
+	db.retries[name] = pending
+	return nil
+}
+
+func TestWatchers(t *testing.T) {
+	db := &fakeWatcherDB{
+		cursors: make(map[string]Cursor),
+		assigners: map[string][]AutoAssigner{
+			"school": {{Filter: "*", ProfileUUID: "school-profile", TokenName: "school"}},
+		},
+	}
+	ps := inmem.NewPubSub()
+	events, err := ps.Subscribe(context.Background(), "test", SyncTopic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clients := map[string]*fakeClient{
+		"default": {serial: "DEFAULT1", assigned: make(chan []string, 1)},
+		"school":  {serial: "SCHOOL1", assigned: make(chan []string, 1)},
+	}
+	ws, err := NewWatchers(db, ps, log.NewNopLogger(), map[string]Client{
+		"default": clients["default"],
+		"school":  clients["school"],
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// each watcher publishes its devices with the name of its token.
+	tokens := make(map[string]string)
+	for len(tokens) < 2 {
+		select {
+		case ev := <-events:
+			var e Event
+			if err := UnmarshalEvent(ev.Message, &e); err != nil {
+				t.Fatal(err)
+			}
+			for _, d := range e.Devices {
+				tokens[d.SerialNumber] = e.TokenName
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for sync events, have %v", tokens)
+		}
+	}
+	if have, want := tokens["DEFAULT1"], "default"; have != want {
+		t.Errorf("DEFAULT1: have token %q, want %q", have, want)
+	}
+	if have, want := tokens["SCHOOL1"], "school"; have != want {
+		t.Errorf("SCHOOL1: have token %q, want %q", have, want)
+	}
+
+	// only the token with an auto-assigner assigns its devices.
+	select {
+	case have := <-clients["school"].assigned:
+		if len(have) != 2 || have[0] != "school-profile" || have[1] != "SCHOOL1" {
+			t.Errorf("have assignment %v, want [school-profile SCHOOL1]", have)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for school auto-assignment")
+	}
+	select {
+	case have := <-clients["default"].assigned:
+		t.Errorf("have assignment %v for the default token, want none", have)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	db.mtx.Lock()
+	if have, want := db.cursors["school"].Value, "SCHOOL1-cursor"; have != want {
+		t.Errorf("have school cursor %q, want %q", have, want)
+	}
+	db.mtx.Unlock()
+
+	if err := ws.SyncNow("school"); err != nil {
+		t.Errorf("sync school: %s", err)
+	}
+	if err := ws.SyncNow(""); err != nil {
+		t.Errorf("sync all: %s", err)
+	}
+	if err := ws.SyncNow("office"); err == nil {
+		t.Error("have no error syncing an unknown token")
+	}
+}
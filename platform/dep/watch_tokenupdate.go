@@ -32,7 +32,7 @@ func (svc *DEPService) watchTokenUpdates(pubsub pubsub.Subscriber) error {
 				}
 
 				svc.mtx.Lock()
-				svc.client = client
+				svc.clients[token.InstanceName()] = client
 				svc.mtx.Unlock()
 			}
 		}
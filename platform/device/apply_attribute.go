@@ -0,0 +1,72 @@
+package device
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/pkg/httputil"
+)
+
+// ApplyAttribute defines a custom attribute, or changes its description. The
+// type of an attribute can not be changed, because the values of the devices
+// were formatted for it.
+func (svc *DeviceService) ApplyAttribute(ctx context.Context, a *Attribute) error {
+	if err := a.Verify(); err != nil {
+		return err
+	}
+	attributes, err := svc.store.Attributes()
+	if err != nil {
+		return errors.Wrap(err, "get device attributes")
+	}
+	for _, existing := range attributes {
+		if existing.Name == a.Name && existing.Type != a.Type {
+			return attributeErrorf("%s is a %s attribute, remove it before defining it with another type", a.Name, existing.Type)
+		}
+	}
+	return svc.store.SaveAttribute(a)
+}
+
+type applyAttributeRequest struct {
+	Attribute *Attribute `json:"attribute"`
+}
+
+type applyAttributeResponse struct {
+	Err error `json:"err,omitempty"`
+}
+
+func (r applyAttributeResponse) Failed() error { return r.Err }
+
+func decodeApplyAttributeRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	var req applyAttributeRequest
+	err := httputil.DecodeJSONRequest(r, &req)
+	return req, err
+}
+
+func decodeApplyAttributeResponse(_ context.Context, r *http.Response) (interface{}, error) {
+	var resp applyAttributeResponse
+	err := httputil.DecodeJSONResponse(r, &resp)
+	return resp, err
+}
+
+func MakeApplyAttributeEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(applyAttributeRequest)
+		if req.Attribute == nil {
+			return applyAttributeResponse{Err: attributeErrorf("request must contain an attribute")}, nil
+		}
+		err = svc.ApplyAttribute(ctx, req.Attribute)
+		return applyAttributeResponse{Err: err}, nil
+	}
+}
+
+func (e Endpoints) ApplyAttribute(ctx context.Context, a *Attribute) error {
+	request := applyAttributeRequest{Attribute: a}
+	response, err := e.ApplyAttributeEndpoint(ctx, request)
+	if err != nil {
+		return err
+	}
+	return response.(applyAttributeResponse).Err
+}
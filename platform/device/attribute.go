@@ -0,0 +1,137 @@
+package device
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AttributeType is the type of the values of a custom attribute.
+type AttributeType string
+
+const (
+	StringAttribute AttributeType = "string"
+	NumberAttribute AttributeType = "number"
+	BoolAttribute   AttributeType = "bool"
+	DateAttribute   AttributeType = "date"
+)
+
+// Attribute defines a custom device attribute, such as a department, owner
+// email or lease end date. Devices store the values of the attributes in
+// Device.Attributes, formatted for the type of the attribute so that they
+// compare correctly in filters.
+type Attribute struct {
+	Name        string        `json:"name"`
+	Type        AttributeType `json:"type"`
+	Description string        `json:"description,omitempty"`
+}
+
+// attributeName is the syntax of attribute names, which are used in filters
+// as attr.<name>.
+var attributeName = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// AttributeError is returned for attribute definitions, attribute values and
+// tags which are not valid.
+type AttributeError struct {
+	Message string
+}
+
+func (e *AttributeError) Error() string { return "invalid device attribute: " + e.Message }
+
+func (e *AttributeError) StatusCode() int { return http.StatusBadRequest }
+
+func attributeErrorf(format string, args ...interface{}) error {
+	return &AttributeError{Message: fmt.Sprintf(format, args...)}
+}
+
+func (a *Attribute) Verify() error {
+	if !attributeName.MatchString(a.Name) {
+		return attributeErrorf("name %q must be lower case letters, digits and underscores, starting with a letter", a.Name)
+	}
+	switch a.Type {
+	case StringAttribute, NumberAttribute, BoolAttribute, DateAttribute:
+		return nil
+	default:
+		return attributeErrorf("%s has unknown type %q, want string, number, bool or date", a.Name, a.Type)
+	}
+}
+
+// format parses a value of the attribute and formats it the way it is
+// stored: numbers without exponents or trailing zeros, booleans as true or
+// false and dates as YYYY-MM-DD.
+func (a *Attribute) format(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	switch a.Type {
+	case NumberAttribute:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return "", attributeErrorf("%s must be a number, got %q", a.Name, value)
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	case BoolAttribute:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", attributeErrorf("%s must be true or false, got %q", a.Name, value)
+		}
+		return strconv.FormatBool(b), nil
+	case DateAttribute:
+		t, err := parseTime(value)
+		if err != nil {
+			return "", attributeErrorf("%s must be a date, got %q", a.Name, value)
+		}
+		return t.UTC().Format("2006-01-02"), nil
+	default:
+		return value, nil
+	}
+}
+
+// formatTags trims tags and removes duplicates. Tags can not be empty or
+// contain commas or semicolons, which separate tags in flags and CSV files.
+func formatTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool, len(tags))
+	var formatted []string
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || strings.ContainsAny(tag, ",;") {
+			return nil, attributeErrorf("tag %q must not be empty or contain , or ;", tag)
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			formatted = append(formatted, tag)
+		}
+	}
+	return formatted, nil
+}
+
+// hasTag reports whether dev is tagged with tag, ignoring case.
+func hasTag(dev *Device, tag string) bool {
+	for _, t := range dev.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedTags returns the union of tags and add without the tags in remove,
+// sorted. Tags which only differ in case are the same tag.
+func sortedTags(tags, add, remove []string) []string {
+	set := make(map[string]string)
+	for _, tag := range append(append([]string(nil), tags...), add...) {
+		if _, ok := set[strings.ToLower(tag)]; !ok {
+			set[strings.ToLower(tag)] = tag
+		}
+	}
+	for _, tag := range remove {
+		delete(set, strings.ToLower(tag))
+	}
+	var sorted []string
+	for _, tag := range set {
+		sorted = append(sorted, tag)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
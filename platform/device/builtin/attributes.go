@@ -0,0 +1,128 @@
+package builtin
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/device"
+)
+
+// Attribute definitions are stored as JSON, keyed by the attribute name.
+
+type attributeDoc struct {
+	Data []byte `firestore:"data"`
+}
+
+func (db *FireDB) SaveAttribute(a *device.Attribute) error {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return errors.Wrap(err, "marshal device attribute")
+	}
+	_, err = db.Collection(AttributeBucket).Doc(a.Name).Set(context.Background(), attributeDoc{Data: data})
+	return errors.Wrap(err, "put device attribute to firestore")
+}
+
+func (db *FireDB) Attributes() ([]device.Attribute, error) {
+	docs, err := db.Collection(AttributeBucket).Documents(context.Background()).GetAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "list device attributes")
+	}
+	var attributes []device.Attribute
+	for _, snap := range docs {
+		var doc attributeDoc
+		if err := snap.DataTo(&doc); err != nil {
+			return nil, errors.Wrap(err, "decode device attribute document")
+		}
+		var a device.Attribute
+		if err := json.Unmarshal(doc.Data, &a); err != nil {
+			return nil, errors.Wrap(err, "unmarshal device attribute")
+		}
+		attributes = append(attributes, a)
+	}
+	return attributes, nil
+}
+
+func (db *FireDB) DeleteAttribute(name string) error {
+	_, err := db.Collection(AttributeBucket).Doc(name).Delete(context.Background())
+	if status.Code(err) == codes.NotFound {
+		return nil
+	}
+	return errors.Wrapf(err, "delete device attribute %s", name)
+}
+
+func (db *DB) SaveAttribute(a *device.Attribute) error {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return errors.Wrap(err, "marshal device attribute")
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket([]byte(AttributeBucket)).Put([]byte(a.Name), data)
+		return errors.Wrap(err, "put device attribute to boltdb")
+	})
+}
+
+func (db *DB) Attributes() ([]device.Attribute, error) {
+	var attributes []device.Attribute
+	err := db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(AttributeBucket)).ForEach(func(k, v []byte) error {
+			var a device.Attribute
+			if err := json.Unmarshal(v, &a); err != nil {
+				return errors.Wrapf(err, "unmarshal device attribute %s", k)
+			}
+			attributes = append(attributes, a)
+			return nil
+		})
+	})
+	return attributes, err
+}
+
+func (db *DB) DeleteAttribute(name string) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket([]byte(AttributeBucket)).Delete([]byte(name))
+		return errors.Wrapf(err, "delete device attribute %s", name)
+	})
+}
+
+func (db *SQLDB) SaveAttribute(a *device.Attribute) error {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return errors.Wrap(err, "marshal device attribute")
+	}
+	_, err = db.Exec(db.Upsert("device_attributes", "name", "name", "data"), a.Name, data)
+	return errors.Wrap(err, "put device attribute to sql")
+}
+
+func (db *SQLDB) Attributes() ([]device.Attribute, error) {
+	rows, err := db.Query(`SELECT data FROM device_attributes ORDER BY name`)
+	if err != nil {
+		return nil, errors.Wrap(err, "list device attributes from sql")
+	}
+	defer rows.Close()
+	var attributes []device.Attribute
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, errors.Wrap(err, "scan device attribute row")
+		}
+		var a device.Attribute
+		if err := json.Unmarshal(data, &a); err != nil {
+			return nil, errors.Wrap(err, "unmarshal device attribute")
+		}
+		attributes = append(attributes, a)
+	}
+	return attributes, errors.Wrap(rows.Err(), "list device attributes from sql")
+}
+
+func (db *SQLDB) DeleteAttribute(name string) error {
+	_, err := db.Exec(`DELETE FROM device_attributes WHERE name = ?`, name)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	return errors.Wrapf(err, "delete device attribute %s", name)
+}
@@ -1,14 +1,17 @@
 package builtin
 
 import (
-	"cloud.google.com/go/firestore"
+	"bytes"
 	"context"
 	"fmt"
+
+	"cloud.google.com/go/firestore"
+	"github.com/boltdb/bolt"
 	"github.com/pkg/errors"
 	"google.golang.org/api/iterator"
-	"log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
-	"github.com/boltdb/bolt"
 	"github.com/vishnuvaradaraj/micromdm/platform/device"
 )
 
@@ -19,162 +22,190 @@ const (
 	// to the device uuid.
 	deviceIndexBucket = "mdm.DeviceIdx"
 
-	// The udidCertAuthBucket stores a simple mapping from UDID to
+	// The deviceFieldIndexBucket bucket indexes the devices by the values
+	// of the indexedFields. Keys are the field, value and device uuid
+	// separated by NUL bytes.
+	deviceFieldIndexBucket = "mdm.DeviceFieldIdx"
+
+	// The UDIDCertAuthBucket stores a simple mapping from UDID to
 	// sha256 hash of the device identity certificate for future validation
-	udidCertAuthBucket = "mdm.UDIDCertAuth"
+	UDIDCertAuthBucket = "mdm.UDIDCertAuth"
+
+	// The AttributeBucket stores the custom attribute definitions by name.
+	AttributeBucket = "mdm.DeviceAttributes"
 
+	// The HistoryBucket has a bucket of history events for each device UUID.
+	HistoryBucket = "mdm.DeviceHistory"
 )
 
+// indexedFields are the query fields with a secondary index. Queries with an
+// equality condition on one of them only read the matching devices.
+var indexedFields = []string{"model", "os_version", "dep_profile_status", "dep_token_name", "enrolled", "dep_device"}
+
+// FireDB stores devices in Google Cloud Firestore. Devices are keyed by UUID
+// and stored in the same wire format as the BoltDB store. The UDID and serial
+// number are stored next to the record so they can be queried.
 type FireDB struct {
 	*firestore.Client
 }
 
+type deviceDoc struct {
+	UDID         string `firestore:"udid"`
+	SerialNumber string `firestore:"serial_number"`
+	Data         []byte `firestore:"data"`
+}
+
+type udidCertDoc struct {
+	CertHash []byte `firestore:"cert_hash"`
+}
+
 func NewFireDB(db *firestore.Client) (*FireDB, error) {
 	datastore := &FireDB{Client: db}
 	return datastore, nil
 }
 
 func (db *FireDB) Save(dev *device.Device) error {
-
-	ctx := context.Background()
-
-	_, err := db.Collection(DeviceBucket).Doc(dev.UDID).Set(ctx, dev)
+	devproto, err := device.MarshalDevice(dev)
 	if err != nil {
-		return err
+		return errors.Wrap(err, "marshalling device")
 	}
-
-	return nil
+	doc := deviceDoc{
+		UDID:         dev.UDID,
+		SerialNumber: dev.SerialNumber,
+		Data:         devproto,
+	}
+	_, err = db.Collection(DeviceBucket).Doc(dev.UUID).Set(context.Background(), doc)
+	return errors.Wrap(err, "put device to firestore")
 }
 
 func (db *FireDB) List(opt device.ListDevicesOption) ([]device.Device, error) {
+	q, err := device.NewQuery(opt)
+	if err != nil {
+		return nil, err
+	}
+	query := db.Collection(DeviceBucket).Query
+	// the UDID and serial number are the only fields stored next to the
+	// record, so they are the only ones which can be queried.
+	if field, values, ok := q.Equal("serial_number", "udid"); ok && len(values) == 1 {
+		query = query.Where(field, "==", values[0])
+	}
 	var devices []device.Device
-
-	ctx := context.Background()
-
-	iter := db.Collection(DeviceBucket).Documents(ctx)
+	iter := query.Documents(context.Background())
+	defer iter.Stop()
 	for {
-		doc, err := iter.Next()
+		snap, err := iter.Next()
 		if err == iterator.Done {
 			break
 		}
 		if err != nil {
-			log.Fatalf("Failed to iterate: %v", err)
-		}
-
-		var dev device.Device
-		doc.DataTo(&dev)
-
-
-		if len(opt.FilterSerial) == 0 {
-			devices = append(devices, dev)
-			break
+			return nil, errors.Wrap(err, "list devices from firestore")
 		}
-		for _, fs := range opt.FilterSerial {
-			if fs == dev.SerialNumber {
-				devices = append(devices, dev)
-			}
+		dev, err := deviceFromSnapshot(snap)
+		if err != nil {
+			return nil, err
 		}
+		devices = append(devices, *dev)
 	}
-
-	return devices, nil
+	return q.Apply(devices), nil
 }
 
 func (db *FireDB) DeleteByUDID(udid string) error {
-
-	ctx := context.Background()
-	_, err := db.Collection(DeviceBucket).Doc(udid).Delete(ctx)
-	return err
+	return db.deleteByField("udid", udid)
 }
 
 func (db *FireDB) DeleteBySerial(serial string) error {
+	return db.deleteByField("serial_number", serial)
+}
 
-	ctx := context.Background()
+func (db *FireDB) deleteByField(field, value string) error {
+	snap, err := db.snapshotByField(field, value)
+	if err != nil {
+		return err
+	}
+	_, err = snap.Ref.Delete(context.Background())
+	return errors.Wrapf(err, "delete device for key %s", value)
+}
 
-	query := db.Collection(DeviceBucket).Where("SerialNumber", "==", serial).Limit(1)
-	doc, _ := db.docByQuery(query)
-	if (doc != nil) {
-		doc.Ref.Delete(ctx)
+func (db *FireDB) DeviceByUUID(uuid string) (*device.Device, error) {
+	if uuid == "" {
+		return nil, &notFound{"Device", fmt.Sprintf("uuid %s", uuid)}
+	}
+	snap, err := db.Collection(DeviceBucket).Doc(uuid).Get(context.Background())
+	if status.Code(err) == codes.NotFound {
+		return nil, &notFound{"Device", fmt.Sprintf("uuid %s", uuid)}
 	}
-	return nil
+	if err != nil {
+		return nil, errors.Wrap(err, "get device by uuid from firestore")
+	}
+	return deviceFromSnapshot(snap)
 }
 
 func (db *FireDB) DeviceByUDID(udid string) (*device.Device, error) {
-
-	query := db.Collection(DeviceBucket).Where("UDID", "==", udid).Limit(1)
-	return db.deviceByQuery(query)
+	return db.deviceByField("udid", udid)
 }
 
 func (db *FireDB) DeviceBySerial(serial string) (*device.Device, error) {
-
-	query := db.Collection(DeviceBucket).Where("SerialNumber", "==", serial).Limit(1)
-	return db.deviceByQuery(query)
+	return db.deviceByField("serial_number", serial)
 }
 
-func (db *FireDB) docByQuery(q firestore.Query) (*firestore.DocumentSnapshot, error) {
-
-	ctx := context.Background()
-
-	query := q.Documents(ctx)
-	docs, err := query.GetAll()
+func (db *FireDB) deviceByField(field, value string) (*device.Device, error) {
+	snap, err := db.snapshotByField(field, value)
 	if err != nil {
 		return nil, err
 	}
+	return deviceFromSnapshot(snap)
+}
 
-	if (len(docs)>0) {
-
-		doc := docs[0]
-		return doc, nil
+func (db *FireDB) snapshotByField(field, value string) (*firestore.DocumentSnapshot, error) {
+	if value == "" {
+		return nil, &notFound{"Device", fmt.Sprintf("key %s", value)}
 	}
-
-	return nil, nil
+	q := db.Collection(DeviceBucket).Where(field, "==", value).Limit(1)
+	docs, err := q.Documents(context.Background()).GetAll()
+	if err != nil {
+		return nil, errors.Wrapf(err, "query device by %s", field)
+	}
+	if len(docs) == 0 {
+		return nil, &notFound{"Device", fmt.Sprintf("key %s", value)}
+	}
+	return docs[0], nil
 }
 
-func (db *FireDB) deviceByQuery(q firestore.Query) (*device.Device, error) {
-
+func deviceFromSnapshot(snap *firestore.DocumentSnapshot) (*device.Device, error) {
+	var doc deviceDoc
+	if err := snap.DataTo(&doc); err != nil {
+		return nil, errors.Wrap(err, "decode device document")
+	}
 	var dev device.Device
-
-	doc, _ := db.docByQuery(q)
-	if (doc != nil) {
-		doc.DataTo(&dev)
-	} else {
-		return nil, &notFound{"Device", "Device not found"}
+	if err := device.UnmarshalDevice(doc.Data, &dev); err != nil {
+		return nil, err
 	}
 	return &dev, nil
 }
 
 func (db *FireDB) SaveUDIDCertHash(udid, certHash []byte) error {
-
-	ctx := context.Background()
-
-	key := string(udid[:])
-	_, err := db.Collection(udidCertAuthBucket).Doc(key).Set(ctx, map[string]interface{}{
-		"certHash":    certHash,
-	})
-
-	return err
+	doc := udidCertDoc{CertHash: certHash}
+	_, err := db.Collection(UDIDCertAuthBucket).Doc(string(udid)).Set(context.Background(), doc)
+	return errors.Wrap(err, "put udid cert to firestore")
 }
 
 func (db *FireDB) GetUDIDCertHash(udid []byte) ([]byte, error) {
-	var certHash []byte
-
-	ctx := context.Background()
-
-	key := string(udid[:])
-	doc, err := db.Collection(udidCertAuthBucket).Doc(key).Get(ctx)
+	snap, err := db.Collection(UDIDCertAuthBucket).Doc(string(udid)).Get(context.Background())
+	if status.Code(err) == codes.NotFound {
+		return nil, &notFound{"UDID", fmt.Sprintf("udid %s", string(udid))}
+	}
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrap(err, "get udid cert from firestore")
 	}
-
-	v, _  := doc.DataAtPath([]string{"certHash"})
-	certHash = v.([]byte)
-
-	return certHash, nil
+	var doc udidCertDoc
+	if err := snap.DataTo(&doc); err != nil {
+		return nil, errors.Wrap(err, "decode udid cert document")
+	}
+	return doc.CertHash, nil
 }
 
-
 //////////////////////////////////////////////////////////////////////////////
 
-
 type DB struct {
 	*bolt.DB
 }
@@ -185,12 +216,42 @@ func NewDB(db *bolt.DB) (*DB, error) {
 		if err != nil {
 			return err
 		}
-		_, err = tx.CreateBucketIfNotExists([]byte(DeviceBucket))
+		devices, err := tx.CreateBucketIfNotExists([]byte(DeviceBucket))
 		if err != nil {
 			return err
 		}
-		_, err = tx.CreateBucketIfNotExists([]byte(udidCertAuthBucket))
-		return err
+		_, err = tx.CreateBucketIfNotExists([]byte(UDIDCertAuthBucket))
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists([]byte(AttributeBucket))
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists([]byte(HistoryBucket))
+		if err != nil {
+			return err
+		}
+		if tx.Bucket([]byte(deviceFieldIndexBucket)) != nil {
+			return nil
+		}
+		// index the devices saved before the field index existed.
+		fieldIdx, err := tx.CreateBucket([]byte(deviceFieldIndexBucket))
+		if err != nil {
+			return err
+		}
+		return devices.ForEach(func(k, v []byte) error {
+			var dev device.Device
+			if err := device.UnmarshalDevice(v, &dev); err != nil {
+				return err
+			}
+			for _, key := range fieldIndexKeys(&dev) {
+				if err := fieldIdx.Put(key, nil); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
 	})
 	if err != nil {
 		return nil, errors.Wrapf(err, "creating %s bucket", DeviceBucket)
@@ -199,30 +260,78 @@ func NewDB(db *bolt.DB) (*DB, error) {
 	return datastore, nil
 }
 
+// fieldIndexKeys returns the keys of a device in the field index bucket.
+func fieldIndexKeys(dev *device.Device) [][]byte {
+	var keys [][]byte
+	for _, field := range indexedFields {
+		keys = append(keys, fieldIndexKey(field, device.FieldValue(dev, field), dev.UUID))
+	}
+	return keys
+}
+
+func fieldIndexKey(field, value, uuid string) []byte {
+	return []byte(field + "\x00" + value + "\x00" + uuid)
+}
+
 func (db *DB) List(opt device.ListDevicesOption) ([]device.Device, error) {
+	q, err := device.NewQuery(opt)
+	if err != nil {
+		return nil, err
+	}
 	var devices []device.Device
-	err := db.View(func(tx *bolt.Tx) error {
+	err = db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(DeviceBucket))
-		// TODO optimize by implemting Seek() and bytes.HasPrefix() so we don't
-		// hit all keys in the database if we dont have to.
-		return b.ForEach(func(k, v []byte) error {
+		add := func(v []byte) error {
 			var dev device.Device
 			if err := device.UnmarshalDevice(v, &dev); err != nil {
 				return err
 			}
-			if len(opt.FilterSerial) == 0 {
-				devices = append(devices, dev)
-				return nil
-			}
-			for _, fs := range opt.FilterSerial {
-				if fs == dev.SerialNumber {
-					devices = append(devices, dev)
+			devices = append(devices, dev)
+			return nil
+		}
+		field, values, ok := q.Equal(append([]string{"serial_number", "udid"}, indexedFields...)...)
+		if !ok {
+			return b.ForEach(func(k, v []byte) error { return add(v) })
+		}
+		seen := make(map[string]bool)
+		for _, uuid := range db.lookup(tx, field, values) {
+			if v := b.Get(uuid); v != nil && !seen[string(uuid)] {
+				seen[string(uuid)] = true
+				if err := add(v); err != nil {
+					return err
 				}
 			}
-			return nil
-		})
+		}
+		return nil
 	})
-	return devices, err
+	if err != nil {
+		return nil, err
+	}
+	return q.Apply(devices), nil
+}
+
+// lookup returns the uuids of the devices with one of values in the indexed
+// field. The matched devices are checked against the whole query, so stale
+// index entries are harmless.
+func (db *DB) lookup(tx *bolt.Tx, field string, values []string) [][]byte {
+	var uuids [][]byte
+	if field == "serial_number" || field == "udid" {
+		ib := tx.Bucket([]byte(deviceIndexBucket))
+		for _, value := range values {
+			if uuid := ib.Get([]byte(value)); uuid != nil {
+				uuids = append(uuids, uuid)
+			}
+		}
+		return uuids
+	}
+	c := tx.Bucket([]byte(deviceFieldIndexBucket)).Cursor()
+	for _, value := range values {
+		prefix := fieldIndexKey(field, value, "")
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			uuids = append(uuids, append([]byte(nil), k[len(prefix):]...))
+		}
+	}
+	return uuids
 }
 
 func (db *DB) Save(dev *device.Device) error {
@@ -256,6 +365,24 @@ func (db *DB) Save(dev *device.Device) error {
 		}
 	}
 
+	fieldIdx := tx.Bucket([]byte(deviceFieldIndexBucket))
+	if prev := bkt.Get([]byte(dev.UUID)); prev != nil {
+		var old device.Device
+		if err := device.UnmarshalDevice(prev, &old); err != nil {
+			return errors.Wrap(err, "unmarshal previous device")
+		}
+		for _, key := range fieldIndexKeys(&old) {
+			if err := fieldIdx.Delete(key); err != nil {
+				return errors.Wrap(err, "delete device field index")
+			}
+		}
+	}
+	for _, key := range fieldIndexKeys(dev) {
+		if err := fieldIdx.Put(key, nil); err != nil {
+			return errors.Wrap(err, "put device field index")
+		}
+	}
+
 	key := []byte(dev.UUID)
 	if err := bkt.Put(key, devproto); err != nil {
 		return errors.Wrap(err, "put device to boltdb")
@@ -294,6 +421,12 @@ func (db *DB) deleteByIndex(key string) error {
 	if err := idxBucket.Delete([]byte(device.SerialNumber)); err != nil {
 		return errors.Wrapf(err, "delete device index for serial %s", device.SerialNumber)
 	}
+	fieldIdx := tx.Bucket([]byte(deviceFieldIndexBucket))
+	for _, key := range fieldIndexKeys(device) {
+		if err := fieldIdx.Delete(key); err != nil {
+			return errors.Wrapf(err, "delete device field index for key %s", key)
+		}
+	}
 
 	return tx.Commit()
 }
@@ -311,6 +444,21 @@ func (e *notFound) NotFound() bool {
 	return true
 }
 
+func (db *DB) DeviceByUUID(uuid string) (*device.Device, error) {
+	var dev device.Device
+	err := db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket([]byte(DeviceBucket)).Get([]byte(uuid))
+		if v == nil {
+			return &notFound{"Device", fmt.Sprintf("uuid %s", uuid)}
+		}
+		return device.UnmarshalDevice(v, &dev)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &dev, nil
+}
+
 func (db *DB) DeviceByUDID(udid string) (*device.Device, error) {
 	return db.deviceByIndex(udid)
 }
@@ -329,7 +477,7 @@ func (db *DB) deviceByIndex(key string) (*device.Device, error) {
 			return &notFound{"Device", fmt.Sprintf("key %s", key)}
 		}
 		v := b.Get(idx)
-		if idx == nil {
+		if v == nil {
 			return &notFound{"Device", fmt.Sprintf("uuid %s", string(idx))}
 		}
 		return device.UnmarshalDevice(v, &dev)
@@ -345,9 +493,9 @@ func (db *DB) SaveUDIDCertHash(udid, certHash []byte) error {
 	if err != nil {
 		return errors.Wrap(err, "begin transaction")
 	}
-	bkt := tx.Bucket([]byte(udidCertAuthBucket))
+	bkt := tx.Bucket([]byte(UDIDCertAuthBucket))
 	if bkt == nil {
-		return fmt.Errorf("bucket %q not found!", udidCertAuthBucket)
+		return fmt.Errorf("bucket %q not found!", UDIDCertAuthBucket)
 	}
 	if err := bkt.Put(udid, certHash); err != nil {
 		return errors.Wrap(err, "put udid cert to boltdb")
@@ -358,14 +506,16 @@ func (db *DB) SaveUDIDCertHash(udid, certHash []byte) error {
 func (db *DB) GetUDIDCertHash(udid []byte) ([]byte, error) {
 	var certHash []byte
 	err := db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(udidCertAuthBucket))
+		b := tx.Bucket([]byte(UDIDCertAuthBucket))
 		if b == nil {
-			return fmt.Errorf("bucket %q not found!", udidCertAuthBucket)
+			return fmt.Errorf("bucket %q not found!", UDIDCertAuthBucket)
 		}
-		certHash = b.Get(udid)
-		if certHash == nil {
+		v := b.Get(udid)
+		if v == nil {
 			return &notFound{"UDID", fmt.Sprintf("udid %s", string(udid))}
 		}
+		// bolt values are only valid for the life of the transaction.
+		certHash = append([]byte(nil), v...)
 		return nil
 	})
 	return certHash, err
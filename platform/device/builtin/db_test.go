@@ -1,20 +1,19 @@
 package builtin
 
 import (
-	"context"
-	"firebase.google.com/go"
-	"google.golang.org/api/option"
 	"io/ioutil"
 	"os"
 	"testing"
 
 	"github.com/boltdb/bolt"
+	_ "github.com/mattn/go-sqlite3"
+
 	"github.com/vishnuvaradaraj/micromdm/platform/device"
+	"github.com/vishnuvaradaraj/micromdm/platform/storage/sqldb"
 )
 
-
-func TestFireSave(t *testing.T) {
-	db := setupFireDB(t)
+func TestSave(t *testing.T) {
+	db := setupDB(t)
 	dev := &device.Device{
 		UUID:         "a-b-c-d",
 		UDID:         "UDID-FOO-BAR-BAZ",
@@ -64,9 +63,10 @@ func TestFireSave(t *testing.T) {
 
 	t.Run("byUDID", tf(byUDID))
 	t.Run("bySerial", tf(bySerial))
+
 }
 
-func TestSave(t *testing.T) {
+func TestDeleteByUDID(t *testing.T) {
 	db := setupDB(t)
 	dev := &device.Device{
 		UUID:         "a-b-c-d",
@@ -79,48 +79,17 @@ func TestSave(t *testing.T) {
 		t.Fatalf("saving device in datastore: %s", err)
 	}
 
-	byUDID, err := db.DeviceByUDID(dev.UDID)
-	if err != nil {
-		t.Fatalf("getting device by UDID: %s", err)
-	}
-
-	bySerial, err := db.DeviceBySerial(dev.SerialNumber)
-	if err != nil {
-		t.Fatalf("getting device by UDID: %s", err)
+	if err := db.DeleteByUDID(dev.UDID); err != nil {
+		t.Fatalf("deleting device in datastore: %s", err)
 	}
 
-	// test helper that verifies that the retrieved device is the same
-	tf := func(haveDev *device.Device) func(t *testing.T) {
-		return func(t *testing.T) {
-			if have, want := haveDev.UDID, dev.UDID; have != want {
-				t.Errorf("have %s, want %s", have, want)
-			}
-
-			if have, want := haveDev.UUID, dev.UUID; have != want {
-				t.Errorf("have %s, want %s", have, want)
-			}
-
-			if have, want := haveDev.SerialNumber, dev.SerialNumber; have != want {
-				t.Errorf("have %s, want %s", have, want)
-			}
-
-			if have, want := haveDev.ProductName, dev.ProductName; have != want {
-				t.Errorf("have %s, want %s", have, want)
-			}
-
-			if have, want := haveDev.LastSeen, dev.LastSeen; have != want {
-				t.Errorf("have %s, want %s", have, want)
-			}
-
-		}
+	byUDID, _ := db.DeviceByUDID(dev.UDID)
+	if byUDID != nil {
+		t.Fatalf("expected device to be deleted")
 	}
-
-	t.Run("byUDID", tf(byUDID))
-	t.Run("bySerial", tf(bySerial))
-
 }
 
-func TestDeleteByUDID(t *testing.T) {
+func TestDeleteBySerial(t *testing.T) {
 	db := setupDB(t)
 	dev := &device.Device{
 		UUID:         "a-b-c-d",
@@ -133,72 +102,115 @@ func TestDeleteByUDID(t *testing.T) {
 		t.Fatalf("saving device in datastore: %s", err)
 	}
 
-	if err := db.DeleteByUDID(dev.UDID); err != nil {
+	if err := db.DeleteBySerial(dev.SerialNumber); err != nil {
 		t.Fatalf("deleting device in datastore: %s", err)
 	}
 
-	byUDID, _ := db.DeviceByUDID(dev.UDID)
+	byUDID, _ := db.DeviceBySerial(dev.SerialNumber)
 	if byUDID != nil {
 		t.Fatalf("expected device to be deleted")
 	}
 }
 
-func TestDeleteBySerial(t *testing.T) {
+func TestIndexSavedDevices(t *testing.T) {
 	db := setupDB(t)
 	dev := &device.Device{
 		UUID:         "a-b-c-d",
 		UDID:         "UDID-FOO-BAR-BAZ",
 		SerialNumber: "foobarbaz",
-		ProductName:  "MacBook",
+		Model:        "MacBookPro15,1",
 	}
-
 	if err := db.Save(dev); err != nil {
 		t.Fatalf("saving device in datastore: %s", err)
 	}
 
-	if err := db.DeleteBySerial(dev.SerialNumber); err != nil {
-		t.Fatalf("deleting device in datastore: %s", err)
+	// databases of earlier versions have no field index.
+	err := db.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket([]byte(deviceFieldIndexBucket))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err = NewDB(db.DB)
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	byUDID, _ := db.DeviceBySerial(dev.SerialNumber)
-	if byUDID != nil {
-		t.Fatalf("expected device to be deleted")
+	devices, err := db.List(device.ListDevicesOption{Filter: "model=MacBookPro15,1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(devices), 1; have != want {
+		t.Fatalf("have %d devices, want %d", have, want)
+	}
+	if have, want := devices[0].UUID, dev.UUID; have != want {
+		t.Errorf("have %s, want %s", have, want)
 	}
 }
 
-func setupDB(t *testing.T) *DB {
-	f, _ := ioutil.TempFile("", "bolt-")
+func TestSQLFillQueryColumns(t *testing.T) {
+	f, err := ioutil.TempFile("", "sqlite-")
+	if err != nil {
+		t.Fatal(err)
+	}
 	f.Close()
-	os.Remove(f.Name())
-
-	db, err := bolt.Open(f.Name(), 0777, nil)
+	defer os.Remove(f.Name())
+	db, err := sqldb.Open(sqldb.SQLite, f.Name())
 	if err != nil {
-		t.Fatalf("couldn't open bolt, err %s\n", err)
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// a row saved before the query columns were added.
+	_, err = db.Exec(`CREATE TABLE devices (
+		uuid VARCHAR(255) PRIMARY KEY,
+		udid VARCHAR(255) NOT NULL,
+		serial_number VARCHAR(255) NOT NULL,
+		data BLOB NOT NULL,
+		model VARCHAR(255),
+		os_version VARCHAR(255),
+		dep_profile_status VARCHAR(255),
+		dep_token_name VARCHAR(255),
+		enrolled INTEGER,
+		dep_device INTEGER
+	)`)
+	if err != nil {
+		t.Fatal(err)
 	}
-	devDB, err := NewDB(db)
+	dev := &device.Device{UUID: "a-b-c-d", UDID: "UDID-FOO-BAR-BAZ", SerialNumber: "foobarbaz", Enrolled: true}
+	data, err := device.MarshalDevice(dev)
 	if err != nil {
-		t.Fatalf("couldn't create device DB, err %s\n", err)
+		t.Fatal(err)
 	}
-	return devDB
-}
-
-func setupFireDB(t *testing.T) *FireDB {
-
-	ctx := context.Background()
-
-	// Use a service account
-	sa := option.WithCredentialsFile("/Users/vishnuv/go/src/github.com/vishnuvaradaraj/micromdm/tools/certs/family-protection-dd191-firebase-adminsdk-x7xrc-435ea7bf3a.json")
-	app, err := firebase.NewApp(ctx, nil, sa)
+	_, err = db.Exec(`INSERT INTO devices (uuid, udid, serial_number, data) VALUES (?, ?, ?, ?)`,
+		dev.UUID, dev.UDID, dev.SerialNumber, data)
 	if err != nil {
-		t.Fatalf("couldn't open firebase, err %s\n", err)
+		t.Fatal(err)
 	}
 
-	fireDB, err := app.Firestore(ctx)
+	devDB, err := NewSQLDB(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	devices, err := devDB.List(device.ListDevicesOption{Filter: "enrolled"})
 	if err != nil {
-		t.Fatalf("couldn't init firebase, err %s\n", err)
+		t.Fatal(err)
 	}
+	if have, want := len(devices), 1; have != want {
+		t.Errorf("have %d devices, want %d", have, want)
+	}
+}
+
+func setupDB(t *testing.T) *DB {
+	f, _ := ioutil.TempFile("", "bolt-")
+	f.Close()
+	os.Remove(f.Name())
 
-	devDB, err := NewFireDB(fireDB)
+	db, err := bolt.Open(f.Name(), 0777, nil)
+	if err != nil {
+		t.Fatalf("couldn't open bolt, err %s\n", err)
+	}
+	devDB, err := NewDB(db)
 	if err != nil {
 		t.Fatalf("couldn't create device DB, err %s\n", err)
 	}
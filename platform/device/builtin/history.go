@@ -0,0 +1,156 @@
+package builtin
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+
+	"cloud.google.com/go/firestore"
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/device"
+)
+
+type historyDoc struct {
+	Time int64  `firestore:"time"`
+	Data []byte `firestore:"data"`
+}
+
+func (db *FireDB) AddHistory(uuid string, ev *device.HistoryEvent) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return errors.Wrap(err, "marshal device history event")
+	}
+	doc := historyDoc{Time: ev.Time.UnixNano(), Data: data}
+	_, err = db.Collection(HistoryBucket).Doc(uuid).Collection("events").Doc(ev.ID).Set(context.Background(), doc)
+	return errors.Wrap(err, "add device history event to firestore")
+}
+
+func (db *FireDB) History(uuid string) ([]device.HistoryEvent, error) {
+	docs, err := db.Collection(HistoryBucket).Doc(uuid).Collection("events").
+		OrderBy("time", firestore.Asc).Documents(context.Background()).GetAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "get device history from firestore")
+	}
+	events := []device.HistoryEvent{}
+	for _, snap := range docs {
+		var doc historyDoc
+		if err := snap.DataTo(&doc); err != nil {
+			return nil, errors.Wrap(err, "decode device history document")
+		}
+		var ev device.HistoryEvent
+		if err := json.Unmarshal(doc.Data, &ev); err != nil {
+			return nil, errors.Wrap(err, "unmarshal device history event")
+		}
+		events = append(events, ev)
+	}
+	return events, nil
+}
+
+func (db *FireDB) DeleteHistory(uuid string) error {
+	ctx := context.Background()
+	docs, err := db.Collection(HistoryBucket).Doc(uuid).Collection("events").Documents(ctx).GetAll()
+	if err != nil {
+		return errors.Wrap(err, "get device history from firestore")
+	}
+	for _, snap := range docs {
+		if _, err := snap.Ref.Delete(ctx); err != nil {
+			return errors.Wrap(err, "delete device history event from firestore")
+		}
+	}
+	return nil
+}
+
+// AddHistory stores the event in a bucket per device UUID, keyed by the big
+// endian event time so the keys sort by age. An event with the same ID and
+// time is replaced.
+func (db *DB) AddHistory(uuid string, ev *device.HistoryEvent) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return errors.Wrap(err, "marshal device history event")
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		bkt, err := tx.Bucket([]byte(HistoryBucket)).CreateBucketIfNotExists([]byte(uuid))
+		if err != nil {
+			return errors.Wrap(err, "create device history bucket")
+		}
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, uint64(ev.Time.UnixNano()))
+		for v := bkt.Get(key); v != nil; v = bkt.Get(key) {
+			var existing device.HistoryEvent
+			if err := json.Unmarshal(v, &existing); err == nil && existing.ID == ev.ID {
+				// the event is imported again.
+				break
+			}
+			// events at the same nanosecond.
+			binary.BigEndian.PutUint64(key, binary.BigEndian.Uint64(key)+1)
+		}
+		return errors.Wrap(bkt.Put(key, data), "put device history event to boltdb")
+	})
+}
+
+func (db *DB) History(uuid string) ([]device.HistoryEvent, error) {
+	events := []device.HistoryEvent{}
+	err := db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(HistoryBucket)).Bucket([]byte(uuid))
+		if bkt == nil {
+			return nil
+		}
+		return bkt.ForEach(func(k, v []byte) error {
+			var ev device.HistoryEvent
+			if err := json.Unmarshal(v, &ev); err != nil {
+				return errors.Wrap(err, "unmarshal device history event")
+			}
+			events = append(events, ev)
+			return nil
+		})
+	})
+	return events, err
+}
+
+func (db *DB) DeleteHistory(uuid string) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket([]byte(HistoryBucket)).DeleteBucket([]byte(uuid))
+		if err == bolt.ErrBucketNotFound {
+			return nil
+		}
+		return errors.Wrapf(err, "delete history of device %s", uuid)
+	})
+}
+
+func (db *SQLDB) AddHistory(uuid string, ev *device.HistoryEvent) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return errors.Wrap(err, "marshal device history event")
+	}
+	_, err = db.Exec(db.Upsert("device_history", "id", "id", "device_uuid", "created_at", "data"),
+		ev.ID, uuid, ev.Time.UnixNano(), data)
+	return errors.Wrap(err, "put device history event to sql")
+}
+
+func (db *SQLDB) History(uuid string) ([]device.HistoryEvent, error) {
+	rows, err := db.Query(`SELECT data FROM device_history WHERE device_uuid = ? ORDER BY created_at`, uuid)
+	if err != nil {
+		return nil, errors.Wrap(err, "get device history from sql")
+	}
+	defer rows.Close()
+	events := []device.HistoryEvent{}
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, errors.Wrap(err, "scan device history event")
+		}
+		var ev device.HistoryEvent
+		if err := json.Unmarshal(data, &ev); err != nil {
+			return nil, errors.Wrap(err, "unmarshal device history event")
+		}
+		events = append(events, ev)
+	}
+	return events, errors.Wrap(rows.Err(), "list device history from sql")
+}
+
+func (db *SQLDB) DeleteHistory(uuid string) error {
+	_, err := db.Exec(`DELETE FROM device_history WHERE device_uuid = ?`, uuid)
+	return errors.Wrapf(err, "delete history of device %s", uuid)
+}
@@ -0,0 +1,182 @@
+package builtin
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/device"
+	"github.com/vishnuvaradaraj/micromdm/platform/storage/sqldb"
+)
+
+// SQLDB stores devices in a SQL database. The schema is managed by the
+// storage package.
+type SQLDB struct {
+	*sqldb.DB
+}
+
+func NewSQLDB(db *sqldb.DB) (*SQLDB, error) {
+	datastore := &SQLDB{DB: db}
+	if err := datastore.fillQueryColumns(); err != nil {
+		return nil, err
+	}
+	return datastore, nil
+}
+
+// queryColumns are the columns of the query fields which are looked up with
+// equality conditions. Boolean fields are stored as 0 or 1.
+var queryColumns = []string{"serial_number", "udid", "model", "os_version", "dep_profile_status", "dep_token_name", "enrolled", "dep_device"}
+
+func (db *SQLDB) Save(dev *device.Device) error {
+	devproto, err := device.MarshalDevice(dev)
+	if err != nil {
+		return errors.Wrap(err, "marshalling device")
+	}
+	_, err = db.Exec(db.Upsert("devices", "uuid", "uuid", "udid", "serial_number", "model", "os_version",
+		"dep_profile_status", "dep_token_name", "enrolled", "dep_device", "data"),
+		dev.UUID, dev.UDID, dev.SerialNumber, dev.Model, dev.OSVersion,
+		string(dev.DEPProfileStatus), dev.DEPTokenName, boolColumn(dev.Enrolled), boolColumn(dev.DEPDevice), devproto)
+	return errors.Wrap(err, "put device to sql")
+}
+
+func boolColumn(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// fillQueryColumns saves the devices which were saved before the query
+// columns were added again, to fill in the columns.
+func (db *SQLDB) fillQueryColumns() error {
+	devices, err := db.listWhere(`enrolled IS NULL`)
+	if err != nil {
+		return err
+	}
+	for i := range devices {
+		if err := db.Save(&devices[i]); err != nil {
+			return errors.Wrap(err, "fill device query columns")
+		}
+	}
+	return nil
+}
+
+func (db *SQLDB) List(opt device.ListDevicesOption) ([]device.Device, error) {
+	q, err := device.NewQuery(opt)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		where []string
+		args  []interface{}
+	)
+	for _, column := range queryColumns {
+		_, values, ok := q.Equal(column)
+		if !ok {
+			continue
+		}
+		for _, v := range values {
+			if column == "enrolled" || column == "dep_device" {
+				args = append(args, boolColumn(v == "true"))
+				continue
+			}
+			args = append(args, v)
+		}
+		where = append(where, column+" IN ("+strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ")+")")
+	}
+	devices, err := db.listWhere(strings.Join(where, " AND "), args...)
+	if err != nil {
+		return nil, err
+	}
+	return q.Apply(devices), nil
+}
+
+func (db *SQLDB) listWhere(where string, args ...interface{}) ([]device.Device, error) {
+	query := `SELECT data FROM devices`
+	if where != "" {
+		query += ` WHERE ` + where
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "list devices from sql")
+	}
+	defer rows.Close()
+	var devices []device.Device
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, errors.Wrap(err, "scan device row")
+		}
+		var dev device.Device
+		if err := device.UnmarshalDevice(data, &dev); err != nil {
+			return nil, err
+		}
+		devices = append(devices, dev)
+	}
+	return devices, errors.Wrap(rows.Err(), "list devices from sql")
+}
+
+func (db *SQLDB) DeleteByUDID(udid string) error {
+	return db.deleteByColumn("udid", udid)
+}
+
+func (db *SQLDB) DeleteBySerial(serial string) error {
+	return db.deleteByColumn("serial_number", serial)
+}
+
+func (db *SQLDB) deleteByColumn(column, value string) error {
+	dev, err := db.deviceByColumn(column, value)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`DELETE FROM devices WHERE uuid = ?`, dev.UUID)
+	return errors.Wrapf(err, "delete device for key %s", value)
+}
+
+func (db *SQLDB) DeviceByUUID(uuid string) (*device.Device, error) {
+	return db.deviceByColumn("uuid", uuid)
+}
+
+func (db *SQLDB) DeviceByUDID(udid string) (*device.Device, error) {
+	return db.deviceByColumn("udid", udid)
+}
+
+func (db *SQLDB) DeviceBySerial(serial string) (*device.Device, error) {
+	return db.deviceByColumn("serial_number", serial)
+}
+
+// deviceByColumn looks up a device by its key or one of the indexed columns.
+func (db *SQLDB) deviceByColumn(column, value string) (*device.Device, error) {
+	if value == "" {
+		return nil, &notFound{"Device", fmt.Sprintf("key %s", value)}
+	}
+	var data []byte
+	err := db.QueryRow(`SELECT data FROM devices WHERE `+column+` = ?`, value).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, &notFound{"Device", fmt.Sprintf("key %s", value)}
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "get device by %s", column)
+	}
+	var dev device.Device
+	if err := device.UnmarshalDevice(data, &dev); err != nil {
+		return nil, err
+	}
+	return &dev, nil
+}
+
+func (db *SQLDB) SaveUDIDCertHash(udid, certHash []byte) error {
+	_, err := db.Exec(db.Upsert("device_udid_certs", "udid", "udid", "cert_hash"), string(udid), certHash)
+	return errors.Wrap(err, "put udid cert to sql")
+}
+
+func (db *SQLDB) GetUDIDCertHash(udid []byte) ([]byte, error) {
+	var certHash []byte
+	err := db.QueryRow(`SELECT cert_hash FROM device_udid_certs WHERE udid = ?`, string(udid)).Scan(&certHash)
+	if err == sql.ErrNoRows {
+		return nil, &notFound{"UDID", fmt.Sprintf("udid %s", string(udid))}
+	}
+	return certHash, errors.Wrap(err, "get udid cert from sql")
+}
@@ -38,9 +38,69 @@ func NewHTTPClient(instance, token string, logger log.Logger, opts ...httptransp
 		).Endpoint()
 	}
 
+	var updateDevicesEndpoint endpoint.Endpoint
+	{
+		updateDevicesEndpoint = httptransport.NewClient(
+			"PATCH",
+			httputil.CopyURL(u, "/v1/devices"),
+			httputil.EncodeRequestWithToken(token, httptransport.EncodeJSONRequest),
+			decodeUpdateDevicesResponse,
+			opts...,
+		).Endpoint()
+	}
+
+	var applyAttributeEndpoint endpoint.Endpoint
+	{
+		applyAttributeEndpoint = httptransport.NewClient(
+			"PUT",
+			httputil.CopyURL(u, "/v1/devices/attributes"),
+			httputil.EncodeRequestWithToken(token, httptransport.EncodeJSONRequest),
+			decodeApplyAttributeResponse,
+			opts...,
+		).Endpoint()
+	}
+
+	var getAttributesEndpoint endpoint.Endpoint
+	{
+		getAttributesEndpoint = httptransport.NewClient(
+			"GET",
+			httputil.CopyURL(u, "/v1/devices/attributes"),
+			httputil.EncodeRequestWithToken(token, httptransport.EncodeJSONRequest),
+			decodeGetAttributesResponse,
+			opts...,
+		).Endpoint()
+	}
+
+	var removeAttributesEndpoint endpoint.Endpoint
+	{
+		removeAttributesEndpoint = httptransport.NewClient(
+			"DELETE",
+			httputil.CopyURL(u, "/v1/devices/attributes"),
+			httputil.EncodeRequestWithToken(token, httptransport.EncodeJSONRequest),
+			decodeRemoveAttributesResponse,
+			opts...,
+		).Endpoint()
+	}
+
+	var deviceHistoryEndpoint endpoint.Endpoint
+	{
+		deviceHistoryEndpoint = httptransport.NewClient(
+			"GET",
+			httputil.CopyURL(u, ""), // empty path, modified by the encodeRequest func
+			httputil.EncodeRequestWithToken(token, encodeDeviceHistoryRequest),
+			decodeDeviceHistoryResponse,
+			opts...,
+		).Endpoint()
+	}
+
 	return Endpoints{
-		ListDevicesEndpoint:   listDevicesEndpoint,
-		RemoveDevicesEndpoint: removeDevicesEndpoint,
+		ListDevicesEndpoint:      listDevicesEndpoint,
+		RemoveDevicesEndpoint:    removeDevicesEndpoint,
+		UpdateDevicesEndpoint:    updateDevicesEndpoint,
+		ApplyAttributeEndpoint:   applyAttributeEndpoint,
+		GetAttributesEndpoint:    getAttributesEndpoint,
+		RemoveAttributesEndpoint: removeAttributesEndpoint,
+		DeviceHistoryEndpoint:    deviceHistoryEndpoint,
 	}, nil
 
 }
@@ -11,6 +11,20 @@ import (
 
 const DeviceEnrolledTopic = "mdm.DeviceEnrolled"
 
+// DeviceReEnrolledTopic is a PubSub topic that the TokenUpdate checkin event
+// of a re-enrolled device is published to, instead of DeviceEnrolledTopic.
+//
+// A device re-enrolls when it authenticates with a UDID which is already in
+// the inventory, for example after it was erased or its enrollment profile
+// was removed. The state of the previous enrollment is reset when it
+// authenticates, so the device completes the new enrollment like a new one.
+const DeviceReEnrolledTopic = "mdm.DeviceReEnrolled"
+
+// DeviceUpdatedTopic is a PubSub topic that devices are published to, encoded
+// with MarshalDevice, each time the device worker or the device service saves
+// them.
+const DeviceUpdatedTopic = "mdm.DeviceUpdated"
+
 type Device struct {
 	UUID                   string
 	UDID                   string
@@ -39,8 +53,16 @@ type Device struct {
 	DEPProfilePushTime     time.Time
 	DEPProfileAssignedDate time.Time
 	DEPProfileAssignedBy   string
+	DEPTokenName           string
 	LastSeen               time.Time
 	LastQueryResponse      []byte
+	PushUnreachable        bool
+
+	// Attributes are the values of the custom attributes of the device, by
+	// attribute name, formatted for the type of the attribute.
+	Attributes map[string]string
+	// Tags are free-form labels, such as "kiosk" or "loaner".
+	Tags []string
 }
 
 // DEPProfileStatus is the status of the DEP Profile
@@ -84,8 +106,12 @@ func MarshalDevice(dev *Device) ([]byte, error) {
 		DepProfilePushTime:     timeToNano(dev.DEPProfilePushTime),
 		DepProfileAssignedDate: timeToNano(dev.DEPProfileAssignedDate),
 		DepProfileAssignedBy:   dev.DEPProfileAssignedBy,
+		DepTokenName:           dev.DEPTokenName,
 		LastSeen:               timeToNano(dev.LastSeen),
 		LastQueryResponse:      dev.LastQueryResponse,
+		PushUnreachable:        dev.PushUnreachable,
+		Attributes:             dev.Attributes,
+		Tags:                   dev.Tags,
 	}
 	return proto.Marshal(&protodev)
 }
@@ -122,8 +148,12 @@ func UnmarshalDevice(data []byte, dev *Device) error {
 	dev.DEPProfilePushTime = timeFromNano(pb.GetDepProfilePushTime())
 	dev.DEPProfileAssignedDate = timeFromNano(pb.GetDepProfileAssignedDate())
 	dev.DEPProfileAssignedBy = pb.GetDepProfileAssignedBy()
+	dev.DEPTokenName = pb.GetDepTokenName()
 	dev.LastSeen = timeFromNano(pb.GetLastSeen())
 	dev.LastQueryResponse = pb.GetLastQueryResponse()
+	dev.PushUnreachable = pb.GetPushUnreachable()
+	dev.Attributes = pb.GetAttributes()
+	dev.Tags = pb.GetTags()
 	return nil
 }
 
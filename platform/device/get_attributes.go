@@ -0,0 +1,62 @@
+package device
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/pkg/httputil"
+)
+
+func (svc *DeviceService) GetAttributes(ctx context.Context) ([]Attribute, error) {
+	return svc.store.Attributes()
+}
+
+// DeviceAttributes returns the custom attributes and tags of the device with
+// a serial number, or none if the device is not in the inventory. DEP
+// auto-assigner filters use it to match the attributes of synced devices.
+func (svc *DeviceService) DeviceAttributes(serial string) (map[string]string, []string, error) {
+	dev, err := svc.store.DeviceBySerial(serial)
+	if isNotFound(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "retrieve device with serial number %s", serial)
+	}
+	return dev.Attributes, dev.Tags, nil
+}
+
+type getAttributesResponse struct {
+	Attributes []Attribute `json:"attributes"`
+	Err        error       `json:"err,omitempty"`
+}
+
+func (r getAttributesResponse) Failed() error { return r.Err }
+
+func decodeGetAttributesRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	return struct{}{}, nil
+}
+
+func decodeGetAttributesResponse(_ context.Context, r *http.Response) (interface{}, error) {
+	var resp getAttributesResponse
+	err := httputil.DecodeJSONResponse(r, &resp)
+	return resp, err
+}
+
+func MakeGetAttributesEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		attributes, err := svc.GetAttributes(ctx)
+		return getAttributesResponse{Attributes: attributes, Err: err}, nil
+	}
+}
+
+func (e Endpoints) GetAttributes(ctx context.Context) ([]Attribute, error) {
+	response, err := e.GetAttributesEndpoint(ctx, struct{}{})
+	if err != nil {
+		return nil, err
+	}
+	resp := response.(getAttributesResponse)
+	return resp.Attributes, resp.Err
+}
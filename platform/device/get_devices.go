@@ -3,6 +3,9 @@ package device
 import (
 	"context"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-kit/kit/endpoint"
@@ -11,11 +14,48 @@ import (
 )
 
 type ListDevicesOption struct {
-	Page    int `json:"page"`
+	// Page is the 1-based page of PerPage devices to list, for clients which
+	// do not use Cursor. Devices saved or removed between requests shift the
+	// pages.
+	Page int `json:"page"`
+	// PerPage limits the number of devices listed. Zero lists every device.
 	PerPage int `json:"per_page"`
 
 	FilterSerial []string `json:"filter_serial"`
 	FilterUDID   []string `json:"filter_udid"`
+
+	// Filter is a list of conditions joined by "and". A condition compares
+	// a field to a value with one of the operators =, !=, <, <=, >, >= or ~
+	// (contains, ignoring case). Boolean fields can be used alone, or
+	// negated with "not":
+	//
+	//	os_version<14 and enrolled
+	//	model=MacBookPro15,1 and not dep_device
+	//	device_name~"front desk" and last_seen>=2019-01-01
+	//	attr.department=Sales and tag!=loaner
+	//
+	// Values with spaces are quoted. Times are RFC 3339 times or dates in
+	// UTC. Versions are compared by their numeric components. Custom
+	// attributes are named attr.<name>, and tag matches any of the tags of
+	// a device.
+	Filter string `json:"filter,omitempty"`
+	// Query matches devices whose name or asset tag contains it, or which
+	// have it as a tag, ignoring case.
+	Query string `json:"query,omitempty"`
+	// LastSeenAfter and LastSeenBefore limit the devices to those last seen
+	// in a range of time.
+	LastSeenAfter  time.Time `json:"last_seen_after,omitempty"`
+	LastSeenBefore time.Time `json:"last_seen_before,omitempty"`
+
+	// Sort is the field to sort by, with a "-" prefix for descending order.
+	// Devices are sorted by serial number by default.
+	Sort string `json:"sort,omitempty"`
+	// Cursor is the NextCursor of the previous page. Unlike pages, cursors
+	// are stable while devices are saved or removed.
+	Cursor string `json:"cursor,omitempty"`
+	// Fields selects the fields of the listed devices. The UDID and serial
+	// number are always included. Every field is included by default.
+	Fields []string `json:"fields,omitempty"`
 }
 
 type DeviceDTO struct {
@@ -23,32 +63,116 @@ type DeviceDTO struct {
 	UDID             string    `json:"udid"`
 	EnrollmentStatus bool      `json:"enrollment_status"`
 	LastSeen         time.Time `json:"last_seen"`
+	PushUnreachable  bool      `json:"push_unreachable,omitempty"`
+	DEPTokenName     string    `json:"dep_token_name,omitempty"`
+	DeviceName       string    `json:"device_name,omitempty"`
+	AssetTag         string    `json:"asset_tag,omitempty"`
+	Model            string    `json:"model,omitempty"`
+	ModelName        string    `json:"model_name,omitempty"`
+	ProductName      string    `json:"product_name,omitempty"`
+	OSVersion        string    `json:"os_version,omitempty"`
+	BuildVersion     string    `json:"build_version,omitempty"`
+	DEPDevice        bool      `json:"dep_device,omitempty"`
+	DEPProfileStatus string    `json:"dep_profile_status,omitempty"`
+
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Tags       []string          `json:"tags,omitempty"`
+}
+
+// DevicePage is a page of listed devices.
+type DevicePage struct {
+	Devices []DeviceDTO
+	// NextCursor lists the next page, it is empty on the last page.
+	NextCursor string
 }
 
-func (svc *DeviceService) ListDevices(ctx context.Context, opt ListDevicesOption) ([]DeviceDTO, error) {
+// dtoFields zero the fields of a DeviceDTO which are not selected.
+var dtoFields = map[string]func(*DeviceDTO){
+	"serial_number":      func(*DeviceDTO) {},
+	"udid":               func(*DeviceDTO) {},
+	"enrolled":           func(d *DeviceDTO) { d.EnrollmentStatus = false },
+	"last_seen":          func(d *DeviceDTO) { d.LastSeen = time.Time{} },
+	"push_unreachable":   func(d *DeviceDTO) { d.PushUnreachable = false },
+	"dep_token_name":     func(d *DeviceDTO) { d.DEPTokenName = "" },
+	"device_name":        func(d *DeviceDTO) { d.DeviceName = "" },
+	"asset_tag":          func(d *DeviceDTO) { d.AssetTag = "" },
+	"model":              func(d *DeviceDTO) { d.Model = "" },
+	"model_name":         func(d *DeviceDTO) { d.ModelName = "" },
+	"product_name":       func(d *DeviceDTO) { d.ProductName = "" },
+	"os_version":         func(d *DeviceDTO) { d.OSVersion = "" },
+	"build_version":      func(d *DeviceDTO) { d.BuildVersion = "" },
+	"dep_device":         func(d *DeviceDTO) { d.DEPDevice = false },
+	"dep_profile_status": func(d *DeviceDTO) { d.DEPProfileStatus = "" },
+	"attributes":         func(d *DeviceDTO) { d.Attributes = nil },
+	"tags":               func(d *DeviceDTO) { d.Tags = nil },
+}
+
+func (svc *DeviceService) ListDevices(ctx context.Context, opt ListDevicesOption) (*DevicePage, error) {
+	selected := make(map[string]bool)
+	for _, f := range opt.Fields {
+		if _, ok := dtoFields[f]; !ok {
+			return nil, queryErrorf("can not select unknown field %q", f)
+		}
+		selected[f] = true
+	}
+	q, err := NewQuery(opt)
+	if err != nil {
+		return nil, err
+	}
 	devices, err := svc.store.List(opt)
-	var dto []DeviceDTO
+	if err != nil {
+		return nil, err
+	}
+	page := &DevicePage{NextCursor: q.NextCursor(devices)}
 	for _, d := range devices {
-		dto = append(dto, DeviceDTO{
+		dto := DeviceDTO{
 			SerialNumber:     d.SerialNumber,
 			UDID:             d.UDID,
 			EnrollmentStatus: d.Enrolled,
 			LastSeen:         d.LastSeen,
-		})
+			PushUnreachable:  d.PushUnreachable,
+			DEPTokenName:     d.DEPTokenName,
+			DeviceName:       d.DeviceName,
+			AssetTag:         d.AssetTag,
+			Model:            d.Model,
+			ModelName:        d.ModelName,
+			ProductName:      d.ProductName,
+			OSVersion:        d.OSVersion,
+			BuildVersion:     d.BuildVersion,
+			DEPDevice:        d.DEPDevice,
+			DEPProfileStatus: string(d.DEPProfileStatus),
+			Attributes:       d.Attributes,
+			Tags:             d.Tags,
+		}
+		if len(selected) > 0 {
+			for name, zero := range dtoFields {
+				if !selected[name] {
+					zero(&dto)
+				}
+			}
+		}
+		page.Devices = append(page.Devices, dto)
 	}
-	return dto, err
+	return page, nil
 }
 
 type getDevicesRequest struct{ Opts ListDevicesOption }
 type getDevicesResponse struct {
-	Devices []DeviceDTO `json:"devices"`
-	Err     error       `json:"err,omitempty"`
+	Devices    []DeviceDTO `json:"devices"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+	Err        error       `json:"err,omitempty"`
 }
 
 func (r getDevicesResponse) Failed() error { return r.Err }
 
+// decodeListDevicesRequest decodes the options from the JSON body, or from the
+// query string if there is no body.
 func decodeListDevicesRequest(ctx context.Context, r *http.Request) (interface{}, error) {
 	var opts ListDevicesOption
+	if r.ContentLength == 0 {
+		err := decodeListDevicesQuery(r.URL.Query(), &opts)
+		return getDevicesRequest{Opts: opts}, err
+	}
 	err := httputil.DecodeJSONRequest(r, &opts)
 	req := getDevicesRequest{
 		Opts: opts,
@@ -56,6 +180,42 @@ func decodeListDevicesRequest(ctx context.Context, r *http.Request) (interface{}
 	return req, err
 }
 
+func decodeListDevicesQuery(v url.Values, opts *ListDevicesOption) error {
+	var err error
+	atoi := func(name string) int {
+		n, convErr := strconv.Atoi(v.Get(name))
+		if convErr != nil && v.Get(name) != "" && err == nil {
+			err = queryErrorf("%s must be a number", name)
+		}
+		return n
+	}
+	parseTime := func(name string) time.Time {
+		t, parseErr := time.Parse(time.RFC3339, v.Get(name))
+		if parseErr != nil && v.Get(name) != "" && err == nil {
+			err = queryErrorf("%s must be an RFC 3339 time", name)
+		}
+		return t
+	}
+	split := func(name string) []string {
+		if v.Get(name) == "" {
+			return nil
+		}
+		return strings.Split(v.Get(name), ",")
+	}
+	opts.Page = atoi("page")
+	opts.PerPage = atoi("per_page")
+	opts.FilterSerial = split("serial")
+	opts.FilterUDID = split("udid")
+	opts.Filter = v.Get("filter")
+	opts.Query = v.Get("q")
+	opts.LastSeenAfter = parseTime("last_seen_after")
+	opts.LastSeenBefore = parseTime("last_seen_before")
+	opts.Sort = v.Get("sort")
+	opts.Cursor = v.Get("cursor")
+	opts.Fields = split("fields")
+	return err
+}
+
 func decodeListDevicesResponse(_ context.Context, r *http.Response) (interface{}, error) {
 	var resp getDevicesResponse
 	err := httputil.DecodeJSONResponse(r, &resp)
@@ -65,19 +225,23 @@ func decodeListDevicesResponse(_ context.Context, r *http.Response) (interface{}
 func MakeListDevicesEndpoint(svc Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		req := request.(getDevicesRequest)
-		dto, err := svc.ListDevices(ctx, req.Opts)
+		page, err := svc.ListDevices(ctx, req.Opts)
+		if err != nil {
+			return getDevicesResponse{Err: err}, nil
+		}
 		return getDevicesResponse{
-			Devices: dto,
-			Err:     err,
+			Devices:    page.Devices,
+			NextCursor: page.NextCursor,
 		}, nil
 	}
 }
 
-func (e Endpoints) ListDevices(ctx context.Context, opts ListDevicesOption) ([]DeviceDTO, error) {
+func (e Endpoints) ListDevices(ctx context.Context, opts ListDevicesOption) (*DevicePage, error) {
 	request := getDevicesRequest{opts}
 	response, err := e.ListDevicesEndpoint(ctx, request.Opts)
 	if err != nil {
 		return nil, err
 	}
-	return response.(getDevicesResponse).Devices, response.(getDevicesResponse).Err
+	resp := response.(getDevicesResponse)
+	return &DevicePage{Devices: resp.Devices, NextCursor: resp.NextCursor}, resp.Err
 }
@@ -0,0 +1,118 @@
+package device
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/pkg/httputil"
+)
+
+// DeviceHistory returns the history of the device with a UDID, oldest first.
+func (svc *DeviceService) DeviceHistory(ctx context.Context, udid string, opt HistoryOption) ([]HistoryEvent, error) {
+	dev, err := svc.store.DeviceByUDID(udid)
+	if err != nil {
+		return nil, errors.Wrapf(err, "retrieve device with udid %s", udid)
+	}
+	events, err := svc.store.History(dev.UUID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get history of device %s", udid)
+	}
+	return opt.filter(events), nil
+}
+
+type deviceHistoryRequest struct {
+	UDID string
+	Opts HistoryOption
+}
+
+type deviceHistoryResponse struct {
+	Events []HistoryEvent `json:"events"`
+	Err    error          `json:"err,omitempty"`
+}
+
+func (r deviceHistoryResponse) Failed() error { return r.Err }
+
+// decodeDeviceHistoryRequest decodes the options from the query parameters
+// type, a comma separated list of event types, since, an RFC 3339 time, and
+// limit.
+func decodeDeviceHistoryRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	udid, ok := mux.Vars(r)["udid"]
+	if !ok {
+		return nil, errors.New("device: bad route")
+	}
+	req := deviceHistoryRequest{UDID: udid}
+	v := r.URL.Query()
+	if types := v.Get("type"); types != "" {
+		for _, typ := range strings.Split(types, ",") {
+			req.Opts.Types = append(req.Opts.Types, HistoryEventType(typ))
+		}
+	}
+	if since := v.Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return nil, queryErrorf("since must be an RFC 3339 time")
+		}
+		req.Opts.Since = t
+	}
+	if limit := v.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			return nil, queryErrorf("limit must be a number")
+		}
+		req.Opts.Limit = n
+	}
+	return req, nil
+}
+
+func encodeDeviceHistoryRequest(_ context.Context, r *http.Request, request interface{}) error {
+	req := request.(deviceHistoryRequest)
+	r.Method, r.URL.Path = "GET", "/v1/devices/"+url.PathEscape(req.UDID)+"/history"
+	q := make(url.Values)
+	var types []string
+	for _, typ := range req.Opts.Types {
+		types = append(types, string(typ))
+	}
+	if len(types) > 0 {
+		q.Set("type", strings.Join(types, ","))
+	}
+	if !req.Opts.Since.IsZero() {
+		q.Set("since", req.Opts.Since.Format(time.RFC3339))
+	}
+	if req.Opts.Limit > 0 {
+		q.Set("limit", strconv.Itoa(req.Opts.Limit))
+	}
+	r.URL.RawQuery = q.Encode()
+	return nil
+}
+
+func decodeDeviceHistoryResponse(_ context.Context, r *http.Response) (interface{}, error) {
+	var resp deviceHistoryResponse
+	err := httputil.DecodeJSONResponse(r, &resp)
+	return resp, err
+}
+
+func MakeDeviceHistoryEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(deviceHistoryRequest)
+		events, err := svc.DeviceHistory(ctx, req.UDID, req.Opts)
+		return deviceHistoryResponse{Events: events, Err: err}, nil
+	}
+}
+
+func (e Endpoints) DeviceHistory(ctx context.Context, udid string, opt HistoryOption) ([]HistoryEvent, error) {
+	request := deviceHistoryRequest{UDID: udid, Opts: opt}
+	resp, err := e.DeviceHistoryEndpoint(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	response := resp.(deviceHistoryResponse)
+	return response.Events, response.Err
+}
@@ -0,0 +1,124 @@
+package device
+
+import (
+	"encoding/json"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// HistoryTopic is a PubSub topic that other services publish HistoryEvents
+// to, to add them to the history of the device with the event's UDID.
+const HistoryTopic = "mdm.DeviceHistory"
+
+// HistoryEventType is the kind of a HistoryEvent.
+type HistoryEventType string
+
+const (
+	// Enrolled is recorded the first time a device enrolls, and ReEnrolled
+	// each time it enrolls again.
+	Enrolled   HistoryEventType = "enrolled"
+	ReEnrolled HistoryEventType = "re_enrolled"
+	CheckedOut HistoryEventType = "checked_out"
+
+	DEPAdded    HistoryEventType = "dep_added"
+	DEPModified HistoryEventType = "dep_modified"
+	DEPDeleted  HistoryEventType = "dep_deleted"
+
+	BlueprintApplied HistoryEventType = "blueprint_applied"
+	// BlueprintRemoved is recorded when what a blueprint installed is
+	// removed from a device.
+	BlueprintRemoved HistoryEventType = "blueprint_removed"
+	// SetupCompleted is recorded when a device which awaits configuration
+	// is sent DeviceConfigured, and SetupFailed when a blueprint of its setup
+	// fails. The action detail of SetupFailed is "hold" when the device is
+	// left in Setup Assistant.
+	SetupCompleted HistoryEventType = "setup_completed"
+	SetupFailed    HistoryEventType = "setup_failed"
+	// CommandResult is recorded when a device acknowledges a command or
+	// reports an error.
+	CommandResult HistoryEventType = "command_result"
+	// StaleAction is recorded when the stale device policy acts on a
+	// device.
+	StaleAction HistoryEventType = "stale_action"
+
+	NameChanged HistoryEventType = "name_changed"
+	OSUpdated   HistoryEventType = "os_updated"
+)
+
+// HistoryEvent is an entry in the history of a device. Events are only ever
+// added, so the history keeps the changes which the device record loses when
+// it is updated.
+type HistoryEvent struct {
+	ID           string           `json:"id"`
+	Time         time.Time        `json:"time"`
+	Type         HistoryEventType `json:"type"`
+	UDID         string           `json:"udid,omitempty"`
+	SerialNumber string           `json:"serial_number,omitempty"`
+	// Details describe the event, such as the previous and new OS version
+	// or the status of a command.
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// NewHistoryEvent creates an event of the device with udid which happened
+// now.
+func NewHistoryEvent(typ HistoryEventType, udid string, details map[string]string) *HistoryEvent {
+	return &HistoryEvent{
+		ID:      uuid.NewV4().String(),
+		Time:    time.Now().UTC(),
+		Type:    typ,
+		UDID:    udid,
+		Details: details,
+	}
+}
+
+func MarshalHistoryEvent(ev *HistoryEvent) ([]byte, error) {
+	return json.Marshal(ev)
+}
+
+func UnmarshalHistoryEvent(data []byte, ev *HistoryEvent) error {
+	return json.Unmarshal(data, ev)
+}
+
+// HistoryStore persists the history of each device, by device UUID. The
+// history is kept by UUID rather than UDID, so that it includes the DEP
+// events of devices which have not enrolled yet.
+type HistoryStore interface {
+	// AddHistory appends an event to the history of a device.
+	AddHistory(uuid string, ev *HistoryEvent) error
+	// History returns the history of a device, oldest first.
+	History(uuid string) ([]HistoryEvent, error)
+	// DeleteHistory deletes the history of a device.
+	DeleteHistory(uuid string) error
+}
+
+// HistoryOption selects the events of a device history.
+type HistoryOption struct {
+	// Types only returns events of these types.
+	Types []HistoryEventType `json:"types,omitempty"`
+	// Since only returns events at or after this time.
+	Since time.Time `json:"since,omitempty"`
+	// Limit returns at most this many of the most recent events.
+	Limit int `json:"limit,omitempty"`
+}
+
+func (opt HistoryOption) filter(events []HistoryEvent) []HistoryEvent {
+	types := make(map[HistoryEventType]bool, len(opt.Types))
+	for _, typ := range opt.Types {
+		types[typ] = true
+	}
+	filtered := events[:0]
+	for _, ev := range events {
+		if len(types) > 0 && !types[ev.Type] {
+			continue
+		}
+		if ev.Time.Before(opt.Since) {
+			continue
+		}
+		filtered = append(filtered, ev)
+	}
+	if opt.Limit > 0 && len(filtered) > opt.Limit {
+		filtered = filtered[len(filtered)-opt.Limit:]
+	}
+	return filtered
+}
@@ -0,0 +1,112 @@
+package device
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/vishnuvaradaraj/micromdm/mdm"
+	"github.com/vishnuvaradaraj/micromdm/platform/pubsub/inmem"
+)
+
+func checkinMessage(t *testing.T, messageType, udid, name, osVersion string) []byte {
+	t.Helper()
+	ev := mdm.CheckinEvent{Command: mdm.CheckinCommand{MessageType: messageType, UDID: udid}}
+	ev.Command.SerialNumber = "C02A"
+	ev.Command.DeviceName = name
+	ev.Command.OSVersion = osVersion
+	msg, err := mdm.MarshalCheckinEvent(&ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func historyTypes(events []HistoryEvent) []HistoryEventType {
+	var types []HistoryEventType
+	for _, ev := range events {
+		types = append(types, ev.Type)
+	}
+	return types
+}
+
+func TestWorkerHistory(t *testing.T) {
+	store := &memStore{}
+	w := NewWorker(store, inmem.NewPubSub(), log.NewNopLogger())
+	ctx := context.Background()
+
+	steps := []struct {
+		update  func(context.Context, []byte) error
+		message []byte
+	}{
+		{w.updateFromAuthenticate, checkinMessage(t, "Authenticate", "UDID-1", "laptop", "10.14.1")},
+		{w.updateFromTokenUpdate, checkinMessage(t, "TokenUpdate", "UDID-1", "", "")},
+		{w.updateFromCheckout, checkinMessage(t, "CheckOut", "UDID-1", "", "")},
+		{w.updateFromAuthenticate, checkinMessage(t, "Authenticate", "UDID-1", "Front Desk", "10.14.2")},
+		{w.updateFromTokenUpdate, checkinMessage(t, "TokenUpdate", "UDID-1", "", "")},
+	}
+	for _, step := range steps {
+		if err := step.update(ctx, step.message); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dev, err := store.DeviceByUDID("UDID-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := store.History(dev.UUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []HistoryEventType{Enrolled, CheckedOut, NameChanged, OSUpdated, ReEnrolled}
+	have := historyTypes(events)
+	if len(have) != len(want) {
+		t.Fatalf("have %v, want %v", have, want)
+	}
+	for i := range want {
+		if have[i] != want[i] {
+			t.Fatalf("have %v, want %v", have, want)
+		}
+	}
+	if ev := events[3]; ev.Details["from"] != "10.14.1" || ev.Details["to"] != "10.14.2" {
+		t.Errorf("have os update details %v", ev.Details)
+	}
+	if ev := events[0]; ev.UDID != "UDID-1" || ev.SerialNumber != "C02A" {
+		t.Errorf("have event %+v, want the UDID and serial number of the device", ev)
+	}
+
+	// events published by other services are added to the history.
+	msg, err := MarshalHistoryEvent(NewHistoryEvent(BlueprintApplied, "UDID-1", map[string]string{"blueprint": "staff"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.addHistory(ctx, msg); err != nil {
+		t.Fatal(err)
+	}
+
+	svc := New(store, inmem.NewPubSub())
+	events, err = svc.DeviceHistory(ctx, "UDID-1", HistoryOption{Types: []HistoryEventType{ReEnrolled, BlueprintApplied}, Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Type != BlueprintApplied {
+		t.Errorf("have %v, want the blueprint_applied event", historyTypes(events))
+	}
+	events, err = svc.DeviceHistory(ctx, "UDID-1", HistoryOption{Since: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 0 {
+		t.Errorf("have %v, want no events in the future", historyTypes(events))
+	}
+
+	if err := svc.RemoveDevices(ctx, RemoveDevicesOptions{UDIDs: []string{"UDID-1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if events, _ := store.History(dev.UUID); len(events) != 0 {
+		t.Errorf("have %v, want the history deleted with the device", historyTypes(events))
+	}
+}
@@ -29,35 +29,39 @@ var _ = math.Inf
 const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
 
 type Device struct {
-	Uuid                   string `protobuf:"bytes,1,opt,name=uuid" json:"uuid,omitempty"`
-	Udid                   string `protobuf:"bytes,2,opt,name=udid" json:"udid,omitempty"`
-	SerialNumber           string `protobuf:"bytes,3,opt,name=serial_number,json=serialNumber" json:"serial_number,omitempty"`
-	OsVersion              string `protobuf:"bytes,4,opt,name=os_version,json=osVersion" json:"os_version,omitempty"`
-	BuildVersion           string `protobuf:"bytes,5,opt,name=build_version,json=buildVersion" json:"build_version,omitempty"`
-	ProductName            string `protobuf:"bytes,6,opt,name=product_name,json=productName" json:"product_name,omitempty"`
-	Imei                   string `protobuf:"bytes,7,opt,name=imei" json:"imei,omitempty"`
-	Meid                   string `protobuf:"bytes,8,opt,name=meid" json:"meid,omitempty"`
-	Token                  string `protobuf:"bytes,9,opt,name=token" json:"token,omitempty"`
-	PushMagic              string `protobuf:"bytes,10,opt,name=push_magic,json=pushMagic" json:"push_magic,omitempty"`
-	MdmTopic               string `protobuf:"bytes,11,opt,name=mdm_topic,json=mdmTopic" json:"mdm_topic,omitempty"`
-	UnlockToken            string `protobuf:"bytes,12,opt,name=unlock_token,json=unlockToken" json:"unlock_token,omitempty"`
-	Enrolled               bool   `protobuf:"varint,13,opt,name=enrolled" json:"enrolled,omitempty"`
-	AwaitingConfiguration  bool   `protobuf:"varint,14,opt,name=awaiting_configuration,json=awaitingConfiguration" json:"awaiting_configuration,omitempty"`
-	DeviceName             string `protobuf:"bytes,15,opt,name=device_name,json=deviceName" json:"device_name,omitempty"`
-	Model                  string `protobuf:"bytes,16,opt,name=model" json:"model,omitempty"`
-	ModelName              string `protobuf:"bytes,17,opt,name=model_name,json=modelName" json:"model_name,omitempty"`
-	Description            string `protobuf:"bytes,18,opt,name=description" json:"description,omitempty"`
-	Color                  string `protobuf:"bytes,19,opt,name=color" json:"color,omitempty"`
-	AssetTag               string `protobuf:"bytes,20,opt,name=asset_tag,json=assetTag" json:"asset_tag,omitempty"`
-	DepDevice              bool   `protobuf:"varint,21,opt,name=dep_device,json=depDevice" json:"dep_device,omitempty"`
-	DepProfileStatus       string `protobuf:"bytes,22,opt,name=dep_profile_status,json=depProfileStatus" json:"dep_profile_status,omitempty"`
-	DepProfileUuid         string `protobuf:"bytes,23,opt,name=dep_profile_uuid,json=depProfileUuid" json:"dep_profile_uuid,omitempty"`
-	DepProfileAssignTime   int64  `protobuf:"varint,24,opt,name=dep_profile_assign_time,json=depProfileAssignTime" json:"dep_profile_assign_time,omitempty"`
-	DepProfilePushTime     int64  `protobuf:"varint,25,opt,name=dep_profile_push_time,json=depProfilePushTime" json:"dep_profile_push_time,omitempty"`
-	DepProfileAssignedDate int64  `protobuf:"varint,26,opt,name=dep_profile_assigned_date,json=depProfileAssignedDate" json:"dep_profile_assigned_date,omitempty"`
-	DepProfileAssignedBy   string `protobuf:"bytes,27,opt,name=dep_profile_assigned_by,json=depProfileAssignedBy" json:"dep_profile_assigned_by,omitempty"`
-	LastSeen               int64  `protobuf:"varint,28,opt,name=last_seen,json=lastSeen" json:"last_seen,omitempty"`
-	LastQueryResponse      []byte `protobuf:"bytes,29,opt,name=last_query_response,json=lastQueryResponse,proto3" json:"last_query_response,omitempty"`
+	Uuid                   string            `protobuf:"bytes,1,opt,name=uuid" json:"uuid,omitempty"`
+	Udid                   string            `protobuf:"bytes,2,opt,name=udid" json:"udid,omitempty"`
+	SerialNumber           string            `protobuf:"bytes,3,opt,name=serial_number,json=serialNumber" json:"serial_number,omitempty"`
+	OsVersion              string            `protobuf:"bytes,4,opt,name=os_version,json=osVersion" json:"os_version,omitempty"`
+	BuildVersion           string            `protobuf:"bytes,5,opt,name=build_version,json=buildVersion" json:"build_version,omitempty"`
+	ProductName            string            `protobuf:"bytes,6,opt,name=product_name,json=productName" json:"product_name,omitempty"`
+	Imei                   string            `protobuf:"bytes,7,opt,name=imei" json:"imei,omitempty"`
+	Meid                   string            `protobuf:"bytes,8,opt,name=meid" json:"meid,omitempty"`
+	Token                  string            `protobuf:"bytes,9,opt,name=token" json:"token,omitempty"`
+	PushMagic              string            `protobuf:"bytes,10,opt,name=push_magic,json=pushMagic" json:"push_magic,omitempty"`
+	MdmTopic               string            `protobuf:"bytes,11,opt,name=mdm_topic,json=mdmTopic" json:"mdm_topic,omitempty"`
+	UnlockToken            string            `protobuf:"bytes,12,opt,name=unlock_token,json=unlockToken" json:"unlock_token,omitempty"`
+	Enrolled               bool              `protobuf:"varint,13,opt,name=enrolled" json:"enrolled,omitempty"`
+	AwaitingConfiguration  bool              `protobuf:"varint,14,opt,name=awaiting_configuration,json=awaitingConfiguration" json:"awaiting_configuration,omitempty"`
+	DeviceName             string            `protobuf:"bytes,15,opt,name=device_name,json=deviceName" json:"device_name,omitempty"`
+	Model                  string            `protobuf:"bytes,16,opt,name=model" json:"model,omitempty"`
+	ModelName              string            `protobuf:"bytes,17,opt,name=model_name,json=modelName" json:"model_name,omitempty"`
+	Description            string            `protobuf:"bytes,18,opt,name=description" json:"description,omitempty"`
+	Color                  string            `protobuf:"bytes,19,opt,name=color" json:"color,omitempty"`
+	AssetTag               string            `protobuf:"bytes,20,opt,name=asset_tag,json=assetTag" json:"asset_tag,omitempty"`
+	DepDevice              bool              `protobuf:"varint,21,opt,name=dep_device,json=depDevice" json:"dep_device,omitempty"`
+	DepProfileStatus       string            `protobuf:"bytes,22,opt,name=dep_profile_status,json=depProfileStatus" json:"dep_profile_status,omitempty"`
+	DepProfileUuid         string            `protobuf:"bytes,23,opt,name=dep_profile_uuid,json=depProfileUuid" json:"dep_profile_uuid,omitempty"`
+	DepProfileAssignTime   int64             `protobuf:"varint,24,opt,name=dep_profile_assign_time,json=depProfileAssignTime" json:"dep_profile_assign_time,omitempty"`
+	DepProfilePushTime     int64             `protobuf:"varint,25,opt,name=dep_profile_push_time,json=depProfilePushTime" json:"dep_profile_push_time,omitempty"`
+	DepProfileAssignedDate int64             `protobuf:"varint,26,opt,name=dep_profile_assigned_date,json=depProfileAssignedDate" json:"dep_profile_assigned_date,omitempty"`
+	DepProfileAssignedBy   string            `protobuf:"bytes,27,opt,name=dep_profile_assigned_by,json=depProfileAssignedBy" json:"dep_profile_assigned_by,omitempty"`
+	LastSeen               int64             `protobuf:"varint,28,opt,name=last_seen,json=lastSeen" json:"last_seen,omitempty"`
+	LastQueryResponse      []byte            `protobuf:"bytes,29,opt,name=last_query_response,json=lastQueryResponse,proto3" json:"last_query_response,omitempty"`
+	PushUnreachable        bool              `protobuf:"varint,30,opt,name=push_unreachable,json=pushUnreachable" json:"push_unreachable,omitempty"`
+	DepTokenName           string            `protobuf:"bytes,31,opt,name=dep_token_name,json=depTokenName" json:"dep_token_name,omitempty"`
+	Attributes             map[string]string `protobuf:"bytes,32,rep,name=attributes" json:"attributes,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Tags                   []string          `protobuf:"bytes,33,rep,name=tags" json:"tags,omitempty"`
 }
 
 func (m *Device) Reset()                    { *m = Device{} }
@@ -268,6 +272,34 @@ func (m *Device) GetLastQueryResponse() []byte {
 	return nil
 }
 
+func (m *Device) GetPushUnreachable() bool {
+	if m != nil {
+		return m.PushUnreachable
+	}
+	return false
+}
+
+func (m *Device) GetDepTokenName() string {
+	if m != nil {
+		return m.DepTokenName
+	}
+	return ""
+}
+
+func (m *Device) GetAttributes() map[string]string {
+	if m != nil {
+		return m.Attributes
+	}
+	return nil
+}
+
+func (m *Device) GetTags() []string {
+	if m != nil {
+		return m.Tags
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*Device)(nil), "deviceproto.Device")
 }
@@ -275,40 +307,47 @@ func init() {
 func init() { proto.RegisterFile("device.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 557 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x6c, 0x94, 0x41, 0x4f, 0x1b, 0x31,
-	0x10, 0x85, 0x95, 0x02, 0x21, 0x71, 0x02, 0x0d, 0x26, 0x09, 0x03, 0x14, 0x35, 0x6d, 0x2f, 0x39,
-	0x54, 0x48, 0x55, 0xc5, 0xa1, 0xc7, 0xb6, 0x5c, 0x8b, 0x68, 0x48, 0x7b, 0xb5, 0x9c, 0xf5, 0xb0,
-	0x58, 0xac, 0xed, 0xad, 0xed, 0xa5, 0xca, 0x2f, 0xef, 0xb5, 0xf2, 0x38, 0x90, 0xa8, 0xf4, 0xe6,
-	0xf9, 0xde, 0xbc, 0xf1, 0xcc, 0xac, 0xb5, 0xac, 0xaf, 0xf0, 0x41, 0x17, 0x78, 0x5e, 0x7b, 0x17,
-	0x1d, 0xef, 0xe5, 0x88, 0x82, 0xb7, 0x7f, 0x76, 0x59, 0xfb, 0x92, 0x62, 0xce, 0xd9, 0x76, 0xd3,
-	0x68, 0x05, 0xad, 0x49, 0x6b, 0xda, 0x9d, 0xd1, 0x99, 0x98, 0xd2, 0x0a, 0x5e, 0xac, 0x98, 0xd2,
-	0x8a, 0xbf, 0x63, 0x7b, 0x01, 0xbd, 0x96, 0x95, 0xb0, 0x8d, 0x59, 0xa0, 0x87, 0x2d, 0x12, 0xfb,
-	0x19, 0x5e, 0x11, 0xe3, 0x67, 0x8c, 0xb9, 0x20, 0x1e, 0xd0, 0x07, 0xed, 0x2c, 0x6c, 0x53, 0x46,
-	0xd7, 0x85, 0x9f, 0x19, 0xa4, 0x1a, 0x8b, 0x46, 0x57, 0xea, 0x29, 0x63, 0x27, 0xd7, 0x20, 0xf8,
-	0x98, 0xf4, 0x86, 0xf5, 0x6b, 0xef, 0x54, 0x53, 0x44, 0x61, 0xa5, 0x41, 0x68, 0x53, 0x4e, 0x6f,
-	0xc5, 0xae, 0xa4, 0xa1, 0x9e, 0xb5, 0x41, 0x0d, 0xbb, 0xb9, 0xbf, 0x74, 0x4e, 0xcc, 0xa0, 0x56,
-	0xd0, 0xc9, 0x2c, 0x9d, 0xf9, 0x90, 0xed, 0x44, 0x77, 0x8f, 0x16, 0xba, 0x04, 0x73, 0x90, 0x9a,
-	0xac, 0x9b, 0x70, 0x27, 0x8c, 0x2c, 0x75, 0x01, 0x2c, 0x37, 0x99, 0xc8, 0xb7, 0x04, 0xf8, 0x29,
-	0xeb, 0x1a, 0x65, 0x44, 0x74, 0xb5, 0x2e, 0xa0, 0x47, 0x6a, 0xc7, 0x28, 0x33, 0x4f, 0x71, 0x6a,
-	0xae, 0xb1, 0x95, 0x2b, 0xee, 0x45, 0x2e, 0xdc, 0xcf, 0xcd, 0x65, 0x36, 0xa7, 0xf2, 0x27, 0xac,
-	0x83, 0xd6, 0xbb, 0xaa, 0x42, 0x05, 0x7b, 0x93, 0xd6, 0xb4, 0x33, 0x7b, 0x8a, 0xf9, 0x05, 0x1b,
-	0xcb, 0xdf, 0x52, 0x47, 0x6d, 0x4b, 0x51, 0x38, 0x7b, 0xab, 0xcb, 0xc6, 0xcb, 0x98, 0x36, 0xb1,
-	0x4f, 0x99, 0xa3, 0x47, 0xf5, 0xeb, 0xa6, 0xc8, 0x5f, 0xb3, 0xd5, 0xd7, 0xcb, 0x1b, 0x79, 0x49,
-	0x97, 0xb2, 0x8c, 0x68, 0x21, 0x43, 0xb6, 0x63, 0x9c, 0xc2, 0x0a, 0x06, 0x79, 0x50, 0x0a, 0xd2,
-	0xa0, 0x74, 0xc8, 0xae, 0x83, 0x3c, 0x28, 0x11, 0x32, 0x4d, 0x52, 0xd5, 0x50, 0x78, 0x5d, 0x53,
-	0x07, 0x3c, 0x8f, 0xb2, 0x81, 0x52, 0xd9, 0xc2, 0x55, 0xce, 0xc3, 0x61, 0x2e, 0x4b, 0x41, 0x5a,
-	0x90, 0x0c, 0x01, 0xa3, 0x88, 0xb2, 0x84, 0x61, 0x5e, 0x10, 0x81, 0xb9, 0x2c, 0xd3, 0x9d, 0x0a,
-	0x6b, 0x91, 0x7b, 0x83, 0x11, 0x4d, 0xd5, 0x55, 0x58, 0xaf, 0x5e, 0xdb, 0x7b, 0xc6, 0x93, 0x5c,
-	0x7b, 0x77, 0xab, 0x2b, 0x14, 0x21, 0xca, 0xd8, 0x04, 0x18, 0x53, 0x91, 0x81, 0xc2, 0xfa, 0x3a,
-	0x0b, 0x37, 0xc4, 0xf9, 0x94, 0x0d, 0x36, 0xb3, 0xe9, 0x9d, 0x1e, 0x51, 0xee, 0xfe, 0x3a, 0xf7,
-	0x47, 0x7a, 0xb1, 0x17, 0xec, 0x68, 0x33, 0x53, 0x86, 0xa0, 0x4b, 0x2b, 0xa2, 0x36, 0x08, 0x30,
-	0x69, 0x4d, 0xb7, 0x66, 0xc3, 0xb5, 0xe1, 0x33, 0x89, 0x73, 0x6d, 0x90, 0x7f, 0x60, 0xa3, 0x4d,
-	0x1b, 0x3d, 0x0b, 0x32, 0x1d, 0x93, 0x89, 0xaf, 0x4d, 0xd7, 0x4d, 0xb8, 0x23, 0xcb, 0x27, 0x76,
-	0xfc, 0xfc, 0x26, 0x54, 0x42, 0xc9, 0x88, 0x70, 0x42, 0xb6, 0xf1, 0xbf, 0x77, 0xa1, 0xba, 0x94,
-	0x11, 0xff, 0xdf, 0x24, 0x2a, 0xb1, 0x58, 0xc2, 0x29, 0x4d, 0x35, 0x7c, 0x6e, 0xfc, 0xb2, 0x4c,
-	0xfb, 0xae, 0x64, 0x88, 0x22, 0x20, 0x5a, 0x78, 0x45, 0x37, 0x74, 0x12, 0xb8, 0x41, 0xb4, 0xfc,
-	0x9c, 0x1d, 0x92, 0xf8, 0xab, 0x41, 0xbf, 0x14, 0x1e, 0x43, 0xed, 0x6c, 0x40, 0x38, 0x9b, 0xb4,
-	0xa6, 0xfd, 0xd9, 0x41, 0x92, 0xbe, 0x27, 0x65, 0xb6, 0x12, 0x16, 0x6d, 0xfa, 0x01, 0x7c, 0xfc,
-	0x1b, 0x00, 0x00, 0xff, 0xff, 0x9b, 0x06, 0xcd, 0x66, 0x1d, 0x04, 0x00, 0x00,
+	// 672 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x6c, 0x54, 0x5d, 0x4f, 0x1b, 0x3b,
+	0x10, 0x55, 0x08, 0x70, 0x13, 0x27, 0x40, 0x30, 0x01, 0x0c, 0x5c, 0x2e, 0xcb, 0xa5, 0x0f, 0xa9,
+	0x54, 0x45, 0x6a, 0x2b, 0xa4, 0xb6, 0x52, 0x1f, 0x28, 0xf4, 0xb1, 0x88, 0x86, 0xd0, 0x57, 0xcb,
+	0x59, 0x0f, 0xc1, 0x62, 0x77, 0xbd, 0xb5, 0xbd, 0x54, 0xf9, 0xb7, 0xfd, 0x29, 0xd5, 0x8c, 0x03,
+	0x59, 0x41, 0xdf, 0x66, 0xce, 0x99, 0x33, 0x5f, 0x3b, 0x6b, 0xd6, 0xd5, 0xf0, 0x60, 0x52, 0x18,
+	0x96, 0xce, 0x06, 0xcb, 0x3b, 0xd1, 0x23, 0xe7, 0xff, 0xdf, 0x6d, 0xb6, 0x7a, 0x41, 0x3e, 0xe7,
+	0x6c, 0xb9, 0xaa, 0x8c, 0x16, 0x8d, 0xa4, 0x31, 0x68, 0x8f, 0xc8, 0x26, 0x4c, 0x1b, 0x2d, 0x96,
+	0xe6, 0x98, 0x36, 0x9a, 0x9f, 0xb0, 0x35, 0x0f, 0xce, 0xa8, 0x4c, 0x16, 0x55, 0x3e, 0x01, 0x27,
+	0x9a, 0x44, 0x76, 0x23, 0x78, 0x49, 0x18, 0x3f, 0x64, 0xcc, 0x7a, 0xf9, 0x00, 0xce, 0x1b, 0x5b,
+	0x88, 0x65, 0x8a, 0x68, 0x5b, 0xff, 0x23, 0x02, 0x98, 0x63, 0x52, 0x99, 0x4c, 0x3f, 0x45, 0xac,
+	0xc4, 0x1c, 0x04, 0x3e, 0x06, 0x1d, 0xb3, 0x6e, 0xe9, 0xac, 0xae, 0xd2, 0x20, 0x0b, 0x95, 0x83,
+	0x58, 0xa5, 0x98, 0xce, 0x1c, 0xbb, 0x54, 0x39, 0xf5, 0x6c, 0x72, 0x30, 0xe2, 0x9f, 0xd8, 0x1f,
+	0xda, 0x88, 0xe5, 0x60, 0xb4, 0x68, 0x45, 0x0c, 0x6d, 0xde, 0x67, 0x2b, 0xc1, 0xde, 0x43, 0x21,
+	0xda, 0x04, 0x46, 0x07, 0x9b, 0x2c, 0x2b, 0x7f, 0x27, 0x73, 0x35, 0x35, 0xa9, 0x60, 0xb1, 0x49,
+	0x44, 0xbe, 0x21, 0xc0, 0x0f, 0x58, 0x3b, 0xd7, 0xb9, 0x0c, 0xb6, 0x34, 0xa9, 0xe8, 0x10, 0xdb,
+	0xca, 0x75, 0x3e, 0x46, 0x1f, 0x9b, 0xab, 0x8a, 0xcc, 0xa6, 0xf7, 0x32, 0x26, 0xee, 0xc6, 0xe6,
+	0x22, 0x36, 0xa6, 0xf4, 0xfb, 0xac, 0x05, 0x85, 0xb3, 0x59, 0x06, 0x5a, 0xac, 0x25, 0x8d, 0x41,
+	0x6b, 0xf4, 0xe4, 0xf3, 0x53, 0xb6, 0xa3, 0x7e, 0x29, 0x13, 0x4c, 0x31, 0x95, 0xa9, 0x2d, 0x6e,
+	0xcd, 0xb4, 0x72, 0x2a, 0xe0, 0x26, 0xd6, 0x29, 0x72, 0xfb, 0x91, 0x3d, 0xaf, 0x93, 0xfc, 0x88,
+	0xcd, 0xbf, 0x5e, 0xdc, 0xc8, 0x06, 0x15, 0x65, 0x11, 0xa2, 0x85, 0xf4, 0xd9, 0x4a, 0x6e, 0x35,
+	0x64, 0xa2, 0x17, 0x07, 0x25, 0x07, 0x07, 0x25, 0x23, 0xaa, 0x36, 0xe3, 0xa0, 0x84, 0x90, 0x28,
+	0xc1, 0xac, 0x3e, 0x75, 0xa6, 0xa4, 0x0e, 0x78, 0x1c, 0xa5, 0x06, 0x61, 0xda, 0xd4, 0x66, 0xd6,
+	0x89, 0xad, 0x98, 0x96, 0x1c, 0x5c, 0x90, 0xf2, 0x1e, 0x82, 0x0c, 0x6a, 0x2a, 0xfa, 0x71, 0x41,
+	0x04, 0x8c, 0xd5, 0x14, 0x6b, 0x6a, 0x28, 0x65, 0xec, 0x4d, 0x6c, 0xd3, 0x54, 0x6d, 0x0d, 0xe5,
+	0xfc, 0xda, 0xde, 0x30, 0x8e, 0x74, 0xe9, 0xec, 0xad, 0xc9, 0x40, 0xfa, 0xa0, 0x42, 0xe5, 0xc5,
+	0x0e, 0x25, 0xe9, 0x69, 0x28, 0xaf, 0x22, 0x71, 0x4d, 0x38, 0x1f, 0xb0, 0x5e, 0x3d, 0x9a, 0xee,
+	0x74, 0x97, 0x62, 0xd7, 0x17, 0xb1, 0x37, 0x78, 0xb1, 0xa7, 0x6c, 0xb7, 0x1e, 0xa9, 0xbc, 0x37,
+	0xd3, 0x42, 0x06, 0x93, 0x83, 0x10, 0x49, 0x63, 0xd0, 0x1c, 0xf5, 0x17, 0x82, 0x33, 0x22, 0xc7,
+	0x26, 0x07, 0xfe, 0x96, 0x6d, 0xd7, 0x65, 0x74, 0x16, 0x24, 0xda, 0x23, 0x11, 0x5f, 0x88, 0xae,
+	0x2a, 0x7f, 0x47, 0x92, 0x8f, 0x6c, 0xef, 0x65, 0x25, 0xd0, 0x52, 0xab, 0x00, 0x62, 0x9f, 0x64,
+	0x3b, 0xcf, 0x6b, 0x81, 0xbe, 0x50, 0x01, 0xfe, 0xde, 0x24, 0x68, 0x39, 0x99, 0x89, 0x03, 0x9a,
+	0xaa, 0xff, 0x52, 0xf8, 0x65, 0x86, 0xfb, 0xce, 0x94, 0x0f, 0xd2, 0x03, 0x14, 0xe2, 0x5f, 0xaa,
+	0xd0, 0x42, 0xe0, 0x1a, 0xa0, 0xe0, 0x43, 0xb6, 0x45, 0xe4, 0xcf, 0x0a, 0xdc, 0x4c, 0x3a, 0xf0,
+	0xa5, 0x2d, 0x3c, 0x88, 0xc3, 0xa4, 0x31, 0xe8, 0x8e, 0x36, 0x91, 0xfa, 0x8e, 0xcc, 0x68, 0x4e,
+	0xf0, 0xd7, 0xac, 0x47, 0x53, 0x56, 0x85, 0x03, 0x95, 0xde, 0xa9, 0x49, 0x06, 0xe2, 0x3f, 0xfa,
+	0x4a, 0x1b, 0x88, 0xdf, 0x2c, 0x60, 0xfe, 0x8a, 0xe1, 0x96, 0xe3, 0xa1, 0xc7, 0x13, 0x3a, 0x8a,
+	0xbf, 0xab, 0x86, 0x92, 0x4e, 0x9d, 0xae, 0xe8, 0x9c, 0x31, 0x15, 0x82, 0x33, 0x93, 0x2a, 0x80,
+	0x17, 0x49, 0xd2, 0x1c, 0x74, 0xde, 0x9d, 0x0c, 0x6b, 0x8f, 0xcd, 0x30, 0x7e, 0xfa, 0xe1, 0xd9,
+	0x53, 0xd4, 0xd7, 0x22, 0xb8, 0xd9, 0xa8, 0x26, 0xc3, 0x9f, 0x37, 0xa8, 0xa9, 0x17, 0xc7, 0x49,
+	0x13, 0x7f, 0x5e, 0xb4, 0xf7, 0x3f, 0xb3, 0x8d, 0x67, 0x12, 0xde, 0x63, 0xcd, 0x7b, 0x98, 0xcd,
+	0x9f, 0x2a, 0x34, 0xf1, 0x42, 0x1f, 0x54, 0x56, 0xc1, 0xfc, 0xa9, 0x8a, 0xce, 0xa7, 0xa5, 0x0f,
+	0x8d, 0xc9, 0x2a, 0x15, 0x7f, 0xff, 0x67, 0x00, 0xce, 0x84, 0xd3, 0x29, 0x06, 0x05, 0x00, 0x00,
 }
@@ -0,0 +1,40 @@
+package device
+
+import "sync"
+
+// deviceLocks serializes the changes of each device by the worker and the
+// service, which read a device, change some of its fields and save all of
+// them. Without it, one would save a copy read before the other saved and
+// undo its changes.
+var deviceLocks = struct {
+	sync.Mutex
+	m map[string]*deviceLock
+}{m: make(map[string]*deviceLock)}
+
+type deviceLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lockDevice locks the device with a UUID and returns the function which
+// unlocks it.
+func lockDevice(uuid string) func() {
+	deviceLocks.Lock()
+	l, ok := deviceLocks.m[uuid]
+	if !ok {
+		l = new(deviceLock)
+		deviceLocks.m[uuid] = l
+	}
+	l.refs++
+	deviceLocks.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		deviceLocks.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(deviceLocks.m, uuid)
+		}
+		deviceLocks.Unlock()
+	}
+}
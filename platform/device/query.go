@@ -0,0 +1,528 @@
+package device
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// QueryError is returned for a filter, sort, cursor or field list which can
+// not be used to list devices.
+type QueryError struct {
+	Message string
+}
+
+func (e *QueryError) Error() string { return "invalid device query: " + e.Message }
+
+func (e *QueryError) StatusCode() int { return http.StatusBadRequest }
+
+func queryErrorf(format string, args ...interface{}) error {
+	return &QueryError{Message: fmt.Sprintf(format, args...)}
+}
+
+type fieldKind int
+
+const (
+	stringField fieldKind = iota
+	versionField
+	boolField
+	timeField
+	// attributeField is a custom attribute. Values which are numbers are
+	// compared as numbers.
+	attributeField
+	// tagField matches a device if any of its tags match.
+	tagField
+)
+
+type field struct {
+	kind  fieldKind
+	value func(*Device) string
+}
+
+// timeLayout formats times with a fixed width, so that formatted times sort
+// like the times. The zero time is formatted as the empty string.
+const timeLayout = "2006-01-02T15:04:05.000000000Z"
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(timeLayout)
+}
+
+// fields are the device fields which can be filtered, sorted and selected.
+var fields = map[string]field{
+	"serial_number":      {stringField, func(d *Device) string { return d.SerialNumber }},
+	"udid":               {stringField, func(d *Device) string { return d.UDID }},
+	"device_name":        {stringField, func(d *Device) string { return d.DeviceName }},
+	"asset_tag":          {stringField, func(d *Device) string { return d.AssetTag }},
+	"model":              {stringField, func(d *Device) string { return d.Model }},
+	"model_name":         {stringField, func(d *Device) string { return d.ModelName }},
+	"product_name":       {stringField, func(d *Device) string { return d.ProductName }},
+	"os_version":         {versionField, func(d *Device) string { return d.OSVersion }},
+	"build_version":      {stringField, func(d *Device) string { return d.BuildVersion }},
+	"dep_profile_status": {stringField, func(d *Device) string { return string(d.DEPProfileStatus) }},
+	"dep_token_name":     {stringField, func(d *Device) string { return d.DEPTokenName }},
+	"enrolled":           {boolField, func(d *Device) string { return strconv.FormatBool(d.Enrolled) }},
+	"dep_device":         {boolField, func(d *Device) string { return strconv.FormatBool(d.DEPDevice) }},
+	"push_unreachable":   {boolField, func(d *Device) string { return strconv.FormatBool(d.PushUnreachable) }},
+	"last_seen":          {timeField, func(d *Device) string { return formatTime(d.LastSeen) }},
+}
+
+// attributePrefix prefixes the names of custom attributes in queries.
+const attributePrefix = "attr."
+
+// lookupField returns a query field, or the custom attribute field of a name
+// like attr.department.
+func lookupField(name string) (field, bool) {
+	if f, ok := fields[name]; ok {
+		return f, true
+	}
+	if name == "tag" {
+		return field{tagField, func(d *Device) string { return strings.Join(d.Tags, ",") }}, true
+	}
+	if attr := strings.TrimPrefix(name, attributePrefix); attr != name && attributeName.MatchString(attr) {
+		return field{attributeField, func(d *Device) string { return d.Attributes[attr] }}, true
+	}
+	return field{}, false
+}
+
+// FieldValue returns the value of a query field of dev the way it is compared
+// by queries. Stores use it to index devices.
+func FieldValue(dev *Device, name string) string {
+	f, _ := lookupField(name)
+	return f.value(dev)
+}
+
+// compare compares two values of a field. Versions are compared by their
+// numeric components, so that 10.14.1 is less than 14. The other kinds are
+// formatted so they compare as strings.
+func compare(kind fieldKind, a, b string) int {
+	switch kind {
+	case versionField:
+		return compareVersions(a, b)
+	case attributeField:
+		x, xerr := strconv.ParseFloat(a, 64)
+		y, yerr := strconv.ParseFloat(b, 64)
+		if xerr == nil && yerr == nil {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y string
+		if i < len(as) {
+			x = as[i]
+		}
+		if i < len(bs) {
+			y = bs[i]
+		}
+		xn, xerr := strconv.Atoi(x)
+		yn, yerr := strconv.Atoi(y)
+		switch {
+		case x == y:
+			continue
+		case xerr == nil && yerr == nil && xn != yn:
+			if xn < yn {
+				return -1
+			}
+			return 1
+		case x == "":
+			return -1
+		case y == "":
+			return 1
+		default:
+			if c := strings.Compare(x, y); c != 0 {
+				return c
+			}
+		}
+	}
+	return 0
+}
+
+type condition struct {
+	field string
+	// get returns the value of the field of a device.
+	get   func(*Device) string
+	kind  fieldKind
+	op    string
+	value string
+	// values are the values of an "in" condition, which the filters by
+	// serial number and UDID are compiled to.
+	values []string
+}
+
+func (c condition) match(dev *Device) bool {
+	if c.kind == tagField {
+		return c.matchTags(dev)
+	}
+	v := c.get(dev)
+	switch c.op {
+	case "in":
+		for _, value := range c.values {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	case "~":
+		return strings.Contains(strings.ToLower(v), strings.ToLower(c.value))
+	}
+	n := compare(c.kind, v, c.value)
+	switch c.op {
+	case "=":
+		return n == 0
+	case "!=":
+		return n != 0
+	case "<":
+		return n < 0
+	case "<=":
+		return n <= 0
+	case ">":
+		return n > 0
+	default: // ">="
+		return n >= 0
+	}
+}
+
+// matchTags matches the tags of dev: "=" if it has the tag, "!=" if it does
+// not and "~" if any tag contains the value, ignoring case.
+func (c condition) matchTags(dev *Device) bool {
+	switch c.op {
+	case "=":
+		return hasTag(dev, c.value)
+	case "!=":
+		return !hasTag(dev, c.value)
+	default: // "~"
+		for _, tag := range dev.Tags {
+			if strings.Contains(strings.ToLower(tag), strings.ToLower(c.value)) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// parseFilter parses the filter expression of a ListDevicesOption.
+func parseFilter(filter string) ([]condition, error) {
+	tokens, err := tokenize(filter)
+	if err != nil {
+		return nil, err
+	}
+	var conds []condition
+	for len(tokens) > 0 {
+		if len(conds) > 0 {
+			if !strings.EqualFold(tokens[0], "and") {
+				return nil, queryErrorf("expected \"and\" before %q", tokens[0])
+			}
+			tokens = tokens[1:]
+			if len(tokens) == 0 {
+				return nil, queryErrorf("expected a condition after \"and\"")
+			}
+		}
+		negate := false
+		if strings.EqualFold(tokens[0], "not") {
+			negate = true
+			tokens = tokens[1:]
+			if len(tokens) == 0 {
+				return nil, queryErrorf("expected a field after \"not\"")
+			}
+		}
+		name := tokens[0]
+		f, ok := lookupField(name)
+		if !ok {
+			return nil, queryErrorf("unknown field %q", name)
+		}
+		tokens = tokens[1:]
+		if len(tokens) == 0 || !isOperator(tokens[0]) {
+			if f.kind != boolField {
+				return nil, queryErrorf("field %s must be compared to a value", name)
+			}
+			conds = append(conds, condition{field: name, get: f.value, kind: f.kind, op: "=", value: strconv.FormatBool(!negate)})
+			continue
+		}
+		if negate {
+			return nil, queryErrorf("\"not\" can only be used with boolean fields")
+		}
+		op := tokens[0]
+		if len(tokens) < 2 {
+			return nil, queryErrorf("expected a value after %s%s", name, op)
+		}
+		value, err := parseValue(f.kind, name, tokens[1])
+		if err != nil {
+			return nil, err
+		}
+		if op == "~" && f.kind != stringField && f.kind != attributeField && f.kind != tagField {
+			return nil, queryErrorf("~ can only be used with text fields, not %s", name)
+		}
+		if f.kind == tagField && op != "=" && op != "!=" && op != "~" {
+			return nil, queryErrorf("tag can only be compared with =, != or ~")
+		}
+		conds = append(conds, condition{field: name, get: f.value, kind: f.kind, op: op, value: value})
+		tokens = tokens[2:]
+	}
+	return conds, nil
+}
+
+var operators = []string{"!=", "<=", ">=", "=", "<", ">", "~"}
+
+func isOperator(s string) bool {
+	for _, op := range operators {
+		if s == op {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenize splits a filter into words, operators and quoted values.
+func tokenize(s string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case unicode.IsSpace(rune(c)):
+			i++
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(s[i+1:], c)
+			if end < 0 {
+				return nil, queryErrorf("unterminated quoted value at %q", s[i:])
+			}
+			// keep the opening quote so that quoted values are never operators.
+			tokens = append(tokens, s[i:i+1+end])
+			i += end + 2
+		case strings.IndexByte("!<>=~", c) >= 0:
+			op := string(c)
+			if i+1 < len(s) && s[i+1] == '=' && c != '=' && c != '~' {
+				op += "="
+			}
+			if op == "!" {
+				return nil, queryErrorf("unknown operator ! at %q", s[i:])
+			}
+			tokens = append(tokens, op)
+			i += len(op)
+		default:
+			j := i
+			for j < len(s) && !unicode.IsSpace(rune(s[j])) && strings.IndexByte("!<>=~\"'", s[j]) < 0 {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+func parseValue(kind fieldKind, name, token string) (string, error) {
+	quoted := strings.HasPrefix(token, `"`) || strings.HasPrefix(token, "'")
+	if quoted {
+		token = token[1:]
+	} else if isOperator(token) {
+		return "", queryErrorf("expected a value for %s, got %s", name, token)
+	}
+	switch kind {
+	case boolField:
+		b, err := strconv.ParseBool(token)
+		if err != nil {
+			return "", queryErrorf("%s must be true or false, got %q", name, token)
+		}
+		return strconv.FormatBool(b), nil
+	case timeField:
+		t, err := parseTime(token)
+		if err != nil {
+			return "", queryErrorf("%s must be a date or an RFC 3339 time, got %q", name, token)
+		}
+		return formatTime(t), nil
+	default:
+		return token, nil
+	}
+}
+
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", s)
+}
+
+// Query is a compiled ListDevicesOption. Stores use it to filter, sort and
+// paginate devices, after narrowing the devices down with their indexes.
+type Query struct {
+	conds      []condition
+	text       string
+	sortField  string
+	sortKey    field
+	descending bool
+	cursor     *cursor
+	offset     int
+	limit      int
+}
+
+type cursor struct {
+	Sort string `json:"s"`
+	Key  string `json:"k"`
+	UUID string `json:"u"`
+}
+
+// DefaultSort is the sort order of devices if none is requested.
+const DefaultSort = "serial_number"
+
+// NewQuery compiles the filters, sort order and pagination of opt.
+func NewQuery(opt ListDevicesOption) (*Query, error) {
+	q := &Query{
+		text:  strings.ToLower(opt.Query),
+		limit: opt.PerPage,
+	}
+	conds, err := parseFilter(opt.Filter)
+	if err != nil {
+		return nil, err
+	}
+	q.conds = conds
+	if len(opt.FilterSerial) > 0 {
+		q.conds = append(q.conds, condition{field: "serial_number", get: fields["serial_number"].value, op: "in", values: opt.FilterSerial})
+	}
+	if len(opt.FilterUDID) > 0 {
+		q.conds = append(q.conds, condition{field: "udid", get: fields["udid"].value, op: "in", values: opt.FilterUDID})
+	}
+	if !opt.LastSeenAfter.IsZero() {
+		q.conds = append(q.conds, condition{field: "last_seen", get: fields["last_seen"].value, kind: timeField, op: ">=", value: formatTime(opt.LastSeenAfter)})
+	}
+	if !opt.LastSeenBefore.IsZero() {
+		q.conds = append(q.conds, condition{field: "last_seen", get: fields["last_seen"].value, kind: timeField, op: "<", value: formatTime(opt.LastSeenBefore)})
+	}
+
+	sortBy := opt.Sort
+	if sortBy == "" {
+		sortBy = DefaultSort
+	}
+	q.sortField = strings.TrimPrefix(sortBy, "-")
+	q.descending = strings.HasPrefix(sortBy, "-")
+	f, ok := lookupField(q.sortField)
+	if !ok || f.kind == tagField {
+		return nil, queryErrorf("can not sort by unknown field %q", q.sortField)
+	}
+	q.sortKey = f
+
+	if opt.Cursor != "" {
+		data, err := base64.RawURLEncoding.DecodeString(opt.Cursor)
+		if err != nil {
+			return nil, queryErrorf("malformed cursor")
+		}
+		var c cursor
+		if err := json.Unmarshal(data, &c); err != nil {
+			return nil, queryErrorf("malformed cursor")
+		}
+		if c.Sort != sortBy {
+			return nil, queryErrorf("cursor is for sort %q, not %q", c.Sort, sortBy)
+		}
+		q.cursor = &c
+	} else if opt.Page > 1 && opt.PerPage > 0 {
+		q.offset = (opt.Page - 1) * opt.PerPage
+	}
+	return q, nil
+}
+
+// Equal returns the values one of the named fields must be equal to, for
+// stores which look devices up by an index on the field. It returns false if
+// the query has no such condition on any of the fields.
+func (q *Query) Equal(names ...string) (string, []string, bool) {
+	for _, name := range names {
+		for _, c := range q.conds {
+			switch {
+			case c.field == name && c.op == "=":
+				return name, []string{c.value}, true
+			case c.field == name && c.op == "in":
+				return name, c.values, true
+			}
+		}
+	}
+	return "", nil, false
+}
+
+// Match reports whether dev matches the filters of the query.
+func (q *Query) Match(dev *Device) bool {
+	for _, c := range q.conds {
+		if !c.match(dev) {
+			return false
+		}
+	}
+	if q.text != "" &&
+		!strings.Contains(strings.ToLower(dev.DeviceName), q.text) &&
+		!strings.Contains(strings.ToLower(dev.AssetTag), q.text) &&
+		!hasTag(dev, q.text) {
+		return false
+	}
+	return true
+}
+
+// less orders devices by the sort field, then by UUID so that the order is
+// stable between pages.
+func (q *Query) less(key1, uuid1, key2, uuid2 string) bool {
+	n := compare(q.sortKey.kind, key1, key2)
+	if n == 0 {
+		n = strings.Compare(uuid1, uuid2)
+	}
+	if q.descending {
+		return n > 0
+	}
+	return n < 0
+}
+
+// Apply filters, sorts and paginates devices.
+func (q *Query) Apply(devices []Device) []Device {
+	matched := devices[:0:0]
+	for i := range devices {
+		if q.Match(&devices[i]) {
+			matched = append(matched, devices[i])
+		}
+	}
+	value := q.sortKey.value
+	sort.Slice(matched, func(i, j int) bool {
+		return q.less(value(&matched[i]), matched[i].UUID, value(&matched[j]), matched[j].UUID)
+	})
+	start := q.offset
+	if q.cursor != nil {
+		start = sort.Search(len(matched), func(i int) bool {
+			return q.less(q.cursor.Key, q.cursor.UUID, value(&matched[i]), matched[i].UUID)
+		})
+	}
+	if start > len(matched) {
+		start = len(matched)
+	}
+	matched = matched[start:]
+	if q.limit > 0 && len(matched) > q.limit {
+		matched = matched[:q.limit]
+	}
+	return matched
+}
+
+// NextCursor returns the cursor of the page after page, or an empty string if
+// page is the last page.
+func (q *Query) NextCursor(page []Device) string {
+	if q.limit == 0 || len(page) < q.limit {
+		return ""
+	}
+	last := &page[len(page)-1]
+	sortBy := q.sortField
+	if q.descending {
+		sortBy = "-" + sortBy
+	}
+	data, _ := json.Marshal(cursor{Sort: sortBy, Key: q.sortKey.value(last), UUID: last.UUID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
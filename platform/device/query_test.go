@@ -0,0 +1,206 @@
+package device
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func testDevices() []Device {
+	seen := time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)
+	return []Device{
+		{UUID: "1", SerialNumber: "C02A", OSVersion: "10.14.1", Enrolled: true, Model: "MacBookPro15,1", DeviceName: "Front Desk", LastSeen: seen,
+			Attributes: map[string]string{"department": "Sales", "cost": "100"}, Tags: []string{"kiosk", "loaner"}},
+		{UUID: "2", SerialNumber: "C02B", OSVersion: "10.13.6", Enrolled: false, Model: "MacBookPro15,1", AssetTag: "IT-0042", LastSeen: seen.Add(time.Hour),
+			Attributes: map[string]string{"department": "IT", "cost": "20"}, Tags: []string{"Loaner"}},
+		{UUID: "3", SerialNumber: "C02C", OSVersion: "14.0", Enrolled: true, Model: "Macmini8,1", DEPDevice: true, LastSeen: seen.Add(-time.Hour)},
+		{UUID: "4", SerialNumber: "C02D", OSVersion: "9.3", Enrolled: true, Model: "iPad6,11", DEPProfileStatus: ASSIGNED},
+	}
+}
+
+func serials(devices []Device) string {
+	var s string
+	for _, d := range devices {
+		s += d.SerialNumber + " "
+	}
+	return s
+}
+
+func TestQueryFilter(t *testing.T) {
+	tests := []struct {
+		opt  ListDevicesOption
+		want string
+	}{
+		{ListDevicesOption{}, "C02A C02B C02C C02D "},
+		{ListDevicesOption{Filter: "os_version<14 and enrolled"}, "C02A C02D "},
+		{ListDevicesOption{Filter: "os_version>=10.14"}, "C02A C02C "},
+		{ListDevicesOption{Filter: "not enrolled"}, "C02B "},
+		{ListDevicesOption{Filter: "enrolled=false"}, "C02B "},
+		{ListDevicesOption{Filter: "model=MacBookPro15,1 AND not dep_device"}, "C02A C02B "},
+		{ListDevicesOption{Filter: "model!=MacBookPro15,1"}, "C02C C02D "},
+		{ListDevicesOption{Filter: "model~mini"}, "C02C "},
+		{ListDevicesOption{Filter: "dep_profile_status=assigned"}, "C02D "},
+		{ListDevicesOption{Filter: `device_name~"front desk"`}, "C02A "},
+		{ListDevicesOption{Filter: "last_seen>=2019-03-01T12:00:00Z"}, "C02A C02B "},
+		{ListDevicesOption{Filter: "last_seen<2019-03-02 and last_seen>2019-01-01"}, "C02A C02B C02C "},
+		{ListDevicesOption{LastSeenAfter: time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)}, "C02A C02B "},
+		{ListDevicesOption{LastSeenBefore: time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)}, "C02C C02D "},
+		{ListDevicesOption{Query: "it-00"}, "C02B "},
+		{ListDevicesOption{Query: "desk"}, "C02A "},
+		{ListDevicesOption{FilterSerial: []string{"C02D", "C02B"}}, "C02B C02D "},
+		{ListDevicesOption{FilterSerial: []string{"C02D", "C02B"}, Filter: "enrolled"}, "C02D "},
+		{ListDevicesOption{Filter: "attr.department=Sales"}, "C02A "},
+		{ListDevicesOption{Filter: "attr.department!=Sales"}, "C02B C02C C02D "},
+		{ListDevicesOption{Filter: "attr.cost>50"}, "C02A "},
+		{ListDevicesOption{Filter: "attr.department~s"}, "C02A "},
+		{ListDevicesOption{Filter: "tag=loaner"}, "C02A C02B "},
+		{ListDevicesOption{Filter: "tag!=loaner and enrolled"}, "C02C C02D "},
+		{ListDevicesOption{Filter: "tag~kio"}, "C02A "},
+		{ListDevicesOption{Query: "kiosk"}, "C02A "},
+	}
+	for _, tt := range tests {
+		q, err := NewQuery(tt.opt)
+		if err != nil {
+			t.Fatalf("%+v: %s", tt.opt, err)
+		}
+		if have := serials(q.Apply(testDevices())); have != tt.want {
+			t.Errorf("%+v: have %q, want %q", tt.opt, have, tt.want)
+		}
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	for _, opt := range []ListDevicesOption{
+		{Filter: "color=red"},
+		{Filter: "model"},
+		{Filter: "enrolled=maybe"},
+		{Filter: "enrolled model=x"},
+		{Filter: "enrolled and"},
+		{Filter: "not model=x"},
+		{Filter: "os_version~10"},
+		{Filter: "last_seen>yesterday"},
+		{Filter: `device_name="front desk`},
+		{Filter: "model ! x"},
+		{Filter: "attr.Department=Sales"},
+		{Filter: "tag<loaner"},
+		{Sort: "tag"},
+		{Sort: "color"},
+		{Cursor: "not a cursor"},
+	} {
+		_, err := NewQuery(opt)
+		if _, ok := err.(*QueryError); !ok {
+			t.Errorf("%+v: have err %v, want a QueryError", opt, err)
+		}
+	}
+}
+
+func TestQuerySort(t *testing.T) {
+	tests := []struct {
+		sort string
+		want string
+	}{
+		{"", "C02A C02B C02C C02D "},
+		{"-serial_number", "C02D C02C C02B C02A "},
+		{"os_version", "C02D C02B C02A C02C "},
+		{"-last_seen", "C02B C02A C02C C02D "},
+		// devices with equal models are ordered by uuid.
+		{"model", "C02A C02B C02C C02D "},
+		// devices without the attribute sort first, and numbers by value.
+		{"attr.cost", "C02C C02D C02B C02A "},
+	}
+	for _, tt := range tests {
+		q, err := NewQuery(ListDevicesOption{Sort: tt.sort})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have := serials(q.Apply(testDevices())); have != tt.want {
+			t.Errorf("sort %q: have %q, want %q", tt.sort, have, tt.want)
+		}
+	}
+}
+
+func TestQueryCursor(t *testing.T) {
+	var devices []Device
+	for i := 0; i < 10; i++ {
+		devices = append(devices, Device{
+			UUID:         strconv.Itoa(i),
+			SerialNumber: "SERIAL" + strconv.Itoa(i),
+			// pairs of devices have the same model.
+			Model: "Model" + strconv.Itoa(i/2),
+		})
+	}
+
+	opt := ListDevicesOption{PerPage: 3, Sort: "-model"}
+	var (
+		have   []string
+		cursor string
+	)
+	for pages := 0; ; pages++ {
+		if pages > 4 {
+			t.Fatal("too many pages")
+		}
+		q, err := NewQuery(opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		page := q.Apply(devices)
+		for _, d := range page {
+			have = append(have, d.UUID)
+		}
+		// devices saved between pages don't shift the next pages.
+		devices = append(devices, Device{UUID: "new" + strconv.Itoa(pages), Model: "Model9"})
+		if opt.Cursor = q.NextCursor(page); opt.Cursor == "" {
+			break
+		}
+		cursor = opt.Cursor
+	}
+	// descending order also orders devices with the same model by
+	// descending uuid.
+	want := []string{"9", "8", "7", "6", "5", "4", "3", "2", "1", "0"}
+	if len(have) != len(want) {
+		t.Fatalf("have %v, want %v", have, want)
+	}
+	for i := range want {
+		if have[i] != want[i] {
+			t.Fatalf("have %v, want %v", have, want)
+		}
+	}
+
+	opt.Sort, opt.Cursor = "model", cursor
+	if _, err := NewQuery(opt); err == nil {
+		t.Error("have no error using a cursor with another sort")
+	}
+}
+
+func TestQueryPage(t *testing.T) {
+	q, err := NewQuery(ListDevicesOption{Page: 2, PerPage: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := serials(q.Apply(testDevices())), "C02D "; have != want {
+		t.Errorf("have %q, want %q", have, want)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"10.14.1", "14", -1},
+		{"10.14", "10.14.0", -1},
+		{"10.9", "10.10", -1},
+		{"12.0.1", "12.0.1", 0},
+		{"13", "12.4", 1},
+		{"", "1", -1},
+		{"11.0b1", "11.0b2", -1},
+	}
+	for _, tt := range tests {
+		if have := compareVersions(tt.a, tt.b); have != tt.want {
+			t.Errorf("compareVersions(%q, %q): have %d, want %d", tt.a, tt.b, have, tt.want)
+		}
+		if have := compareVersions(tt.b, tt.a); have != -tt.want {
+			t.Errorf("compareVersions(%q, %q): have %d, want %d", tt.b, tt.a, have, -tt.want)
+		}
+	}
+}
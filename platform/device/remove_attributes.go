@@ -0,0 +1,93 @@
+package device
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/pkg/httputil"
+)
+
+// RemoveAttributes removes attribute definitions, and the values of the
+// attributes from every device.
+func (svc *DeviceService) RemoveAttributes(ctx context.Context, names []string) error {
+	remove := make(map[string]bool, len(names))
+	for _, name := range names {
+		remove[name] = true
+	}
+	devices, err := svc.store.List(ListDevicesOption{})
+	if err != nil {
+		return errors.Wrap(err, "list devices")
+	}
+	removeValues := func(dev *Device) error {
+		for name := range dev.Attributes {
+			if remove[name] {
+				delete(dev.Attributes, name)
+			}
+		}
+		if len(dev.Attributes) == 0 {
+			dev.Attributes = nil
+		}
+		return nil
+	}
+	for i := range devices {
+		dev := &devices[i]
+		changed := false
+		for name := range dev.Attributes {
+			changed = changed || remove[name]
+		}
+		if !changed {
+			continue
+		}
+		if err := svc.changeDevice(ctx, dev, removeValues); err != nil {
+			return errors.Wrapf(err, "save device %s", dev.UUID)
+		}
+	}
+	for _, name := range names {
+		if err := svc.store.DeleteAttribute(name); err != nil {
+			return errors.Wrapf(err, "delete device attribute %s", name)
+		}
+	}
+	return nil
+}
+
+type removeAttributesRequest struct {
+	Names []string `json:"names"`
+}
+
+type removeAttributesResponse struct {
+	Err error `json:"err,omitempty"`
+}
+
+func (r removeAttributesResponse) Failed() error { return r.Err }
+
+func decodeRemoveAttributesRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	var req removeAttributesRequest
+	err := httputil.DecodeJSONRequest(r, &req)
+	return req, err
+}
+
+func decodeRemoveAttributesResponse(_ context.Context, r *http.Response) (interface{}, error) {
+	var resp removeAttributesResponse
+	err := httputil.DecodeJSONResponse(r, &resp)
+	return resp, err
+}
+
+func MakeRemoveAttributesEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(removeAttributesRequest)
+		err = svc.RemoveAttributes(ctx, req.Names)
+		return removeAttributesResponse{Err: err}, nil
+	}
+}
+
+func (e Endpoints) RemoveAttributes(ctx context.Context, names []string) error {
+	request := removeAttributesRequest{Names: names}
+	response, err := e.RemoveAttributesEndpoint(ctx, request)
+	if err != nil {
+		return err
+	}
+	return response.(removeAttributesResponse).Err
+}
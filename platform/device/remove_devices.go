@@ -5,22 +5,37 @@ import (
 	"net/http"
 
 	"github.com/go-kit/kit/endpoint"
+	"github.com/pkg/errors"
+
 	"github.com/vishnuvaradaraj/micromdm/pkg/httputil"
 )
 
+// RemoveDevices deletes devices and their history.
 func (svc *DeviceService) RemoveDevices(ctx context.Context, opt RemoveDevicesOptions) error {
 	for _, udid := range opt.UDIDs {
-		err := svc.store.DeleteByUDID(udid)
+		dev, err := svc.store.DeviceByUDID(udid)
 		if err != nil {
 			return err
 		}
+		if err := svc.store.DeleteByUDID(udid); err != nil {
+			return err
+		}
+		if err := svc.store.DeleteHistory(dev.UUID); err != nil {
+			return errors.Wrapf(err, "delete history of device %s", udid)
+		}
 	}
 
 	for _, serial := range opt.Serials {
-		err := svc.store.DeleteBySerial(serial)
+		dev, err := svc.store.DeviceBySerial(serial)
 		if err != nil {
 			return err
 		}
+		if err := svc.store.DeleteBySerial(serial); err != nil {
+			return err
+		}
+		if err := svc.store.DeleteHistory(dev.UUID); err != nil {
+			return errors.Wrapf(err, "delete history of device %s", serial)
+		}
 	}
 
 	return nil
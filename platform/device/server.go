@@ -9,20 +9,35 @@ import (
 )
 
 type Endpoints struct {
-	ListDevicesEndpoint   endpoint.Endpoint
-	RemoveDevicesEndpoint endpoint.Endpoint
+	ListDevicesEndpoint      endpoint.Endpoint
+	RemoveDevicesEndpoint    endpoint.Endpoint
+	UpdateDevicesEndpoint    endpoint.Endpoint
+	ApplyAttributeEndpoint   endpoint.Endpoint
+	GetAttributesEndpoint    endpoint.Endpoint
+	RemoveAttributesEndpoint endpoint.Endpoint
+	DeviceHistoryEndpoint    endpoint.Endpoint
 }
 
 func MakeServerEndpoints(s Service, outer endpoint.Middleware, others ...endpoint.Middleware) Endpoints {
 	return Endpoints{
-		ListDevicesEndpoint:   endpoint.Chain(outer, others...)(MakeListDevicesEndpoint(s)),
-		RemoveDevicesEndpoint: endpoint.Chain(outer, others...)(MakeRemoveDevicesEndpoint(s)),
+		ListDevicesEndpoint:      endpoint.Chain(outer, others...)(MakeListDevicesEndpoint(s)),
+		RemoveDevicesEndpoint:    endpoint.Chain(outer, others...)(MakeRemoveDevicesEndpoint(s)),
+		UpdateDevicesEndpoint:    endpoint.Chain(outer, others...)(MakeUpdateDevicesEndpoint(s)),
+		ApplyAttributeEndpoint:   endpoint.Chain(outer, others...)(MakeApplyAttributeEndpoint(s)),
+		GetAttributesEndpoint:    endpoint.Chain(outer, others...)(MakeGetAttributesEndpoint(s)),
+		RemoveAttributesEndpoint: endpoint.Chain(outer, others...)(MakeRemoveAttributesEndpoint(s)),
+		DeviceHistoryEndpoint:    endpoint.Chain(outer, others...)(MakeDeviceHistoryEndpoint(s)),
 	}
 }
 
 func RegisterHTTPHandlers(r *mux.Router, e Endpoints, options ...httptransport.ServerOption) {
 	// GET     /v1/devices		get a list of devices managed by the server
 	// DELETE  /v1/devices		remove one or more devices from the server
+	// PATCH   /v1/devices		set the custom attributes and tags of devices, from JSON or CSV
+	// PUT     /v1/devices/attributes		define a custom device attribute
+	// GET     /v1/devices/attributes		get the custom device attributes
+	// DELETE  /v1/devices/attributes		remove custom device attributes and their values
+	// GET     /v1/devices/:udid/history		get the timeline of events of a device
 
 	r.Methods("GET").Path("/v1/devices").Handler(httptransport.NewServer(
 		e.ListDevicesEndpoint,
@@ -37,4 +52,39 @@ func RegisterHTTPHandlers(r *mux.Router, e Endpoints, options ...httptransport.S
 		httputil.EncodeJSONResponse,
 		options...,
 	))
+
+	r.Methods("PATCH").Path("/v1/devices").Handler(httptransport.NewServer(
+		e.UpdateDevicesEndpoint,
+		decodeUpdateDevicesRequest,
+		httputil.EncodeJSONResponse,
+		options...,
+	))
+
+	r.Methods("PUT").Path("/v1/devices/attributes").Handler(httptransport.NewServer(
+		e.ApplyAttributeEndpoint,
+		decodeApplyAttributeRequest,
+		httputil.EncodeJSONResponse,
+		options...,
+	))
+
+	r.Methods("GET").Path("/v1/devices/attributes").Handler(httptransport.NewServer(
+		e.GetAttributesEndpoint,
+		decodeGetAttributesRequest,
+		httputil.EncodeJSONResponse,
+		options...,
+	))
+
+	r.Methods("DELETE").Path("/v1/devices/attributes").Handler(httptransport.NewServer(
+		e.RemoveAttributesEndpoint,
+		decodeRemoveAttributesRequest,
+		httputil.EncodeJSONResponse,
+		options...,
+	))
+
+	r.Methods("GET").Path("/v1/devices/{udid}/history").Handler(httptransport.NewServer(
+		e.DeviceHistoryEndpoint,
+		decodeDeviceHistoryRequest,
+		httputil.EncodeJSONResponse,
+		options...,
+	))
 }
@@ -2,6 +2,8 @@ package device
 
 import (
 	"context"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/pubsub"
 )
 
 type RemoveDevicesOptions struct {
@@ -10,20 +12,42 @@ type RemoveDevicesOptions struct {
 }
 
 type Service interface {
-	ListDevices(ctx context.Context, opt ListDevicesOption) ([]DeviceDTO, error)
+	ListDevices(ctx context.Context, opt ListDevicesOption) (*DevicePage, error)
 	RemoveDevices(ctx context.Context, opt RemoveDevicesOptions) error
+
+	// UpdateDevices sets the custom attributes and tags of devices.
+	UpdateDevices(ctx context.Context, updates []DeviceUpdate) error
+	ApplyAttribute(ctx context.Context, a *Attribute) error
+	GetAttributes(ctx context.Context) ([]Attribute, error)
+	// RemoveAttributes removes attribute definitions and their values.
+	RemoveAttributes(ctx context.Context, names []string) error
+
+	// DeviceHistory returns the timeline of events of a device.
+	DeviceHistory(ctx context.Context, udid string, opt HistoryOption) ([]HistoryEvent, error)
 }
 
 type Store interface {
+	// List returns the page of devices which match opt, in the order of
+	// opt.Sort. Stores use NewQuery to filter, sort and paginate.
 	List(opt ListDevicesOption) ([]Device, error)
 	DeleteByUDID(udid string) error
 	DeleteBySerial(serial string) error
+	DeviceWorkerStore
+	AttributeStore
+}
+
+// AttributeStore stores the definitions of custom attributes.
+type AttributeStore interface {
+	SaveAttribute(a *Attribute) error
+	Attributes() ([]Attribute, error)
+	DeleteAttribute(name string) error
 }
 
 type DeviceService struct {
-	store Store
+	store     Store
+	publisher pubsub.Publisher
 }
 
-func New(store Store) *DeviceService {
-	return &DeviceService{store: store}
+func New(store Store, pub pubsub.Publisher) *DeviceService {
+	return &DeviceService{store: store, publisher: pub}
 }
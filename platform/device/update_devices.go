@@ -0,0 +1,282 @@
+package device
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/vishnuvaradaraj/micromdm/pkg/httputil"
+)
+
+// DeviceUpdate changes the custom attributes and tags of the device with a
+// UDID, or else with a serial number.
+type DeviceUpdate struct {
+	UDID         string `json:"udid,omitempty"`
+	SerialNumber string `json:"serial_number,omitempty"`
+
+	// Attributes sets custom attributes by name. An empty value removes the
+	// attribute from the device.
+	Attributes map[string]string `json:"attributes,omitempty"`
+
+	// Tags are added to the tags of the device, or replace them if
+	// ReplaceTags is set. RemoveTags are removed afterwards.
+	Tags        []string `json:"tags,omitempty"`
+	ReplaceTags bool     `json:"replace_tags,omitempty"`
+	RemoveTags  []string `json:"remove_tags,omitempty"`
+}
+
+// UpdateDevices checks every update before saving the devices, so that an
+// invalid update changes no device. Devices which are looked up by serial
+// number and are not in the inventory are added, like DEP devices before
+// they enroll, so that attributes can be set before a device is synced.
+func (svc *DeviceService) UpdateDevices(ctx context.Context, updates []DeviceUpdate) error {
+	attributes, err := svc.store.Attributes()
+	if err != nil {
+		return errors.Wrap(err, "get device attributes")
+	}
+	defs := make(map[string]Attribute, len(attributes))
+	for _, a := range attributes {
+		defs[a.Name] = a
+	}
+
+	// updates of the same device in a batch apply in order, to the device
+	// as updated by the previous ones.
+	type deviceUpdates struct {
+		dev     *Device
+		updates []*DeviceUpdate
+	}
+	var (
+		devices []*deviceUpdates
+		byUUID  = make(map[string]*deviceUpdates)
+		byKey   = make(map[string]*deviceUpdates)
+	)
+	for i := range updates {
+		u := &updates[i]
+		key := "serial:" + u.SerialNumber
+		if u.UDID != "" {
+			key = "udid:" + u.UDID
+		}
+		du, ok := byKey[key]
+		if !ok {
+			dev, err := svc.deviceForUpdate(u)
+			if err != nil {
+				return err
+			}
+			if du, ok = byUUID[dev.UUID]; !ok {
+				du = &deviceUpdates{dev: dev}
+				byUUID[dev.UUID] = du
+				devices = append(devices, du)
+			}
+			byKey[key] = du
+		}
+		if err := applyUpdate(du.dev, u, defs); err != nil {
+			return err
+		}
+		du.updates = append(du.updates, u)
+	}
+
+	for _, du := range devices {
+		err := svc.changeDevice(ctx, du.dev, func(saved *Device) error {
+			for _, u := range du.updates {
+				if err := applyUpdate(saved, u, defs); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return errors.Wrapf(err, "save device %s", du.dev.UUID)
+		}
+	}
+	return nil
+}
+
+// changeDevice applies change to the saved copy of dev and saves it, holding
+// the lock of the device so that the changes the worker saved since dev was
+// read are kept. dev is saved as it is if it was not saved before.
+func (svc *DeviceService) changeDevice(ctx context.Context, dev *Device, change func(*Device) error) error {
+	unlock := lockDevice(dev.UUID)
+	defer unlock()
+	saved, err := svc.store.DeviceByUUID(dev.UUID)
+	switch {
+	case isNotFound(err):
+		saved = dev
+	case err != nil:
+		return errors.Wrapf(err, "get saved device %s", dev.UUID)
+	default:
+		if err := change(saved); err != nil {
+			return err
+		}
+	}
+	return saveDevice(ctx, svc.store, svc.publisher, saved)
+}
+
+func (svc *DeviceService) deviceForUpdate(u *DeviceUpdate) (*Device, error) {
+	if u.UDID != "" {
+		dev, err := svc.store.DeviceByUDID(u.UDID)
+		if isNotFound(err) {
+			return nil, attributeErrorf("no device with UDID %s", u.UDID)
+		}
+		return dev, errors.Wrapf(err, "retrieve device with udid %s", u.UDID)
+	}
+	if u.SerialNumber == "" {
+		return nil, attributeErrorf("update must have a UDID or serial number")
+	}
+	dev, err := svc.store.DeviceBySerial(u.SerialNumber)
+	if isNotFound(err) {
+		return &Device{UUID: uuid.NewV4().String(), SerialNumber: u.SerialNumber}, nil
+	}
+	return dev, errors.Wrapf(err, "retrieve device with serial number %s", u.SerialNumber)
+}
+
+func applyUpdate(dev *Device, u *DeviceUpdate, defs map[string]Attribute) error {
+	values := make(map[string]string, len(dev.Attributes)+len(u.Attributes))
+	for name, value := range dev.Attributes {
+		values[name] = value
+	}
+	for name, value := range u.Attributes {
+		a, ok := defs[name]
+		if !ok {
+			return attributeErrorf("unknown attribute %q, define it with mdmctl apply device-attributes", name)
+		}
+		if strings.TrimSpace(value) == "" {
+			delete(values, name)
+			continue
+		}
+		formatted, err := a.format(value)
+		if err != nil {
+			return err
+		}
+		values[name] = formatted
+	}
+	if len(values) == 0 {
+		values = nil
+	}
+
+	add, err := formatTags(u.Tags)
+	if err != nil {
+		return err
+	}
+	remove, err := formatTags(u.RemoveTags)
+	if err != nil {
+		return err
+	}
+	tags := dev.Tags
+	if u.ReplaceTags {
+		tags = nil
+	}
+
+	dev.Attributes = values
+	dev.Tags = sortedTags(tags, add, remove)
+	return nil
+}
+
+// ParseDeviceUpdatesCSV parses device updates from CSV. The first row names
+// the columns: serial_number or udid selects the device, tags lists its tags
+// separated by semicolons and the other columns are custom attributes. Each
+// row sets every attribute column, so empty cells remove attributes, and the
+// tags column replaces the tags of the device.
+func ParseDeviceUpdatesCSV(r io.Reader) ([]DeviceUpdate, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, attributeErrorf("CSV has no header row")
+	}
+	if err != nil {
+		return nil, &AttributeError{Message: err.Error()}
+	}
+	hasDevice := false
+	for i, column := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(column))
+		if header[i] == "serial_number" || header[i] == "udid" {
+			hasDevice = true
+		}
+	}
+	if !hasDevice {
+		return nil, attributeErrorf("CSV must have a serial_number or udid column")
+	}
+
+	var updates []DeviceUpdate
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return updates, nil
+		}
+		if err != nil {
+			return nil, &AttributeError{Message: err.Error()}
+		}
+		u := DeviceUpdate{Attributes: make(map[string]string)}
+		for i, column := range header {
+			value := strings.TrimSpace(record[i])
+			switch column {
+			case "serial_number":
+				u.SerialNumber = value
+			case "udid":
+				u.UDID = value
+			case "tags":
+				u.ReplaceTags = true
+				for _, tag := range strings.Split(value, ";") {
+					if tag = strings.TrimSpace(tag); tag != "" {
+						u.Tags = append(u.Tags, tag)
+					}
+				}
+			default:
+				u.Attributes[column] = value
+			}
+		}
+		updates = append(updates, u)
+	}
+}
+
+type updateDevicesRequest struct {
+	Updates []DeviceUpdate `json:"updates"`
+}
+
+type updateDevicesResponse struct {
+	Err error `json:"err,omitempty"`
+}
+
+func (r updateDevicesResponse) Failed() error { return r.Err }
+
+// decodeUpdateDevicesRequest decodes JSON, or CSV if the Content-Type is
+// text/csv.
+func decodeUpdateDevicesRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	var req updateDevicesRequest
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+		updates, err := ParseDeviceUpdatesCSV(r.Body)
+		req.Updates = updates
+		return req, err
+	}
+	err := httputil.DecodeJSONRequest(r, &req)
+	return req, err
+}
+
+func decodeUpdateDevicesResponse(_ context.Context, r *http.Response) (interface{}, error) {
+	var resp updateDevicesResponse
+	err := httputil.DecodeJSONResponse(r, &resp)
+	return resp, err
+}
+
+func MakeUpdateDevicesEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(updateDevicesRequest)
+		err = svc.UpdateDevices(ctx, req.Updates)
+		return updateDevicesResponse{Err: err}, nil
+	}
+}
+
+func (e Endpoints) UpdateDevices(ctx context.Context, updates []DeviceUpdate) error {
+	request := updateDevicesRequest{Updates: updates}
+	response, err := e.UpdateDevicesEndpoint(ctx, request)
+	if err != nil {
+		return err
+	}
+	return response.(updateDevicesResponse).Err
+}
@@ -0,0 +1,283 @@
+package device
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/pubsub/inmem"
+)
+
+type notFound struct{}
+
+func (notFound) Error() string  { return "not found" }
+func (notFound) NotFound() bool { return true }
+
+// memStore is a Store for the devices, attributes and history of a test.
+type memStore struct {
+	devices    []Device
+	attributes []Attribute
+	history    map[string][]HistoryEvent
+	// historyErr is returned when history is added or read.
+	historyErr error
+}
+
+func (s *memStore) List(opt ListDevicesOption) ([]Device, error) {
+	q, err := NewQuery(opt)
+	if err != nil {
+		return nil, err
+	}
+	return q.Apply(s.devices), nil
+}
+
+func (s *memStore) find(match func(*Device) bool) (*Device, error) {
+	for _, d := range s.devices {
+		if match(&d) {
+			return &d, nil
+		}
+	}
+	return nil, notFound{}
+}
+
+func (s *memStore) DeviceByUUID(uuid string) (*Device, error) {
+	return s.find(func(d *Device) bool { return d.UUID == uuid })
+}
+
+func (s *memStore) DeviceByUDID(udid string) (*Device, error) {
+	return s.find(func(d *Device) bool { return d.UDID == udid })
+}
+
+func (s *memStore) DeviceBySerial(serial string) (*Device, error) {
+	return s.find(func(d *Device) bool { return d.SerialNumber == serial })
+}
+
+func (s *memStore) Save(dev *Device) error {
+	for i, d := range s.devices {
+		if d.UUID == dev.UUID {
+			s.devices[i] = *dev
+			return nil
+		}
+	}
+	s.devices = append(s.devices, *dev)
+	return nil
+}
+
+func (s *memStore) DeleteByUDID(string) error   { return nil }
+func (s *memStore) DeleteBySerial(string) error { return nil }
+
+func (s *memStore) SaveAttribute(a *Attribute) error {
+	for i := range s.attributes {
+		if s.attributes[i].Name == a.Name {
+			s.attributes[i] = *a
+			return nil
+		}
+	}
+	s.attributes = append(s.attributes, *a)
+	return nil
+}
+
+func (s *memStore) Attributes() ([]Attribute, error) { return s.attributes, nil }
+
+func (s *memStore) DeleteAttribute(name string) error {
+	for i := range s.attributes {
+		if s.attributes[i].Name == name {
+			s.attributes = append(s.attributes[:i], s.attributes[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (s *memStore) AddHistory(uuid string, ev *HistoryEvent) error {
+	if s.historyErr != nil {
+		return s.historyErr
+	}
+	if s.history == nil {
+		s.history = make(map[string][]HistoryEvent)
+	}
+	s.history[uuid] = append(s.history[uuid], *ev)
+	return nil
+}
+
+func (s *memStore) History(uuid string) ([]HistoryEvent, error) {
+	if s.historyErr != nil {
+		return nil, s.historyErr
+	}
+	return append([]HistoryEvent(nil), s.history[uuid]...), nil
+}
+
+func (s *memStore) DeleteHistory(uuid string) error {
+	delete(s.history, uuid)
+	return nil
+}
+
+type countPublisher int
+
+func (p *countPublisher) Publish(context.Context, string, []byte) error {
+	*p++
+	return nil
+}
+
+func testService(t *testing.T) (*DeviceService, *memStore, *countPublisher) {
+	store := &memStore{devices: []Device{
+		{UUID: "1", UDID: "UDID-1", SerialNumber: "C02A", Tags: []string{"kiosk"}},
+		{UUID: "2", UDID: "UDID-2", SerialNumber: "C02B"},
+	}}
+	pub := new(countPublisher)
+	svc := New(store, pub)
+	for _, a := range []Attribute{
+		{Name: "department", Type: StringAttribute},
+		{Name: "cost", Type: NumberAttribute},
+		{Name: "lease_end", Type: DateAttribute},
+	} {
+		if err := svc.ApplyAttribute(context.Background(), &a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return svc, store, pub
+}
+
+func TestApplyAttribute(t *testing.T) {
+	svc, _, _ := testService(t)
+	ctx := context.Background()
+	for _, a := range []Attribute{
+		{Name: "Department", Type: StringAttribute},
+		{Name: "owner", Type: "email"},
+		{Name: "cost", Type: StringAttribute},
+	} {
+		if err := svc.ApplyAttribute(ctx, &a); err == nil {
+			t.Errorf("%+v: have no error", a)
+		}
+	}
+	if err := svc.ApplyAttribute(ctx, &Attribute{Name: "cost", Type: NumberAttribute, Description: "in USD"}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUpdateDevices(t *testing.T) {
+	svc, store, pub := testService(t)
+	ctx := context.Background()
+
+	err := svc.UpdateDevices(ctx, []DeviceUpdate{
+		{UDID: "UDID-1", Attributes: map[string]string{"department": "Sales", "cost": "1.50"}, Tags: []string{"Loaner"}},
+		{SerialNumber: "C02A", Attributes: map[string]string{"lease_end": "2021-06-30T00:00:00Z"}, RemoveTags: []string{"KIOSK"}},
+		{SerialNumber: "C02NEW", Tags: []string{"loaner"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev, _ := store.DeviceByUDID("UDID-1")
+	if have, want := dev.Attributes["cost"], "1.5"; have != want {
+		t.Errorf("have cost %s, want %s", have, want)
+	}
+	if have, want := dev.Attributes["lease_end"], "2021-06-30"; have != want {
+		t.Errorf("have lease_end %s, want %s", have, want)
+	}
+	if have, want := strings.Join(dev.Tags, ","), "Loaner"; have != want {
+		t.Errorf("have tags %s, want %s", have, want)
+	}
+	if _, err := store.DeviceBySerial("C02NEW"); err != nil {
+		t.Errorf("have err %v, want a device added for the new serial", err)
+	}
+	if have, want := int(*pub), 2; have != want {
+		t.Errorf("have %d devices published, want %d", have, want)
+	}
+
+	invalid := [][]DeviceUpdate{
+		{{UDID: "UDID-MISSING"}},
+		{{Attributes: map[string]string{"department": "IT"}}},
+		{{SerialNumber: "C02B", Attributes: map[string]string{"owner": "me"}}},
+		{{SerialNumber: "C02B", Attributes: map[string]string{"cost": "a lot"}}},
+		{{SerialNumber: "C02B", Tags: []string{"a;b"}}},
+		// a valid update is not saved if another update in the batch fails.
+		{{SerialNumber: "C02B", Tags: []string{"saved"}}, {SerialNumber: "C02B", Tags: []string{""}}},
+	}
+	for _, updates := range invalid {
+		err := svc.UpdateDevices(ctx, updates)
+		if _, ok := err.(*AttributeError); !ok {
+			t.Errorf("%+v: have err %v, want an AttributeError", updates, err)
+		}
+	}
+	if dev, _ := store.DeviceBySerial("C02B"); dev.Tags != nil {
+		t.Errorf("have tags %v, want none", dev.Tags)
+	}
+
+	// removing an attribute removes its values.
+	if err := svc.RemoveAttributes(ctx, []string{"cost"}); err != nil {
+		t.Fatal(err)
+	}
+	if dev, _ := store.DeviceByUDID("UDID-1"); dev.Attributes["cost"] != "" {
+		t.Errorf("have cost %s after removing the attribute", dev.Attributes["cost"])
+	}
+}
+
+func TestDeviceChangesNotLost(t *testing.T) {
+	svc, store, _ := testService(t)
+	w := NewWorker(store, inmem.NewPubSub(), log.NewNopLogger())
+	ctx := context.Background()
+
+	// the worker saves a copy read before the tags were updated.
+	stale, _ := store.DeviceByUDID("UDID-1")
+	if err := svc.UpdateDevices(ctx, []DeviceUpdate{{UDID: "UDID-1", Tags: []string{"loaner"}}}); err != nil {
+		t.Fatal(err)
+	}
+	stale.DeviceName = "Front Desk"
+	if err := w.save(ctx, stale); err != nil {
+		t.Fatal(err)
+	}
+	dev, _ := store.DeviceByUDID("UDID-1")
+	if have, want := strings.Join(dev.Tags, ","), "kiosk,loaner"; have != want {
+		t.Errorf("have tags %s after the worker saved, want %s", have, want)
+	}
+
+	// the service changes a copy read before the worker saved.
+	stale, _ = store.DeviceByUDID("UDID-1")
+	dev.OSVersion = "10.14.2"
+	if err := w.save(ctx, dev); err != nil {
+		t.Fatal(err)
+	}
+	err := svc.changeDevice(ctx, stale, func(d *Device) error {
+		d.Tags = nil
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev, _ = store.DeviceByUDID("UDID-1")
+	if dev.OSVersion != "10.14.2" || dev.DeviceName != "Front Desk" || dev.Tags != nil {
+		t.Errorf("have os version %q, name %q and tags %v, want every change saved",
+			dev.OSVersion, dev.DeviceName, dev.Tags)
+	}
+}
+
+func TestParseDeviceUpdatesCSV(t *testing.T) {
+	const data = `Serial_Number,department,tags
+C02A,Sales,loaner; kiosk
+C02B,,
+`
+	updates, err := ParseDeviceUpdatesCSV(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(updates), 2; have != want {
+		t.Fatalf("have %d updates, want %d", have, want)
+	}
+	u := updates[0]
+	if u.SerialNumber != "C02A" || u.Attributes["department"] != "Sales" || !u.ReplaceTags {
+		t.Errorf("have %+v", u)
+	}
+	if have, want := strings.Join(u.Tags, ","), "loaner,kiosk"; have != want {
+		t.Errorf("have tags %s, want %s", have, want)
+	}
+	if u := updates[1]; u.Attributes["department"] != "" || len(u.Tags) != 0 || !u.ReplaceTags {
+		t.Errorf("have %+v, want the department and tags removed", u)
+	}
+
+	for _, data := range []string{"", "department\nSales\n", "serial_number,department\nC02A\n"} {
+		if _, err := ParseDeviceUpdatesCSV(strings.NewReader(data)); err == nil {
+			t.Errorf("%q: have no error", data)
+		}
+	}
+}
@@ -10,28 +10,48 @@ import (
 	uuid "github.com/satori/go.uuid"
 
 	"github.com/vishnuvaradaraj/micromdm/mdm"
+	"github.com/vishnuvaradaraj/micromdm/platform/apns"
 	"github.com/vishnuvaradaraj/micromdm/platform/dep/sync"
 	"github.com/vishnuvaradaraj/micromdm/platform/pubsub"
 )
 
 type DeviceWorkerStore interface {
 	Save(*Device) error
+	DeviceByUUID(uuid string) (*Device, error)
 	DeviceByUDID(udid string) (*Device, error)
 	DeviceBySerial(udid string) (*Device, error)
+	HistoryStore
 }
 
 type Worker struct {
 	db     DeviceWorkerStore
 	ps     pubsub.PublishSubscriber
 	logger log.Logger
+	resets []func(udid string, authenticated time.Time) error
 }
 
-func NewWorker(db DeviceWorkerStore, ps pubsub.PublishSubscriber, logger log.Logger) *Worker {
-	return &Worker{
+type WorkerOption func(*Worker)
+
+// WithEnrollmentReset adds functions which clear the state a device kept from
+// its previous enrollment, such as its command queue or users. They are called
+// with the UDID of a device when it re-enrolls and the time of its
+// Authenticate message, and must keep what was created since then.
+func WithEnrollmentReset(resets ...func(udid string, authenticated time.Time) error) WorkerOption {
+	return func(w *Worker) {
+		w.resets = append(w.resets, resets...)
+	}
+}
+
+func NewWorker(db DeviceWorkerStore, ps pubsub.PublishSubscriber, logger log.Logger, opts ...WorkerOption) *Worker {
+	w := &Worker{
 		db:     db,
 		ps:     ps,
 		logger: logger,
 	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
 }
 
 func (w *Worker) Run(ctx context.Context) error {
@@ -56,6 +76,14 @@ func (w *Worker) Run(ctx context.Context) error {
 	if err != nil {
 		return errors.Wrapf(err, "subscribing %s to %s", subscription, mdm.ConnectTopic)
 	}
+	unregisteredEvents, err := w.ps.Subscribe(ctx, subscription, apns.UnregisteredTopic)
+	if err != nil {
+		return errors.Wrapf(err, "subscribing %s to %s", subscription, apns.UnregisteredTopic)
+	}
+	historyEvents, err := w.ps.Subscribe(ctx, subscription, HistoryTopic)
+	if err != nil {
+		return errors.Wrapf(err, "subscribing %s to %s", subscription, HistoryTopic)
+	}
 
 	for {
 		var err error
@@ -72,6 +100,10 @@ func (w *Worker) Run(ctx context.Context) error {
 			err = w.updateFromDEPSync(ctx, ev.Message)
 		case ev := <-connectEvents:
 			err = w.updateFromAcknowledge(ctx, ev.Message)
+		case ev := <-unregisteredEvents:
+			err = w.updateFromPushUnregistered(ctx, ev.Message)
+		case ev := <-historyEvents:
+			err = w.addHistory(ctx, ev.Message)
 		}
 		if err != nil {
 			level.Info(w.logger).Log(
@@ -83,6 +115,74 @@ func (w *Worker) Run(ctx context.Context) error {
 	}
 }
 
+// save saves a device changed by the worker. Attributes and tags are only
+// changed by the service, so the saved ones are kept in case they changed
+// since dev was read.
+func (w *Worker) save(ctx context.Context, dev *Device) error {
+	unlock := lockDevice(dev.UUID)
+	defer unlock()
+	saved, err := w.db.DeviceByUUID(dev.UUID)
+	if err != nil && !isNotFound(err) {
+		return errors.Wrapf(err, "get saved device %s", dev.UUID)
+	}
+	if err == nil {
+		dev.Attributes, dev.Tags = saved.Attributes, saved.Tags
+	}
+	return saveDevice(ctx, w.db, w.ps, dev)
+}
+
+// saveDevice saves dev and publishes it to DeviceUpdatedTopic.
+func saveDevice(ctx context.Context, db DeviceWorkerStore, pub pubsub.Publisher, dev *Device) error {
+	if err := db.Save(dev); err != nil {
+		return err
+	}
+	msg, err := MarshalDevice(dev)
+	if err != nil {
+		return errors.Wrap(err, "marshal updated device")
+	}
+	err = pub.Publish(ctx, DeviceUpdatedTopic, msg)
+	return errors.Wrapf(err, "publish device on topic: %s", DeviceUpdatedTopic)
+}
+
+// record adds an event to the history of dev.
+func (w *Worker) record(dev *Device, typ HistoryEventType, details map[string]string) error {
+	ev := NewHistoryEvent(typ, dev.UDID, details)
+	ev.SerialNumber = dev.SerialNumber
+	err := w.db.AddHistory(dev.UUID, ev)
+	return errors.Wrapf(err, "add %s event to history of device %s", typ, dev.UUID)
+}
+
+// addHistory adds an event published to HistoryTopic to the history of its
+// device. A device whose setup completed, or is held after a failure, no
+// longer awaits configuration, so its setup is not resumed after a restart.
+func (w *Worker) addHistory(ctx context.Context, message []byte) error {
+	var ev HistoryEvent
+	if err := UnmarshalHistoryEvent(message, &ev); err != nil {
+		return errors.Wrap(err, "unmarshal history event")
+	}
+	dev, err := w.db.DeviceByUDID(ev.UDID)
+	if err != nil {
+		return errors.Wrapf(err, "retrieve device with udid %s", ev.UDID)
+	}
+	setupDone := ev.Type == SetupCompleted || (ev.Type == SetupFailed && ev.Details["action"] == "hold")
+	if setupDone && dev.AwaitingConfiguration {
+		dev.AwaitingConfiguration = false
+		if err := w.save(ctx, dev); err != nil {
+			return errors.Wrapf(err, "saving device %s after its setup", dev.UDID)
+		}
+	}
+	ev.SerialNumber = dev.SerialNumber
+	err = w.db.AddHistory(dev.UUID, &ev)
+	return errors.Wrapf(err, "add %s event to history of device %s", ev.Type, dev.UUID)
+}
+
+// depHistoryEvents are the history events of the DEP sync op types.
+var depHistoryEvents = map[string]HistoryEventType{
+	"added":    DEPAdded,
+	"modified": DEPModified,
+	"deleted":  DEPDeleted,
+}
+
 func (w *Worker) updateFromDEPSync(ctx context.Context, message []byte) error {
 	var ev sync.Event
 	if err := sync.UnmarshalEvent(message, &ev); err != nil {
@@ -90,6 +190,7 @@ func (w *Worker) updateFromDEPSync(ctx context.Context, message []byte) error {
 	}
 	level.Debug(w.logger).Log(
 		"msg", "updating devices from DEP",
+		"dep_token", ev.TokenName,
 		"device_count", len(ev.Devices),
 	)
 
@@ -126,9 +227,22 @@ func (w *Worker) updateFromDEPSync(ctx context.Context, message []byte) error {
 		dev.DEPProfileAssignTime = dd.ProfileAssignTime
 		dev.DEPProfileAssignedDate = dd.DeviceAssignedDate
 		dev.DEPProfileAssignedBy = dd.DeviceAssignedBy
+		if ev.TokenName != "" {
+			dev.DEPTokenName = ev.TokenName
+		}
 
-		if err := w.db.Save(dev); err != nil {
-			return errors.Wrap(err, "save device %s from DEP sync")
+		if err := w.save(ctx, dev); err != nil {
+			return errors.Wrapf(err, "save device %s from DEP sync", dd.SerialNumber)
+		}
+		if typ, ok := depHistoryEvents[dd.OpType]; ok {
+			err := w.record(dev, typ, map[string]string{
+				"dep_token":      dev.DEPTokenName,
+				"profile_uuid":   dd.ProfileUUID,
+				"profile_status": dd.ProfileStatus,
+			})
+			if err != nil {
+				level.Info(w.logger).Log("msg", "record DEP sync", "serial", dd.SerialNumber, "err", err)
+			}
 		}
 	}
 
@@ -147,9 +261,26 @@ func (w *Worker) updateFromAcknowledge(ctx context.Context, message []byte) erro
 	}
 	dev.LastSeen = time.Now()
 
-	err = w.db.Save(dev)
-	return errors.Wrapf(err, "saving updated device for acknowledge event")
-
+	if err := w.save(ctx, dev); err != nil {
+		return errors.Wrapf(err, "saving updated device for acknowledge event")
+	}
+	if ev.Response.CommandUUID == "" || ev.Response.Status == "NotNow" {
+		return nil
+	}
+	details := map[string]string{
+		"command_uuid": ev.Response.CommandUUID,
+		"status":       ev.Response.Status,
+	}
+	if ev.Response.RequestType != "" {
+		details["request_type"] = ev.Response.RequestType
+	}
+	if chain := ev.Response.ErrorChain; len(chain) > 0 {
+		details["error"] = chain[0].USEnglishDescription
+		if details["error"] == "" {
+			details["error"] = chain[0].LocalizedDescription
+		}
+	}
+	return w.record(dev, CommandResult, details)
 }
 
 func (w *Worker) updateFromCheckout(ctx context.Context, message []byte) error {
@@ -166,9 +297,10 @@ func (w *Worker) updateFromCheckout(ctx context.Context, message []byte) error {
 	dev.Enrolled = false
 	dev.LastSeen = time.Now()
 
-	err = w.db.Save(dev)
-	return errors.Wrapf(err, "saving updated device for checkout event")
-
+	if err := w.save(ctx, dev); err != nil {
+		return errors.Wrapf(err, "saving updated device for checkout event")
+	}
+	return w.record(dev, CheckedOut, nil)
 }
 
 func (w *Worker) updateFromTokenUpdate(ctx context.Context, message []byte) error {
@@ -190,23 +322,65 @@ func (w *Worker) updateFromTokenUpdate(ctx context.Context, message []byte) erro
 	dev.PushMagic = ev.Command.PushMagic
 	dev.UnlockToken = ev.Command.UnlockToken.String()
 	dev.AwaitingConfiguration = ev.Command.AwaitingConfiguration
+	dev.PushUnreachable = false
 	dev.LastSeen = time.Now()
 	// first TokenUpdate event will have the enrollment status set to false.
 	newlyEnrolled := !dev.Enrolled
 	dev.Enrolled = true
-	if err := w.db.Save(dev); err != nil {
+	if err := w.save(ctx, dev); err != nil {
 		return errors.Wrapf(err, "saving updated device for Token event udid=%s", ev.Command.UDID)
 	}
 
 	if newlyEnrolled {
+		typ, err := w.recordEnrollment(dev)
+		if err != nil {
+			level.Info(w.logger).Log("msg", "record enrollment", "udid", dev.UDID, "err", err)
+		}
 		// notify subscribers of a successful enrollment
 		// TODO: The enrollment topic needs a custom event.
-		err = w.ps.Publish(ctx, DeviceEnrolledTopic, message)
-		return errors.Wrap(err, "publishing new enrollment message")
+		topic := DeviceEnrolledTopic
+		if typ == ReEnrolled {
+			topic = DeviceReEnrolledTopic
+		}
+		err = w.ps.Publish(ctx, topic, message)
+		return errors.Wrapf(err, "publishing enrollment message on topic: %s", topic)
 	}
 	return nil
 }
 
+// recordEnrollment records that dev enrolled, or re-enrolled if its history
+// has an earlier enrollment, and returns the type of the event. The type is
+// Enrolled if the history can not be read.
+func (w *Worker) recordEnrollment(dev *Device) (HistoryEventType, error) {
+	history, err := w.db.History(dev.UUID)
+	if err != nil {
+		return Enrolled, errors.Wrapf(err, "get history of device %s", dev.UUID)
+	}
+	typ := Enrolled
+	for _, ev := range history {
+		if ev.Type == Enrolled || ev.Type == ReEnrolled {
+			typ = ReEnrolled
+			break
+		}
+	}
+	return typ, w.record(dev, typ, map[string]string{"os_version": dev.OSVersion})
+}
+
+func (w *Worker) updateFromPushUnregistered(ctx context.Context, message []byte) error {
+	udid := string(message)
+	dev, err := w.db.DeviceByUDID(udid)
+	if isNotFound(err) {
+		// the push was for a user channel, which is keyed by GUID.
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "retrieve device with udid %s", udid)
+	}
+	dev.PushUnreachable = true
+	err = w.save(ctx, dev)
+	return errors.Wrapf(err, "saving unreachable device udid=%s", udid)
+}
+
 func (w *Worker) updateFromAuthenticate(ctx context.Context, message []byte) error {
 	var ev mdm.CheckinEvent
 	if err := mdm.UnmarshalCheckinEvent(message, &ev); err != nil {
@@ -223,6 +397,9 @@ func (w *Worker) updateFromAuthenticate(ctx context.Context, message []byte) err
 			"msg", "re-enrolling device",
 			"serial", ev.Command.SerialNumber,
 		)
+		if err := w.resetEnrollment(device, ev.Time); err != nil {
+			return err
+		}
 	} else {
 		level.Debug(w.logger).Log(
 			"msg", "enrolling new device",
@@ -233,6 +410,7 @@ func (w *Worker) updateFromAuthenticate(ctx context.Context, message []byte) err
 	if device.UUID == "" {
 		device.UUID = uuid.NewV4().String()
 	}
+	prevName, prevOSVersion := device.DeviceName, device.OSVersion
 	device.UDID = ev.Command.UDID
 	device.OSVersion = ev.Command.OSVersion
 	device.BuildVersion = ev.Command.BuildVersion
@@ -244,8 +422,34 @@ func (w *Worker) updateFromAuthenticate(ctx context.Context, message []byte) err
 	device.Model = ev.Command.Model
 	device.ModelName = ev.Command.ModelName
 	device.LastSeen = time.Now()
-	err = w.db.Save(device)
-	return errors.Wrapf(err, "saving updated device for authenticate event")
+	if err := w.save(ctx, device); err != nil {
+		return errors.Wrapf(err, "saving updated device for authenticate event")
+	}
+
+	// a known device which reports a new name or OS version.
+	if prevName != "" && prevName != device.DeviceName {
+		err := w.record(device, NameChanged, map[string]string{"from": prevName, "to": device.DeviceName})
+		if err != nil {
+			return err
+		}
+	}
+	if prevOSVersion != "" && prevOSVersion != device.OSVersion {
+		return w.record(device, OSUpdated, map[string]string{"from": prevOSVersion, "to": device.OSVersion})
+	}
+	return nil
+}
+
+// resetEnrollment clears the state dev kept from its previous enrollment, so
+// that commands queued for it or the configuration it was waiting for are not
+// carried over to the new enrollment, which began when it authenticated.
+func (w *Worker) resetEnrollment(dev *Device, authenticated time.Time) error {
+	for _, reset := range w.resets {
+		if err := reset(dev.UDID, authenticated); err != nil {
+			return errors.Wrapf(err, "reset previous enrollment of device %s", dev.UDID)
+		}
+	}
+	dev.AwaitingConfiguration = false
+	return nil
 }
 
 func getOrCreateDevice(db DeviceWorkerStore, serial, udid string) (dev *Device, reenrolling bool, err error) {
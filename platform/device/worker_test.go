@@ -0,0 +1,181 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/vishnuvaradaraj/micromdm/dep"
+	"github.com/vishnuvaradaraj/micromdm/mdm"
+	"github.com/vishnuvaradaraj/micromdm/platform/dep/sync"
+	"github.com/vishnuvaradaraj/micromdm/platform/pubsub/inmem"
+)
+
+func TestWorkerReEnrollment(t *testing.T) {
+	store := &memStore{}
+	ps := inmem.NewPubSub()
+	ctx := context.Background()
+	enrolled, err := ps.Subscribe(ctx, "test", DeviceEnrolledTopic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reEnrolled, err := ps.Subscribe(ctx, "test", DeviceReEnrolledTopic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resets []string
+	w := NewWorker(store, ps, log.NewNopLogger(), WithEnrollmentReset(func(udid string, _ time.Time) error {
+		resets = append(resets, udid)
+		return nil
+	}))
+
+	tokenUpdate := mdm.CheckinEvent{Command: mdm.CheckinCommand{MessageType: "TokenUpdate", UDID: "UDID-1"}}
+	tokenUpdate.Command.AwaitingConfiguration = true
+	tokenUpdateMessage, err := mdm.MarshalCheckinEvent(&tokenUpdate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// waitTopic returns the topic the enrollment was published to.
+	waitTopic := func() string {
+		t.Helper()
+		select {
+		case ev := <-enrolled:
+			return ev.Topic
+		case ev := <-reEnrolled:
+			return ev.Topic
+		case <-time.After(time.Second):
+			t.Fatal("enrollment was not published")
+		}
+		return ""
+	}
+
+	if err := w.updateFromAuthenticate(ctx, checkinMessage(t, "Authenticate", "UDID-1", "laptop", "10.14.1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.updateFromTokenUpdate(ctx, tokenUpdateMessage); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := waitTopic(), DeviceEnrolledTopic; have != want {
+		t.Errorf("have enrollment on %s, want %s", have, want)
+	}
+	if len(resets) != 0 {
+		t.Errorf("have resets %v for a new device, want none", resets)
+	}
+
+	if err := w.updateFromAuthenticate(ctx, checkinMessage(t, "Authenticate", "UDID-1", "laptop", "10.14.1")); err != nil {
+		t.Fatal(err)
+	}
+	if len(resets) != 1 || resets[0] != "UDID-1" {
+		t.Errorf("have resets %v, want UDID-1", resets)
+	}
+	dev, err := store.DeviceByUDID("UDID-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dev.Enrolled || dev.AwaitingConfiguration {
+		t.Errorf("have enrolled %v and awaiting configuration %v, want the enrollment reset",
+			dev.Enrolled, dev.AwaitingConfiguration)
+	}
+
+	if err := w.updateFromTokenUpdate(ctx, tokenUpdateMessage); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := waitTopic(), DeviceReEnrolledTopic; have != want {
+		t.Errorf("have re-enrollment on %s, want %s", have, want)
+	}
+}
+
+func TestWorkerHistoryErrors(t *testing.T) {
+	store := &memStore{}
+	ps := inmem.NewPubSub()
+	ctx := context.Background()
+	enrolled, err := ps.Subscribe(ctx, "test", DeviceEnrolledTopic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWorker(store, ps, log.NewNopLogger())
+	if err := w.updateFromAuthenticate(ctx, checkinMessage(t, "Authenticate", "UDID-1", "laptop", "10.14.1")); err != nil {
+		t.Fatal(err)
+	}
+	store.historyErr = errors.New("history unavailable")
+
+	// the enrollment is published without its history.
+	if err := w.updateFromTokenUpdate(ctx, checkinMessage(t, "TokenUpdate", "UDID-1", "", "")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-enrolled:
+	case <-time.After(time.Second):
+		t.Fatal("enrollment was not published")
+	}
+
+	// every device of a DEP sync is saved without its history.
+	msg, err := sync.MarshalEvent(sync.NewEvent("", []dep.Device{
+		{SerialNumber: "C02B", OpType: "added"},
+		{SerialNumber: "C02C", OpType: "added"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.updateFromDEPSync(ctx, msg); err != nil {
+		t.Fatal(err)
+	}
+	for _, serial := range []string{"C02B", "C02C"} {
+		if _, err := store.DeviceBySerial(serial); err != nil {
+			t.Errorf("device %s from DEP sync: %s", serial, err)
+		}
+	}
+}
+
+func TestWorkerSetupDone(t *testing.T) {
+	store := &memStore{}
+	ctx := context.Background()
+	w := NewWorker(store, inmem.NewPubSub(), log.NewNopLogger())
+	if err := w.updateFromAuthenticate(ctx, checkinMessage(t, "Authenticate", "UDID-1", "laptop", "10.14.1")); err != nil {
+		t.Fatal(err)
+	}
+	tokenUpdate := mdm.CheckinEvent{Command: mdm.CheckinCommand{MessageType: "TokenUpdate", UDID: "UDID-1"}}
+	tokenUpdate.Command.AwaitingConfiguration = true
+	msg, err := mdm.MarshalCheckinEvent(&tokenUpdate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.updateFromTokenUpdate(ctx, msg); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		typ                   HistoryEventType
+		details               map[string]string
+		awaitingConfiguration bool
+	}{
+		{SetupFailed, map[string]string{"action": "continue"}, true},
+		{SetupFailed, map[string]string{"action": "hold"}, false},
+		{SetupCompleted, nil, false},
+	}
+	for _, tt := range tests {
+		dev, err := store.DeviceByUDID("UDID-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		dev.AwaitingConfiguration = true
+		if err := store.Save(dev); err != nil {
+			t.Fatal(err)
+		}
+		msg, err := MarshalHistoryEvent(NewHistoryEvent(tt.typ, "UDID-1", tt.details))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.addHistory(ctx, msg); err != nil {
+			t.Fatal(err)
+		}
+		if dev, _ = store.DeviceByUDID("UDID-1"); dev.AwaitingConfiguration != tt.awaitingConfiguration {
+			t.Errorf("%s %v: have awaiting configuration %v, want %v",
+				tt.typ, tt.details, dev.AwaitingConfiguration, tt.awaitingConfiguration)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package group
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+
+	"github.com/vishnuvaradaraj/micromdm/pkg/httputil"
+)
+
+// ApplyGroup creates or replaces a group, and updates its members.
+func (svc *GroupService) ApplyGroup(ctx context.Context, g *Group) error {
+	if g == nil {
+		return &InvalidGroupError{Message: "request must contain a group"}
+	}
+	if err := g.Verify(); err != nil {
+		return &InvalidGroupError{Message: err.Error()}
+	}
+	if err := svc.store.Save(g); err != nil {
+		return err
+	}
+	return svc.evaluate(ctx, g)
+}
+
+// InvalidGroupError is returned when a group can not be applied.
+type InvalidGroupError struct {
+	Message string
+}
+
+func (e *InvalidGroupError) Error() string   { return "invalid group: " + e.Message }
+func (e *InvalidGroupError) StatusCode() int { return http.StatusBadRequest }
+
+type applyGroupRequest struct {
+	Group *Group `json:"group"`
+}
+
+type applyGroupResponse struct {
+	Err error `json:"err,omitempty"`
+}
+
+func (r applyGroupResponse) Failed() error { return r.Err }
+
+func decodeApplyGroupRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	var req applyGroupRequest
+	err := httputil.DecodeJSONRequest(r, &req)
+	return req, err
+}
+
+func decodeApplyGroupResponse(_ context.Context, r *http.Response) (interface{}, error) {
+	var resp applyGroupResponse
+	err := httputil.DecodeJSONResponse(r, &resp)
+	return resp, err
+}
+
+func MakeApplyGroupEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(applyGroupRequest)
+		err = svc.ApplyGroup(ctx, req.Group)
+		return applyGroupResponse{
+			Err: err,
+		}, nil
+	}
+}
+
+func (e Endpoints) ApplyGroup(ctx context.Context, g *Group) error {
+	request := applyGroupRequest{Group: g}
+	resp, err := e.ApplyGroupEndpoint(ctx, request)
+	if err != nil {
+		return err
+	}
+	return resp.(applyGroupResponse).Err
+}
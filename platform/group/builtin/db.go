@@ -0,0 +1,325 @@
+package builtin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/firestore"
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/group"
+)
+
+const (
+	GroupBucket  = "mdm.Groups"
+	MemberBucket = "mdm.GroupMembers"
+)
+
+// Firestore document IDs can not contain "/", so group names are escaped.
+var keyEscaper = strings.NewReplacer("%", "%25", "/", "%2F", ":", "%3A")
+
+// FireDB stores groups in Google Cloud Firestore.
+type FireDB struct {
+	*firestore.Client
+}
+
+type groupDoc struct {
+	Data []byte `firestore:"data"`
+}
+
+type memberDoc struct {
+	Group string `firestore:"group"`
+	UUID  string `firestore:"uuid"`
+	Data  []byte `firestore:"data"`
+}
+
+func NewFireDB(db *firestore.Client) (*FireDB, error) {
+	datastore := &FireDB{Client: db}
+	return datastore, nil
+}
+
+func fireMemberKey(groupName, uuid string) string {
+	return keyEscaper.Replace(groupName) + ":" + keyEscaper.Replace(uuid)
+}
+
+func (db *FireDB) Save(g *group.Group) error {
+	data, err := json.Marshal(g)
+	if err != nil {
+		return errors.Wrap(err, "marshal group")
+	}
+	_, err = db.Collection(GroupBucket).Doc(keyEscaper.Replace(g.Name)).Set(context.Background(), groupDoc{Data: data})
+	return errors.Wrap(err, "put group to firestore")
+}
+
+func (db *FireDB) GroupByName(name string) (*group.Group, error) {
+	snap, err := db.Collection(GroupBucket).Doc(keyEscaper.Replace(name)).Get(context.Background())
+	if status.Code(err) == codes.NotFound {
+		return nil, &notFound{"Group", fmt.Sprintf("name %s", name)}
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "get group %s", name)
+	}
+	var doc groupDoc
+	if err := snap.DataTo(&doc); err != nil {
+		return nil, errors.Wrap(err, "decode group document")
+	}
+	var g group.Group
+	err = json.Unmarshal(doc.Data, &g)
+	return &g, errors.Wrap(err, "unmarshal group")
+}
+
+func (db *FireDB) List() ([]group.Group, error) {
+	docs, err := db.Collection(GroupBucket).Documents(context.Background()).GetAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "list groups")
+	}
+	groups := []group.Group{}
+	for _, snap := range docs {
+		var doc groupDoc
+		if err := snap.DataTo(&doc); err != nil {
+			return nil, errors.Wrap(err, "decode group document")
+		}
+		var g group.Group
+		if err := json.Unmarshal(doc.Data, &g); err != nil {
+			return nil, errors.Wrap(err, "unmarshal group")
+		}
+		groups = append(groups, g)
+	}
+	return groups, nil
+}
+
+func (db *FireDB) Delete(name string) error {
+	if _, err := db.GroupByName(name); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	docs, err := db.Collection(MemberBucket).Where("group", "==", name).Documents(ctx).GetAll()
+	if err != nil {
+		return errors.Wrapf(err, "get members of group %s", name)
+	}
+	for _, snap := range docs {
+		if _, err := snap.Ref.Delete(ctx); err != nil {
+			return errors.Wrapf(err, "delete member of group %s", name)
+		}
+	}
+	_, err = db.Collection(GroupBucket).Doc(keyEscaper.Replace(name)).Delete(ctx)
+	return errors.Wrapf(err, "delete group %s", name)
+}
+
+func (db *FireDB) Members(groupName string) ([]group.Member, error) {
+	docs, err := db.Collection(MemberBucket).Where("group", "==", groupName).Documents(context.Background()).GetAll()
+	if err != nil {
+		return nil, errors.Wrapf(err, "get members of group %s", groupName)
+	}
+	var members []group.Member
+	for _, snap := range docs {
+		var doc memberDoc
+		if err := snap.DataTo(&doc); err != nil {
+			return nil, errors.Wrap(err, "decode group member document")
+		}
+		var m group.Member
+		if err := json.Unmarshal(doc.Data, &m); err != nil {
+			return nil, errors.Wrap(err, "unmarshal group member")
+		}
+		members = append(members, m)
+	}
+	return members, nil
+}
+
+func (db *FireDB) Member(groupName, uuid string) (*group.Member, error) {
+	snap, err := db.Collection(MemberBucket).Doc(fireMemberKey(groupName, uuid)).Get(context.Background())
+	if status.Code(err) == codes.NotFound {
+		return nil, &notFound{"Group Member", fmt.Sprintf("uuid %s in group %s", uuid, groupName)}
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "get member %s of group %s", uuid, groupName)
+	}
+	var doc memberDoc
+	if err := snap.DataTo(&doc); err != nil {
+		return nil, errors.Wrap(err, "decode group member document")
+	}
+	var m group.Member
+	err = json.Unmarshal(doc.Data, &m)
+	return &m, errors.Wrap(err, "unmarshal group member")
+}
+
+func (db *FireDB) SaveMember(groupName string, m *group.Member) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return errors.Wrap(err, "marshal group member")
+	}
+	doc := memberDoc{Group: groupName, UUID: m.UUID, Data: data}
+	_, err = db.Collection(MemberBucket).Doc(fireMemberKey(groupName, m.UUID)).Set(context.Background(), doc)
+	return errors.Wrap(err, "put group member to firestore")
+}
+
+func (db *FireDB) DeleteMember(groupName, uuid string) error {
+	_, err := db.Collection(MemberBucket).Doc(fireMemberKey(groupName, uuid)).Delete(context.Background())
+	if status.Code(err) == codes.NotFound {
+		return nil
+	}
+	return errors.Wrapf(err, "delete member %s of group %s", uuid, groupName)
+}
+
+//////////////////////////////////////////////////////
+
+// DB stores groups in BoltDB. Members are keyed by the group name and the
+// device UUID, separated by NUL.
+type DB struct {
+	*bolt.DB
+}
+
+func NewDB(db *bolt.DB) (*DB, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists([]byte(GroupBucket)); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists([]byte(MemberBucket))
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "creating group buckets")
+	}
+	datastore := &DB{
+		DB: db,
+	}
+	return datastore, nil
+}
+
+func memberPrefix(groupName string) []byte {
+	return []byte(groupName + "\x00")
+}
+
+func memberKey(groupName, uuid string) []byte {
+	return append(memberPrefix(groupName), uuid...)
+}
+
+func (db *DB) Save(g *group.Group) error {
+	data, err := json.Marshal(g)
+	if err != nil {
+		return errors.Wrap(err, "marshal group")
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(GroupBucket)).Put([]byte(g.Name), data)
+	})
+	return errors.Wrap(err, "put group to boltdb")
+}
+
+func (db *DB) GroupByName(name string) (*group.Group, error) {
+	var g group.Group
+	err := db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket([]byte(GroupBucket)).Get([]byte(name))
+		if data == nil {
+			return &notFound{"Group", fmt.Sprintf("name %s", name)}
+		}
+		return json.Unmarshal(data, &g)
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "get group %s", name)
+	}
+	return &g, nil
+}
+
+func (db *DB) List() ([]group.Group, error) {
+	groups := []group.Group{}
+	err := db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(GroupBucket)).ForEach(func(k, v []byte) error {
+			var g group.Group
+			if err := json.Unmarshal(v, &g); err != nil {
+				return errors.Wrapf(err, "unmarshal group %s", k)
+			}
+			groups = append(groups, g)
+			return nil
+		})
+	})
+	return groups, errors.Wrap(err, "list groups")
+}
+
+func (db *DB) Delete(name string) error {
+	err := db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(GroupBucket))
+		if b.Get([]byte(name)) == nil {
+			return &notFound{"Group", fmt.Sprintf("name %s", name)}
+		}
+		if err := b.Delete([]byte(name)); err != nil {
+			return err
+		}
+		c := tx.Bucket([]byte(MemberBucket)).Cursor()
+		prefix := memberPrefix(name)
+		for k, _ := c.Seek(prefix); k != nil && strings.HasPrefix(string(k), string(prefix)); k, _ = c.Seek(prefix) {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return errors.Wrapf(err, "delete group %s", name)
+}
+
+func (db *DB) Members(groupName string) ([]group.Member, error) {
+	var members []group.Member
+	err := db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(MemberBucket)).Cursor()
+		prefix := memberPrefix(groupName)
+		for k, v := c.Seek(prefix); k != nil && strings.HasPrefix(string(k), string(prefix)); k, v = c.Next() {
+			var m group.Member
+			if err := json.Unmarshal(v, &m); err != nil {
+				return errors.Wrapf(err, "unmarshal member %s of group %s", k[len(prefix):], groupName)
+			}
+			members = append(members, m)
+		}
+		return nil
+	})
+	return members, errors.Wrapf(err, "get members of group %s", groupName)
+}
+
+func (db *DB) Member(groupName, uuid string) (*group.Member, error) {
+	var m group.Member
+	err := db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket([]byte(MemberBucket)).Get(memberKey(groupName, uuid))
+		if data == nil {
+			return &notFound{"Group Member", fmt.Sprintf("uuid %s in group %s", uuid, groupName)}
+		}
+		return json.Unmarshal(data, &m)
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "get member %s of group %s", uuid, groupName)
+	}
+	return &m, nil
+}
+
+func (db *DB) SaveMember(groupName string, m *group.Member) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return errors.Wrap(err, "marshal group member")
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(MemberBucket)).Put(memberKey(groupName, m.UUID), data)
+	})
+	return errors.Wrap(err, "put group member to boltdb")
+}
+
+func (db *DB) DeleteMember(groupName, uuid string) error {
+	err := db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(MemberBucket)).Delete(memberKey(groupName, uuid))
+	})
+	return errors.Wrapf(err, "delete member %s of group %s", uuid, groupName)
+}
+
+type notFound struct {
+	ResourceType string
+	Message      string
+}
+
+func (e *notFound) Error() string {
+	return fmt.Sprintf("not found: %s %s", e.ResourceType, e.Message)
+}
+
+func (e *notFound) NotFound() bool {
+	return true
+}
@@ -0,0 +1,128 @@
+package builtin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/group"
+	"github.com/vishnuvaradaraj/micromdm/platform/storage/sqldb"
+)
+
+// SQLDB stores groups in a SQL database.
+type SQLDB struct {
+	*sqldb.DB
+}
+
+func NewSQLDB(db *sqldb.DB) (*SQLDB, error) {
+	datastore := &SQLDB{DB: db}
+	return datastore, nil
+}
+
+func (db *SQLDB) Save(g *group.Group) error {
+	data, err := json.Marshal(g)
+	if err != nil {
+		return errors.Wrap(err, "marshal group")
+	}
+	_, err = db.Exec(db.Upsert("device_groups", "name", "name", "data"), g.Name, data)
+	return errors.Wrap(err, "put group to sql")
+}
+
+func (db *SQLDB) GroupByName(name string) (*group.Group, error) {
+	var data []byte
+	err := db.QueryRow(`SELECT data FROM device_groups WHERE name = ?`, name).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, &notFound{"Group", fmt.Sprintf("name %s", name)}
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "get group %s", name)
+	}
+	var g group.Group
+	err = json.Unmarshal(data, &g)
+	return &g, errors.Wrap(err, "unmarshal group")
+}
+
+func (db *SQLDB) List() ([]group.Group, error) {
+	rows, err := db.Query(`SELECT data FROM device_groups ORDER BY name`)
+	if err != nil {
+		return nil, errors.Wrap(err, "list groups")
+	}
+	defer rows.Close()
+	groups := []group.Group{}
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, errors.Wrap(err, "list groups")
+		}
+		var g group.Group
+		if err := json.Unmarshal(data, &g); err != nil {
+			return nil, errors.Wrap(err, "unmarshal group")
+		}
+		groups = append(groups, g)
+	}
+	return groups, errors.Wrap(rows.Err(), "list groups")
+}
+
+func (db *SQLDB) Delete(name string) error {
+	res, err := db.Exec(`DELETE FROM device_groups WHERE name = ?`, name)
+	if err != nil {
+		return errors.Wrapf(err, "delete group %s", name)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return errors.Wrapf(&notFound{"Group", fmt.Sprintf("name %s", name)}, "delete group %s", name)
+	}
+	_, err = db.Exec(`DELETE FROM device_group_members WHERE group_name = ?`, name)
+	return errors.Wrapf(err, "delete members of group %s", name)
+}
+
+func (db *SQLDB) Members(groupName string) ([]group.Member, error) {
+	rows, err := db.Query(`SELECT data FROM device_group_members WHERE group_name = ? ORDER BY device_uuid`, groupName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get members of group %s", groupName)
+	}
+	defer rows.Close()
+	var members []group.Member
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, errors.Wrapf(err, "get members of group %s", groupName)
+		}
+		var m group.Member
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, errors.Wrap(err, "unmarshal group member")
+		}
+		members = append(members, m)
+	}
+	return members, errors.Wrapf(rows.Err(), "get members of group %s", groupName)
+}
+
+func (db *SQLDB) Member(groupName, uuid string) (*group.Member, error) {
+	var data []byte
+	err := db.QueryRow(`SELECT data FROM device_group_members WHERE group_name = ? AND device_uuid = ?`, groupName, uuid).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, &notFound{"Group Member", fmt.Sprintf("uuid %s in group %s", uuid, groupName)}
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "get member %s of group %s", uuid, groupName)
+	}
+	var m group.Member
+	err = json.Unmarshal(data, &m)
+	return &m, errors.Wrap(err, "unmarshal group member")
+}
+
+func (db *SQLDB) SaveMember(groupName string, m *group.Member) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return errors.Wrap(err, "marshal group member")
+	}
+	_, err = db.Exec(db.Upsert("device_group_members", "group_name, device_uuid", "group_name", "device_uuid", "data"),
+		groupName, m.UUID, data)
+	return errors.Wrap(err, "put group member to sql")
+}
+
+func (db *SQLDB) DeleteMember(groupName, uuid string) error {
+	_, err := db.Exec(`DELETE FROM device_group_members WHERE group_name = ? AND device_uuid = ?`, groupName, uuid)
+	return errors.Wrapf(err, "delete member %s of group %s", uuid, groupName)
+}
@@ -0,0 +1,70 @@
+package group
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+
+	"github.com/vishnuvaradaraj/micromdm/pkg/httputil"
+)
+
+func (svc *GroupService) GetGroups(ctx context.Context, opt GetGroupsOption) ([]Group, error) {
+	if opt.FilterName != "" {
+		g, err := svc.store.GroupByName(opt.FilterName)
+		if err != nil {
+			return nil, err
+		}
+		return []Group{*g}, nil
+	}
+	return svc.store.List()
+}
+
+type getGroupsRequest struct {
+	Opts GetGroupsOption
+}
+
+type getGroupsResponse struct {
+	Groups []Group `json:"groups"`
+	Err    error   `json:"err,omitempty"`
+}
+
+func (r getGroupsResponse) Failed() error { return r.Err }
+
+// decodeGetGroupsRequest decodes the options from the JSON body, or the name
+// query parameter if there is no body.
+func decodeGetGroupsRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	var opts GetGroupsOption
+	if r.ContentLength == 0 {
+		opts.FilterName = r.URL.Query().Get("name")
+		return getGroupsRequest{Opts: opts}, nil
+	}
+	err := httputil.DecodeJSONRequest(r, &opts)
+	return getGroupsRequest{Opts: opts}, err
+}
+
+func decodeGetGroupsResponse(_ context.Context, r *http.Response) (interface{}, error) {
+	var resp getGroupsResponse
+	err := httputil.DecodeJSONResponse(r, &resp)
+	return resp, err
+}
+
+func MakeGetGroupsEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getGroupsRequest)
+		groups, err := svc.GetGroups(ctx, req.Opts)
+		return getGroupsResponse{
+			Groups: groups,
+			Err:    err,
+		}, nil
+	}
+}
+
+func (e Endpoints) GetGroups(ctx context.Context, opt GetGroupsOption) ([]Group, error) {
+	response, err := e.GetGroupsEndpoint(ctx, opt)
+	if err != nil {
+		return nil, err
+	}
+	resp := response.(getGroupsResponse)
+	return resp.Groups, resp.Err
+}
@@ -0,0 +1,105 @@
+// Package group manages groups of devices. Static groups list the UDIDs and
+// serial numbers of their members, dynamic groups are a query over the device
+// inventory which is evaluated again each time a device is updated.
+package group
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/device"
+)
+
+// MembershipChangedTopic is a PubSub topic that an Event is published to when
+// devices join or leave a group.
+const MembershipChangedTopic = "mdm.GroupMembershipChanged"
+
+// Group is a static or dynamic group of devices.
+type Group struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+
+	// UDIDs and Serials list the members of a static group.
+	UDIDs   []string `json:"udids,omitempty"`
+	Serials []string `json:"serials,omitempty"`
+
+	// Filter and Query define the members of a dynamic group, with the
+	// syntax of device.ListDevicesOption.
+	Filter string `json:"filter,omitempty"`
+	Query  string `json:"query,omitempty"`
+}
+
+// Dynamic reports whether the members of the group are defined by a query.
+func (g *Group) Dynamic() bool {
+	return g.Filter != "" || g.Query != ""
+}
+
+func (g *Group) Verify() error {
+	if g.Name == "" {
+		return errors.New("group must have a name")
+	}
+	if strings.ContainsRune(g.Name, 0) {
+		return errors.New("group name must not contain NUL")
+	}
+	if g.Dynamic() && (len(g.UDIDs) > 0 || len(g.Serials) > 0) {
+		return errors.New("group can not have both a query and a list of devices")
+	}
+	_, err := g.matcher()
+	return err
+}
+
+// matcher returns a function which reports whether a device is a member of
+// the group.
+func (g *Group) matcher() (func(*device.Device) bool, error) {
+	if g.Dynamic() {
+		q, err := device.NewQuery(device.ListDevicesOption{Filter: g.Filter, Query: g.Query})
+		if err != nil {
+			return nil, err
+		}
+		return q.Match, nil
+	}
+	udids := make(map[string]bool, len(g.UDIDs))
+	for _, udid := range g.UDIDs {
+		udids[udid] = true
+	}
+	serials := make(map[string]bool, len(g.Serials))
+	for _, serial := range g.Serials {
+		serials[serial] = true
+	}
+	return func(dev *device.Device) bool {
+		return (dev.UDID != "" && udids[dev.UDID]) || (dev.SerialNumber != "" && serials[dev.SerialNumber])
+	}, nil
+}
+
+// Member is a device in a group. Devices synced from DEP have no UDID until
+// they enroll.
+type Member struct {
+	UUID         string `json:"uuid"`
+	UDID         string `json:"udid,omitempty"`
+	SerialNumber string `json:"serial_number,omitempty"`
+}
+
+func memberOf(dev *device.Device) Member {
+	return Member{UUID: dev.UUID, UDID: dev.UDID, SerialNumber: dev.SerialNumber}
+}
+
+// Event lists the devices which joined or left a group.
+type Event struct {
+	Group     string    `json:"group"`
+	Added     []Member  `json:"added,omitempty"`
+	Removed   []Member  `json:"removed,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MarshalEvent serializes a membership event.
+func MarshalEvent(e *Event) ([]byte, error) {
+	return json.Marshal(e)
+}
+
+// UnmarshalEvent parses a membership event.
+func UnmarshalEvent(data []byte, e *Event) error {
+	return json.Unmarshal(data, e)
+}
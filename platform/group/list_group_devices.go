@@ -0,0 +1,90 @@
+package group
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/pkg/httputil"
+	"github.com/vishnuvaradaraj/micromdm/platform/device"
+)
+
+func (svc *GroupService) ListGroupDevices(ctx context.Context, name string, opt device.ListDevicesOption) (*device.DevicePage, error) {
+	if _, err := svc.store.GroupByName(name); err != nil {
+		return nil, err
+	}
+	members, err := svc.store.Members(name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get members of group %s", name)
+	}
+	// the devices in opt.FilterSerial which are members, or every member.
+	filter := make(map[string]bool, len(opt.FilterSerial))
+	for _, serial := range opt.FilterSerial {
+		filter[serial] = true
+	}
+	var serials []string
+	for _, m := range members {
+		if m.SerialNumber != "" && (len(filter) == 0 || filter[m.SerialNumber]) {
+			serials = append(serials, m.SerialNumber)
+		}
+	}
+	if len(serials) == 0 {
+		if _, err := device.NewQuery(opt); err != nil {
+			return nil, err
+		}
+		return &device.DevicePage{}, nil
+	}
+	opt.FilterSerial = serials
+	return svc.inventory.ListDevices(ctx, opt)
+}
+
+type listGroupDevicesRequest struct {
+	Group string                   `json:"group"`
+	Opts  device.ListDevicesOption `json:"options"`
+}
+
+type listGroupDevicesResponse struct {
+	Devices    []device.DeviceDTO `json:"devices"`
+	NextCursor string             `json:"next_cursor,omitempty"`
+	Err        error              `json:"err,omitempty"`
+}
+
+func (r listGroupDevicesResponse) Failed() error { return r.Err }
+
+func decodeListGroupDevicesRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	var req listGroupDevicesRequest
+	err := httputil.DecodeJSONRequest(r, &req)
+	return req, err
+}
+
+func decodeListGroupDevicesResponse(_ context.Context, r *http.Response) (interface{}, error) {
+	var resp listGroupDevicesResponse
+	err := httputil.DecodeJSONResponse(r, &resp)
+	return resp, err
+}
+
+func MakeListGroupDevicesEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(listGroupDevicesRequest)
+		page, err := svc.ListGroupDevices(ctx, req.Group, req.Opts)
+		if err != nil {
+			return listGroupDevicesResponse{Err: err}, nil
+		}
+		return listGroupDevicesResponse{
+			Devices:    page.Devices,
+			NextCursor: page.NextCursor,
+		}, nil
+	}
+}
+
+func (e Endpoints) ListGroupDevices(ctx context.Context, name string, opt device.ListDevicesOption) (*device.DevicePage, error) {
+	request := listGroupDevicesRequest{Group: name, Opts: opt}
+	response, err := e.ListGroupDevicesEndpoint(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	resp := response.(listGroupDevicesResponse)
+	return &device.DevicePage{Devices: resp.Devices, NextCursor: resp.NextCursor}, resp.Err
+}
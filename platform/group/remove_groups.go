@@ -0,0 +1,74 @@
+package group
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/pkg/httputil"
+)
+
+// RemoveGroups deletes groups. Their members are published as removed.
+func (svc *GroupService) RemoveGroups(ctx context.Context, names []string) error {
+	svc.mtx.Lock()
+	defer svc.mtx.Unlock()
+	for _, name := range names {
+		if _, err := svc.store.GroupByName(name); err != nil {
+			return err
+		}
+		members, err := svc.store.Members(name)
+		if err != nil {
+			return errors.Wrapf(err, "get members of group %s", name)
+		}
+		if err := svc.store.Delete(name); err != nil {
+			return err
+		}
+		if err := svc.publish(ctx, &Event{Group: name, Removed: members}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type removeGroupsRequest struct {
+	Names []string `json:"names"`
+}
+
+type removeGroupsResponse struct {
+	Err error `json:"err,omitempty"`
+}
+
+func (r removeGroupsResponse) Failed() error { return r.Err }
+
+func decodeRemoveGroupsRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	var req removeGroupsRequest
+	err := httputil.DecodeJSONRequest(r, &req)
+	return req, err
+}
+
+func decodeRemoveGroupsResponse(_ context.Context, r *http.Response) (interface{}, error) {
+	var resp removeGroupsResponse
+	err := httputil.DecodeJSONResponse(r, &resp)
+	return resp, err
+}
+
+func MakeRemoveGroupsEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(removeGroupsRequest)
+		err = svc.RemoveGroups(ctx, req.Names)
+		return removeGroupsResponse{
+			Err: err,
+		}, nil
+	}
+}
+
+func (e Endpoints) RemoveGroups(ctx context.Context, names []string) error {
+	request := removeGroupsRequest{Names: names}
+	resp, err := e.RemoveGroupsEndpoint(ctx, request)
+	if err != nil {
+		return err
+	}
+	return resp.(removeGroupsResponse).Err
+}
@@ -0,0 +1,142 @@
+package group
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/mdm/mdm"
+	"github.com/vishnuvaradaraj/micromdm/pkg/httputil"
+	"github.com/vishnuvaradaraj/micromdm/platform/command"
+)
+
+// CommandResult lists the commands queued for the members of a group.
+type CommandResult struct {
+	Commands []QueuedCommand `json:"commands"`
+	// Skipped are the members which have no UDID because they have not
+	// enrolled.
+	Skipped []Member `json:"skipped,omitempty"`
+}
+
+type QueuedCommand struct {
+	UDID        string `json:"udid"`
+	CommandUUID string `json:"command_uuid"`
+}
+
+// SendCommand queues a command for every member of a group with a UDID. The
+// UDID of req is ignored. Commands are correlated with the batch ID in ctx,
+// or "group:" and the name of the group.
+func (svc *GroupService) SendCommand(ctx context.Context, name string, req *mdm.CommandRequest) (*CommandResult, error) {
+	if req == nil || req.Command == nil || req.RequestType == "" {
+		return nil, &InvalidGroupError{Message: "request must contain a command"}
+	}
+	if _, err := svc.store.GroupByName(name); err != nil {
+		return nil, err
+	}
+	members, err := svc.store.Members(name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get members of group %s", name)
+	}
+	if _, ok := command.CorrelationFromContext(ctx); !ok {
+		ctx = command.NewContext(ctx, command.Correlation{BatchID: "group:" + name})
+	}
+
+	result := &CommandResult{Commands: []QueuedCommand{}}
+	for _, m := range members {
+		if m.UDID == "" {
+			result.Skipped = append(result.Skipped, m)
+			continue
+		}
+		payload, err := svc.commands.NewCommand(ctx, &mdm.CommandRequest{UDID: m.UDID, Command: req.Command})
+		if err != nil {
+			return result, errors.Wrapf(err, "queue command for %s", m.UDID)
+		}
+		result.Commands = append(result.Commands, QueuedCommand{UDID: m.UDID, CommandUUID: payload.CommandUUID})
+	}
+	return result, nil
+}
+
+// sendCommandRequest is a command with the group and an optional batch ID,
+// like the requests of POST /v1/commands.
+type sendCommandRequest struct {
+	Group   string
+	BatchID string
+	Command *mdm.Command
+}
+
+func (r sendCommandRequest) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(r.Command)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]interface{})
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	fields["group"] = r.Group
+	if r.BatchID != "" {
+		fields["batch_id"] = r.BatchID
+	}
+	return json.Marshal(fields)
+}
+
+func (r *sendCommandRequest) UnmarshalJSON(data []byte) error {
+	var req struct {
+		Group   string `json:"group"`
+		BatchID string `json:"batch_id"`
+	}
+	if err := json.Unmarshal(data, &req); err != nil {
+		return err
+	}
+	r.Group, r.BatchID = req.Group, req.BatchID
+	r.Command = &mdm.Command{}
+	return r.Command.UnmarshalJSON(data)
+}
+
+type sendCommandResponse struct {
+	*CommandResult
+	Err error `json:"err,omitempty"`
+}
+
+func (r sendCommandResponse) Failed() error { return r.Err }
+
+func decodeSendCommandRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	var req sendCommandRequest
+	err := httputil.DecodeJSONRequest(r, &req)
+	return req, err
+}
+
+func decodeSendCommandResponse(_ context.Context, r *http.Response) (interface{}, error) {
+	var resp sendCommandResponse
+	err := httputil.DecodeJSONResponse(r, &resp)
+	return resp, err
+}
+
+func MakeSendCommandEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(sendCommandRequest)
+		if req.BatchID != "" {
+			ctx = command.NewContext(ctx, command.Correlation{BatchID: req.BatchID})
+		}
+		result, err := svc.SendCommand(ctx, req.Group, &mdm.CommandRequest{Command: req.Command})
+		return sendCommandResponse{CommandResult: result, Err: err}, nil
+	}
+}
+
+// SendCommand queues a command for the members of a group. The batch ID of
+// ctx is sent with the request.
+func (e Endpoints) SendCommand(ctx context.Context, name string, req *mdm.CommandRequest) (*CommandResult, error) {
+	request := sendCommandRequest{Group: name, Command: req.Command}
+	if c, ok := command.CorrelationFromContext(ctx); ok {
+		request.BatchID = c.BatchID
+	}
+	response, err := e.SendCommandEndpoint(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	resp := response.(sendCommandResponse)
+	return resp.CommandResult, resp.Err
+}
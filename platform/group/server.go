@@ -0,0 +1,70 @@
+package group
+
+import (
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+
+	"github.com/vishnuvaradaraj/micromdm/pkg/httputil"
+)
+
+type Endpoints struct {
+	ApplyGroupEndpoint       endpoint.Endpoint
+	GetGroupsEndpoint        endpoint.Endpoint
+	RemoveGroupsEndpoint     endpoint.Endpoint
+	ListGroupDevicesEndpoint endpoint.Endpoint
+	SendCommandEndpoint      endpoint.Endpoint
+}
+
+func MakeServerEndpoints(s Service, outer endpoint.Middleware, others ...endpoint.Middleware) Endpoints {
+	return Endpoints{
+		ApplyGroupEndpoint:       endpoint.Chain(outer, others...)(MakeApplyGroupEndpoint(s)),
+		GetGroupsEndpoint:        endpoint.Chain(outer, others...)(MakeGetGroupsEndpoint(s)),
+		RemoveGroupsEndpoint:     endpoint.Chain(outer, others...)(MakeRemoveGroupsEndpoint(s)),
+		ListGroupDevicesEndpoint: endpoint.Chain(outer, others...)(MakeListGroupDevicesEndpoint(s)),
+		SendCommandEndpoint:      endpoint.Chain(outer, others...)(MakeSendCommandEndpoint(s)),
+	}
+}
+
+func RegisterHTTPHandlers(r *mux.Router, e Endpoints, options ...httptransport.ServerOption) {
+	// PUT     /v1/groups			create or replace a group on the server
+	// GET     /v1/groups			get a list of groups managed by the server
+	// DELETE  /v1/groups			remove one or more groups from the server
+	// POST    /v1/groups/devices		list the devices in a group
+	// POST    /v1/groups/commands		queue a command for the devices in a group
+
+	r.Methods("PUT").Path("/v1/groups").Handler(httptransport.NewServer(
+		e.ApplyGroupEndpoint,
+		decodeApplyGroupRequest,
+		httputil.EncodeJSONResponse,
+		options...,
+	))
+
+	r.Methods("GET").Path("/v1/groups").Handler(httptransport.NewServer(
+		e.GetGroupsEndpoint,
+		decodeGetGroupsRequest,
+		httputil.EncodeJSONResponse,
+		options...,
+	))
+
+	r.Methods("DELETE").Path("/v1/groups").Handler(httptransport.NewServer(
+		e.RemoveGroupsEndpoint,
+		decodeRemoveGroupsRequest,
+		httputil.EncodeJSONResponse,
+		options...,
+	))
+
+	r.Methods("POST").Path("/v1/groups/devices").Handler(httptransport.NewServer(
+		e.ListGroupDevicesEndpoint,
+		decodeListGroupDevicesRequest,
+		httputil.EncodeJSONResponse,
+		options...,
+	))
+
+	r.Methods("POST").Path("/v1/groups/commands").Handler(httptransport.NewServer(
+		e.SendCommandEndpoint,
+		decodeSendCommandRequest,
+		httputil.EncodeJSONResponse,
+		options...,
+	))
+}
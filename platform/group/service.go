@@ -0,0 +1,206 @@
+package group
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/mdm/mdm"
+	"github.com/vishnuvaradaraj/micromdm/platform/command"
+	"github.com/vishnuvaradaraj/micromdm/platform/device"
+	"github.com/vishnuvaradaraj/micromdm/platform/pubsub"
+)
+
+type GetGroupsOption struct {
+	FilterName string `json:"filter_name"`
+}
+
+type Service interface {
+	ApplyGroup(ctx context.Context, g *Group) error
+	GetGroups(ctx context.Context, opt GetGroupsOption) ([]Group, error)
+	RemoveGroups(ctx context.Context, names []string) error
+	// ListGroupDevices lists the members of a group from the device
+	// inventory. The options filter, sort and paginate the members.
+	ListGroupDevices(ctx context.Context, name string, opt device.ListDevicesOption) (*device.DevicePage, error)
+	// SendCommand queues a command for every member of a group which has
+	// enrolled.
+	SendCommand(ctx context.Context, name string, req *mdm.CommandRequest) (*CommandResult, error)
+}
+
+// Store persists groups and their members.
+type Store interface {
+	Save(*Group) error
+	GroupByName(name string) (*Group, error)
+	List() ([]Group, error)
+	// Delete deletes a group and its members.
+	Delete(name string) error
+
+	// Members returns the members of a group, by UUID.
+	Members(group string) ([]Member, error)
+	Member(group, uuid string) (*Member, error)
+	SaveMember(group string, m *Member) error
+	DeleteMember(group, uuid string) error
+}
+
+// DeviceStore is the device inventory which groups are evaluated over.
+type DeviceStore interface {
+	device.Store
+}
+
+type GroupService struct {
+	store     Store
+	devices   DeviceStore
+	inventory device.Service
+	commands  command.Service
+	publisher pubsub.Publisher
+
+	// mtx serializes membership updates, so that each change is published
+	// once.
+	mtx sync.Mutex
+}
+
+func New(store Store, devices DeviceStore, commands command.Service, pub pubsub.Publisher) *GroupService {
+	return &GroupService{
+		store:     store,
+		devices:   devices,
+		inventory: device.New(devices, pub),
+		commands:  commands,
+		publisher: pub,
+	}
+}
+
+// IsMember reports whether the device with a UDID is a member of a group.
+// The group is evaluated against the saved device, so devices are members
+// as soon as they are saved, before the Worker updates the membership.
+func (svc *GroupService) IsMember(ctx context.Context, name, udid string) (bool, error) {
+	g, err := svc.store.GroupByName(name)
+	if err != nil {
+		return false, errors.Wrapf(err, "get group %s", name)
+	}
+	match, err := g.matcher()
+	if err != nil {
+		return false, errors.Wrapf(err, "evaluate group %s", name)
+	}
+	dev, err := svc.devices.DeviceByUDID(udid)
+	if isNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrapf(err, "retrieve device with udid %s", udid)
+	}
+	return match(dev), nil
+}
+
+// evaluate updates the members of a group from the device inventory.
+func (svc *GroupService) evaluate(ctx context.Context, g *Group) error {
+	match, err := g.matcher()
+	if err != nil {
+		return errors.Wrapf(err, "evaluate group %s", g.Name)
+	}
+
+	svc.mtx.Lock()
+	defer svc.mtx.Unlock()
+	devices, err := svc.devices.List(device.ListDevicesOption{})
+	if err != nil {
+		return errors.Wrap(err, "list devices")
+	}
+	members, err := svc.store.Members(g.Name)
+	if err != nil {
+		return errors.Wrapf(err, "get members of group %s", g.Name)
+	}
+	current := make(map[string]Member, len(members))
+	for _, m := range members {
+		current[m.UUID] = m
+	}
+
+	ev := Event{Group: g.Name}
+	for i := range devices {
+		dev := &devices[i]
+		if !match(dev) {
+			continue
+		}
+		m, ok := current[dev.UUID]
+		delete(current, dev.UUID)
+		if ok && m == memberOf(dev) {
+			continue
+		}
+		m = memberOf(dev)
+		if err := svc.store.SaveMember(g.Name, &m); err != nil {
+			return errors.Wrapf(err, "add %s to group %s", dev.UUID, g.Name)
+		}
+		if !ok {
+			ev.Added = append(ev.Added, m)
+		}
+	}
+	for _, m := range current {
+		if err := svc.store.DeleteMember(g.Name, m.UUID); err != nil {
+			return errors.Wrapf(err, "remove %s from group %s", m.UUID, g.Name)
+		}
+		ev.Removed = append(ev.Removed, m)
+	}
+	return svc.publish(ctx, &ev)
+}
+
+// updateDevice updates the groups a device is a member of.
+func (svc *GroupService) updateDevice(ctx context.Context, dev *device.Device) error {
+	groups, err := svc.store.List()
+	if err != nil {
+		return errors.Wrap(err, "list groups")
+	}
+
+	svc.mtx.Lock()
+	defer svc.mtx.Unlock()
+	for i := range groups {
+		g := &groups[i]
+		match, err := g.matcher()
+		if err != nil {
+			return errors.Wrapf(err, "evaluate group %s", g.Name)
+		}
+		m, err := svc.store.Member(g.Name, dev.UUID)
+		if err != nil && !isNotFound(err) {
+			return errors.Wrapf(err, "get member %s of group %s", dev.UUID, g.Name)
+		}
+		isMember := err == nil
+		ev := Event{Group: g.Name}
+		switch {
+		case match(dev) && (!isMember || *m != memberOf(dev)):
+			added := memberOf(dev)
+			if err := svc.store.SaveMember(g.Name, &added); err != nil {
+				return errors.Wrapf(err, "add %s to group %s", dev.UUID, g.Name)
+			}
+			if !isMember {
+				ev.Added = append(ev.Added, added)
+			}
+		case !match(dev) && isMember:
+			if err := svc.store.DeleteMember(g.Name, dev.UUID); err != nil {
+				return errors.Wrapf(err, "remove %s from group %s", dev.UUID, g.Name)
+			}
+			ev.Removed = append(ev.Removed, *m)
+		}
+		if err := svc.publish(ctx, &ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// publish publishes a membership event, if devices joined or left the group.
+func (svc *GroupService) publish(ctx context.Context, ev *Event) error {
+	if len(ev.Added) == 0 && len(ev.Removed) == 0 {
+		return nil
+	}
+	ev.CreatedAt = time.Now().UTC()
+	msg, err := MarshalEvent(ev)
+	if err != nil {
+		return errors.Wrap(err, "marshal group membership event")
+	}
+	err = svc.publisher.Publish(ctx, MembershipChangedTopic, msg)
+	return errors.Wrapf(err, "publish group membership on topic: %s", MembershipChangedTopic)
+}
+
+func isNotFound(err error) bool {
+	e, ok := errors.Cause(err).(interface{ NotFound() bool })
+	return ok && e.NotFound()
+}
@@ -0,0 +1,446 @@
+package group
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/vishnuvaradaraj/micromdm/mdm/mdm"
+	"github.com/vishnuvaradaraj/micromdm/platform/command"
+	"github.com/vishnuvaradaraj/micromdm/platform/device"
+)
+
+type notFound struct{}
+
+func (notFound) Error() string  { return "not found" }
+func (notFound) NotFound() bool { return true }
+
+type memStore struct {
+	mtx     sync.Mutex
+	groups  map[string]Group
+	members map[string]map[string]Member
+}
+
+func newMemStore() *memStore {
+	return &memStore{groups: make(map[string]Group), members: make(map[string]map[string]Member)}
+}
+
+func (s *memStore) Save(g *Group) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.groups[g.Name] = *g
+	return nil
+}
+
+func (s *memStore) GroupByName(name string) (*Group, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	g, ok := s.groups[name]
+	if !ok {
+		return nil, notFound{}
+	}
+	return &g, nil
+}
+
+func (s *memStore) List() ([]Group, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	var groups []Group
+	for _, g := range s.groups {
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups, nil
+}
+
+func (s *memStore) Delete(name string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	delete(s.groups, name)
+	delete(s.members, name)
+	return nil
+}
+
+func (s *memStore) Members(group string) ([]Member, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	var members []Member
+	for _, m := range s.members[group] {
+		members = append(members, m)
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].UUID < members[j].UUID })
+	return members, nil
+}
+
+func (s *memStore) Member(group, uuid string) (*Member, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	m, ok := s.members[group][uuid]
+	if !ok {
+		return nil, notFound{}
+	}
+	return &m, nil
+}
+
+func (s *memStore) SaveMember(group string, m *Member) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.members[group] == nil {
+		s.members[group] = make(map[string]Member)
+	}
+	s.members[group][m.UUID] = *m
+	return nil
+}
+
+func (s *memStore) DeleteMember(group, uuid string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	delete(s.members[group], uuid)
+	return nil
+}
+
+type memDevices struct {
+	devices []device.Device
+}
+
+func (s *memDevices) List(opt device.ListDevicesOption) ([]device.Device, error) {
+	q, err := device.NewQuery(opt)
+	if err != nil {
+		return nil, err
+	}
+	return q.Apply(s.devices), nil
+}
+
+func (s *memDevices) DeviceByUUID(uuid string) (*device.Device, error) {
+	for _, d := range s.devices {
+		if d.UUID == uuid {
+			return &d, nil
+		}
+	}
+	return nil, notFound{}
+}
+
+func (s *memDevices) DeviceByUDID(udid string) (*device.Device, error) {
+	for _, d := range s.devices {
+		if d.UDID == udid {
+			return &d, nil
+		}
+	}
+	return nil, notFound{}
+}
+
+func (s *memDevices) DeviceBySerial(serial string) (*device.Device, error) {
+	for _, d := range s.devices {
+		if d.SerialNumber == serial {
+			return &d, nil
+		}
+	}
+	return nil, notFound{}
+}
+
+func (s *memDevices) Save(dev *device.Device) error {
+	for i, d := range s.devices {
+		if d.UUID == dev.UUID {
+			s.devices[i] = *dev
+			return nil
+		}
+	}
+	s.devices = append(s.devices, *dev)
+	return nil
+}
+
+func (s *memDevices) DeleteByUDID(string) error   { return nil }
+func (s *memDevices) DeleteBySerial(string) error { return nil }
+
+func (s *memDevices) SaveAttribute(*device.Attribute) error   { return nil }
+func (s *memDevices) Attributes() ([]device.Attribute, error) { return nil, nil }
+func (s *memDevices) DeleteAttribute(string) error            { return nil }
+
+func (s *memDevices) AddHistory(string, *device.HistoryEvent) error { return nil }
+func (s *memDevices) History(string) ([]device.HistoryEvent, error) { return nil, nil }
+func (s *memDevices) DeleteHistory(string) error                    { return nil }
+
+type recordPublisher struct {
+	events []Event
+}
+
+func (p *recordPublisher) Publish(_ context.Context, topic string, msg []byte) error {
+	var ev Event
+	if err := UnmarshalEvent(msg, &ev); err != nil {
+		return err
+	}
+	p.events = append(p.events, ev)
+	return nil
+}
+
+// last returns the UUIDs of the devices which joined and left a group in
+// the last event.
+func (p *recordPublisher) last() (added, removed string) {
+	if len(p.events) == 0 {
+		return "", ""
+	}
+	ev := p.events[len(p.events)-1]
+	return uuids(ev.Added), uuids(ev.Removed)
+}
+
+func uuids(members []Member) string {
+	var s []string
+	for _, m := range members {
+		s = append(s, m.UUID)
+	}
+	sort.Strings(s)
+	return strings.Join(s, " ")
+}
+
+type recordCommands struct {
+	requests []mdm.CommandRequest
+	batchIDs []string
+}
+
+func (c *recordCommands) NewCommand(ctx context.Context, req *mdm.CommandRequest) (*mdm.CommandPayload, error) {
+	c.requests = append(c.requests, *req)
+	corr, _ := command.CorrelationFromContext(ctx)
+	c.batchIDs = append(c.batchIDs, corr.BatchID)
+	return &mdm.CommandPayload{CommandUUID: "command-" + req.UDID}, nil
+}
+
+func testService() (*GroupService, *memDevices, *recordPublisher, *recordCommands) {
+	devices := &memDevices{devices: []device.Device{
+		{UUID: "1", UDID: "UDID-1", SerialNumber: "C02A", OSVersion: "10.14.1", Enrolled: true},
+		{UUID: "2", UDID: "UDID-2", SerialNumber: "C02B", OSVersion: "14.0", Enrolled: true},
+		{UUID: "3", SerialNumber: "C02C", DEPDevice: true},
+	}}
+	pub := &recordPublisher{}
+	commands := &recordCommands{}
+	return New(newMemStore(), devices, commands, pub), devices, pub, commands
+}
+
+func TestApplyGroup(t *testing.T) {
+	svc, _, pub, _ := testService()
+	ctx := context.Background()
+
+	tests := []struct {
+		group Group
+		want  string
+	}{
+		{Group{Name: "static", UDIDs: []string{"UDID-2"}, Serials: []string{"C02C", "C02Z"}}, "2 3"},
+		{Group{Name: "dynamic", Filter: "os_version<14 and enrolled"}, "1"},
+		{Group{Name: "dep", Filter: "dep_device"}, "3"},
+	}
+	for _, tt := range tests {
+		if err := svc.ApplyGroup(ctx, &tt.group); err != nil {
+			t.Fatal(err)
+		}
+		members, err := svc.store.Members(tt.group.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have := uuids(members); have != tt.want {
+			t.Errorf("group %s: have members %q, want %q", tt.group.Name, have, tt.want)
+		}
+		if added, _ := pub.last(); added != tt.want {
+			t.Errorf("group %s: have added %q, want %q", tt.group.Name, added, tt.want)
+		}
+	}
+
+	// changing the definition of a group publishes the changes only.
+	events := len(pub.events)
+	if err := svc.ApplyGroup(ctx, &Group{Name: "dynamic", Filter: "enrolled"}); err != nil {
+		t.Fatal(err)
+	}
+	if added, removed := pub.last(); len(pub.events) != events+1 || added != "2" || removed != "" {
+		t.Errorf("have added %q and removed %q, want 2 added", added, removed)
+	}
+	if err := svc.ApplyGroup(ctx, &Group{Name: "dynamic", Filter: "enrolled"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(pub.events) != events+1 {
+		t.Error("published an event for a group which did not change")
+	}
+
+	for _, g := range []Group{
+		{},
+		{Name: "both", Filter: "enrolled", UDIDs: []string{"UDID-1"}},
+		{Name: "bad", Filter: "color=red"},
+	} {
+		err := svc.ApplyGroup(ctx, &g)
+		if _, ok := err.(*InvalidGroupError); !ok {
+			t.Errorf("%+v: have err %v, want an InvalidGroupError", g, err)
+		}
+	}
+}
+
+func TestUpdateDevice(t *testing.T) {
+	svc, devices, pub, _ := testService()
+	ctx := context.Background()
+	if err := svc.ApplyGroup(ctx, &Group{Name: "old", Filter: "os_version<14 and enrolled"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// device 1 is updated to 14 and leaves the group.
+	dev := devices.devices[0]
+	dev.OSVersion = "14.1"
+	devices.devices[0] = dev
+	if err := svc.updateDevice(ctx, &dev); err != nil {
+		t.Fatal(err)
+	}
+	if added, removed := pub.last(); added != "" || removed != "1" {
+		t.Errorf("have added %q and removed %q, want 1 removed", added, removed)
+	}
+	if ok, err := svc.IsMember(ctx, "old", "UDID-1"); err != nil || ok {
+		t.Errorf("have member %v, err %v, want not a member", ok, err)
+	}
+
+	// device 3 enrolls with an old release and joins the group.
+	dev = devices.devices[2]
+	dev.UDID, dev.OSVersion, dev.Enrolled = "UDID-3", "12.4", true
+	devices.devices[2] = dev
+	if ok, err := svc.IsMember(ctx, "old", "UDID-3"); err != nil || !ok {
+		t.Errorf("have member %v, err %v, want a member before the update", ok, err)
+	}
+	if err := svc.updateDevice(ctx, &dev); err != nil {
+		t.Fatal(err)
+	}
+	if added, removed := pub.last(); added != "3" || removed != "" {
+		t.Errorf("have added %q and removed %q, want 3 added", added, removed)
+	}
+	m, err := svc.store.Member("old", "3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.UDID != "UDID-3" {
+		t.Errorf("have member udid %q, want UDID-3", m.UDID)
+	}
+
+	if ok, err := svc.IsMember(ctx, "old", "UDID-unknown"); err != nil || ok {
+		t.Errorf("have member %v, err %v, want an unknown device not to be a member", ok, err)
+	}
+}
+
+func TestWorkerDeviceUpdated(t *testing.T) {
+	svc, devices, pub, _ := testService()
+	ctx := context.Background()
+	if err := svc.ApplyGroup(ctx, &Group{Name: "old", Filter: "os_version<14 and enrolled"}); err != nil {
+		t.Fatal(err)
+	}
+	w := NewWorker(svc, nil, log.NewNopLogger())
+
+	// an event of device 1 from before it was updated to 14 is evaluated
+	// against the saved device, which is not in the group.
+	stale, err := device.MarshalDevice(&devices.devices[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	devices.devices[0].OSVersion = "14.1"
+	if err := w.deviceUpdated(ctx, stale); err != nil {
+		t.Fatal(err)
+	}
+	if added, removed := pub.last(); added != "" || removed != "1" {
+		t.Errorf("have added %q and removed %q, want 1 removed", added, removed)
+	}
+
+	// a device deleted since the event is left to the next evaluation.
+	gone, err := device.MarshalDevice(&device.Device{UUID: "deleted", OSVersion: "12.0", Enrolled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.deviceUpdated(ctx, gone); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.store.Member("old", "deleted"); !isNotFound(err) {
+		t.Errorf("have error %v, want the deleted device not to be a member", err)
+	}
+}
+
+func TestRemoveGroups(t *testing.T) {
+	svc, _, pub, _ := testService()
+	ctx := context.Background()
+	if err := svc.ApplyGroup(ctx, &Group{Name: "enrolled", Filter: "enrolled"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.RemoveGroups(ctx, []string{"enrolled"}); err != nil {
+		t.Fatal(err)
+	}
+	if added, removed := pub.last(); added != "" || removed != "1 2" {
+		t.Errorf("have added %q and removed %q, want 1 and 2 removed", added, removed)
+	}
+	if _, err := svc.store.GroupByName("enrolled"); !isNotFound(err) {
+		t.Errorf("have err %v, want the group to be removed", err)
+	}
+}
+
+func TestSendCommand(t *testing.T) {
+	svc, _, _, commands := testService()
+	ctx := context.Background()
+	if err := svc.ApplyGroup(ctx, &Group{Name: "all", Serials: []string{"C02A", "C02B", "C02C"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := &mdm.CommandRequest{Command: &mdm.Command{RequestType: "DeviceInformation"}}
+	result, err := svc.SendCommand(ctx, "all", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Commands) != 2 || len(commands.requests) != 2 {
+		t.Fatalf("have %d commands, want 2", len(result.Commands))
+	}
+	if have := uuids(result.Skipped); have != "3" {
+		t.Errorf("have skipped %q, want the device which is not enrolled", have)
+	}
+	for i, r := range commands.requests {
+		if r.UDID != result.Commands[i].UDID || commands.batchIDs[i] != "group:all" {
+			t.Errorf("have command for %s in batch %q", r.UDID, commands.batchIDs[i])
+		}
+	}
+
+	ctx = command.NewContext(ctx, command.Correlation{BatchID: "rollout-1"})
+	if _, err := svc.SendCommand(ctx, "all", req); err != nil {
+		t.Fatal(err)
+	}
+	if have := commands.batchIDs[len(commands.batchIDs)-1]; have != "rollout-1" {
+		t.Errorf("have batch id %q, want rollout-1", have)
+	}
+}
+
+func TestListGroupDevices(t *testing.T) {
+	svc, _, _, _ := testService()
+	ctx := context.Background()
+	if err := svc.ApplyGroup(ctx, &Group{Name: "static", Serials: []string{"C02A", "C02C"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.ApplyGroup(ctx, &Group{Name: "empty", UDIDs: []string{"UDID-unknown"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		group string
+		opt   device.ListDevicesOption
+		want  string
+	}{
+		{"static", device.ListDevicesOption{}, "C02A C02C"},
+		{"static", device.ListDevicesOption{Filter: "enrolled"}, "C02A"},
+		{"static", device.ListDevicesOption{FilterSerial: []string{"C02B", "C02C"}}, "C02C"},
+		{"empty", device.ListDevicesOption{}, ""},
+	}
+	for _, tt := range tests {
+		page, err := svc.ListGroupDevices(ctx, tt.group, tt.opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var serials []string
+		for _, d := range page.Devices {
+			serials = append(serials, d.SerialNumber)
+		}
+		if have := strings.Join(serials, " "); have != tt.want {
+			t.Errorf("%s %+v: have %q, want %q", tt.group, tt.opt, have, tt.want)
+		}
+	}
+
+	if _, err := svc.ListGroupDevices(ctx, "missing", device.ListDevicesOption{}); !isNotFound(err) {
+		t.Errorf("have err %v, want not found", err)
+	}
+}
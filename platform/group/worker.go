@@ -0,0 +1,109 @@
+package group
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/device"
+	"github.com/vishnuvaradaraj/micromdm/platform/pubsub"
+)
+
+// DefaultEvaluateInterval is how often the Worker evaluates every group
+// again, which removes devices deleted from the inventory.
+const DefaultEvaluateInterval = time.Hour
+
+// Worker updates the members of groups as devices are updated.
+type Worker struct {
+	svc        *GroupService
+	subscriber pubsub.Subscriber
+	logger     log.Logger
+	interval   time.Duration
+}
+
+type WorkerOption func(*Worker)
+
+// WithEvaluateInterval sets how often every group is evaluated.
+func WithEvaluateInterval(interval time.Duration) WorkerOption {
+	return func(w *Worker) {
+		w.interval = interval
+	}
+}
+
+func NewWorker(svc *GroupService, subscriber pubsub.Subscriber, logger log.Logger, opts ...WorkerOption) *Worker {
+	w := &Worker{
+		svc:        svc,
+		subscriber: subscriber,
+		logger:     logger,
+		interval:   DefaultEvaluateInterval,
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+// Run evaluates every group, then updates the groups of each updated device
+// until ctx is done.
+func (w *Worker) Run(ctx context.Context) error {
+	const subscription = "groups_worker"
+	updatedEvents, err := w.subscriber.Subscribe(ctx, subscription, device.DeviceUpdatedTopic)
+	if err != nil {
+		return errors.Wrapf(err, "subscribing %s to %s", subscription, device.DeviceUpdatedTopic)
+	}
+	if err := w.evaluateAll(ctx); err != nil {
+		level.Info(w.logger).Log("msg", "evaluate groups", "err", err)
+	}
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := w.evaluateAll(ctx); err != nil {
+				level.Info(w.logger).Log("msg", "evaluate groups", "err", err)
+			}
+		case ev := <-updatedEvents:
+			if err := w.deviceUpdated(ctx, ev.Message); err != nil {
+				level.Info(w.logger).Log("msg", "update device groups", "err", err)
+			}
+		}
+	}
+}
+
+// deviceUpdated updates the groups of an updated device. Events may arrive
+// out of order, so the groups are evaluated against the device as it is saved
+// now rather than as it was published. A device which was deleted since is
+// removed from its groups by the next evaluation of every group.
+func (w *Worker) deviceUpdated(ctx context.Context, message []byte) error {
+	var ev device.Device
+	if err := device.UnmarshalDevice(message, &ev); err != nil {
+		return errors.Wrap(err, "unmarshal updated device")
+	}
+	dev, err := w.svc.devices.DeviceByUUID(ev.UUID)
+	if isNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "get updated device %s", ev.UUID)
+	}
+	return errors.Wrapf(w.svc.updateDevice(ctx, dev), "update groups of device %s", dev.UUID)
+}
+
+func (w *Worker) evaluateAll(ctx context.Context) error {
+	groups, err := w.svc.store.List()
+	if err != nil {
+		return errors.Wrap(err, "list groups")
+	}
+	for i := range groups {
+		if err := w.svc.evaluate(ctx, &groups[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
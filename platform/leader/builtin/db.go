@@ -0,0 +1,102 @@
+package builtin
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const LeaseBucket = "mdm.LeaderLeases"
+
+// lease is the holder of a lease and the time it expires at.
+type lease struct {
+	Holder  string `json:"holder" firestore:"holder"`
+	Expires int64  `json:"expires" firestore:"expires"`
+}
+
+// available reports whether holder can take the lease at now.
+func (l lease) available(holder string, now time.Time) bool {
+	return l.Holder == holder || l.Expires <= now.UnixNano()
+}
+
+// FireDB stores leader leases in Google Cloud Firestore.
+type FireDB struct {
+	*firestore.Client
+}
+
+func NewFireDB(db *firestore.Client) (*FireDB, error) {
+	datastore := &FireDB{Client: db}
+	return datastore, nil
+}
+
+func (db *FireDB) AcquireLease(name, holder string, now, expires time.Time) (bool, error) {
+	var held bool
+	ref := db.Collection(LeaseBucket).Doc(name)
+	err := db.RunTransaction(context.Background(), func(ctx context.Context, tx *firestore.Transaction) error {
+		held = false
+		snap, err := tx.Get(ref)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return errors.Wrap(err, "get lease from firestore")
+		}
+		if err == nil {
+			var l lease
+			if err := snap.DataTo(&l); err != nil {
+				return errors.Wrap(err, "decode lease document")
+			}
+			if !l.available(holder, now) {
+				return nil
+			}
+		}
+		held = true
+		return tx.Set(ref, lease{Holder: holder, Expires: expires.UnixNano()})
+	})
+	return held, errors.Wrap(err, "acquire lease in firestore")
+}
+
+// DB stores leader leases in BoltDB.
+type DB struct {
+	*bolt.DB
+}
+
+func NewDB(db *bolt.DB) (*DB, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(LeaseBucket))
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "creating %s bucket", LeaseBucket)
+	}
+	datastore := &DB{
+		DB: db,
+	}
+	return datastore, nil
+}
+
+func (db *DB) AcquireLease(name, holder string, now, expires time.Time) (bool, error) {
+	var held bool
+	err := db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(LeaseBucket))
+		if v := b.Get([]byte(name)); v != nil {
+			var l lease
+			if err := json.Unmarshal(v, &l); err != nil {
+				return errors.Wrap(err, "unmarshal lease")
+			}
+			if !l.available(holder, now) {
+				return nil
+			}
+		}
+		data, err := json.Marshal(lease{Holder: holder, Expires: expires.UnixNano()})
+		if err != nil {
+			return errors.Wrap(err, "marshal lease")
+		}
+		held = true
+		return b.Put([]byte(name), data)
+	})
+	return held, errors.Wrap(err, "acquire lease in boltdb")
+}
@@ -0,0 +1,42 @@
+package builtin
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/storage/sqldb"
+)
+
+// SQLDB stores leader leases in a SQL database.
+type SQLDB struct {
+	*sqldb.DB
+}
+
+func NewSQLDB(db *sqldb.DB) (*SQLDB, error) {
+	datastore := &SQLDB{DB: db}
+	return datastore, nil
+}
+
+// AcquireLease creates the lease, or takes it over with a single conditional
+// update, so that only one of the servers racing for it gets it.
+func (db *SQLDB) AcquireLease(name, holder string, now, expires time.Time) (bool, error) {
+	res, err := db.Exec(db.InsertIfAbsent("leader_leases", "name", "name", "holder", "expires_at"),
+		name, holder, expires.UnixNano())
+	if err != nil {
+		return false, errors.Wrap(err, "create lease in sql")
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return false, errors.Wrap(err, "create lease in sql")
+	} else if n > 0 {
+		return true, nil
+	}
+	res, err = db.Exec(`UPDATE leader_leases SET holder = ?, expires_at = ?
+		WHERE name = ? AND (holder = ? OR expires_at <= ?)`,
+		holder, expires.UnixNano(), name, holder, now.UnixNano())
+	if err != nil {
+		return false, errors.Wrap(err, "update lease in sql")
+	}
+	n, err := res.RowsAffected()
+	return n > 0, errors.Wrap(err, "update lease in sql")
+}
@@ -0,0 +1,121 @@
+// Package leader elects one of the servers which share a store to run the
+// background workers which must only run once, such as the DEP sync and the
+// periodic passes over all devices.
+//
+// The elected server holds a lease in the store, which it renews well before
+// it expires. Another server takes over once the lease expires, for example
+// because the leader stopped.
+package leader
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+)
+
+// DefaultTTL is how long a lease is valid without being renewed.
+const DefaultTTL = time.Minute
+
+// Store keeps the leases.
+type Store interface {
+	// AcquireLease gives the named lease to holder until expires, unless
+	// another holder has a lease which expires after now. It reports whether
+	// holder has the lease.
+	AcquireLease(name, holder string, now, expires time.Time) (bool, error)
+}
+
+// Lease is a named lease which the server tries to hold.
+type Lease struct {
+	store  Store
+	name   string
+	holder string
+	ttl    time.Duration
+	logger log.Logger
+	now    func() time.Time
+
+	mtx     sync.RWMutex
+	expires time.Time
+}
+
+type Option func(*Lease)
+
+// WithTTL sets how long the lease is valid without being renewed. The lease
+// is renewed every third of ttl.
+func WithTTL(ttl time.Duration) Option {
+	return func(l *Lease) {
+		l.ttl = ttl
+	}
+}
+
+// New creates a lease which holder tries to acquire. holder must be unique
+// among the servers sharing the store.
+func New(store Store, name, holder string, logger log.Logger, opts ...Option) *Lease {
+	l := &Lease{
+		store:  store,
+		name:   name,
+		holder: holder,
+		ttl:    DefaultTTL,
+		logger: logger,
+		now:    time.Now,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// Held reports whether the server holds the lease. The lease is considered
+// lost a third of the ttl before it expires, so that another server which
+// takes it over never runs the workers at the same time.
+func (l *Lease) Held() bool {
+	l.mtx.RLock()
+	defer l.mtx.RUnlock()
+	return l.now().Before(l.expires.Add(-l.ttl / 3))
+}
+
+// Run renews the lease every third of the ttl until ctx is done, or acquires
+// it if another server gave it up.
+func (l *Lease) Run(ctx context.Context) error {
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := l.Acquire(); err != nil {
+				level.Info(l.logger).Log("msg", "acquire lease", "lease", l.name, "err", err)
+			}
+		}
+	}
+}
+
+// Acquire takes or renews the lease once. It is called before the workers
+// start, so that a single server does not wait for Run to get the lease.
+func (l *Lease) Acquire() error {
+	now := l.now()
+	expires := now.Add(l.ttl)
+	held, err := l.store.AcquireLease(l.name, l.holder, now, expires)
+	if err != nil {
+		return errors.Wrapf(err, "acquire lease %s", l.name)
+	}
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	was := l.now().Before(l.expires)
+	if !held {
+		if was {
+			level.Info(l.logger).Log("msg", "lost lease", "lease", l.name)
+		}
+		l.expires = time.Time{}
+		return nil
+	}
+	if !was {
+		level.Info(l.logger).Log("msg", "acquired lease", "lease", l.name, "holder", l.holder)
+	}
+	l.expires = expires
+	return nil
+}
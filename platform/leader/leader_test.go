@@ -0,0 +1,63 @@
+package leader
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+type leaseStore struct {
+	holder  string
+	expires time.Time
+}
+
+func (s *leaseStore) AcquireLease(name, holder string, now, expires time.Time) (bool, error) {
+	if s.holder != holder && now.Before(s.expires) {
+		return false, nil
+	}
+	s.holder, s.expires = holder, expires
+	return true, nil
+}
+
+func TestLease(t *testing.T) {
+	store := new(leaseStore)
+	now := time.Now()
+	clock := func() time.Time { return now }
+	first := New(store, "workers", "server-1", log.NewNopLogger(), WithTTL(time.Minute))
+	second := New(store, "workers", "server-2", log.NewNopLogger(), WithTTL(time.Minute))
+	first.now, second.now = clock, clock
+
+	if first.Held() {
+		t.Fatal("expected the lease not to be held before it is acquired")
+	}
+	for _, l := range []*Lease{first, second} {
+		if err := l.Acquire(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !first.Held() || second.Held() {
+		t.Fatalf("have held %v and %v, want only the first server to hold the lease", first.Held(), second.Held())
+	}
+
+	// the lease is given up before it expires, unless it is renewed.
+	now = now.Add(45 * time.Second)
+	if first.Held() {
+		t.Error("expected the lease to be given up before it expires")
+	}
+	if err := first.Acquire(); err != nil {
+		t.Fatal(err)
+	}
+	if !first.Held() {
+		t.Error("expected the renewed lease to be held")
+	}
+
+	// another server takes over an expired lease.
+	now = now.Add(2 * time.Minute)
+	if err := second.Acquire(); err != nil {
+		t.Fatal(err)
+	}
+	if first.Held() || !second.Held() {
+		t.Errorf("have held %v and %v, want only the second server to hold the lease", first.Held(), second.Held())
+	}
+}
@@ -0,0 +1,194 @@
+// Package nudge re-sends pushes to devices which have commands waiting but
+// have not checked in, in case the original push was lost.
+package nudge
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/device"
+	"github.com/vishnuvaradaraj/micromdm/platform/queue"
+)
+
+// Defaults for the Scheduler.
+const (
+	DefaultInterval    = 10 * time.Minute
+	DefaultMaxInterval = 4 * time.Hour
+	DefaultMaxAge      = 72 * time.Hour
+)
+
+type QueueStore interface {
+	PendingDeviceCommands() ([]queue.DeviceCommand, error)
+}
+
+type DeviceStore interface {
+	DeviceByUDID(udid string) (*device.Device, error)
+}
+
+// Pusher queues a push to a device. It is implemented by apns.PushService.
+type Pusher interface {
+	QueuePush(udid string)
+}
+
+// Scheduler periodically scans the command queue for devices with pending
+// commands and no recent activity, and pushes to them again.
+//
+// A device is idle from the later of its LastSeen time and the time its newest
+// pending command was queued. The first nudge is sent once a device has been
+// idle for the interval, and the wait between nudges doubles up to the
+// maximum interval. Devices idle for longer than the maximum age are left
+// alone until they check in or a new command is queued.
+type Scheduler struct {
+	queue   QueueStore
+	devices DeviceStore
+	pusher  Pusher
+	logger  log.Logger
+
+	interval    time.Duration
+	maxInterval time.Duration
+	maxAge      time.Duration
+	now         func() time.Time
+	leader      func() bool
+
+	mu    sync.Mutex
+	state map[string]nudgeState
+}
+
+type nudgeState struct {
+	idleSince time.Time
+	lastNudge time.Time
+	nudges    int
+}
+
+type Option func(*Scheduler)
+
+// WithSchedule sets the wait before the first nudge, the maximum wait between
+// nudges and the idle time after which nudges stop.
+func WithSchedule(interval, maxInterval, maxAge time.Duration) Option {
+	return func(s *Scheduler) {
+		s.interval = interval
+		s.maxInterval = maxInterval
+		s.maxAge = maxAge
+	}
+}
+
+// WithLeader only scans the queue while held returns true, so that a single
+// server nudges the devices of a queue shared by several servers.
+func WithLeader(held func() bool) Option {
+	return func(s *Scheduler) {
+		s.leader = held
+	}
+}
+
+func New(q QueueStore, devices DeviceStore, pusher Pusher, logger log.Logger, opts ...Option) *Scheduler {
+	s := &Scheduler{
+		queue:       q,
+		devices:     devices,
+		pusher:      pusher,
+		logger:      logger,
+		interval:    DefaultInterval,
+		maxInterval: DefaultMaxInterval,
+		maxAge:      DefaultMaxAge,
+		now:         time.Now,
+		state:       make(map[string]nudgeState),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Run scans the queue every half interval until ctx is done.
+func (s *Scheduler) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.interval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if s.leader != nil && !s.leader() {
+				continue
+			}
+			if err := s.scan(); err != nil {
+				level.Info(s.logger).Log("msg", "scan queue for nudges", "err", err)
+			}
+		}
+	}
+}
+
+func (s *Scheduler) scan() error {
+	pending, err := s.queue.PendingDeviceCommands()
+	if err != nil {
+		return errors.Wrap(err, "list pending device commands")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	seen := make(map[string]bool, len(pending))
+	for _, dc := range pending {
+		udid := dc.DeviceUDID
+		seen[udid] = true
+
+		idleSince := dc.LastQueued()
+		dev, err := s.devices.DeviceByUDID(udid)
+		if err != nil && !isNotFound(err) {
+			return errors.Wrapf(err, "retrieve device with udid %s", udid)
+		}
+		if err == nil && dev.LastSeen.After(idleSince) {
+			idleSince = dev.LastSeen
+		}
+
+		st := s.state[udid]
+		if !st.idleSince.Equal(idleSince) {
+			// the device checked in or a command was queued since the last scan.
+			st = nudgeState{idleSince: idleSince}
+		}
+		s.state[udid] = st
+
+		idle := now.Sub(idleSince)
+		if idle < s.interval || idle > s.maxAge {
+			continue
+		}
+		if !st.lastNudge.IsZero() && now.Sub(st.lastNudge) < s.backoff(st.nudges) {
+			continue
+		}
+
+		st.lastNudge = now
+		st.nudges++
+		s.state[udid] = st
+		s.pusher.QueuePush(udid)
+		level.Debug(s.logger).Log("msg", "nudged idle device", "udid", udid, "idle", idle, "nudges", st.nudges)
+	}
+
+	// forget devices which no longer have pending commands.
+	for udid := range s.state {
+		if !seen[udid] {
+			delete(s.state, udid)
+		}
+	}
+	return nil
+}
+
+// backoff returns the wait after the nth nudge.
+func (s *Scheduler) backoff(n int) time.Duration {
+	wait := s.interval
+	for i := 1; i < n && wait < s.maxInterval; i++ {
+		wait *= 2
+	}
+	if wait > s.maxInterval {
+		wait = s.maxInterval
+	}
+	return wait
+}
+
+func isNotFound(err error) bool {
+	e, ok := errors.Cause(err).(interface{ NotFound() bool })
+	return ok && e.NotFound()
+}
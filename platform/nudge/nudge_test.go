@@ -0,0 +1,116 @@
+package nudge
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/device"
+	"github.com/vishnuvaradaraj/micromdm/platform/queue"
+)
+
+type notFound struct{}
+
+func (notFound) Error() string  { return "not found" }
+func (notFound) NotFound() bool { return true }
+
+type fakeStores struct {
+	pending []queue.DeviceCommand
+	devices map[string]*device.Device
+}
+
+func (f *fakeStores) PendingDeviceCommands() ([]queue.DeviceCommand, error) {
+	return f.pending, nil
+}
+
+func (f *fakeStores) DeviceByUDID(udid string) (*device.Device, error) {
+	dev, ok := f.devices[udid]
+	if !ok {
+		return nil, notFound{}
+	}
+	return dev, nil
+}
+
+type fakePusher map[string]int
+
+func (p fakePusher) QueuePush(udid string) { p[udid]++ }
+
+func TestScan(t *testing.T) {
+	start := time.Date(2018, 9, 1, 12, 0, 0, 0, time.UTC)
+	stores := &fakeStores{
+		pending: []queue.DeviceCommand{
+			{DeviceUDID: "udid-1", Commands: []queue.Command{{UUID: "cmd-1", CreatedAt: start}}},
+		},
+		devices: map[string]*device.Device{
+			"udid-1": {UDID: "udid-1", LastSeen: start.Add(-time.Hour)},
+		},
+	}
+	pushes := fakePusher{}
+	s := New(stores, stores, pushes, log.NewNopLogger(),
+		WithSchedule(10*time.Minute, 40*time.Minute, 2*time.Hour))
+
+	// minutes after the command was queued, and the pushes expected by then.
+	steps := []struct {
+		at     time.Duration
+		pushes int
+	}{
+		{5 * time.Minute, 0},
+		{10 * time.Minute, 1}, // idle for the interval
+		{15 * time.Minute, 1},
+		{20 * time.Minute, 2}, // 10m after the first nudge
+		{35 * time.Minute, 2},
+		{40 * time.Minute, 3}, // 20m after the second
+		{75 * time.Minute, 3},
+		{80 * time.Minute, 4}, // capped at 40m
+		{120 * time.Minute, 5},
+		{165 * time.Minute, 5}, // past the maximum age
+	}
+	for _, step := range steps {
+		s.now = func() time.Time { return start.Add(step.at) }
+		if err := s.scan(); err != nil {
+			t.Fatal(err)
+		}
+		if have, want := pushes["udid-1"], step.pushes; have != want {
+			t.Errorf("at %s: have %d pushes, want %d", step.at, have, want)
+		}
+	}
+
+	// checking in restarts the schedule.
+	stores.devices["udid-1"].LastSeen = start.Add(170 * time.Minute)
+	s.now = func() time.Time { return start.Add(180 * time.Minute) }
+	if err := s.scan(); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := pushes["udid-1"], 6; have != want {
+		t.Errorf("after check in: have %d pushes, want %d", have, want)
+	}
+
+	// devices without pending commands are not nudged or tracked.
+	stores.pending = nil
+	if err := s.scan(); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(s.state), 0; have != want {
+		t.Errorf("have %d tracked devices, want %d", have, want)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	s := New(nil, nil, nil, log.NewNopLogger(), WithSchedule(time.Minute, 5*time.Minute, time.Hour))
+	tests := []struct {
+		nudges int
+		want   time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{4, 5 * time.Minute},
+		{10, 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		if have := s.backoff(tt.nudges); have != tt.want {
+			t.Errorf("backoff(%d): have %s, want %s", tt.nudges, have, tt.want)
+		}
+	}
+}
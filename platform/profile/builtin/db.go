@@ -1,14 +1,16 @@
 package builtin
 
 import (
-	"fmt"
 	"context"
-	"google.golang.org/api/iterator"
+	"fmt"
 
 	"cloud.google.com/go/firestore"
-
 	"github.com/boltdb/bolt"
 	"github.com/pkg/errors"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
 	"github.com/vishnuvaradaraj/micromdm/platform/profile"
 )
 
@@ -16,37 +18,38 @@ const (
 	ProfileBucket = "mdm.Profile"
 )
 
+// FireDB stores profiles in Google Cloud Firestore, keyed by identifier.
 type FireDB struct {
 	*firestore.Client
 }
 
+type profileDoc struct {
+	Data []byte `firestore:"data"`
+}
+
 func NewFireDB(db *firestore.Client) (*FireDB, error) {
 	datastore := &FireDB{Client: db}
 	return datastore, nil
 }
 
 func (db *FireDB) List() ([]profile.Profile, error) {
-
 	var list []profile.Profile
-
-	ctx := context.Background()
-
-	iter := db.Collection(ProfileBucket).Documents(ctx)
+	iter := db.Collection(ProfileBucket).Documents(context.Background())
+	defer iter.Stop()
 	for {
-		doc, err := iter.Next()
+		snap, err := iter.Next()
 		if err == iterator.Done {
 			break
 		}
+		if err != nil {
+			return nil, errors.Wrap(err, "list profiles from firestore")
+		}
+		p, err := profileFromSnapshot(snap)
 		if err != nil {
 			return nil, err
 		}
-
-		var p profile.Profile
-		doc.DataTo(&p)
-
-		list = append(list, p)
+		list = append(list, *p)
 	}
-
 	return list, nil
 }
 
@@ -55,48 +58,50 @@ func (db *FireDB) Save(p *profile.Profile) error {
 	if err != nil {
 		return err
 	}
-
-	ctx := context.Background()
-
-	_, err = db.Collection(ProfileBucket).Doc(p.Identifier).Set(ctx, p)
+	pproto, err := profile.MarshalProfile(p)
 	if err != nil {
-		return err
+		return errors.Wrap(err, "marshalling profile")
 	}
-
-	return nil
+	doc := profileDoc{Data: pproto}
+	_, err = db.Collection(ProfileBucket).Doc(p.Identifier).Set(context.Background(), doc)
+	return errors.Wrap(err, "put profile to firestore")
 }
 
 func (db *FireDB) ProfileById(id string) (*profile.Profile, error) {
-	var p profile.Profile
-
-	ctx := context.Background()
-
-	doc, err := db.Collection(ProfileBucket).Doc(id).Get(ctx)
-	if err != nil {
-		return nil, &notFound{"Profile","Not found"}
+	snap, err := db.Collection(ProfileBucket).Doc(id).Get(context.Background())
+	if status.Code(err) == codes.NotFound {
+		return nil, &notFound{"Profile", fmt.Sprintf("id %s", id)}
 	}
-
-	err = doc.DataTo(&p)
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrap(err, "get profile from firestore")
 	}
-
-	return &p, nil
+	return profileFromSnapshot(snap)
 }
 
 func (db *FireDB) Delete(id string) error {
-
 	ctx := context.Background()
-
-	doc, err := db.Collection(ProfileBucket).Doc(id).Get(ctx)
-	if err != nil {
-		return &notFound{"Profile","Not found"}
+	ref := db.Collection(ProfileBucket).Doc(id)
+	if _, err := ref.Get(ctx); status.Code(err) == codes.NotFound {
+		return &notFound{"Profile", fmt.Sprintf("id %s", id)}
+	} else if err != nil {
+		return errors.Wrap(err, "get profile from firestore")
 	}
-
-	_, err = doc.Ref.Delete(ctx)
+	_, err := ref.Delete(ctx)
 	return err
 }
 
+func profileFromSnapshot(snap *firestore.DocumentSnapshot) (*profile.Profile, error) {
+	var doc profileDoc
+	if err := snap.DataTo(&doc); err != nil {
+		return nil, errors.Wrap(err, "decode profile document")
+	}
+	var p profile.Profile
+	if err := profile.UnmarshalProfile(doc.Data, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
 //////////////////////////////////////////////////////////////////////////
 
 type DB struct {
@@ -168,7 +173,10 @@ func (db *DB) ProfileById(id string) (*profile.Profile, error) {
 		}
 		return profile.UnmarshalProfile(v, &p)
 	})
-	return &p, err
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
 }
 
 func (db *DB) Delete(id string) error {
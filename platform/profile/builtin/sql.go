@@ -0,0 +1,82 @@
+package builtin
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/profile"
+	"github.com/vishnuvaradaraj/micromdm/platform/storage/sqldb"
+)
+
+// SQLDB stores profiles in a SQL database, keyed by identifier.
+type SQLDB struct {
+	*sqldb.DB
+}
+
+func NewSQLDB(db *sqldb.DB) (*SQLDB, error) {
+	datastore := &SQLDB{DB: db}
+	return datastore, nil
+}
+
+func (db *SQLDB) List() ([]profile.Profile, error) {
+	rows, err := db.Query(`SELECT data FROM profiles ORDER BY id`)
+	if err != nil {
+		return nil, errors.Wrap(err, "list profiles from sql")
+	}
+	defer rows.Close()
+	var list []profile.Profile
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, errors.Wrap(err, "scan profile row")
+		}
+		var p profile.Profile
+		if err := profile.UnmarshalProfile(data, &p); err != nil {
+			return nil, err
+		}
+		list = append(list, p)
+	}
+	return list, errors.Wrap(rows.Err(), "list profiles from sql")
+}
+
+func (db *SQLDB) Save(p *profile.Profile) error {
+	err := p.Validate()
+	if err != nil {
+		return err
+	}
+	pproto, err := profile.MarshalProfile(p)
+	if err != nil {
+		return errors.Wrap(err, "marshalling profile")
+	}
+	_, err = db.Exec(db.Upsert("profiles", "id", "id", "data"), p.Identifier, pproto)
+	return errors.Wrap(err, "put profile to sql")
+}
+
+func (db *SQLDB) ProfileById(id string) (*profile.Profile, error) {
+	var data []byte
+	err := db.QueryRow(`SELECT data FROM profiles WHERE id = ?`, id).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, &notFound{"Profile", fmt.Sprintf("id %s", id)}
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "get profile from sql")
+	}
+	var p profile.Profile
+	if err := profile.UnmarshalProfile(data, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (db *SQLDB) Delete(id string) error {
+	res, err := db.Exec(`DELETE FROM profiles WHERE id = ?`, id)
+	if err != nil {
+		return errors.Wrap(err, "delete profile from sql")
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return &notFound{"Profile", fmt.Sprintf("id %s", id)}
+	}
+	return nil
+}
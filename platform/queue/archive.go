@@ -0,0 +1,161 @@
+package queue
+
+import (
+	"context"
+	"encoding/binary"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+)
+
+const ArchiveBucket = "mdm.ArchivedDeviceCommands"
+
+// ArchivedDeviceCommand is a command queue which a device left behind when it
+// re-enrolled.
+type ArchivedDeviceCommand struct {
+	ArchivedAt time.Time `json:"archived_at"`
+	DeviceCommand
+}
+
+// ArchiveStore keeps the archived command queues of each device.
+type ArchiveStore interface {
+	DeviceCommandStore
+	DeleteDeviceCommand(udid string) error
+	SaveArchivedDeviceCommand(a *ArchivedDeviceCommand) error
+	// ArchivedDeviceCommands returns the archived queues of a device, oldest
+	// first.
+	ArchivedDeviceCommands(udid string) ([]ArchivedDeviceCommand, error)
+}
+
+// ArchiveDeviceCommand moves the commands which were queued for a device
+// before t to the archive, so that its queued and NotNow commands are not sent
+// after it re-enrolls. Commands queued since t stay in the queue. A device
+// without a queue, or without commands queued before t, is left alone.
+func ArchiveDeviceCommand(db ArchiveStore, udid string, t time.Time) error {
+	dc, err := db.DeviceCommand(udid)
+	if isNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "get command queue of %s", udid)
+	}
+	old, kept := DeviceCommand{DeviceUDID: udid}, DeviceCommand{DeviceUDID: udid}
+	for _, l := range []struct {
+		cmds      []Command
+		old, kept *[]Command
+	}{
+		{dc.Commands, &old.Commands, &kept.Commands},
+		{dc.Completed, &old.Completed, &kept.Completed},
+		{dc.Failed, &old.Failed, &kept.Failed},
+		{dc.NotNow, &old.NotNow, &kept.NotNow},
+	} {
+		for _, cmd := range l.cmds {
+			if cmd.CreatedAt.Before(t) {
+				*l.old = append(*l.old, cmd)
+			} else {
+				*l.kept = append(*l.kept, cmd)
+			}
+		}
+	}
+	if old.empty() {
+		return nil
+	}
+	archived := &ArchivedDeviceCommand{ArchivedAt: time.Now().UTC(), DeviceCommand: old}
+	if err := db.SaveArchivedDeviceCommand(archived); err != nil {
+		return errors.Wrapf(err, "archive command queue of %s", udid)
+	}
+	if kept.empty() {
+		return errors.Wrapf(db.DeleteDeviceCommand(udid), "delete command queue of %s", udid)
+	}
+	return errors.Wrapf(db.Save(&kept), "save command queue of %s", udid)
+}
+
+type archiveDoc struct {
+	Time int64  `firestore:"time"`
+	Data []byte `firestore:"data"`
+}
+
+func (db *FireDB) DeleteDeviceCommand(udid string) error {
+	_, err := db.Collection(DeviceCommandBucket).Doc(udid).Delete(context.Background())
+	return errors.Wrap(err, "delete DeviceCommand from firestore")
+}
+
+func (db *FireDB) SaveArchivedDeviceCommand(a *ArchivedDeviceCommand) error {
+	pb, err := MarshalDeviceCommand(&a.DeviceCommand)
+	if err != nil {
+		return errors.Wrap(err, "marshalling DeviceCommand")
+	}
+	nanos := a.ArchivedAt.UnixNano()
+	doc := archiveDoc{Time: nanos, Data: pb}
+	_, err = db.Collection(ArchiveBucket).Doc(a.DeviceUDID).Collection("queues").
+		Doc(strconv.FormatInt(nanos, 10)).Set(context.Background(), doc)
+	return errors.Wrap(err, "put archived DeviceCommand to firestore")
+}
+
+func (db *FireDB) ArchivedDeviceCommands(udid string) ([]ArchivedDeviceCommand, error) {
+	docs, err := db.Collection(ArchiveBucket).Doc(udid).Collection("queues").
+		OrderBy("time", firestore.Asc).Documents(context.Background()).GetAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "get archived DeviceCommands from firestore")
+	}
+	archived := []ArchivedDeviceCommand{}
+	for _, snap := range docs {
+		var doc archiveDoc
+		if err := snap.DataTo(&doc); err != nil {
+			return nil, errors.Wrap(err, "decode archived DeviceCommand document")
+		}
+		a := ArchivedDeviceCommand{ArchivedAt: time.Unix(0, doc.Time).UTC()}
+		if err := UnmarshalDeviceCommand(doc.Data, &a.DeviceCommand); err != nil {
+			return nil, err
+		}
+		archived = append(archived, a)
+	}
+	return archived, nil
+}
+
+func (db *Store) DeleteDeviceCommand(udid string) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket([]byte(DeviceCommandBucket)).Delete([]byte(udid))
+		return errors.Wrap(err, "delete DeviceCommand from boltdb")
+	})
+}
+
+// SaveArchivedDeviceCommand stores the queue in a bucket per UDID, keyed by
+// the big endian archive time so the keys sort by age.
+func (db *Store) SaveArchivedDeviceCommand(a *ArchivedDeviceCommand) error {
+	pb, err := MarshalDeviceCommand(&a.DeviceCommand)
+	if err != nil {
+		return errors.Wrap(err, "marshalling DeviceCommand")
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		bkt, err := tx.Bucket([]byte(ArchiveBucket)).CreateBucketIfNotExists([]byte(a.DeviceUDID))
+		if err != nil {
+			return errors.Wrap(err, "create archived DeviceCommand bucket")
+		}
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, uint64(a.ArchivedAt.UnixNano()))
+		return errors.Wrap(bkt.Put(key, pb), "put archived DeviceCommand to boltdb")
+	})
+}
+
+func (db *Store) ArchivedDeviceCommands(udid string) ([]ArchivedDeviceCommand, error) {
+	archived := []ArchivedDeviceCommand{}
+	err := db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(ArchiveBucket)).Bucket([]byte(udid))
+		if bkt == nil {
+			return nil
+		}
+		return bkt.ForEach(func(k, v []byte) error {
+			a := ArchivedDeviceCommand{ArchivedAt: time.Unix(0, int64(binary.BigEndian.Uint64(k))).UTC()}
+			if err := UnmarshalDeviceCommand(v, &a.DeviceCommand); err != nil {
+				return err
+			}
+			archived = append(archived, a)
+			return nil
+		})
+	})
+	return archived, err
+}
@@ -33,6 +33,30 @@ type DeviceCommand struct {
 	NotNow    []Command
 }
 
+// Pending reports whether the device has commands waiting to be sent, either
+// queued or refused with NotNow.
+func (c *DeviceCommand) Pending() bool {
+	return len(c.Commands) > 0 || len(c.NotNow) > 0
+}
+
+// empty reports whether the queue has no commands at all.
+func (c *DeviceCommand) empty() bool {
+	return len(c.Commands) == 0 && len(c.Completed) == 0 && len(c.Failed) == 0 && len(c.NotNow) == 0
+}
+
+// LastQueued returns the most recent creation time of the pending commands.
+func (c *DeviceCommand) LastQueued() time.Time {
+	var last time.Time
+	for _, cmds := range [][]Command{c.Commands, c.NotNow} {
+		for _, cmd := range cmds {
+			if cmd.CreatedAt.After(last) {
+				last = cmd.CreatedAt
+			}
+		}
+	}
+	return last
+}
+
 func MarshalDeviceCommand(c *DeviceCommand) ([]byte, error) {
 	protoc := devicecommandproto.DeviceCommand{
 		DeviceUdid: c.DeviceUDID,
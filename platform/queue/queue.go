@@ -1,14 +1,18 @@
-// Package queue implements a boldDB backed queue for MDM Commands.
+// Package queue implements a BoltDB, Firestore or SQL backed queue for MDM Commands.
 package queue
 
 import (
 	"context"
 	"fmt"
+	"time"
 
+	"cloud.google.com/go/firestore"
 	"github.com/boltdb/bolt"
 	"github.com/groob/plist"
 	"github.com/pkg/errors"
-	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/vishnuvaradaraj/micromdm/mdm"
 	"github.com/vishnuvaradaraj/micromdm/platform/command"
@@ -21,201 +25,158 @@ const (
 	CommandQueuedTopic = "mdm.CommandQueued"
 )
 
-type FireDB struct {
-	*firestore.Client
+// DeviceCommandStore persists the command queue of each device.
+type DeviceCommandStore interface {
+	Save(cmd *DeviceCommand) error
+	DeviceCommand(udid string) (*DeviceCommand, error)
+	// PendingDeviceCommands returns the queues with commands which have not
+	// been completed or failed.
+	PendingDeviceCommands() ([]DeviceCommand, error)
 }
 
-func NewFireDB(db *firestore.Client) (*FireDB, error) {
-	datastore := &FireDB{Client: db}
-	return datastore, nil
+// deviceCommandUpdater is implemented by stores which can change the queue of
+// a device atomically, so that servers sharing the store don't lose commands.
+type deviceCommandUpdater interface {
+	UpdateDeviceCommand(udid string, fn func(dc *DeviceCommand) (*DeviceCommand, error)) error
 }
 
-func (db *FireDB) Next(ctx context.Context, resp mdm.Response) ([]byte, error) {
-	cmd, err := db.nextCommand(ctx, resp)
-	if err != nil {
-		return nil, err
-	}
-	if cmd == nil {
-		return nil, nil
-	}
-	return cmd.Payload, nil
-}
-
-func (db *FireDB) nextCommand(ctx context.Context, resp mdm.Response) (*Command, error) {
-	udid := resp.UDID
-	if resp.UserID != nil {
-		// use the user id for user level commands
-		udid = *resp.UserID
+// updateDeviceCommand passes the queue of a device to fn, which is nil if the
+// device has no queue, and saves the queue fn returns. Nothing is saved if fn
+// returns nil.
+func updateDeviceCommand(db DeviceCommandStore, udid string, fn func(dc *DeviceCommand) (*DeviceCommand, error)) error {
+	if u, ok := db.(deviceCommandUpdater); ok {
+		return u.UpdateDeviceCommand(udid, fn)
 	}
 	dc, err := db.DeviceCommand(udid)
+	if isNotFound(err) {
+		dc, err = nil, nil
+	}
 	if err != nil {
-		if isNotFound(err) {
-			return nil, nil
-		}
-		return nil, errors.Wrapf(err, "get device command from queue, udid: %s", resp.UDID)
+		return err
 	}
-
-	var cmd *Command
-	switch resp.Status {
-	case "NotNow":
-		// We will try this command later when the device is not
-		// responding with NotNow
-		x, a := cut(dc.Commands, resp.CommandUUID)
-		dc.Commands = a
-		if x == nil {
-			break
-		}
-		dc.NotNow = append(dc.NotNow, *x)
-
-	case "Acknowledged":
-		// move to completed, send next
-		x, a := cut(dc.Commands, resp.CommandUUID)
-		dc.Commands = a
-		if x == nil {
-			break
-		}
-		dc.Completed = append(dc.Completed, *x)
-	case "Error":
-		// move to failed, send next
-		x, a := cut(dc.Commands, resp.CommandUUID)
-		dc.Commands = a
-		if x == nil { // must've already bin ackd
-			break
-		}
-		dc.Failed = append(dc.Failed, *x)
-
-	case "CommandFormatError":
-		// move to failed
-		x, a := cut(dc.Commands, resp.CommandUUID)
-		dc.Commands = a
-		if x == nil {
-			break
-		}
-		dc.Failed = append(dc.Failed, *x)
-
-	case "Idle":
-		// will send next command below
-
-	default:
-		return nil, fmt.Errorf("unknown response status: %s", resp.Status)
+	dc, err = fn(dc)
+	if err != nil || dc == nil {
+		return err
 	}
+	return db.Save(dc)
+}
 
-	// pop the first command from the queue and add it to the end.
-	// If the regular queue is empty, send a command that got
-	// refused with NotNow before.
-	cmd, dc.Commands = popFirst(dc.Commands)
-	if cmd != nil {
-		dc.Commands = append(dc.Commands, *cmd)
-	} else if resp.Status != "NotNow" {
-		cmd, dc.NotNow = popFirst(dc.NotNow)
-		if cmd != nil {
-			dc.Commands = append(dc.Commands, *cmd)
-		}
-	}
+// FireDB is a Google Cloud Firestore backed queue.
+// DeviceCommands are keyed by UDID and stored in the same wire format as the
+// BoltDB Store.
+type FireDB struct {
+	*firestore.Client
+}
 
-	if err := db.Save(dc); err != nil {
-		return nil, err
-	}
+type deviceCommandDoc struct {
+	Data []byte `firestore:"data"`
+}
 
-	return cmd, nil
+func NewFireDB(db *firestore.Client) (*FireDB, error) {
+	datastore := &FireDB{Client: db}
+	return datastore, nil
 }
 
 func NewFireQueue(db *firestore.Client, pubsub pubsub.PublishSubscriber) (*FireDB, error) {
-
 	datastore := &FireDB{Client: db}
-	if err := datastore.pollCommands(pubsub); err != nil {
+	if err := pollCommands(datastore, pubsub); err != nil {
 		return nil, err
 	}
 	return datastore, nil
 }
 
-func (db *FireDB) Save(cmd *DeviceCommand) error {
-
-	ctx := context.Background()
-
-	_, err := db.Collection(DeviceCommandBucket).Doc(cmd.DeviceUDID).Set(ctx, cmd)
-	if err != nil {
-		return err
-	}
-
-	return nil
+func (db *FireDB) Next(ctx context.Context, resp mdm.Response) ([]byte, error) {
+	return next(ctx, db, resp)
 }
 
-func (db *FireDB) DeviceCommand(udid string) (*DeviceCommand, error) {
-
-	var dev DeviceCommand
-
-	ctx := context.Background()
-
-	doc, err := db.Collection(DeviceCommandBucket).Doc(udid).Get(ctx)
-	if err != nil {
-		return nil, &notFound{"Profile","Not found"}
-	}
-
-	err = doc.DataTo(&dev)
+func (db *FireDB) Save(cmd *DeviceCommand) error {
+	pb, err := MarshalDeviceCommand(cmd)
 	if err != nil {
-		return nil, err
+		return errors.Wrap(err, "marshalling DeviceCommand")
 	}
-
-	return &dev, nil
+	doc := deviceCommandDoc{Data: pb}
+	_, err = db.Collection(DeviceCommandBucket).Doc(cmd.DeviceUDID).Set(context.Background(), doc)
+	return errors.Wrap(err, "put DeviceCommand to firestore")
 }
 
-func (db *FireDB) pollCommands(pubsub pubsub.PublishSubscriber) error {
-	commandEvents, err := pubsub.Subscribe(context.TODO(), "command-queue", command.CommandTopic)
-	if err != nil {
-		return errors.Wrapf(err,
-			"subscribing push to %s topic", command.CommandTopic)
+func (db *FireDB) PendingDeviceCommands() ([]DeviceCommand, error) {
+	var pending []DeviceCommand
+	iter := db.Collection(DeviceCommandBucket).Documents(context.Background())
+	defer iter.Stop()
+	for {
+		snap, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "list DeviceCommands from firestore")
+		}
+		var doc deviceCommandDoc
+		if err := snap.DataTo(&doc); err != nil {
+			return nil, errors.Wrap(err, "decode DeviceCommand document")
+		}
+		var dc DeviceCommand
+		if err := UnmarshalDeviceCommand(doc.Data, &dc); err != nil {
+			return nil, err
+		}
+		if dc.Pending() {
+			pending = append(pending, dc)
+		}
 	}
-	go func() {
-		for {
-			select {
-			case event := <-commandEvents:
-				var ev command.Event
-				if err := command.UnmarshalEvent(event.Message, &ev); err != nil {
-					fmt.Println(err)
-					continue
-				}
-
-				cmd := new(DeviceCommand)
-				cmd.DeviceUDID = ev.DeviceUDID
-				byUDID, err := db.DeviceCommand(ev.DeviceUDID)
-				if err == nil && byUDID != nil {
-					cmd = byUDID
-				}
-				newPayload, err := plist.Marshal(ev.Payload)
-				if err != nil {
-					fmt.Println(errors.Wrap(err, "marshal event payload"))
-					continue
-				}
-				newCmd := Command{
-					UUID:    ev.Payload.CommandUUID,
-					Payload: newPayload,
-				}
-				cmd.Commands = append(cmd.Commands, newCmd)
-				if err := db.Save(cmd); err != nil {
-					fmt.Println(err)
-					continue
-				}
-				fmt.Printf("queued event for device: %s\n", ev.DeviceUDID)
-
-				cq := new(QueueCommandQueued)
-				cq.DeviceUDID = ev.DeviceUDID
-				cq.CommandUUID = ev.Payload.CommandUUID
-
-				msgBytes, err := MarshalQueuedCommand(cq)
-				if err != nil {
-					fmt.Println(err)
-					continue
-				}
+	return pending, nil
+}
 
-				pubsub.Publish(context.TODO(), CommandQueuedTopic, msgBytes)
+// UpdateDeviceCommand changes the queue of a device in a Firestore transaction.
+func (db *FireDB) UpdateDeviceCommand(udid string, fn func(dc *DeviceCommand) (*DeviceCommand, error)) error {
+	ref := db.Collection(DeviceCommandBucket).Doc(udid)
+	err := db.RunTransaction(context.Background(), func(ctx context.Context, tx *firestore.Transaction) error {
+		var dc *DeviceCommand
+		snap, err := tx.Get(ref)
+		switch {
+		case status.Code(err) == codes.NotFound:
+		case err != nil:
+			return errors.Wrap(err, "get DeviceCommand from firestore")
+		default:
+			var doc deviceCommandDoc
+			if err := snap.DataTo(&doc); err != nil {
+				return errors.Wrap(err, "decode DeviceCommand document")
+			}
+			dc = new(DeviceCommand)
+			if err := UnmarshalDeviceCommand(doc.Data, dc); err != nil {
+				return err
 			}
 		}
-	}()
-
-	return nil
+		dc, err = fn(dc)
+		if err != nil || dc == nil {
+			return err
+		}
+		pb, err := MarshalDeviceCommand(dc)
+		if err != nil {
+			return errors.Wrap(err, "marshalling DeviceCommand")
+		}
+		return tx.Set(ref, deviceCommandDoc{Data: pb})
+	})
+	return errors.Wrap(err, "update DeviceCommand in firestore")
 }
 
+func (db *FireDB) DeviceCommand(udid string) (*DeviceCommand, error) {
+	snap, err := db.Collection(DeviceCommandBucket).Doc(udid).Get(context.Background())
+	if status.Code(err) == codes.NotFound {
+		return nil, &notFound{"DeviceCommand", fmt.Sprintf("udid %s", udid)}
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "get DeviceCommand from firestore")
+	}
+	var doc deviceCommandDoc
+	if err := snap.DataTo(&doc); err != nil {
+		return nil, errors.Wrap(err, "decode DeviceCommand document")
+	}
+	var dc DeviceCommand
+	if err := UnmarshalDeviceCommand(doc.Data, &dc); err != nil {
+		return nil, err
+	}
+	return &dc, nil
+}
 
 //////////////////////////////////////////////////////
 
@@ -224,7 +185,11 @@ type Store struct {
 }
 
 func (db *Store) Next(ctx context.Context, resp mdm.Response) ([]byte, error) {
-	cmd, err := db.nextCommand(ctx, resp)
+	return next(ctx, db, resp)
+}
+
+func next(ctx context.Context, db DeviceCommandStore, resp mdm.Response) ([]byte, error) {
+	cmd, err := nextCommand(ctx, db, resp)
 	if err != nil {
 		return nil, err
 	}
@@ -234,82 +199,80 @@ func (db *Store) Next(ctx context.Context, resp mdm.Response) ([]byte, error) {
 	return cmd.Payload, nil
 }
 
-func (db *Store) nextCommand(ctx context.Context, resp mdm.Response) (*Command, error) {
+func nextCommand(ctx context.Context, db DeviceCommandStore, resp mdm.Response) (*Command, error) {
 	udid := resp.UDID
 	if resp.UserID != nil {
 		// use the user id for user level commands
 		udid = *resp.UserID
 	}
-	dc, err := db.DeviceCommand(udid)
-	if err != nil {
-		if isNotFound(err) {
-			return nil, nil
-		}
-		return nil, errors.Wrapf(err, "get device command from queue, udid: %s", resp.UDID)
-	}
-
 	var cmd *Command
-	switch resp.Status {
-	case "NotNow":
-		// We will try this command later when the device is not
-		// responding with NotNow
-		x, a := cut(dc.Commands, resp.CommandUUID)
-		dc.Commands = a
-		if x == nil {
-			break
+	err := updateDeviceCommand(db, udid, func(dc *DeviceCommand) (*DeviceCommand, error) {
+		cmd = nil
+		if dc == nil {
+			return nil, nil
 		}
-		dc.NotNow = append(dc.NotNow, *x)
+		switch resp.Status {
+		case "NotNow":
+			// We will try this command later when the device is not
+			// responding with NotNow
+			x, a := cut(dc.Commands, resp.CommandUUID)
+			dc.Commands = a
+			if x == nil {
+				break
+			}
+			dc.NotNow = append(dc.NotNow, *x)
+
+		case "Acknowledged":
+			// move to completed, send next
+			x, a := cut(dc.Commands, resp.CommandUUID)
+			dc.Commands = a
+			if x == nil {
+				break
+			}
+			dc.Completed = append(dc.Completed, *x)
+		case "Error":
+			// move to failed, send next
+			x, a := cut(dc.Commands, resp.CommandUUID)
+			dc.Commands = a
+			if x == nil { // must've already bin ackd
+				break
+			}
+			dc.Failed = append(dc.Failed, *x)
+
+		case "CommandFormatError":
+			// move to failed
+			x, a := cut(dc.Commands, resp.CommandUUID)
+			dc.Commands = a
+			if x == nil {
+				break
+			}
+			dc.Failed = append(dc.Failed, *x)
 
-	case "Acknowledged":
-		// move to completed, send next
-		x, a := cut(dc.Commands, resp.CommandUUID)
-		dc.Commands = a
-		if x == nil {
-			break
-		}
-		dc.Completed = append(dc.Completed, *x)
-	case "Error":
-		// move to failed, send next
-		x, a := cut(dc.Commands, resp.CommandUUID)
-		dc.Commands = a
-		if x == nil { // must've already bin ackd
-			break
-		}
-		dc.Failed = append(dc.Failed, *x)
+		case "Idle":
+			// will send next command below
 
-	case "CommandFormatError":
-		// move to failed
-		x, a := cut(dc.Commands, resp.CommandUUID)
-		dc.Commands = a
-		if x == nil {
-			break
+		default:
+			return nil, fmt.Errorf("unknown response status: %s", resp.Status)
 		}
-		dc.Failed = append(dc.Failed, *x)
-
-	case "Idle":
-		// will send next command below
-
-	default:
-		return nil, fmt.Errorf("unknown response status: %s", resp.Status)
-	}
 
-	// pop the first command from the queue and add it to the end.
-	// If the regular queue is empty, send a command that got
-	// refused with NotNow before.
-	cmd, dc.Commands = popFirst(dc.Commands)
-	if cmd != nil {
-		dc.Commands = append(dc.Commands, *cmd)
-	} else if resp.Status != "NotNow" {
-		cmd, dc.NotNow = popFirst(dc.NotNow)
+		// pop the first command from the queue and add it to the end.
+		// If the regular queue is empty, send a command that got
+		// refused with NotNow before.
+		cmd, dc.Commands = popFirst(dc.Commands)
 		if cmd != nil {
 			dc.Commands = append(dc.Commands, *cmd)
+		} else if resp.Status != "NotNow" {
+			cmd, dc.NotNow = popFirst(dc.NotNow)
+			if cmd != nil {
+				dc.Commands = append(dc.Commands, *cmd)
+			}
 		}
-	}
 
-	if err := db.Save(dc); err != nil {
-		return nil, err
+		return dc, nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "update device command queue, udid: %s", resp.UDID)
 	}
-
 	return cmd, nil
 }
 
@@ -332,16 +295,50 @@ func cut(all []Command, uuid string) (*Command, []Command) {
 	return nil, all
 }
 
+// CancelCommand removes a command which was not sent to a device yet, or
+// which the device answered with NotNow, from its queue. The command is kept
+// with the failed commands of the device, with the status Canceled. It
+// reports whether the command was still waiting to be sent.
+func CancelCommand(db DeviceCommandStore, udid, uuid string) (bool, error) {
+	var canceled bool
+	err := updateDeviceCommand(db, udid, func(dc *DeviceCommand) (*DeviceCommand, error) {
+		canceled = false
+		if dc == nil {
+			return nil, nil
+		}
+		cmd, commands := cut(dc.Commands, uuid)
+		dc.Commands = commands
+		if cmd == nil {
+			cmd, dc.NotNow = cut(dc.NotNow, uuid)
+		}
+		if cmd == nil {
+			return nil, nil
+		}
+		cmd.LastStatus = "Canceled"
+		dc.Failed = append(dc.Failed, *cmd)
+		canceled = true
+		return dc, nil
+	})
+	if err != nil {
+		return false, errors.Wrapf(err, "cancel command %s of %s", uuid, udid)
+	}
+	return canceled, nil
+}
+
 func NewQueue(db *bolt.DB, pubsub pubsub.PublishSubscriber) (*Store, error) {
 	err := db.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists([]byte(DeviceCommandBucket))
-		return err
+		for _, name := range []string{DeviceCommandBucket, ArchiveBucket} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return errors.Wrapf(err, "creating %s bucket", name)
+			}
+		}
+		return nil
 	})
 	if err != nil {
-		return nil, errors.Wrapf(err, "creating %s bucket", DeviceCommandBucket)
+		return nil, err
 	}
 	datastore := &Store{DB: db}
-	if err := datastore.pollCommands(pubsub); err != nil {
+	if err := pollCommands(datastore, pubsub); err != nil {
 		return nil, err
 	}
 	return datastore, nil
@@ -367,6 +364,29 @@ func (db *Store) Save(cmd *DeviceCommand) error {
 	return tx.Commit()
 }
 
+// UpdateDeviceCommand changes the queue of a device in a BoltDB transaction.
+func (db *Store) UpdateDeviceCommand(udid string, fn func(dc *DeviceCommand) (*DeviceCommand, error)) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(DeviceCommandBucket))
+		var dc *DeviceCommand
+		if v := bkt.Get([]byte(udid)); v != nil {
+			dc = new(DeviceCommand)
+			if err := UnmarshalDeviceCommand(v, dc); err != nil {
+				return err
+			}
+		}
+		dc, err := fn(dc)
+		if err != nil || dc == nil {
+			return err
+		}
+		devproto, err := MarshalDeviceCommand(dc)
+		if err != nil {
+			return errors.Wrap(err, "marshalling DeviceCommand")
+		}
+		return errors.Wrap(bkt.Put([]byte(udid), devproto), "put DeviceCommand to boltdb")
+	})
+}
+
 func (db *Store) DeviceCommand(udid string) (*DeviceCommand, error) {
 	var dev DeviceCommand
 	err := db.View(func(tx *bolt.Tx) error {
@@ -383,6 +403,24 @@ func (db *Store) DeviceCommand(udid string) (*DeviceCommand, error) {
 	return &dev, nil
 }
 
+func (db *Store) PendingDeviceCommands() ([]DeviceCommand, error) {
+	var pending []DeviceCommand
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(DeviceCommandBucket))
+		return b.ForEach(func(k, v []byte) error {
+			var dc DeviceCommand
+			if err := UnmarshalDeviceCommand(v, &dc); err != nil {
+				return err
+			}
+			if dc.Pending() {
+				pending = append(pending, dc)
+			}
+			return nil
+		})
+	})
+	return pending, err
+}
+
 type notFound struct {
 	ResourceType string
 	Message      string
@@ -392,7 +430,11 @@ func (e *notFound) Error() string {
 	return fmt.Sprintf("not found: %s %s", e.ResourceType, e.Message)
 }
 
-func (db *Store) pollCommands(pubsub pubsub.PublishSubscriber) error {
+func (e *notFound) NotFound() bool {
+	return true
+}
+
+func pollCommands(db DeviceCommandStore, pubsub pubsub.PublishSubscriber) error {
 	commandEvents, err := pubsub.Subscribe(context.TODO(), "command-queue", command.CommandTopic)
 	if err != nil {
 		return errors.Wrapf(err,
@@ -408,23 +450,24 @@ func (db *Store) pollCommands(pubsub pubsub.PublishSubscriber) error {
 					continue
 				}
 
-				cmd := new(DeviceCommand)
-				cmd.DeviceUDID = ev.DeviceUDID
-				byUDID, err := db.DeviceCommand(ev.DeviceUDID)
-				if err == nil && byUDID != nil {
-					cmd = byUDID
-				}
 				newPayload, err := plist.Marshal(ev.Payload)
 				if err != nil {
 					fmt.Println(errors.Wrap(err, "marshal event payload"))
 					continue
 				}
 				newCmd := Command{
-					UUID:    ev.Payload.CommandUUID,
-					Payload: newPayload,
+					UUID:      ev.Payload.CommandUUID,
+					Payload:   newPayload,
+					CreatedAt: time.Now().UTC(),
 				}
-				cmd.Commands = append(cmd.Commands, newCmd)
-				if err := db.Save(cmd); err != nil {
+				err = updateDeviceCommand(db, ev.DeviceUDID, func(cmd *DeviceCommand) (*DeviceCommand, error) {
+					if cmd == nil {
+						cmd = &DeviceCommand{DeviceUDID: ev.DeviceUDID}
+					}
+					cmd.Commands = append(cmd.Commands, newCmd)
+					return cmd, nil
+				})
+				if err != nil {
 					fmt.Println(err)
 					continue
 				}
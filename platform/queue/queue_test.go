@@ -29,7 +29,7 @@ func TestNext_Error(t *testing.T) {
 		Status:      "Error",
 	}
 	for range dc.Commands {
-		cmd, err := store.nextCommand(ctx, resp)
+		cmd, err := nextCommand(ctx, store, resp)
 		if err != nil {
 			t.Fatalf("expected nil, but got err: %s", err)
 		}
@@ -62,7 +62,7 @@ func TestNext_NotNow(t *testing.T) {
 			CommandUUID: "yCmd",
 			Status:      "NotNow",
 		}
-		cmd, err := store.nextCommand(ctx, resp)
+		cmd, err := nextCommand(ctx, store, resp)
 
 		if err != nil {
 			t.Fatalf("expected nil, but got err: %s", err)
@@ -74,7 +74,7 @@ func TestNext_NotNow(t *testing.T) {
 			Status:      "NotNow",
 		}
 
-		cmd, err = store.nextCommand(ctx, resp)
+		cmd, err = nextCommand(ctx, store, resp)
 		if err != nil {
 			t.Fatalf("expected nil, but got err: %s", err)
 		}
@@ -110,7 +110,7 @@ func TestNext_Idle(t *testing.T) {
 		Status:      "Idle",
 	}
 	for i, _ := range dc.Commands {
-		cmd, err := store.nextCommand(ctx, resp)
+		cmd, err := nextCommand(ctx, store, resp)
 		if err != nil {
 			t.Fatalf("expected nil, but got err: %s", err)
 		}
@@ -142,7 +142,7 @@ func TestNext_zeroCommands(t *testing.T) {
 	for _, s := range allStatuses {
 		t.Run(s, func(t *testing.T) {
 			resp := mdm.Response{CommandUUID: s, Status: s}
-			cmd, err := store.nextCommand(ctx, resp)
+			cmd, err := nextCommand(ctx, store, resp)
 			if err != nil {
 				t.Errorf("expected nil, but got err: %s", err)
 			}
@@ -154,6 +154,50 @@ func TestNext_zeroCommands(t *testing.T) {
 
 }
 
+func TestCancelCommand(t *testing.T) {
+	store, teardown := setupDB(t)
+	defer teardown()
+
+	dc := &DeviceCommand{DeviceUDID: "TestDevice"}
+	dc.Commands = append(dc.Commands, Command{UUID: "xCmd"})
+	dc.NotNow = append(dc.NotNow, Command{UUID: "yCmd"})
+	dc.Completed = append(dc.Completed, Command{UUID: "zCmd"})
+	if err := store.Save(dc); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		uuid     string
+		canceled bool
+	}{
+		{"xCmd", true},
+		{"yCmd", true},
+		{"zCmd", false},
+		{"xCmd", false},
+	} {
+		canceled, err := CancelCommand(store, dc.DeviceUDID, tt.uuid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if canceled != tt.canceled {
+			t.Errorf("%s: have canceled %v, want %v", tt.uuid, canceled, tt.canceled)
+		}
+	}
+	have, err := store.DeviceCommand(dc.DeviceUDID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have.Pending() {
+		t.Errorf("have pending commands %v %v, want none", have.Commands, have.NotNow)
+	}
+	if len(have.Failed) != 2 || have.Failed[0].LastStatus != "Canceled" {
+		t.Errorf("have failed commands %+v, want the canceled commands", have.Failed)
+	}
+	if canceled, err := CancelCommand(store, "OtherDevice", "xCmd"); err != nil || canceled {
+		t.Errorf("have canceled %v, err %v for a device without a queue", canceled, err)
+	}
+}
+
 func setupDB(t *testing.T) (*Store, func()) {
 	f, _ := ioutil.TempFile("", "bolt-")
 	teardown := func() {
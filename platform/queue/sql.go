@@ -0,0 +1,181 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/mdm"
+	"github.com/vishnuvaradaraj/micromdm/platform/pubsub"
+	"github.com/vishnuvaradaraj/micromdm/platform/storage/sqldb"
+)
+
+// SQLDB is a SQL backed queue. DeviceCommands are keyed by UDID and stored in
+// the same wire format as the BoltDB Store.
+type SQLDB struct {
+	*sqldb.DB
+}
+
+func NewSQLQueue(db *sqldb.DB, pubsub pubsub.PublishSubscriber) (*SQLDB, error) {
+	datastore := &SQLDB{DB: db}
+	if err := pollCommands(datastore, pubsub); err != nil {
+		return nil, err
+	}
+	return datastore, nil
+}
+
+func (db *SQLDB) Next(ctx context.Context, resp mdm.Response) ([]byte, error) {
+	return next(ctx, db, resp)
+}
+
+func (db *SQLDB) Save(cmd *DeviceCommand) error {
+	pb, err := MarshalDeviceCommand(cmd)
+	if err != nil {
+		return errors.Wrap(err, "marshalling DeviceCommand")
+	}
+	_, err = db.Exec(db.Upsert("device_commands", "udid", "udid", "data"), cmd.DeviceUDID, pb)
+	return errors.Wrap(err, "put DeviceCommand to sql")
+}
+
+// UpdateDeviceCommand changes the queue of a device in a transaction which
+// locks its row. A queue which another server creates at the same time is
+// read again.
+func (db *SQLDB) UpdateDeviceCommand(udid string, fn func(dc *DeviceCommand) (*DeviceCommand, error)) error {
+	for {
+		err := db.Update(func(tx *sqldb.Tx) error {
+			var (
+				dc   *DeviceCommand
+				data []byte
+			)
+			err := tx.QueryRow(`SELECT data FROM device_commands WHERE udid = ?`+db.Dialect.ForUpdate(), udid).Scan(&data)
+			switch {
+			case err == sql.ErrNoRows:
+			case err != nil:
+				return errors.Wrap(err, "get DeviceCommand from sql")
+			default:
+				dc = new(DeviceCommand)
+				if err := UnmarshalDeviceCommand(data, dc); err != nil {
+					return err
+				}
+			}
+			exists := dc != nil
+			dc, err = fn(dc)
+			if err != nil || dc == nil {
+				return err
+			}
+			pb, err := MarshalDeviceCommand(dc)
+			if err != nil {
+				return errors.Wrap(err, "marshalling DeviceCommand")
+			}
+			if exists {
+				_, err = tx.Exec(`UPDATE device_commands SET data = ? WHERE udid = ?`, pb, udid)
+				return errors.Wrap(err, "put DeviceCommand to sql")
+			}
+			res, err := tx.Exec(db.InsertIfAbsent("device_commands", "udid", "udid", "data"), udid, pb)
+			if err != nil {
+				return errors.Wrap(err, "put DeviceCommand to sql")
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return errors.Wrap(err, "put DeviceCommand to sql")
+			}
+			if n == 0 {
+				return errRetry
+			}
+			return nil
+		})
+		if err == errRetry {
+			continue
+		}
+		return err
+	}
+}
+
+// errRetry rolls back a transaction which has to be run again.
+var errRetry = errors.New("retry transaction")
+
+func (db *SQLDB) DeviceCommand(udid string) (*DeviceCommand, error) {
+	var data []byte
+	err := db.QueryRow(`SELECT data FROM device_commands WHERE udid = ?`, udid).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, &notFound{"DeviceCommand", fmt.Sprintf("udid %s", udid)}
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "get DeviceCommand from sql")
+	}
+	var dc DeviceCommand
+	if err := UnmarshalDeviceCommand(data, &dc); err != nil {
+		return nil, err
+	}
+	return &dc, nil
+}
+
+func (db *SQLDB) PendingDeviceCommands() ([]DeviceCommand, error) {
+	rows, err := db.Query(`SELECT data FROM device_commands`)
+	if err != nil {
+		return nil, errors.Wrap(err, "list DeviceCommands from sql")
+	}
+	defer rows.Close()
+	var pending []DeviceCommand
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, errors.Wrap(err, "scan DeviceCommand")
+		}
+		var dc DeviceCommand
+		if err := UnmarshalDeviceCommand(data, &dc); err != nil {
+			return nil, err
+		}
+		if dc.Pending() {
+			pending = append(pending, dc)
+		}
+	}
+	return pending, errors.Wrap(rows.Err(), "list DeviceCommands from sql")
+}
+
+func (db *SQLDB) DeleteDeviceCommand(udid string) error {
+	_, err := db.Exec(`DELETE FROM device_commands WHERE udid = ?`, udid)
+	return errors.Wrap(err, "delete DeviceCommand from sql")
+}
+
+func (db *SQLDB) SaveArchivedDeviceCommand(a *ArchivedDeviceCommand) error {
+	pb, err := MarshalDeviceCommand(&a.DeviceCommand)
+	if err != nil {
+		return errors.Wrap(err, "marshalling DeviceCommand")
+	}
+	// the archive time is unique per device, so the row is replaced when
+	// the archive is imported again.
+	nanos := a.ArchivedAt.UnixNano()
+	id := a.DeviceUDID + "/" + strconv.FormatInt(nanos, 10)
+	_, err = db.Exec(db.Upsert("device_command_archive", "id", "id", "udid", "archived_at", "data"),
+		id, a.DeviceUDID, nanos, pb)
+	return errors.Wrap(err, "put archived DeviceCommand to sql")
+}
+
+func (db *SQLDB) ArchivedDeviceCommands(udid string) ([]ArchivedDeviceCommand, error) {
+	rows, err := db.Query(`SELECT archived_at, data FROM device_command_archive WHERE udid = ? ORDER BY archived_at`, udid)
+	if err != nil {
+		return nil, errors.Wrap(err, "get archived DeviceCommands from sql")
+	}
+	defer rows.Close()
+	archived := []ArchivedDeviceCommand{}
+	for rows.Next() {
+		var (
+			nanos int64
+			data  []byte
+		)
+		if err := rows.Scan(&nanos, &data); err != nil {
+			return nil, errors.Wrap(err, "scan archived DeviceCommand")
+		}
+		a := ArchivedDeviceCommand{ArchivedAt: time.Unix(0, nanos).UTC()}
+		if err := UnmarshalDeviceCommand(data, &a.DeviceCommand); err != nil {
+			return nil, err
+		}
+		archived = append(archived, a)
+	}
+	return archived, errors.Wrap(rows.Err(), "list archived DeviceCommands from sql")
+}
@@ -1,67 +1,74 @@
 package builtin
 
 import (
-	"fmt"
 	"context"
+	"fmt"
 
+	"cloud.google.com/go/firestore"
 	"github.com/boltdb/bolt"
-	"github.com/vishnuvaradaraj/micromdm/platform/remove"
 	"github.com/pkg/errors"
-	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/remove"
 )
 
 const RemoveBucket = "mdm.RemoveDevice"
 
+// FireDB stores blocked devices in Google Cloud Firestore, keyed by UDID.
 type FireDB struct {
 	*firestore.Client
 }
 
+type deviceDoc struct {
+	Data []byte `firestore:"data"`
+}
+
 func NewFireDB(db *firestore.Client) (*FireDB, error) {
 	datastore := &FireDB{Client: db}
 	return datastore, nil
 }
 
 func (db *FireDB) DeviceByUDID(udid string) (*remove.Device, error) {
-	var dev remove.Device
-
-	ctx := context.Background()
-
-	doc, err := db.Collection(RemoveBucket).Doc(udid).Get(ctx)
-	if err != nil {
-		return nil, &notFound{"RemoveDevice","Not found"}
+	snap, err := db.Collection(RemoveBucket).Doc(udid).Get(context.Background())
+	if status.Code(err) == codes.NotFound {
+		err = &notFound{"Device", fmt.Sprintf("udid %s", udid)}
 	}
-
-	err = doc.DataTo(&dev)
 	if err != nil {
+		return nil, errors.Wrap(err, "remove: get device by udid")
+	}
+	var doc deviceDoc
+	if err := snap.DataTo(&doc); err != nil {
+		return nil, errors.Wrap(err, "decode remove device document")
+	}
+	var dev remove.Device
+	if err := remove.UnmarshalDevice(doc.Data, &dev); err != nil {
 		return nil, err
 	}
-
 	return &dev, nil
 }
 
 func (db *FireDB) Save(dev *remove.Device) error {
-
-	ctx := context.Background()
-
-	_, err := db.Collection(RemoveBucket).Doc(dev.UDID).Set(ctx, dev)
+	pb, err := remove.MarshalDevice(dev)
 	if err != nil {
-		return err
+		return errors.Wrap(err, "marshalling Device")
 	}
-
-	return nil
+	doc := deviceDoc{Data: pb}
+	_, err = db.Collection(RemoveBucket).Doc(dev.UDID).Set(context.Background(), doc)
+	return errors.Wrap(err, "put device to firestore")
 }
 
 func (db *FireDB) Delete(udid string) error {
-
 	ctx := context.Background()
-
-	doc, err := db.Collection(RemoveBucket).Doc(udid).Get(ctx)
-	if err != nil {
-		return &notFound{"RemoveDevice","Not found"}
+	ref := db.Collection(RemoveBucket).Doc(udid)
+	_, err := ref.Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		err = &notFound{"Device", fmt.Sprintf("udid %s", udid)}
 	}
-
-	_, err = doc.Ref.Delete(ctx)
-	return err
+	if err == nil {
+		_, err = ref.Delete(ctx)
+	}
+	return errors.Wrapf(err, "delete device with udid %s", udid)
 }
 
 //////////////////////////////////////////////////////
@@ -94,7 +101,10 @@ func (db *DB) DeviceByUDID(udid string) (*remove.Device, error) {
 		}
 		return remove.UnmarshalDevice(v, &dev)
 	})
-	return &dev, errors.Wrap(err, "remove: get device by udid")
+	if err != nil {
+		return nil, errors.Wrap(err, "remove: get device by udid")
+	}
+	return &dev, nil
 }
 
 func (db *DB) Save(dev *remove.Device) error {
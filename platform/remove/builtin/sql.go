@@ -0,0 +1,57 @@
+package builtin
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/remove"
+	"github.com/vishnuvaradaraj/micromdm/platform/storage/sqldb"
+)
+
+// SQLDB stores blocked devices in a SQL database, keyed by UDID.
+type SQLDB struct {
+	*sqldb.DB
+}
+
+func NewSQLDB(db *sqldb.DB) (*SQLDB, error) {
+	datastore := &SQLDB{DB: db}
+	return datastore, nil
+}
+
+func (db *SQLDB) DeviceByUDID(udid string) (*remove.Device, error) {
+	var data []byte
+	err := db.QueryRow(`SELECT data FROM removed_devices WHERE udid = ?`, udid).Scan(&data)
+	if err == sql.ErrNoRows {
+		err = &notFound{"Device", fmt.Sprintf("udid %s", udid)}
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "remove: get device by udid")
+	}
+	var dev remove.Device
+	if err := remove.UnmarshalDevice(data, &dev); err != nil {
+		return nil, err
+	}
+	return &dev, nil
+}
+
+func (db *SQLDB) Save(dev *remove.Device) error {
+	pb, err := remove.MarshalDevice(dev)
+	if err != nil {
+		return errors.Wrap(err, "marshalling Device")
+	}
+	_, err = db.Exec(db.Upsert("removed_devices", "udid", "udid", "data"), dev.UDID, pb)
+	return errors.Wrap(err, "put device to sql")
+}
+
+func (db *SQLDB) Delete(udid string) error {
+	res, err := db.Exec(`DELETE FROM removed_devices WHERE udid = ?`, udid)
+	if err != nil {
+		return errors.Wrap(err, "remove: delete device by udid")
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return errors.Wrap(&notFound{"Device", fmt.Sprintf("udid %s", udid)}, "remove: delete device by udid")
+	}
+	return nil
+}
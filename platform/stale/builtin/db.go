@@ -0,0 +1,112 @@
+package builtin
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+
+	"cloud.google.com/go/firestore"
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/stale"
+)
+
+const ActionBucket = "mdm.StaleDeviceActions"
+
+// FireDB stores stale device actions in Google Cloud Firestore.
+type FireDB struct {
+	*firestore.Client
+}
+
+type actionDoc struct {
+	Time int64  `firestore:"time"`
+	Data []byte `firestore:"data"`
+}
+
+func NewFireDB(db *firestore.Client) (*FireDB, error) {
+	datastore := &FireDB{Client: db}
+	return datastore, nil
+}
+
+func (db *FireDB) Save(a *stale.Action) error {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return errors.Wrap(err, "marshal stale device action")
+	}
+	doc := actionDoc{Time: a.Time.UnixNano(), Data: data}
+	_, err = db.Collection(ActionBucket).Doc(a.ID).Set(context.Background(), doc)
+	return errors.Wrap(err, "put stale device action to firestore")
+}
+
+func (db *FireDB) List() ([]stale.Action, error) {
+	docs, err := db.Collection(ActionBucket).OrderBy("time", firestore.Asc).Documents(context.Background()).GetAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "list stale device actions")
+	}
+	actions := []stale.Action{}
+	for _, snap := range docs {
+		var doc actionDoc
+		if err := snap.DataTo(&doc); err != nil {
+			return nil, errors.Wrap(err, "decode stale device action document")
+		}
+		var a stale.Action
+		if err := json.Unmarshal(doc.Data, &a); err != nil {
+			return nil, errors.Wrap(err, "unmarshal stale device action")
+		}
+		actions = append(actions, a)
+	}
+	return actions, nil
+}
+
+// DB stores stale device actions in BoltDB, keyed by the big endian action
+// time and the action ID so the keys sort by age.
+type DB struct {
+	*bolt.DB
+}
+
+func NewDB(db *bolt.DB) (*DB, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(ActionBucket))
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "creating %s bucket", ActionBucket)
+	}
+	datastore := &DB{
+		DB: db,
+	}
+	return datastore, nil
+}
+
+func actionKey(a *stale.Action) []byte {
+	key := make([]byte, 8, 8+len(a.ID))
+	binary.BigEndian.PutUint64(key, uint64(a.Time.UnixNano()))
+	return append(key, a.ID...)
+}
+
+func (db *DB) Save(a *stale.Action) error {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return errors.Wrap(err, "marshal stale device action")
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket([]byte(ActionBucket)).Put(actionKey(a), data)
+		return errors.Wrap(err, "put stale device action to boltdb")
+	})
+}
+
+func (db *DB) List() ([]stale.Action, error) {
+	actions := []stale.Action{}
+	err := db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(ActionBucket)).ForEach(func(k, v []byte) error {
+			var a stale.Action
+			if err := json.Unmarshal(v, &a); err != nil {
+				return errors.Wrap(err, "unmarshal stale device action")
+			}
+			actions = append(actions, a)
+			return nil
+		})
+	})
+	return actions, err
+}
@@ -0,0 +1,51 @@
+package builtin
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/stale"
+	"github.com/vishnuvaradaraj/micromdm/platform/storage/sqldb"
+)
+
+// SQLDB stores stale device actions in a SQL database.
+type SQLDB struct {
+	*sqldb.DB
+}
+
+func NewSQLDB(db *sqldb.DB) (*SQLDB, error) {
+	datastore := &SQLDB{DB: db}
+	return datastore, nil
+}
+
+func (db *SQLDB) Save(a *stale.Action) error {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return errors.Wrap(err, "marshal stale device action")
+	}
+	_, err = db.Exec(db.Upsert("stale_device_actions", "id", "id", "device_uuid", "created_at", "data"),
+		a.ID, a.UUID, a.Time.UnixNano(), data)
+	return errors.Wrap(err, "put stale device action to sql")
+}
+
+func (db *SQLDB) List() ([]stale.Action, error) {
+	rows, err := db.Query(`SELECT data FROM stale_device_actions ORDER BY created_at`)
+	if err != nil {
+		return nil, errors.Wrap(err, "list stale device actions")
+	}
+	defer rows.Close()
+	actions := []stale.Action{}
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, errors.Wrap(err, "scan stale device action")
+		}
+		var a stale.Action
+		if err := json.Unmarshal(data, &a); err != nil {
+			return nil, errors.Wrap(err, "unmarshal stale device action")
+		}
+		actions = append(actions, a)
+	}
+	return actions, errors.Wrap(rows.Err(), "list stale device actions")
+}
@@ -0,0 +1,33 @@
+package stale
+
+import (
+	"net/url"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	httptransport "github.com/go-kit/kit/transport/http"
+
+	"github.com/vishnuvaradaraj/micromdm/pkg/httputil"
+)
+
+func NewHTTPClient(instance, token string, logger log.Logger, opts ...httptransport.ClientOption) (Service, error) {
+	u, err := url.Parse(instance)
+	if err != nil {
+		return nil, err
+	}
+
+	var listActionsEndpoint endpoint.Endpoint
+	{
+		listActionsEndpoint = httptransport.NewClient(
+			"GET",
+			httputil.CopyURL(u, "/v1/stale/actions"),
+			httputil.EncodeRequestWithToken(token, encodeListActionsRequest),
+			decodeListActionsResponse,
+			opts...,
+		).Endpoint()
+	}
+
+	return Endpoints{
+		ListActionsEndpoint: listActionsEndpoint,
+	}, nil
+}
@@ -0,0 +1,367 @@
+package stale
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+
+	mdmsvc "github.com/vishnuvaradaraj/micromdm/mdm"
+	"github.com/vishnuvaradaraj/micromdm/mdm/mdm"
+	"github.com/vishnuvaradaraj/micromdm/platform/command"
+	"github.com/vishnuvaradaraj/micromdm/platform/device"
+	"github.com/vishnuvaradaraj/micromdm/platform/pubsub"
+)
+
+// DefaultInterval is how often the Enforcer checks the devices.
+const DefaultInterval = 6 * time.Hour
+
+type DeviceStore interface {
+	List(opt device.ListDevicesOption) ([]device.Device, error)
+}
+
+// Blocker blocks a device. It is implemented by remove.Service.
+type Blocker interface {
+	BlockDevice(ctx context.Context, udid string) error
+}
+
+// Remover removes the records of devices. It is implemented by
+// device.Service.
+type Remover interface {
+	RemoveDevices(ctx context.Context, opt device.RemoveDevicesOptions) error
+}
+
+// Enforcer periodically applies a Policy to the device inventory.
+//
+// Each action is taken once while a device is idle: the actions recorded
+// after the device was last seen are not taken again, and a device which
+// checks in again starts over. An enrolled device is probed first, and is
+// only remediated or purged once it did not answer for an interval.
+type Enforcer struct {
+	policy   Policy
+	store    Store
+	devices  DeviceStore
+	commands command.Service
+	blocker  Blocker
+	remover  Remover
+	cancel   func(udid, commandUUID string) (bool, error)
+	leader   func() bool
+	ps       pubsub.PublishSubscriber
+	logger   log.Logger
+	interval time.Duration
+	now      func() time.Time
+
+	// wipes are the WipeQueued actions by UDID, which are canceled if the
+	// device connects. Only read and changed by Run.
+	wipes map[string]Action
+}
+
+type Option func(*Enforcer)
+
+// WithInterval sets how often the devices are checked, which is also how
+// long a probed device has to answer.
+func WithInterval(interval time.Duration) Option {
+	return func(e *Enforcer) {
+		e.interval = interval
+	}
+}
+
+// WithCommandCanceler sets the function which cancels a queued EraseDevice
+// command when the device connects before it is sent. It reports whether the
+// command was still queued. Without it, queued wipes are not canceled.
+func WithCommandCanceler(cancel func(udid, commandUUID string) (bool, error)) Option {
+	return func(e *Enforcer) {
+		e.cancel = cancel
+	}
+}
+
+// WithLeader only checks the devices while held returns true, so that a single
+// server enforces the policy on an inventory shared by several servers. The
+// other servers still cancel the queued wipes of devices which connect to them.
+func WithLeader(held func() bool) Option {
+	return func(e *Enforcer) {
+		e.leader = held
+	}
+}
+
+func NewEnforcer(
+	policy Policy,
+	store Store,
+	devices DeviceStore,
+	commands command.Service,
+	blocker Blocker,
+	remover Remover,
+	ps pubsub.PublishSubscriber,
+	logger log.Logger,
+	opts ...Option,
+) *Enforcer {
+	e := &Enforcer{
+		policy:   policy,
+		store:    store,
+		devices:  devices,
+		commands: commands,
+		blocker:  blocker,
+		remover:  remover,
+		ps:       ps,
+		logger:   logger,
+		interval: DefaultInterval,
+		now:      time.Now,
+		wipes:    make(map[string]Action),
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// Run checks the devices a minute after it starts, giving the webhook worker
+// time to subscribe, and every interval after that until ctx is done. In
+// between, it cancels the queued wipes of devices which connect.
+func (e *Enforcer) Run(ctx context.Context) error {
+	const subscription = "stale_enforcer"
+	connectEvents, err := e.ps.Subscribe(ctx, subscription, mdmsvc.ConnectTopic)
+	if err != nil {
+		return errors.Wrapf(err, "subscribing %s to %s", subscription, mdmsvc.ConnectTopic)
+	}
+	if err := e.loadWipes(); err != nil {
+		level.Info(e.logger).Log("msg", "load queued wipes", "err", err)
+	}
+
+	timer := time.NewTimer(time.Minute)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ev := <-connectEvents:
+			if err := e.connected(ctx, ev.Message); err != nil {
+				level.Info(e.logger).Log("msg", "cancel queued wipe", "err", err)
+			}
+		case <-timer.C:
+			timer.Reset(e.interval)
+			if e.leader != nil && !e.leader() {
+				// pick up the wipes queued by the leader.
+				if err := e.loadWipes(); err != nil {
+					level.Info(e.logger).Log("msg", "load queued wipes", "err", err)
+				}
+				continue
+			}
+			if err := e.enforce(ctx); err != nil {
+				level.Info(e.logger).Log("msg", "enforce stale device policy", "err", err)
+			}
+		}
+	}
+}
+
+// loadWipes finds the wipes which were queued and not canceled.
+func (e *Enforcer) loadWipes() error {
+	actions, err := e.store.List()
+	if err != nil {
+		return errors.Wrap(err, "list stale device actions")
+	}
+	e.wipes = make(map[string]Action)
+	for _, a := range actions {
+		switch a.Type {
+		case WipeQueued:
+			e.wipes[a.UDID] = a
+		case WipeCanceled:
+			delete(e.wipes, a.UDID)
+		}
+	}
+	return nil
+}
+
+// connected cancels the queued wipe of a device which connected, unless the
+// device is answering the EraseDevice command itself. The device is given the
+// DeviceInformation command it was probed with first, which was queued ahead
+// of the erase, so the wipe is canceled before the erase is sent.
+func (e *Enforcer) connected(ctx context.Context, message []byte) error {
+	var ev mdmsvc.AcknowledgeEvent
+	if err := mdmsvc.UnmarshalAcknowledgeEvent(message, &ev); err != nil {
+		return errors.Wrap(err, "unmarshal acknowledge event")
+	}
+	wipe, ok := e.wipes[ev.Response.UDID]
+	if !ok || ev.Response.UserID != nil {
+		return nil
+	}
+	delete(e.wipes, wipe.UDID)
+	if e.cancel == nil || ev.Response.CommandUUID == wipe.CommandUUID {
+		return nil
+	}
+	canceled, err := e.cancel(wipe.UDID, wipe.CommandUUID)
+	if err != nil {
+		return errors.Wrapf(err, "cancel wipe of device %s", wipe.UDID)
+	}
+	if !canceled {
+		return nil
+	}
+	dev := &device.Device{UUID: wipe.UUID, UDID: wipe.UDID, SerialNumber: wipe.SerialNumber, LastSeen: wipe.LastSeen}
+	a := newAction(WipeCanceled, dev, e.now(), "device connected before the wipe was sent")
+	a.CommandUUID = wipe.CommandUUID
+	return e.record(ctx, a)
+}
+
+func (e *Enforcer) enforce(ctx context.Context) error {
+	actions, err := e.store.List()
+	if err != nil {
+		return errors.Wrap(err, "list stale device actions")
+	}
+	taken := make(map[string][]Action)
+	for _, a := range actions {
+		taken[a.UUID] = append(taken[a.UUID], a)
+	}
+	devices, err := e.devices.List(device.ListDevicesOption{})
+	if err != nil {
+		return errors.Wrap(err, "list devices")
+	}
+
+	now := e.now()
+	for i := range devices {
+		dev := &devices[i]
+		if dev.UDID == "" || dev.LastSeen.IsZero() {
+			// never checked in.
+			continue
+		}
+		idle := now.Sub(dev.LastSeen)
+		if idle < e.policy.StaleAfter {
+			continue
+		}
+		done := make(map[ActionType]Action)
+		for _, a := range taken[dev.UUID] {
+			if !a.Time.Before(dev.LastSeen) {
+				done[a.Type] = a
+			}
+		}
+		if err := e.enforceDevice(ctx, dev, idle, done, now); err != nil {
+			level.Info(e.logger).Log("msg", "enforce stale device policy", "udid", dev.UDID, "err", err)
+		}
+	}
+	return nil
+}
+
+// enforceDevice takes the actions of the policy on a stale device which have
+// not been done yet. An enrolled device is probed before it is remediated or
+// purged, and is only acted on an interval after the probe.
+func (e *Enforcer) enforceDevice(ctx context.Context, dev *device.Device, idle time.Duration, done map[ActionType]Action, now time.Time) error {
+	staleReason := reason(dev.LastSeen, now, e.policy.StaleAfter)
+	if _, ok := done[MarkedStale]; !ok {
+		if err := e.record(ctx, newAction(MarkedStale, dev, now, staleReason)); err != nil {
+			return err
+		}
+	}
+
+	var remediate bool
+	if dev.Enrolled {
+		switch e.policy.Remediation {
+		case Wipe:
+			_, ok := done[WipeQueued]
+			remediate = !ok
+		case Block:
+			_, ok := done[Blocked]
+			remediate = !ok
+		}
+	}
+	_, purged := done[Purged]
+	purge := e.policy.PurgeAfter > 0 && idle >= e.policy.PurgeAfter && !purged
+	if !remediate && !purge {
+		return nil
+	}
+
+	if dev.Enrolled {
+		probe, ok := done[Probed]
+		if !ok {
+			return e.probe(ctx, dev, now, staleReason)
+		}
+		if now.Sub(probe.Time) < e.interval {
+			// the device has until the next check to answer.
+			return nil
+		}
+	}
+
+	if remediate {
+		switch e.policy.Remediation {
+		case Wipe:
+			payload, err := e.commands.NewCommand(ctx, &mdm.CommandRequest{
+				UDID:    dev.UDID,
+				Command: &mdm.Command{RequestType: "EraseDevice", EraseDevice: &mdm.EraseDevice{}},
+			})
+			if err != nil {
+				return errors.Wrapf(err, "queue wipe of stale device %s", dev.UDID)
+			}
+			a := newAction(WipeQueued, dev, now, staleReason)
+			a.CommandUUID = payload.CommandUUID
+			if err := e.record(ctx, a); err != nil {
+				return err
+			}
+			e.wipes[a.UDID] = *a
+		case Block:
+			if err := e.blocker.BlockDevice(ctx, dev.UDID); err != nil {
+				return errors.Wrapf(err, "block stale device %s", dev.UDID)
+			}
+			if err := e.record(ctx, newAction(Blocked, dev, now, staleReason)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if purge {
+		err := e.remover.RemoveDevices(ctx, device.RemoveDevicesOptions{UDIDs: []string{dev.UDID}})
+		if err != nil {
+			return errors.Wrapf(err, "purge stale device %s", dev.UDID)
+		}
+		return e.record(ctx, newAction(Purged, dev, now, reason(dev.LastSeen, now, e.policy.PurgeAfter)))
+	}
+	return nil
+}
+
+// probe queues a DeviceInformation command for a stale device, which pushes
+// it to check in. A device which answers is seen again and starts over.
+func (e *Enforcer) probe(ctx context.Context, dev *device.Device, now time.Time, reason string) error {
+	payload, err := e.commands.NewCommand(ctx, &mdm.CommandRequest{
+		UDID: dev.UDID,
+		Command: &mdm.Command{
+			RequestType:       "DeviceInformation",
+			DeviceInformation: &mdm.DeviceInformation{Queries: []string{"UDID"}},
+		},
+	})
+	if err != nil {
+		return errors.Wrapf(err, "probe stale device %s", dev.UDID)
+	}
+	a := newAction(Probed, dev, now, reason)
+	a.CommandUUID = payload.CommandUUID
+	return e.record(ctx, a)
+}
+
+// record saves an action, and publishes it to ActionTopic and to the history
+// of the device. The history of a purged device is removed with it, so the
+// saved action is the only record of the purge.
+func (e *Enforcer) record(ctx context.Context, a *Action) error {
+	if err := e.store.Save(a); err != nil {
+		return errors.Wrapf(err, "save %s action for device %s", a.Type, a.UDID)
+	}
+	level.Info(e.logger).Log("msg", "stale device policy", "action", a.Type, "udid", a.UDID, "serial", a.SerialNumber, "reason", a.Reason)
+
+	msg, err := MarshalAction(a)
+	if err != nil {
+		return errors.Wrap(err, "marshal stale device action")
+	}
+	if err := e.ps.Publish(ctx, ActionTopic, msg); err != nil {
+		return errors.Wrapf(err, "publish stale device action on topic: %s", ActionTopic)
+	}
+	if a.Type == Purged {
+		return nil
+	}
+
+	details := map[string]string{"action": string(a.Type), "reason": a.Reason}
+	if a.CommandUUID != "" {
+		details["command_uuid"] = a.CommandUUID
+	}
+	msg, err = device.MarshalHistoryEvent(device.NewHistoryEvent(device.StaleAction, a.UDID, details))
+	if err != nil {
+		return errors.Wrap(err, "marshal stale device history event")
+	}
+	err = e.ps.Publish(ctx, device.HistoryTopic, msg)
+	return errors.Wrapf(err, "publish stale device history event on topic: %s", device.HistoryTopic)
+}
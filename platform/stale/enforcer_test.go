@@ -0,0 +1,264 @@
+package stale
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	mdmsvc "github.com/vishnuvaradaraj/micromdm/mdm"
+	"github.com/vishnuvaradaraj/micromdm/mdm/mdm"
+	"github.com/vishnuvaradaraj/micromdm/platform/device"
+	"github.com/vishnuvaradaraj/micromdm/platform/pubsub"
+)
+
+type memStore struct{ actions []Action }
+
+func (s *memStore) Save(a *Action) error {
+	s.actions = append(s.actions, *a)
+	return nil
+}
+
+func (s *memStore) List() ([]Action, error) {
+	return append([]Action(nil), s.actions...), nil
+}
+
+// fakeDevices is the device inventory, the command queue and the remove
+// service of a test.
+type fakeDevices struct {
+	devices []device.Device
+	probes  []string
+	wipes   []string
+	blocks  []string
+}
+
+func (f *fakeDevices) List(device.ListDevicesOption) ([]device.Device, error) {
+	return append([]device.Device(nil), f.devices...), nil
+}
+
+func (f *fakeDevices) NewCommand(_ context.Context, req *mdm.CommandRequest) (*mdm.CommandPayload, error) {
+	if req.Command.RequestType == "DeviceInformation" {
+		f.probes = append(f.probes, req.UDID)
+		return &mdm.CommandPayload{CommandUUID: "probe-" + req.UDID}, nil
+	}
+	f.wipes = append(f.wipes, req.UDID)
+	return &mdm.CommandPayload{CommandUUID: "wipe-" + req.UDID}, nil
+}
+
+func (f *fakeDevices) BlockDevice(_ context.Context, udid string) error {
+	f.blocks = append(f.blocks, udid)
+	return nil
+}
+
+func (f *fakeDevices) RemoveDevices(_ context.Context, opt device.RemoveDevicesOptions) error {
+	kept := f.devices[:0]
+	for _, dev := range f.devices {
+		if dev.UDID != opt.UDIDs[0] {
+			kept = append(kept, dev)
+		}
+	}
+	f.devices = kept
+	return nil
+}
+
+type topicPublisher map[string]int
+
+func (p topicPublisher) Publish(_ context.Context, topic string, _ []byte) error {
+	p[topic]++
+	return nil
+}
+
+func (p topicPublisher) Subscribe(context.Context, string, string) (<-chan pubsub.Event, error) {
+	return make(chan pubsub.Event), nil
+}
+
+func actionTypes(actions []Action, udid string) []ActionType {
+	var types []ActionType
+	for _, a := range actions {
+		if a.UDID == udid {
+			types = append(types, a.Type)
+		}
+	}
+	return types
+}
+
+func TestEnforce(t *testing.T) {
+	now := time.Date(2018, 9, 1, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	devices := &fakeDevices{devices: []device.Device{
+		{UUID: "uuid-active", UDID: "active", Enrolled: true, LastSeen: now.Add(-day)},
+		{UUID: "uuid-idle", UDID: "idle", Enrolled: true, LastSeen: now.Add(-40 * day)},
+		{UUID: "uuid-checked-out", UDID: "checked-out", LastSeen: now.Add(-40 * day)},
+		{UUID: "uuid-lost", UDID: "lost", SerialNumber: "C02LOST", Enrolled: true, LastSeen: now.Add(-100 * day)},
+		{UUID: "uuid-dep", SerialNumber: "C02DEP", DEPDevice: true},
+	}}
+	store := &memStore{}
+	pub := topicPublisher{}
+	policy := Policy{StaleAfter: 30 * day, Remediation: Wipe, PurgeAfter: 90 * day, AllowWipe: true}
+	if err := policy.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	e := NewEnforcer(policy, store, devices, devices, devices, devices, pub, log.NewNopLogger())
+	e.now = func() time.Time { return now }
+
+	// actions are only taken once while a device is idle, and enrolled
+	// devices are probed an interval before they are wiped or purged.
+	enforce := func() {
+		for i := 0; i < 2; i++ {
+			if err := e.enforce(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	enforce()
+	if have, want := len(devices.probes), 2; have != want {
+		t.Errorf("have %d probes queued, want %d", have, want)
+	}
+	if len(devices.wipes) != 0 || len(devices.devices) != 5 {
+		t.Errorf("have wipes %v and %d devices, want nothing done before the probe is answered", devices.wipes, len(devices.devices))
+	}
+	now = now.Add(e.interval)
+	enforce()
+
+	tests := []struct {
+		udid string
+		want []ActionType
+	}{
+		{"active", nil},
+		{"idle", []ActionType{MarkedStale, Probed, WipeQueued}},
+		{"checked-out", []ActionType{MarkedStale}},
+		{"lost", []ActionType{MarkedStale, Probed, WipeQueued, Purged}},
+	}
+	for _, tt := range tests {
+		have := actionTypes(store.actions, tt.udid)
+		if len(have) != len(tt.want) {
+			t.Errorf("%s: have actions %v, want %v", tt.udid, have, tt.want)
+			continue
+		}
+		for i := range tt.want {
+			if have[i] != tt.want[i] {
+				t.Errorf("%s: have actions %v, want %v", tt.udid, have, tt.want)
+			}
+		}
+	}
+	if have, want := len(devices.wipes), 2; have != want {
+		t.Errorf("have %d wipes queued, want %d", have, want)
+	}
+	if have, want := len(devices.devices), 4; have != want {
+		t.Errorf("have %d devices, want %d after the purge", have, want)
+	}
+	for _, a := range store.actions {
+		if a.Type == Purged && (a.SerialNumber != "C02LOST" || a.Reason == "") {
+			t.Errorf("have purge %+v, want the serial number and the reason", a)
+		}
+		if a.Type == WipeQueued && a.CommandUUID != "wipe-"+a.UDID {
+			t.Errorf("have wipe %+v, want the command UUID", a)
+		}
+		if a.Type == Probed && a.CommandUUID != "probe-"+a.UDID {
+			t.Errorf("have probe %+v, want the command UUID", a)
+		}
+	}
+	if have, want := pub[ActionTopic], len(store.actions); have != want {
+		t.Errorf("have %d published actions, want %d", have, want)
+	}
+	// the history of a purged device is removed with it.
+	if have, want := pub[device.HistoryTopic], len(store.actions)-1; have != want {
+		t.Errorf("have %d history events, want %d", have, want)
+	}
+
+	// a device which checks in again is marked stale again once it is idle.
+	devices.devices[1].LastSeen = now.Add(time.Hour)
+	now = now.Add(31 * day)
+	enforce()
+	now = now.Add(e.interval)
+	enforce()
+	have := actionTypes(store.actions, "idle")
+	want := []ActionType{MarkedStale, Probed, WipeQueued, MarkedStale, Probed, WipeQueued}
+	if len(have) != len(want) || have[3] != MarkedStale || have[4] != Probed || have[5] != WipeQueued {
+		t.Errorf("have actions %v, want %v", have, want)
+	}
+}
+
+func TestEnforceCancelWipe(t *testing.T) {
+	now := time.Date(2018, 9, 1, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	devices := &fakeDevices{devices: []device.Device{
+		{UUID: "uuid-answers", UDID: "answers", Enrolled: true, LastSeen: now.Add(-40 * day)},
+		{UUID: "uuid-erased", UDID: "erased", Enrolled: true, LastSeen: now.Add(-40 * day)},
+	}}
+	store := &memStore{}
+	var canceled []string
+	cancel := func(udid, commandUUID string) (bool, error) {
+		canceled = append(canceled, commandUUID)
+		return true, nil
+	}
+	policy := Policy{StaleAfter: 30 * day, Remediation: Wipe, AllowWipe: true}
+	e := NewEnforcer(policy, store, devices, devices, devices, devices, topicPublisher{}, log.NewNopLogger(),
+		WithCommandCanceler(cancel))
+	e.now = func() time.Time { return now }
+	for _, at := range []time.Time{now, now.Add(e.interval)} {
+		now = at
+		if err := e.enforce(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	connect := func(udid, commandUUID string) {
+		msg, err := mdmsvc.MarshalAcknowledgeEvent(&mdmsvc.AcknowledgeEvent{
+			Response: mdmsvc.Response{UDID: udid, CommandUUID: commandUUID, Status: "Acknowledged"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := e.connected(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the device answers the probe before the erase is sent.
+	connect("answers", "probe-answers")
+	// the device answers the erase itself.
+	connect("erased", "wipe-erased")
+	// later connects do not cancel again.
+	connect("answers", "")
+
+	if len(canceled) != 1 || canceled[0] != "wipe-answers" {
+		t.Errorf("have canceled %v, want only the wipe of the device which answered", canceled)
+	}
+	if have := actionTypes(store.actions, "answers"); have[len(have)-1] != WipeCanceled {
+		t.Errorf("have actions %v, want the wipe canceled", have)
+	}
+	if have := actionTypes(store.actions, "erased"); have[len(have)-1] != WipeQueued {
+		t.Errorf("have actions %v, want the wipe kept", have)
+	}
+
+	// the queued wipes are loaded from the store on start.
+	e = NewEnforcer(policy, store, devices, devices, devices, devices, topicPublisher{}, log.NewNopLogger())
+	if err := e.loadWipes(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := e.wipes["answers"]; ok || len(e.wipes) != 1 {
+		t.Errorf("have queued wipes %v, want only the wipe which was not canceled", e.wipes)
+	}
+}
+
+func TestPolicyVerify(t *testing.T) {
+	day := 24 * time.Hour
+	tests := []struct {
+		policy Policy
+		ok     bool
+	}{
+		{Policy{StaleAfter: 30 * day}, true},
+		{Policy{StaleAfter: 30 * day, Remediation: Block, PurgeAfter: 90 * day}, true},
+		{Policy{StaleAfter: 30 * day, Remediation: Wipe, AllowWipe: true}, true},
+		{Policy{StaleAfter: 30 * day, Remediation: Wipe}, false},
+		{Policy{}, false},
+		{Policy{StaleAfter: 30 * day, Remediation: "lock"}, false},
+		{Policy{StaleAfter: 30 * day, PurgeAfter: 10 * day}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.policy.Verify(); (err == nil) != tt.ok {
+			t.Errorf("%+v: have err %v, want ok %v", tt.policy, err, tt.ok)
+		}
+	}
+}
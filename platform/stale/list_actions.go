@@ -0,0 +1,89 @@
+package stale
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+
+	"github.com/vishnuvaradaraj/micromdm/pkg/httputil"
+)
+
+func (svc *StaleService) ListActions(ctx context.Context, opt ListActionsOption) ([]Action, error) {
+	actions, err := svc.store.List()
+	if err != nil {
+		return nil, err
+	}
+	filtered := actions[:0]
+	for _, a := range actions {
+		if opt.UDID != "" && a.UDID != opt.UDID {
+			continue
+		}
+		if opt.SerialNumber != "" && a.SerialNumber != opt.SerialNumber {
+			continue
+		}
+		filtered = append(filtered, a)
+	}
+	return filtered, nil
+}
+
+type listActionsRequest struct {
+	Opts ListActionsOption
+}
+
+type listActionsResponse struct {
+	Actions []Action `json:"actions"`
+	Err     error    `json:"err,omitempty"`
+}
+
+func (r listActionsResponse) Failed() error { return r.Err }
+
+// decodeListActionsRequest decodes the options from the udid and serial query
+// parameters.
+func decodeListActionsRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	q := r.URL.Query()
+	opts := ListActionsOption{
+		UDID:         q.Get("udid"),
+		SerialNumber: q.Get("serial"),
+	}
+	return listActionsRequest{Opts: opts}, nil
+}
+
+func encodeListActionsRequest(_ context.Context, r *http.Request, request interface{}) error {
+	req := request.(listActionsRequest)
+	q := r.URL.Query()
+	if req.Opts.UDID != "" {
+		q.Set("udid", req.Opts.UDID)
+	}
+	if req.Opts.SerialNumber != "" {
+		q.Set("serial", req.Opts.SerialNumber)
+	}
+	r.URL.RawQuery = q.Encode()
+	return nil
+}
+
+func decodeListActionsResponse(_ context.Context, r *http.Response) (interface{}, error) {
+	var resp listActionsResponse
+	err := httputil.DecodeJSONResponse(r, &resp)
+	return resp, err
+}
+
+func MakeListActionsEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(listActionsRequest)
+		actions, err := svc.ListActions(ctx, req.Opts)
+		return listActionsResponse{
+			Actions: actions,
+			Err:     err,
+		}, nil
+	}
+}
+
+func (e Endpoints) ListActions(ctx context.Context, opt ListActionsOption) ([]Action, error) {
+	response, err := e.ListActionsEndpoint(ctx, listActionsRequest{Opts: opt})
+	if err != nil {
+		return nil, err
+	}
+	resp := response.(listActionsResponse)
+	return resp.Actions, resp.Err
+}
@@ -0,0 +1,30 @@
+package stale
+
+import (
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+
+	"github.com/vishnuvaradaraj/micromdm/pkg/httputil"
+)
+
+type Endpoints struct {
+	ListActionsEndpoint endpoint.Endpoint
+}
+
+func MakeServerEndpoints(s Service, outer endpoint.Middleware, others ...endpoint.Middleware) Endpoints {
+	return Endpoints{
+		ListActionsEndpoint: endpoint.Chain(outer, others...)(MakeListActionsEndpoint(s)),
+	}
+}
+
+func RegisterHTTPHandlers(r *mux.Router, e Endpoints, options ...httptransport.ServerOption) {
+	// GET     /v1/stale/actions		list the actions taken on stale devices
+
+	r.Methods("GET").Path("/v1/stale/actions").Handler(httptransport.NewServer(
+		e.ListActionsEndpoint,
+		decodeListActionsRequest,
+		httputil.EncodeJSONResponse,
+		options...,
+	))
+}
@@ -0,0 +1,31 @@
+package stale
+
+import (
+	"context"
+)
+
+type ListActionsOption struct {
+	UDID         string `json:"udid,omitempty"`
+	SerialNumber string `json:"serial_number,omitempty"`
+}
+
+type Service interface {
+	// ListActions lists the actions taken on stale devices, oldest first.
+	ListActions(ctx context.Context, opt ListActionsOption) ([]Action, error)
+}
+
+// Store persists the actions taken on stale devices. Actions are only ever
+// added.
+type Store interface {
+	Save(*Action) error
+	// List returns every action, oldest first.
+	List() ([]Action, error)
+}
+
+type StaleService struct {
+	store Store
+}
+
+func New(store Store) *StaleService {
+	return &StaleService{store: store}
+}
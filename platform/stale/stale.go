@@ -0,0 +1,141 @@
+// Package stale finds devices which have stopped checking in and retires them
+// according to a Policy. Every action taken on a device is recorded, so that
+// it is known why a device was wiped, blocked or removed.
+package stale
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/device"
+)
+
+// ActionTopic is a PubSub topic that an Action is published to, JSON encoded,
+// each time the policy acts on a device.
+const ActionTopic = "mdm.StaleDeviceAction"
+
+// ActionType is what the policy did to a device.
+type ActionType string
+
+const (
+	// MarkedStale is recorded once a device has not been seen for the
+	// StaleAfter period of the policy.
+	MarkedStale ActionType = "marked_stale"
+	// Probed is recorded when a DeviceInformation command is queued for an
+	// enrolled stale device, which pushes it to check in, before it is
+	// remediated or purged.
+	Probed ActionType = "probed"
+	// WipeQueued and Blocked are recorded when a stale device is remediated.
+	WipeQueued ActionType = "wipe_queued"
+	Blocked    ActionType = "blocked"
+	// WipeCanceled is recorded when a device connects before its queued
+	// EraseDevice command was sent, and the command is canceled.
+	WipeCanceled ActionType = "wipe_canceled"
+	// Purged is recorded when the records of a device are removed after the
+	// PurgeAfter period of the policy.
+	Purged ActionType = "purged"
+)
+
+// Action is a record of the policy acting on a device. Actions are kept after
+// the device is purged.
+type Action struct {
+	ID           string     `json:"id"`
+	Time         time.Time  `json:"time"`
+	Type         ActionType `json:"type"`
+	UUID         string     `json:"uuid"`
+	UDID         string     `json:"udid"`
+	SerialNumber string     `json:"serial_number,omitempty"`
+	LastSeen     time.Time  `json:"last_seen"`
+	// Reason explains why the policy acted, with the thresholds at the time.
+	Reason string `json:"reason"`
+	// CommandUUID is the DeviceInformation command of a Probed action, and
+	// the EraseDevice command of a WipeQueued or WipeCanceled action.
+	CommandUUID string `json:"command_uuid,omitempty"`
+}
+
+func newAction(typ ActionType, dev *device.Device, now time.Time, reason string) *Action {
+	return &Action{
+		ID:           uuid.NewV4().String(),
+		Time:         now.UTC(),
+		Type:         typ,
+		UUID:         dev.UUID,
+		UDID:         dev.UDID,
+		SerialNumber: dev.SerialNumber,
+		LastSeen:     dev.LastSeen,
+		Reason:       reason,
+	}
+}
+
+func MarshalAction(a *Action) ([]byte, error) {
+	return json.Marshal(a)
+}
+
+func UnmarshalAction(data []byte, a *Action) error {
+	return json.Unmarshal(data, a)
+}
+
+// Remediation is what the policy does to an enrolled device once it is stale.
+type Remediation string
+
+const (
+	// NoRemediation only marks the device as stale.
+	NoRemediation Remediation = "none"
+	// Wipe queues an EraseDevice command for the device, behind the
+	// DeviceInformation command it was probed with. The erase is canceled if
+	// the device connects before it is sent. Wipe must be allowed by the
+	// AllowWipe field of the policy.
+	Wipe Remediation = "wipe"
+	// Block blocks the device with the remove service, which forces it to
+	// check out the next time it connects.
+	Block Remediation = "block"
+)
+
+// Policy are the thresholds after which devices are retired. A device is idle
+// from the time it was last seen; devices which have never checked in, like
+// DEP devices which have not enrolled, are left alone. Enrolled devices are
+// probed before they are remediated or purged, and are only acted on if they
+// did not answer within the interval of the Enforcer.
+type Policy struct {
+	// StaleAfter marks devices which have been idle this long as stale.
+	StaleAfter time.Duration `json:"stale_after"`
+	// Remediation is applied to enrolled devices when they are marked stale.
+	Remediation Remediation `json:"remediation"`
+	// AllowWipe must be set for the Wipe remediation, which erases devices.
+	AllowWipe bool `json:"allow_wipe,omitempty"`
+	// PurgeAfter removes the records of devices which have been idle this
+	// long. Devices are never purged if zero.
+	PurgeAfter time.Duration `json:"purge_after,omitempty"`
+}
+
+func (p Policy) Verify() error {
+	if p.StaleAfter <= 0 {
+		return errors.New("stale threshold must be positive")
+	}
+	switch p.Remediation {
+	case "", NoRemediation, Wipe, Block:
+	default:
+		return errors.Errorf("unknown stale device remediation %q, must be one of none, wipe or block", p.Remediation)
+	}
+	if p.Remediation == Wipe && !p.AllowWipe {
+		return errors.New("the wipe remediation erases devices and must be allowed explicitly")
+	}
+	if p.PurgeAfter != 0 && p.PurgeAfter <= p.StaleAfter {
+		return errors.New("purge threshold must be longer than the stale threshold")
+	}
+	return nil
+}
+
+// reason explains an action on a device which has been idle since lastSeen,
+// with the threshold which was crossed.
+func reason(lastSeen, now time.Time, threshold time.Duration) string {
+	return fmt.Sprintf("not seen for %d days since %s, the policy threshold is %d days",
+		days(now.Sub(lastSeen)), lastSeen.UTC().Format("2006-01-02"), days(threshold))
+}
+
+func days(d time.Duration) int {
+	return int(d.Hours() / 24)
+}
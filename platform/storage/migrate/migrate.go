@@ -0,0 +1,656 @@
+// Package migrate copies the state of a BoltDB server to another storage
+// backend.
+//
+// Every record is written with an upsert, so a migration can be re-run until
+// the cut-over to the new backend. Records which were deleted from BoltDB since
+// a previous run are not deleted from the destination, but reported as extra
+// records, which fail the verification.
+package migrate
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"text/tabwriter"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/backup"
+	"github.com/vishnuvaradaraj/micromdm/platform/blueprint"
+	"github.com/vishnuvaradaraj/micromdm/platform/config"
+	configbuiltin "github.com/vishnuvaradaraj/micromdm/platform/config/builtin"
+	"github.com/vishnuvaradaraj/micromdm/platform/device"
+	"github.com/vishnuvaradaraj/micromdm/platform/queue"
+	"github.com/vishnuvaradaraj/micromdm/platform/storage"
+)
+
+// scepBucket is the bucket of the BoltDB SCEP depot.
+const scepBucket = "scep_certificates"
+
+// Report is the outcome of a migration.
+type Report struct {
+	From       string        `json:"from"`
+	To         string        `json:"to"`
+	StartedAt  time.Time     `json:"started_at"`
+	FinishedAt time.Time     `json:"finished_at"`
+	Stores     []StoreReport `json:"stores"`
+}
+
+// StoreReport counts the records of a store in the source, and the ones found
+// with the same content in the destination after the copy. Extra counts the
+// records of the destination which are not in the source, for the stores which
+// can be listed.
+type StoreReport struct {
+	Name     string `json:"name"`
+	Source   int    `json:"source"`
+	Verified int    `json:"verified"`
+	Extra    int    `json:"extra"`
+	Skipped  string `json:"skipped,omitempty"`
+}
+
+// OK reports whether every record which was copied has been verified, and the
+// destination has no records which are not in the source.
+func (r *Report) OK() bool {
+	for _, s := range r.Stores {
+		if s.Skipped == "" && (s.Verified != s.Source || s.Extra > 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// Print writes the report as a table.
+func (r *Report) Print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "STORE\tSOURCE\tVERIFIED\tEXTRA\tSTATUS\n")
+	for _, s := range r.Stores {
+		status := "ok"
+		switch {
+		case s.Skipped != "":
+			status = "skipped: " + s.Skipped
+		case s.Verified != s.Source:
+			status = "MISMATCH"
+		case s.Extra > 0:
+			status = "EXTRA"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%s\n", s.Name, s.Source, s.Verified, s.Extra, status)
+	}
+	return tw.Flush()
+}
+
+// secrets are the records which are not part of a JSON export.
+type secrets struct {
+	pushCert, pushKey []byte
+
+	depKey  *rsa.PrivateKey
+	depCert *x509.Certificate
+
+	caKey  *rsa.PrivateKey
+	caCert *x509.Certificate
+	serial *big.Int
+	certs  map[string]*x509.Certificate
+}
+
+// FromBolt copies every store of a BoltDB database to dst and verifies the
+// copy. An error is only returned if the copy could not be completed; check
+// Report.OK for the result of the verification.
+func FromBolt(src *bolt.DB, dst *storage.Stores) (*Report, error) {
+	report := &Report{
+		From:      storage.Bolt,
+		To:        dst.Backend,
+		StartedAt: time.Now().UTC(),
+	}
+
+	exp, err := backup.ExportBolt(src)
+	if err != nil {
+		return nil, err
+	}
+	sec, err := readSecrets(src)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := exp.Import(dst); err != nil {
+		return nil, err
+	}
+	if sec.pushCert != nil {
+		if err := dst.Config.SavePushCertificate(sec.pushCert, sec.pushKey); err != nil {
+			return nil, errors.Wrap(err, "copy push certificate")
+		}
+	}
+	if sec.depKey != nil {
+		if err := dst.Config.SaveDEPKeypair(sec.depKey, sec.depCert); err != nil {
+			return nil, errors.Wrap(err, "copy dep keypair")
+		}
+	}
+	scepSkipped := scepSkipReason(dst, sec)
+	if scepSkipped == "" {
+		importer := dst.SCEPDepot.(storage.SCEPImporter)
+		if err := importer.ImportCA(sec.caKey, sec.caCert, sec.serial); err != nil {
+			return nil, errors.Wrap(err, "copy scep ca")
+		}
+		for name, crt := range sec.certs {
+			if err := importer.ImportCertificate(name, crt); err != nil {
+				return nil, errors.Wrapf(err, "copy scep certificate %s", name)
+			}
+		}
+	}
+
+	report.Stores, err = verify(dst, exp, sec, scepSkipped)
+	if err != nil {
+		return nil, err
+	}
+	report.FinishedAt = time.Now().UTC()
+	return report, nil
+}
+
+func scepSkipReason(dst *storage.Stores, sec *secrets) string {
+	if sec.caCert == nil {
+		return "no scep ca in source"
+	}
+	if dst.SCEPDepot == nil {
+		return fmt.Sprintf("%s keeps the scep depot in boltdb", dst.Backend)
+	}
+	if _, ok := dst.SCEPDepot.(storage.SCEPImporter); !ok {
+		return fmt.Sprintf("%s scep depot does not support imports", dst.Backend)
+	}
+	return ""
+}
+
+func readSecrets(db *bolt.DB) (*secrets, error) {
+	sec := &secrets{certs: make(map[string]*x509.Certificate)}
+	err := db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(configbuiltin.ConfigBucket)); b != nil {
+			if v := b.Get([]byte("config")); v != nil {
+				var conf config.ServerConfig
+				if err := config.UnmarshalServerConfig(v, &conf); err != nil {
+					return errors.Wrap(err, "read push certificate")
+				}
+				sec.pushCert, sec.pushKey = conf.PushCertificate, conf.PrivateKey
+			}
+		}
+
+		if b := tx.Bucket([]byte(configbuiltin.DEPTokenBucket)); b != nil {
+			key, cert := b.Get([]byte("key")), b.Get([]byte("certificate"))
+			if key != nil && cert != nil {
+				var err error
+				if sec.depKey, err = x509.ParsePKCS1PrivateKey(key); err != nil {
+					return errors.Wrap(err, "parse dep key")
+				}
+				if sec.depCert, err = x509.ParseCertificate(cert); err != nil {
+					return errors.Wrap(err, "parse dep certificate")
+				}
+			}
+		}
+
+		b := tx.Bucket([]byte(scepBucket))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var err error
+			switch name := string(k); name {
+			case "ca_key":
+				sec.caKey, err = x509.ParsePKCS1PrivateKey(v)
+			case "ca_certificate":
+				sec.caCert, err = x509.ParseCertificate(v)
+			case "serial":
+				sec.serial = new(big.Int).SetBytes(v)
+			default:
+				sec.certs[name], err = x509.ParseCertificate(v)
+			}
+			return errors.Wrapf(err, "read scep depot value %s", k)
+		})
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "read secrets from bolt")
+	}
+	if sec.caCert != nil && sec.caKey == nil {
+		return nil, errors.New("scep depot has a ca certificate but no key")
+	}
+	if sec.serial == nil {
+		sec.serial = big.NewInt(2)
+	}
+	return sec, nil
+}
+
+// verify reads every source record back from dst.
+func verify(dst *storage.Stores, exp *backup.Export, sec *secrets, scepSkipped string) ([]StoreReport, error) {
+	var reports []StoreReport
+	add := func(name string, source int, found func(i int) (bool, error)) error {
+		r := StoreReport{Name: name, Source: source}
+		for i := 0; i < source; i++ {
+			ok, err := found(i)
+			if err != nil {
+				return errors.Wrapf(err, "verify %s", name)
+			}
+			if ok {
+				r.Verified++
+			}
+		}
+		reports = append(reports, r)
+		return nil
+	}
+	// extra counts the keys of the destination records which are not keys of
+	// the source records, for the store added last.
+	extra := func(dstKeys map[string]bool, source int, key func(i int) string) {
+		srcKeys := make(map[string]bool, source)
+		for i := 0; i < source; i++ {
+			srcKeys[key(i)] = true
+		}
+		r := &reports[len(reports)-1]
+		for k := range dstKeys {
+			if !srcKeys[k] {
+				r.Extra++
+			}
+		}
+	}
+
+	devices, err := dst.Device.List(device.ListDevicesOption{})
+	if err != nil {
+		return nil, errors.Wrap(err, "list devices")
+	}
+	deviceUUIDs := make(map[string]bool)
+	for _, d := range devices {
+		deviceUUIDs[d.UUID] = true
+	}
+	if err := add("devices", len(exp.Devices), func(i int) (bool, error) {
+		return deviceUUIDs[exp.Devices[i].UUID], nil
+	}); err != nil {
+		return nil, err
+	}
+	extra(deviceUUIDs, len(exp.Devices), func(i int) string { return exp.Devices[i].UUID })
+
+	var udids []string
+	for udid := range exp.UDIDCertHashes {
+		udids = append(udids, udid)
+	}
+	if err := add("udid_cert_hashes", len(udids), func(i int) (bool, error) {
+		hash, err := dst.Device.GetUDIDCertHash([]byte(udids[i]))
+		if isNotFound(err) {
+			return false, nil
+		}
+		return bytes.Equal(hash, exp.UDIDCertHashes[udids[i]]), err
+	}); err != nil {
+		return nil, err
+	}
+
+	attributes, err := dst.Device.Attributes()
+	if err != nil {
+		return nil, errors.Wrap(err, "list device attributes")
+	}
+	attributeTypes := make(map[string]device.AttributeType)
+	for _, a := range attributes {
+		attributeTypes[a.Name] = a.Type
+	}
+	if err := add("device_attributes", len(exp.DeviceAttributes), func(i int) (bool, error) {
+		a := exp.DeviceAttributes[i]
+		typ, ok := attributeTypes[a.Name]
+		return ok && typ == a.Type, nil
+	}); err != nil {
+		return nil, err
+	}
+	attributeNames := make(map[string]bool, len(attributeTypes))
+	for name := range attributeTypes {
+		attributeNames[name] = true
+	}
+	extra(attributeNames, len(exp.DeviceAttributes), func(i int) string { return exp.DeviceAttributes[i].Name })
+
+	historyUUIDs := make([]string, 0, len(exp.DeviceHistory))
+	for uuid := range exp.DeviceHistory {
+		historyUUIDs = append(historyUUIDs, uuid)
+	}
+	if err := add("device_history", len(historyUUIDs), func(i int) (bool, error) {
+		events, err := dst.Device.History(historyUUIDs[i])
+		return len(events) == len(exp.DeviceHistory[historyUUIDs[i]]), err
+	}); err != nil {
+		return nil, err
+	}
+
+	profiles, err := dst.Profile.List()
+	if err != nil {
+		return nil, errors.Wrap(err, "list profiles")
+	}
+	profileIDs := make(map[string]bool)
+	for _, p := range profiles {
+		profileIDs[p.Identifier] = true
+	}
+	if err := add("profiles", len(exp.Profiles), func(i int) (bool, error) {
+		return profileIDs[exp.Profiles[i].Identifier], nil
+	}); err != nil {
+		return nil, err
+	}
+	extra(profileIDs, len(exp.Profiles), func(i int) string { return exp.Profiles[i].Identifier })
+
+	users, err := dst.User.List()
+	if err != nil {
+		return nil, errors.Wrap(err, "list users")
+	}
+	userUUIDs := make(map[string]bool)
+	for _, u := range users {
+		userUUIDs[u.UUID] = true
+	}
+	if err := add("users", len(exp.Users), func(i int) (bool, error) {
+		return userUUIDs[exp.Users[i].UUID], nil
+	}); err != nil {
+		return nil, err
+	}
+	extra(userUUIDs, len(exp.Users), func(i int) string { return exp.Users[i].UUID })
+
+	blueprints, err := dst.Blueprint.List()
+	if err != nil {
+		return nil, errors.Wrap(err, "list blueprints")
+	}
+	blueprintUUIDs := make(map[string]bool)
+	for _, bp := range blueprints {
+		blueprintUUIDs[bp.UUID] = true
+	}
+	if err := add("blueprints", len(exp.Blueprints), func(i int) (bool, error) {
+		return blueprintUUIDs[exp.Blueprints[i].UUID], nil
+	}); err != nil {
+		return nil, err
+	}
+	extra(blueprintUUIDs, len(exp.Blueprints), func(i int) string { return exp.Blueprints[i].UUID })
+
+	states := make(map[string][]blueprint.DeviceState)
+	if err := add("blueprint_device_states", len(exp.BlueprintDeviceStates), func(i int) (bool, error) {
+		want := exp.BlueprintDeviceStates[i]
+		if _, ok := states[want.UDID]; !ok {
+			have, err := dst.Blueprint.DeviceStates(want.UDID)
+			if err != nil {
+				return false, err
+			}
+			states[want.UDID] = have
+		}
+		for _, have := range states[want.UDID] {
+			if have.BlueprintUUID == want.BlueprintUUID {
+				return len(have.Items) == len(want.Items), nil
+			}
+		}
+		return false, nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := add("block_list", len(exp.RemovedDevices), func(i int) (bool, error) {
+		_, err := dst.Remove.DeviceByUDID(exp.RemovedDevices[i].UDID)
+		if isNotFound(err) {
+			return false, nil
+		}
+		return err == nil, err
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := add("push_info", len(exp.PushInfo), func(i int) (bool, error) {
+		info, err := dst.Push.PushInfo(exp.PushInfo[i].UDID)
+		if isNotFound(err) {
+			return false, nil
+		}
+		return err == nil && info.Token == exp.PushInfo[i].Token, err
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := add("command_queues", len(exp.CommandQueue), func(i int) (bool, error) {
+		want := exp.CommandQueue[i]
+		have, err := dst.Queue.DeviceCommand(want.DeviceUDID)
+		if isNotFound(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return len(have.Commands) == len(want.Commands) &&
+			len(have.Completed) == len(want.Completed) &&
+			len(have.Failed) == len(want.Failed) &&
+			len(have.NotNow) == len(want.NotNow), nil
+	}); err != nil {
+		return nil, err
+	}
+
+	archived := make(map[string][]queue.ArchivedDeviceCommand)
+	if err := add("archived_command_queues", len(exp.ArchivedCommandQueue), func(i int) (bool, error) {
+		want := exp.ArchivedCommandQueue[i]
+		if _, ok := archived[want.DeviceUDID]; !ok {
+			have, err := dst.Queue.ArchivedDeviceCommands(want.DeviceUDID)
+			if err != nil {
+				return false, err
+			}
+			archived[want.DeviceUDID] = have
+		}
+		for _, have := range archived[want.DeviceUDID] {
+			if have.ArchivedAt.Equal(want.ArchivedAt) {
+				return len(have.Commands) == len(want.Commands), nil
+			}
+		}
+		return false, nil
+	}); err != nil {
+		return nil, err
+	}
+
+	tokens, err := dst.Config.DEPTokens()
+	if err != nil {
+		return nil, errors.Wrap(err, "list dep tokens")
+	}
+	tokenKeys := make(map[string]bool)
+	for _, tok := range tokens {
+		tokenKeys[tok.ConsumerKey] = true
+	}
+	if err := add("dep_tokens", len(exp.DEPTokens), func(i int) (bool, error) {
+		return tokenKeys[exp.DEPTokens[i].ConsumerKey], nil
+	}); err != nil {
+		return nil, err
+	}
+	extra(tokenKeys, len(exp.DEPTokens), func(i int) string { return exp.DEPTokens[i].ConsumerKey })
+
+	cursors := make(map[string]string, len(exp.DEPCursors)+1)
+	for name, cursor := range exp.DEPCursors {
+		cursors[name] = cursor.Value
+	}
+	if exp.DEPCursor != nil {
+		cursors[config.DefaultDEPTokenName] = exp.DEPCursor.Value
+	}
+	cursorNames := make([]string, 0, len(cursors))
+	for name := range cursors {
+		cursorNames = append(cursorNames, name)
+	}
+	if err := add("dep_cursors", len(cursorNames), func(i int) (bool, error) {
+		cursor, err := dst.DEPSync.LoadCursor(cursorNames[i])
+		return err == nil && cursor.Value == cursors[cursorNames[i]], err
+	}); err != nil {
+		return nil, err
+	}
+
+	// auto-assigners are listed for each DEP token.
+	type assignerValue struct {
+		profileUUID string
+		priority    int
+	}
+	assignerProfiles := make(map[string]map[string]assignerValue)
+	for _, want := range exp.AutoAssigners {
+		if _, ok := assignerProfiles[want.TokenName]; ok {
+			continue
+		}
+		assigners, err := dst.DEPSync.LoadAutoAssigners(want.TokenName)
+		if err != nil {
+			return nil, errors.Wrapf(err, "list auto-assigners of dep token %s", want.TokenName)
+		}
+		profiles := make(map[string]assignerValue)
+		for _, aa := range assigners {
+			profiles[aa.Filter] = assignerValue{aa.ProfileUUID, aa.Priority}
+		}
+		assignerProfiles[want.TokenName] = profiles
+	}
+	if err := add("auto_assigners", len(exp.AutoAssigners), func(i int) (bool, error) {
+		aa := exp.AutoAssigners[i]
+		return assignerProfiles[aa.TokenName][aa.Filter] == assignerValue{aa.ProfileUUID, aa.Priority}, nil
+	}); err != nil {
+		return nil, err
+	}
+
+	// the profile library is listed for each DEP token and profile name.
+	type profileName struct{ tokenName, name string }
+	profileVersions := make(map[profileName]map[int]string)
+	for _, want := range exp.DEPProfiles {
+		key := profileName{want.TokenName, want.Name}
+		if _, ok := profileVersions[key]; ok {
+			continue
+		}
+		versions, err := dst.DEPProfile.ProfileVersions(want.TokenName, want.Name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "list versions of dep profile %s", want.Name)
+		}
+		uuids := make(map[int]string)
+		for _, v := range versions {
+			uuids[v.Version] = v.ProfileUUID
+		}
+		profileVersions[key] = uuids
+	}
+	if err := add("dep_profiles", len(exp.DEPProfiles), func(i int) (bool, error) {
+		pv := exp.DEPProfiles[i]
+		uuid, ok := profileVersions[profileName{pv.TokenName, pv.Name}][pv.Version]
+		return ok && uuid == pv.ProfileUUID, nil
+	}); err != nil {
+		return nil, err
+	}
+
+	assignments, err := dst.DEPProfile.Assignments()
+	if err != nil {
+		return nil, errors.Wrap(err, "list dep profile assignments")
+	}
+	assigned := make(map[string]string)
+	for _, a := range assignments {
+		assigned[a.SerialNumber] = a.ProfileUUID
+	}
+	if err := add("dep_profile_assignments", len(exp.DEPProfileAssignments), func(i int) (bool, error) {
+		a := exp.DEPProfileAssignments[i]
+		return assigned[a.SerialNumber] == a.ProfileUUID, nil
+	}); err != nil {
+		return nil, err
+	}
+	assignedSerials := make(map[string]bool, len(assigned))
+	for serial := range assigned {
+		assignedSerials[serial] = true
+	}
+	extra(assignedSerials, len(exp.DEPProfileAssignments), func(i int) string {
+		return exp.DEPProfileAssignments[i].SerialNumber
+	})
+
+	groups, err := dst.Group.List()
+	if err != nil {
+		return nil, errors.Wrap(err, "list groups")
+	}
+	groupNames := make(map[string]bool)
+	for _, g := range groups {
+		groupNames[g.Name] = true
+	}
+	if err := add("groups", len(exp.Groups), func(i int) (bool, error) {
+		return groupNames[exp.Groups[i].Name], nil
+	}); err != nil {
+		return nil, err
+	}
+	extra(groupNames, len(exp.Groups), func(i int) string { return exp.Groups[i].Name })
+
+	type groupMember struct{ group, uuid string }
+	var members []groupMember
+	for name, mm := range exp.GroupMembers {
+		for _, m := range mm {
+			members = append(members, groupMember{name, m.UUID})
+		}
+	}
+	if err := add("group_members", len(members), func(i int) (bool, error) {
+		_, err := dst.Group.Member(members[i].group, members[i].uuid)
+		if isNotFound(err) {
+			return false, nil
+		}
+		return err == nil, err
+	}); err != nil {
+		return nil, err
+	}
+
+	staleActions, err := dst.Stale.List()
+	if err != nil {
+		return nil, errors.Wrap(err, "list stale device actions")
+	}
+	staleActionIDs := make(map[string]bool)
+	for _, a := range staleActions {
+		staleActionIDs[a.ID] = true
+	}
+	if err := add("stale_actions", len(exp.StaleActions), func(i int) (bool, error) {
+		return staleActionIDs[exp.StaleActions[i].ID], nil
+	}); err != nil {
+		return nil, err
+	}
+	extra(staleActionIDs, len(exp.StaleActions), func(i int) string { return exp.StaleActions[i].ID })
+
+	if err := add("push_certificate", count(sec.pushCert != nil), func(int) (bool, error) {
+		raw, err := dst.Config.GetPushCertificate()
+		if err != nil {
+			return false, err
+		}
+		crt, err := parsePEMCertificate(sec.pushCert)
+		return err == nil && bytes.Equal(raw, crt.Raw), err
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := add("dep_keypair", count(sec.depCert != nil), func(int) (bool, error) {
+		_, crt, err := dst.Config.DEPKeypair()
+		return err == nil && crt.Equal(sec.depCert), err
+	}); err != nil {
+		return nil, err
+	}
+
+	if scepSkipped != "" {
+		reports = append(reports,
+			StoreReport{Name: "scep_ca", Source: count(sec.caCert != nil), Skipped: scepSkipped},
+			StoreReport{Name: "scep_certificates", Source: len(sec.certs), Skipped: scepSkipped},
+		)
+		return reports, nil
+	}
+
+	if err := add("scep_ca", 1, func(int) (bool, error) {
+		chain, _, err := dst.SCEPDepot.CA(nil)
+		return err == nil && len(chain) == 1 && chain[0].Equal(sec.caCert), err
+	}); err != nil {
+		return nil, err
+	}
+
+	var certs []*x509.Certificate
+	for _, crt := range sec.certs {
+		certs = append(certs, crt)
+	}
+	if err := add("scep_certificates", len(certs), func(i int) (bool, error) {
+		return dst.SCEPDepot.HasCN(certs[i].Subject.CommonName, 0, certs[i], false)
+	}); err != nil {
+		return nil, err
+	}
+	return reports, nil
+}
+
+func count(ok bool) int {
+	if ok {
+		return 1
+	}
+	return 0
+}
+
+func isNotFound(err error) bool {
+	e, ok := errors.Cause(err).(interface{ NotFound() bool })
+	return ok && e.NotFound()
+}
+
+func parsePEMCertificate(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("decode push certificate PEM")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
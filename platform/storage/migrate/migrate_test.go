@@ -0,0 +1,262 @@
+package migrate
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/vishnuvaradaraj/micromdm/pkg/crypto"
+	"github.com/vishnuvaradaraj/micromdm/platform/apns"
+	"github.com/vishnuvaradaraj/micromdm/platform/blueprint"
+	depapi "github.com/vishnuvaradaraj/micromdm/platform/dep"
+	"github.com/vishnuvaradaraj/micromdm/platform/dep/sync"
+	"github.com/vishnuvaradaraj/micromdm/platform/device"
+	"github.com/vishnuvaradaraj/micromdm/platform/group"
+	"github.com/vishnuvaradaraj/micromdm/platform/profile"
+	"github.com/vishnuvaradaraj/micromdm/platform/pubsub/inmem"
+	"github.com/vishnuvaradaraj/micromdm/platform/queue"
+	"github.com/vishnuvaradaraj/micromdm/platform/remove"
+	"github.com/vishnuvaradaraj/micromdm/platform/stale"
+	"github.com/vishnuvaradaraj/micromdm/platform/storage"
+	"github.com/vishnuvaradaraj/micromdm/platform/user"
+)
+
+const mobileconfig = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>PayloadIdentifier</key>
+	<string>com.example.profile</string>
+</dict>
+</plist>`
+
+// openStores creates a seeded BoltDB source and an empty SQLite destination.
+func openStores(t *testing.T) (src *bolt.DB, stores, dst *storage.Stores, cleanup func()) {
+	f, err := ioutil.TempFile("", "bolt-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	sf, err := ioutil.TempFile("", "sqlite-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sf.Close()
+	cleanup = func() {
+		if dst != nil {
+			dst.Close()
+		}
+		if src != nil {
+			src.Close()
+		}
+		os.Remove(sf.Name())
+		os.Remove(f.Name())
+	}
+
+	src, err = bolt.Open(f.Name(), 0777, nil)
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	stores, err = storage.NewBolt(src, inmem.NewPubSub())
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	seed(t, stores)
+
+	dst, err = storage.Open(context.Background(), "sqlite://"+sf.Name(), inmem.NewPubSub())
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	return src, stores, dst, cleanup
+}
+
+func TestFromBolt(t *testing.T) {
+	src, stores, dst, cleanup := openStores(t)
+	defer cleanup()
+
+	// a migration is re-run during a cut-over.
+	for i := 0; i < 2; i++ {
+		report, err := FromBolt(src, dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !report.OK() {
+			t.Errorf("run %d: migration was not verified: %+v", i, report.Stores)
+		}
+		for _, s := range report.Stores {
+			if s.Skipped != "" {
+				t.Errorf("run %d: skipped %s: %s", i, s.Name, s.Skipped)
+			}
+			if s.Source == 0 {
+				t.Errorf("run %d: no %s in source", i, s.Name)
+			}
+		}
+	}
+
+	srcCA, _, err := stores.SCEPDepot.CA(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dstCA, _, err := dst.SCEPDepot.CA(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !dstCA[0].Equal(srcCA[0]) {
+		t.Error("scep ca was not copied")
+	}
+	srcSerial, err := stores.SCEPDepot.Serial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dstSerial, err := dst.SCEPDepot.Serial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := dstSerial.Int64(), srcSerial.Int64(); have != want {
+		t.Errorf("have serial %d, want %d", have, want)
+	}
+}
+
+func TestFromBoltDeletedRecord(t *testing.T) {
+	src, stores, dst, cleanup := openStores(t)
+	defer cleanup()
+
+	if report, err := FromBolt(src, dst); err != nil {
+		t.Fatal(err)
+	} else if !report.OK() {
+		t.Fatalf("migration was not verified: %+v", report.Stores)
+	}
+
+	// the device is deleted from the source before the migration is re-run.
+	if err := stores.Device.DeleteByUDID("UDID-1"); err != nil {
+		t.Fatal(err)
+	}
+	report, err := FromBolt(src, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.OK() {
+		t.Error("expected the migration with a deleted source record to fail the verification")
+	}
+	for _, s := range report.Stores {
+		want := 0
+		if s.Name == "devices" {
+			want = 1
+		}
+		if s.Extra != want {
+			t.Errorf("have %d extra %s, want %d", s.Extra, s.Name, want)
+		}
+	}
+}
+
+func seed(t *testing.T, stores *storage.Stores) {
+	if err := stores.Device.Save(&device.Device{UUID: "uuid-1", UDID: "UDID-1", SerialNumber: "SERIAL-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := stores.Device.SaveAttribute(&device.Attribute{Name: "department", Type: device.StringAttribute}); err != nil {
+		t.Fatal(err)
+	}
+	if err := stores.Device.AddHistory("uuid-1", device.NewHistoryEvent(device.Enrolled, "UDID-1", nil)); err != nil {
+		t.Fatal(err)
+	}
+	if err := stores.Device.SaveUDIDCertHash([]byte("UDID-1"), []byte("hash")); err != nil {
+		t.Fatal(err)
+	}
+	p := &profile.Profile{Identifier: "com.example.profile", Mobileconfig: []byte(mobileconfig)}
+	if err := stores.Profile.Save(p); err != nil {
+		t.Fatal(err)
+	}
+	if err := stores.User.Save(&user.User{UUID: "user-1", UDID: "UDID-1", UserID: "user-id-1"}); err != nil {
+		t.Fatal(err)
+	}
+	bp := &blueprint.Blueprint{UUID: "bp-1", Name: "default", ProfileIdentifiers: []string{p.Identifier}}
+	if err := stores.Blueprint.Save(bp); err != nil {
+		t.Fatal(err)
+	}
+	if err := stores.Blueprint.SaveDeviceState(&blueprint.DeviceState{
+		UDID:          "UDID-1",
+		BlueprintUUID: bp.UUID,
+		BlueprintName: bp.Name,
+		Items:         []blueprint.Item{{Type: blueprint.ItemProfile, Identifier: p.Identifier, Status: blueprint.ItemInstalled}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := stores.Remove.Save(&remove.Device{UDID: "UDID-2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := stores.Push.Save(&apns.PushInfo{UDID: "UDID-1", Token: "token", PushMagic: "magic"}); err != nil {
+		t.Fatal(err)
+	}
+	cmd := &queue.DeviceCommand{
+		DeviceUDID: "UDID-1",
+		Commands:   []queue.Command{{UUID: "cmd-1", Payload: []byte("payload")}},
+	}
+	if err := stores.Queue.Save(cmd); err != nil {
+		t.Fatal(err)
+	}
+	archived := &queue.ArchivedDeviceCommand{ArchivedAt: time.Now().UTC(), DeviceCommand: *cmd}
+	if err := stores.Queue.SaveArchivedDeviceCommand(archived); err != nil {
+		t.Fatal(err)
+	}
+	if err := stores.Config.AddToken("CK_migrate", []byte(`{"consumer_key":"CK_migrate"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := stores.Config.DEPKeypair(); err != nil {
+		t.Fatal(err)
+	}
+	if err := stores.DEPSync.SaveCursor("", sync.Cursor{Value: "cursor-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := stores.DEPSync.SaveAutoAssigner(&sync.AutoAssigner{Filter: "*", ProfileUUID: "profile-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := stores.DEPProfile.SaveProfileVersion(&depapi.ProfileVersion{TokenName: "default", Name: "Staff", Version: 1, ProfileUUID: "profile-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := stores.DEPProfile.SaveAssignment(&depapi.Assignment{SerialNumber: "SERIAL-1", TokenName: "default", ProfileUUID: "profile-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := stores.Group.Save(&group.Group{Name: "Staff", Serials: []string{"SERIAL-1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := stores.Group.SaveMember("Staff", &group.Member{UUID: "device-1", SerialNumber: "SERIAL-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := stores.Stale.Save(&stale.Action{ID: "action-1", Time: time.Now(), Type: stale.MarkedStale, UUID: "uuid-1", UDID: "UDID-1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	key, cert, err := crypto.SimpleSelfSignedRSAKeypair("com.apple.mgmt.External.migrate", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := stores.Config.SavePushCertificate(certPEM, keyPEM); err != nil {
+		t.Fatal(err)
+	}
+
+	caKey, err := stores.SCEPDepot.CreateOrLoadKey(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stores.SCEPDepot.CreateOrLoadCA(caKey, 1, "MicroMDM", "US"); err != nil {
+		t.Fatal(err)
+	}
+	_, deviceCert, err := crypto.SimpleSelfSignedRSAKeypair("device", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stores.SCEPDepot.Put(deviceCert.Subject.CommonName, deviceCert); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,232 @@
+package storage
+
+import "github.com/vishnuvaradaraj/micromdm/platform/storage/sqldb"
+
+// migrations is the schema of the SQL backend. Records are stored in the same
+// wire format as the BoltDB store, with the columns used for lookups next to
+// them. Append new migrations; never edit one which has been released.
+var migrations = []sqldb.Migration{
+	{
+		Version: 1,
+		Statements: []string{
+			`CREATE TABLE devices (
+				uuid VARCHAR(255) PRIMARY KEY,
+				udid VARCHAR(255) NOT NULL,
+				serial_number VARCHAR(255) NOT NULL,
+				data {{blob}} NOT NULL
+			)`,
+			`CREATE INDEX devices_udid_idx ON devices (udid)`,
+			`CREATE INDEX devices_serial_number_idx ON devices (serial_number)`,
+			`CREATE TABLE device_udid_certs (
+				udid VARCHAR(255) PRIMARY KEY,
+				cert_hash {{blob}} NOT NULL
+			)`,
+			`CREATE TABLE device_commands (
+				udid VARCHAR(255) PRIMARY KEY,
+				data {{blob}} NOT NULL
+			)`,
+			`CREATE TABLE push_info (
+				udid VARCHAR(255) PRIMARY KEY,
+				data {{blob}} NOT NULL
+			)`,
+			`CREATE TABLE profiles (
+				id VARCHAR(255) PRIMARY KEY,
+				data {{blob}} NOT NULL
+			)`,
+			`CREATE TABLE blueprints (
+				uuid VARCHAR(255) PRIMARY KEY,
+				name VARCHAR(255) NOT NULL UNIQUE,
+				data {{blob}} NOT NULL
+			)`,
+			`CREATE TABLE users (
+				uuid VARCHAR(255) PRIMARY KEY,
+				udid VARCHAR(255) NOT NULL,
+				user_id VARCHAR(255) NOT NULL,
+				data {{blob}} NOT NULL
+			)`,
+			`CREATE INDEX users_udid_idx ON users (udid)`,
+			`CREATE INDEX users_user_id_idx ON users (user_id)`,
+			`CREATE TABLE removed_devices (
+				udid VARCHAR(255) PRIMARY KEY,
+				data {{blob}} NOT NULL
+			)`,
+			`CREATE TABLE server_config (
+				id VARCHAR(255) PRIMARY KEY,
+				data {{blob}} NOT NULL
+			)`,
+			`CREATE TABLE dep_tokens (
+				consumer_key VARCHAR(255) PRIMARY KEY,
+				data {{blob}} NOT NULL
+			)`,
+			`CREATE TABLE dep_keypair (
+				id VARCHAR(255) PRIMARY KEY,
+				private_key {{blob}} NOT NULL,
+				certificate {{blob}} NOT NULL
+			)`,
+			`CREATE TABLE dep_sync_cursor (
+				id VARCHAR(255) PRIMARY KEY,
+				data {{blob}} NOT NULL
+			)`,
+			`CREATE TABLE dep_autoassigners (
+				filter_name VARCHAR(255) PRIMARY KEY,
+				profile_uuid VARCHAR(255) NOT NULL
+			)`,
+			`CREATE TABLE scep_certificates (
+				name VARCHAR(255) PRIMARY KEY,
+				common_name VARCHAR(255) NOT NULL,
+				certificate {{blob}} NOT NULL
+			)`,
+			`CREATE INDEX scep_certificates_common_name_idx ON scep_certificates (common_name)`,
+			`CREATE TABLE scep_ca (
+				name VARCHAR(255) PRIMARY KEY,
+				data {{blob}} NOT NULL
+			)`,
+		},
+	},
+	{
+		Version: 2,
+		Statements: []string{
+			`CREATE TABLE push_log (
+				id VARCHAR(255) PRIMARY KEY,
+				udid VARCHAR(255) NOT NULL,
+				created_at BIGINT NOT NULL,
+				data {{blob}} NOT NULL
+			)`,
+			`CREATE INDEX push_log_udid_idx ON push_log (udid, created_at)`,
+		},
+	},
+	{
+		Version: 3,
+		Statements: []string{
+			`ALTER TABLE dep_autoassigners ADD COLUMN priority INTEGER NOT NULL DEFAULT 0`,
+		},
+	},
+	{
+		Version: 4,
+		Statements: []string{
+			`CREATE TABLE dep_profiles (
+				id VARCHAR(255) PRIMARY KEY,
+				token_name VARCHAR(255) NOT NULL,
+				name VARCHAR(255) NOT NULL,
+				version INTEGER NOT NULL,
+				data {{blob}} NOT NULL
+			)`,
+			`CREATE INDEX dep_profiles_name_idx ON dep_profiles (token_name, name)`,
+			`CREATE TABLE dep_profile_assignments (
+				serial_number VARCHAR(255) PRIMARY KEY,
+				data {{blob}} NOT NULL
+			)`,
+		},
+	},
+	{
+		// columns queried when listing devices. Rows saved before are
+		// filled in by the device store, which finds them by their NULL
+		// enrolled column.
+		Version: 5,
+		Statements: []string{
+			`ALTER TABLE devices ADD COLUMN model VARCHAR(255)`,
+			`ALTER TABLE devices ADD COLUMN os_version VARCHAR(255)`,
+			`ALTER TABLE devices ADD COLUMN dep_profile_status VARCHAR(255)`,
+			`ALTER TABLE devices ADD COLUMN dep_token_name VARCHAR(255)`,
+			`ALTER TABLE devices ADD COLUMN enrolled INTEGER`,
+			`ALTER TABLE devices ADD COLUMN dep_device INTEGER`,
+			`CREATE INDEX devices_model_idx ON devices (model)`,
+			`CREATE INDEX devices_os_version_idx ON devices (os_version)`,
+			`CREATE INDEX devices_dep_profile_status_idx ON devices (dep_profile_status)`,
+			`CREATE INDEX devices_dep_token_name_idx ON devices (dep_token_name)`,
+			`CREATE INDEX devices_enrolled_idx ON devices (enrolled)`,
+			`CREATE INDEX devices_dep_device_idx ON devices (dep_device)`,
+		},
+	},
+	{
+		Version: 6,
+		Statements: []string{
+			`CREATE TABLE device_groups (
+				name VARCHAR(255) PRIMARY KEY,
+				data {{blob}} NOT NULL
+			)`,
+			`CREATE TABLE device_group_members (
+				group_name VARCHAR(255) NOT NULL,
+				device_uuid VARCHAR(255) NOT NULL,
+				data {{blob}} NOT NULL,
+				PRIMARY KEY (group_name, device_uuid)
+			)`,
+		},
+	},
+	{
+		Version: 7,
+		Statements: []string{
+			`CREATE TABLE device_attributes (
+				name VARCHAR(255) PRIMARY KEY,
+				data {{blob}} NOT NULL
+			)`,
+		},
+	},
+	{
+		Version: 8,
+		Statements: []string{
+			`CREATE TABLE device_history (
+				id VARCHAR(255) PRIMARY KEY,
+				device_uuid VARCHAR(255) NOT NULL,
+				created_at BIGINT NOT NULL,
+				data {{blob}} NOT NULL
+			)`,
+			`CREATE INDEX device_history_device_uuid_idx ON device_history (device_uuid, created_at)`,
+		},
+	},
+	{
+		Version: 9,
+		Statements: []string{
+			`CREATE TABLE stale_device_actions (
+				id VARCHAR(255) PRIMARY KEY,
+				device_uuid VARCHAR(255) NOT NULL,
+				created_at BIGINT NOT NULL,
+				data {{blob}} NOT NULL
+			)`,
+			`CREATE INDEX stale_device_actions_created_at_idx ON stale_device_actions (created_at)`,
+		},
+	},
+	{
+		Version: 10,
+		Statements: []string{
+			`CREATE TABLE device_command_archive (
+				id VARCHAR(255) PRIMARY KEY,
+				udid VARCHAR(255) NOT NULL,
+				archived_at BIGINT NOT NULL,
+				data {{blob}} NOT NULL
+			)`,
+			`CREATE INDEX device_command_archive_udid_idx ON device_command_archive (udid, archived_at)`,
+		},
+	},
+	{
+		Version: 11,
+		Statements: []string{
+			`CREATE TABLE blueprint_device_states (
+				id VARCHAR(255) PRIMARY KEY,
+				udid VARCHAR(255) NOT NULL,
+				blueprint_uuid VARCHAR(255) NOT NULL,
+				data {{blob}} NOT NULL
+			)`,
+			`CREATE INDEX blueprint_device_states_udid_idx ON blueprint_device_states (udid)`,
+		},
+	},
+	{
+		Version: 12,
+		Statements: []string{
+			`CREATE TABLE dep_autoassign_retries (
+				token_name VARCHAR(255) PRIMARY KEY,
+				data {{blob}} NOT NULL
+			)`,
+		},
+	},
+	{
+		Version: 13,
+		Statements: []string{
+			`CREATE TABLE leader_leases (
+				name VARCHAR(255) PRIMARY KEY,
+				holder VARCHAR(255) NOT NULL,
+				expires_at BIGINT NOT NULL
+			)`,
+		},
+	},
+}
@@ -0,0 +1,273 @@
+package storage
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"encoding/asn1"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vishnuvaradaraj/scep/depot"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/storage/sqldb"
+)
+
+// SCEPDepot is the SCEP certificate store used by the server.
+type SCEPDepot interface {
+	depot.Depot
+	CreateOrLoadKey(bits int) (*rsa.PrivateKey, error)
+	CreateOrLoadCA(key *rsa.PrivateKey, years int, org, country string) (*x509.Certificate, error)
+}
+
+// SCEPImporter is implemented by SCEP depots which can take over the CA and
+// issued certificates of another depot.
+type SCEPImporter interface {
+	ImportCA(key *rsa.PrivateKey, cert *x509.Certificate, serial *big.Int) error
+	ImportCertificate(name string, crt *x509.Certificate) error
+}
+
+// SQLDepot is a SCEP depot stored in a SQL database. It is the SQL version of
+// the BoltDB depot from the scep package.
+type SQLDepot struct {
+	*sqldb.DB
+}
+
+// NewSQLDepot creates a SCEPDepot backed by a SQL database.
+func NewSQLDepot(db *sqldb.DB) *SQLDepot {
+	return &SQLDepot{DB: db}
+}
+
+func (db *SQLDepot) caValue(name string) ([]byte, error) {
+	var data []byte
+	err := db.QueryRow(`SELECT data FROM scep_ca WHERE name = ?`, name).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return data, errors.Wrapf(err, "get %s from scep depot", name)
+}
+
+func (db *SQLDepot) putCAValue(name string, data []byte) error {
+	_, err := db.Exec(db.Upsert("scep_ca", "name", "name", "data"), name, data)
+	return errors.Wrapf(err, "put %s to scep depot", name)
+}
+
+// addCAValue saves a value unless the depot has one under the name.
+func (db *SQLDepot) addCAValue(name string, data []byte) error {
+	_, err := db.Exec(db.InsertIfAbsent("scep_ca", "name", "name", "data"), name, data)
+	return errors.Wrapf(err, "put %s to scep depot", name)
+}
+
+func (db *SQLDepot) CA(pass []byte) ([]*x509.Certificate, *rsa.PrivateKey, error) {
+	caCert, err := db.caValue("ca_certificate")
+	if err != nil {
+		return nil, nil, err
+	}
+	if caCert == nil {
+		return nil, nil, errors.New("no ca_certificate in scep depot")
+	}
+	cert, err := x509.ParseCertificate(caCert)
+	if err != nil {
+		return nil, nil, err
+	}
+	caKey, err := db.caValue("ca_key")
+	if err != nil {
+		return nil, nil, err
+	}
+	if caKey == nil {
+		return nil, nil, errors.New("no ca_key in scep depot")
+	}
+	key, err := x509.ParsePKCS1PrivateKey(caKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return []*x509.Certificate{cert}, key, nil
+}
+
+// Put saves an issued certificate under its common name and the next serial
+// number. The serial is locked until the certificate is saved, so servers
+// sharing the depot never reuse a serial.
+func (db *SQLDepot) Put(cn string, crt *x509.Certificate) error {
+	if crt == nil || crt.Raw == nil {
+		return errors.Errorf("%q does not specify a valid certificate for storage", cn)
+	}
+	if err := db.addCAValue("serial", big.NewInt(2).Bytes()); err != nil {
+		return err
+	}
+	return db.Update(func(tx *sqldb.Tx) error {
+		var k []byte
+		err := tx.QueryRow(`SELECT data FROM scep_ca WHERE name = ?`+db.Dialect.ForUpdate(), "serial").Scan(&k)
+		if err != nil {
+			return errors.Wrap(err, "get serial from scep depot")
+		}
+		serial := new(big.Int).SetBytes(k)
+		name := cn + "." + serial.String()
+		_, err = tx.Exec(`INSERT INTO scep_certificates (name, common_name, certificate) VALUES (?, ?, ?)`,
+			name, cn, crt.Raw)
+		if err != nil {
+			return errors.Wrap(err, "put certificate to scep depot")
+		}
+		_, err = tx.Exec(`UPDATE scep_ca SET data = ? WHERE name = ?`,
+			serial.Add(serial, big.NewInt(1)).Bytes(), "serial")
+		return errors.Wrap(err, "put serial to scep depot")
+	})
+}
+
+func (db *SQLDepot) Serial() (*big.Int, error) {
+	if err := db.addCAValue("serial", big.NewInt(2).Bytes()); err != nil {
+		return nil, err
+	}
+	k, err := db.caValue("serial")
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(k), nil
+}
+
+func (db *SQLDepot) HasCN(cn string, allowTime int, cert *x509.Certificate, revokeOldCertificate bool) (bool, error) {
+	// TODO: implement allowTime
+	// TODO: implement revocation
+	if cert == nil {
+		return false, errors.New("nil certificate provided")
+	}
+	rows, err := db.Query(`SELECT certificate FROM scep_certificates WHERE common_name = ?`, cert.Subject.CommonName)
+	if err != nil {
+		return false, errors.Wrap(err, "find certificates in scep depot")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var raw []byte
+		if err := rows.Scan(&raw); err != nil {
+			return false, err
+		}
+		if bytes.Equal(raw, cert.Raw) {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+// ImportCA replaces the CA of the depot. The serial number is never lowered,
+// so certificates issued by this depot keep unique serials.
+func (db *SQLDepot) ImportCA(key *rsa.PrivateKey, cert *x509.Certificate, serial *big.Int) error {
+	if err := db.putCAValue("ca_key", x509.MarshalPKCS1PrivateKey(key)); err != nil {
+		return err
+	}
+	if err := db.putCAValue("ca_certificate", cert.Raw); err != nil {
+		return err
+	}
+	current, err := db.caValue("serial")
+	if err != nil {
+		return err
+	}
+	if current != nil && new(big.Int).SetBytes(current).Cmp(serial) > 0 {
+		return nil
+	}
+	return db.putCAValue("serial", serial.Bytes())
+}
+
+// ImportCertificate saves an issued certificate under its name in another
+// depot, which is the common name and serial joined by a dot.
+func (db *SQLDepot) ImportCertificate(name string, crt *x509.Certificate) error {
+	cn := name
+	if i := strings.LastIndex(name, "."); i > 0 {
+		cn = name[:i]
+	}
+	_, err := db.Exec(db.Upsert("scep_certificates", "name", "name", "common_name", "certificate"),
+		name, cn, crt.Raw)
+	return errors.Wrap(err, "import certificate to scep depot")
+}
+
+func (db *SQLDepot) CreateOrLoadKey(bits int) (*rsa.PrivateKey, error) {
+	priv, err := db.caValue("ca_key")
+	if err != nil {
+		return nil, err
+	}
+	if priv != nil {
+		return x509.ParsePKCS1PrivateKey(priv)
+	}
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return nil, err
+	}
+	// another server sharing the depot may have saved its key first.
+	if err := db.addCAValue("ca_key", x509.MarshalPKCS1PrivateKey(key)); err != nil {
+		return nil, err
+	}
+	if priv, err = db.caValue("ca_key"); err != nil {
+		return nil, err
+	}
+	return x509.ParsePKCS1PrivateKey(priv)
+}
+
+func (db *SQLDepot) CreateOrLoadCA(key *rsa.PrivateKey, years int, org, country string) (*x509.Certificate, error) {
+	caCert, err := db.caValue("ca_certificate")
+	if err != nil {
+		return nil, err
+	}
+	if caCert != nil {
+		return x509.ParseCertificate(caCert)
+	}
+
+	subject := pkix.Name{
+		Country:            []string{country},
+		Organization:       []string{org},
+		OrganizationalUnit: []string{"MICROMDM SCEP CA"},
+		CommonName:         org,
+	}
+	subjectKeyID, err := generateSubjectKeyID(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	authTemplate := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               subject,
+		NotBefore:             time.Now().Add(-600).UTC(),
+		NotAfter:              time.Now().AddDate(years, 0, 0).UTC(),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLen:            0,
+		SubjectKeyId:          subjectKeyID,
+	}
+	crtBytes, err := x509.CreateCertificate(rand.Reader, &authTemplate, &authTemplate, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	// another server sharing the depot may have saved its certificate first.
+	if err := db.addCAValue("ca_certificate", crtBytes); err != nil {
+		return nil, err
+	}
+	if caCert, err = db.caValue("ca_certificate"); err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(caCert)
+}
+
+// rsaPublicKey reflects the ASN.1 structure of a PKCS#1 public key.
+type rsaPublicKey struct {
+	N *big.Int
+	E int
+}
+
+// generateSubjectKeyID generates the SubjectKeyId used in the CA certificate,
+// the SHA-1 hash of the subjectPublicKey BIT STRING.
+func generateSubjectKeyID(pub crypto.PublicKey) ([]byte, error) {
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("only RSA public key is supported")
+	}
+	pubBytes, err := asn1.Marshal(rsaPublicKey{N: rsaPub.N, E: rsaPub.E})
+	if err != nil {
+		return nil, err
+	}
+	hash := sha1.Sum(pubBytes)
+	return hash[:], nil
+}
@@ -0,0 +1,60 @@
+package sqldb
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Migration is a numbered schema change. Migrations are applied in order of
+// Version, and each is applied once.
+type Migration struct {
+	Version int
+
+	// Statements are run in order. {{blob}} is replaced with the binary
+	// column type of the dialect.
+	Statements []string
+}
+
+const migrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version INTEGER PRIMARY KEY
+)`
+
+// Migrate applies the migrations which have not been applied yet.
+func (db *DB) Migrate(migrations []Migration) error {
+	if _, err := db.Exec(migrationsTable); err != nil {
+		return errors.Wrap(err, "create schema_migrations table")
+	}
+	var current int
+	if err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return errors.Wrap(err, "get schema version")
+	}
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+		if err := db.apply(m); err != nil {
+			return errors.Wrapf(err, "apply migration %d", m.Version)
+		}
+		current = m.Version
+	}
+	return nil
+}
+
+func (db *DB) apply(m Migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, stmt := range m.Statements {
+		stmt = strings.Replace(stmt, "{{blob}}", db.Dialect.Blob(), -1)
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(db.Rebind(`INSERT INTO schema_migrations (version) VALUES (?)`), m.Version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,182 @@
+// Package sqldb contains the helpers shared by the SQL stores.
+//
+// Queries are written with ? placeholders and rebound for the dialect in use,
+// so the same statements work on PostgreSQL, MySQL and SQLite.
+package sqldb
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Dialect is the flavor of SQL spoken by the database.
+type Dialect string
+
+// Supported dialects. The values are the registered database/sql driver names.
+const (
+	Postgres Dialect = "postgres"
+	MySQL    Dialect = "mysql"
+	SQLite   Dialect = "sqlite3"
+)
+
+// DB is a database handle which knows its dialect.
+type DB struct {
+	*sql.DB
+	Dialect Dialect
+}
+
+// Open opens a database with the driver for the dialect.
+func Open(dialect Dialect, dsn string) (*DB, error) {
+	db, err := sql.Open(string(dialect), dsn)
+	if err != nil {
+		return nil, errors.Wrapf(err, "open %s database", dialect)
+	}
+	if dialect == SQLite {
+		// SQLite only allows a single writer.
+		db.SetMaxOpenConns(1)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, errors.Wrapf(err, "connect to %s database", dialect)
+	}
+	return &DB{DB: db, Dialect: dialect}, nil
+}
+
+// Rebind replaces the ? placeholders in a query with the dialect's placeholders.
+func (db *DB) Rebind(query string) string {
+	return db.Dialect.rebind(query)
+}
+
+func (d Dialect) rebind(query string) string {
+	if d != Postgres {
+		return query
+	}
+	var (
+		b strings.Builder
+		n int
+	)
+	for _, r := range query {
+		if r != '?' {
+			b.WriteRune(r)
+			continue
+		}
+		n++
+		b.WriteString("$" + strconv.Itoa(n))
+	}
+	return b.String()
+}
+
+// Upsert returns a statement which inserts a row, or updates the columns of the
+// row with the same key. key is the primary key column and must be listed first
+// in columns.
+func (db *DB) Upsert(table, key string, columns ...string) string {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	query := "INSERT INTO " + table + " (" + strings.Join(columns, ", ") + ") VALUES (" + placeholders + ")"
+
+	var updates []string
+	for _, col := range columns {
+		if col == key {
+			continue
+		}
+		if db.Dialect == MySQL {
+			updates = append(updates, col+" = VALUES("+col+")")
+		} else {
+			updates = append(updates, col+" = excluded."+col)
+		}
+	}
+	switch {
+	case db.Dialect == MySQL && len(updates) == 0:
+		query += " ON DUPLICATE KEY UPDATE " + key + " = " + key
+	case db.Dialect == MySQL:
+		query += " ON DUPLICATE KEY UPDATE " + strings.Join(updates, ", ")
+	case len(updates) == 0:
+		query += " ON CONFLICT (" + key + ") DO NOTHING"
+	default:
+		query += " ON CONFLICT (" + key + ") DO UPDATE SET " + strings.Join(updates, ", ")
+	}
+	return query
+}
+
+// InsertIfAbsent returns a statement which inserts a row unless a row with the
+// same key exists. key is the primary key column and must be listed first in
+// columns. The statement affects no rows if the key exists.
+func (db *DB) InsertIfAbsent(table, key string, columns ...string) string {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	query := "INSERT INTO " + table + " (" + strings.Join(columns, ", ") + ") VALUES (" + placeholders + ")"
+	if db.Dialect == MySQL {
+		return query + " ON DUPLICATE KEY UPDATE " + key + " = " + key
+	}
+	return query + " ON CONFLICT (" + key + ") DO NOTHING"
+}
+
+// ForUpdate returns the clause which locks the rows selected in a transaction
+// until it ends. SQLite has no row locks, but only allows a single writer.
+func (d Dialect) ForUpdate() string {
+	if d == SQLite {
+		return ""
+	}
+	return " FOR UPDATE"
+}
+
+// Tx is a transaction which knows the dialect of its database.
+type Tx struct {
+	*sql.Tx
+	Dialect Dialect
+}
+
+// Exec runs a statement written with ? placeholders.
+func (tx *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return tx.Tx.Exec(tx.Dialect.rebind(query), args...)
+}
+
+// QueryRow runs a query written with ? placeholders which returns at most one
+// row. Scan returns sql.ErrNoRows if there is no row.
+func (tx *Tx) QueryRow(query string, args ...interface{}) *sql.Row {
+	return tx.Tx.QueryRow(tx.Dialect.rebind(query), args...)
+}
+
+// Update runs fn in a transaction, which is committed if fn returns nil and
+// rolled back otherwise. Rows read with ForUpdate can be changed by fn without
+// racing other servers which share the database.
+func (db *DB) Update(fn func(tx *Tx) error) error {
+	sqlTx, err := db.DB.Begin()
+	if err != nil {
+		return errors.Wrap(err, "begin transaction")
+	}
+	defer sqlTx.Rollback()
+	if err := fn(&Tx{Tx: sqlTx, Dialect: db.Dialect}); err != nil {
+		return err
+	}
+	return errors.Wrap(sqlTx.Commit(), "commit transaction")
+}
+
+// Exec runs a statement written with ? placeholders.
+func (db *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return db.DB.Exec(db.Rebind(query), args...)
+}
+
+// Query runs a query written with ? placeholders.
+func (db *DB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.DB.Query(db.Rebind(query), args...)
+}
+
+// QueryRow runs a query written with ? placeholders which returns at most one
+// row. Scan returns sql.ErrNoRows if there is no row.
+func (db *DB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return db.DB.QueryRow(db.Rebind(query), args...)
+}
+
+// Blob is the column type used to store binary data.
+func (d Dialect) Blob() string {
+	switch d {
+	case Postgres:
+		return "BYTEA"
+	case MySQL:
+		return "LONGBLOB"
+	default:
+		return "BLOB"
+	}
+}
@@ -0,0 +1,59 @@
+package sqldb
+
+import "testing"
+
+func TestUpsert(t *testing.T) {
+	var tests = []struct {
+		dialect Dialect
+		want    string
+	}{
+		{
+			dialect: Postgres,
+			want:    "INSERT INTO devices (uuid, udid, data) VALUES ($1, $2, $3) ON CONFLICT (uuid) DO UPDATE SET udid = excluded.udid, data = excluded.data",
+		},
+		{
+			dialect: MySQL,
+			want:    "INSERT INTO devices (uuid, udid, data) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE udid = VALUES(udid), data = VALUES(data)",
+		},
+		{
+			dialect: SQLite,
+			want:    "INSERT INTO devices (uuid, udid, data) VALUES (?, ?, ?) ON CONFLICT (uuid) DO UPDATE SET udid = excluded.udid, data = excluded.data",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.dialect), func(t *testing.T) {
+			db := &DB{Dialect: tt.dialect}
+			if have := db.Rebind(db.Upsert("devices", "uuid", "uuid", "udid", "data")); have != tt.want {
+				t.Errorf("have %s, want %s", have, tt.want)
+			}
+		})
+	}
+}
+
+func TestInsertIfAbsent(t *testing.T) {
+	var tests = []struct {
+		dialect Dialect
+		want    string
+	}{
+		{
+			dialect: Postgres,
+			want:    "INSERT INTO scep_ca (name, data) VALUES ($1, $2) ON CONFLICT (name) DO NOTHING",
+		},
+		{
+			dialect: MySQL,
+			want:    "INSERT INTO scep_ca (name, data) VALUES (?, ?) ON DUPLICATE KEY UPDATE name = name",
+		},
+		{
+			dialect: SQLite,
+			want:    "INSERT INTO scep_ca (name, data) VALUES (?, ?) ON CONFLICT (name) DO NOTHING",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.dialect), func(t *testing.T) {
+			db := &DB{Dialect: tt.dialect}
+			if have := db.Rebind(db.InsertIfAbsent("scep_ca", "name", "name", "data")); have != tt.want {
+				t.Errorf("have %s, want %s", have, tt.want)
+			}
+		})
+	}
+}
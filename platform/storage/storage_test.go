@@ -0,0 +1,102 @@
+package storage_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/boltdb/bolt"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/pubsub/inmem"
+	"github.com/vishnuvaradaraj/micromdm/platform/storage"
+	"github.com/vishnuvaradaraj/micromdm/platform/storage/storetest"
+)
+
+func TestBolt(t *testing.T) {
+	f, err := ioutil.TempFile("", "bolt-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	db, err := bolt.Open(f.Name(), 0777, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	stores, err := storage.NewBolt(db, inmem.NewPubSub())
+	if err != nil {
+		t.Fatal(err)
+	}
+	storetest.Run(t, stores)
+}
+
+// TestFirestore runs against the Firestore emulator, started with
+//
+//	gcloud beta emulators firestore start
+func TestFirestore(t *testing.T) {
+	if os.Getenv("FIRESTORE_EMULATOR_HOST") == "" {
+		t.Skip("FIRESTORE_EMULATOR_HOST not set")
+	}
+	// every run uses a new project so that the stores start out empty.
+	project := fmt.Sprintf("micromdm-test-%d", time.Now().UnixNano())
+	client, err := firestore.NewClient(context.Background(), project)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	stores, err := storage.NewFirestore(client, inmem.NewPubSub())
+	if err != nil {
+		t.Fatal(err)
+	}
+	storetest.Run(t, stores)
+}
+
+func TestSQLite(t *testing.T) {
+	f, err := ioutil.TempFile("", "sqlite-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	stores, err := storage.Open(context.Background(), "sqlite://"+f.Name(), inmem.NewPubSub())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stores.Close()
+	storetest.Run(t, stores)
+
+	// migrations are only applied once.
+	again, err := storage.Open(context.Background(), "sqlite://"+f.Name(), inmem.NewPubSub())
+	if err != nil {
+		t.Fatal(err)
+	}
+	again.Close()
+}
+
+// TestSQLServers runs against the databases in the MICROMDM_TEST_POSTGRES and
+// MICROMDM_TEST_MYSQL storage URLs. The databases must be empty.
+func TestSQLServers(t *testing.T) {
+	for _, env := range []string{"MICROMDM_TEST_POSTGRES", "MICROMDM_TEST_MYSQL"} {
+		t.Run(env, func(t *testing.T) {
+			rawurl := os.Getenv(env)
+			if rawurl == "" {
+				t.Skipf("%s not set", env)
+			}
+			stores, err := storage.Open(context.Background(), rawurl, inmem.NewPubSub())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer stores.Close()
+			storetest.Run(t, stores)
+		})
+	}
+}
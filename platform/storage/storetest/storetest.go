@@ -0,0 +1,1337 @@
+// Package storetest provides a conformance suite which every storage backend
+// must pass, so that the backends remain interchangeable.
+package storetest
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/dep"
+	"github.com/vishnuvaradaraj/micromdm/mdm"
+	"github.com/vishnuvaradaraj/micromdm/pkg/crypto"
+	"github.com/vishnuvaradaraj/micromdm/platform/apns"
+	"github.com/vishnuvaradaraj/micromdm/platform/blueprint"
+	"github.com/vishnuvaradaraj/micromdm/platform/config"
+	depapi "github.com/vishnuvaradaraj/micromdm/platform/dep"
+	"github.com/vishnuvaradaraj/micromdm/platform/dep/sync"
+	"github.com/vishnuvaradaraj/micromdm/platform/device"
+	"github.com/vishnuvaradaraj/micromdm/platform/group"
+	"github.com/vishnuvaradaraj/micromdm/platform/leader"
+	"github.com/vishnuvaradaraj/micromdm/platform/profile"
+	"github.com/vishnuvaradaraj/micromdm/platform/queue"
+	"github.com/vishnuvaradaraj/micromdm/platform/remove"
+	"github.com/vishnuvaradaraj/micromdm/platform/stale"
+	"github.com/vishnuvaradaraj/micromdm/platform/storage"
+	"github.com/vishnuvaradaraj/micromdm/platform/user"
+)
+
+// Run runs every conformance test against a set of empty stores.
+func Run(t *testing.T, stores *storage.Stores) {
+	t.Run("Device", func(t *testing.T) { TestDeviceStore(t, stores.Device) })
+	t.Run("Queue", func(t *testing.T) { TestQueueStore(t, stores.Queue) })
+	t.Run("Push", func(t *testing.T) { TestPushStore(t, stores.Push) })
+	t.Run("Profile", func(t *testing.T) { TestProfileStore(t, stores.Profile) })
+	t.Run("Blueprint", func(t *testing.T) { TestBlueprintStore(t, stores.Blueprint) })
+	t.Run("User", func(t *testing.T) { TestUserStore(t, stores.User) })
+	t.Run("Remove", func(t *testing.T) { TestRemoveStore(t, stores.Remove) })
+	t.Run("Config", func(t *testing.T) { TestConfigStore(t, stores.Config) })
+	t.Run("DEPSync", func(t *testing.T) { TestDEPSyncStore(t, stores.DEPSync) })
+	t.Run("DEPProfile", func(t *testing.T) { TestDEPProfileStore(t, stores.DEPProfile) })
+	t.Run("Group", func(t *testing.T) { TestGroupStore(t, stores.Group) })
+	t.Run("Stale", func(t *testing.T) { TestStaleStore(t, stores.Stale) })
+	t.Run("Leader", func(t *testing.T) { TestLeaderStore(t, stores.Leader) })
+	if stores.SCEPDepot != nil {
+		t.Run("SCEPDepot", func(t *testing.T) { TestSCEPDepot(t, stores.SCEPDepot) })
+	}
+}
+
+func isNotFound(err error) bool {
+	err = errors.Cause(err)
+	type notFoundErr interface {
+		error
+		NotFound() bool
+	}
+	e, ok := err.(notFoundErr)
+	return ok && e.NotFound()
+}
+
+func wantNotFound(t *testing.T, err error) {
+	t.Helper()
+	if !isNotFound(err) {
+		t.Errorf("have err %v, want a not found error", err)
+	}
+}
+
+// TestDeviceStore checks lookups by UDID and serial, listing and deletion.
+func TestDeviceStore(t *testing.T, store storage.DeviceStore) {
+	dev := &device.Device{
+		UUID:         "device-uuid-1",
+		UDID:         "udid-1",
+		SerialNumber: "C02SERIAL1",
+		DeviceName:   "laptop",
+		Attributes:   map[string]string{"department": "Sales"},
+		Tags:         []string{"loaner"},
+	}
+	if err := store.Save(dev); err != nil {
+		t.Fatal(err)
+	}
+
+	byUDID, err := store.DeviceByUDID(dev.UDID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := byUDID.SerialNumber, dev.SerialNumber; have != want {
+		t.Errorf("have %s, want %s", have, want)
+	}
+	bySerial, err := store.DeviceBySerial(dev.SerialNumber)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := bySerial.UDID, dev.UDID; have != want {
+		t.Errorf("have %s, want %s", have, want)
+	}
+	byUUID, err := store.DeviceByUUID(dev.UUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := byUUID.UDID, dev.UDID; have != want {
+		t.Errorf("have %s, want %s", have, want)
+	}
+	if have, want := bySerial.Attributes["department"], "Sales"; have != want {
+		t.Errorf("have department %s, want %s", have, want)
+	}
+	if have := bySerial.Tags; len(have) != 1 || have[0] != "loaner" {
+		t.Errorf("have tags %v, want [loaner]", have)
+	}
+
+	devices, err := store.List(device.ListDevicesOption{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(devices), 1; have != want {
+		t.Errorf("have %d devices, want %d", have, want)
+	}
+
+	if err := store.SaveUDIDCertHash([]byte(dev.UDID), []byte("hash")); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := store.GetUDIDCertHash([]byte(dev.UDID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := string(hash), "hash"; have != want {
+		t.Errorf("have %s, want %s", have, want)
+	}
+
+	if err := store.DeleteByUDID(dev.UDID); err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.DeviceByUDID(dev.UDID)
+	wantNotFound(t, err)
+	_, err = store.DeviceBySerial(dev.SerialNumber)
+	wantNotFound(t, err)
+	_, err = store.DeviceByUUID(dev.UUID)
+	wantNotFound(t, err)
+	wantNotFound(t, store.DeleteBySerial("missing"))
+
+	t.Run("Query", func(t *testing.T) { testDeviceQuery(t, store) })
+	t.Run("Attributes", func(t *testing.T) { testAttributeStore(t, store) })
+	t.Run("History", func(t *testing.T) { testHistoryStore(t, store) })
+}
+
+// testHistoryStore checks that the history of a device is returned oldest
+// first, including events at the same time, and deleted.
+func testHistoryStore(t *testing.T, store device.HistoryStore) {
+	now := time.Now().UTC()
+	for i, typ := range []device.HistoryEventType{device.Enrolled, device.OSUpdated, device.CheckedOut} {
+		ev := device.NewHistoryEvent(typ, "UDID-HISTORY", nil)
+		ev.Time = now.Add(time.Duration(i/2) * time.Second)
+		if err := store.AddHistory("uuid-history", ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	events, err := store.History("uuid-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(events), 3; have != want {
+		t.Fatalf("have %d events, want %d", have, want)
+	}
+	if events[2].Type != device.CheckedOut {
+		t.Errorf("have last event %s, want %s", events[2].Type, device.CheckedOut)
+	}
+
+	if events, err := store.History("missing"); err != nil || len(events) != 0 {
+		t.Errorf("have %d events, err %v for a missing device, want none", len(events), err)
+	}
+	if err := store.DeleteHistory("uuid-history"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeleteHistory("missing"); err != nil {
+		t.Errorf("have err %v deleting a missing history, want nil", err)
+	}
+	if events, _ := store.History("uuid-history"); len(events) != 0 {
+		t.Errorf("have %d events after delete, want none", len(events))
+	}
+}
+
+// testAttributeStore checks that custom attribute definitions are replaced by
+// name and deleted.
+func testAttributeStore(t *testing.T, store device.AttributeStore) {
+	for _, a := range []device.Attribute{
+		{Name: "department", Type: device.StringAttribute},
+		{Name: "lease_end", Type: device.DateAttribute},
+		{Name: "department", Type: device.StringAttribute, Description: "cost center"},
+	} {
+		if err := store.SaveAttribute(&a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	attributes, err := store.Attributes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(attributes), 2; have != want {
+		t.Fatalf("have %d attributes, want %d", have, want)
+	}
+	for _, a := range attributes {
+		if a.Name == "department" && a.Description != "cost center" {
+			t.Errorf("have description %q, want the replaced attribute", a.Description)
+		}
+	}
+
+	if err := store.DeleteAttribute("department"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeleteAttribute("missing"); err != nil {
+		t.Errorf("have err %v deleting a missing attribute, want nil", err)
+	}
+	attributes, err = store.Attributes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attributes) != 1 || attributes[0].Name != "lease_end" {
+		t.Errorf("have %+v, want only lease_end", attributes)
+	}
+}
+
+// testDeviceQuery checks that the indexes of a device store find the devices
+// matching a query, and that pages follow each other.
+func testDeviceQuery(t *testing.T, store storage.DeviceStore) {
+	devices := []*device.Device{
+		{UUID: "query-uuid-1", UDID: "query-udid-1", SerialNumber: "QUERY1", Model: "MacBookPro15,1", OSVersion: "10.14.1", Enrolled: true},
+		{UUID: "query-uuid-2", UDID: "query-udid-2", SerialNumber: "QUERY2", Model: "MacBookPro15,1", OSVersion: "14.1", Enrolled: true},
+		{UUID: "query-uuid-3", UDID: "query-udid-3", SerialNumber: "QUERY3", Model: "Macmini8,1", OSVersion: "10.13.6"},
+		{UUID: "query-uuid-4", UDID: "query-udid-4", SerialNumber: "QUERY4", Model: "Macmini8,1", OSVersion: "10.14", DEPDevice: true, DEPTokenName: "dep"},
+	}
+	for _, dev := range devices {
+		if err := store.Save(dev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func() {
+		for _, dev := range devices {
+			store.DeleteByUDID(dev.UDID)
+		}
+	}()
+
+	list := func(opt device.ListDevicesOption) string {
+		t.Helper()
+		found, err := store.List(opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var serials []string
+		for _, dev := range found {
+			serials = append(serials, dev.SerialNumber)
+		}
+		return fmt.Sprint(serials)
+	}
+	tests := []struct {
+		opt  device.ListDevicesOption
+		want string
+	}{
+		{device.ListDevicesOption{}, "[QUERY1 QUERY2 QUERY3 QUERY4]"},
+		{device.ListDevicesOption{Filter: "os_version<14 and enrolled"}, "[QUERY1]"},
+		{device.ListDevicesOption{Filter: "model=Macmini8,1"}, "[QUERY3 QUERY4]"},
+		{device.ListDevicesOption{Filter: "model=Macmini8,1 and enrolled=false and dep_device"}, "[QUERY4]"},
+		{device.ListDevicesOption{Filter: "dep_token_name=dep"}, "[QUERY4]"},
+		{device.ListDevicesOption{Filter: "os_version=14.1"}, "[QUERY2]"},
+		{device.ListDevicesOption{Filter: "udid=query-udid-2"}, "[QUERY2]"},
+		{device.ListDevicesOption{FilterSerial: []string{"QUERY3", "QUERY1", "missing"}}, "[QUERY1 QUERY3]"},
+		{device.ListDevicesOption{Sort: "-os_version"}, "[QUERY2 QUERY1 QUERY4 QUERY3]"},
+		{device.ListDevicesOption{Sort: "os_version", PerPage: 2, Page: 2}, "[QUERY1 QUERY2]"},
+	}
+	for _, tt := range tests {
+		if have := list(tt.opt); have != tt.want {
+			t.Errorf("%+v: have %s, want %s", tt.opt, have, tt.want)
+		}
+	}
+
+	// saving a device again updates its indexes.
+	devices[0].Model = "iMac19,1"
+	if err := store.Save(devices[0]); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := list(device.ListDevicesOption{Filter: "model=MacBookPro15,1"}), "[QUERY2]"; have != want {
+		t.Errorf("have %s, want %s", have, want)
+	}
+	if have, want := list(device.ListDevicesOption{Filter: "model=iMac19,1"}), "[QUERY1]"; have != want {
+		t.Errorf("have %s, want %s", have, want)
+	}
+
+	opt := device.ListDevicesOption{PerPage: 3, Sort: "-serial_number"}
+	q, err := device.NewQuery(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := store.List(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opt.Cursor = q.NextCursor(page)
+	if opt.Cursor == "" {
+		t.Fatal("have no cursor after a full page")
+	}
+	if have, want := list(opt), "[QUERY1]"; have != want {
+		t.Errorf("have next page %s, want %s", have, want)
+	}
+}
+
+// TestQueueStore checks that a device command queue round trips.
+func TestQueueStore(t *testing.T, store storage.QueueStore) {
+	_, err := store.DeviceCommand("udid-missing")
+	wantNotFound(t, err)
+
+	cmd := &queue.DeviceCommand{
+		DeviceUDID: "udid-1",
+		Commands:   []queue.Command{{UUID: "cmd-1", Payload: []byte("payload")}},
+	}
+	if err := store.Save(cmd); err != nil {
+		t.Fatal(err)
+	}
+	have, err := store.DeviceCommand(cmd.DeviceUDID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(have.Commands) != 1 {
+		t.Fatalf("have %d commands, want 1", len(have.Commands))
+	}
+	if have, want := have.Commands[0].UUID, "cmd-1"; have != want {
+		t.Errorf("have %s, want %s", have, want)
+	}
+
+	done := &queue.DeviceCommand{
+		DeviceUDID: "udid-2",
+		Completed:  []queue.Command{{UUID: "cmd-2", Payload: []byte("payload")}},
+	}
+	if err := store.Save(done); err != nil {
+		t.Fatal(err)
+	}
+	pending, err := store.PendingDeviceCommands()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 {
+		t.Fatalf("have %d pending queues, want 1", len(pending))
+	}
+	if have, want := pending[0].DeviceUDID, cmd.DeviceUDID; have != want {
+		t.Errorf("have pending udid %s, want %s", have, want)
+	}
+
+	// a command queued after the time is not archived.
+	reEnrolled := time.Now().UTC()
+	cmd.Commands = append(cmd.Commands, queue.Command{UUID: "cmd-3", CreatedAt: reEnrolled.Add(time.Second)})
+	if err := store.Save(cmd); err != nil {
+		t.Fatal(err)
+	}
+	if err := queue.ArchiveDeviceCommand(store, cmd.DeviceUDID, reEnrolled); err != nil {
+		t.Fatal(err)
+	}
+	have, err = store.DeviceCommand(cmd.DeviceUDID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(have.Commands) != 1 || have.Commands[0].UUID != "cmd-3" {
+		t.Fatalf("have commands %v after archiving, want cmd-3", have.Commands)
+	}
+	// a queue without commands from before the time is left alone.
+	if err := queue.ArchiveDeviceCommand(store, cmd.DeviceUDID, reEnrolled); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.DeviceCommand(cmd.DeviceUDID); err != nil {
+		t.Fatal(err)
+	}
+	archived, err := store.ArchivedDeviceCommands(cmd.DeviceUDID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(archived) != 1 {
+		t.Fatalf("have %d archived queues, want 1", len(archived))
+	}
+	if err := store.DeleteDeviceCommand(cmd.DeviceUDID); err != nil {
+		t.Fatal(err)
+	}
+	// archiving a device without a queue does nothing.
+	if err := queue.ArchiveDeviceCommand(store, cmd.DeviceUDID, reEnrolled); err != nil {
+		t.Fatal(err)
+	}
+	archived, err = store.ArchivedDeviceCommands(cmd.DeviceUDID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(archived) != 1 {
+		t.Fatalf("have %d archived queues, want 1", len(archived))
+	}
+	if len(archived[0].Commands) != 1 {
+		t.Errorf("have %d archived commands, want 1", len(archived[0].Commands))
+	}
+	if have, want := archived[0].Commands[0].UUID, "cmd-1"; have != want {
+		t.Errorf("have archived command %s, want %s", have, want)
+	}
+	if archived[0].ArchivedAt.IsZero() {
+		t.Error("have zero archive time")
+	}
+	// an imported archive replaces the same archive.
+	if err := store.SaveArchivedDeviceCommand(&archived[0]); err != nil {
+		t.Fatal(err)
+	}
+	archived, err = store.ArchivedDeviceCommands(cmd.DeviceUDID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(archived), 1; have != want {
+		t.Errorf("have %d archived queues after import, want %d", have, want)
+	}
+
+	// concurrent acknowledgements don't overwrite each other.
+	const n = 10
+	busy := &queue.DeviceCommand{DeviceUDID: "udid-busy"}
+	for i := 0; i < n; i++ {
+		busy.Commands = append(busy.Commands, queue.Command{UUID: fmt.Sprintf("cmd-%d", i), Payload: []byte("payload")})
+	}
+	if err := store.Save(busy); err != nil {
+		t.Fatal(err)
+	}
+	errs := make(chan error, n)
+	for _, cmd := range busy.Commands {
+		go func(uuid string) {
+			_, err := store.Next(context.Background(), mdm.Response{UDID: busy.DeviceUDID, CommandUUID: uuid, Status: "Acknowledged"})
+			errs <- err
+		}(cmd.UUID)
+	}
+	for i := 0; i < n; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	have, err = store.DeviceCommand(busy.DeviceUDID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(have.Commands) != 0 || len(have.Completed) != n {
+		t.Errorf("have %d queued and %d completed commands, want 0 and %d", len(have.Commands), len(have.Completed), n)
+	}
+}
+
+// TestPushStore checks that push info round trips.
+func TestPushStore(t *testing.T, store storage.PushStore) {
+	_, err := store.PushInfo("udid-missing")
+	wantNotFound(t, err)
+
+	info := &apns.PushInfo{UDID: "udid-1", Token: "token", PushMagic: "magic", MDMTopic: "topic"}
+	if err := store.Save(info); err != nil {
+		t.Fatal(err)
+	}
+	have, err := store.PushInfo(info.UDID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *have != *info {
+		t.Errorf("have %#v, want %#v", have, info)
+	}
+
+	info.Unreachable = true
+	if err := store.Save(info); err != nil {
+		t.Fatal(err)
+	}
+	have, err = store.PushInfo(info.UDID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !have.Unreachable {
+		t.Error("have reachable PushInfo, want unreachable")
+	}
+
+	entries, err := store.PushLog(info.UDID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(entries), 0; have != want {
+		t.Errorf("have %d push log entries, want %d", have, want)
+	}
+	start := time.Now().UTC()
+	for i := 0; i < apns.PushLogSize+5; i++ {
+		entry := &apns.PushLogEntry{
+			UDID:      info.UDID,
+			ID:        fmt.Sprintf("id-%d", i),
+			Status:    200,
+			CreatedAt: start.Add(time.Duration(i) * time.Second),
+		}
+		if err := store.SavePushLog(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err = store.PushLog(info.UDID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(entries), apns.PushLogSize; have != want {
+		t.Fatalf("have %d push log entries, want %d", have, want)
+	}
+	if have, want := entries[0].ID, fmt.Sprintf("id-%d", apns.PushLogSize+4); have != want {
+		t.Errorf("have newest push log entry %s, want %s", have, want)
+	}
+	if have, want := entries[len(entries)-1].ID, "id-5"; have != want {
+		t.Errorf("have oldest push log entry %s, want %s", have, want)
+	}
+
+	if err := store.DeletePushInfo(info.UDID); err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.PushInfo(info.UDID)
+	wantNotFound(t, err)
+}
+
+const mobileconfig = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>PayloadIdentifier</key>
+	<string>com.example.profile</string>
+</dict>
+</plist>`
+
+// TestProfileStore checks profile lookup, listing and deletion.
+func TestProfileStore(t *testing.T, store profile.Store) {
+	_, err := store.ProfileById("com.example.missing")
+	wantNotFound(t, err)
+
+	p := &profile.Profile{Identifier: "com.example.profile", Mobileconfig: []byte(mobileconfig)}
+	if err := store.Save(p); err != nil {
+		t.Fatal(err)
+	}
+	have, err := store.ProfileById(p.Identifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(have.Mobileconfig, p.Mobileconfig) {
+		t.Errorf("have %s, want %s", have.Mobileconfig, p.Mobileconfig)
+	}
+	profiles, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(profiles), 1; have != want {
+		t.Errorf("have %d profiles, want %d", have, want)
+	}
+	if err := store.Delete(p.Identifier); err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.ProfileById(p.Identifier)
+	wantNotFound(t, err)
+}
+
+// TestBlueprintStore checks blueprint lookup by name and apply event, and deletion.
+func TestBlueprintStore(t *testing.T, store storage.BlueprintStore) {
+	_, err := store.BlueprintByName("missing")
+	wantNotFound(t, err)
+
+	bp := &blueprint.Blueprint{
+		UUID:            "blueprint-uuid-1",
+		Name:            "blueprint-1",
+		ApplyAt:         []string{blueprint.ApplyAtEnroll, blueprint.ApplyAtPeriodic},
+		Groups:          []string{"Staff Laptops"},
+		DEPProfileUUIDs: []string{"profile-1"},
+		Models:          []string{"MacBook*"},
+		SerialNumbers:   []string{"C02*"},
+		Priority:        10,
+	}
+	if err := store.Save(bp); err != nil {
+		t.Fatal(err)
+	}
+	have, err := store.BlueprintByName(bp.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := have.UUID, bp.UUID; have != want {
+		t.Errorf("have %s, want %s", have, want)
+	}
+	if len(have.Groups) != 1 || have.Groups[0] != bp.Groups[0] {
+		t.Errorf("have groups %v, want %v", have.Groups, bp.Groups)
+	}
+	if !reflect.DeepEqual(have, bp) {
+		t.Errorf("have %+v, want %+v", have, bp)
+	}
+
+	dup := &blueprint.Blueprint{UUID: "blueprint-uuid-2", Name: bp.Name}
+	if err := store.Save(dup); err == nil {
+		t.Error("expected saving a blueprint with a duplicate name to fail")
+	}
+	missingProfile := &blueprint.Blueprint{
+		UUID:               "blueprint-uuid-3",
+		Name:               "blueprint-3",
+		ProfileIdentifiers: []string{"com.example.missing"},
+	}
+	if err := store.Save(missingProfile); err == nil {
+		t.Error("expected saving a blueprint with an unknown profile to fail")
+	}
+
+	bps, err := store.BlueprintsByApplyAt(blueprint.ApplyAtEnroll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(bps), 1; have != want {
+		t.Errorf("have %d blueprints, want %d", have, want)
+	}
+
+	now := time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)
+	state := &blueprint.DeviceState{
+		UDID:          "UDID-1",
+		BlueprintUUID: bp.UUID,
+		BlueprintName: bp.Name,
+		AppliedAt:     now,
+		Items: []blueprint.Item{
+			{Type: blueprint.ItemApplication, Identifier: "https://example.com/app.plist", CommandUUID: "command-1",
+				Status: blueprint.ItemQueued, UpdatedAt: now},
+		},
+	}
+	for _, s := range []*blueprint.DeviceState{
+		state,
+		{UDID: "UDID-2", BlueprintUUID: bp.UUID, BlueprintName: bp.Name, AppliedAt: now},
+	} {
+		if err := store.SaveDeviceState(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a state is replaced by the next one for the device and blueprint.
+	state.Items[0].Status = blueprint.ItemAcknowledged
+	state.Items[0].BundleIdentifier = "com.example.app"
+	if err := store.SaveDeviceState(state); err != nil {
+		t.Fatal(err)
+	}
+	states, err := store.DeviceStates(state.UDID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := states, []blueprint.DeviceState{*state}; !reflect.DeepEqual(have, want) {
+		t.Errorf("have device states %+v, want %+v", have, want)
+	}
+	states, err = store.ListDeviceStates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(states), 2; have != want {
+		t.Errorf("have %d device states, want %d", have, want)
+	}
+	if err := store.DeleteDeviceState("UDID-2", bp.UUID); err != nil {
+		t.Fatal(err)
+	}
+	if states, err = store.DeviceStates("UDID-2"); err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 0 {
+		t.Errorf("have device states %+v after deleting the blueprint state, want none", states)
+	}
+	if err := store.DeleteDeviceStates(state.UDID); err != nil {
+		t.Fatal(err)
+	}
+	states, err = store.DeviceStates(state.UDID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 0 {
+		t.Errorf("have device states %+v after delete, want none", states)
+	}
+
+	if err := store.Delete(bp.Name); err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.BlueprintByName(bp.Name)
+	wantNotFound(t, err)
+}
+
+// TestUserStore checks user lookup by UUID, user ID and device.
+func TestUserStore(t *testing.T, store storage.UserStore) {
+	_, err := store.User("missing")
+	wantNotFound(t, err)
+	_, err = store.UserByUserID("missing")
+	wantNotFound(t, err)
+
+	u := &user.User{UUID: "user-uuid-1", UDID: "udid-1", UserID: "user-id-1", UserShortname: "alice"}
+	if err := store.Save(u); err != nil {
+		t.Fatal(err)
+	}
+	have, err := store.User(u.UUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := have.UserShortname, u.UserShortname; have != want {
+		t.Errorf("have %s, want %s", have, want)
+	}
+	have, err = store.UserByUserID(u.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := have.UUID, u.UUID; have != want {
+		t.Errorf("have %s, want %s", have, want)
+	}
+
+	users, err := store.DeviceUsers(u.UDID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(users), 1; have != want {
+		t.Errorf("have %d users, want %d", have, want)
+	}
+
+	// only the users created before the time are deleted.
+	created := time.Date(2018, 6, 1, 0, 0, 0, 0, time.UTC)
+	later := &user.User{UUID: "user-uuid-2", UDID: "udid-1", UserID: "user-id-2", CreatedAt: created}
+	if err := store.Save(later); err != nil {
+		t.Fatal(err)
+	}
+	if err := user.DeleteDeviceUsersBefore(store, u.UDID, created); err != nil {
+		t.Fatal(err)
+	}
+	users, err = store.DeviceUsers(u.UDID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].UUID != later.UUID {
+		t.Fatalf("have users %v, want only %s", users, later.UUID)
+	}
+	if have, want := users[0].CreatedAt, created; !have.Equal(want) {
+		t.Errorf("have created at %s, want %s", have, want)
+	}
+	_, err = store.UserByUserID(u.UserID)
+	wantNotFound(t, err)
+
+	if err := store.DeleteDeviceUsers(u.UDID); err != nil {
+		t.Fatal(err)
+	}
+	users, err = store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(users), 0; have != want {
+		t.Errorf("have %d users, want %d", have, want)
+	}
+}
+
+// TestRemoveStore checks the blocked device list.
+func TestRemoveStore(t *testing.T, store remove.Store) {
+	_, err := store.DeviceByUDID("udid-1")
+	wantNotFound(t, err)
+
+	if err := store.Save(&remove.Device{UDID: "udid-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.DeviceByUDID("udid-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete("udid-1"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.DeviceByUDID("udid-1")
+	wantNotFound(t, err)
+}
+
+// TestConfigStore checks the push certificate, DEP tokens and DEP keypair.
+func TestConfigStore(t *testing.T, store storage.ConfigStore) {
+	_, err := store.GetPushCertificate()
+	if err == nil {
+		t.Error("expected an error before a push certificate is saved")
+	}
+
+	key, cert, err := crypto.SimpleSelfSignedRSAKeypair("storetest", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := store.SavePushCertificate(certPEM, keyPEM); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := store.GetPushCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(raw, cert.Raw) {
+		t.Error("push certificate does not match the saved certificate")
+	}
+
+	token := []byte(`{"consumer_key":"CK_storetest","access_token":"AT_storetest"}`)
+	if err := store.AddToken("CK_storetest", token); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := store.DEPTokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 1 {
+		t.Fatalf("have %d DEP tokens, want 1", len(tokens))
+	}
+	if have, want := tokens[0].AccessToken, "AT_storetest"; have != want {
+		t.Errorf("have %s, want %s", have, want)
+	}
+
+	_, first, err := store.DEPKeypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, second, err := store.DEPKeypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !first.Equal(second) {
+		t.Error("expected the generated DEP keypair to be persisted")
+	}
+
+	if err := store.SaveDEPKeypair(key, cert); err != nil {
+		t.Fatal(err)
+	}
+	_, saved, err := store.DEPKeypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !saved.Equal(cert) {
+		t.Error("expected the saved DEP keypair to replace the generated one")
+	}
+}
+
+// TestDEPSyncStore checks the DEP cursors, auto-assign retries and auto
+// assigners, which are kept separately for each DEP token.
+func TestDEPSyncStore(t *testing.T, store storage.DEPSyncStore) {
+	cursor, err := store.LoadCursor("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cursor.Value != "" {
+		t.Errorf("have cursor %s, want an empty cursor", cursor.Value)
+	}
+	if err := store.SaveCursor("", sync.Cursor{Value: "cursor-1", CreatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveCursor("school", sync.Cursor{Value: "cursor-2", CreatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	cursors := []struct {
+		tokenName string
+		want      string
+	}{
+		{"", "cursor-1"},
+		{config.DefaultDEPTokenName, "cursor-1"},
+		{"school", "cursor-2"},
+		{"office", ""},
+	}
+	for _, tt := range cursors {
+		cursor, err = store.LoadCursor(tt.tokenName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have, want := cursor.Value, tt.want; have != want {
+			t.Errorf("token %q: have cursor %s, want %s", tt.tokenName, have, want)
+		}
+	}
+
+	pending := []sync.PendingAssignment{{SerialNumber: "C02RETRY", ProfileUUID: "profile-uuid-1", Attempts: 2}}
+	if err := store.SaveAutoAssignRetries("", pending); err != nil {
+		t.Fatal(err)
+	}
+	retries := []struct {
+		tokenName string
+		want      int
+	}{
+		{config.DefaultDEPTokenName, 1},
+		{"school", 0},
+	}
+	for _, tt := range retries {
+		saved, err := store.LoadAutoAssignRetries(tt.tokenName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(saved) != tt.want {
+			t.Errorf("token %q: have %d auto-assign retries, want %d", tt.tokenName, len(saved), tt.want)
+		} else if tt.want > 0 && saved[0] != pending[0] {
+			t.Errorf("token %q: have retry %+v, want %+v", tt.tokenName, saved[0], pending[0])
+		}
+	}
+	if err := store.SaveAutoAssignRetries("", nil); err != nil {
+		t.Fatal(err)
+	}
+	if saved, err := store.LoadAutoAssignRetries(""); err != nil || len(saved) != 0 {
+		t.Errorf("have auto-assign retries %v (err %v), want none", saved, err)
+	}
+
+	assigner := &sync.AutoAssigner{Filter: "*", ProfileUUID: "profile-uuid-1"}
+	if err := store.SaveAutoAssigner(assigner); err != nil {
+		t.Fatal(err)
+	}
+	schoolAssigner := &sync.AutoAssigner{Filter: "*", ProfileUUID: "profile-uuid-2", TokenName: "school"}
+	if err := store.SaveAutoAssigner(schoolAssigner); err != nil {
+		t.Fatal(err)
+	}
+	assigners, err := store.LoadAutoAssigners("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(assigners) != 1 {
+		t.Fatalf("have %d auto assigners, want 1", len(assigners))
+	}
+	if have, want := assigners[0].ProfileUUID, assigner.ProfileUUID; have != want {
+		t.Errorf("have %s, want %s", have, want)
+	}
+	if have, want := assigners[0].TokenName, config.DefaultDEPTokenName; have != want {
+		t.Errorf("have token name %s, want %s", have, want)
+	}
+	assigners, err = store.LoadAutoAssigners("school")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(assigners) != 1 {
+		t.Fatalf("have %d school auto assigners, want 1", len(assigners))
+	}
+	if have, want := assigners[0].ProfileUUID, schoolAssigner.ProfileUUID; have != want {
+		t.Errorf("have %s, want %s", have, want)
+	}
+	if have, want := assigners[0].Filter, "*"; have != want {
+		t.Errorf("have filter %s, want %s", have, want)
+	}
+
+	if err := store.DeleteAutoAssigner("", assigner.Filter); err != nil {
+		t.Fatal(err)
+	}
+	assigners, err = store.LoadAutoAssigners("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(assigners), 0; have != want {
+		t.Errorf("have %d auto assigners, want %d", have, want)
+	}
+	assigners, err = store.LoadAutoAssigners("school")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(assigners), 1; have != want {
+		t.Errorf("have %d school auto assigners after deleting the default one, want %d", have, want)
+	}
+
+	// rule filters may contain the characters which separate keys.
+	ruleAssigner := &sync.AutoAssigner{
+		Filter:      "description^=MBP 13.3/2.0GHZ;serial~=^C02:?",
+		ProfileUUID: "profile-uuid-3",
+		TokenName:   "school",
+		Priority:    10,
+	}
+	if err := store.SaveAutoAssigner(ruleAssigner); err != nil {
+		t.Fatal(err)
+	}
+	assigners, err = store.LoadAutoAssigners("school")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, a := range assigners {
+		if a.Filter == ruleAssigner.Filter {
+			found = true
+			if a != *ruleAssigner {
+				t.Errorf("have %+v, want %+v", a, *ruleAssigner)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("rule auto-assigner not found in %+v", assigners)
+	}
+	if err := store.DeleteAutoAssigner("school", ruleAssigner.Filter); err != nil {
+		t.Fatal(err)
+	}
+	assigners, err = store.LoadAutoAssigners("school")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(assigners), 1; have != want {
+		t.Errorf("have %d school auto assigners after deleting the rule, want %d", have, want)
+	}
+}
+
+// TestDEPProfileStore checks the versions of the DEP profile library and the
+// intended profile assignments.
+func TestDEPProfileStore(t *testing.T, store depapi.Store) {
+	// names may contain the characters which separate keys.
+	const name = "Staff 2/2: Laptops"
+	for i, uuid := range []string{"uuid-1", "uuid-2"} {
+		v := &depapi.ProfileVersion{
+			TokenName:   "default",
+			Name:        name,
+			Version:     i + 1,
+			ProfileUUID: uuid,
+			Profile:     &dep.Profile{ProfileName: name, IsSupervised: i == 1},
+			CreatedAt:   time.Now().UTC().Truncate(time.Second),
+		}
+		if err := store.SaveProfileVersion(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, v := range []depapi.ProfileVersion{
+		{TokenName: "default", Name: "Staff 2", Version: 1, ProfileUUID: "uuid-3"},
+		{TokenName: "school", Name: name, Version: 1, ProfileUUID: "uuid-4"},
+	} {
+		if err := store.SaveProfileVersion(&v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	versions, err := store.ProfileVersions("default", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(versions), 2; have != want {
+		t.Fatalf("have %d versions, want %d", have, want)
+	}
+	if v := versions[1]; v.Version != 2 || v.ProfileUUID != "uuid-2" || !v.Profile.IsSupervised {
+		t.Errorf("have latest version %+v", v)
+	}
+
+	profiles, err := store.ListProfiles("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(profiles), 2; have != want {
+		t.Fatalf("have %d profiles, want %d", have, want)
+	}
+	for _, p := range profiles {
+		if p.Name == name && p.Version != 2 {
+			t.Errorf("have version %d of %s in list, want latest", p.Version, name)
+		}
+	}
+
+	if err := store.DeleteProfile("default", name); err != nil {
+		t.Fatal(err)
+	}
+	wantNotFound(t, store.DeleteProfile("default", name))
+	versions, err = store.ProfileVersions("school", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(versions), 1; have != want {
+		t.Errorf("have %d versions of the school profile, want %d", have, want)
+	}
+
+	a := &depapi.Assignment{SerialNumber: "C02XYZ", TokenName: "default", ProfileUUID: "uuid-2"}
+	if err := store.SaveAssignment(a); err != nil {
+		t.Fatal(err)
+	}
+	a.ProfileUUID = "uuid-3"
+	if err := store.SaveAssignment(a); err != nil {
+		t.Fatal(err)
+	}
+	assignments, err := store.Assignments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(assignments) != 1 || assignments[0] != *a {
+		t.Errorf("have assignments %+v, want %+v", assignments, *a)
+	}
+	if err := store.DeleteAssignment(a.SerialNumber); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeleteAssignment(a.SerialNumber); err != nil {
+		t.Errorf("delete missing assignment: %s", err)
+	}
+	assignments, err = store.Assignments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(assignments) != 0 {
+		t.Errorf("have assignments %+v after delete", assignments)
+	}
+}
+
+// TestGroupStore checks groups and their members, which are deleted with the
+// group.
+func TestGroupStore(t *testing.T, store group.Store) {
+	// names may contain the characters which separate keys.
+	const name = "Staff 2/2: Laptops"
+	_, err := store.GroupByName(name)
+	wantNotFound(t, err)
+	wantNotFound(t, store.Delete(name))
+
+	g := &group.Group{Name: name, Filter: "os_version<14 and enrolled"}
+	if err := store.Save(g); err != nil {
+		t.Fatal(err)
+	}
+	g.Description = "laptops of the staff"
+	if err := store.Save(g); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(&group.Group{Name: "Staff 2", Serials: []string{"C02ABC"}}); err != nil {
+		t.Fatal(err)
+	}
+	have, err := store.GroupByName(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have.Description != g.Description || have.Filter != g.Filter {
+		t.Errorf("have group %+v, want %+v", have, g)
+	}
+	groups, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(groups), 2; have != want {
+		t.Errorf("have %d groups, want %d", have, want)
+	}
+
+	for _, m := range []group.Member{
+		{UUID: "uuid-1", SerialNumber: "C02ABC"},
+		{UUID: "uuid-2", UDID: "UDID-2", SerialNumber: "C02DEF"},
+	} {
+		if err := store.SaveMember(name, &m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.SaveMember("Staff 2", &group.Member{UUID: "uuid-1", SerialNumber: "C02ABC"}); err != nil {
+		t.Fatal(err)
+	}
+	// devices which enroll get a UDID.
+	if err := store.SaveMember(name, &group.Member{UUID: "uuid-1", UDID: "UDID-1", SerialNumber: "C02ABC"}); err != nil {
+		t.Fatal(err)
+	}
+	members, err := store.Members(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(members), 2; have != want {
+		t.Fatalf("have %d members, want %d", have, want)
+	}
+	m, err := store.Member(name, "uuid-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := m.UDID, "UDID-1"; have != want {
+		t.Errorf("have member UDID %q, want %q", have, want)
+	}
+	_, err = store.Member("Staff 2", "uuid-2")
+	wantNotFound(t, err)
+
+	if err := store.DeleteMember(name, "uuid-2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeleteMember(name, "uuid-2"); err != nil {
+		t.Errorf("delete missing member: %s", err)
+	}
+	members, err = store.Members(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 1 || members[0].UUID != "uuid-1" {
+		t.Errorf("have members %+v, want uuid-1", members)
+	}
+
+	if err := store.Delete(name); err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.GroupByName(name)
+	wantNotFound(t, err)
+	members, err = store.Members(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 0 {
+		t.Errorf("have members %+v of a deleted group", members)
+	}
+	members, err = store.Members("Staff 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(members), 1; have != want {
+		t.Errorf("have %d members of another group, want %d", have, want)
+	}
+}
+
+// TestStaleStore checks that stale device actions are listed oldest first and
+// replaced by ID.
+func TestStaleStore(t *testing.T, store stale.Store) {
+	now := time.Now().UTC()
+	for _, a := range []stale.Action{
+		{ID: "action-2", Time: now.Add(time.Hour), Type: stale.WipeQueued, UUID: "uuid-1", UDID: "UDID-1"},
+		{ID: "action-1", Time: now, Type: stale.MarkedStale, UUID: "uuid-1", UDID: "UDID-1"},
+		{ID: "action-2", Time: now.Add(time.Hour), Type: stale.WipeQueued, UUID: "uuid-1", UDID: "UDID-1", CommandUUID: "command-1"},
+	} {
+		if err := store.Save(&a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	actions, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(actions), 2; have != want {
+		t.Fatalf("have %d actions, want %d", have, want)
+	}
+	if actions[0].ID != "action-1" || actions[1].CommandUUID != "command-1" {
+		t.Errorf("have actions %+v, want action-1 then the replaced action-2", actions)
+	}
+}
+
+// TestLeaderStore checks that a lease has a single holder until it expires.
+func TestLeaderStore(t *testing.T, store leader.Store) {
+	now := time.Now()
+	acquire := func(holder string, now time.Time, want bool) {
+		t.Helper()
+		held, err := store.AcquireLease("workers", holder, now, now.Add(time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if held != want {
+			t.Errorf("%s: have held %v, want %v", holder, held, want)
+		}
+	}
+	acquire("server-1", now, true)
+	acquire("server-2", now.Add(time.Second), false)
+	// the holder renews its lease.
+	acquire("server-1", now.Add(30*time.Second), true)
+	acquire("server-2", now.Add(time.Minute), false)
+	// another server takes over an expired lease.
+	acquire("server-2", now.Add(2*time.Minute), true)
+	acquire("server-1", now.Add(2*time.Minute), false)
+
+	// only one of the servers racing for a lease gets it.
+	const n = 10
+	results := make(chan bool, n)
+	for i := 0; i < n; i++ {
+		go func(holder string) {
+			held, err := store.AcquireLease("race", holder, now, now.Add(time.Minute))
+			if err != nil {
+				t.Error(err)
+			}
+			results <- held
+		}(fmt.Sprintf("server-%d", i))
+	}
+	var held int
+	for i := 0; i < n; i++ {
+		if <-results {
+			held++
+		}
+	}
+	if held != 1 {
+		t.Errorf("have %d holders of the lease, want 1", held)
+	}
+}
+
+// TestSCEPDepot checks the CA, serial numbers and issued certificates.
+func TestSCEPDepot(t *testing.T, depot storage.SCEPDepot) {
+	key, err := depot.CreateOrLoadKey(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := depot.CreateOrLoadCA(key, 1, "MicroMDM", "US")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, err := depot.CreateOrLoadCA(key, 1, "MicroMDM", "US"); err != nil {
+		t.Fatal(err)
+	} else if !again.Equal(ca) {
+		t.Error("expected the CA to be persisted")
+	}
+	chain, _, err := depot.CA(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain) != 1 || !chain[0].Equal(ca) {
+		t.Error("CA chain does not contain the CA certificate")
+	}
+
+	serial, err := depot.Serial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, cert, err := crypto.SimpleSelfSignedRSAKeypair("device", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := depot.Put(cert.Subject.CommonName, cert); err != nil {
+		t.Fatal(err)
+	}
+	next, err := depot.Serial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := next.Int64(), serial.Int64()+1; have != want {
+		t.Errorf("have serial %d, want %d", have, want)
+	}
+	hasCN, err := depot.HasCN(cert.Subject.CommonName, 0, cert, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasCN {
+		t.Error("expected the issued certificate to be found")
+	}
+
+	// certificates issued at the same time get different serials.
+	const n = 10
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() { errs <- depot.Put(cert.Subject.CommonName, cert) }()
+	}
+	for i := 0; i < n; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	issued := next
+	if next, err = depot.Serial(); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := next.Int64(), issued.Int64()+n; have != want {
+		t.Errorf("have serial %d after concurrent certificates, want %d", have, want)
+	}
+
+	importer, ok := depot.(storage.SCEPImporter)
+	if !ok {
+		return
+	}
+	_, imported, err := crypto.SimpleSelfSignedRSAKeypair("imported", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// importing twice must not fail.
+	for i := 0; i < 2; i++ {
+		if err := importer.ImportCertificate("imported.7", imported); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if hasCN, err := depot.HasCN("imported", 0, imported, false); err != nil {
+		t.Fatal(err)
+	} else if !hasCN {
+		t.Error("expected the imported certificate to be found")
+	}
+	if err := importer.ImportCA(key, ca, big.NewInt(1)); err != nil {
+		t.Fatal(err)
+	}
+	if have, err := depot.Serial(); err != nil {
+		t.Fatal(err)
+	} else if have.Cmp(next) != 0 {
+		t.Errorf("have serial %s, want %s", have, next)
+	}
+}
@@ -1,14 +1,17 @@
 package builtin
 
 import (
-	"cloud.google.com/go/firestore"
 	"context"
 	"fmt"
+
+	"cloud.google.com/go/firestore"
 	"github.com/boltdb/bolt"
 	"github.com/go-kit/kit/log"
 	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
 	"github.com/vishnuvaradaraj/micromdm/platform/user"
-	"google.golang.org/api/iterator"
 )
 
 const (
@@ -17,147 +20,120 @@ const (
 	userIndexBucket = "mdm.UserIdx"
 )
 
+// FireDB stores users in Google Cloud Firestore, keyed by UUID.
+// The UDID and UserID are stored next to the record so they can be queried.
 type FireDB struct {
 	*firestore.Client
 }
 
+type userDoc struct {
+	UDID   string `firestore:"udid"`
+	UserID string `firestore:"user_id"`
+	Data   []byte `firestore:"data"`
+}
+
 func NewFireDB(db *firestore.Client) (*FireDB, error) {
 	datastore := &FireDB{Client: db}
 	return datastore, nil
 }
 
 func (db *FireDB) List() ([]user.User, error) {
-	var users []user.User
-
-	ctx := context.Background()
-
-	iter := db.Collection(UserBucket).Documents(ctx)
-	for {
-		doc, err := iter.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			return nil, err
-		}
-
-		var u user.User
-		doc.DataTo(&u)
-
-		users = append(users, u)
-	}
-
-	return users, nil
+	users, err := db.usersByQuery(db.Collection(UserBucket).Query)
+	return users, errors.Wrap(err, "list users")
 }
 
 func (db *FireDB) Save(u *user.User) error {
-
-	ctx := context.Background()
-
-	_, err := db.Collection(UserBucket).Doc(u.UDID).Set(ctx, u)
+	userpb, err := user.MarshalUser(u)
 	if err != nil {
-		return err
+		return errors.Wrap(err, "marshalling user")
 	}
-
-	return nil
+	doc := userDoc{
+		UDID:   u.UDID,
+		UserID: u.UserID,
+		Data:   userpb,
+	}
+	_, err = db.Collection(UserBucket).Doc(u.UUID).Set(context.Background(), doc)
+	return errors.Wrap(err, "store user in firestore")
 }
 
 func (db *FireDB) User(uuid string) (*user.User, error) {
-
-	var u user.User
-
-	ctx := context.Background()
-
-	doc, err := db.Collection(UserBucket).Doc(uuid).Get(ctx)
-	if err != nil {
-		return nil, &notFound{"User","Not found"}
+	snap, err := db.Collection(UserBucket).Doc(uuid).Get(context.Background())
+	if status.Code(err) == codes.NotFound {
+		err = &notFound{"User", fmt.Sprintf("uuid %s", uuid)}
 	}
-
-	err = doc.DataTo(&u)
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrap(err, "get user by uuid from firestore")
 	}
-
-	return &u, nil
+	return userFromSnapshot(snap)
 }
 
 func (db *FireDB) UserByUserID(userID string) (*user.User, error) {
-
-	var u user.User
-
-	ctx := context.Background()
-
-	q := db.Collection(UserBucket).Where("UserID", "==", userID).Limit(1)
-	query := q.Documents(ctx)
-	docs, err := query.GetAll()
-	if err != nil {
-		return nil, err
+	q := db.Collection(UserBucket).Where("user_id", "==", userID).Limit(1)
+	users, err := db.usersByQuery(q)
+	if err == nil && len(users) == 0 {
+		err = &notFound{"User", fmt.Sprintf("user id %s", userID)}
 	}
-
-	if (len(docs)>0) {
-
-		var u user.User
-
-		doc := docs[0]
-		doc.DataTo(&u)
-
-	} else {
-		return nil, &notFound{"User","Not found"}
+	if err != nil {
+		return nil, errors.Wrap(err, "get user by user id from firestore")
 	}
-
-	return &u, nil
+	return &users[0], nil
 }
 
 func (db *FireDB) DeviceUsers(udid string) ([]user.User, error) {
+	users, err := db.usersByQuery(db.Collection(UserBucket).Where("udid", "==", udid))
+	if err != nil {
+		return nil, errors.Wrap(err, "get device users")
+	}
+	return users, nil
+}
 
-	var users []user.User
-
+func (db *FireDB) DeleteDeviceUsers(udid string) error {
 	ctx := context.Background()
+	docs, err := db.Collection(UserBucket).Where("udid", "==", udid).Documents(ctx).GetAll()
+	if err != nil {
+		return errors.Wrapf(err, "delete users for UDID %s", udid)
+	}
+	for _, snap := range docs {
+		if _, err := snap.Ref.Delete(ctx); err != nil {
+			return errors.Wrapf(err, "delete users for UDID %s", udid)
+		}
+	}
+	return nil
+}
 
-	q := db.Collection(UserBucket).Where("UDID", "==", udid)
-	query := q.Documents(ctx)
+func (db *FireDB) Delete(uuid string) error {
+	_, err := db.Collection(UserBucket).Doc(uuid).Delete(context.Background())
+	return errors.Wrapf(err, "delete user %s from firestore", uuid)
+}
 
-	docs, err := query.GetAll()
+func (db *FireDB) usersByQuery(q firestore.Query) ([]user.User, error) {
+	docs, err := q.Documents(context.Background()).GetAll()
 	if err != nil {
 		return nil, err
 	}
-
-	if (len(docs)>0) {
-
-		for i := 0; i < len(docs); i++ {
-			var u user.User
-
-			doc := docs[i]
-			doc.DataTo(&u)
-
-			users = append(users, u)
+	var users []user.User
+	for _, snap := range docs {
+		u, err := userFromSnapshot(snap)
+		if err != nil {
+			return nil, err
 		}
-
+		users = append(users, *u)
 	}
-
 	return users, nil
 }
 
-func (db *FireDB) DeleteDeviceUsers(udid string) error {
-
-	ctx := context.Background()
-
-	q := db.Collection(UserBucket).Where("UDID", "==", udid)
-	query := q.Documents(ctx)
-
-	docs, err := query.GetAll()
-	if err != nil {
-		return err
+func userFromSnapshot(snap *firestore.DocumentSnapshot) (*user.User, error) {
+	var doc userDoc
+	if err := snap.DataTo(&doc); err != nil {
+		return nil, errors.Wrap(err, "decode user document")
 	}
-
-	for i := 0; i < len(docs); i++ {
-		docs[i].Ref.Delete(ctx)
+	var u user.User
+	if err := user.UnmarshalUser(doc.Data, &u); err != nil {
+		return nil, err
 	}
-
-	return nil
+	return &u, nil
 }
 
-
 //////////////////////////////////////////////////////////////////////////
 
 type DB struct {
@@ -265,7 +241,7 @@ func (db *DB) UserByUserID(userID string) (*user.User, error) {
 			return &notFound{"User", fmt.Sprintf("user id %s", userID)}
 		}
 		v := b.Get(idx)
-		if idx == nil {
+		if v == nil {
 			return &notFound{"User", fmt.Sprintf("uuid %s", string(idx))}
 		}
 		return user.UnmarshalUser(v, &u)
@@ -319,6 +295,32 @@ func (db *DB) DeleteDeviceUsers(udid string) error {
 	return errors.Wrapf(err, "delete users for UDID %s", udid)
 }
 
+func (db *DB) Delete(uuid string) error {
+	err := db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(UserBucket))
+		v := b.Get([]byte(uuid))
+		if v == nil {
+			return nil
+		}
+		var u user.User
+		if err := user.UnmarshalUser(v, &u); err != nil {
+			return errors.Wrap(err, "unmarshal user for Delete")
+		}
+		// only remove the indexes which still reference this user.
+		ib := tx.Bucket([]byte(userIndexBucket))
+		for _, idx := range []string{u.UDID, u.UserID} {
+			if idx == "" || string(ib.Get([]byte(idx))) != uuid {
+				continue
+			}
+			if err := ib.Delete([]byte(idx)); err != nil {
+				return errors.Wrapf(err, "delete index %s of user %s", idx, uuid)
+			}
+		}
+		return b.Delete([]byte(uuid))
+	})
+	return errors.Wrapf(err, "delete user %s from bolt", uuid)
+}
+
 type notFound struct {
 	ResourceType string
 	Message      string
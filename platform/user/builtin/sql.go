@@ -0,0 +1,96 @@
+package builtin
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/storage/sqldb"
+	"github.com/vishnuvaradaraj/micromdm/platform/user"
+)
+
+// SQLDB stores users in a SQL database, keyed by UUID.
+type SQLDB struct {
+	*sqldb.DB
+}
+
+func NewSQLDB(db *sqldb.DB) (*SQLDB, error) {
+	datastore := &SQLDB{DB: db}
+	return datastore, nil
+}
+
+func (db *SQLDB) List() ([]user.User, error) {
+	users, err := db.usersByQuery(`SELECT data FROM users ORDER BY uuid`)
+	return users, errors.Wrap(err, "list users")
+}
+
+func (db *SQLDB) Save(u *user.User) error {
+	userpb, err := user.MarshalUser(u)
+	if err != nil {
+		return errors.Wrap(err, "marshalling user")
+	}
+	_, err = db.Exec(db.Upsert("users", "uuid", "uuid", "udid", "user_id", "data"),
+		u.UUID, u.UDID, u.UserID, userpb)
+	return errors.Wrap(err, "store user in sql")
+}
+
+func (db *SQLDB) User(uuid string) (*user.User, error) {
+	users, err := db.usersByQuery(`SELECT data FROM users WHERE uuid = ?`, uuid)
+	if err == nil && len(users) == 0 {
+		err = &notFound{"User", fmt.Sprintf("uuid %s", uuid)}
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "get user by uuid from sql")
+	}
+	return &users[0], nil
+}
+
+func (db *SQLDB) UserByUserID(userID string) (*user.User, error) {
+	users, err := db.usersByQuery(`SELECT data FROM users WHERE user_id = ? ORDER BY uuid`, userID)
+	if err == nil && len(users) == 0 {
+		err = &notFound{"User", fmt.Sprintf("user id %s", userID)}
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "get user by user id from sql")
+	}
+	return &users[0], nil
+}
+
+func (db *SQLDB) DeviceUsers(udid string) ([]user.User, error) {
+	users, err := db.usersByQuery(`SELECT data FROM users WHERE udid = ? ORDER BY uuid`, udid)
+	if err != nil {
+		return nil, errors.Wrap(err, "get device users")
+	}
+	return users, nil
+}
+
+func (db *SQLDB) DeleteDeviceUsers(udid string) error {
+	_, err := db.Exec(`DELETE FROM users WHERE udid = ?`, udid)
+	return errors.Wrapf(err, "delete users for UDID %s", udid)
+}
+
+func (db *SQLDB) Delete(uuid string) error {
+	_, err := db.Exec(`DELETE FROM users WHERE uuid = ?`, uuid)
+	return errors.Wrapf(err, "delete user %s from sql", uuid)
+}
+
+func (db *SQLDB) usersByQuery(query string, args ...interface{}) ([]user.User, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var users []user.User
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var u user.User
+		if err := user.UnmarshalUser(data, &u); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
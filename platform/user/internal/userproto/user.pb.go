@@ -36,6 +36,7 @@ type User struct {
 	AuthToken     string `protobuf:"bytes,6,opt,name=auth_token,json=authToken" json:"auth_token,omitempty"`
 	PasswordHash  []byte `protobuf:"bytes,7,opt,name=password_hash,json=passwordHash,proto3" json:"password_hash,omitempty"`
 	Hidden        bool   `protobuf:"varint,8,opt,name=hidden" json:"hidden,omitempty"`
+	CreatedAt     int64  `protobuf:"varint,9,opt,name=created_at,json=createdAt" json:"created_at,omitempty"`
 }
 
 func (m *User) Reset()                    { *m = User{} }
@@ -99,6 +100,13 @@ func (m *User) GetHidden() bool {
 	return false
 }
 
+func (m *User) GetCreatedAt() int64 {
+	if m != nil {
+		return m.CreatedAt
+	}
+	return 0
+}
+
 func init() {
 	proto.RegisterType((*User)(nil), "userproto.User")
 }
@@ -106,18 +114,19 @@ func init() {
 func init() { proto.RegisterFile("user.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 206 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x34, 0xcf, 0xbf, 0x4a, 0x04, 0x31,
-	0x10, 0x06, 0x70, 0xa2, 0x6b, 0xee, 0x76, 0x58, 0x2d, 0xa6, 0xd0, 0x34, 0xc2, 0xa2, 0x08, 0x5b,
-	0xd9, 0xf8, 0x12, 0x0a, 0x56, 0xab, 0xd6, 0x21, 0x32, 0xc1, 0x04, 0x35, 0x39, 0xf2, 0x07, 0x1f,
-	0xdb, 0x57, 0x38, 0x66, 0xd8, 0xeb, 0xbe, 0xf9, 0xcd, 0x97, 0xc0, 0x00, 0xf4, 0xea, 0xcb, 0xe3,
-	0xa1, 0xe4, 0x96, 0x71, 0xe4, 0x2c, 0xf1, 0xee, 0x5f, 0xc1, 0xf0, 0x51, 0x7d, 0x41, 0x84, 0xa1,
-	0xf7, 0x48, 0x46, 0xcd, 0x6a, 0x19, 0x57, 0xc9, 0x62, 0x14, 0xc9, 0x9c, 0x6d, 0x46, 0x91, 0xf0,
-	0x06, 0x76, 0xfc, 0xda, 0x46, 0x32, 0xe7, 0xc2, 0x9a, 0xc7, 0x17, 0xc2, 0x07, 0xb8, 0x92, 0x45,
-	0x0d, 0xb9, 0xb4, 0xe4, 0x7e, 0xbd, 0x19, 0x64, 0x7f, 0xc9, 0xfa, 0x76, 0x42, 0xbc, 0x07, 0x01,
-	0xfb, 0x93, 0xd3, 0x97, 0xb4, 0x2e, 0xa4, 0x35, 0x31, 0xbe, 0x6e, 0x86, 0xb7, 0x00, 0xae, 0xb7,
-	0x60, 0x5b, 0xfe, 0xf6, 0xc9, 0x68, 0x69, 0x8c, 0x2c, 0xef, 0x0c, 0xfc, 0xc7, 0xc1, 0xd5, 0xfa,
-	0x97, 0x0b, 0xd9, 0xe0, 0x6a, 0x30, 0xbb, 0x59, 0x2d, 0xd3, 0x3a, 0x9d, 0xf0, 0xd9, 0xd5, 0x80,
-	0xd7, 0xa0, 0x43, 0x24, 0xf2, 0xc9, 0xec, 0x67, 0xb5, 0xec, 0xd7, 0x6d, 0xfa, 0xd4, 0x72, 0xf8,
-	0xd3, 0x31, 0x00, 0x00, 0xff, 0xff, 0x35, 0xa8, 0xcb, 0x32, 0x11, 0x01, 0x00, 0x00,
+	// 222 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x34, 0xd0, 0xb1, 0x4a, 0x04, 0x31,
+	0x10, 0x06, 0x60, 0x72, 0xb7, 0xee, 0x5d, 0x86, 0xd5, 0x22, 0x85, 0x4e, 0x23, 0x2c, 0x8a, 0xb0,
+	0x95, 0x8d, 0x4f, 0x60, 0xa7, 0x60, 0xb5, 0x6a, 0x1d, 0xa2, 0x13, 0x4c, 0x50, 0x37, 0x47, 0x92,
+	0xc5, 0xb7, 0xf0, 0x99, 0x8f, 0x19, 0x72, 0xdd, 0x3f, 0xdf, 0xfc, 0x99, 0x22, 0x00, 0x6b, 0xf1,
+	0xf9, 0xfe, 0x90, 0x53, 0x4d, 0x46, 0x73, 0x96, 0x78, 0xf3, 0xbf, 0x81, 0xee, 0xbd, 0xf8, 0x6c,
+	0x0c, 0x74, 0xeb, 0x1a, 0x09, 0xd5, 0xa8, 0x26, 0x3d, 0x4b, 0x16, 0xa3, 0x48, 0xb8, 0x69, 0x46,
+	0x91, 0xcc, 0x15, 0xec, 0xf8, 0xb5, 0x8d, 0x84, 0x5b, 0xe1, 0x9e, 0xc7, 0x67, 0x32, 0x77, 0x70,
+	0x21, 0x8b, 0x12, 0x52, 0xae, 0x8b, 0xfb, 0xf5, 0xd8, 0xc9, 0xfe, 0x9c, 0xf5, 0xf5, 0x84, 0xe6,
+	0x16, 0x04, 0xec, 0x4f, 0x5a, 0xbe, 0xa4, 0x75, 0x26, 0xad, 0x81, 0xf1, 0xa5, 0x99, 0xb9, 0x06,
+	0x70, 0x6b, 0x0d, 0xb6, 0xa6, 0x6f, 0xbf, 0x60, 0x2f, 0x0d, 0xcd, 0xf2, 0xc6, 0xc0, 0x37, 0x0e,
+	0xae, 0x94, 0xbf, 0x94, 0xc9, 0x06, 0x57, 0x02, 0xee, 0x46, 0x35, 0x0d, 0xf3, 0x70, 0xc2, 0x27,
+	0x57, 0x82, 0xb9, 0x84, 0x3e, 0x44, 0x22, 0xbf, 0xe0, 0x7e, 0x54, 0xd3, 0x7e, 0x6e, 0x13, 0xdf,
+	0xfe, 0xcc, 0xde, 0x55, 0x4f, 0xd6, 0x55, 0xd4, 0xa3, 0x9a, 0xb6, 0xb3, 0x6e, 0xf2, 0x58, 0x3f,
+	0x7a, 0xf9, 0x97, 0x87, 0xe3, 0x00, 0x6b, 0x75, 0x7e, 0x4f, 0x30, 0x01, 0x00, 0x00,
 }
@@ -2,6 +2,8 @@
 package user
 
 import (
+	"time"
+
 	"github.com/gogo/protobuf/proto"
 	"github.com/pkg/errors"
 	uuid "github.com/satori/go.uuid"
@@ -18,6 +20,9 @@ type User struct {
 	AuthToken     string `json:"auth_token"`
 	PasswordHash  []byte `json:"password_hash"`
 	Hidden        bool   `json:"hidden"`
+	// CreatedAt is when the user was created. It is zero for users created
+	// before it was recorded.
+	CreatedAt time.Time `json:"created_at,omitempty"`
 }
 
 func NewFromRequest(u User) (*User, error) {
@@ -27,6 +32,7 @@ func NewFromRequest(u User) (*User, error) {
 		UserLongname:  u.UserLongname,
 		PasswordHash:  u.PasswordHash,
 		Hidden:        u.Hidden,
+		CreatedAt:     time.Now().UTC(),
 	}
 	return &newUser, nil
 }
@@ -42,6 +48,9 @@ func MarshalUser(u *User) ([]byte, error) {
 		PasswordHash:  u.PasswordHash,
 		Hidden:        u.Hidden,
 	}
+	if !u.CreatedAt.IsZero() {
+		pb.CreatedAt = u.CreatedAt.UnixNano()
+	}
 	return proto.Marshal(&pb)
 }
 
@@ -58,5 +67,8 @@ func UnmarshalUser(data []byte, u *User) error {
 	u.AuthToken = pb.GetAuthToken()
 	u.PasswordHash = pb.GetPasswordHash()
 	u.Hidden = pb.GetHidden()
+	if pb.GetCreatedAt() != 0 {
+		u.CreatedAt = time.Unix(0, pb.GetCreatedAt()).UTC()
+	}
 	return nil
 }
@@ -2,6 +2,7 @@ package user
 
 import (
 	"context"
+	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
@@ -18,6 +19,31 @@ type WorkerStore interface {
 	UserByUserID(userID string) (*User, error)
 }
 
+// ResetStore removes the users a device kept from a previous enrollment.
+type ResetStore interface {
+	DeviceUsers(udid string) ([]User, error)
+	Delete(uuid string) error
+}
+
+// DeleteDeviceUsersBefore deletes the users of a device which were created
+// before t, keeping those which checked in after it re-enrolled. Users without
+// a creation time are deleted.
+func DeleteDeviceUsersBefore(db ResetStore, udid string, t time.Time) error {
+	users, err := db.DeviceUsers(udid)
+	if err != nil {
+		return errors.Wrapf(err, "get users of device %s", udid)
+	}
+	for _, u := range users {
+		if !u.CreatedAt.Before(t) {
+			continue
+		}
+		if err := db.Delete(u.UUID); err != nil {
+			return errors.Wrapf(err, "delete user %s of device %s", u.UserID, udid)
+		}
+	}
+	return nil
+}
+
 type Worker struct {
 	db     WorkerStore
 	sub    pubsub.Subscriber
@@ -83,6 +109,7 @@ func (w *Worker) updateUserFromTokenUpdate(ctx context.Context, message []byte)
 			)
 		}
 		usr.UUID = uuid.NewV4().String()
+		usr.CreatedAt = ev.Time
 	}
 
 	usr.UDID = ev.Command.UDID
@@ -2,51 +2,46 @@ package server
 
 import (
 	"bytes"
-	"cloud.google.com/go/firestore"
 	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/pem"
-	"firebase.google.com/go"
 	"fmt"
-	"google.golang.org/api/option"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"os"
 	"path/filepath"
 	"time"
 
-	"github.com/RobotsAndPencils/buford/push"
 	"github.com/boltdb/bolt"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
+	"github.com/go-kit/kit/metrics/expvar"
 	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
 	boltdepot "github.com/vishnuvaradaraj/scep/depot/bolt"
 	scep "github.com/vishnuvaradaraj/scep/server"
 	"golang.org/x/crypto/pkcs12"
 
 	"github.com/vishnuvaradaraj/micromdm/dep"
+	"github.com/vishnuvaradaraj/micromdm/dep/depsim"
 	"github.com/vishnuvaradaraj/micromdm/mdm"
 	"github.com/vishnuvaradaraj/micromdm/mdm/enroll"
 	"github.com/vishnuvaradaraj/micromdm/pkg/crypto"
 	"github.com/vishnuvaradaraj/micromdm/platform/apns"
-	apnsbuiltin "github.com/vishnuvaradaraj/micromdm/platform/apns/builtin"
 	"github.com/vishnuvaradaraj/micromdm/platform/command"
 	"github.com/vishnuvaradaraj/micromdm/platform/config"
-	configbuiltin "github.com/vishnuvaradaraj/micromdm/platform/config/builtin"
 	"github.com/vishnuvaradaraj/micromdm/platform/dep/sync"
-	syncbuiltin "github.com/vishnuvaradaraj/micromdm/platform/dep/sync/builtin"
 	"github.com/vishnuvaradaraj/micromdm/platform/device"
-	devicebuiltin "github.com/vishnuvaradaraj/micromdm/platform/device/builtin"
+	"github.com/vishnuvaradaraj/micromdm/platform/leader"
+	"github.com/vishnuvaradaraj/micromdm/platform/nudge"
 	"github.com/vishnuvaradaraj/micromdm/platform/profile"
-	profilebuiltin "github.com/vishnuvaradaraj/micromdm/platform/profile/builtin"
 	"github.com/vishnuvaradaraj/micromdm/platform/pubsub"
 	"github.com/vishnuvaradaraj/micromdm/platform/pubsub/inmem"
-	"github.com/vishnuvaradaraj/micromdm/platform/queue"
 	block "github.com/vishnuvaradaraj/micromdm/platform/remove"
-	blockbuiltin "github.com/vishnuvaradaraj/micromdm/platform/remove/builtin"
+	"github.com/vishnuvaradaraj/micromdm/platform/storage"
 	"github.com/vishnuvaradaraj/micromdm/workflow/webhook"
-
 )
 
 type Server struct {
@@ -61,15 +56,47 @@ type Server struct {
 	APNSCertificatePath string
 	APNSPrivateKeyPass  string
 	TLSCertPath         string
-	SCEPDepot           *boltdepot.Depot
+	SCEPDepot           storage.SCEPDepot
 	ProfileDB           profile.Store
 	ConfigDB            config.Store
 	RemoveDB            block.Store
 	CommandWebhookURL   string
-	DEPClient           *dep.Client
-	SyncDB              *syncbuiltin.DB
+	// CommandWebhookFormat is the webhook.Format posted to CommandWebhookURL.
+	CommandWebhookFormat string
+	DeviceDB             storage.DeviceStore
+	// DEPClients has a client for each DEP token, keyed by token name.
+	DEPClients map[string]*dep.Client
+	SyncDB     storage.DEPSyncStore
+
+	// Storage is the backend URL for the stores. BoltDB in ConfigPath is used
+	// if empty. The SCEP depot is kept in BoltDB unless a SQL backend is used.
+	Storage string
+	Stores  *storage.Stores
+
+	// Leader is the lease of the server which runs the workers that must
+	// only run once when several servers share the Stores, such as the DEP
+	// sync, nudges and the periodic passes over all devices.
+	Leader *leader.Lease
+
+	// APNSSandbox sends push notifications to the APNs development
+	// environment instead of production.
+	APNSSandbox bool
+	// APNSTokenKeyPath is the .p8 authentication key used for token based
+	// APNs authentication, instead of the push certificate.
+	APNSTokenKeyPath string
+	APNSTokenKeyID   string
+	APNSTokenTeamID  string
+	// APNSPushWorkers and APNSPushRate bound the concurrency and rate per
+	// second of pushes for queued commands.
+	APNSPushWorkers int
+	APNSPushRate    int
+
+	// NudgeInterval is how long a device with pending commands may be idle
+	// before it is pushed again. Nudges are disabled if zero.
+	NudgeInterval    time.Duration
+	NudgeMaxInterval time.Duration
+	NudgeMaxAge      time.Duration
 
-	PushService     *push.Service // bufford push
 	APNSPushService apns.Service
 	CommandService  command.Service
 	MDMService      mdm.Service
@@ -78,28 +105,22 @@ type Server struct {
 	ConfigService   config.Service
 
 	WebhooksHTTPClient *http.Client
-
-	FireDB		*firestore.Client
 }
 
-func (c *Server) Setup(logger log.Logger) error {
+func (c *Server) Setup(ctx context.Context, logger log.Logger) error {
 	if err := c.setupPubSub(); err != nil {
 		return err
 	}
 
-	if err := c.setupBolt(); err != nil {
-		return err
-	}
-
-	if err := c.setupFirebase(); err != nil {
+	if err := c.setupStorage(); err != nil {
 		return err
 	}
 
-	if err := c.setupRemoveService(); err != nil {
+	if err := c.setupLeader(ctx, logger); err != nil {
 		return err
 	}
 
-	if err := c.setupConfigStore(); err != nil {
+	if err := c.setupConfigStore(logger); err != nil {
 		return err
 	}
 
@@ -111,7 +132,7 @@ func (c *Server) Setup(logger log.Logger) error {
 		return err
 	}
 
-	if err := c.setupPushService(logger); err != nil {
+	if err := c.setupPushService(ctx, logger); err != nil {
 		return err
 	}
 
@@ -127,28 +148,14 @@ func (c *Server) Setup(logger log.Logger) error {
 		return err
 	}
 
-	if err := c.setupDepClient(); err != nil {
-		return err
-	}
-
-	if err := c.setupProfileDB(); err != nil {
+	if err := c.setupDepClient(logger); err != nil {
 		return err
 	}
 
-	if err := c.setupEnrollmentService(); err != nil {
+	if err := c.setupEnrollmentService(logger); err != nil {
 		return err
 	}
 
-
-	return nil
-}
-
-func (c *Server) setupProfileDB() error {
-	profileDB, err := profilebuiltin.NewDB(c.DB)
-	if err != nil {
-		return err
-	}
-	c.ProfileDB = profileDB
 	return nil
 }
 
@@ -162,18 +169,62 @@ func (c *Server) setupWebhooks(logger log.Logger) error {
 		return nil
 	}
 
+	format, err := webhook.ParseFormat(c.CommandWebhookFormat)
+	if err != nil {
+		return err
+	}
+
 	ctx := context.Background()
-	ww := webhook.New(c.CommandWebhookURL, c.PubClient, webhook.WithLogger(logger), webhook.WithHTTPClient(c.WebhooksHTTPClient))
+	ww := webhook.New(c.CommandWebhookURL, c.PubClient,
+		webhook.WithLogger(logger),
+		webhook.WithHTTPClient(c.WebhooksHTTPClient),
+		webhook.WithFormat(format),
+		webhook.WithDeviceStore(c.DeviceDB),
+	)
 	go ww.Run(ctx)
 	return nil
 }
 
-func (c *Server) setupRemoveService() error {
-	removeDB, err := blockbuiltin.NewDB(c.DB)
+// setupStorage opens the backend selected by c.Storage. BoltDB is the default
+// and uses the database in the config path.
+func (c *Server) setupStorage() error {
+	var (
+		stores *storage.Stores
+		err    error
+	)
+	if c.Storage == "" || c.Storage == storage.Bolt {
+		if err := c.setupBolt(); err != nil {
+			return err
+		}
+		stores, err = storage.NewBolt(c.DB, c.PubClient)
+	} else {
+		stores, err = storage.Open(context.Background(), c.Storage, c.PubClient)
+	}
 	if err != nil {
+		return errors.Wrap(err, "setup storage")
+	}
+	c.Stores = stores
+	c.DeviceDB = stores.Device
+	c.ProfileDB = stores.Profile
+	c.ConfigDB = stores.Config
+	c.RemoveDB = stores.Remove
+	c.SyncDB = stores.DEPSync
+	return nil
+}
+
+// setupLeader acquires the lease of the singleton workers if no other server
+// holds it, and keeps renewing it. The lease is named after the host, so that a
+// restarted server takes its lease back at once.
+func (c *Server) setupLeader(ctx context.Context, logger log.Logger) error {
+	holder, err := os.Hostname()
+	if err != nil || holder == "" {
+		holder = uuid.NewV4().String()
+	}
+	c.Leader = leader.New(c.Stores.Leader, "workers", holder, log.With(logger, "component", "leader"))
+	if err := c.Leader.Acquire(); err != nil {
 		return err
 	}
-	c.RemoveDB = removeDB
+	go c.Leader.Run(ctx)
 	return nil
 }
 
@@ -187,15 +238,7 @@ func (c *Server) setupCommandService() error {
 }
 
 func (c *Server) setupCommandQueue(logger log.Logger) error {
-	q, err := queue.NewQueue(c.DB, c.PubClient)
-	if err != nil {
-		return err
-	}
-	devDB, err := devicebuiltin.NewDB(c.DB)
-	if err != nil {
-		return errors.Wrap(err, "new device db")
-	}
-
+	q := c.Stores.Queue
 	var mdmService mdm.Service
 	{
 		svc := mdm.NewService(c.PubClient, q)
@@ -203,7 +246,7 @@ func (c *Server) setupCommandQueue(logger log.Logger) error {
 		mdmService = block.RemoveMiddleware(c.RemoveDB)(mdmService)
 
 		udidauthLogger := log.With(logger, "component", "udidcertauth")
-		mdmService = device.UDIDCertAuthMiddleware(devDB, udidauthLogger)(mdmService)
+		mdmService = device.UDIDCertAuthMiddleware(c.DeviceDB, udidauthLogger)(mdmService)
 
 		verifycertLogger := log.With(logger, "component", "verifycert")
 		mdmService = VerifyCertificateMiddleware(c.SCEPDepot, verifycertLogger)(mdmService)
@@ -224,24 +267,6 @@ func (c *Server) setupBolt() error {
 	return nil
 }
 
-func (c *Server) setupFirebase() error {
-	ctx := context.Background()
-
-	// Use a service account
-	sa := option.WithCredentialsFile("/Users/vishnuv/go/src/github.com/vishnuvaradaraj/micromdm/tools/certs/family-protection-dd191-firebase-adminsdk-x7xrc-435ea7bf3a.json")
-	app, err := firebase.NewApp(ctx, nil, sa)
-	if err != nil {
-		return errors.Wrap(err, "opening firebase")
-	}
-
-	c.FireDB, err = app.Firestore(ctx)
-	if err != nil {
-		return errors.Wrap(err, "init firestore")
-	}
-
-	return nil
-}
-
 func (c *Server) loadPushCerts() error {
 	if c.APNSCertificatePath == "" && c.APNSPrivateKeyPass == "" && c.APNSPrivateKeyPath == "" {
 		// this is optional, config could also be provided with mdmctl
@@ -297,24 +322,60 @@ func (c *Server) loadPushCerts() error {
 	return nil
 }
 
+func (c *Server) loadPushToken() (*apns.Token, error) {
+	if c.APNSTokenKeyID == "" || c.APNSTokenTeamID == "" {
+		return nil, errors.New("APNs token authentication requires a key ID and team ID")
+	}
+	p8, err := ioutil.ReadFile(c.APNSTokenKeyPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "read APNs authentication key")
+	}
+	key, err := apns.ParseTokenKey(p8)
+	if err != nil {
+		return nil, err
+	}
+	return &apns.Token{KeyID: c.APNSTokenKeyID, TeamID: c.APNSTokenTeamID, Key: key}, nil
+}
+
 type pushServiceCert struct {
 	*x509.Certificate
 	PrivateKey interface{}
 }
 
-func (c *Server) setupConfigStore() error {
-	db, err := configbuiltin.NewDB(c.DB, c.PubClient)
-	if err != nil {
-		return err
-	}
-	c.ConfigDB = db
-	c.ConfigService = config.New(db)
+func (c *Server) setupConfigStore(logger log.Logger) error {
+	c.ConfigService = config.New(c.ConfigDB)
 
+	expiryWorker := config.NewExpiryWorker(c.ConfigDB, c.PubClient, log.With(logger, "component", "config"))
+	go expiryWorker.Run(context.Background())
 	return nil
 }
 
-func (c *Server) setupPushService(logger log.Logger) error {
-	var opts []apns.Option
+func (c *Server) setupPushService(ctx context.Context, logger log.Logger) error {
+	host := apns.Production
+	if c.APNSSandbox {
+		host = apns.Sandbox
+	}
+	opts := []apns.Option{
+		apns.WithHost(host),
+		apns.WithLogger(log.With(logger, "component", "apns")),
+		apns.WithDispatch(apns.DefaultPushWindow, c.APNSPushWorkers, c.APNSPushRate),
+		apns.WithMetrics(apns.Metrics{
+			Latency:   expvar.NewHistogram("apns_push_latency_seconds", 50),
+			Succeeded: expvar.NewCounter("apns_push_succeeded"),
+			Failed:    expvar.NewCounter("apns_push_failed"),
+			Retried:   expvar.NewCounter("apns_push_retried"),
+			Coalesced: expvar.NewCounter("apns_push_coalesced"),
+			Dropped:   expvar.NewCounter("apns_push_dropped"),
+		}),
+	}
+	if c.APNSTokenKeyPath != "" {
+		token, err := c.loadPushToken()
+		if err != nil {
+			return err
+		}
+		opts = append(opts, apns.WithToken(token))
+		goto after
+	}
 	{
 		cert, _ := c.ConfigDB.PushCertificate()
 		if c.PushCert.Certificate != nil && cert == nil {
@@ -327,21 +388,16 @@ func (c *Server) setupPushService(logger log.Logger) error {
 		if cert == nil {
 			goto after
 		}
-		client, err := push.NewClient(*cert)
+		client, err := apns.NewClient(*cert, host)
 		if err != nil {
 			return err
 		}
-		svc := push.NewService(client, push.Production)
-		opts = append(opts, apns.WithPushService(svc))
+		opts = append(opts, apns.WithClient(client))
 	}
 after:
 
-	db, err := apnsbuiltin.NewDB(c.DB, c.PubClient)
-	if err != nil {
-		return err
-	}
-
-	service, err := apns.New(db, c.ConfigDB, c.PubClient, opts...)
+	db := c.Stores.Push
+	service, err := apns.New(ctx, db, c.ConfigDB, c.PubClient, opts...)
 	if err != nil {
 		return errors.Wrap(err, "starting micromdm push service")
 	}
@@ -352,10 +408,19 @@ after:
 	pushinfoWorker := apns.NewWorker(db, c.PubClient, logger)
 	go pushinfoWorker.Run(context.Background())
 
+	if c.NudgeInterval > 0 {
+		nudger := nudge.New(c.Stores.Queue, c.Stores.Device, service,
+			log.With(logger, "component", "nudge"),
+			nudge.WithSchedule(c.NudgeInterval, c.NudgeMaxInterval, c.NudgeMaxAge),
+			nudge.WithLeader(c.Leader.Held),
+		)
+		go nudger.Run(context.Background())
+	}
+
 	return nil
 }
 
-func (c *Server) setupEnrollmentService() error {
+func (c *Server) setupEnrollmentService(logger log.Logger) error {
 	var topicProvider enroll.TopicProvider
 	var err error
 	if c.PushCert.Certificate != nil {
@@ -380,6 +445,7 @@ func (c *Server) setupEnrollmentService() error {
 		c.TLSCertPath,
 		SCEPCertificateSubject,
 		c.ProfileDB,
+		log.With(logger, "component", "enroll"),
 	)
 	if err != nil {
 		return err
@@ -395,79 +461,91 @@ func (p staticTopicProvider) PushTopic() (string, error) {
 	return p.topic, nil
 }
 
-func (c *Server) setupDepClient() error {
-	var (
-		conf           dep.OAuthParameters
-		depsim         = c.Depsim
-		hasTokenConfig bool
-		opts           []dep.Option
-	)
+// setupDepClient creates a DEP client for every DEP token. The -depsim
+// flag replaces the client of the default token, with "builtin" starting the
+// in-process DEP simulator.
+func (c *Server) setupDepClient(logger log.Logger) error {
+	c.DEPClients = make(map[string]*dep.Client)
 
 	// try getting the oauth config from bolt
 	tokens, err := c.ConfigDB.DEPTokens()
 	if err != nil {
 		return err
 	}
-	if len(tokens) >= 1 {
-		hasTokenConfig = true
-		conf.ConsumerSecret = tokens[0].ConsumerSecret
-		conf.ConsumerKey = tokens[0].ConsumerKey
-		conf.AccessSecret = tokens[0].AccessSecret
-		conf.AccessToken = tokens[0].AccessToken
-		// TODO: handle expiration
+	for _, tok := range tokens {
+		name := tok.InstanceName()
+		if _, ok := c.DEPClients[name]; ok {
+			// tokens stored before they were named are all the default token.
+			level.Info(logger).Log(
+				"msg", "skipping DEP token with duplicate name, re-apply it with mdmctl apply dep-tokens -name",
+				"name", name,
+				"consumer_key", tok.ConsumerKey,
+			)
+			continue
+		}
+		conf := dep.OAuthParameters{
+			ConsumerSecret: tok.ConsumerSecret,
+			ConsumerKey:    tok.ConsumerKey,
+			AccessSecret:   tok.AccessSecret,
+			AccessToken:    tok.AccessToken,
+		}
+		if !tok.AccessTokenExpiry.IsZero() && time.Now().After(tok.AccessTokenExpiry) {
+			// Apple refuses expired tokens, the sync retries until it is renewed.
+			level.Warn(logger).Log(
+				"msg", "DEP token has expired, apply a new one with mdmctl apply dep-tokens",
+				"name", name,
+				"access_token_expiry", tok.AccessTokenExpiry,
+			)
+		}
+		c.DEPClients[name] = dep.NewClient(conf)
 	}
 
 	// override with depsim keys if specified on CLI
-	if depsim != "" {
-		hasTokenConfig = true
-		conf = dep.OAuthParameters{
-			ConsumerKey:    "CK_48dd68d198350f51258e885ce9a5c37ab7f98543c4a697323d75682a6c10a32501cb247e3db08105db868f73f2c972bdb6ae77112aea803b9219eb52689d42e6",
-			ConsumerSecret: "CS_34c7b2b531a600d99a0e4edcf4a78ded79b86ef318118c2f5bcfee1b011108c32d5302df801adbe29d446eb78f02b13144e323eb9aad51c79f01e50cb45c3a68",
-			AccessToken:    "AT_927696831c59ba510cfe4ec1a69e5267c19881257d4bca2906a99d0785b785a6f6fdeb09774954fdd5e2d0ad952e3af52c6d8d2f21c924ba0caf4a031c158b89",
-			AccessSecret:   "AS_c31afd7a09691d83548489336e8ff1cb11b82b6bca13f793344496a556b1f4972eaff4dde6deb5ac9cf076fdfa97ec97699c34d515947b9cf9ed31c99dded6ba",
+	if depsimURL := c.Depsim; depsimURL != "" {
+		if depsimURL == "builtin" {
+			sim := depsim.New()
+			sim.AddDevices(depsim.SampleDevices(10)...)
+			u, err := sim.Listen("127.0.0.1:0")
+			if err != nil {
+				return err
+			}
+			level.Info(logger).Log("msg", "started builtin DEP simulator", "url", u)
+			depsimURL = u.String()
 		}
-		depsimurl, err := url.Parse(depsim)
+		u, err := url.Parse(depsimURL)
 		if err != nil {
 			return err
 		}
-		opts = append(opts, dep.WithServerURL(depsimurl))
-	}
-
-	if !hasTokenConfig {
-		return nil
+		c.DEPClients[config.DefaultDEPTokenName] = dep.NewClient(depsim.Credentials, dep.WithServerURL(u))
 	}
-
-	c.DEPClient = dep.NewClient(conf, opts...)
 	return nil
 }
 
+// CreateDEPSyncer starts a DEP sync for every DEP token, and for tokens which
+// are added later.
 func (c *Server) CreateDEPSyncer(logger log.Logger) (sync.Syncer, error) {
-	client := c.DEPClient
-	opts := []sync.Option{
-		sync.WithLogger(log.With(logger, "component", "depsync")),
+	clients := make(map[string]sync.Client, len(c.DEPClients))
+	for name, client := range c.DEPClients {
+		clients[name] = client
 	}
-	if client != nil {
-		opts = append(opts, sync.WithClient(client))
-	}
-
-	syncdb, err := syncbuiltin.NewDB(c.DB)
-	if err != nil {
-		return nil, err
-	}
-	c.SyncDB = syncdb
-
-	var syncer sync.Syncer
-	syncer, err = sync.NewWatcher(c.SyncDB, c.PubClient, opts...)
-	if err != nil {
-		return nil, err
-	}
-	return syncer, nil
+	return sync.NewWatchers(c.SyncDB, c.PubClient, log.With(logger, "component", "depsync"), clients,
+		sync.WithDeviceAttributes(device.New(c.DeviceDB, c.PubClient)),
+		sync.WithLeader(c.Leader.Held),
+	)
 }
 
 func (c *Server) setupSCEP(logger log.Logger) error {
-	depot, err := boltdepot.NewBoltDepot(c.DB)
-	if err != nil {
-		return err
+	depot := c.Stores.SCEPDepot
+	if depot == nil {
+		// the backend does not store the SCEP depot, keep it in BoltDB.
+		if err := c.setupBolt(); err != nil {
+			return err
+		}
+		boltDepot, err := boltdepot.NewBoltDepot(c.DB)
+		if err != nil {
+			return err
+		}
+		depot = boltDepot
 	}
 
 	key, err := depot.CreateOrLoadKey(2048)
@@ -12,9 +12,15 @@ type AcknowledgeEvent struct {
 	CommandUUID string            `json:"command_uuid"`
 	Params      map[string]string `json:"url_params"`
 	RawPayload  []byte            `json:"raw_payload"`
+
+	// Set by the enriched format.
+	Payload     map[string]interface{} `json:"payload,omitempty"`
+	RequestType string                 `json:"request_type,omitempty"`
+	BatchID     string                 `json:"batch_id,omitempty"`
+	BlueprintID string                 `json:"blueprint_id,omitempty"`
 }
 
-func acknowledgeEvent(topic string, data []byte) (*Event, error) {
+func (w *Worker) acknowledgeEvent(topic string, data []byte) (*Event, error) {
 	var ev mdm.AcknowledgeEvent
 	if err := mdm.UnmarshalAcknowledgeEvent(data, &ev); err != nil {
 		return nil, errors.Wrap(err, "unmarshal acknowledge event for webhook")
@@ -33,5 +39,9 @@ func acknowledgeEvent(topic string, data []byte) (*Event, error) {
 		},
 	}
 
+	if w.format == FormatEnriched {
+		w.enrichAcknowledge(&ev, &webhookEvent)
+	}
+
 	return &webhookEvent, nil
 }
@@ -10,9 +10,12 @@ type CheckinEvent struct {
 	UDID       string            `json:"udid"`
 	Params     map[string]string `json:"url_params"`
 	RawPayload []byte            `json:"raw_payload"`
+
+	// Set by the enriched format.
+	Payload map[string]interface{} `json:"payload,omitempty"`
 }
 
-func checkinEvent(topic string, data []byte) (*Event, error) {
+func (w *Worker) checkinEvent(topic string, data []byte) (*Event, error) {
 	var ev mdm.CheckinEvent
 	if err := mdm.UnmarshalCheckinEvent(data, &ev); err != nil {
 		return nil, errors.Wrap(err, "unmarshal checkin event for webhook")
@@ -30,5 +33,9 @@ func checkinEvent(topic string, data []byte) (*Event, error) {
 		},
 	}
 
+	if w.format == FormatEnriched {
+		w.enrichCheckin(&ev, &webhookEvent)
+	}
+
 	return &webhookEvent, nil
 }
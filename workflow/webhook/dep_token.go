@@ -0,0 +1,27 @@
+package webhook
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/config"
+)
+
+func depTokenEvent(topic string, data []byte) (*Event, error) {
+	var info config.DEPTokenInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, errors.Wrap(err, "unmarshal DEP token event for webhook")
+	}
+
+	webhookEvent := Event{
+		Topic:     topic,
+		EventID:   uuid.NewV4().String(),
+		CreatedAt: time.Now().UTC(),
+
+		DEPTokenEvent: &info,
+	}
+	return &webhookEvent, nil
+}
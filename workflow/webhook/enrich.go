@@ -0,0 +1,240 @@
+package webhook
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/groob/plist"
+	"github.com/pkg/errors"
+
+	"github.com/vishnuvaradaraj/micromdm/mdm"
+	"github.com/vishnuvaradaraj/micromdm/platform/command"
+	"github.com/vishnuvaradaraj/micromdm/platform/device"
+)
+
+// Format selects the shape of the events posted to a webhook endpoint.
+type Format string
+
+const (
+	// FormatRaw posts the check-in and acknowledge events with the raw plist payload.
+	FormatRaw Format = "raw"
+
+	// FormatEnriched additionally decodes the plist payload into JSON and
+	// attaches the device and the originating command request.
+	FormatEnriched Format = "enriched"
+)
+
+// ParseFormat returns the Format for a string. An empty string is FormatRaw.
+func ParseFormat(s string) (Format, error) {
+	switch Format(s) {
+	case "", FormatRaw:
+		return FormatRaw, nil
+	case FormatEnriched:
+		return FormatEnriched, nil
+	default:
+		return "", errors.Errorf("unknown webhook format %q", s)
+	}
+}
+
+// DeviceStore is used by the enriched format to look up device details.
+type DeviceStore interface {
+	DeviceByUDID(udid string) (*device.Device, error)
+}
+
+// Device is the subset of device details included in enriched events.
+type Device struct {
+	SerialNumber string `json:"serial_number,omitempty"`
+	Model        string `json:"model,omitempty"`
+	ModelName    string `json:"model_name,omitempty"`
+	DeviceName   string `json:"device_name,omitempty"`
+
+	// Attributes and Tags are the custom attributes and tags of the device.
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Tags       []string          `json:"tags,omitempty"`
+}
+
+// decodePayload converts a raw plist payload into a JSON friendly map.
+func decodePayload(raw []byte) (map[string]interface{}, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	var payload map[string]interface{}
+	if err := plist.Unmarshal(raw, &payload); err != nil {
+		return nil, errors.Wrap(err, "decode plist payload for webhook")
+	}
+	return payload, nil
+}
+
+func (w *Worker) lookupDevice(udid string) *Device {
+	if w.devices == nil || udid == "" {
+		return nil
+	}
+	dev, err := w.devices.DeviceByUDID(udid)
+	if err != nil {
+		return nil
+	}
+	return &Device{
+		SerialNumber: dev.SerialNumber,
+		Model:        dev.Model,
+		ModelName:    dev.ModelName,
+		DeviceName:   dev.DeviceName,
+		Attributes:   dev.Attributes,
+		Tags:         dev.Tags,
+	}
+}
+
+// enrichAcknowledge adds the decoded payload, the device and the queued command
+// to an acknowledge event. A payload which cannot be decoded is left out.
+func (w *Worker) enrichAcknowledge(ev *mdm.AcknowledgeEvent, event *Event) {
+	ack := event.AcknowledgeEvent
+	payload, err := decodePayload(ev.Raw)
+	if err != nil {
+		level.Info(w.logger).Log("msg", "enrich webhook event", "udid", ev.Response.UDID, "err", err)
+	}
+	ack.Payload = payload
+	event.Device = w.lookupDevice(ev.Response.UDID)
+
+	if ev.Response.CommandUUID == "" {
+		return
+	}
+	cmd, ok := w.commands.get(ev.Response.CommandUUID)
+	if !ok {
+		return
+	}
+	ack.RequestType = cmd.RequestType
+	ack.BatchID = cmd.BatchID
+	ack.BlueprintID = cmd.BlueprintID
+	if ev.Response.Status != "NotNow" {
+		w.commands.delete(ev.Response.CommandUUID)
+	}
+}
+
+// enrichCheckin adds the decoded payload and the device to a checkin event. A
+// payload which cannot be decoded is left out.
+func (w *Worker) enrichCheckin(ev *mdm.CheckinEvent, event *Event) {
+	payload, err := decodePayload(ev.Raw)
+	if err != nil {
+		level.Info(w.logger).Log("msg", "enrich webhook event", "udid", ev.Command.UDID, "err", err)
+	}
+	event.CheckinEvent.Payload = payload
+	event.Device = w.lookupDevice(ev.Command.UDID)
+	if event.Device == nil && ev.Command.SerialNumber != "" {
+		// Authenticate arrives before the device is saved, but carries the details.
+		event.Device = &Device{
+			SerialNumber: ev.Command.SerialNumber,
+			Model:        ev.Command.Model,
+			ModelName:    ev.Command.ModelName,
+			DeviceName:   ev.Command.DeviceName,
+		}
+	}
+}
+
+// commandInfo is what the enriched format knows about a queued command.
+type commandInfo struct {
+	RequestType string
+	BatchID     string
+	BlueprintID string
+	created     time.Time
+}
+
+const (
+	commandCacheSize = 10000
+	commandCacheTTL  = 7 * 24 * time.Hour
+)
+
+// commandCache remembers queued commands until they are acknowledged so that
+// responses can be matched with the request which created them. The entries
+// are kept in the order they were created in, so the oldest are evicted first
+// once the cache is full.
+type commandCache struct {
+	mtx      sync.Mutex
+	commands map[string]*list.Element
+	order    *list.List
+}
+
+type commandEntry struct {
+	uuid string
+	info commandInfo
+}
+
+func newCommandCache() *commandCache {
+	return &commandCache{
+		commands: make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (c *commandCache) get(uuid string) (commandInfo, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	elem, ok := c.commands[uuid]
+	if !ok {
+		return commandInfo{}, false
+	}
+	return elem.Value.(*commandEntry).info, true
+}
+
+func (c *commandCache) delete(uuid string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if elem, ok := c.commands[uuid]; ok {
+		c.order.Remove(elem)
+		delete(c.commands, uuid)
+	}
+}
+
+func (c *commandCache) update(uuid string, fn func(*commandInfo)) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	elem, ok := c.commands[uuid]
+	if !ok {
+		now := time.Now()
+		c.prune(now)
+		elem = c.order.PushBack(&commandEntry{uuid: uuid, info: commandInfo{created: now}})
+		c.commands[uuid] = elem
+	}
+	fn(&elem.Value.(*commandEntry).info)
+}
+
+// prune drops the expired entries, and the oldest entries while the cache is
+// full. Commands which are never acknowledged would otherwise grow the cache
+// without bound.
+func (c *commandCache) prune(now time.Time) {
+	for elem := c.order.Front(); elem != nil; elem = c.order.Front() {
+		entry := elem.Value.(*commandEntry)
+		if len(c.commands) < commandCacheSize && now.Sub(entry.info.created) <= commandCacheTTL {
+			return
+		}
+		c.order.Remove(elem)
+		delete(c.commands, entry.uuid)
+	}
+}
+
+func (c *commandCache) addCommand(data []byte) error {
+	var ev command.Event
+	if err := command.UnmarshalEvent(data, &ev); err != nil {
+		return errors.Wrap(err, "unmarshal command event for webhook")
+	}
+	if ev.Payload == nil || ev.Payload.Command == nil {
+		return nil
+	}
+	c.update(ev.Payload.CommandUUID, func(info *commandInfo) {
+		info.RequestType = ev.Payload.Command.RequestType
+	})
+	return nil
+}
+
+func (c *commandCache) addCorrelation(data []byte) error {
+	var ev command.CorrelationEvent
+	if err := command.UnmarshalCorrelationEvent(data, &ev); err != nil {
+		return errors.Wrap(err, "unmarshal command correlation event for webhook")
+	}
+	c.update(ev.CommandUUID, func(info *commandInfo) {
+		info.RequestType = ev.RequestType
+		info.BatchID = ev.Correlation.BatchID
+		info.BlueprintID = ev.Correlation.BlueprintID
+	})
+	return nil
+}
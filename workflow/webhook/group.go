@@ -0,0 +1,26 @@
+package webhook
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/group"
+)
+
+func groupEvent(topic string, data []byte) (*Event, error) {
+	var ev group.Event
+	if err := group.UnmarshalEvent(data, &ev); err != nil {
+		return nil, errors.Wrap(err, "unmarshal group membership event for webhook")
+	}
+
+	webhookEvent := Event{
+		Topic:     topic,
+		EventID:   uuid.NewV4().String(),
+		CreatedAt: time.Now().UTC(),
+
+		GroupEvent: &ev,
+	}
+	return &webhookEvent, nil
+}
@@ -0,0 +1,27 @@
+package webhook
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/config"
+)
+
+func pushCertificateEvent(topic string, data []byte) (*Event, error) {
+	var info config.PushCertificateInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, errors.Wrap(err, "unmarshal push certificate event for webhook")
+	}
+
+	webhookEvent := Event{
+		Topic:     topic,
+		EventID:   uuid.NewV4().String(),
+		CreatedAt: time.Now().UTC(),
+
+		PushCertificateEvent: &info,
+	}
+	return &webhookEvent, nil
+}
@@ -0,0 +1,26 @@
+package webhook
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/vishnuvaradaraj/micromdm/platform/stale"
+)
+
+func staleDeviceEvent(topic string, data []byte) (*Event, error) {
+	var a stale.Action
+	if err := stale.UnmarshalAction(data, &a); err != nil {
+		return nil, errors.Wrap(err, "unmarshal stale device action for webhook")
+	}
+
+	webhookEvent := Event{
+		Topic:     topic,
+		EventID:   uuid.NewV4().String(),
+		CreatedAt: time.Now().UTC(),
+
+		StaleDeviceEvent: &a,
+	}
+	return &webhookEvent, nil
+}
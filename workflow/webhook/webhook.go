@@ -10,7 +10,12 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/vishnuvaradaraj/micromdm/mdm"
+	"github.com/vishnuvaradaraj/micromdm/platform/command"
+	"github.com/vishnuvaradaraj/micromdm/platform/config"
+	"github.com/vishnuvaradaraj/micromdm/platform/device"
+	"github.com/vishnuvaradaraj/micromdm/platform/group"
 	"github.com/vishnuvaradaraj/micromdm/platform/pubsub"
+	"github.com/vishnuvaradaraj/micromdm/platform/stale"
 )
 
 type Event struct {
@@ -20,6 +25,14 @@ type Event struct {
 
 	AcknowledgeEvent *AcknowledgeEvent `json:"acknowledge_event,omitempty"`
 	CheckinEvent     *CheckinEvent     `json:"checkin_event,omitempty"`
+
+	PushCertificateEvent *config.PushCertificateInfo `json:"push_certificate_event,omitempty"`
+	DEPTokenEvent        *config.DEPTokenInfo        `json:"dep_token_event,omitempty"`
+	GroupEvent           *group.Event                `json:"group_event,omitempty"`
+	StaleDeviceEvent     *stale.Action               `json:"stale_device_event,omitempty"`
+
+	// Device is set by the enriched format.
+	Device *Device `json:"device,omitempty"`
 }
 
 type Worker struct {
@@ -27,6 +40,10 @@ type Worker struct {
 	url    string
 	client *http.Client
 	sub    pubsub.Subscriber
+
+	format   Format
+	devices  DeviceStore
+	commands *commandCache
 }
 
 type Option func(*Worker)
@@ -43,18 +60,38 @@ func WithHTTPClient(client *http.Client) Option {
 	}
 }
 
+// WithFormat sets the format of events posted to the endpoint.
+// The default is FormatRaw.
+func WithFormat(format Format) Option {
+	return func(w *Worker) {
+		w.format = format
+	}
+}
+
+// WithDeviceStore is used by the enriched format to include device details.
+func WithDeviceStore(devices DeviceStore) Option {
+	return func(w *Worker) {
+		w.devices = devices
+	}
+}
+
 func New(url string, sub pubsub.Subscriber, opts ...Option) *Worker {
 	worker := &Worker{
 		url:    url,
 		sub:    sub,
 		logger: log.NewNopLogger(),
 		client: http.DefaultClient,
+		format: FormatRaw,
 	}
 
 	for _, optFn := range opts {
 		optFn(worker)
 	}
 
+	if worker.format == FormatEnriched {
+		worker.commands = newCommandCache()
+	}
+
 	return worker
 }
 
@@ -81,6 +118,47 @@ func (w *Worker) Run(ctx context.Context) error {
 		return errors.Wrapf(err, "subscribe %s to %s", subscription, mdm.CheckoutTopic)
 	}
 
+	// the TokenUpdate of a re-enrolled device is sent again on its own topic.
+	reEnrollEvents, err := w.sub.Subscribe(ctx, subscription, device.DeviceReEnrolledTopic)
+	if err != nil {
+		return errors.Wrapf(err, "subscribe %s to %s", subscription, device.DeviceReEnrolledTopic)
+	}
+
+	pushCertEvents, err := w.sub.Subscribe(ctx, subscription, config.PushCertificateExpiringTopic)
+	if err != nil {
+		return errors.Wrapf(err, "subscribe %s to %s", subscription, config.PushCertificateExpiringTopic)
+	}
+
+	depTokenEvents, err := w.sub.Subscribe(ctx, subscription, config.DEPTokenExpiringTopic)
+	if err != nil {
+		return errors.Wrapf(err, "subscribe %s to %s", subscription, config.DEPTokenExpiringTopic)
+	}
+
+	groupEvents, err := w.sub.Subscribe(ctx, subscription, group.MembershipChangedTopic)
+	if err != nil {
+		return errors.Wrapf(err, "subscribe %s to %s", subscription, group.MembershipChangedTopic)
+	}
+
+	staleEvents, err := w.sub.Subscribe(ctx, subscription, stale.ActionTopic)
+	if err != nil {
+		return errors.Wrapf(err, "subscribe %s to %s", subscription, stale.ActionTopic)
+	}
+
+	// commands are only tracked for the enriched format; receiving from the
+	// nil channels blocks forever otherwise.
+	var commandEvents, correlationEvents <-chan pubsub.Event
+	if w.format == FormatEnriched {
+		commandEvents, err = w.sub.Subscribe(ctx, subscription, command.CommandTopic)
+		if err != nil {
+			return errors.Wrapf(err, "subscribe %s to %s", subscription, command.CommandTopic)
+		}
+
+		correlationEvents, err = w.sub.Subscribe(ctx, subscription, command.CorrelationTopic)
+		if err != nil {
+			return errors.Wrapf(err, "subscribe %s to %s", subscription, command.CorrelationTopic)
+		}
+	}
+
 	for {
 		var (
 			event *Event
@@ -89,14 +167,34 @@ func (w *Worker) Run(ctx context.Context) error {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
+		case ev := <-commandEvents:
+			if err := w.commands.addCommand(ev.Message); err != nil {
+				level.Info(w.logger).Log("msg", "track webhook command", "err", err)
+			}
+			continue
+		case ev := <-correlationEvents:
+			if err := w.commands.addCorrelation(ev.Message); err != nil {
+				level.Info(w.logger).Log("msg", "track webhook command", "err", err)
+			}
+			continue
 		case ev := <-ackEvents:
-			event, err = acknowledgeEvent(ev.Topic, ev.Message)
+			event, err = w.acknowledgeEvent(ev.Topic, ev.Message)
 		case ev := <-authenticateEvents:
-			event, err = checkinEvent(ev.Topic, ev.Message)
+			event, err = w.checkinEvent(ev.Topic, ev.Message)
 		case ev := <-tokenUpdateEvents:
-			event, err = checkinEvent(ev.Topic, ev.Message)
+			event, err = w.checkinEvent(ev.Topic, ev.Message)
 		case ev := <-checkoutEvents:
-			event, err = checkinEvent(ev.Topic, ev.Message)
+			event, err = w.checkinEvent(ev.Topic, ev.Message)
+		case ev := <-reEnrollEvents:
+			event, err = w.checkinEvent(ev.Topic, ev.Message)
+		case ev := <-pushCertEvents:
+			event, err = pushCertificateEvent(ev.Topic, ev.Message)
+		case ev := <-depTokenEvents:
+			event, err = depTokenEvent(ev.Topic, ev.Message)
+		case ev := <-groupEvents:
+			event, err = groupEvent(ev.Topic, ev.Message)
+		case ev := <-staleEvents:
+			event, err = staleDeviceEvent(ev.Topic, ev.Message)
 		}
 
 		if err != nil {
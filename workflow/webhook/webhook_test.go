@@ -0,0 +1,229 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/vishnuvaradaraj/micromdm/mdm"
+	mdmcmd "github.com/vishnuvaradaraj/micromdm/mdm/mdm"
+	"github.com/vishnuvaradaraj/micromdm/platform/command"
+	"github.com/vishnuvaradaraj/micromdm/platform/device"
+)
+
+type deviceStore map[string]*device.Device
+
+func (s deviceStore) DeviceByUDID(udid string) (*device.Device, error) {
+	dev, ok := s[udid]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return dev, nil
+}
+
+const ackPayload = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>CommandUUID</key>
+	<string>cmd-1</string>
+	<key>QueryResponses</key>
+	<dict>
+		<key>OSVersion</key>
+		<string>10.14</string>
+	</dict>
+	<key>Status</key>
+	<string>Acknowledged</string>
+	<key>UDID</key>
+	<string>udid-1</string>
+</dict>
+</plist>`
+
+func TestEnrichedAcknowledgeEvent(t *testing.T) {
+	w := New("http://example.com", nil,
+		WithFormat(FormatEnriched),
+		WithDeviceStore(deviceStore{"udid-1": {
+			UDID:         "udid-1",
+			SerialNumber: "C02ABC",
+			Model:        "MacBookPro15,1",
+			DeviceName:   "laptop",
+			Attributes:   map[string]string{"department": "Sales"},
+			Tags:         []string{"loaner"},
+		}}),
+	)
+
+	cmdMsg, err := command.MarshalEvent(command.NewEvent(&mdmcmd.CommandPayload{
+		CommandUUID: "cmd-1",
+		Command:     &mdmcmd.Command{RequestType: "DeviceInformation"},
+	}, "udid-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.commands.addCommand(cmdMsg); err != nil {
+		t.Fatal(err)
+	}
+	corrMsg, err := command.MarshalCorrelationEvent(&command.CorrelationEvent{
+		CommandUUID: "cmd-1",
+		DeviceUDID:  "udid-1",
+		RequestType: "DeviceInformation",
+		Correlation: command.Correlation{BatchID: "batch-1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.commands.addCorrelation(corrMsg); err != nil {
+		t.Fatal(err)
+	}
+
+	ackMsg, err := mdm.MarshalAcknowledgeEvent(&mdm.AcknowledgeEvent{
+		ID:   "event-1",
+		Time: time.Now(),
+		Response: mdm.Response{
+			UDID:        "udid-1",
+			Status:      "Acknowledged",
+			CommandUUID: "cmd-1",
+		},
+		Raw: []byte(ackPayload),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event, err := w.acknowledgeEvent(mdm.ConnectTopic, ackMsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ack := event.AcknowledgeEvent
+	if have, want := ack.RequestType, "DeviceInformation"; have != want {
+		t.Errorf("have %s, want %s", have, want)
+	}
+	if have, want := ack.BatchID, "batch-1"; have != want {
+		t.Errorf("have %s, want %s", have, want)
+	}
+	if event.Device == nil {
+		t.Fatal("expected device details in enriched event")
+	}
+	if have, want := event.Device.SerialNumber, "C02ABC"; have != want {
+		t.Errorf("have %s, want %s", have, want)
+	}
+	if have, want := event.Device.Attributes["department"], "Sales"; have != want {
+		t.Errorf("have department %s, want %s", have, want)
+	}
+	if have := event.Device.Tags; len(have) != 1 || have[0] != "loaner" {
+		t.Errorf("have tags %v, want [loaner]", have)
+	}
+	responses, ok := ack.Payload["QueryResponses"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected decoded QueryResponses, got %#v", ack.Payload)
+	}
+	if have, want := responses["OSVersion"], "10.14"; have != want {
+		t.Errorf("have %s, want %s", have, want)
+	}
+
+	// acknowledged commands are no longer tracked.
+	if _, ok := w.commands.get("cmd-1"); ok {
+		t.Error("expected acknowledged command to be removed from cache")
+	}
+}
+
+func TestEnrichedEventUndecodablePayload(t *testing.T) {
+	w := New("http://example.com", nil, WithFormat(FormatEnriched))
+	ackMsg, err := mdm.MarshalAcknowledgeEvent(&mdm.AcknowledgeEvent{
+		ID:       "event-1",
+		Time:     time.Now(),
+		Response: mdm.Response{UDID: "udid-1", Status: "Acknowledged"},
+		Raw:      []byte("not a plist"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event, err := w.acknowledgeEvent(mdm.ConnectTopic, ackMsg)
+	if err != nil {
+		t.Fatalf("expected the event to be sent without its payload, got %v", err)
+	}
+	if event.AcknowledgeEvent.Payload != nil {
+		t.Errorf("have payload %v, want none", event.AcknowledgeEvent.Payload)
+	}
+}
+
+func TestRawAcknowledgeEvent(t *testing.T) {
+	w := New("http://example.com", nil)
+	ackMsg, err := mdm.MarshalAcknowledgeEvent(&mdm.AcknowledgeEvent{
+		ID:       "event-1",
+		Time:     time.Now(),
+		Response: mdm.Response{UDID: "udid-1", Status: "Acknowledged"},
+		Raw:      []byte(ackPayload),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event, err := w.acknowledgeEvent(mdm.ConnectTopic, ackMsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.AcknowledgeEvent.Payload != nil || event.Device != nil {
+		t.Error("raw format must not include enriched fields")
+	}
+}
+
+func TestCommandCacheEvictsOldest(t *testing.T) {
+	c := newCommandCache()
+	for i := 0; i < commandCacheSize+10; i++ {
+		c.update(fmt.Sprintf("cmd-%d", i), func(info *commandInfo) {
+			info.RequestType = "DeviceInformation"
+		})
+	}
+	if have, want := len(c.commands), commandCacheSize; have != want {
+		t.Fatalf("have %d cached commands, want %d", have, want)
+	}
+	for i := 0; i < 10; i++ {
+		if _, ok := c.get(fmt.Sprintf("cmd-%d", i)); ok {
+			t.Errorf("expected cmd-%d to be evicted", i)
+		}
+	}
+	for _, uuid := range []string{"cmd-10", fmt.Sprintf("cmd-%d", commandCacheSize+9)} {
+		if _, ok := c.get(uuid); !ok {
+			t.Errorf("expected %s to be kept", uuid)
+		}
+	}
+
+	// entries past the TTL are dropped regardless of the size of the cache
+	c = newCommandCache()
+	c.update("expired", func(*commandInfo) {})
+	c.commands["expired"].Value.(*commandEntry).info.created = time.Now().Add(-commandCacheTTL - time.Minute)
+	c.update("fresh", func(*commandInfo) {})
+	if _, ok := c.get("expired"); ok {
+		t.Error("expected the expired command to be pruned")
+	}
+	if _, ok := c.get("fresh"); !ok {
+		t.Error("expected the fresh command to be kept")
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	var tests = []struct {
+		in      string
+		want    Format
+		wantErr bool
+	}{
+		{in: "", want: FormatRaw},
+		{in: "raw", want: FormatRaw},
+		{in: "enriched", want: FormatEnriched},
+		{in: "xml", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			have, err := ParseFormat(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("have err %v, want err %v", err, tt.wantErr)
+			}
+			if have != tt.want {
+				t.Errorf("have %s, want %s", have, tt.want)
+			}
+		})
+	}
+}